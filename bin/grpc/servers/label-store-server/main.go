@@ -7,12 +7,16 @@ import (
 	"net"
 	"os"
 
+	"github.com/square/p2/pkg/grpc/authz"
+	"github.com/square/p2/pkg/grpc/interceptors"
 	"github.com/square/p2/pkg/grpc/labelstore"
 	label_protos "github.com/square/p2/pkg/grpc/labelstore/protos"
+	"github.com/square/p2/pkg/grpc/ratelimit"
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/flags"
+	consul_podstore "github.com/square/p2/pkg/store/consul/podstore"
 
 	"github.com/Sirupsen/logrus"
 	"google.golang.org/grpc"
@@ -28,6 +32,14 @@ var (
 
 type config struct {
 	Port int `yaml:"port"`
+
+	// Auth configures TLS and role-based authorization of API calls. If
+	// unset, the server accepts plaintext calls from anyone.
+	Auth authz.Config `yaml:"auth"`
+
+	// RateLimits protects consul from runaway clients. If unset, calls
+	// aren't limited.
+	RateLimits ratelimit.Config `yaml:"rate_limits"`
 }
 
 const defaultPort = 3000
@@ -43,25 +55,49 @@ func main() {
 	client := consul.NewConsulClient(opts)
 	applicator := labels.NewConsulApplicator(client, 1, 0)
 
-	port := getPort()
+	config := getConfig()
 
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", config.Port))
 	if err != nil {
 		logger.Fatalf("failed to listen: %v", err)
 	}
 
-	logrusLogger.Infof("Listening tcp on port %d", port)
-	s := grpc.NewServer()
+	serverOpts, err := config.Auth.ServerOptions()
+	if err != nil {
+		logger.Fatalf("failed to configure TLS: %v", err)
+	}
+
+	// Rate limits are enforced before authorization, which may read from
+	// consul
+	limiter, err := ratelimit.New(config.RateLimits)
+	if err != nil {
+		logger.Fatalf("failed to configure rate limits: %v", err)
+	}
+	unary := []grpc.UnaryServerInterceptor{limiter.UnaryInterceptor}
+	stream := []grpc.StreamServerInterceptor{limiter.StreamInterceptor}
+
+	authorizer, err := config.Auth.Authorizer(consul_podstore.NewConsul(client.KV()), applicator, logrusLogger)
+	if err != nil {
+		logger.Fatalf("failed to configure authorization: %v", err)
+	}
+	if authorizer != nil {
+		unary = append(unary, authorizer.UnaryInterceptor)
+		stream = append(stream, authorizer.StreamInterceptor)
+	}
+	serverOpts = append(serverOpts, interceptors.ServerOptions(unary, stream)...)
+
+	logrusLogger.Infof("Listening tcp on port %d", config.Port)
+	s := grpc.NewServer(serverOpts...)
 	label_protos.RegisterP2LabelStoreServer(s, labelstore.NewServer(applicator, logrusLogger))
 	if err := s.Serve(lis); err != nil {
 		logger.Fatalf("failed to serve: %v", err)
 	}
 }
 
-func getPort() int {
+func getConfig() config {
 	configPath := os.Getenv("CONFIG_PATH")
 	if configPath == "" {
-		return defaultPort
+		return config{Port: defaultPort}
 	}
 
 	configBytes, err := ioutil.ReadFile(configPath)
@@ -69,15 +105,15 @@ func getPort() int {
 		logger.Fatal(err)
 	}
 
-	var config config
-	err = yaml.Unmarshal(configBytes, &config)
+	var c config
+	err = yaml.Unmarshal(configBytes, &c)
 	if err != nil {
 		logger.Fatal(err)
 	}
 
-	if config.Port == 0 {
-		return defaultPort
+	if c.Port == 0 {
+		c.Port = defaultPort
 	}
 
-	return config.Port
+	return c
 }
@@ -6,13 +6,20 @@ import (
 	"log"
 	"net"
 	"os"
+	"time"
 
+	"github.com/square/p2/pkg/grpc/authz"
+	"github.com/square/p2/pkg/grpc/interceptors"
 	"github.com/square/p2/pkg/grpc/podstore"
 	podstore_protos "github.com/square/p2/pkg/grpc/podstore/protos"
+	"github.com/square/p2/pkg/grpc/ratelimit"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/flags"
 	consul_podstore "github.com/square/p2/pkg/store/consul/podstore"
 	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/idempotencystatus"
 	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
 
 	"google.golang.org/grpc"
@@ -21,37 +28,96 @@ import (
 
 type config struct {
 	Port int `yaml:"port"`
+
+	// Auth configures TLS and role-based authorization of API calls. If
+	// unset, the server accepts plaintext calls from anyone.
+	Auth authz.Config `yaml:"auth"`
+
+	// RateLimits protects consul from runaway clients. If unset, calls
+	// aren't limited.
+	RateLimits ratelimit.Config `yaml:"rate_limits"`
+
+	// IdempotencyTTL is how long idempotency keys passed to SchedulePod
+	// are honored, e.g. "24h"
+	IdempotencyTTL string `yaml:"idempotency_ttl"`
 }
 
 const defaultPort = 3000
 
+// How often expired idempotency keys are deleted from consul
+const idempotencyPruneInterval = 1 * time.Hour
+
 func main() {
 	// Parse custom flags + standard Consul routing options
 	_, opts, _ := flags.ParseWithConsulOptions()
 
 	client := consul.NewConsulClient(opts)
 	podStore := consul_podstore.NewConsul(client.KV())
-	podStatusStore := podstatus.NewConsul(statusstore.NewConsul(client), consul.PreparerPodStatusNamespace)
+	podStatusStore := podstatus.NewConsul(statusstore.NewConsul(client), statusstore.PreparerPodStatusNamespace)
+	idempotencyStore := idempotencystatus.NewConsul(statusstore.NewConsul(client), statusstore.SchedulePodIdempotencyNamespace)
 
 	logger := log.New(os.Stderr, "", 0)
-	port := getPort(logger)
+	config := getConfig(logger)
+
+	idempotencyTTL := podstore.DefaultIdempotencyTTL
+	if config.IdempotencyTTL != "" {
+		var err error
+		idempotencyTTL, err = time.ParseDuration(config.IdempotencyTTL)
+		if err != nil || idempotencyTTL <= 0 {
+			logger.Fatalf("invalid idempotency_ttl %q", config.IdempotencyTTL)
+		}
+	}
+	go pruneIdempotencyKeys(idempotencyStore, idempotencyTTL, logger)
 
-	lis, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", port))
+	lis, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", config.Port))
 	if err != nil {
 		logger.Fatalf("failed to listen: %v", err)
 	}
 
-	s := grpc.NewServer()
-	podstore_protos.RegisterP2PodStoreServer(s, podstore.NewServer(podStore, podStatusStore, client))
+	serverOpts, err := config.Auth.ServerOptions()
+	if err != nil {
+		logger.Fatalf("failed to configure TLS: %v", err)
+	}
+
+	// Rate limits are enforced before authorization, which may read from
+	// consul
+	limiter, err := ratelimit.New(config.RateLimits)
+	if err != nil {
+		logger.Fatalf("failed to configure rate limits: %v", err)
+	}
+	unary := []grpc.UnaryServerInterceptor{limiter.UnaryInterceptor}
+	stream := []grpc.StreamServerInterceptor{limiter.StreamInterceptor}
+
+	authorizer, err := config.Auth.Authorizer(podStore, labels.NewConsulApplicator(client, 1, 0), logging.DefaultLogger)
+	if err != nil {
+		logger.Fatalf("failed to configure authorization: %v", err)
+	}
+	if authorizer != nil {
+		unary = append(unary, authorizer.UnaryInterceptor)
+		stream = append(stream, authorizer.StreamInterceptor)
+	}
+	serverOpts = append(serverOpts, interceptors.ServerOptions(unary, stream)...)
+
+	s := grpc.NewServer(serverOpts...)
+	podstore_protos.RegisterP2PodStoreServer(s, podstore.NewServer(podStore, podStatusStore, idempotencyStore, idempotencyTTL, client))
 	if err := s.Serve(lis); err != nil {
 		logger.Fatalf("failed to serve: %v", err)
 	}
 }
 
-func getPort(logger *log.Logger) int {
+func pruneIdempotencyKeys(idempotencyStore idempotencystatus.ConsulStore, ttl time.Duration, logger *log.Logger) {
+	for range time.Tick(idempotencyPruneInterval) {
+		err := idempotencyStore.DeleteExpired(ttl)
+		if err != nil {
+			logger.Printf("could not delete expired idempotency keys: %v", err)
+		}
+	}
+}
+
+func getConfig(logger *log.Logger) config {
 	configPath := os.Getenv("CONFIG_PATH")
 	if configPath == "" {
-		return defaultPort
+		return config{Port: defaultPort}
 	}
 
 	configBytes, err := ioutil.ReadFile(configPath)
@@ -59,15 +125,15 @@ func getPort(logger *log.Logger) int {
 		logger.Fatal(err)
 	}
 
-	var config config
-	err = yaml.Unmarshal(configBytes, &config)
+	var c config
+	err = yaml.Unmarshal(configBytes, &c)
 	if err != nil {
 		logger.Fatal(err)
 	}
 
-	if config.Port == 0 {
+	if c.Port == 0 {
 		logger.Fatal("Port must be set")
 	}
 
-	return config.Port
+	return c
 }
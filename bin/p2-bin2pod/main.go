@@ -45,6 +45,7 @@ var (
 	location      = bin2pod.Flag("location", "The location where the outputted tar will live. The characters {} will be replaced with the unique basename of the tar, including its SHA. If not provided, the location will be a file path to the resulting tar from the build, which is included in the output of this script. Users must copy the resultant tar to the new location if it is different from the default output path.").String()
 	workDirectory = bin2pod.Flag("work-dir", "A directory where the results will be written.").ExistingDir()
 	config        = bin2pod.Flag("config", "a list of key=value assignments. Each key will be set in the config section.").Strings()
+	hook          = bin2pod.Flag("hook", "Make the pod a hook pod, which the preparer installs into its hooks directory instead of launching").Bool()
 )
 
 type result struct {
@@ -72,12 +73,13 @@ func activeDir() string {
 }
 
 func main() {
-	bin2pod.Version(version.VERSION)
+	version.Register(bin2pod)
 	kingpin.MustParse(bin2pod.Parse(os.Args[1:]))
 
 	res := result{}
 	manifestBuilder := manifest.NewBuilder()
 	manifestBuilder.SetID(podID())
+	manifestBuilder.SetHook(*hook)
 
 	stanza := launch.LaunchableStanza{}
 	stanza.LaunchableType = "hoist"
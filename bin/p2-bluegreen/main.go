@@ -0,0 +1,117 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/go-cleanhttp"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/bluegreen"
+	"github.com/square/p2/pkg/health/checker"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/store/consul/podstore"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/version"
+	"github.com/square/p2/pkg/webhook"
+)
+
+var (
+	manifestURI        = kingpin.Arg("manifest", "a path or url to the pod manifest of the new version").Required().URL()
+	hosts              = kingpin.Arg("hosts", "Hosts to deploy to").Required().Strings()
+	launchTimeout      = kingpin.Flag("launch-timeout", "How long to wait for the new version to launch and pass its health checks on every host").Default("10m").Duration()
+	verificationWindow = kingpin.Flag("verification-window", "How long the new version must run after traffic is flipped to it before the old version is removed").Default("5m").Duration()
+	webhookConfig      = kingpin.Flag("webhook-config", "Path to a YAML file listing webhook endpoints to notify of the deployment's events").ExistingFile()
+)
+
+// How long to wait for the last webhook events to be delivered before exiting
+const webhookFlushTimeout = 30 * time.Second
+
+func main() {
+	kingpin.CommandLine.Name = "p2-bluegreen"
+	kingpin.CommandLine.Help = `p2-bluegreen performs a blue/green deployment of a pod. See the bluegreen package's godoc for more information.
+
+	Example invocation: p2-bluegreen helloworld.yaml aws{1,2,3}.example.com
+
+	This will start the pod whose manifest is located at helloworld.yaml
+	alongside the currently live version on each of the three nodes, flip the
+	"bluegreen_traffic" pod label to it once it has launched and is healthy
+	everywhere, and
+	remove the old version after the verification window passes.
+`
+
+	version.Register(kingpin.CommandLine)
+	_, opts, labeler := flags.ParseWithConsulOptions()
+	client := consul.NewConsulClient(opts)
+	podStore := podstore.NewConsul(client.KV())
+	podStatusStore := podstatus.NewConsul(statusstore.NewConsul(client), statusstore.PreparerPodStatusNamespace)
+
+	manifest, err := manifest.FromURI(*manifestURI)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+
+	logger := logging.NewLogger(logrus.Fields{
+		"pod": manifest.ID(),
+	})
+	logger.Logger.Formatter = &logrus.TextFormatter{
+		DisableTimestamp: false,
+		FullTimestamp:    true,
+		TimestampFormat:  "15:04:05.000",
+	}
+
+	nodes := make([]types.NodeName, len(*hosts))
+	for i, host := range *hosts {
+		nodes[i] = types.NodeName(host)
+	}
+
+	deployment := bluegreen.NewDeployment(
+		manifest,
+		nodes,
+		podStore,
+		podStatusStore,
+		labeler,
+		checker.NewHealthChecker(client),
+		logger,
+		*launchTimeout,
+		*verificationWindow,
+	)
+
+	var httpNotifier *webhook.HTTPNotifier
+	if *webhookConfig != "" {
+		config, err := webhook.LoadConfig(*webhookConfig)
+		if err != nil {
+			logger.WithError(err).Fatalln("Unable to load webhook config")
+		}
+		httpNotifier = webhook.NewHTTPNotifier(config, cleanhttp.DefaultClient(), logger)
+		go httpNotifier.Start(nil)
+		deployment.Notifier = httpNotifier
+	}
+
+	// roll back on ctrl-C
+	quit := make(chan struct{})
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt)
+		<-signals
+		close(quit)
+	}()
+
+	start := time.Now()
+	err = deployment.Run(quit)
+	if httpNotifier != nil && !httpNotifier.Flush(webhookFlushTimeout) {
+		logger.NoFields().Warnln("Some webhook events were not delivered")
+	}
+	if err != nil {
+		logger.WithError(err).Fatalln("Blue/green deployment failed and was rolled back")
+	}
+	logger.WithField("duration", time.Since(start)).Infoln("Blue/green deployment complete")
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/hashicorp/consul/api"
 	"github.com/square/p2/pkg/artifact"
 	"github.com/square/p2/pkg/auth"
+	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/osversion"
 	"github.com/square/p2/pkg/pods"
@@ -31,10 +32,14 @@ var (
 	podRoot            = kingpin.Flag("pod-root", "The root of where pods will be installed").Default(pods.DefaultPath).String()
 	registryURL        = kingpin.Flag("registry", "The URL of the registry to download artifacts from").URL()
 	requireFile        = kingpin.Flag("require-file", "Check for the presence of a required file before execing its argument").String()
+	basePodPaths       = kingpin.Flag("base-pod", "A path to the manifest of a pod that every node runs, e.g. a health daemon or hooks. It is scheduled for this host and installed by the base agent. Can be passed multiple times.").ExistingFiles()
+	nodeLabels         = kingpin.Flag("label", "A label to apply to this node, as key=value. Can be passed multiple times.").StringMap()
+	convergeTimeout    = kingpin.Flag("converge-timeout", "How long to wait for every bootstrapped pod to appear in the reality store.").Default("30s").Duration()
+	bake               = kingpin.Flag("bake", "Only install consul, the base agent and the base pods, without launching them or contacting consul, for baking them into a machine image. Bootstrapping a host booted from the image then skips fetching their artifacts.").Bool()
 )
 
 func main() {
-	kingpin.Version(version.VERSION)
+	version.Register(kingpin.CommandLine)
 	kingpin.Parse()
 	log.Println("Starting bootstrap")
 	hostname, err := os.Hostname()
@@ -44,13 +49,38 @@ func main() {
 	nodeName := types.NodeName(hostname)
 	agentManifest, err := manifest.FromPath(*agentManifestPath)
 	if err != nil {
-		log.Fatalln("Could not get agent manifest: %s", err)
+		log.Fatalf("Could not get agent manifest: %s", err)
+	}
+	var baseManifests []manifest.Manifest
+	for _, path := range *basePodPaths {
+		baseManifest, err := manifest.FromPath(path)
+		if err != nil {
+			log.Fatalf("Could not get base pod manifest %s: %s", path, err)
+		}
+		baseManifests = append(baseManifests, baseManifest)
 	}
-	log.Println("Installing and launching consul")
 
 	// TODO: configure a proper http client instead of using default for fetcher
 	podFactory := pods.NewFactory(*podRoot, nodeName, uri.DefaultFetcher, *requireFile, pods.NewReadOnlyPolicy(false, nil, nil))
 
+	if *bake {
+		toBake := append([]manifest.Manifest{agentManifest}, baseManifests...)
+		if *consulManifestPath != "" {
+			consulManifest, err := manifest.FromPath(*consulManifestPath)
+			if err != nil {
+				log.Fatalf("Could not get consul manifest: %s", err)
+			}
+			toBake = append([]manifest.Manifest{consulManifest}, toBake...)
+		}
+		if err = bakePods(podFactory, toBake, *registryURL); err != nil {
+			log.Fatalln(err)
+		}
+		log.Println("Baking complete")
+		return
+	}
+
+	log.Println("Installing and launching consul")
+
 	var consulPod *pods.Pod
 	var consulManifest manifest.Manifest
 	if *existingConsul == "" {
@@ -61,9 +91,13 @@ func main() {
 
 		// Consul will never have a uuid (for now)
 		consulPod = podFactory.NewLegacyPod(consulManifest.ID())
-		err = installConsul(consulPod, consulManifest, *registryURL)
-		if err != nil {
-			log.Fatalf("Could not install consul: %s", err)
+		if isInstalled(consulPod, consulManifest) {
+			log.Println("Consul is already installed, skipping")
+		} else {
+			err = installConsul(consulPod, consulManifest, *registryURL)
+			if err != nil {
+				log.Fatalf("Could not install consul: %s", err)
+			}
 		}
 	} else {
 		log.Printf("Using existing Consul at %s\n", *existingConsul)
@@ -94,17 +128,77 @@ func main() {
 	if err != nil {
 		log.Fatalf("Could not register base agent with consul: %s", err)
 	}
+	for _, baseManifest := range baseManifests {
+		log.Printf("Registering base pod %s in consul\n", baseManifest.ID())
+		err = scheduleForThisHost(baseManifest, false)
+		if err != nil {
+			log.Fatalf("Could not register base pod %s with consul: %s", baseManifest.ID(), err)
+		}
+	}
+	if len(*nodeLabels) > 0 {
+		log.Println("Applying node labels")
+		err = applyNodeLabels(nodeName, *nodeLabels)
+		if err != nil {
+			log.Fatalf("Could not apply node labels: %s", err)
+		}
+	}
+
 	log.Println("Installing and launching base agent")
 	err = installBaseAgent(podFactory, agentManifest, *registryURL)
 	if err != nil {
 		log.Fatalf("Could not install base agent: %s", err)
 	}
-	if err := verifyReality(30*time.Second, consulManifest.ID(), agentManifest.ID()); err != nil {
+
+	expected := append([]manifest.Manifest{consulManifest, agentManifest}, baseManifests...)
+	if err := verifyReality(*convergeTimeout, expected); err != nil {
 		log.Fatalln(err)
 	}
 	log.Println("Bootstrapping complete")
 }
 
+// isInstalled returns true if the pod has already been installed and
+// launched with the given manifest, in which case installing it again is
+// unnecessary.
+func isInstalled(pod *pods.Pod, desired manifest.Manifest) bool {
+	current, err := pod.CurrentManifest()
+	if err != nil {
+		return false
+	}
+	return sameManifest(current, desired)
+}
+
+func sameManifest(a manifest.Manifest, b manifest.Manifest) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	aSHA, err := a.SHA()
+	if err != nil {
+		return false
+	}
+	bSHA, err := b.SHA()
+	if err != nil {
+		return false
+	}
+	return aSHA == bSHA
+}
+
+// bakePods installs each pod without launching it, so that the pod's
+// artifacts are already in place when a host booted from the image being
+// baked is bootstrapped. Launching the pods is left to that bootstrap, or to
+// the preparer.
+func bakePods(podFactory pods.Factory, manifests []manifest.Manifest, registryURL *url.URL) error {
+	registry := artifact.NewRegistry(registryURL, uri.DefaultFetcher, osversion.DefaultDetector)
+	for _, man := range manifests {
+		log.Printf("Installing %s\n", man.ID())
+		pod := podFactory.NewLegacyPod(man.ID())
+		err := pod.Install(man, auth.NopVerifier(), registry, "")
+		if err != nil {
+			return util.Errorf("Could not install %s: %s", man.ID(), err)
+		}
+	}
+	return nil
+}
+
 func installConsul(consulPod *pods.Pod, consulManifest manifest.Manifest, registryURL *url.URL) error {
 	// Inject servicebuilder?
 	err := consulPod.Install(consulManifest, auth.NopVerifier(), artifact.NewRegistry(registryURL, uri.DefaultFetcher, osversion.DefaultDetector), "")
@@ -174,9 +268,9 @@ func verifyConsulUp(timeout string) error {
 	}
 }
 
-func verifyReality(waitTime time.Duration, consulID types.PodID, agentID types.PodID) error {
-	quit := make(chan struct{})
-	defer close(quit)
+// verifyReality waits until every expected pod is in the reality store for
+// this host with the expected manifest.
+func verifyReality(waitTime time.Duration, expected []manifest.Manifest) error {
 	store := consul.NewConsulStore(consul.NewConsulClient(consul.Options{
 		Token: *consulToken,
 	}))
@@ -185,28 +279,28 @@ func verifyReality(waitTime time.Duration, consulID types.PodID, agentID types.P
 		return err
 	}
 	waitChan := time.After(waitTime)
-	hasConsul := false
-	hasPreparer := false
+	var missing []types.PodID
 	for {
 		select {
 		case <-waitChan:
-			return util.Errorf(
-				"Consul and/or Preparer weren't in the reality store within %s (consul=%t, preparer=%t)",
-				waitTime, hasConsul, hasPreparer)
+			return util.Errorf("Pods weren't in the reality store within %s: %v", waitTime, missing)
 		case <-time.After(100 * time.Millisecond):
 			results, _, err := store.ListPods(consul.REALITY_TREE, types.NodeName(hostname))
 			if err != nil {
 				log.Printf("Error looking for pods: %s\n", err)
 				continue
 			}
+			reality := make(map[types.PodID]manifest.Manifest)
 			for _, res := range results {
-				if res.Manifest.ID() == consulID {
-					hasConsul = true
-				} else if res.Manifest.ID() == agentID {
-					hasPreparer = true
+				reality[res.Manifest.ID()] = res.Manifest
+			}
+			missing = nil
+			for _, man := range expected {
+				if !sameManifest(reality[man.ID()], man) {
+					missing = append(missing, man.ID())
 				}
 			}
-			if hasConsul && hasPreparer {
+			if len(missing) == 0 {
 				return nil
 			}
 		}
@@ -221,21 +315,57 @@ func scheduleForThisHost(manifest manifest.Manifest, alsoReality bool) error {
 	if err != nil {
 		return err
 	}
-	_, err = store.SetPod(consul.INTENT_TREE, types.NodeName(hostname), manifest)
-	if err != nil {
-		return err
+	trees := []consul.PodPrefix{consul.INTENT_TREE}
+	if alsoReality {
+		trees = append(trees, consul.REALITY_TREE)
+	}
+	for _, tree := range trees {
+		existing, _, err := store.Pod(tree, types.NodeName(hostname), manifest.ID())
+		if err != nil && err != pods.NoCurrentManifest {
+			return err
+		}
+		if sameManifest(existing, manifest) {
+			log.Printf("%s is already in the %s tree, skipping\n", manifest.ID(), tree)
+			continue
+		}
+		_, err = store.SetPod(tree, types.NodeName(hostname), manifest)
+		if err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	if alsoReality {
-		_, err = store.SetPod(consul.REALITY_TREE, types.NodeName(hostname), manifest)
+// applyNodeLabels sets any of the given labels that the node doesn't already
+// have.
+func applyNodeLabels(nodeName types.NodeName, desired map[string]string) error {
+	applicator := labels.NewConsulApplicator(consul.NewConsulClient(consul.Options{
+		Token: *consulToken,
+	}), 0, 0)
+	current, err := applicator.GetLabels(labels.NODE, nodeName.String())
+	if err != nil {
 		return err
 	}
-	return nil
+	changed := make(map[string]string)
+	for key, value := range desired {
+		if !current.Labels.Has(key) || current.Labels.Get(key) != value {
+			changed[key] = value
+		}
+	}
+	if len(changed) == 0 {
+		log.Println("Node labels are already applied, skipping")
+		return nil
+	}
+	return applicator.SetLabels(labels.NODE, nodeName.String(), changed)
 }
 
 func installBaseAgent(podFactory pods.Factory, agentManifest manifest.Manifest, registryURL *url.URL) error {
 	// preparer will never have a uuid (for now)
 	agentPod := podFactory.NewLegacyPod(agentManifest.ID())
+	if isInstalled(agentPod, agentManifest) {
+		log.Println("Base agent is already installed, skipping")
+		return nil
+	}
 	err := agentPod.Install(agentManifest, auth.NopVerifier(), artifact.NewRegistry(registryURL, uri.DefaultFetcher, osversion.DefaultDetector), "")
 	if err != nil {
 		return err
@@ -146,7 +146,7 @@ func scanCgroup(dirname string) (*Output, error) {
 }
 
 func main() {
-	app.Version(version.VERSION)
+	version.Register(app)
 	kingpin.MustParse(app.Parse(os.Args[1:]))
 	logger := log.New(os.Stderr, "", 0)
 
@@ -0,0 +1,65 @@
+// p2-cordon marks nodes as unschedulable. Replication controllers, daemon sets
+// and node allocations don't put new pods on a cordoned node, but the pods
+// already running there are left alone, unlike draining the node.
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/scheduler"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/version"
+)
+
+const (
+	CmdCordon   = "cordon"
+	CmdUncordon = "uncordon"
+	CmdList     = "list"
+)
+
+var (
+	cmdCordon  = kingpin.Command(CmdCordon, "Stop new pods from being scheduled on a node. Its running pods are not touched.")
+	cordonNode = cmdCordon.Arg("node", "The node to cordon").Required().String()
+
+	cmdUncordon  = kingpin.Command(CmdUncordon, "Let new pods be scheduled on a cordoned node again.")
+	uncordonNode = cmdUncordon.Arg("node", "The node to uncordon").Required().String()
+
+	cmdList = kingpin.Command(CmdList, "List the cordoned nodes.")
+)
+
+func main() {
+	kingpin.CommandLine.Name = "p2-cordon"
+	version.Register(kingpin.CommandLine)
+	cmd, _, applicator := flags.ParseWithConsulOptions()
+
+	switch cmd {
+	case CmdCordon:
+		err := applicator.SetLabel(labels.NODE, *cordonNode, types.CordonedLabel, "true")
+		if err != nil {
+			log.Fatalf("Could not cordon %s: %s", *cordonNode, err)
+		}
+		fmt.Printf("Cordoned %s\n", *cordonNode)
+	case CmdUncordon:
+		err := applicator.RemoveLabel(labels.NODE, *uncordonNode, types.CordonedLabel)
+		if err != nil {
+			log.Fatalf("Could not uncordon %s: %s", *uncordonNode, err)
+		}
+		fmt.Printf("Uncordoned %s\n", *uncordonNode)
+	case CmdList:
+		cordoned, err := scheduler.CordonedNodes(applicator)
+		if err != nil {
+			log.Fatalf("Could not list cordoned nodes: %s", err)
+		}
+		if cordoned.Len() == 0 {
+			fmt.Println("No nodes are cordoned")
+		}
+		for _, node := range cordoned.ListNodes() {
+			fmt.Println(node)
+		}
+	}
+}
@@ -49,7 +49,7 @@ func main() {
 	healthChecker := checker.NewHealthChecker(client)
 
 	rawStatusStore := statusstore.NewConsul(client)
-	statusStore := daemonsetstatus.NewConsul(rawStatusStore, ds_farm.DaemonSetStatusNamespace)
+	statusStore := daemonsetstatus.NewConsul(rawStatusStore, statusstore.DaemonSetStatusNamespace)
 
 	sessions := make(chan string)
 	go consulutil.SessionManager(api.SessionEntry{
@@ -48,7 +48,7 @@ var (
 )
 
 func main() {
-	kingpin.Version(version.VERSION)
+	version.Register(kingpin.CommandLine)
 	kingpin.Parse()
 
 	if *umask != umaskDefault {
@@ -0,0 +1,115 @@
+// p2-health-blackout manages the health blackout windows of pods. Critical
+// health results that are checked during one of a pod's windows are marked as
+// suppressed, and deploys treat them as passing.
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/version"
+)
+
+const (
+	CmdList  = "list"
+	CmdAdd   = "add"
+	CmdClear = "clear"
+)
+
+var (
+	cmdList   = kingpin.Command(CmdList, "List the blackout windows of a pod.")
+	listPodID = cmdList.Arg("pod", "The pod whose windows to list").Required().String()
+
+	cmdAdd   = kingpin.Command(CmdAdd, "Add a blackout window to a pod. Give either --daily, or --start and --end.")
+	addPodID = cmdAdd.Arg("pod", "The pod to add a window to").Required().String()
+	addDaily = cmdAdd.Flag("daily", "A window that recurs every day, as two times of day in UTC, e.g. 02:00-02:30").String()
+	addStart = cmdAdd.Flag("start", "The start of a one-off window, in RFC3339 format").String()
+	addEnd   = cmdAdd.Flag("end", "The end of a one-off window, in RFC3339 format").String()
+
+	cmdClear   = kingpin.Command(CmdClear, "Remove every blackout window of a pod.")
+	clearPodID = cmdClear.Arg("pod", "The pod whose windows to remove").Required().String()
+)
+
+func main() {
+	kingpin.CommandLine.Name = "p2-health-blackout"
+	version.Register(kingpin.CommandLine)
+	cmd, opts, _ := flags.ParseWithConsulOptions()
+	client := consul.NewConsulClient(opts)
+	store := consul.NewConsulStore(client)
+
+	switch cmd {
+	case CmdList:
+		windows, err := store.HealthBlackouts(types.PodID(*listPodID))
+		if err != nil {
+			log.Fatalf("Could not read blackout windows of %s: %s", *listPodID, err)
+		}
+		if len(windows) == 0 {
+			fmt.Printf("%s has no blackout windows\n", *listPodID)
+		}
+		for _, window := range windows {
+			fmt.Println(describeWindow(window))
+		}
+	case CmdAdd:
+		window, err := parseWindow()
+		if err != nil {
+			log.Fatalf("Invalid window: %s", err)
+		}
+		podID := types.PodID(*addPodID)
+		windows, err := store.HealthBlackouts(podID)
+		if err != nil {
+			log.Fatalf("Could not read blackout windows of %s: %s", podID, err)
+		}
+		err = store.SetHealthBlackouts(podID, append(windows, window))
+		if err != nil {
+			log.Fatalf("Could not add blackout window to %s: %s", podID, err)
+		}
+		fmt.Printf("Added blackout window to %s: %s\n", podID, describeWindow(window))
+	case CmdClear:
+		err := store.SetHealthBlackouts(types.PodID(*clearPodID), nil)
+		if err != nil {
+			log.Fatalf("Could not remove blackout windows of %s: %s", *clearPodID, err)
+		}
+		fmt.Printf("Removed blackout windows of %s\n", *clearPodID)
+	}
+}
+
+func parseWindow() (health.BlackoutWindow, error) {
+	var window health.BlackoutWindow
+	if *addDaily != "" {
+		parts := strings.Split(*addDaily, "-")
+		if len(parts) != 2 {
+			return window, fmt.Errorf("--daily must be two times of day separated by a dash, e.g. 02:00-02:30")
+		}
+		window.DailyStart, window.DailyEnd = parts[0], parts[1]
+	}
+	if *addStart != "" {
+		start, err := time.Parse(time.RFC3339, *addStart)
+		if err != nil {
+			return window, fmt.Errorf("invalid --start: %s", err)
+		}
+		window.Start = start
+	}
+	if *addEnd != "" {
+		end, err := time.Parse(time.RFC3339, *addEnd)
+		if err != nil {
+			return window, fmt.Errorf("invalid --end: %s", err)
+		}
+		window.End = end
+	}
+	return window, window.Validate()
+}
+
+func describeWindow(window health.BlackoutWindow) string {
+	if window.DailyStart != "" {
+		return fmt.Sprintf("daily from %s to %s UTC", window.DailyStart, window.DailyEnd)
+	}
+	return fmt.Sprintf("from %s to %s", window.Start.Format(time.RFC3339), window.End.Format(time.RFC3339))
+}
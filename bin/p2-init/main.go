@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/version"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	clusterName = kingpin.Arg("name", "The name of the cluster, e.g. production-east").Required().String()
+	help        = `p2-init records the name of the p2 cluster, along with the versions of the
+schemas of the records p2 keeps in Consul, so that command line tools can
+check which cluster they are pointed at. A cluster can only be initialized
+once.
+`
+)
+
+func main() {
+	version.Register(kingpin.CommandLine)
+	kingpin.CommandLine.Help = help
+	_, opts, _ := flags.ParseWithConsulOptions()
+
+	store := consul.NewConsulStore(consul.NewConsulClient(opts))
+	existing, err := store.ClusterMetadata()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if existing != nil {
+		log.Fatalf("The cluster has already been initialized as %s on %s", existing.Name, existing.CreatedAt.Format("2006-01-02"))
+	}
+
+	metadata, err := store.InitClusterMetadata(*clusterName)
+	if err != nil {
+		log.Fatalf("Could not initialize the cluster: %s", err)
+	}
+	fmt.Printf("Initialized cluster %s with schema versions %v\n", metadata.Name, metadata.SchemaVersions)
+}
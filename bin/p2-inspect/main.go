@@ -13,6 +13,9 @@ import (
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/hookstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/processstatus"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/version"
 )
@@ -24,7 +27,7 @@ var (
 )
 
 func main() {
-	kingpin.Version(version.VERSION)
+	version.Register(kingpin.CommandLine)
 	_, opts, _ := flags.ParseWithConsulOptions()
 	client := consul.NewConsulClient(opts)
 	store := consul.NewConsulStore(client)
@@ -92,6 +95,66 @@ func main() {
 
 			old := statusMap[podID][node]
 			old.Health = result.Status
+			old.HealthCheck = result.Check
+			statusMap[podID][node] = old
+		}
+	}
+
+	processStatusStore := processstatus.NewConsul(statusstore.NewConsul(client), statusstore.ProcessExitStatusNamespace)
+	hookStatusStore := hookstatus.NewConsul(statusstore.NewConsul(client), statusstore.HookStatusNamespace)
+	nodes := make(map[types.NodeName]bool)
+	for _, nodeStatuses := range statusMap {
+		for node := range nodeStatuses {
+			nodes[node] = true
+		}
+	}
+	for node := range nodes {
+		processStatus, _, err := processStatusStore.Get(node)
+		if statusstore.IsNoStatus(err) {
+			continue
+		} else if err != nil {
+			log.Fatalf("Could not retrieve process exits for node %s: %s", node, err)
+		}
+
+		for podID, processStatuses := range processStatus.Pods {
+			old, ok := statusMap[podID][node]
+			if !ok {
+				continue
+			}
+			old.ProcessStatuses = processStatuses
+			statusMap[podID][node] = old
+		}
+	}
+	for node := range nodes {
+		hookStatus, _, err := hookStatusStore.Get(node)
+		if statusstore.IsNoStatus(err) {
+			continue
+		} else if err != nil {
+			log.Fatalf("Could not retrieve hook results for node %s: %s", node, err)
+		}
+
+		for podID, hookResults := range hookStatus.Pods {
+			old, ok := statusMap[podID][node]
+			if !ok {
+				continue
+			}
+			old.HookResults = hookResults
+			statusMap[podID][node] = old
+		}
+	}
+
+	conflicts, err := store.IntentConflicts(filterNodeName)
+	if err != nil {
+		log.Fatalf("Could not retrieve conflicting deploys: %s", err)
+	}
+	for podID, nodeConflicts := range conflicts {
+		for node, write := range nodeConflicts {
+			old, ok := statusMap[podID][node]
+			if !ok {
+				continue
+			}
+			write := write
+			old.ConflictingDeploys = &write
 			statusMap[podID][node] = old
 		}
 	}
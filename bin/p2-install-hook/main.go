@@ -29,7 +29,7 @@ var (
 )
 
 func main() {
-	kingpin.Version(version.VERSION)
+	version.Register(kingpin.CommandLine)
 	kingpin.Parse()
 
 	if *nodeName == "" {
@@ -19,7 +19,7 @@ var (
 )
 
 func main() {
-	kingpin.Version(version.VERSION)
+	version.Register(kingpin.CommandLine)
 	kingpin.Parse()
 
 	if err := setSTDINToBlock(); err != nil {
@@ -1,21 +1,51 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"gopkg.in/alecthomas/kingpin.v2"
 
+	"github.com/square/p2/pkg/health"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/preparer"
+	"github.com/square/p2/pkg/util"
 	"github.com/square/p2/pkg/util/param"
 	"github.com/square/p2/pkg/version"
 	"github.com/square/p2/pkg/watch"
 )
 
+var shutdown = kingpin.Flag(
+	"shutdown",
+	"Stop every pod on this node and mark the node as shutting down, then exit. Intended to be run from the ExecStop of a systemd unit when the host is going down",
+).Bool()
+
+var debugBundle = kingpin.Flag(
+	"debug-bundle",
+	"Write a gzipped tarball of the internal state of the preparer running on this node, fetched from its status server, to the given path, then exit. Useful for support escalations",
+).String()
+
+var checkHealth = kingpin.Flag(
+	"check-health",
+	"Have the preparer running on this node check the health of the given pod right away, print the result and exit. Useful right after a deploy, or when debugging a health check",
+).String()
+
+// How long to wait for each group of workers to stop at shutdown, in seconds
+var workerStopTimeout = param.Int("worker_stop_timeout", 30)
+
 func main() {
 	// Other packages define flags, and they need parsing here.
 	kingpin.Parse()
@@ -34,14 +64,32 @@ func main() {
 		logger.WithError(err).Fatalln("invalid parameter")
 	}
 
+	if *debugBundle != "" {
+		// this must happen before a status server is started, which
+		// would replace the running preparer's socket
+		err = fetchDebugBundle(preparerConfig, *debugBundle)
+		if err != nil {
+			logger.WithError(err).Fatalln("Could not fetch debug bundle")
+		}
+		logger.WithField("path", *debugBundle).Infoln("Wrote debug bundle")
+		return
+	}
+
+	if *checkHealth != "" {
+		// like fetching a debug bundle, this must happen before a status
+		// server is started
+		err = requestHealthCheck(preparerConfig, *checkHealth)
+		if err != nil {
+			logger.WithError(err).Fatalln("Could not check pod health")
+		}
+		return
+	}
+
 	statusServer, err := preparer.NewStatusServer(preparerConfig.StatusPort, preparerConfig.StatusSocket, &logger)
 	if err == preparer.NoServerConfigured {
 		logger.NoFields().Warningln("No status port or socket provided, no status server configured")
 	} else if err != nil {
 		logger.WithError(err).Fatalln("Could not start status server")
-	} else {
-		go statusServer.Serve()
-		defer statusServer.Close()
 	}
 
 	if preparerConfig.RequireFile != "" {
@@ -60,6 +108,29 @@ func main() {
 	}
 	defer prep.Close()
 
+	healthRegistry := watch.NewHealthRegistry()
+	if prep.Supervisor != nil {
+		healthRegistry.Observe(prep.Supervisor.Observe)
+	}
+	if statusServer != nil {
+		statusServer.SetConsulLiveness(prep.ConsulLiveness)
+		statusServer.AddDebugSection("preparer", prep.DebugSnapshot)
+		statusServer.AddDebugSection("health_monitor", healthRegistry.Snapshot)
+		statusServer.AddHandler("/_health/check", http.HandlerFunc(healthRegistry.ServeCheck))
+		go statusServer.Serve()
+		defer statusServer.Close()
+	}
+
+	if *shutdown {
+		logger.NoFields().Infoln("Shutting down all pods on this node")
+		err = prep.Shutdown()
+		if err != nil {
+			logger.WithError(err).Fatalln("Node shutdown did not complete cleanly")
+		}
+		logger.NoFields().Infoln("All pods halted")
+		return
+	}
+
 	logger.WithFields(logrus.Fields{
 		"starting":    true,
 		"node_name":   preparerConfig.NodeName,
@@ -69,10 +140,15 @@ func main() {
 		"auth_type":   preparerConfig.Auth["type"],
 		"keyring":     preparerConfig.Auth["keyring"],
 		"version":     version.VERSION,
+		"git_sha":     version.GitSHA,
 	}).Infoln("Preparer started successfully")
 
+	err = prep.MarkNodeRunning()
+	if err != nil {
+		logger.WithError(err).Errorln("Could not mark node as running")
+	}
+
 	quitMainUpdate := make(chan struct{})
-	var quitChans []chan struct{}
 
 	// Install the latest hooks before any pods are processed
 	err = prep.InstallHooks()
@@ -87,40 +163,164 @@ func main() {
 
 	go prep.WatchForPodManifestsForNode(quitMainUpdate)
 
+	// Every other worker stops when workCtx is cancelled
+	workCtx, stopWork := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	runWorker := func(run func(quit <-chan struct{})) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(workCtx.Done())
+		}()
+	}
+
+	runWorker(prep.WatchForPrefetchRequests)
+	runWorker(prep.ConsulLiveness.Run)
+	runWorker(prep.ResourceUsageReporter.Run)
+	if prep.ClockSkew != nil {
+		runWorker(prep.ClockSkew.Run)
+	}
 	if prep.PodProcessReporter != nil {
-		quitPodProcessReporter := make(chan struct{})
-		quitChans = append(quitChans, quitPodProcessReporter)
-		go prep.PodProcessReporter.Run(quitPodProcessReporter)
+		runWorker(func(quit <-chan struct{}) {
+			err := prep.PodProcessReporter.Run(quit)
+			if err != nil {
+				logger.WithError(err).Errorln("Pod process reporter exited")
+			}
+		})
+	}
+	if prep.ArtifactCache != nil {
+		runWorker(prep.ArtifactCache.Serve)
 	}
 
 	// Launch health checking watch. This watch tracks health of
 	// all pods on this host and writes the information to consul
-	quitMonitorPodHealth := make(chan struct{})
+	healthCtx, stopHealth := context.WithCancel(context.Background())
 	var wgHealth sync.WaitGroup
 	wgHealth.Add(1)
 	go func() {
 		defer wgHealth.Done()
-		watch.MonitorPodHealth(preparerConfig, &logger, quitMonitorPodHealth)
+		watch.MonitorPodHealth(healthCtx, preparerConfig, &logger, healthRegistry)
 	}()
 
-	waitForTermination(logger, quitMainUpdate, quitChans)
+	waitForTermination(logger, quitMainUpdate, stopWork)
+	waitWithTimeout(logger, "workers", &workers)
 
 	// The preparer should continue to report app health during a shutdown, so terminate
 	// the health monitor last.
-	close(quitMonitorPodHealth)
-	wgHealth.Wait()
+	stopHealth()
+	waitWithTimeout(logger, "health monitor", &wgHealth)
 
 	logger.NoFields().Infoln("Terminating")
 }
 
-func waitForTermination(logger logging.Logger, quitMainUpdate chan struct{}, quitChans []chan struct{}) {
+func waitForTermination(logger logging.Logger, quitMainUpdate chan struct{}, stopWork context.CancelFunc) {
 	signalCh := make(chan os.Signal, 2)
 	signal.Notify(signalCh, syscall.SIGTERM, os.Interrupt)
 	received := <-signalCh
 	logger.WithField("signal", received.String()).Infoln("Stopping work")
-	for _, quitCh := range quitChans {
-		close(quitCh)
-	}
+	stopWork()
 	quitMainUpdate <- struct{}{}
 	<-quitMainUpdate // acknowledgement
 }
+
+// waitWithTimeout waits for wg for up to *workerStopTimeout, so that a
+// worker that doesn't stop can't hold up the preparer's exit forever
+func waitWithTimeout(logger logging.Logger, name string, wg *sync.WaitGroup) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	timeout := time.Duration(*workerStopTimeout) * time.Second
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		logger.WithFields(logrus.Fields{
+			"component": name,
+			"timeout":   timeout,
+		}).Warnln("Gave up waiting for shutdown")
+	}
+}
+
+// statusServerClient returns a client for the status server of the running
+// preparer and the URL that the server's endpoints are relative to
+func statusServerClient(config *preparer.PreparerConfig) (*http.Client, string, error) {
+	client := &http.Client{Timeout: 1 * time.Minute}
+	switch {
+	case config.StatusPort != 0:
+		return client, fmt.Sprintf("http://localhost:%d", config.StatusPort), nil
+	case config.StatusSocket != "":
+		client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", config.StatusSocket)
+			},
+		}
+		// the host is ignored when dialing the socket
+		return client, "http://preparer", nil
+	default:
+		return nil, "", preparer.NoServerConfigured
+	}
+}
+
+// fetchDebugBundle downloads a debug bundle from the status server of the
+// running preparer and writes it to path
+func fetchDebugBundle(config *preparer.PreparerConfig, path string) error {
+	client, baseURL, err := statusServerClient(config)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Get(baseURL + "/_debug/bundle")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return util.Errorf("status server returned %s", resp.Status)
+	}
+
+	return util.WriteAtomic(path, util.AtomicWriteOptions{Perm: 0600, UID: -1, GID: -1}, func(w io.Writer) error {
+		_, err := io.Copy(w, resp.Body)
+		return err
+	})
+}
+
+// requestHealthCheck has the running preparer check the health of a pod and
+// prints the result
+func requestHealthCheck(config *preparer.PreparerConfig, podID string) error {
+	client, baseURL, err := statusServerClient(config)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.PostForm(baseURL+"/_health/check?"+url.Values{"pod": {podID}}.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return util.Errorf("status server returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var res health.Result
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return util.Errorf("could not decode health check result: %s", err)
+	}
+	fmt.Printf("%s: %s\n", res.ID, describeStatus(res.Status, res.Reason))
+	if res.Addresses != nil {
+		for _, address := range res.Addresses.Results {
+			fmt.Printf("  %s: %s\n", address.Address, describeStatus(address.Status, address.Reason))
+		}
+	}
+	return nil
+}
+
+func describeStatus(status health.HealthState, reason health.Reason) string {
+	if reason == "" {
+		return string(status)
+	}
+	return fmt.Sprintf("%s (%s)", status, reason)
+}
@@ -12,10 +12,12 @@ import (
 	"gopkg.in/alecthomas/kingpin.v2"
 
 	"github.com/hashicorp/go-cleanhttp"
+	"golang.org/x/crypto/openpgp"
 	klabels "k8s.io/kubernetes/pkg/labels"
 
 	"github.com/square/p2/pkg/alerting"
 	"github.com/square/p2/pkg/artifact"
+	"github.com/square/p2/pkg/auth"
 	"github.com/square/p2/pkg/health/checker"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/osversion"
@@ -33,12 +35,16 @@ import (
 	"github.com/square/p2/pkg/uri"
 	"github.com/square/p2/pkg/util/stream"
 	"github.com/square/p2/pkg/version"
+	"github.com/square/p2/pkg/webhook"
 )
 
 // Command arguments
 var (
 	logLevel            = kingpin.Flag("log", "Logging level to display").String()
 	pagerdutyServiceKey = kingpin.Flag("pagerduty-service-key", "Pagerduty Service Key to use for alerting if provided").String()
+	webhookConfig       = kingpin.Flag("webhook-config", "Path to a YAML file listing webhook endpoints to notify of rolling update events").ExistingFile()
+	dryRun              = kingpin.Flag("dry-run", "Instead of scheduling or unscheduling pods, record the changes each replication controller would make in its status. View them with p2-rctl dry-run-report").Bool()
+	approversKeyring    = kingpin.Flag("approvers-keyring", "Path to a keyring holding the keys of the operators who may approve rolling updates of protected pods. Without it, rolling updates of protected pods never get past their canary").ExistingFile()
 )
 
 // RetryCount defines the number of retries to attempt when accessing some storage
@@ -58,7 +64,7 @@ func SessionName() string {
 
 func main() {
 	// Parse custom flags + standard Consul routing options
-	kingpin.Version(version.VERSION)
+	version.Register(kingpin.CommandLine)
 	_, opts, labeler := flags.ParseWithConsulOptions()
 
 	// Set up the logger
@@ -79,11 +85,18 @@ func main() {
 	statusStoreClient := statusstore.NewConsul(client)
 	consulStore := consul.NewConsulStore(client)
 	rcStore := rcstore.NewConsul(client, labeler, RetryCount)
-	rcStatusStore := rcstatus.NewConsul(statusStoreClient, consul.RCStatusNamespace)
+	rcStatusStore := rcstatus.NewConsul(statusStoreClient, statusstore.RCStatusNamespace)
 
 	rollStore := rollstore.NewConsul(client, labeler, nil)
 	healthChecker := checker.NewHealthChecker(client)
-	shadowTrafficHealthChecker := checker.NewShadowTrafficHealthChecker(nil, nil, client, nil, nil, false, false)
+	// rolling updates ask for the health of their pods after every roll
+	// delay, so serve that from a cache instead of listing it each time
+	shadowTrafficHealthChecker := checker.NewCachingChecker(
+		checker.NewShadowTrafficHealthChecker(nil, nil, client, nil, nil, false, false),
+		client,
+		1*time.Second,
+		10*time.Minute,
+	)
 	sched := scheduler.NewApplicatorScheduler(labeler)
 
 	// Start acquiring sessions
@@ -109,6 +122,26 @@ func main() {
 		}
 	}
 
+	var notifier webhook.Notifier = webhook.NewNop()
+	if *webhookConfig != "" {
+		config, err := webhook.LoadConfig(*webhookConfig)
+		if err != nil {
+			logger.WithError(err).Fatalln("Unable to load webhook config")
+		}
+		httpNotifier := webhook.NewHTTPNotifier(config, httpClient, logger)
+		go httpNotifier.Start(nil)
+		notifier = httpNotifier
+	}
+
+	var approverKeyring openpgp.KeyRing
+	if *approversKeyring != "" {
+		keyring, err := auth.LoadKeyring(*approversKeyring)
+		if err != nil {
+			logger.WithError(err).Fatalln("Unable to load approvers' keyring")
+		}
+		approverKeyring = keyring
+	}
+
 	auditLogStore := auditlogstore.NewConsulStore(client.KV())
 
 	fetcher := uri.BasicFetcher{Client: opts.Client}
@@ -134,13 +167,24 @@ func main() {
 		alerter,
 		1*time.Second,
 		artifactRegistry,
+		*dryRun,
 	).Start(nil)
+
+	if *dryRun {
+		// rolling updates change the replica counts of RCs, which is
+		// exactly what a dry run must not do
+		logger.NoFields().Infoln("Running in dry-run mode, not starting the rolling update farm")
+		select {}
+	}
+
 	roll.NewFarm(
 		roll.UpdateFactory{
-			Store:         consulStore,
-			RCStore:       rcStore,
-			HealthChecker: shadowTrafficHealthChecker,
-			Labeler:       labeler,
+			Store:           consulStore,
+			RCStore:         rcStore,
+			HealthChecker:   shadowTrafficHealthChecker,
+			Labeler:         labeler,
+			Notifier:        notifier,
+			ApproverKeyring: approverKeyring,
 		},
 		consulStore,
 		rollStore,
@@ -150,7 +194,7 @@ func main() {
 		labeler,
 		klabels.Everything(),
 		client.KV(),
-		roll.FarmConfig{},
+		roll.FarmConfig{Notifier: notifier},
 		alerter,
 	).Start(nil)
 }
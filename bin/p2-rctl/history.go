@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/rc/fields"
+)
+
+type rcHistoryEntry struct {
+	timestamp time.Time
+	eventType audit.EventType
+	details   audit.RCMutationDetails
+}
+
+// History prints every mutation recorded in the audit log for the given RC,
+// oldest first, showing who made it, through which interface, and the
+// fields it changed
+func (r rctlParams) History(id fields.ID) {
+	auditLogs, err := r.auditLogs.List()
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not list audit log records")
+	}
+
+	isRCMutation := make(map[audit.EventType]bool)
+	for _, eventType := range audit.RCMutationEvents {
+		isRCMutation[eventType] = true
+	}
+
+	var entries []rcHistoryEntry
+	for _, auditLog := range auditLogs {
+		if !isRCMutation[auditLog.EventType] || auditLog.EventDetails == nil {
+			continue
+		}
+
+		var details audit.RCMutationDetails
+		err = json.Unmarshal([]byte(*auditLog.EventDetails), &details)
+		if err != nil {
+			r.logger.WithError(err).Warnln("Skipping malformed audit log record")
+			continue
+		}
+		if details.ReplicationControllerID != id {
+			continue
+		}
+
+		entries = append(entries, rcHistoryEntry{
+			timestamp: auditLog.Timestamp,
+			eventType: auditLog.EventType,
+			details:   details,
+		})
+	}
+
+	if len(entries) == 0 {
+		fmt.Printf("no history found for %s\n", id)
+		return
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].timestamp.Before(entries[j].timestamp)
+	})
+
+	for _, entry := range entries {
+		fmt.Printf("%s %s by %s (%s)\n", entry.timestamp.Format(time.RFC3339), entry.eventType, entry.details.User, entry.details.Source)
+		for _, change := range entry.details.Changes() {
+			if change.Field != "manifest" {
+				fmt.Printf("    %s: %q -> %q\n", change.Field, change.Old, change.New)
+				continue
+			}
+
+			fmt.Printf("    %s:\n", change.Field)
+			for _, line := range lineDiff(change.Old, change.New) {
+				fmt.Printf("        %s\n", line)
+			}
+		}
+	}
+}
+
+// lineDiff returns the lines of a minimal diff between two texts, each
+// prefixed with "-", "+" or " " for removed, added and unchanged lines
+func lineDiff(oldText, newText string) []string {
+	oldLines := splitLines(oldText)
+	newLines := splitLines(newText)
+
+	// lcs[i][j] is the length of the longest common subsequence of
+	// oldLines[i:] and newLines[j:]
+	lcs := make([][]int, len(oldLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(newLines)+1)
+	}
+	for i := len(oldLines) - 1; i >= 0; i-- {
+		for j := len(newLines) - 1; j >= 0; j-- {
+			if oldLines[i] == newLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff []string
+	i, j := 0, 0
+	for i < len(oldLines) && j < len(newLines) {
+		switch {
+		case oldLines[i] == newLines[j]:
+			diff = append(diff, " "+oldLines[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, "-"+oldLines[i])
+			i++
+		default:
+			diff = append(diff, "+"+newLines[j])
+			j++
+		}
+	}
+	for ; i < len(oldLines); i++ {
+		diff = append(diff, "-"+oldLines[i])
+	}
+	for ; j < len(newLines); j++ {
+		diff = append(diff, "+"+newLines[j])
+	}
+	return diff
+}
+
+func splitLines(text string) []string {
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
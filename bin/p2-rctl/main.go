@@ -4,9 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"os/signal"
+	"os/user"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -17,7 +20,9 @@ import (
 	klabels "k8s.io/kubernetes/pkg/labels"
 
 	"github.com/square/p2/pkg/alerting"
+	"github.com/square/p2/pkg/audit"
 	"github.com/square/p2/pkg/cli"
+	"github.com/square/p2/pkg/cohort"
 	"github.com/square/p2/pkg/health/checker"
 	hclient "github.com/square/p2/pkg/health/client"
 	"github.com/square/p2/pkg/labels"
@@ -38,7 +43,9 @@ import (
 	"github.com/square/p2/pkg/store/consul/statusstore"
 	"github.com/square/p2/pkg/store/consul/statusstore/rcstatus"
 	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/version"
+	"github.com/square/p2/pkg/webhook"
 )
 
 const (
@@ -48,19 +55,26 @@ const (
 	cmdListText           = "list"
 	cmdGetText            = "get"
 	cmdGetStatusText      = "get-status"
+	cmdDryRunReportText   = "dry-run-report"
 	cmdEnableText         = "enable"
 	cmdDisableText        = "disable"
 	cmdRollText           = "rolling-update"
 	cmdDeleteRollText     = "delete-rolling-update"
+	cmdApproveRollText    = "approve-rolling-update"
 	cmdSchedupText        = "schedule-update"
 	cmdUpdateManifestText = "update-manifest"
 	cmdUpdateStrategyText = "update-strategy"
+	cmdUpdateSelectorText = "update-node-selector"
+	cmdHistoryText        = "history"
 )
 
 var (
 	logLevel = kingpin.Flag("log", "Logging level to display.").String()
 	logJSON  = kingpin.Flag("log-json", "Log messages will be JSON formatted").Bool()
 
+	maxUnschedulePercent = kingpin.Flag("max-unschedule-percent", "Refuse to unschedule more than this percentage of a replication controller's pods in one operation unless it is confirmed with --confirm-unschedule. 0 means no limit").Default(strconv.Itoa(rc.DefaultUnscheduleLimits.MaxPercent)).Int()
+	maxUnschedulePods    = kingpin.Flag("max-unschedule-pods", "Refuse to unschedule more than this many of a replication controller's pods in one operation unless it is confirmed with --confirm-unschedule. 0 means no limit").Default(strconv.Itoa(rc.DefaultUnscheduleLimits.MaxPods)).Int()
+
 	cmdCreate                = kingpin.Command(cmdCreateText, "Create a new replication controller")
 	createManifest           = cmdCreate.Flag("manifest", "manifest file to use for this replication controller").Short('m').Required().String()
 	createNodeSel            = cmdCreate.Flag("node-selector", "node selector that this replication controller should target").Short('n').Required().String()
@@ -78,6 +92,9 @@ var (
 	replicasID  = cmdReplicas.Arg("id", "replication controller uuid to modify").Required().String()
 	replicasNum = cmdReplicas.Arg("replicas", "number of replicas desired").Required().Int()
 	yes         = cmdReplicas.Flag("yes", "auto confirm the replica change (i.e. no confirmation prompt)").Short('y').Bool()
+	// --yes doesn't confirm a mass unschedule, so that scripts can't
+	// skip the check by accident
+	replicasConfirmUnschedule = cmdReplicas.Flag("confirm-unschedule", "the pod ID of the replication controller, typed out to confirm lowering the replica count by more than --max-unschedule-percent or --max-unschedule-pods").String()
 
 	cmdList  = kingpin.Command(cmdListText, "List replication controllers")
 	listJSON = cmdList.Flag("json", "output the entire JSON object of each replication controller").Short('j').Bool()
@@ -89,21 +106,29 @@ var (
 	cmdGetStatus = kingpin.Command(cmdGetStatusText, "Get the status entry for a replication controller")
 	getStatusID  = cmdGetStatus.Arg("id", "uuid of replication controller whose status should be fetched").Required().String()
 
+	cmdDryRunReport = kingpin.Command(cmdDryRunReportText, "Print the scheduling changes recorded by an RC farm running with --dry-run, for every replication controller")
+	dryRunReportAll = cmdDryRunReport.Flag("all", "also print replication controllers that would take no action").Bool()
+
 	cmdEnable = kingpin.Command(cmdEnableText, "Enable replication controller")
 	enableID  = cmdEnable.Arg("id", "replication controller uuid to enable").Required().String()
 
 	cmdDisable = kingpin.Command(cmdDisableText, "Disable replication controller")
 	disableID  = cmdDisable.Arg("id", "replication controller uuid to disable").Required().String()
 
-	cmdRoll   = kingpin.Command(cmdRollText, "Rolling update from one replication controller to another")
-	rollOldID = cmdRoll.Flag("old", "old replication controller uuid").Required().Short('o').String()
-	rollNewID = cmdRoll.Flag("new", "new replication controller uuid").Required().Short('n').String()
-	rollWant  = cmdRoll.Flag("desired", "number of replicas desired").Required().Short('d').Int()
-	rollNeed  = cmdRoll.Flag("minimum", "minimum number of healthy replicas during update").Required().Short('m').Int()
+	cmdRoll     = kingpin.Command(cmdRollText, "Rolling update from one replication controller to another")
+	rollOldID   = cmdRoll.Flag("old", "old replication controller uuid").Required().Short('o').String()
+	rollNewID   = cmdRoll.Flag("new", "new replication controller uuid").Required().Short('n').String()
+	rollWant    = cmdRoll.Flag("desired", "number of replicas desired").Short('d').Int()
+	rollPercent = cmdRoll.Flag("percent", "instead of --desired, restrict the new replication controller to a stable cohort of this percentage of the nodes its node selector matches, and move every node of the cohort to it").Int()
+	rollNeed    = cmdRoll.Flag("minimum", "minimum number of healthy replicas during update").Required().Short('m').Int()
 
 	cmdDeleteRoll = kingpin.Command(cmdDeleteRollText, "Delete a rolling update.")
 	deleteRollID  = cmdDeleteRoll.Flag("id", "rolling update uuid").Required().Short('i').String()
 
+	cmdApproveRoll       = kingpin.Command(cmdApproveRollText, "Approve a rolling update of a protected pod, allowing it to go past its canary. The approver must not be the user who requested the update.")
+	approveRollID        = cmdApproveRoll.Flag("id", "rolling update uuid").Required().Short('i').String()
+	approveRollSignature = cmdApproveRoll.Flag("signature", "Path to a detached signature of the message \"approve rolling update <id>\", made with a key in the approvers' keyring of the rolling update farm").Required().ExistingFile()
+
 	cmdSchedup   = kingpin.Command(cmdSchedupText, "Schedule new rolling update (will be run by farm)")
 	schedupOldID = cmdSchedup.Flag("old", "old replication controller uuid").Required().Short('o').String()
 	schedupNewID = cmdSchedup.Flag("new", "new replication controller uuid").Required().Short('n').String()
@@ -117,10 +142,18 @@ var (
 	cmdUpdateStrategy  = kingpin.Command(cmdUpdateStrategyText, "Forcefully update the allocation strategy in the manifest.")
 	updateStrategyRCID = cmdUpdateStrategy.Flag("id", "replication controller uuid to update").Required().String()
 	updateStrategy     = cmdUpdateStrategy.Flag("strategy", "allocation strategy to use for the replication controller").Required().String()
+
+	cmdUpdateSelector  = kingpin.Command(cmdUpdateSelectorText, "Change the node selector of a replication controller. Its pods will be moved off nodes the new selector does not match.")
+	updateSelectorRCID = cmdUpdateSelector.Arg("id", "replication controller uuid to update").Required().String()
+	updateSelector     = cmdUpdateSelector.Arg("node-selector", "node selector that this replication controller should target").Required().String()
+	selectorConfirm    = cmdUpdateSelector.Flag("confirm-unschedule", "the pod ID of the replication controller, typed out to confirm a selector that moves its pods off more than --max-unschedule-percent or --max-unschedule-pods of its nodes").String()
+
+	cmdHistory = kingpin.Command(cmdHistoryText, "Show the audit log of changes made to a replication controller")
+	historyID  = cmdHistory.Arg("id", "replication controller uuid whose history should be shown").Required().String()
 )
 
 func main() {
-	kingpin.Version(version.VERSION)
+	version.Register(kingpin.CommandLine)
 	cmd, opts, _ := flags.ParseWithConsulOptions()
 
 	logger := logging.NewLogger(logrus.Fields{})
@@ -147,12 +180,13 @@ func main() {
 	labeler := labels.NewConsulApplicator(client, 0, 0)
 
 	rcStore := rcstore.NewConsul(client, labeler, 3)
-	rcStatusStore := rcstatus.NewConsul(statusstore.NewConsul(client), consul.RCStatusNamespace)
+	rcStatusStore := rcstatus.NewConsul(statusstore.NewConsul(client), statusstore.RCStatusNamespace)
 
 	// The roll labeler CANT be an http applicator because it uses consul
 	// transactions, so this might be different from labeler returned by
 	// flags.ParseWithConsulOptions()
 	rollLabeler := labels.NewConsulApplicator(client, 0, 0)
+	auditLogStore := auditlogstore.NewConsulStore(client.KV())
 	rctl := rctlParams{
 		httpClient: httpClient,
 		baseClient: client,
@@ -160,6 +194,10 @@ func main() {
 		// the same implementation of these various interfaces in
 		// the future.
 		rcs:               rcStore,
+		auditingRCs:       rcstore.NewAuditingStore(rcStore, auditLogStore),
+		auditLogs:         auditLogStore,
+		txner:             client.KV(),
+		user:              currentUserName(),
 		rcStatusStore:     rcStatusStore,
 		rollRCStore:       rcStore,
 		rollRCStatusStore: rcStatusStore,
@@ -170,6 +208,10 @@ func main() {
 		hcheck:            checker.NewShadowTrafficHealthChecker(nil, nil, client, nil, nil, false, false),
 		hclient:           nil,
 		logger:            logger,
+		unscheduleLimits: rc.UnscheduleLimits{
+			MaxPercent: *maxUnschedulePercent,
+			MaxPods:    *maxUnschedulePods,
+		},
 	}
 
 	switch cmd {
@@ -186,27 +228,44 @@ func main() {
 	case cmdDeleteText:
 		rctl.Delete(*deleteID, *deleteForce)
 	case cmdReplicasText:
-		rctl.SetReplicas(*replicasID, *replicasNum)
+		rctl.SetReplicas(*replicasID, *replicasNum, types.PodID(*replicasConfirmUnschedule))
 	case cmdListText:
 		rctl.List(*listJSON)
 	case cmdGetText:
 		rctl.Get(*getID, *getManifest)
 	case cmdGetStatusText:
 		rctl.GetStatus(*getStatusID)
+	case cmdDryRunReportText:
+		rctl.DryRunReport(*dryRunReportAll)
 	case cmdEnableText:
 		rctl.Enable(*enableID)
 	case cmdDisableText:
 		rctl.Disable(*disableID)
 	case cmdRollText:
-		rctl.RollingUpdate(*rollOldID, *rollNewID, *rollWant, *rollNeed)
+		want := *rollWant
+		switch {
+		case *rollPercent != 0 && want != 0:
+			logger.NoFields().Fatalln("Only one of --desired or --percent may be specified")
+		case *rollPercent != 0:
+			want = rctl.RestrictToCohort(rc_fields.ID(*rollNewID), *rollPercent)
+		case want == 0:
+			logger.NoFields().Fatalln("One of --desired or --percent must be specified")
+		}
+		rctl.RollingUpdate(*rollOldID, *rollNewID, want, *rollNeed)
 	case cmdSchedupText:
 		rctl.ScheduleUpdate(*schedupOldID, *schedupNewID, *schedupWant, *schedupNeed, client.KV())
 	case cmdDeleteRollText:
 		rctl.DeleteRollingUpdate(*deleteRollID, client.KV())
+	case cmdApproveRollText:
+		rctl.ApproveRollingUpdate(*approveRollID, *approveRollSignature)
 	case cmdUpdateManifestText:
 		rctl.UpdateManifest(fields.ID(*updateManifestRCID), *updateManifestPath)
 	case cmdUpdateStrategyText:
 		rctl.UpdateStrategy(fields.ID(*updateStrategyRCID), fields.Strategy(*updateStrategy))
+	case cmdUpdateSelectorText:
+		rctl.UpdateNodeSelector(fields.ID(*updateSelectorRCID), *updateSelector, types.PodID(*selectorConfirm))
+	case cmdHistoryText:
+		rctl.History(fields.ID(*historyID))
 	}
 }
 
@@ -224,10 +283,20 @@ func SessionName() string {
 type Store interface {
 	// for passing into a roll farm
 	roll.Store
+
+	SetRollApproval(rollID string, approval consul.RollApproval) error
 }
 
 type ReplicationControllerStore interface {
+	List() ([]fields.RC, error)
+	Get(id fields.ID) (fields.RC, error)
+}
+
+// AuditingRCStore performs every RC mutation requested by the user, so that
+// each one is recorded in the audit log along with who requested it
+type AuditingRCStore interface {
 	Create(
+		ctx context.Context,
 		manifest manifest.Manifest,
 		nodeSelector klabels.Selector,
 		availabilityZone pc_fields.AvailabilityZone,
@@ -235,15 +304,20 @@ type ReplicationControllerStore interface {
 		podLabels klabels.Set,
 		additionalLabels klabels.Set,
 		allocationStrategy rc_fields.Strategy,
+		user string,
+		source audit.Source,
 	) (fields.RC, error)
-	SetDesiredReplicas(id fields.ID, n int) error
-	List() ([]fields.RC, error)
-	Enable(id fields.ID) error
-	Disable(id fields.ID) error
-	Delete(id fields.ID, force bool) error
-	Get(id fields.ID) (fields.RC, error)
-	UpdateManifest(id fields.ID, man manifest.Manifest) error
-	UpdateStrategy(id fields.ID, strategy fields.Strategy) error
+	SetDesiredReplicas(ctx context.Context, id fields.ID, n int, user string, source audit.Source) (fields.RC, error)
+	Enable(ctx context.Context, id fields.ID, user string, source audit.Source) (fields.RC, error)
+	Disable(ctx context.Context, id fields.ID, user string, source audit.Source) (fields.RC, error)
+	Delete(ctx context.Context, id fields.ID, force bool, user string, source audit.Source) error
+	UpdateManifest(ctx context.Context, id fields.ID, man manifest.Manifest, user string, source audit.Source) (fields.RC, error)
+	UpdateStrategy(ctx context.Context, id fields.ID, strategy fields.Strategy, user string, source audit.Source) (fields.RC, error)
+	UpdateNodeSelector(ctx context.Context, id fields.ID, nodeSelector klabels.Selector, user string, source audit.Source) (fields.RC, error)
+}
+
+type AuditLogLister interface {
+	List() (map[audit.ID]audit.AuditLog, error)
 }
 
 type RollingUpdateStore interface {
@@ -263,6 +337,10 @@ type rctlParams struct {
 	httpClient        *http.Client
 	baseClient        consulutil.ConsulClient
 	rcs               ReplicationControllerStore
+	auditingRCs       AuditingRCStore
+	auditLogs         AuditLogLister
+	txner             transaction.Txner
+	user              string
 	rcStatusStore     RCStatusStore
 	rollRCStore       roll.ReplicationControllerStore
 	rollRCStatusStore roll.RCStatusStore
@@ -274,6 +352,7 @@ type rctlParams struct {
 	hcheck            checker.ShadowTrafficHealthChecker
 	hclient           hclient.HealthServiceClient
 	logger            logging.Logger
+	unscheduleLimits  rc.UnscheduleLimits
 }
 
 func (r rctlParams) Create(
@@ -299,7 +378,13 @@ func (r rctlParams) Create(
 		}).Fatalln("Could not parse node selector")
 	}
 
-	newRC, err := r.rcs.Create(manifest, nodeSel, availabilityZone, clusterName, klabels.Set(podLabels), rcLabels, allocationStrategy)
+	ctx, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
+	newRC, err := r.auditingRCs.Create(ctx, manifest, nodeSel, availabilityZone, clusterName, klabels.Set(podLabels), rcLabels, allocationStrategy, r.user, audit.SourceCLI)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not create replication controller in Consul")
+	}
+	err = transaction.MustCommit(ctx, r.txner)
 	if err != nil {
 		r.logger.WithError(err).Fatalln("Could not create replication controller in Consul")
 	}
@@ -307,7 +392,13 @@ func (r rctlParams) Create(
 }
 
 func (r rctlParams) Delete(id string, force bool) {
-	err := r.rcs.Delete(rc_fields.ID(id), force)
+	ctx, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
+	err := r.auditingRCs.Delete(ctx, rc_fields.ID(id), force, r.user, audit.SourceCLI)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not delete replication controller in Consul")
+	}
+	err = transaction.MustCommit(ctx, r.txner)
 	if err != nil {
 		r.logger.WithError(err).Fatalln("Could not delete replication controller in Consul")
 	}
@@ -328,16 +419,31 @@ func (r rctlParams) DeleteRollingUpdate(id string, txner transaction.Txner) {
 	}
 }
 
-func (r rctlParams) SetReplicas(id string, replicas int) {
+func (r rctlParams) SetReplicas(id string, replicas int, confirmedPodID types.PodID) {
 	if replicas < 0 {
 		r.logger.NoFields().Fatalln("Cannot set negative replica count")
 	}
 
+	rcFields, err := r.rcs.Get(rc_fields.ID(id))
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not get replication controller in Consul")
+	}
+	err = r.unscheduleLimits.Check(rcFields.Manifest.ID(), rcFields.ReplicasDesired, rcFields.ReplicasDesired-replicas, confirmedPodID)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Refusing to lower the replica count")
+	}
+
 	fmt.Printf("setting the replica count to %d\n", replicas)
 	if !*yes && !cli.Confirm() {
 		r.logger.Fatal("user aborted")
 	}
-	err := r.rcs.SetDesiredReplicas(rc_fields.ID(id), replicas)
+	ctx, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
+	_, err = r.auditingRCs.SetDesiredReplicas(ctx, rc_fields.ID(id), replicas, r.user, audit.SourceCLI)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not set desired replica count in Consul")
+	}
+	err = transaction.MustCommit(ctx, r.txner)
 	if err != nil {
 		r.logger.WithError(err).Fatalln("Could not set desired replica count in Consul")
 	}
@@ -404,8 +510,51 @@ func (r rctlParams) GetStatus(id string) {
 	fmt.Printf("%s\n", out)
 }
 
+func (r rctlParams) DryRunReport(all bool) {
+	list, err := r.rcs.List()
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not list replication controllers in Consul")
+	}
+
+	type rcDryRun struct {
+		ID     rc_fields.ID     `json:"id"`
+		PodID  types.PodID      `json:"pod_id"`
+		DryRun *rcstatus.DryRun `json:"dry_run"`
+	}
+	report := []rcDryRun{}
+	for _, listRC := range list {
+		status, _, err := r.rcStatusStore.Get(listRC.ID)
+		if err != nil && !statusstore.IsNoStatus(err) {
+			r.logger.WithError(err).Fatalln("could not fetch RC status")
+		}
+
+		// RCs without a dry run result have not been handled by a
+		// dry-run farm yet and are always reported
+		if !all && status.DryRun != nil && !status.DryRun.HasChanges() {
+			continue
+		}
+		report = append(report, rcDryRun{
+			ID:     listRC.ID,
+			PodID:  listRC.Manifest.ID(),
+			DryRun: status.DryRun,
+		})
+	}
+
+	out, err := json.MarshalIndent(report, "", "    ")
+	if err != nil {
+		r.logger.WithError(err).Fatalln("could not print dry run report as JSON")
+	}
+	fmt.Printf("%s\n", out)
+}
+
 func (r rctlParams) Enable(id string) {
-	err := r.rcs.Enable(rc_fields.ID(id))
+	ctx, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
+	_, err := r.auditingRCs.Enable(ctx, rc_fields.ID(id), r.user, audit.SourceCLI)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not enable replication controller in Consul")
+	}
+	err = transaction.MustCommit(ctx, r.txner)
 	if err != nil {
 		r.logger.WithError(err).Fatalln("Could not enable replication controller in Consul")
 	}
@@ -413,13 +562,93 @@ func (r rctlParams) Enable(id string) {
 }
 
 func (r rctlParams) Disable(id string) {
-	err := r.rcs.Disable(rc_fields.ID(id))
+	ctx, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
+	_, err := r.auditingRCs.Disable(ctx, rc_fields.ID(id), r.user, audit.SourceCLI)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not disable replication controller in Consul")
+	}
+	err = transaction.MustCommit(ctx, r.txner)
 	if err != nil {
 		r.logger.WithError(err).Fatalln("Could not disable replication controller in Consul")
 	}
 	r.logger.WithField("id", id).Infoln("Disabled replication controller")
 }
 
+// RestrictToCohort labels the nodes matching the node selector of a
+// replication controller with their cohort, restricts its node selector to the
+// percent cohort, and returns how many nodes are in the cohort
+func (r rctlParams) RestrictToCohort(id fields.ID, percent int) int {
+	rcFields, err := r.rcs.Get(id)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not get replication controller in Consul")
+	}
+	// a cohort the replication controller was already restricted to is
+	// replaced, so nodes are looked up without it
+	unrestricted, err := cohort.Unrestricted(rcFields.NodeSelector)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Invalid node selector")
+	}
+	nodeSel, err := cohort.RestrictSelector(rcFields.NodeSelector, percent)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Invalid --percent")
+	}
+
+	matches, err := r.labeler.GetMatches(unrestricted, labels.NODE)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not get the nodes matching the node selector")
+	}
+	var inCohort []types.NodeName
+	for _, match := range matches {
+		node := types.NodeName(match.ID)
+		bucket := cohort.BucketLabel(node)
+		if match.Labels.Get(cohort.NodeLabel) != bucket {
+			err = r.labeler.SetLabel(labels.NODE, match.ID, cohort.NodeLabel, bucket)
+			if err != nil {
+				r.logger.WithErrorAndFields(err, logrus.Fields{"node": node}).Fatalln("Could not label node with its cohort")
+			}
+		}
+		if cohort.Contains(node, percent) {
+			inCohort = append(inCohort, node)
+		}
+	}
+
+	// the update moves nodes into the cohort, it mustn't also move the
+	// new replication controller off nodes outside it
+	current, err := rc.CurrentPods(id, r.labeler)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not get the current pods of the replication controller")
+	}
+	if removed := rc.UnscheduledBySelector(current, inCohort); removed > 0 {
+		r.logger.WithFields(logrus.Fields{
+			"id":      id,
+			"percent": percent,
+			"outside": removed,
+		}).Fatalln("Refusing to restrict the replication controller to the cohort, it has pods on nodes outside it")
+	}
+
+	if nodeSel.String() != rcFields.NodeSelector.String() {
+		ctx, cancelFunc := transaction.New(context.Background())
+		defer cancelFunc()
+		_, err = r.auditingRCs.UpdateNodeSelector(ctx, id, nodeSel, r.user, audit.SourceCLI)
+		if err != nil {
+			r.logger.WithError(err).Fatalln("Node selector update failed")
+		}
+		err = transaction.MustCommit(ctx, r.txner)
+		if err != nil {
+			r.logger.WithError(err).Fatalln("Node selector update failed")
+		}
+	}
+
+	r.logger.WithFields(logrus.Fields{
+		"id":            id,
+		"percent":       percent,
+		"node_selector": nodeSel.String(),
+		"desired":       len(inCohort),
+	}).Infoln("Restricted replication controller to cohort")
+	return len(inCohort)
+}
+
 func (r rctlParams) RollingUpdate(oldID, newID string, want, need int) {
 	if want < need {
 		r.logger.WithFields(logrus.Fields{
@@ -455,6 +684,7 @@ func (r rctlParams) RollingUpdate(oldID, newID string, want, need int) {
 				NewRC:           rc_fields.ID(newID),
 				DesiredReplicas: want,
 				MinimumReplicas: need,
+				Requester:       r.user,
 			},
 			r.consuls,
 			r.baseClient,
@@ -470,9 +700,11 @@ func (r rctlParams) RollingUpdate(oldID, newID string, want, need int) {
 			session,
 			watchDelay,
 			alerting.NewNop(),
-			nil,   // note: this will cause a panic if one of the RCs is dynamic
-			false, // no audit logging
+			nil,                         // note: this will cause a panic if one of the RCs is dynamic
+			false,                       // no audit logging
 			auditlogstore.ConsulStore{}, // no audit logging
+			webhook.NewNop(),
+			nil, // protected pods can't be approved past their canary
 		).Run(ctx)
 		close(result)
 	}()
@@ -513,6 +745,7 @@ func (r rctlParams) ScheduleUpdate(oldID, newID string, want, need int, txner tr
 			NewRC:           rc_fields.ID(newID),
 			DesiredReplicas: want,
 			MinimumReplicas: need,
+			Requester:       r.user,
 		}, nil, nil)
 	if err != nil {
 		r.logger.WithError(err).Fatalln("Could not create rolling update")
@@ -526,18 +759,105 @@ func (r rctlParams) ScheduleUpdate(oldID, newID string, want, need int, txner tr
 	r.logger.WithField("id", newID).Infoln("Created new rolling update")
 }
 
+func (r rctlParams) ApproveRollingUpdate(id string, signaturePath string) {
+	signature, err := ioutil.ReadFile(signaturePath)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not read approval signature")
+	}
+
+	err = r.consuls.SetRollApproval(id, consul.RollApproval{
+		Approver:  r.user,
+		Signature: signature,
+		Time:      time.Now(),
+	})
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not approve rolling update")
+	}
+	r.logger.WithField("id", id).Infoln("Approved rolling update, the farm will check the signature before continuing past the canary")
+}
+
 func (r rctlParams) UpdateManifest(id fields.ID, manifestPath string) {
 	man, err := manifest.FromPath(manifestPath)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not read pod manifest")
+	}
 
-	err = r.rcs.UpdateManifest(id, man)
+	ctx, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
+	_, err = r.auditingRCs.UpdateManifest(ctx, id, man, r.user, audit.SourceCLI)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Manifest update failed! Please retry after checking the database")
+	}
+	err = transaction.MustCommit(ctx, r.txner)
 	if err != nil {
 		r.logger.WithError(err).Fatalln("Manifest update failed! Please retry after checking the database")
 	}
 }
 
 func (r rctlParams) UpdateStrategy(id fields.ID, strategy fields.Strategy) {
-	err := r.rcs.UpdateStrategy(id, strategy)
+	ctx, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
+	_, err := r.auditingRCs.UpdateStrategy(ctx, id, strategy, r.user, audit.SourceCLI)
 	if err != nil {
 		r.logger.WithError(err).Fatalln("Strategy update failed")
 	}
+	err = transaction.MustCommit(ctx, r.txner)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Strategy update failed")
+	}
+}
+
+func (r rctlParams) UpdateNodeSelector(id fields.ID, nodeSelector string, confirmedPodID types.PodID) {
+	nodeSel, err := klabels.Parse(nodeSelector)
+	if err != nil {
+		r.logger.WithErrorAndFields(err, logrus.Fields{
+			"selector": nodeSelector,
+		}).Fatalln("Could not parse node selector")
+	}
+
+	rcFields, err := r.rcs.Get(id)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not get replication controller in Consul")
+	}
+	current, err := rc.CurrentPods(id, r.labeler)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not get the current pods of the replication controller")
+	}
+	matches, err := r.labeler.GetMatches(nodeSel, labels.NODE)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not get the nodes matching the node selector")
+	}
+	eligible := make([]types.NodeName, 0, len(matches))
+	for _, match := range matches {
+		eligible = append(eligible, types.NodeName(match.ID))
+	}
+	removed := rc.UnscheduledBySelector(current, eligible)
+	err = r.unscheduleLimits.Check(rcFields.Manifest.ID(), len(current), removed, confirmedPodID)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Refusing to update the node selector")
+	}
+
+	ctx, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
+	_, err = r.auditingRCs.UpdateNodeSelector(ctx, id, nodeSel, r.user, audit.SourceCLI)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Node selector update failed")
+	}
+	err = transaction.MustCommit(ctx, r.txner)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Node selector update failed")
+	}
+	r.logger.WithFields(logrus.Fields{
+		"id":            id,
+		"node_selector": nodeSel.String(),
+	}).Infoln("Updated node selector of replication controller")
+}
+
+func currentUserName() string {
+	username := "unknown user"
+
+	if user, err := user.Current(); err == nil {
+		username = user.Username
+	}
+	return username
 }
@@ -0,0 +1,129 @@
+// p2-replicate-ctl controls the replications of a pod that are in progress,
+// such as the ones started by p2-replicate.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"time"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/replicationstatus"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/version"
+)
+
+const (
+	CmdPause  = "pause"
+	CmdResume = "resume"
+	CmdStatus = "status"
+	CmdEvents = "events"
+)
+
+var (
+	cmdPause   = kingpin.Command(CmdPause, "Stop the replications of a pod from updating any more hosts. Hosts that are being updated carry on.")
+	pausePodID = cmdPause.Arg("pod", "The pod whose replications to pause").Required().String()
+
+	cmdResume   = kingpin.Command(CmdResume, "Let the paused replications of a pod carry on.")
+	resumePodID = cmdResume.Arg("pod", "The pod whose replications to resume").Required().String()
+
+	cmdStatus   = kingpin.Command(CmdStatus, "Show whether the replications of a pod are paused.")
+	statusPodID = cmdStatus.Arg("pod", "The pod whose replications to show").Required().String()
+
+	cmdEvents     = kingpin.Command(CmdEvents, "Show the phases that each host went through during the replications of a pod, oldest first.")
+	eventsPodID   = cmdEvents.Arg("pod", "The pod whose replication events to show").Required().String()
+	eventsReplica = cmdEvents.Flag("replication", "Only show the events of the replication with this ID").String()
+)
+
+func main() {
+	kingpin.CommandLine.Name = "p2-replicate-ctl"
+	kingpin.CommandLine.Help = `p2-replicate-ctl controls the replications of a pod while they are in progress.
+A pause is kept in consul, so it applies to every replication of the pod, and
+outlives the p2-replicate invocation that was paused. Run p2-replicate again
+with --unpause, or use the resume command, to carry on with the rollout.
+
+	Example invocation: p2-replicate-ctl pause helloworld
+`
+	version.Register(kingpin.CommandLine)
+	cmd, opts, _ := flags.ParseWithConsulOptions()
+	client := consul.NewConsulClient(opts)
+	store := consul.NewConsulStore(client)
+
+	switch cmd {
+	case CmdPause:
+		err := store.PauseReplication(types.PodID(*pausePodID), pausedBy())
+		if err != nil {
+			log.Fatalf("Could not pause replications of %s: %s", *pausePodID, err)
+		}
+		fmt.Printf("Paused replications of %s\n", *pausePodID)
+	case CmdResume:
+		err := store.ResumeReplication(types.PodID(*resumePodID))
+		if err != nil {
+			log.Fatalf("Could not resume replications of %s: %s", *resumePodID, err)
+		}
+		fmt.Printf("Resumed replications of %s\n", *resumePodID)
+	case CmdStatus:
+		pause, err := store.ReplicationPause(types.PodID(*statusPodID))
+		if err != nil {
+			log.Fatalf("Could not read the pause of replications of %s: %s", *statusPodID, err)
+		}
+		if pause == nil {
+			fmt.Printf("Replications of %s are not paused\n", *statusPodID)
+			return
+		}
+		fmt.Printf("Replications of %s were paused by %s at %s\n", *statusPodID, pause.PausedBy, pause.Time.Local().Format(time.RFC3339))
+	case CmdEvents:
+		eventStore := replicationstatus.NewConsul(statusstore.NewConsul(client), statusstore.ReplicationEventStatusNamespace)
+		status, _, err := eventStore.Get(types.PodID(*eventsPodID))
+		if statusstore.IsNoStatus(err) {
+			fmt.Printf("No replication events were recorded for %s\n", *eventsPodID)
+			return
+		}
+		if err != nil {
+			log.Fatalf("Could not read the replication events of %s: %s", *eventsPodID, err)
+		}
+		printEvents(status.Events, *eventsReplica)
+	}
+}
+
+// printEvents prints one event per line, only including the events of the
+// given replication if one is given
+func printEvents(events []replicationstatus.Event, replicationID string) {
+	for _, event := range events {
+		if replicationID != "" && event.ReplicationID != replicationID {
+			continue
+		}
+		line := fmt.Sprintf("%s  %s  %s  %-10s %s", event.Time.Local().Format(time.RFC3339), event.ReplicationID, shortSHA(event.SHA), event.Phase, event.Node)
+		if event.Error != "" {
+			line += ": " + event.Error
+		}
+		fmt.Println(line)
+	}
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
+
+// pausedBy describes who is pausing, in the same form as the replication
+// lock messages of p2-replicate
+func pausedBy() string {
+	thisHost, err := os.Hostname()
+	if err != nil {
+		log.Fatalf("Could not retrieve hostname: %s", err)
+	}
+	thisUser, err := user.Current()
+	if err != nil {
+		log.Fatalf("Could not retrieve user: %s", err)
+	}
+	return fmt.Sprintf("%q from %q", thisUser.Username, thisHost)
+}
@@ -1,37 +1,82 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"os/user"
+	"path/filepath"
 	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/go-cleanhttp"
 	"gopkg.in/alecthomas/kingpin.v2"
+	klabels "k8s.io/kubernetes/pkg/labels"
 
+	"github.com/square/p2/pkg/allocation"
+	"github.com/square/p2/pkg/cohort"
 	"github.com/square/p2/pkg/health"
 	"github.com/square/p2/pkg/health/checker"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/replication"
+	"github.com/square/p2/pkg/scheduler"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/deploystatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/nodehealthstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/nodestatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/prefetchstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/replicationstatus"
 	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/uri"
 	"github.com/square/p2/pkg/version"
+	"github.com/square/p2/pkg/webhook"
 )
 
 var (
 	manifestURI             = kingpin.Arg("manifest", "a path or url to a pod manifest that will be replicated.").Required().URL()
-	hosts                   = kingpin.Arg("hosts", "Hosts to replicate to").Required().Strings()
+	hosts                   = kingpin.Arg("hosts", "Hosts to replicate to. Required unless --selector or --resume is given").Strings()
+	selector                = kingpin.Flag("selector", "Replicate to the nodes matching this node label selector, such as az=us-east-1,role=web, instead of the given hosts").String()
+	allocate                = kingpin.Flag("allocate", "Replicate to this many hosts, chosen by the capacity they have left for the CPUs and memory the manifest's cgroup limits request. Hosts declare their capacity with capacity_cpus and capacity_memory node labels. With --selector, only the matching hosts are considered").Int()
+	spread                  = kingpin.Flag("spread", "With --allocate, the most hosts the pod may be on that share a value of a label, such as rack:1,availability_zone:3. Hosts that already have the pod count towards the limit, and hosts without the label aren't allocated").String()
+	reresolveInterval       = kingpin.Flag("reresolve-interval", "With --selector, how often to look up the nodes matching the selector again while hosts are waiting to be updated. Nodes that started matching are updated too, and waiting nodes that stopped matching are skipped. By default the nodes are only looked up when p2-replicate starts").Duration()
 	minNodes                = kingpin.Flag("min-nodes", "The minimum number of healthy nodes that must remain up while replicating.").Default("1").Short('m').Int()
+	minHealthy              = kingpin.Flag("min-healthy", "The number of the pod's hosts, or a percentage of them such as 90%, that must stay healthy while replicating. Unlike --min-nodes, this counts every host the pod is on according to p2's health checks, not only the hosts being replicated to").String()
+	order                   = kingpin.Flag("order", "The order to update hosts in: health (least healthy first), alphabetical, zone (one availability zone at a time, by the hosts' availability_zone label), or shuffle:<seed> (a random order that is the same for the same seed)").Default("health").String()
+	maxParallel             = kingpin.Flag("max-parallel", "The maximum number of hosts to update at the same time. Each host still has to become healthy before another takes its place. By default, as many hosts are updated at once as --min-nodes allows, up to 50").Int()
 	threshold               = kingpin.Flag("threshold", "The minimum health level to treat as healthy. One of (in order) passing, warning, unknown, critical.").String()
 	overrideLock            = kingpin.Flag("override-lock", "Override any lock holders").Bool()
 	ignoreControllers       = kingpin.Flag("ignore-controllers", "Deploy even if there are controllers managing some of the hosts").Bool()
+	percent                 = kingpin.Flag("percent", "Only deploy to the hosts that are in a deterministic N% cohort of the fleet, chosen by a stable hash of the host names. The same hosts are chosen every time, so this can be used for long-lived canaries").Default("100").Int()
+	manifestSHA256          = kingpin.Flag("sha256", "The hex encoded SHA-256 digest the manifest must have").String()
+	manifestSidecar         = kingpin.Flag("sha256-sidecar", "Verify the manifest against the digest in the file at the manifest's URI with \".sha256\" appended, as written by sha256sum").Bool()
+	canaryCount             = kingpin.Flag("canary-count", "Update this many hosts first, and only update the rest if they all become healthy and stay healthy for --canary-wait").Default("0").Int()
+	canaryWait              = kingpin.Flag("canary-wait", "How long the canary hosts must stay healthy before the rest are updated").Default("5m").Duration()
+	nodeTimeout             = kingpin.Flag("node-timeout", "How long each host has to become healthy after it is updated before it counts as failed. By default hosts are waited on forever").Duration()
+	nodeRetries             = kingpin.Flag("node-retries", "How many more times to update a host that times out (see --node-timeout) or hits an error before it counts as failed").Default("0").Int()
+	onFailure               = kingpin.Flag("on-failure", "What to do when a host fails: continue with the other hosts, abort (stop updating hosts), or rollback (stop updating hosts and give every updated host back the manifest it had before). Hosts only fail by timing out (see --node-timeout), hitting an error, or being a canary that became unhealthy, once their --node-retries are exhausted").Default("continue").Enum("continue", "abort", "rollback")
+	rollbackOnFailure       = kingpin.Flag("rollback-on-failure", "The same as --on-failure rollback").Bool()
+	prefetch                = kingpin.Flag("prefetch", "Have every host download and install the pod's launchables before any of them is updated, so that a host that can't get them fails the deploy before anything is restarted").Bool()
+	unpause                 = kingpin.Flag("unpause", "Lift a pause of the pod's replications, as left by p2-replicate-ctl pause, before replicating").Bool()
+	resume                  = kingpin.Flag("resume", "Resume the replication with the given ID, as printed when it started, updating only the hosts it didn't complete. Hosts must not be given").String()
+	dryRun                  = kingpin.Flag("dry-run", "Print what would be done to each host, based on its current intent and reality, then exit without writing anything").Bool()
+	prefetchTimeout         = kingpin.Flag("prefetch-timeout", "How long to wait for every host to prefetch launchables when --prefetch is set").Default("10m").Duration()
+	nodeOverrides           = kingpin.Flag("node-overrides", "A YAML file of config and env overrides keyed by host name, each of which is merged into the manifest that host is given, for pods whose hosts each need some config of their own such as a shard ID. See replication.NodeOverride").ExistingFile()
+	includeCritical         = kingpin.Flag("include-critical-nodes", "Replicate to hosts whose published node health is critical too. By default they are skipped, both when p2-replicate starts and when --reresolve-interval looks up the nodes again. Hosts only publish their health when their preparer's publish_node_health is set").Bool()
 	concurrentRealityChecks = kingpin.Flag("concurrent-reality-checks", "The number of concurrent requests to check for reality state (this is one area where p2-replicate does not use long-lived watches)").Default(fmt.Sprintf("%v", replication.DefaultConcurrentReality)).Int()
+	webhookConfig           = kingpin.Flag("webhook-config", "Path to a YAML file listing webhook endpoints to notify of the replication's events").ExistingFile()
 )
 
+// How long to wait for the last webhook events to be delivered before exiting
+const webhookFlushTimeout = 30 * time.Second
+
 func main() {
 	kingpin.CommandLine.Name = "p2-replicate"
 	kingpin.CommandLine.Help = `p2-replicate uses the replication package to schedule deployment of a pod across multiple nodes. See the replication package's README and godoc for more information.
@@ -44,15 +89,21 @@ func main() {
 
 	Because of --min-nodes 2, the replicator will ensure that at least two healthy
 	nodes remain up at all times, according to p2's health checks.
+
+	Hosts can also be chosen by their labels, or by the capacity they have left:
+
+	p2-replicate --selector az=us-east-1,role=web --reresolve-interval 10m helloworld.yaml
+	p2-replicate --allocate 5 --selector role=web --spread rack:1 helloworld.yaml
 `
 
-	kingpin.Version(version.VERSION)
+	version.Register(kingpin.CommandLine)
 	_, opts, labeler := flags.ParseWithConsulOptions()
 	client := consul.NewConsulClient(opts)
 	store := consul.NewConsulStore(client)
 	healthChecker := checker.NewHealthChecker(client)
+	nodeHealth := nodehealthstatus.NewConsul(statusstore.NewConsul(client), statusstore.NodeHealthStatusNamespace)
 
-	manifest, err := manifest.FromURI(*manifestURI)
+	manifest, err := fetchManifest(*manifestURI)
 	if err != nil {
 		log.Fatalf("%s", err)
 	}
@@ -76,9 +127,154 @@ func main() {
 		log.Fatalf("Could not retrieve user: %s", err)
 	}
 
-	nodes := make([]types.NodeName, len(*hosts))
-	for i, host := range *hosts {
-		nodes[i] = types.NodeName(host)
+	if *reresolveInterval < 0 || (*reresolveInterval > 0 && (*selector == "" || *allocate != 0)) {
+		log.Fatalf("--reresolve-interval must be positive, and requires --selector without --allocate")
+	}
+	if *allocate < 0 {
+		log.Fatalf("Invalid --allocate: %d", *allocate)
+	}
+	spreadConstraints, err := allocation.ParseSpreadConstraints(*spread)
+	if err != nil {
+		log.Fatalf("Invalid --spread: %s", err)
+	}
+	if len(spreadConstraints) > 0 && *allocate == 0 {
+		log.Fatalf("--spread requires --allocate")
+	}
+
+	var record consul.ReplicationRecord
+	var nodes []types.NodeName
+	var resolver replication.NodeResolver
+	if *resume != "" {
+		if *selector != "" || *allocate != 0 {
+			log.Fatalf("--selector and --allocate can't be given with --resume")
+		}
+		record, nodes, err = resumeRecord(store, *resume, manifest)
+		if err != nil {
+			log.Fatalf("Could not resume replication %s: %s", *resume, err)
+		}
+		if len(nodes) == 0 {
+			log.Fatalf("Replication %s already completed all %d hosts", record.ID, len(record.Nodes))
+		}
+		logger.WithField("hosts", nodes).Infof("Resuming replication %s with %d of %d hosts remaining", record.ID, len(nodes), len(record.Nodes))
+	} else {
+		var candidates []types.NodeName
+		switch {
+		case (*selector != "" || *allocate != 0) && len(*hosts) > 0:
+			log.Fatalf("Hosts can't be given with --selector or --allocate")
+		case *allocate != 0:
+			nodeSelector := klabels.Everything()
+			if *selector != "" {
+				nodeSelector, err = klabels.Parse(*selector)
+				if err != nil {
+					log.Fatalf("Invalid --selector: %s", err)
+				}
+			}
+			allocator := allocation.NewCapacityAllocator(labeler, store, nodeSelector, spreadConstraints...)
+			candidates, err = allocator.Allocate(manifest, *allocate)
+			if err != nil {
+				log.Fatalf("Could not allocate %d hosts: %s", *allocate, err)
+			}
+			logger.WithField("hosts", candidates).Infof("Allocated %d hosts", len(candidates))
+		case *selector != "":
+			nodeSelector, err := klabels.Parse(*selector)
+			if err != nil {
+				log.Fatalf("Invalid --selector: %s", err)
+			}
+			resolver = replication.SelectorResolver(labeler, nodeSelector)
+			candidates, err = resolver()
+			if err != nil {
+				log.Fatalf("Could not find the nodes matching %s: %s", nodeSelector, err)
+			}
+			if len(candidates) == 0 {
+				log.Fatalf("No nodes match %s", nodeSelector)
+			}
+			logger.WithField("hosts", candidates).Infof("%d hosts match %s", len(candidates), nodeSelector)
+		case len(*hosts) > 0:
+			candidates = make([]types.NodeName, len(*hosts))
+			for i, host := range *hosts {
+				candidates[i] = types.NodeName(host)
+			}
+		default:
+			log.Fatalf("No hosts were given")
+		}
+		if !*includeCritical {
+			candidates, err = skipCriticalNodes(candidates, nodeHealth, logger)
+			if err != nil {
+				log.Fatalf("Could not read the health of the hosts: %s", err)
+			}
+			if len(candidates) == 0 {
+				log.Fatalf("Every host's node health is critical, see --include-critical-nodes")
+			}
+		}
+		nodes, err = cohort.Select(candidates, *percent)
+		if err != nil {
+			log.Fatalf("Invalid --percent: %s", err)
+		}
+		if len(nodes) == 0 {
+			log.Fatalf("None of the %d hosts are in the %d%% cohort", len(candidates), *percent)
+		}
+		if *percent < 100 {
+			logger.WithField("hosts", nodes).Infof("Deploying to %d of %d hosts in the %d%% cohort", len(nodes), len(candidates), *percent)
+		}
+
+		record, err = replication.NewRecord(manifest, nodes)
+		if err != nil {
+			log.Fatalf("Could not create replication record: %s", err)
+		}
+	}
+
+	if *maxParallel < 0 {
+		log.Fatalf("Invalid --max-parallel: %d", *maxParallel)
+	}
+	if *canaryCount < 0 {
+		log.Fatalf("Invalid --canary-count: %d", *canaryCount)
+	}
+	if *nodeRetries < 0 {
+		log.Fatalf("Invalid --node-retries: %d", *nodeRetries)
+	}
+	active := len(nodes) - *minNodes
+	if *maxParallel > 0 && *maxParallel < active {
+		active = *maxParallel
+	}
+
+	var minHealthyHosts replication.MinHealthy
+	if *minHealthy != "" {
+		minHealthyHosts, err = replication.ParseMinHealthy(*minHealthy)
+		if err != nil {
+			log.Fatalf("Invalid --min-healthy: %s", err)
+		}
+	}
+
+	nodeOrder, err := replication.ParseOrder(*order)
+	if err != nil {
+		log.Fatalf("Invalid --order: %s", err)
+	}
+
+	var overrides replication.NodeOverrides
+	if *nodeOverrides != "" {
+		overrides, err = replication.LoadNodeOverrides(*nodeOverrides)
+		if err != nil {
+			log.Fatalf("Invalid --node-overrides: %s", err)
+		}
+		for _, node := range nodes {
+			if _, err = overrides.Apply(manifest, node); err != nil {
+				log.Fatalf("Invalid --node-overrides: %s", err)
+			}
+		}
+	}
+
+	if *dryRun {
+		plans, err := replication.Plan(manifest, nodes, overrides, store)
+		if err != nil {
+			log.Fatalf("Could not plan replication: %s", err)
+		}
+		printPlan(plans, manifest)
+		return
+	}
+
+	timeout := replication.NoTimeout
+	if *nodeTimeout > 0 {
+		timeout = *nodeTimeout
 	}
 
 	lockMessage := fmt.Sprintf("%q from %q at %q", thisUser.Username, thisHost, time.Now())
@@ -86,20 +282,46 @@ func main() {
 		manifest,
 		logger,
 		nodes,
-		len(*hosts)-*minNodes,
+		active,
 		store,
 		client.KV(),
 		labeler,
 		healthChecker,
 		health.HealthState(*threshold),
 		lockMessage,
-		replication.NoTimeout,
+		timeout,
 		1*time.Second,
 	)
 	if err != nil {
 		log.Fatalf("Could not initialize replicator: %s", err)
 	}
 
+	if *unpause {
+		err = repl.Resume()
+		if err != nil {
+			log.Fatalf("Could not resume replications: %s", err)
+		}
+	}
+
+	if *prefetch {
+		statusStore := statusstore.NewConsul(client)
+		prefetchStatusStore := prefetchstatus.NewConsul(statusStore, statusstore.PrefetchStatusNamespace)
+		ctx, cancel := context.WithTimeout(context.Background(), *prefetchTimeout)
+		err = replication.Prefetch(ctx, manifest, nodes, store, prefetchStatusStore, logger)
+		cancel()
+		if err != nil {
+			log.Fatalf("Prefetch failed, no hosts were updated: %s", err)
+		}
+	}
+
+	rollbackPolicy := replication.NoRollback
+	switch {
+	case *rollbackOnFailure || *onFailure == "rollback":
+		rollbackPolicy = replication.RollbackOnFailure
+	case *onFailure == "abort":
+		rollbackPolicy = replication.AbortOnFailure
+	}
+
 	replication, errCh, err := repl.InitializeReplication(
 		*overrideLock,
 		*ignoreControllers,
@@ -111,20 +333,253 @@ func main() {
 		log.Fatalf("Unable to initialize replication: %s", err)
 	}
 
-	// auto-drain this channel
+	if *canaryCount > 0 {
+		replication.SetCanary(*canaryCount, *canaryWait)
+	}
+	replication.SetRollbackPolicy(rollbackPolicy)
+	replication.SetRetries(*nodeRetries)
+	replication.SetRecord(record)
+	replication.SetMinHealthy(minHealthyHosts)
+	replication.SetOrder(nodeOrder)
+	replication.SetNodeOverrides(overrides)
+	if *reresolveInterval > 0 {
+		percent := *percent
+		selected := resolver
+		replication.SetNodeResolver(func() ([]types.NodeName, error) {
+			nodes, err := selected()
+			if err != nil {
+				return nil, err
+			}
+			if !*includeCritical {
+				nodes, err = skipCriticalNodes(nodes, nodeHealth, logger)
+				if err != nil {
+					return nil, err
+				}
+			}
+			return cohort.Select(nodes, percent)
+		}, *reresolveInterval)
+	}
+	replication.SetEventStore(replicationstatus.NewConsul(statusstore.NewConsul(client), statusstore.ReplicationEventStatusNamespace))
+	replication.SetAckStore(deploystatus.NewConsul(statusstore.NewConsul(client), statusstore.DeployTimingStatusNamespace))
+	replication.SetNodeStatusStore(nodestatus.NewConsul(statusstore.NewConsul(client), statusstore.PreparerPodStatusNamespace))
+	var httpNotifier *webhook.HTTPNotifier
+	if *webhookConfig != "" {
+		config, err := webhook.LoadConfig(*webhookConfig)
+		if err != nil {
+			log.Fatalf("Unable to load webhook config: %s", err)
+		}
+		httpNotifier = webhook.NewHTTPNotifier(config, cleanhttp.DefaultClient(), logger)
+		go httpNotifier.Start(nil)
+		replication.SetNotifier(httpNotifier)
+	}
+	fmt.Printf("Replication %s: if it is interrupted, resume it with --resume %s\n", record.ID, record.ID)
+	progress := replication.ProgressUpdates()
+
+	// drain this channel, remembering whether the replication was halted
+	var replicationErr error
+	errsDrained := make(chan struct{})
 	go func() {
-		for range errCh {
+		defer close(errsDrained)
+		for err := range errCh {
+			logger.WithError(err).Errorln("Replication error")
+			replicationErr = err
 		}
 	}()
 
+	progressDone := make(chan struct{})
+	go func() {
+		defer close(progressDone)
+		printProgress(progress, len(nodes))
+	}()
+
+	enactDone := make(chan struct{})
 	go func() {
 		// clear lock immediately on ctrl-C
 		signals := make(chan os.Signal, 1)
 		signal.Notify(signals, os.Interrupt)
 		<-signals
 		replication.Cancel()
+		if httpNotifier != nil {
+			// let the replication send that it was canceled
+			select {
+			case <-enactDone:
+			case <-time.After(webhookFlushTimeout):
+			}
+			httpNotifier.Flush(webhookFlushTimeout)
+		}
 		os.Exit(1)
 	}()
 
 	replication.Enact()
+	close(enactDone)
+	<-errsDrained
+	<-progressDone
+	if httpNotifier != nil && !httpNotifier.Flush(webhookFlushTimeout) {
+		logger.NoFields().Warnln("Some webhook events were not delivered")
+	}
+	printTimings(replication.NodeTimings(), manifest, statusstore.NewConsul(client))
+	if replicationErr != nil {
+		log.Fatalf("Replication halted: %s", replicationErr)
+	}
+}
+
+type recordStore interface {
+	ReplicationRecord(id string) (*consul.ReplicationRecord, error)
+}
+
+// resumeRecord fetches the record of the replication with the given ID and
+// returns it along with the hosts it didn't complete
+func resumeRecord(store recordStore, id string, man manifest.Manifest) (consul.ReplicationRecord, []types.NodeName, error) {
+	record, err := store.ReplicationRecord(id)
+	if err != nil {
+		return consul.ReplicationRecord{}, nil, err
+	}
+	if record == nil {
+		return consul.ReplicationRecord{}, nil, fmt.Errorf("there is no record of it, it may have completed")
+	}
+	if len(*hosts) > 0 {
+		return consul.ReplicationRecord{}, nil, fmt.Errorf("hosts can't be given, they are taken from the replication's record")
+	}
+	err = replication.CheckResumable(*record, man)
+	if err != nil {
+		return consul.ReplicationRecord{}, nil, err
+	}
+	return *record, record.Remaining(), nil
+}
+
+// printPlan prints what a replication would do to each host, and how many
+// hosts it would update
+func printPlan(plans []replication.NodePlan, man manifest.Manifest) {
+	sha, _ := man.SHA()
+	fmt.Printf("Dry run of replicating %s with manifest %s to %d hosts:\n", man.ID(), shortSHA(sha), len(plans))
+	fmt.Printf("%-40s %-12s %-12s %s\n", "HOST", "INTENT", "REALITY", "ACTION")
+	counts := make(map[replication.PlanAction]int)
+	for _, plan := range plans {
+		counts[plan.Action]++
+		line := fmt.Sprintf("%-40s %-12s %-12s %s", plan.Node, describeSHA(plan.IntentSHA), describeSHA(plan.RealitySHA), plan.Action)
+		if plan.TargetSHA != sha {
+			line += fmt.Sprintf(" with overrides (%s)", shortSHA(plan.TargetSHA))
+		}
+		if plan.Err != nil {
+			line += ": " + plan.Err.Error()
+		}
+		fmt.Println(line)
+	}
+	fmt.Printf(
+		"%d hosts would be updated, %d already run the manifest, %d have no preparer, %d could not be read\n",
+		counts[replication.PlanUpdate],
+		counts[replication.PlanSkip],
+		counts[replication.PlanNoPreparer],
+		counts[replication.PlanUnknown],
+	)
+}
+
+// skipCriticalNodes returns the nodes whose published node health isn't
+// critical, in the same order
+func skipCriticalNodes(nodes []types.NodeName, nodeHealth scheduler.NodeHealthReader, logger logging.Logger) ([]types.NodeName, error) {
+	critical, err := scheduler.CriticalNodes(nodeHealth, nodes, scheduler.DefaultNodeHealthMaxAge)
+	if err != nil {
+		return nil, err
+	}
+	if critical.Len() == 0 {
+		return nodes, nil
+	}
+	logger.WithField("hosts", critical.ListNodes()).Warnf("Skipping %d hosts whose node health is critical", critical.Len())
+
+	healthy := make([]types.NodeName, 0, len(nodes)-critical.Len())
+	for _, node := range nodes {
+		if !critical.Has(node.String()) {
+			healthy = append(healthy, node)
+		}
+	}
+	return healthy, nil
+}
+
+func describeSHA(sha string) string {
+	if sha == "" {
+		return "-"
+	}
+	return shortSHA(sha)
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
+
+// printProgress prints a line for each host that finishes updating, with
+// counts of how many hosts are done
+func printProgress(progress <-chan replication.NodeProgress, total int) {
+	done := make(map[replication.NodePhase]int)
+	for update := range progress {
+		if update.Phase == replication.NodeRetrying {
+			fmt.Printf("%s retrying: %s\n", update.Node, update.Err)
+			continue
+		}
+		if !update.Done() {
+			continue
+		}
+		done[update.Phase]++
+		finished := done[replication.NodeHealthy] + done[replication.NodeSkipped] + done[replication.NodeFailed]
+		line := fmt.Sprintf(
+			"[%d/%d hosts: %d updated, %d skipped, %d failed] %s %s",
+			finished,
+			total,
+			done[replication.NodeHealthy],
+			done[replication.NodeSkipped],
+			done[replication.NodeFailed],
+			update.Node,
+			update.Phase,
+		)
+		if update.Err != nil {
+			line += ": " + update.Err.Error()
+		}
+		fmt.Println(line)
+	}
+}
+
+// printTimings prints how long each phase of the deploy took, aggregated
+// over the updated hosts, along with the slowest host in each phase
+func printTimings(timings []replication.NodeTiming, man manifest.Manifest, statusStore statusstore.Store) {
+	if len(timings) == 0 {
+		return
+	}
+	deployStatusStore := deploystatus.NewConsul(statusStore, statusstore.DeployTimingStatusNamespace)
+	replication.AddPreparerTimings(timings, man, deployStatusStore, logging.DefaultLogger)
+
+	fmt.Printf("Updated %d hosts:\n", len(timings))
+	fmt.Printf("%-15s %6s %10s %10s %10s  %s\n", "PHASE", "HOSTS", "P50", "P95", "MAX", "SLOWEST")
+	for _, summary := range replication.SummarizeTimings(timings) {
+		fmt.Printf(
+			"%-15s %6d %10s %10s %10s  %s\n",
+			summary.Phase,
+			summary.Nodes,
+			summary.P50.Round(time.Millisecond),
+			summary.P95.Round(time.Millisecond),
+			summary.Max.Round(time.Millisecond),
+			summary.Slowest,
+		)
+	}
+}
+
+// fetchManifest downloads the manifest to a temporary file, verifying it
+// against the digest given on the command line if any, and parses it
+func fetchManifest(manifestURI *url.URL) (manifest.Manifest, error) {
+	dir, err := ioutil.TempDir("", "p2-replicate")
+	if err != nil {
+		return nil, fmt.Errorf("could not create temporary directory for manifest: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "manifest.yaml")
+	err = uri.BasicFetcher{Client: http.DefaultClient}.CopyVerified(manifestURI, path, uri.VerifyOptions{
+		SHA256:  *manifestSHA256,
+		Sidecar: *manifestSidecar,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch manifest %s: %s", manifestURI, err)
+	}
+	return manifest.FromPath(path)
 }
@@ -30,7 +30,7 @@ $ p2-restart --pod-dir /custom/pod/home
 )
 
 func main() {
-	restart.Version(version.VERSION)
+	version.Register(restart)
 	kingpin.MustParse(restart.Parse(os.Args[1:]))
 
 	pods.Log.Logger.Formatter = &logrus.TextFormatter{
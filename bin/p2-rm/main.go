@@ -27,7 +27,7 @@ var (
 )
 
 func main() {
-	kingpin.Version(version.VERSION)
+	version.Register(kingpin.CommandLine)
 	_, opts, _ := flags.ParseWithConsulOptions()
 
 	consulClient := consul.NewConsulClient(opts)
@@ -0,0 +1,162 @@
+// p2-rollback re-deploys a manifest that was previously deployed for a pod,
+// as recorded by the preparer in the manifest history.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"os/user"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/health/checker"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/replication"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/version"
+)
+
+var (
+	podID             = kingpin.Arg("pod", "The pod to roll back").Required().String()
+	hosts             = kingpin.Arg("hosts", "The hosts to roll back the pod on").Required().Strings()
+	to                = kingpin.Flag("to", "The manifest to roll back to: \"previous\" for the one deployed before the current one, or the SHA of one in the manifest history").Default("previous").String()
+	minNodes          = kingpin.Flag("min-nodes", "The minimum number of healthy nodes that must remain up while rolling back.").Default("1").Short('m').Int()
+	threshold         = kingpin.Flag("threshold", "The minimum health level to treat as healthy. One of (in order) passing, warning, unknown, critical.").String()
+	overrideLock      = kingpin.Flag("override-lock", "Override any lock holders").Bool()
+	ignoreControllers = kingpin.Flag("ignore-controllers", "Roll back even if there are controllers managing some of the hosts").Bool()
+	list              = kingpin.Flag("list", "List the manifest history of the pod on each host instead of rolling back").Bool()
+)
+
+func main() {
+	kingpin.CommandLine.Name = "p2-rollback"
+	kingpin.CommandLine.Help = `p2-rollback re-deploys a manifest that was previously deployed for a pod. The
+preparer keeps the last few manifests it deployed for each pod on each host,
+and the rollback goes through the same health-gated replication as p2-replicate.
+
+	Example invocation: p2-rollback --to previous helloworld aws{1,2,3}.example.com
+`
+	version.Register(kingpin.CommandLine)
+	_, opts, labeler := flags.ParseWithConsulOptions()
+	client := consul.NewConsulClient(opts)
+	store := consul.NewConsulStore(client)
+
+	nodes := make([]types.NodeName, len(*hosts))
+	for i, host := range *hosts {
+		nodes[i] = types.NodeName(host)
+	}
+
+	if *list {
+		for _, node := range nodes {
+			history, err := store.ManifestHistory(node, types.PodID(*podID))
+			if err != nil {
+				log.Fatalf("Could not read manifest history on %s: %s", node, err)
+			}
+			fmt.Printf("%s:\n", node)
+			for _, entry := range history {
+				fmt.Printf("  %s  %s\n", entry.SHA, entry.DeployedAt.Local().Format(time.RFC3339))
+			}
+		}
+		return
+	}
+
+	// "previous" may be a different manifest on each host, rolling back
+	// to different manifests at once isn't supported
+	targets := make(map[string][]string)
+	var target consul.ManifestHistoryEntry
+	for _, node := range nodes {
+		history, err := store.ManifestHistory(node, types.PodID(*podID))
+		if err != nil {
+			log.Fatalf("Could not read manifest history on %s: %s", node, err)
+		}
+		entry, err := consul.RollbackTarget(history, *to)
+		if err != nil {
+			log.Fatalf("Could not find the manifest to roll back to on %s: %s", node, err)
+		}
+		target = entry
+		targets[entry.SHA] = append(targets[entry.SHA], node.String())
+	}
+	if len(targets) > 1 {
+		var descriptions []string
+		for sha, nodes := range targets {
+			descriptions = append(descriptions, fmt.Sprintf("%s on %s", sha, strings.Join(nodes, ", ")))
+		}
+		sort.Strings(descriptions)
+		log.Fatalf("The hosts would be rolled back to different manifests, roll them back separately or pass --to <sha>: %s", strings.Join(descriptions, "; "))
+	}
+
+	logger := logging.NewLogger(logrus.Fields{
+		"pod": *podID,
+		"sha": target.SHA,
+	})
+	logger.Logger.Formatter = &logrus.TextFormatter{
+		DisableTimestamp: false,
+		FullTimestamp:    true,
+		TimestampFormat:  "15:04:05.000",
+	}
+	logger.Infof("Rolling back %d hosts to the manifest deployed at %s", len(nodes), target.DeployedAt.Local().Format(time.RFC3339))
+
+	thisHost, err := os.Hostname()
+	if err != nil {
+		log.Fatalf("Could not retrieve hostname: %s", err)
+	}
+	thisUser, err := user.Current()
+	if err != nil {
+		log.Fatalf("Could not retrieve user: %s", err)
+	}
+	lockMessage := fmt.Sprintf("%q from %q at %q (rollback)", thisUser.Username, thisHost, time.Now())
+
+	repl, err := replication.NewReplicator(
+		target.Manifest,
+		logger,
+		nodes,
+		len(nodes)-*minNodes,
+		store,
+		client.KV(),
+		labeler,
+		checker.NewHealthChecker(client),
+		health.HealthState(*threshold),
+		lockMessage,
+		replication.NoTimeout,
+		1*time.Second,
+	)
+	if err != nil {
+		log.Fatalf("Could not initialize replicator: %s", err)
+	}
+
+	replication, errCh, err := repl.InitializeReplication(
+		*overrideLock,
+		*ignoreControllers,
+		replication.DefaultConcurrentReality,
+		0,
+		nil,
+	)
+	if err != nil {
+		log.Fatalf("Unable to initialize replication: %s", err)
+	}
+
+	// auto-drain this channel
+	go func() {
+		for range errCh {
+		}
+	}()
+
+	go func() {
+		// clear lock immediately on ctrl-C
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt)
+		<-signals
+		replication.Cancel()
+		os.Exit(1)
+	}()
+
+	replication.Enact()
+}
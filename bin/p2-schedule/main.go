@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/user"
 
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/schedule"
@@ -22,10 +23,11 @@ var (
 	nodeName     = kingpin.Flag("node", "The node to do the scheduling on. Uses the hostname by default.").String()
 	hookGlobal   = kingpin.Flag("hook", "Schedule as a global hook.").Bool()
 	uuidPod      = kingpin.Flag("uuid-pod", "Schedule the pod using the new UUID scheme").Bool()
+	force        = kingpin.Flag("force", "Overwrite the intent even if someone else just deployed a different manifest of the pod to the node").Bool()
 )
 
 func main() {
-	kingpin.Version(version.VERSION)
+	version.Register(kingpin.CommandLine)
 	_, opts, _ := flags.ParseWithConsulOptions()
 	client := consul.NewConsulClient(opts)
 	store := consul.NewConsulStore(client)
@@ -60,12 +62,14 @@ func main() {
 	} else {
 
 		// Legacy pod
-		podPrefix := consul.INTENT_TREE
 		if *hookGlobal {
-			podPrefix = consul.HOOK_TREE
+			_, err = store.SetPod(consul.HOOK_TREE, types.NodeName(*nodeName), podManifest)
+		} else {
+			err = store.SetPodChecked(types.NodeName(*nodeName), podManifest, writerName(), "", *force)
 		}
-		_, err := store.SetPod(podPrefix, types.NodeName(*nodeName), podManifest)
-		if err != nil {
+		if consul.IsConflictingDeploy(err) {
+			log.Fatalf("%s\nRerun with --force to overwrite it", err)
+		} else if err != nil {
 			log.Fatalf("Could not write manifest %s to intent store: %s\n", podManifest.ID(), err)
 		}
 	}
@@ -77,3 +81,18 @@ func main() {
 
 	fmt.Println(string(outBytes))
 }
+
+// writerName identifies this invocation in the record of who last deployed
+// the pod, so that a different user deploying the pod at the same time is
+// detected as a conflicting deploy
+func writerName() string {
+	username := "unknown"
+	if currentUser, err := user.Current(); err == nil {
+		username = currentUser.Username
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("p2-schedule:user:%s:host:%s", username, hostname)
+}
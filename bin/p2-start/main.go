@@ -38,7 +38,7 @@ var (
 )
 
 func main() {
-	app.Version(version.VERSION)
+	version.Register(app)
 	kingpin.MustParse(app.Parse(os.Args[1:]))
 
 	pods.Log.Logger.Formatter = &logrus.TextFormatter{
@@ -0,0 +1,137 @@
+// p2-status reads and writes statuses in the status store, so that hooks and
+// operators can publish structured statuses of their own, such as the
+// progress of a migration, next to the ones p2 records.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/version"
+)
+
+const (
+	CmdGet   = "get"
+	CmdSet   = "set"
+	CmdWatch = "watch"
+)
+
+var resourceTypes = []string{
+	statusstore.PC.String(),
+	statusstore.POD.String(),
+	statusstore.DS.String(),
+	statusstore.RC.String(),
+	statusstore.NODE.String(),
+	statusstore.NODE_HEALTH.String(),
+}
+
+var (
+	cmdGet          = kingpin.Command(CmdGet, "Print a status. Statuses that are JSON are indented.")
+	getResourceType = cmdGet.Arg("resource-type", "The type of the resource").Required().Enum(resourceTypes...)
+	getID           = cmdGet.Arg("id", "The ID of the resource, such as a pod ID or node name").Required().String()
+	getNamespace    = cmdGet.Arg("namespace", "The namespace of the status").Required().String()
+
+	cmdSet          = kingpin.Command(CmdSet, "Write a status, replacing the one in the namespace if there is one.")
+	setResourceType = cmdSet.Arg("resource-type", "The type of the resource").Required().Enum(resourceTypes...)
+	setID           = cmdSet.Arg("id", "The ID of the resource, such as a pod ID or node name").Required().String()
+	setNamespace    = cmdSet.Arg("namespace", "The namespace of the status").Required().String()
+	setValue        = cmdSet.Arg("value", "The status, or - to read it from stdin").Required().String()
+	setRaw          = cmdSet.Flag("raw", "Write the status as is, instead of requiring it to be JSON").Bool()
+	setForce        = cmdSet.Flag("force", "Write the status even if the namespace is one that p2 writes to itself").Bool()
+
+	cmdWatch          = kingpin.Command(CmdWatch, "Print a status, then print it again every time it changes.")
+	watchResourceType = cmdWatch.Arg("resource-type", "The type of the resource").Required().Enum(resourceTypes...)
+	watchID           = cmdWatch.Arg("id", "The ID of the resource, such as a pod ID or node name").Required().String()
+	watchNamespace    = cmdWatch.Arg("namespace", "The namespace of the status").Required().String()
+)
+
+func main() {
+	kingpin.CommandLine.Name = "p2-status"
+	version.Register(kingpin.CommandLine)
+	cmd, opts, _ := flags.ParseWithConsulOptions()
+	client := consul.NewConsulClient(opts)
+	store := statusstore.NewConsul(client)
+
+	switch cmd {
+	case CmdGet:
+		status, _, err := store.GetStatus(statusstore.ResourceType(*getResourceType), statusstore.ResourceID(*getID), statusstore.Namespace(*getNamespace))
+		if statusstore.IsNoStatus(err) {
+			log.Fatalf("There is no %s status for %s %s", *getNamespace, *getResourceType, *getID)
+		}
+		if err != nil {
+			log.Fatalf("Could not get status: %s", err)
+		}
+		printStatus(status)
+	case CmdSet:
+		namespace := statusstore.Namespace(*setNamespace)
+		if statusstore.IsReserved(namespace) && !*setForce {
+			log.Fatalf("p2 writes %s statuses itself, pass --force to overwrite one anyway", namespace)
+		}
+		value := []byte(*setValue)
+		if *setValue == "-" {
+			var err error
+			value, err = ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				log.Fatalf("Could not read the status from stdin: %s", err)
+			}
+		}
+		if !*setRaw && !json.Valid(value) {
+			log.Fatalf("The status is not valid JSON, pass --raw to write it anyway")
+		}
+		err := store.SetStatus(statusstore.ResourceType(*setResourceType), statusstore.ResourceID(*setID), namespace, statusstore.Status(value))
+		if err != nil {
+			log.Fatalf("Could not set status: %s", err)
+		}
+	case CmdWatch:
+		watch(store, statusstore.ResourceType(*watchResourceType), statusstore.ResourceID(*watchID), statusstore.Namespace(*watchNamespace))
+	}
+}
+
+// watch prints the status, and again each time it changes, until interrupted
+func watch(store statusstore.Store, resourceType statusstore.ResourceType, id statusstore.ResourceID, namespace statusstore.Namespace) {
+	var waitIndex uint64
+	for {
+		status, queryMeta, err := store.WatchStatus(resourceType, id, namespace, waitIndex)
+		if err != nil && !statusstore.IsNoStatus(err) {
+			log.Printf("Could not watch status: %s", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		// the watch timed out without a change
+		if waitIndex != 0 && queryMeta.LastIndex == waitIndex {
+			continue
+		}
+		// consul's index went backwards, so the watch starts over
+		if queryMeta.LastIndex < waitIndex {
+			waitIndex = 0
+			continue
+		}
+		waitIndex = queryMeta.LastIndex
+
+		if statusstore.IsNoStatus(err) {
+			fmt.Printf("%s: no status\n", time.Now().Format(time.RFC3339))
+			continue
+		}
+		fmt.Printf("%s:\n", time.Now().Format(time.RFC3339))
+		printStatus(status)
+	}
+}
+
+func printStatus(status statusstore.Status) {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, status.Bytes(), "", "  "); err == nil {
+		fmt.Println(indented.String())
+		return
+	}
+	fmt.Println(string(status.Bytes()))
+}
@@ -0,0 +1,72 @@
+// p2-warehouse-export exports the health transitions and pod lifecycle events of
+// a P2 cluster to a data warehouse, see the warehouse package. A single
+// instance should run per cluster.
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/go-cleanhttp"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/health/checker"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/version"
+	"github.com/square/p2/pkg/warehouse"
+)
+
+var (
+	configPath = kingpin.Flag("config", "Path to a YAML file configuring the warehouse sink").Required().ExistingFile()
+	logLevel   = kingpin.Flag("log", "Logging level to display").String()
+)
+
+func main() {
+	version.Register(kingpin.CommandLine)
+	_, opts, _ := flags.ParseWithConsulOptions()
+
+	logger := logging.NewLogger(logrus.Fields{})
+	logger.Logger.Formatter = new(logrus.TextFormatter)
+	if *logLevel != "" {
+		lv, err := logrus.ParseLevel(*logLevel)
+		if err != nil {
+			logger.WithErrorAndFields(err, logrus.Fields{"level": *logLevel}).
+				Fatalln("Could not parse log level")
+		}
+		logger.Logger.Level = lv
+	}
+
+	config, err := warehouse.LoadConfig(*configPath)
+	if err != nil {
+		logger.WithError(err).Fatalln("Unable to load warehouse config")
+	}
+	sink, err := warehouse.NewSink(config, cleanhttp.DefaultClient(), logger)
+	if err != nil {
+		logger.WithError(err).Fatalln("Unable to initialize warehouse sink")
+	}
+
+	client := consul.NewConsulClient(opts)
+	exporter := warehouse.NewExporter(
+		checker.NewHealthChecker(client),
+		consul.NewConsulStore(client),
+		sink,
+		config,
+		logger,
+	)
+
+	quit := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		close(quit)
+	}()
+
+	logger.NoFields().Infoln("Exporting to the warehouse")
+	exporter.Run(quit)
+	logger.NoFields().Infoln("Stopped exporting")
+}
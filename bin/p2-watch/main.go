@@ -34,10 +34,11 @@ var (
 	podClusters   = kingpin.Flag("pod-clusters", "Watch pod clusters and their labeled pods").Bool()
 	watchHealthF  = kingpin.Flag("health", "Watch health using HealthChecker").Bool()
 	healthService = kingpin.Arg("health-pod", "Pod to watch. Required if --health is passed").String()
+	healthHistory = kingpin.Flag("history", "With --health, print the last N statuses of the pod on --node, and when it changed to each, instead of watching it").Int()
 )
 
 func main() {
-	kingpin.Version(version.VERSION)
+	version.Register(kingpin.CommandLine)
 	_, opts, applicator := flags.ParseWithConsulOptions()
 	client := consul.NewConsulClient(opts)
 	store := consul.NewConsulStore(client)
@@ -56,6 +57,10 @@ func main() {
 			log.Fatal("Refusing to watch entire health tree, please set a pod ID with --health-pod")
 		}
 
+		if *healthHistory > 0 {
+			printHealthHistory(*healthService, types.NodeName(*nodeName), *healthHistory, client)
+			return
+		}
 		watchHealth(*healthService, client)
 		return
 	} else {
@@ -69,20 +74,19 @@ func main() {
 
 		quit := make(chan struct{})
 		errChan := make(chan error)
-		podCh := make(chan []consul.ManifestResult)
-		go store.WatchPods(podPrefix, types.NodeName(*nodeName), quit, errChan, podCh)
+		changesCh := make(chan consul.PodChanges)
+		go store.WatchPodChanges(podPrefix, types.NodeName(*nodeName), quit, errChan, changesCh)
+		first := true
 		for {
 			select {
-			case results := <-podCh:
-				if len(results) == 0 {
-					fmt.Println(fmt.Sprintf("No manifests exist for %s under %s (they may have been deleted)", *nodeName, podPrefix))
-				} else {
-					for _, result := range results {
-						if err := result.Manifest.Write(os.Stdout); err != nil {
-							log.Fatalf("write error: %v", err)
-						}
-					}
+			case changes := <-changesCh:
+				if first && len(changes.Current) == 0 {
+					fmt.Println(fmt.Sprintf("No manifests exist for %s under %s", *nodeName, podPrefix))
 				}
+				first = false
+				printPodChanges("created", changes.Created)
+				printPodChanges("updated", changes.Updated)
+				printPodChanges("deleted", changes.Deleted)
 			case err := <-errChan:
 				log.Fatalf("Error occurred while listening to pods: %s", err)
 			}
@@ -90,6 +94,18 @@ func main() {
 	}
 }
 
+func printPodChanges(change string, results []consul.ManifestResult) {
+	for _, result := range results {
+		fmt.Printf("# %s %s on %s\n", change, result.Manifest.ID(), result.PodLocation.Node)
+		if change == "deleted" {
+			continue
+		}
+		if err := result.Manifest.Write(os.Stdout); err != nil {
+			log.Fatalf("write error: %v", err)
+		}
+	}
+}
+
 type printSyncer struct {
 	logger *logging.Logger
 }
@@ -178,6 +194,25 @@ func watchHealth(service string, client consulutil.ConsulClient) {
 	}
 }
 
+func printHealthHistory(service string, node types.NodeName, n int, client consulutil.ConsulClient) {
+	hc := checker.NewHealthChecker(client)
+	history, err := hc.History(node, service, n)
+	if err != nil {
+		log.Fatalf("Could not read the health history of %s on %s: %s", service, node, err)
+	}
+	if len(history) == 0 {
+		fmt.Printf("No health history of %s on %s\n", service, node)
+		return
+	}
+	for _, entry := range history {
+		if entry.Reason != "" {
+			fmt.Printf("%s %s (%s)\n", entry.Time.Format(time.RFC3339), entry.Status, entry.Reason)
+		} else {
+			fmt.Printf("%s %s\n", entry.Time.Format(time.RFC3339), entry.Status)
+		}
+	}
+}
+
 type nodeHealthResults []health.Result
 
 func (hrs nodeHealthResults) Len() int {
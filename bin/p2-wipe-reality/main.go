@@ -24,7 +24,7 @@ func main() {
 	// in the reality tree. This is useful if any pods on a host have
 	// been manually altered in some way and need to be restored to
 	// a known state.
-	kingpin.Version(version.VERSION)
+	version.Register(kingpin.CommandLine)
 	_, opts, _ := flags.ParseWithConsulOptions()
 
 	client := consul.NewConsulClient(opts)
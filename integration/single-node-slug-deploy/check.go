@@ -506,7 +506,7 @@ func verifyProcessExit(errCh chan error, tempDir string, logger logging.Logger)
 
 	logger.Infoln("Checking for exit code in consul")
 	timeout = time.After(30 * time.Second)
-	podStatusStore := podstatus.NewConsul(statusstore.NewConsul(consul.NewConsulClient(consul.Options{})), consul.PreparerPodStatusNamespace)
+	podStatusStore := podstatus.NewConsul(statusstore.NewConsul(consul.NewConsulClient(consul.Options{})), statusstore.PreparerPodStatusNamespace)
 	for {
 
 		podStatus, _, err := podStatusStore.Get(podUniqueKey)
@@ -0,0 +1,237 @@
+// Package allocation chooses the hosts a pod should be deployed to, based on
+// the resources its manifest requests and the capacity each host has left.
+package allocation
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/scheduler"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/size"
+)
+
+const (
+	// The node labels that declare how many logical CPUs and how much
+	// memory (such as "64G") a node has for pods
+	CPUCapacityLabel    = "capacity_cpus"
+	MemoryCapacityLabel = "capacity_memory"
+)
+
+// An Allocator chooses the hosts to deploy a pod to
+type Allocator interface {
+	// Allocate returns the count best hosts for the manifest, or an error
+	// if fewer than count hosts can fit it
+	Allocate(manifest manifest.Manifest, count int) ([]types.NodeName, error)
+}
+
+// Resources are an amount of CPUs and memory, either requested by a pod or
+// available on a node
+type Resources struct {
+	CPUs   int
+	Memory size.ByteCount
+}
+
+// Fits returns whether the request fits in the resources
+func (r Resources) Fits(request Resources) bool {
+	return request.CPUs <= r.CPUs && request.Memory <= r.Memory
+}
+
+func (r Resources) minus(other Resources) Resources {
+	return Resources{CPUs: r.CPUs - other.CPUs, Memory: r.Memory - other.Memory}
+}
+
+// Request returns the resources a manifest requests. A pod-wide cgroup limit
+// takes precedence; otherwise the limits of its launchables are added up.
+func Request(m manifest.Manifest) Resources {
+	if cgroup := m.GetResourceLimits().Cgroup; cgroup != nil {
+		return Resources{CPUs: cgroup.CPUs, Memory: cgroup.Memory}
+	}
+
+	var request Resources
+	for _, stanza := range m.GetLaunchableStanzas() {
+		request.CPUs += stanza.CgroupConfig.CPUs
+		request.Memory += stanza.CgroupConfig.Memory
+	}
+	return request
+}
+
+// PodLister lists the pods scheduled on a node
+type PodLister interface {
+	ListPods(podPrefix consul.PodPrefix, nodename types.NodeName) ([]consul.ManifestResult, time.Duration, error)
+}
+
+// CapacityAllocator allocates hosts by the capacity declared in their
+// CPUCapacityLabel and MemoryCapacityLabel labels, less the requests of the
+// pods already in their intent. Nodes without both labels, and cordoned
+// nodes, are never chosen.
+type CapacityAllocator struct {
+	labeler scheduler.NodeLabeler
+	pods    PodLister
+	// only nodes matching this selector are considered
+	selector klabels.Selector
+	// constraints every allocation must satisfy, see SpreadConstraint
+	spread []SpreadConstraint
+}
+
+var _ Allocator = CapacityAllocator{}
+
+func NewCapacityAllocator(labeler scheduler.NodeLabeler, pods PodLister, selector klabels.Selector, spread ...SpreadConstraint) CapacityAllocator {
+	if selector == nil {
+		selector = klabels.Everything()
+	}
+	return CapacityAllocator{
+		labeler:  labeler,
+		pods:     pods,
+		selector: selector,
+		spread:   spread,
+	}
+}
+
+// nodeState is what the allocator knows about a node it considers
+type nodeState struct {
+	node   types.NodeName
+	labels klabels.Set
+	// the resources left on the node, not counting the pod being allocated
+	free Resources
+	// whether the pod being allocated is already in the node's intent
+	hasPod bool
+	// whether the node can be chosen
+	eligible bool
+}
+
+// Allocate returns the count hosts with the most resources left after the
+// manifest is placed on them, preferring memory, then CPUs, then the host
+// name, and skipping hosts that would break a spread constraint. A host that
+// already runs the pod is counted as if it didn't, since deploying there
+// replaces it.
+func (a CapacityAllocator) Allocate(m manifest.Manifest, count int) ([]types.NodeName, error) {
+	if count <= 0 {
+		return nil, util.Errorf("the number of hosts to allocate must be positive, got %d", count)
+	}
+
+	states, err := a.nodeStates(m.ID())
+	if err != nil {
+		return nil, err
+	}
+
+	request := Request(m)
+	type candidate struct {
+		nodeState
+		left Resources
+	}
+	var candidates []candidate
+	for _, state := range states {
+		if state.eligible && state.free.Fits(request) {
+			candidates = append(candidates, candidate{nodeState: state, left: state.free.minus(request)})
+		}
+	}
+	if len(candidates) < count {
+		return nil, util.Errorf("only %d hosts have room for %d CPUs and %s of memory, %d are needed", len(candidates), request.CPUs, request.Memory, count)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i].left, candidates[j].left
+		if a.Memory != b.Memory {
+			return a.Memory > b.Memory
+		}
+		if a.CPUs != b.CPUs {
+			return a.CPUs > b.CPUs
+		}
+		return candidates[i].node < candidates[j].node
+	})
+
+	ordered := make([]nodeState, len(candidates))
+	for i, c := range candidates {
+		ordered[i] = c.nodeState
+	}
+	nodes := solveSpread(ordered, states, a.spread, count)
+	if len(nodes) < count {
+		return nil, util.Errorf("only %d of the %d hosts with room can be allocated without breaking the spread constraints %s, %d are needed", len(nodes), len(candidates), FormatSpreadConstraints(a.spread), count)
+	}
+	return nodes, nil
+}
+
+// Free returns the resources left on each eligible node, not counting the
+// given pod
+func (a CapacityAllocator) Free(podID types.PodID) (map[types.NodeName]Resources, error) {
+	states, err := a.nodeStates(podID)
+	if err != nil {
+		return nil, err
+	}
+
+	free := make(map[types.NodeName]Resources)
+	for _, state := range states {
+		if state.eligible {
+			free[state.node] = state.free
+		}
+	}
+	return free, nil
+}
+
+// nodeStates returns the state of every node matching the selector. Nodes
+// that can't be chosen are included too, since the pod may already be on
+// them and count towards the spread constraints.
+func (a CapacityAllocator) nodeStates(podID types.PodID) ([]nodeState, error) {
+	matches, err := a.labeler.GetMatches(a.selector, labels.NODE)
+	if err != nil {
+		return nil, util.Errorf("could not find the nodes matching %s: %s", a.selector, err)
+	}
+	cordoned, err := scheduler.CordonedNodes(a.labeler)
+	if err != nil {
+		return nil, util.Errorf("could not find the cordoned nodes: %s", err)
+	}
+
+	states := make([]nodeState, 0, len(matches))
+	for _, match := range matches {
+		state := nodeState{
+			node:   types.NodeName(match.ID),
+			labels: match.Labels,
+		}
+		capacity, ok, err := Capacity(match.Labels)
+		if err != nil {
+			return nil, util.Errorf("node %s: %s", state.node, err)
+		}
+		state.eligible = ok && !cordoned.Has(state.node.String())
+
+		results, _, err := a.pods.ListPods(consul.INTENT_TREE, state.node)
+		if err != nil {
+			return nil, util.Errorf("could not list the pods on %s: %s", state.node, err)
+		}
+		for _, result := range results {
+			if result.Manifest.ID() == podID {
+				state.hasPod = true
+				continue
+			}
+			capacity = capacity.minus(Request(result.Manifest))
+		}
+		state.free = capacity
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// Capacity parses the capacity declared by a node's labels. It returns false
+// if the node doesn't declare both its CPUs and its memory.
+func Capacity(nodeLabels klabels.Labels) (Resources, bool, error) {
+	if !nodeLabels.Has(CPUCapacityLabel) || !nodeLabels.Has(MemoryCapacityLabel) {
+		return Resources{}, false, nil
+	}
+
+	cpus, err := strconv.Atoi(nodeLabels.Get(CPUCapacityLabel))
+	if err != nil {
+		return Resources{}, false, util.Errorf("invalid %s label: %s", CPUCapacityLabel, err)
+	}
+	memory, err := size.Parse(nodeLabels.Get(MemoryCapacityLabel))
+	if err != nil {
+		return Resources{}, false, util.Errorf("invalid %s label: %s", MemoryCapacityLabel, err)
+	}
+	return Resources{CPUs: cpus, Memory: memory}, true, nil
+}
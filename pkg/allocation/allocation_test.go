@@ -0,0 +1,115 @@
+package allocation
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/cgroups"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util/size"
+)
+
+type fakePods map[types.NodeName][]manifest.Manifest
+
+func (f fakePods) ListPods(podPrefix consul.PodPrefix, node types.NodeName) ([]consul.ManifestResult, time.Duration, error) {
+	var results []consul.ManifestResult
+	for _, m := range f[node] {
+		results = append(results, consul.ManifestResult{Manifest: m})
+	}
+	return results, 0, nil
+}
+
+func podManifest(id types.PodID, cpus int, memory size.ByteCount) manifest.Manifest {
+	builder := manifest.NewBuilder()
+	builder.SetID(id)
+	builder.SetResourceLimits(manifest.ResourceLimitsStanza{
+		Cgroup: &cgroups.Config{CPUs: cpus, Memory: memory},
+	})
+	return builder.GetManifest()
+}
+
+func setCapacity(t *testing.T, labeler labels.Applicator, node string, cpus string, memory string) {
+	if err := labeler.SetLabel(labels.NODE, node, CPUCapacityLabel, cpus); err != nil {
+		t.Fatal(err)
+	}
+	if err := labeler.SetLabel(labels.NODE, node, MemoryCapacityLabel, memory); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAllocatePicksHostsWithTheMostRoom(t *testing.T) {
+	labeler := labels.NewFakeApplicator()
+	setCapacity(t, labeler, "small", "2", "4G")
+	setCapacity(t, labeler, "large", "16", "64G")
+	setCapacity(t, labeler, "busy", "16", "64G")
+	setCapacity(t, labeler, "cordoned", "32", "128G")
+	if err := labeler.SetLabel(labels.NODE, "cordoned", types.CordonedLabel, "true"); err != nil {
+		t.Fatal(err)
+	}
+	// no capacity labels, so never chosen
+	if err := labeler.SetLabel(labels.NODE, "unlabeled", "role", "web"); err != nil {
+		t.Fatal(err)
+	}
+
+	pods := fakePods{
+		"busy": {podManifest("other", 8, 48*size.Gibibyte)},
+		// the pod being allocated doesn't count against its own host
+		"large": {podManifest("web", 4, 8*size.Gibibyte)},
+	}
+	allocator := NewCapacityAllocator(labeler, pods, nil)
+	web := podManifest("web", 4, 8*size.Gibibyte)
+
+	nodes, err := allocator.Allocate(web, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []types.NodeName{"large", "busy"}
+	if !reflect.DeepEqual(nodes, expected) {
+		t.Errorf("expected %v, got %v", expected, nodes)
+	}
+
+	if _, err := allocator.Allocate(web, 3); err == nil {
+		t.Error("expected an error when too few hosts have room")
+	}
+}
+
+func TestAllocateOnlyConsidersSelectedNodes(t *testing.T) {
+	labeler := labels.NewFakeApplicator()
+	setCapacity(t, labeler, "east", "4", "8G")
+	setCapacity(t, labeler, "west", "16", "64G")
+	if err := labeler.SetLabel(labels.NODE, "east", "az", "east"); err != nil {
+		t.Fatal(err)
+	}
+
+	selector := klabels.Everything().Add("az", klabels.EqualsOperator, []string{"east"})
+	allocator := NewCapacityAllocator(labeler, fakePods{}, selector)
+	nodes, err := allocator.Allocate(podManifest("web", 1, size.Gibibyte), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0] != "east" {
+		t.Errorf("expected [east], got %v", nodes)
+	}
+}
+
+func TestRequestAddsUpLaunchables(t *testing.T) {
+	builder := manifest.NewBuilder()
+	builder.SetID("web")
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"app":     {CgroupConfig: cgroups.Config{CPUs: 2, Memory: size.Gibibyte}},
+		"sidecar": {CgroupConfig: cgroups.Config{CPUs: 1, Memory: 512 * size.Mebibyte}},
+	})
+
+	request := Request(builder.GetManifest())
+	expected := Resources{CPUs: 3, Memory: size.Gibibyte + 512*size.Mebibyte}
+	if request != expected {
+		t.Errorf("expected %+v, got %+v", expected, request)
+	}
+}
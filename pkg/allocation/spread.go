@@ -0,0 +1,102 @@
+package allocation
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// A SpreadConstraint limits how many nodes that share a value of a
+// failure-domain label, such as a rack or an availability zone, a pod may
+// be on. Nodes that already have the pod count towards the limit, whether
+// or not they are allocated again. Nodes without the label can't be
+// allocated while the constraint applies.
+type SpreadConstraint struct {
+	Label        string
+	MaxPerDomain int
+}
+
+func (c SpreadConstraint) String() string {
+	return c.Label + ":" + strconv.Itoa(c.MaxPerDomain)
+}
+
+// ParseSpreadConstraints parses a comma separated list of constraints, each
+// of the form <label>:<max>. For example, "rack:1,availability_zone:3"
+// allows at most one pod per rack and three per availability zone.
+func ParseSpreadConstraints(s string) ([]SpreadConstraint, error) {
+	var constraints []SpreadConstraint
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		fields := strings.Split(part, ":")
+		if len(fields) != 2 || fields[0] == "" {
+			return nil, util.Errorf("invalid spread constraint %q, expected <label>:<max>", part)
+		}
+		max, err := strconv.Atoi(fields[1])
+		if err != nil || max <= 0 {
+			return nil, util.Errorf("invalid spread constraint %q, the maximum must be a positive integer", part)
+		}
+		constraints = append(constraints, SpreadConstraint{Label: fields[0], MaxPerDomain: max})
+	}
+	return constraints, nil
+}
+
+func FormatSpreadConstraints(constraints []SpreadConstraint) string {
+	parts := make([]string, len(constraints))
+	for i, c := range constraints {
+		parts[i] = c.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// solveSpread greedily picks up to count of the candidates, in order,
+// skipping any that would put more of the pod in a failure domain than a
+// constraint allows. existing is every node considered, and the ones that
+// already have the pod are counted before anything is picked.
+func solveSpread(candidates []nodeState, existing []nodeState, constraints []SpreadConstraint, count int) []types.NodeName {
+	// the number of nodes with the pod in each domain, per constraint
+	counts := make([]map[string]int, len(constraints))
+	for i, c := range constraints {
+		counts[i] = make(map[string]int)
+		for _, state := range existing {
+			if state.hasPod && state.labels.Has(c.Label) {
+				counts[i][state.labels.Get(c.Label)]++
+			}
+		}
+	}
+
+	fits := func(state nodeState) bool {
+		for i, c := range constraints {
+			if !state.labels.Has(c.Label) {
+				return false
+			}
+			// a node that has the pod is already counted
+			if !state.hasPod && counts[i][state.labels.Get(c.Label)] >= c.MaxPerDomain {
+				return false
+			}
+		}
+		return true
+	}
+
+	var nodes []types.NodeName
+	for _, state := range candidates {
+		if len(nodes) == count {
+			break
+		}
+		if !fits(state) {
+			continue
+		}
+		nodes = append(nodes, state.node)
+		if state.hasPod {
+			continue
+		}
+		for i, c := range constraints {
+			counts[i][state.labels.Get(c.Label)]++
+		}
+	}
+	return nodes
+}
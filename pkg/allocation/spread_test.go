@@ -0,0 +1,109 @@
+package allocation
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util/size"
+)
+
+func TestParseSpreadConstraints(t *testing.T) {
+	constraints, err := ParseSpreadConstraints("rack:1, availability_zone:3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []SpreadConstraint{{"rack", 1}, {"availability_zone", 3}}
+	if !reflect.DeepEqual(constraints, expected) {
+		t.Errorf("expected %v, got %v", expected, constraints)
+	}
+	if formatted := FormatSpreadConstraints(constraints); formatted != "rack:1,availability_zone:3" {
+		t.Errorf("unexpected formatting %q", formatted)
+	}
+
+	for _, invalid := range []string{"rack", "rack:0", "rack:x", ":2", "rack:1:2"} {
+		if _, err := ParseSpreadConstraints(invalid); err == nil {
+			t.Errorf("expected %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestAllocateSpreadsAcrossRacks(t *testing.T) {
+	labeler := labels.NewFakeApplicator()
+	// the roomiest nodes are all in rack a
+	nodeRacks := map[string]string{
+		"a1": "a", "a2": "a", "a3": "a",
+		"b1": "b", "c1": "c",
+	}
+	memory := map[string]string{
+		"a1": "64G", "a2": "63G", "a3": "62G",
+		"b1": "32G", "c1": "16G",
+	}
+	for node, rack := range nodeRacks {
+		setCapacity(t, labeler, node, "16", memory[node])
+		if err := labeler.SetLabel(labels.NODE, node, "rack", rack); err != nil {
+			t.Fatal(err)
+		}
+	}
+	web := podManifest("web", 1, size.Gibibyte)
+	spread := SpreadConstraint{Label: "rack", MaxPerDomain: 1}
+
+	allocator := NewCapacityAllocator(labeler, fakePods{}, nil, spread)
+	nodes, err := allocator.Allocate(web, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []types.NodeName{"a1", "b1", "c1"}
+	if !reflect.DeepEqual(nodes, expected) {
+		t.Errorf("expected %v, got %v", expected, nodes)
+	}
+
+	if _, err := allocator.Allocate(web, 4); err == nil {
+		t.Error("expected an error when the constraint can't be met")
+	}
+
+	// the pod is already on b2, which can't be allocated since it doesn't
+	// declare its capacity, but it still uses up rack b
+	if err := labeler.SetLabel(labels.NODE, "b2", "rack", "b"); err != nil {
+		t.Fatal(err)
+	}
+	allocator = NewCapacityAllocator(labeler, fakePods{"b2": {web}}, nil, spread)
+	nodes, err = allocator.Allocate(web, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []types.NodeName{"a1", "c1"}
+	if !reflect.DeepEqual(nodes, expected) {
+		t.Errorf("expected %v, got %v", expected, nodes)
+	}
+
+	// a node that already has the pod doesn't count twice
+	allocator = NewCapacityAllocator(labeler, fakePods{"b1": {web}}, nil, spread)
+	nodes, err = allocator.Allocate(web, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []types.NodeName{"a1", "b1", "c1"}
+	if !reflect.DeepEqual(nodes, expected) {
+		t.Errorf("expected %v, got %v", expected, nodes)
+	}
+}
+
+func TestSpreadSkipsUnlabeledNodes(t *testing.T) {
+	labeler := labels.NewFakeApplicator()
+	setCapacity(t, labeler, "labeled", "4", "8G")
+	setCapacity(t, labeler, "unlabeled", "16", "64G")
+	if err := labeler.SetLabel(labels.NODE, "labeled", "rack", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	allocator := NewCapacityAllocator(labeler, fakePods{}, nil, SpreadConstraint{Label: "rack", MaxPerDomain: 1})
+	nodes, err := allocator.Allocate(podManifest("web", 1, size.Gibibyte), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(nodes, []types.NodeName{"labeled"}) {
+		t.Errorf("expected [labeled], got %v", nodes)
+	}
+}
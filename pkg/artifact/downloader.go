@@ -6,6 +6,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/square/p2/pkg/auth"
 	"github.com/square/p2/pkg/gzip"
@@ -20,24 +21,49 @@ type Downloader interface {
 	Download(location *url.URL, verificationData auth.VerificationData, destination string, owner string) error
 }
 
+// DownloadTimings accumulates the time spent in each step of downloading
+// artifacts
+type DownloadTimings struct {
+	Fetch   time.Duration
+	Verify  time.Duration
+	Extract time.Duration
+}
+
 // Implements the Downloader interface. Simply fetches a .tar.gz file from a
 // configured URL and extracts it to the location passed to DownloadTo
 type downloader struct {
 	fetcher  uri.Fetcher
 	verifier auth.ArtifactVerifier
+	timings  *DownloadTimings
 }
 
 func NewLocationDownloader(fetcher uri.Fetcher, verifier auth.ArtifactVerifier) Downloader {
+	return NewTimedLocationDownloader(fetcher, verifier, &DownloadTimings{})
+}
+
+// NewTimedLocationDownloader returns a downloader like NewLocationDownloader
+// that adds the time each download spends in each step to timings
+func NewTimedLocationDownloader(fetcher uri.Fetcher, verifier auth.ArtifactVerifier, timings *DownloadTimings) Downloader {
 	return &downloader{
 		fetcher:  fetcher,
 		verifier: verifier,
+		timings:  timings,
 	}
 }
 
+// addSince adds the time since start to step, and returns the current time to
+// start the next step
+func addSince(start time.Time, step *time.Duration) time.Time {
+	now := time.Now()
+	*step += now.Sub(start)
+	return now
+}
+
 func (l *downloader) Download(location *url.URL, verificationData auth.VerificationData, dst string, owner string) error {
 	// Write to a temporary file for easy cleanup if the network transfer fails
 	// TODO: the end of the artifact URL may not always be suitable as a directory
 	// name
+	start := time.Now()
 	artifactFile, err := ioutil.TempFile("", filepath.Base(location.Path))
 	if err != nil {
 		return err
@@ -54,6 +80,8 @@ func (l *downloader) Download(location *url.URL, verificationData auth.Verificat
 	if err != nil {
 		return util.Errorf("Could not copy artifact locally: %v", err)
 	}
+	start = addSince(start, &l.timings.Fetch)
+
 	// rewind once so we can ask the verifier
 	_, err = artifactFile.Seek(0, os.SEEK_SET)
 	if err != nil {
@@ -64,6 +92,7 @@ func (l *downloader) Download(location *url.URL, verificationData auth.Verificat
 	if err != nil {
 		return err
 	}
+	start = addSince(start, &l.timings.Verify)
 
 	err = artifactFile.Chmod(0644)
 	if err != nil {
@@ -75,5 +104,6 @@ func (l *downloader) Download(location *url.URL, verificationData auth.Verificat
 		_ = os.RemoveAll(dst)
 		return util.Errorf("error while extracting artifact: %s", err)
 	}
+	addSince(start, &l.timings.Extract)
 	return err
 }
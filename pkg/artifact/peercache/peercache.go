@@ -0,0 +1,546 @@
+// Package peercache lets nodes fetch artifacts from other nodes that have
+// already downloaded them, rather than from the origin artifact store. This
+// relieves the origin during deploys that touch a whole fleet at once.
+//
+// Each node keeps the artifacts it downloads in a local directory named by the
+// hex SHA-256 digest of their content, serves that directory over HTTP, and
+// advertises which artifacts it has in Consul under
+// artifact_cache/<digest>/<node>. The node that downloads an artifact from the
+// origin also records its digest under artifact_cache/locations/<key>, where
+// <key> is the digest of the artifact's location, along with the ETag or
+// Last-Modified time the origin sent. A node that wants an artifact asks the
+// origin for those validators, and only if they still match the recorded ones
+// tries a few of the peers advertising the recorded digest before falling back
+// to the origin. Origins that send neither validator are always used directly.
+//
+// Content fetched from a peer or read from the local directory is checked
+// against the recorded digest. Since any node can write the records, the
+// artifact is then verified by the pod's artifact verifier exactly as if it
+// had come from the origin, which is what protects against a malicious peer.
+// The preparer refuses to use the cache without artifact verification.
+package peercache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/uri"
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	consulPrefix  = "artifact_cache"
+	locationsPath = "locations"
+	servePath     = "/artifacts/"
+
+	DefaultMaxPeers     = 3
+	DefaultMaxArtifacts = 20
+)
+
+// Config configures the peer cache. It is read from the preparer's config.
+type Config struct {
+	// Dir holds the artifacts downloaded by this node, which are served to
+	// peers
+	Dir string `yaml:"dir"`
+
+	// Port is the TCP port on which Dir is served to peers
+	Port int `yaml:"port"`
+
+	// Address is the host name or IP address peers use to reach this node.
+	// Defaults to the node name.
+	Address string `yaml:"address,omitempty"`
+
+	// MaxPeers is the number of peers tried before falling back to the
+	// origin. Defaults to DefaultMaxPeers.
+	MaxPeers int `yaml:"max_peers,omitempty"`
+
+	// MaxArtifacts is the number of artifacts kept in Dir. The least
+	// recently downloaded are removed first. Defaults to
+	// DefaultMaxArtifacts.
+	MaxArtifacts int `yaml:"max_artifacts,omitempty"`
+}
+
+// Advertisement is stored in Consul by a node for each artifact it serves
+type Advertisement struct {
+	Node   types.NodeName `json:"node"`
+	URL    string         `json:"url"`
+	Digest string         `json:"digest"`
+}
+
+// Origin is stored in Consul for each artifact location by the node that last
+// downloaded it from the origin
+type Origin struct {
+	Location string `json:"location"`
+	Digest   string `json:"digest"`
+
+	// Validator is the ETag, or else the Last-Modified time, the origin
+	// sent for the artifact
+	Validator string `json:"validator"`
+}
+
+// Cache is a uri.Fetcher that fetches artifacts from peers when it can and
+// from the origin fetcher otherwise. Anything that isn't an artifact is
+// passed straight through to the origin fetcher.
+type Cache struct {
+	config Config
+	node   types.NodeName
+	kv     consulutil.ConsulKVClient
+	origin uri.Fetcher
+	client *http.Client
+	logger logging.Logger
+}
+
+var _ uri.Fetcher = &Cache{}
+
+// New returns a Cache that stores artifacts in config.Dir, advertises them
+// through kv and downloads them from peers with client
+func New(
+	config Config,
+	node types.NodeName,
+	kv consulutil.ConsulKVClient,
+	origin uri.Fetcher,
+	client *http.Client,
+	logger logging.Logger,
+) (*Cache, error) {
+	if config.Dir == "" {
+		return nil, util.Errorf("the artifact peer cache requires a directory")
+	}
+	if config.Port <= 0 {
+		return nil, util.Errorf("the artifact peer cache requires a port")
+	}
+	if config.Address == "" {
+		config.Address = node.String()
+	}
+	if config.MaxPeers <= 0 {
+		config.MaxPeers = DefaultMaxPeers
+	}
+	if config.MaxArtifacts <= 0 {
+		config.MaxArtifacts = DefaultMaxArtifacts
+	}
+	err := os.MkdirAll(config.Dir, 0755)
+	if err != nil {
+		return nil, util.Errorf("could not create artifact peer cache directory: %s", err)
+	}
+	return &Cache{
+		config: config,
+		node:   node,
+		kv:     kv,
+		origin: origin,
+		client: client,
+		logger: logger,
+	}, nil
+}
+
+// Key returns the name under which the origin of the artifact at location is
+// recorded
+func Key(location *url.URL) string {
+	sum := sha256.Sum256([]byte(location.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+func isKey(s string) bool {
+	if len(s) != 2*sha256.Size {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// cacheable reports whether location is an artifact that should go through
+// the cache. Signatures, build manifests and the like are small and are
+// always fetched from the origin.
+func cacheable(location *url.URL) bool {
+	return (location.Scheme == "http" || location.Scheme == "https") && strings.HasSuffix(location.Path, ".tar.gz")
+}
+
+func (c *Cache) path(digest string) string {
+	return filepath.Join(c.config.Dir, digest)
+}
+
+func (c *Cache) consulKey(digest string, node types.NodeName) string {
+	return path.Join(consulPrefix, digest, node.String())
+}
+
+func originKey(location *url.URL) string {
+	return path.Join(consulPrefix, locationsPath, Key(location))
+}
+
+// Open returns the artifact at location from the local cache, from a peer or
+// from the origin, in that order. Artifacts fetched from a peer or the origin
+// are added to the local cache and advertised once they have been read in
+// full.
+func (c *Cache) Open(location *url.URL) (io.ReadCloser, error) {
+	if !cacheable(location) {
+		return c.origin.Open(location)
+	}
+	logger := c.logger.SubLogger(logrus.Fields{"location": location.String()})
+
+	validator := c.originValidator(location, logger)
+	if digest := c.recordedDigest(location, validator, logger); digest != "" {
+		f, err := c.openLocal(digest)
+		if err == nil {
+			return f, nil
+		}
+		if !os.IsNotExist(err) {
+			logger.WithError(err).Warnln("Discarding cached artifact")
+			_ = os.Remove(c.path(digest))
+		}
+
+		for _, ad := range c.peers(digest, logger) {
+			err = c.fetchFromPeer(digest, ad)
+			if err != nil {
+				logger.WithErrorAndFields(err, logrus.Fields{"peer": ad.Node}).Warnln("Could not fetch artifact from peer")
+				continue
+			}
+			logger.WithField("peer", ad.Node).Infoln("Fetched artifact from peer")
+			c.advertise(digest, logger)
+			return c.openLocal(digest)
+		}
+	}
+
+	body, err := c.origin.Open(location)
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempFile(c.config.Dir, ".download")
+	if err != nil {
+		// the cache is an optimization, so carry on without it
+		logger.WithError(err).Warnln("Could not cache artifact")
+		return body, nil
+	}
+	return &teeReader{
+		body:     body,
+		tmp:      tmp,
+		hash:     sha256.New(),
+		complete: func(digest string) { c.store(location, validator, tmp.Name(), digest, logger) },
+	}, nil
+}
+
+// originValidator returns what the origin currently identifies the artifact
+// at location by, or "" if it can't be told whether the artifact changed
+func (c *Cache) originValidator(location *url.URL, logger logging.Logger) string {
+	resp, err := c.origin.Head(location)
+	if err != nil {
+		logger.WithError(err).Warnln("Could not check artifact at origin")
+		return ""
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// recordedDigest returns the digest of the artifact at location if it was
+// recorded when the origin had the same validator, or "" otherwise
+func (c *Cache) recordedDigest(location *url.URL, validator string, logger logging.Logger) string {
+	if validator == "" {
+		return ""
+	}
+	pair, _, err := c.kv.Get(originKey(location), nil)
+	if err != nil {
+		logger.WithError(err).Warnln("Could not read artifact origin")
+		return ""
+	}
+	if pair == nil {
+		return ""
+	}
+	var origin Origin
+	err = json.Unmarshal(pair.Value, &origin)
+	if err != nil {
+		logger.WithError(err).Warnln("Ignoring malformed artifact origin")
+		return ""
+	}
+	if origin.Validator != validator || !isKey(origin.Digest) {
+		return ""
+	}
+	return origin.Digest
+}
+
+// openLocal opens the cached artifact with the given digest, after checking
+// that its content still has that digest
+func (c *Cache) openLocal(digest string) (io.ReadCloser, error) {
+	f, err := os.Open(c.path(digest))
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(hash, f)
+	if err == nil {
+		if actual := hex.EncodeToString(hash.Sum(nil)); actual != digest {
+			err = util.Errorf("cached content has digest %s, expected %s", actual, digest)
+		}
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// peers returns up to MaxPeers advertisements for digest from other nodes, in
+// a random order so that load is spread among them
+func (c *Cache) peers(digest string, logger logging.Logger) []Advertisement {
+	pairs, _, err := c.kv.List(path.Join(consulPrefix, digest)+"/", nil)
+	if err != nil {
+		logger.WithError(err).Warnln("Could not list artifact peers")
+		return nil
+	}
+	var ads []Advertisement
+	for _, pair := range pairs {
+		var ad Advertisement
+		err = json.Unmarshal(pair.Value, &ad)
+		if err != nil {
+			logger.WithErrorAndFields(err, logrus.Fields{"key": pair.Key}).Warnln("Ignoring malformed artifact peer advertisement")
+			continue
+		}
+		if ad.Node == c.node {
+			continue
+		}
+		ads = append(ads, ad)
+	}
+	for i := range ads {
+		j := rand.Intn(i + 1)
+		ads[i], ads[j] = ads[j], ads[i]
+	}
+	if len(ads) > c.config.MaxPeers {
+		ads = ads[:c.config.MaxPeers]
+	}
+	return ads
+}
+
+// fetchFromPeer downloads the artifact advertised by ad into the local cache,
+// checking that it has the expected digest
+func (c *Cache) fetchFromPeer(digest string, ad Advertisement) (err error) {
+	resp, err := c.client.Get(ad.URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return util.Errorf("peer returned status %s", resp.Status)
+	}
+
+	tmp, err := ioutil.TempFile(c.config.Dir, ".download")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), resp.Body)
+	if err != nil {
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != digest {
+		return util.Errorf("peer sent content with digest %s, expected %s", actual, digest)
+	}
+	err = os.Chmod(tmp.Name(), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(digest))
+}
+
+// store moves an artifact fully downloaded from the origin into the local
+// cache, records its digest for the location and advertises it
+func (c *Cache) store(location *url.URL, validator string, tmpPath string, digest string, logger logging.Logger) {
+	err := os.Chmod(tmpPath, 0644)
+	if err == nil {
+		err = os.Rename(tmpPath, c.path(digest))
+	}
+	if err != nil {
+		logger.WithError(err).Warnln("Could not cache artifact")
+		_ = os.Remove(tmpPath)
+		return
+	}
+	if validator != "" {
+		value, err := json.Marshal(Origin{Location: location.String(), Digest: digest, Validator: validator})
+		if err == nil {
+			_, err = c.kv.Put(&api.KVPair{Key: originKey(location), Value: value}, nil)
+		}
+		if err != nil {
+			logger.WithError(err).Warnln("Could not record artifact origin")
+		}
+	}
+	c.advertise(digest, logger)
+}
+
+func (c *Cache) advertise(digest string, logger logging.Logger) {
+	ad := Advertisement{
+		Node:   c.node,
+		URL:    fmt.Sprintf("http://%s%s%s", net.JoinHostPort(c.config.Address, fmt.Sprint(c.config.Port)), servePath, digest),
+		Digest: digest,
+	}
+	value, err := json.Marshal(ad)
+	if err != nil {
+		logger.WithError(err).Warnln("Could not advertise cached artifact")
+		return
+	}
+	_, err = c.kv.Put(&api.KVPair{Key: c.consulKey(digest, c.node), Value: value}, nil)
+	if err != nil {
+		logger.WithError(err).Warnln("Could not advertise cached artifact")
+	}
+	c.evict(logger)
+}
+
+// evict removes the least recently downloaded artifacts beyond MaxArtifacts
+// from the local cache, and withdraws their advertisements first so that
+// peers stop asking for them
+func (c *Cache) evict(logger logging.Logger) {
+	infos, err := ioutil.ReadDir(c.config.Dir)
+	if err != nil {
+		logger.WithError(err).Warnln("Could not list artifact peer cache")
+		return
+	}
+	var cached []os.FileInfo
+	for _, info := range infos {
+		if info.Mode().IsRegular() && isKey(info.Name()) {
+			cached = append(cached, info)
+		}
+	}
+	if len(cached) <= c.config.MaxArtifacts {
+		return
+	}
+	sort.Slice(cached, func(i, j int) bool {
+		return cached[i].ModTime().Before(cached[j].ModTime())
+	})
+	for _, info := range cached[:len(cached)-c.config.MaxArtifacts] {
+		_, err = c.kv.Delete(c.consulKey(info.Name(), c.node), nil)
+		if err != nil {
+			logger.WithError(err).Warnln("Could not withdraw cached artifact advertisement")
+			continue
+		}
+		err = os.Remove(c.path(info.Name()))
+		if err != nil {
+			logger.WithError(err).Warnln("Could not remove cached artifact")
+		}
+	}
+}
+
+func (c *Cache) Head(location *url.URL) (*http.Response, error) {
+	return c.origin.Head(location)
+}
+
+func (c *Cache) CopyLocal(srcUri *url.URL, dstPath string) (err error) {
+	src, err := c.Open(srcUri)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dest, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if errC := dest.Close(); err == nil {
+			err = errC
+		}
+	}()
+	_, err = io.Copy(dest, src)
+	return err
+}
+
+// Handler serves the local cache to peers
+func (c *Cache) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		digest := strings.TrimPrefix(r.URL.Path, servePath)
+		if !strings.HasPrefix(r.URL.Path, servePath) || !isKey(digest) {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, c.path(digest))
+	})
+}
+
+// Serve serves the local cache to peers on the configured port until quit is
+// closed
+func (c *Cache) Serve(quit <-chan struct{}) {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", c.config.Port))
+	if err != nil {
+		c.logger.WithError(err).Errorln("Could not serve artifact peer cache")
+		return
+	}
+	server := &http.Server{Handler: c.Handler()}
+	go func() {
+		<-quit
+		_ = listener.Close()
+	}()
+	err = server.Serve(listener)
+	select {
+	case <-quit:
+	default:
+		c.logger.WithError(err).Errorln("Artifact peer cache server exited")
+	}
+}
+
+// teeReader copies an artifact into the cache as it is read from the origin.
+// The copy is only kept if the artifact was read in full.
+type teeReader struct {
+	body     io.ReadCloser
+	tmp      *os.File
+	hash     hash.Hash
+	failed   bool
+	eof      bool
+	complete func(digest string)
+}
+
+func (t *teeReader) Read(p []byte) (int, error) {
+	n, err := t.body.Read(p)
+	if n > 0 && !t.failed {
+		_, _ = t.hash.Write(p[:n])
+		if _, werr := t.tmp.Write(p[:n]); werr != nil {
+			t.failed = true
+		}
+	}
+	if err == io.EOF {
+		t.eof = true
+	}
+	return n, err
+}
+
+func (t *teeReader) Close() error {
+	err := t.body.Close()
+	closeErr := t.tmp.Close()
+	if t.eof && !t.failed && closeErr == nil {
+		t.complete(hex.EncodeToString(t.hash.Sum(nil)))
+	} else {
+		_ = os.Remove(t.tmp.Name())
+	}
+	return err
+}
@@ -0,0 +1,335 @@
+package peercache
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/uri"
+)
+
+const artifactBody = "pretend this is a launchable tarball"
+
+// fakeOrigin serves artifactBody, or the body set for a path, along with an
+// ETag for it, and counts the requests for content
+type fakeOrigin struct {
+	*httptest.Server
+	requests int32
+
+	mu     sync.Mutex
+	bodies map[string]string
+}
+
+func origin(t *testing.T) (*fakeOrigin, *int32) {
+	o := &fakeOrigin{bodies: make(map[string]string)}
+	o.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := o.body(r.URL.Path)
+		w.Header().Set("ETag", fmt.Sprintf("%q", digestOf(body)))
+		if r.Method == http.MethodHead {
+			return
+		}
+		atomic.AddInt32(&o.requests, 1)
+		_, _ = io.WriteString(w, body)
+	}))
+	return o, &o.requests
+}
+
+func (o *fakeOrigin) body(path string) string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if body, ok := o.bodies[path]; ok {
+		return body
+	}
+	return artifactBody
+}
+
+func (o *fakeOrigin) setBody(path string, body string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.bodies[path] = body
+}
+
+func digestOf(body string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(body)))
+}
+
+// newPeer returns a cache for node that is served to the other caches
+// sharing kv
+func newPeer(t *testing.T, node types.NodeName, kv *consulutil.FakeKV, originServer *fakeOrigin) (*Cache, func()) {
+	dir, err := ioutil.TempDir("", "peercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := &delegatingHandler{}
+	server := httptest.NewServer(handler)
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	portNum, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err := New(
+		Config{Dir: dir, Port: portNum, Address: host},
+		node,
+		kv,
+		uri.BasicFetcher{Client: originServer.Client()},
+		http.DefaultClient,
+		logging.TestLogger(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler.handler = cache.Handler()
+	return cache, func() {
+		server.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+type delegatingHandler struct {
+	handler http.Handler
+}
+
+func (d *delegatingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.handler.ServeHTTP(w, r)
+}
+
+func readAll(t *testing.T, cache *Cache, location *url.URL) string {
+	r, err := cache.Open(location)
+	if err != nil {
+		t.Fatalf("Unexpected error opening %s: %s", location, err)
+	}
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestFetchesArtifactFromPeer(t *testing.T) {
+	originServer, requests := origin(t)
+	defer originServer.Close()
+	kv := consulutil.NewKVWithEntries(nil)
+	first, cleanupFirst := newPeer(t, "first.example.com", kv, originServer)
+	defer cleanupFirst()
+	second, cleanupSecond := newPeer(t, "second.example.com", kv, originServer)
+	defer cleanupSecond()
+
+	location, err := url.Parse(originServer.URL + "/artifacts/app_abc123.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if content := readAll(t, first, location); content != artifactBody {
+		t.Errorf("Expected the artifact from the origin, got %q", content)
+	}
+	if content := readAll(t, second, location); content != artifactBody {
+		t.Errorf("Expected the artifact from the peer, got %q", content)
+	}
+	if n := atomic.LoadInt32(requests); n != 1 {
+		t.Errorf("Expected the origin to be asked for the artifact once, got %d requests", n)
+	}
+
+	pairs, _, err := kv.List(path.Join(consulPrefix, digestOf(artifactBody))+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pairs) != 2 {
+		t.Errorf("Expected both nodes to advertise the artifact, got %d advertisements", len(pairs))
+	}
+}
+
+func TestFallsBackToOriginWhenPeerIsCorrupt(t *testing.T) {
+	originServer, requests := origin(t)
+	defer originServer.Close()
+	kv := consulutil.NewKVWithEntries(nil)
+	first, cleanupFirst := newPeer(t, "first.example.com", kv, originServer)
+	defer cleanupFirst()
+	second, cleanupSecond := newPeer(t, "second.example.com", kv, originServer)
+	defer cleanupSecond()
+
+	location, err := url.Parse(originServer.URL + "/artifacts/app_abc123.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	readAll(t, first, location)
+	err = ioutil.WriteFile(filepath.Join(first.config.Dir, digestOf(artifactBody)), []byte("corrupted"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if content := readAll(t, second, location); content != artifactBody {
+		t.Errorf("Expected the artifact from the origin, got %q", content)
+	}
+	if n := atomic.LoadInt32(requests); n != 2 {
+		t.Errorf("Expected the second node to fall back to the origin, got %d requests", n)
+	}
+}
+
+func TestRehashesLocalArtifacts(t *testing.T) {
+	originServer, requests := origin(t)
+	defer originServer.Close()
+	kv := consulutil.NewKVWithEntries(nil)
+	cache, cleanup := newPeer(t, "first.example.com", kv, originServer)
+	defer cleanup()
+
+	location, err := url.Parse(originServer.URL + "/artifacts/app_abc123.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	readAll(t, cache, location)
+	if content := readAll(t, cache, location); content != artifactBody {
+		t.Errorf("Expected the cached artifact, got %q", content)
+	}
+	if n := atomic.LoadInt32(requests); n != 1 {
+		t.Errorf("Expected the cached artifact to be used, got %d requests", n)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(cache.config.Dir, digestOf(artifactBody)), []byte("corrupted"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content := readAll(t, cache, location); content != artifactBody {
+		t.Errorf("Expected the artifact from the origin, got %q", content)
+	}
+	if n := atomic.LoadInt32(requests); n != 2 {
+		t.Errorf("Expected the corrupted artifact to be fetched again, got %d requests", n)
+	}
+}
+
+func TestRefetchesArtifactsThatChangedAtOrigin(t *testing.T) {
+	originServer, requests := origin(t)
+	defer originServer.Close()
+	kv := consulutil.NewKVWithEntries(nil)
+	first, cleanupFirst := newPeer(t, "first.example.com", kv, originServer)
+	defer cleanupFirst()
+	second, cleanupSecond := newPeer(t, "second.example.com", kv, originServer)
+	defer cleanupSecond()
+
+	location, err := url.Parse(originServer.URL + "/artifacts/app_abc123.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	readAll(t, first, location)
+
+	changed := "pretend this is a rebuilt launchable tarball"
+	originServer.setBody(location.Path, changed)
+	if content := readAll(t, second, location); content != changed {
+		t.Errorf("Expected the changed artifact from the origin, got %q", content)
+	}
+	if content := readAll(t, first, location); content != changed {
+		t.Errorf("Expected the changed artifact from the peer, got %q", content)
+	}
+	if n := atomic.LoadInt32(requests); n != 2 {
+		t.Errorf("Expected the changed artifact to be fetched from the origin once, got %d requests", n)
+	}
+}
+
+func TestDoesNotCachePartialOrNonArtifactFetches(t *testing.T) {
+	originServer, _ := origin(t)
+	defer originServer.Close()
+	kv := consulutil.NewKVWithEntries(nil)
+	cache, cleanup := newPeer(t, "first.example.com", kv, originServer)
+	defer cleanup()
+
+	signature, err := url.Parse(originServer.URL + "/artifacts/app_abc123.tar.gz.sig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	readAll(t, cache, signature)
+
+	artifact, err := url.Parse(originServer.URL + "/artifacts/app_abc123.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := cache.Open(artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.Read(make([]byte, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = r.Close()
+
+	entries, err := ioutil.ReadDir(cache.config.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected nothing to be cached, found %d files", len(entries))
+	}
+	pairs, _, err := kv.List(consulPrefix+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pairs) != 0 {
+		t.Errorf("Expected nothing to be advertised, got %d advertisements", len(pairs))
+	}
+}
+
+func TestEvictsLeastRecentlyDownloadedArtifacts(t *testing.T) {
+	originServer, _ := origin(t)
+	defer originServer.Close()
+	kv := consulutil.NewKVWithEntries(nil)
+	cache, cleanup := newPeer(t, "first.example.com", kv, originServer)
+	defer cleanup()
+	cache.config.MaxArtifacts = 1
+
+	for _, name := range []string{"old", "new"} {
+		location, err := url.Parse(originServer.URL + "/artifacts/" + name + ".tar.gz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		originServer.setBody(location.Path, name)
+		readAll(t, cache, location)
+		if name == "old" {
+			// make sure the artifacts can be told apart by age
+			hourAgo := time.Now().Add(-time.Hour)
+			err = os.Chtimes(filepath.Join(cache.config.Dir, digestOf(name)), hourAgo, hourAgo)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for name, count := range map[string]int{"old": 0, "new": 1} {
+		pairs, _, err := kv.List(path.Join(consulPrefix, digestOf(name))+"/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pairs) != count {
+			t.Errorf("Expected %d advertisements of the %s artifact, got %d", count, name, len(pairs))
+		}
+	}
+	entries, err := ioutil.ReadDir(cache.config.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected one artifact to be left in the cache, found %d files", len(entries))
+	}
+}
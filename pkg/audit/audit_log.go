@@ -3,6 +3,8 @@ package audit
 import (
 	"encoding/json"
 	"time"
+
+	"github.com/square/p2/pkg/version"
 )
 
 const CurrentSchemaVersion int = 1
@@ -21,12 +23,16 @@ func (i ID) String() string { return string(i) }
 
 // AuditLog represents a stored value in consul expressing an event for which audit records
 // are desired. An AuditLog consists of an event type, a json message with details which
-// will have a different schema for each event type, a timestamp and a schema version.
+// will have a different schema for each event type, a timestamp, a schema version and
+// the build of P2 that wrote it.
 type AuditLog struct {
 	EventType     EventType        `json:"event_type"`
 	EventDetails  *json.RawMessage `json:"event_details"`
 	Timestamp     time.Time        `json:"timestamp"`
 	SchemaVersion SchemaVersion    `json:"schema_version"`
+
+	// Build is unset for records written before builds were recorded
+	Build *version.Info `json:"build,omitempty"`
 }
 
 // SchemaVersion implements MarshalJSON() so that every JSON representation of
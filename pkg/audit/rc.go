@@ -2,8 +2,10 @@ package audit
 
 import (
 	"encoding/json"
+	"fmt"
 
 	pc_fields "github.com/square/p2/pkg/pc/fields"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
 )
@@ -13,6 +15,56 @@ const (
 	// nodes that it is targeting. This can be used to log the set of nodes that
 	// an RC or pod cluster manages over time
 	RCRetargetingEvent EventType = "REPLICATION_CONTROLLER_RETARGET"
+
+	// RCCreatedEvent signifies that the replication controller was created
+	RCCreatedEvent EventType = "REPLICATION_CONTROLLER_CREATED"
+
+	// RCDeletedEvent signifies that the replication controller was deleted
+	RCDeletedEvent EventType = "REPLICATION_CONTROLLER_DELETED"
+
+	// RCReplicasUpdatedEvent signifies that the desired replica count of
+	// the replication controller was changed
+	RCReplicasUpdatedEvent EventType = "REPLICATION_CONTROLLER_REPLICAS_UPDATED"
+
+	// RCNodeSelectorUpdatedEvent signifies that the node selector of the
+	// replication controller was changed, which may cause its pods to be
+	// moved to other nodes
+	RCNodeSelectorUpdatedEvent EventType = "REPLICATION_CONTROLLER_NODE_SELECTOR_UPDATED"
+
+	// RCManifestUpdatedEvent signifies that the pod manifest of the
+	// replication controller was replaced
+	RCManifestUpdatedEvent EventType = "REPLICATION_CONTROLLER_MANIFEST_UPDATED"
+
+	// RCStrategyUpdatedEvent signifies that the allocation strategy of the
+	// replication controller was changed
+	RCStrategyUpdatedEvent EventType = "REPLICATION_CONTROLLER_STRATEGY_UPDATED"
+
+	// RCEnabledEvent signifies that the replication controller was enabled
+	RCEnabledEvent EventType = "REPLICATION_CONTROLLER_ENABLED"
+
+	// RCDisabledEvent signifies that the replication controller was disabled
+	RCDisabledEvent EventType = "REPLICATION_CONTROLLER_DISABLED"
+)
+
+// RCMutationEvents are the event types of RC mutation records, i.e. the ones
+// with RCMutationDetails
+var RCMutationEvents = []EventType{
+	RCCreatedEvent,
+	RCDeletedEvent,
+	RCReplicasUpdatedEvent,
+	RCNodeSelectorUpdatedEvent,
+	RCManifestUpdatedEvent,
+	RCStrategyUpdatedEvent,
+	RCEnabledEvent,
+	RCDisabledEvent,
+}
+
+// Source denotes the interface through which a mutation was requested
+type Source string
+
+const (
+	SourceCLI Source = "cli"
+	SourceAPI Source = "api"
 )
 
 type RCRetargetingDetails struct {
@@ -42,3 +94,101 @@ func NewRCRetargetingEventDetails(
 
 	return json.RawMessage(bytes), nil
 }
+
+// RCMutationDetails defines the JSON structure of the details of every RC
+// mutation event
+type RCMutationDetails struct {
+	ReplicationControllerID rc_fields.ID `json:"replication_controller_id"`
+
+	// User is the name of the user who requested the mutation
+	User string `json:"user"`
+
+	// Source is the interface through which the mutation was requested
+	Source Source `json:"source"`
+
+	// Old is the replication controller before the mutation, nil for
+	// creations
+	Old *rc_fields.RawRC `json:"old,omitempty"`
+
+	// New is the replication controller after the mutation, nil for
+	// deletions
+	New *rc_fields.RawRC `json:"new,omitempty"`
+}
+
+func NewRCMutationDetails(
+	rcID rc_fields.ID,
+	oldRC *rc_fields.RC,
+	newRC *rc_fields.RC,
+	user string,
+	source Source,
+) (json.RawMessage, error) {
+	details := RCMutationDetails{
+		ReplicationControllerID: rcID,
+		User:                    user,
+		Source:                  source,
+	}
+
+	if oldRC != nil {
+		raw, err := oldRC.ToRaw()
+		if err != nil {
+			return nil, err
+		}
+		details.Old = &raw
+	}
+	if newRC != nil {
+		raw, err := newRC.ToRaw()
+		if err != nil {
+			return nil, err
+		}
+		details.New = &raw
+	}
+
+	bytes, err := json.Marshal(details)
+	if err != nil {
+		return nil, util.Errorf("could not marshal rc mutation details as json: %s", err)
+	}
+
+	return json.RawMessage(bytes), nil
+}
+
+// RCFieldChange is a single field that an RC mutation changed
+type RCFieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// Changes returns the fields that differ between the old and new RC. For
+// creations every field is compared against its zero value, and vice versa
+// for deletions.
+func (d RCMutationDetails) Changes() []RCFieldChange {
+	var oldRC, newRC rc_fields.RawRC
+	if d.Old != nil {
+		oldRC = *d.Old
+	}
+	if d.New != nil {
+		newRC = *d.New
+	}
+
+	replicas := func(n *int) string {
+		if n == nil {
+			return ""
+		}
+		return fmt.Sprintf("%d", *n)
+	}
+	candidates := []RCFieldChange{
+		{Field: "replicas_desired", Old: replicas(oldRC.ReplicasDesired), New: replicas(newRC.ReplicasDesired)},
+		{Field: "node_selector", Old: oldRC.NodeSelector, New: newRC.NodeSelector},
+		{Field: "allocation_strategy", Old: oldRC.AllocationStrategy.String(), New: newRC.AllocationStrategy.String()},
+		{Field: "disabled", Old: fmt.Sprintf("%t", oldRC.Disabled), New: fmt.Sprintf("%t", newRC.Disabled)},
+		{Field: "manifest", Old: oldRC.Manifest, New: newRC.Manifest},
+	}
+
+	var changes []RCFieldChange
+	for _, change := range candidates {
+		if change.Old != change.New {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
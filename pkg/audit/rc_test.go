@@ -6,7 +6,10 @@ import (
 	"testing"
 
 	pc_fields "github.com/square/p2/pkg/pc/fields"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
 	"github.com/square/p2/pkg/types"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
 )
 
 func TestRCRetargetingEventDetails(t *testing.T) {
@@ -42,3 +45,51 @@ func TestRCRetargetingEventDetails(t *testing.T) {
 		t.Errorf("expected node list to be %s but was %s", nodes, details.Nodes)
 	}
 }
+
+func TestRCMutationDetailsChanges(t *testing.T) {
+	oldRC := rc_fields.RC{
+		ID:                 "some_rc_id",
+		NodeSelector:       klabels.Everything(),
+		ReplicasDesired:    2,
+		AllocationStrategy: rc_fields.DynamicStrategy,
+	}
+	newRC := oldRC
+	newRC.ReplicasDesired = 3
+
+	detailsJSON, err := NewRCMutationDetails(oldRC.ID, &oldRC, &newRC, "some_user", SourceCLI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var details RCMutationDetails
+	err = json.Unmarshal(detailsJSON, &details)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if details.User != "some_user" || details.Source != SourceCLI {
+		t.Errorf("expected the mutation to be attributed to some_user via the CLI, got %q via %q", details.User, details.Source)
+	}
+
+	expected := []RCFieldChange{{Field: "replicas_desired", Old: "2", New: "3"}}
+	if changes := details.Changes(); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected changes %+v but got %+v", expected, changes)
+	}
+
+	// deletions change every field that was set
+	detailsJSON, err = NewRCMutationDetails(oldRC.ID, &oldRC, nil, "some_user", SourceCLI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	details = RCMutationDetails{}
+	err = json.Unmarshal(detailsJSON, &details)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if details.New != nil {
+		t.Error("expected no new RC for a deletion")
+	}
+	if changes := details.Changes(); len(changes) != 2 {
+		t.Errorf("expected the replica count and allocation strategy to change on deletion, got %+v", changes)
+	}
+}
@@ -0,0 +1,396 @@
+// Package bluegreen implements a blue/green deployment strategy for pods.
+//
+// The new ("green") version of a pod is scheduled next to the currently
+// running ("blue") version on every target node as a separate uuid pod, so
+// both run at once. Traffic is directed by a pod label that load balancer
+// integrations are expected to consume: the instances that should receive
+// traffic are labeled with TrafficLabel=TrafficLive, and all others with
+// TrafficLabel=TrafficStandby. Pod labels for uuid pods are keyed by the pod's
+// unique key.
+//
+// Once every green instance has launched and the pod's health checks pass on
+// every target node, the labels are flipped. The blue instances are only
+// unscheduled after the green ones have run without any process exiting or
+// the health checks turning critical for a verification window. If
+// verification fails, the labels are flipped back and the green instances are
+// unscheduled instead.
+//
+// The progress of a deployment can be sent to webhooks by setting its
+// Notifier.
+package bluegreen
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/consul/api"
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/health/checker"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/podstore"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/webhook"
+)
+
+const (
+	// PodIDLabel is set on every pod instance managed by a blue/green
+	// deployment so that the instances of a pod ID can be found later
+	PodIDLabel = "bluegreen_pod_id"
+
+	// TrafficLabel indicates whether a pod instance should be receiving
+	// traffic. Its value is either TrafficLive or TrafficStandby
+	TrafficLabel   = "bluegreen_traffic"
+	TrafficLive    = "live"
+	TrafficStandby = "standby"
+
+	DefaultPollInterval = 5 * time.Second
+
+	// bluegreenOrchestrator identifies blue/green deployments in webhook
+	// events
+	bluegreenOrchestrator = "bluegreen"
+)
+
+type PodStore interface {
+	ReadPod(key types.PodUniqueKey) (podstore.Pod, error)
+	Schedule(manifest manifest.Manifest, node types.NodeName) (types.PodUniqueKey, error)
+	Unschedule(key types.PodUniqueKey) error
+}
+
+type PodStatusStore interface {
+	Get(key types.PodUniqueKey) (podstatus.PodStatus, *api.QueryMeta, error)
+}
+
+type Labeler interface {
+	SetLabels(labelType labels.Type, id string, labels map[string]string) error
+	RemoveAllLabels(labelType labels.Type, id string) error
+	GetMatches(selector klabels.Selector, labelType labels.Type) ([]labels.Labeled, error)
+}
+
+type Deployment struct {
+	manifest       manifest.Manifest
+	nodes          []types.NodeName
+	podStore       PodStore
+	podStatusStore PodStatusStore
+	labeler        Labeler
+	healthChecker  checker.HealthChecker
+	logger         logging.Logger
+
+	// How long to wait for every green instance to launch and pass its
+	// health checks
+	LaunchTimeout time.Duration
+
+	// How long green instances must run without a process exiting or a
+	// health check turning critical after traffic was flipped to them
+	// before the blue instances are removed
+	VerificationWindow time.Duration
+
+	// How often pod statuses are checked
+	PollInterval time.Duration
+
+	// Receives the deployment's lifecycle events. Defaults to a no-op
+	Notifier webhook.Notifier
+}
+
+func NewDeployment(
+	manifest manifest.Manifest,
+	nodes []types.NodeName,
+	podStore PodStore,
+	podStatusStore PodStatusStore,
+	labeler Labeler,
+	healthChecker checker.HealthChecker,
+	logger logging.Logger,
+	launchTimeout time.Duration,
+	verificationWindow time.Duration,
+) Deployment {
+	return Deployment{
+		manifest:           manifest,
+		nodes:              nodes,
+		podStore:           podStore,
+		podStatusStore:     podStatusStore,
+		labeler:            labeler,
+		healthChecker:      healthChecker,
+		logger:             logger,
+		LaunchTimeout:      launchTimeout,
+		VerificationWindow: verificationWindow,
+		PollInterval:       DefaultPollInterval,
+		Notifier:           webhook.NewNop(),
+	}
+}
+
+// Run performs the deployment. It returns nil once the blue instances have
+// been removed, or an error after the green instances have been rolled back.
+// Closing quit aborts the deployment and rolls it back.
+func (d Deployment) Run(quit <-chan struct{}) error {
+	d.notify(webhook.EventStarted, fmt.Sprintf("Blue/green deployment of %s to %d nodes started", d.manifest.ID(), len(d.nodes)))
+	err := d.run(quit)
+	if err == nil {
+		d.notify(webhook.EventSucceeded, fmt.Sprintf("Blue/green deployment of %s completed", d.manifest.ID()))
+		return nil
+	}
+
+	select {
+	case <-quit:
+		d.notify(webhook.EventAborted, fmt.Sprintf("Blue/green deployment of %s was aborted and rolled back", d.manifest.ID()))
+	default:
+		d.notify(webhook.EventRolledBack, fmt.Sprintf("Blue/green deployment of %s was rolled back: %s", d.manifest.ID(), err))
+	}
+	return err
+}
+
+func (d Deployment) run(quit <-chan struct{}) error {
+	blue, err := d.livePods()
+	if err != nil {
+		return err
+	}
+
+	green := make(map[types.NodeName]types.PodUniqueKey)
+	for _, node := range d.nodes {
+		key, err := d.podStore.Schedule(d.manifest, node)
+		if err != nil {
+			d.teardown(green)
+			return util.Errorf("could not schedule green instance on %s: %s", node, err)
+		}
+		green[node] = key
+
+		err = d.labeler.SetLabels(labels.POD, key.String(), d.podLabels(TrafficStandby))
+		if err != nil {
+			d.teardown(green)
+			return util.Errorf("could not label green instance %s on %s: %s", key, node, err)
+		}
+		d.logger.WithFields(logrus.Fields{
+			"node":           node,
+			"pod_unique_key": key,
+		}).Infoln("Scheduled green instance")
+	}
+
+	err = d.waitForLaunch(green, quit)
+	if err != nil {
+		d.teardown(green)
+		return err
+	}
+
+	d.logger.NoFields().Infoln("All green instances launched and healthy, flipping traffic")
+	err = d.flip(green, blue)
+	if err != nil {
+		d.rollback(green, blue)
+		return err
+	}
+
+	err = d.verify(green, quit)
+	if err != nil {
+		d.rollback(green, blue)
+		return err
+	}
+
+	d.logger.NoFields().Infoln("Green instances verified, removing blue instances")
+	d.teardown(blue)
+	return nil
+}
+
+func (d Deployment) podLabels(traffic string) map[string]string {
+	return map[string]string{
+		PodIDLabel:   d.manifest.ID().String(),
+		TrafficLabel: traffic,
+	}
+}
+
+// livePods returns the instances of the pod that are currently receiving
+// traffic on the target nodes
+func (d Deployment) livePods() (map[types.NodeName]types.PodUniqueKey, error) {
+	selector := klabels.Everything().
+		Add(PodIDLabel, klabels.EqualsOperator, []string{d.manifest.ID().String()}).
+		Add(TrafficLabel, klabels.EqualsOperator, []string{TrafficLive})
+	matches, err := d.labeler.GetMatches(selector, labels.POD)
+	if err != nil {
+		return nil, util.Errorf("could not find live instances of %s: %s", d.manifest.ID(), err)
+	}
+
+	targets := make(map[types.NodeName]bool)
+	for _, node := range d.nodes {
+		targets[node] = true
+	}
+
+	live := make(map[types.NodeName]types.PodUniqueKey)
+	for _, match := range matches {
+		key := types.PodUniqueKey(match.ID)
+		pod, err := d.podStore.ReadPod(key)
+		if podstore.IsNoPod(err) {
+			// the labels outlived the pod
+			continue
+		} else if err != nil {
+			return nil, util.Errorf("could not read live instance %s: %s", key, err)
+		}
+		if targets[pod.Node] {
+			live[pod.Node] = key
+		}
+	}
+	return live, nil
+}
+
+func (d Deployment) waitForLaunch(green map[types.NodeName]types.PodUniqueKey, quit <-chan struct{}) error {
+	timeout := time.After(d.LaunchTimeout)
+	for {
+		results, err := d.healthChecker.Service(d.manifest.ID().String())
+		if err != nil {
+			d.logger.WithError(err).Warnln("Could not read green instance health")
+		}
+
+		launched := 0
+		healthy := 0
+		for node, key := range green {
+			status, _, err := d.podStatusStore.Get(key)
+			switch {
+			case statusstore.IsNoStatus(err):
+				continue
+			case err != nil:
+				d.logger.WithErrorAndFields(err, logrus.Fields{"node": node}).Warnln("Could not read green instance status")
+				continue
+			}
+			if err := checkStatus(status); err != nil {
+				return util.Errorf("green instance on %s failed to launch: %s", node, err)
+			}
+			if status.PodStatus != podstatus.PodLaunched {
+				continue
+			}
+			launched++
+			// a missing result is zero, which is treated like "critical"
+			if results[node].GatingStatus() == health.Passing {
+				healthy++
+			}
+		}
+		if healthy == len(green) {
+			return nil
+		}
+
+		select {
+		case <-quit:
+			return util.Errorf("deployment aborted while waiting for green instances to launch")
+		case <-timeout:
+			return util.Errorf("%d of %d green instances launched and %d were healthy within %s", launched, len(green), healthy, d.LaunchTimeout)
+		case <-time.After(d.PollInterval):
+		}
+	}
+}
+
+func (d Deployment) verify(green map[types.NodeName]types.PodUniqueKey, quit <-chan struct{}) error {
+	window := time.After(d.VerificationWindow)
+	for {
+		results, err := d.healthChecker.Service(d.manifest.ID().String())
+		if err != nil {
+			return util.Errorf("could not read health of green instances: %s", err)
+		}
+		for node, key := range green {
+			status, _, err := d.podStatusStore.Get(key)
+			if err != nil {
+				return util.Errorf("could not read status of green instance on %s: %s", node, err)
+			}
+			if err := checkStatus(status); err != nil {
+				return util.Errorf("green instance on %s failed verification: %s", node, err)
+			}
+			if status.PodStatus != podstatus.PodLaunched {
+				return util.Errorf("green instance on %s is %s", node, status.PodStatus)
+			}
+			if result, ok := results[node]; ok && result.GatingStatus() == health.Critical {
+				return util.Errorf("green instance on %s failed verification: health is %s", node, result.Status)
+			}
+		}
+
+		select {
+		case <-quit:
+			return util.Errorf("deployment aborted during verification window")
+		case <-window:
+			return nil
+		case <-time.After(d.PollInterval):
+		}
+	}
+}
+
+// green instances are new, so any process exit means something went wrong
+func checkStatus(status podstatus.PodStatus) error {
+	if status.PodStatus == podstatus.PodFailed {
+		return util.Errorf("pod failed")
+	}
+	for _, process := range status.ProcessStatuses {
+		if process.LastExit != nil {
+			return util.Errorf("%s/%s exited with code %d", process.LaunchableID, process.EntryPoint, process.LastExit.ExitCode)
+		}
+	}
+	return nil
+}
+
+// flip directs traffic to the "to" instances. They are marked live before the
+// "from" instances are marked standby so that there is never a moment where no
+// instance is live.
+func (d Deployment) flip(to map[types.NodeName]types.PodUniqueKey, from map[types.NodeName]types.PodUniqueKey) error {
+	for node, key := range to {
+		err := d.labeler.SetLabels(labels.POD, key.String(), d.podLabels(TrafficLive))
+		if err != nil {
+			return util.Errorf("could not mark instance on %s live: %s", node, err)
+		}
+	}
+	for node, key := range from {
+		err := d.labeler.SetLabels(labels.POD, key.String(), d.podLabels(TrafficStandby))
+		if err != nil {
+			return util.Errorf("could not mark instance on %s standby: %s", node, err)
+		}
+	}
+	return nil
+}
+
+func (d Deployment) rollback(green map[types.NodeName]types.PodUniqueKey, blue map[types.NodeName]types.PodUniqueKey) {
+	d.logger.NoFields().Errorln("Rolling back to blue instances")
+	err := d.flip(blue, green)
+	if err != nil {
+		d.logger.WithError(err).Errorln("Could not flip traffic back to blue instances")
+	}
+	d.teardown(green)
+}
+
+func (d Deployment) notify(eventType webhook.EventType, message string) {
+	if d.Notifier == nil {
+		return
+	}
+
+	sha, err := d.manifest.SHA()
+	if err != nil {
+		d.logger.WithError(err).Warnln("Could not compute manifest SHA for webhook event")
+	}
+	d.Notifier.Notify(webhook.Event{
+		Type:         eventType,
+		Orchestrator: bluegreenOrchestrator,
+		DeploymentID: sha,
+		PodID:        d.manifest.ID().String(),
+		Message:      message,
+		Details: map[string]interface{}{
+			"nodes": d.nodes,
+		},
+	})
+}
+
+// teardown unschedules the instances and removes their labels. Errors are
+// logged rather than returned so that as much as possible is cleaned up
+func (d Deployment) teardown(instances map[types.NodeName]types.PodUniqueKey) {
+	for node, key := range instances {
+		logger := d.logger.SubLogger(logrus.Fields{
+			"node":           node,
+			"pod_unique_key": key,
+		})
+		err := d.podStore.Unschedule(key)
+		if err != nil && !podstore.IsNoPod(err) {
+			logger.WithError(err).Errorln("Could not unschedule instance")
+			continue
+		}
+		err = d.labeler.RemoveAllLabels(labels.POD, key.String())
+		if err != nil {
+			logger.WithError(err).Errorln("Could not remove instance labels")
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package bluegreen
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/health/checker"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/podstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/webhook"
+)
+
+type fakePodStore struct {
+	mu    sync.Mutex
+	pods  map[types.PodUniqueKey]podstore.Pod
+	count int
+}
+
+func newFakePodStore() *fakePodStore {
+	return &fakePodStore{pods: make(map[types.PodUniqueKey]podstore.Pod)}
+}
+
+func (f *fakePodStore) ReadPod(key types.PodUniqueKey) (podstore.Pod, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	pod, ok := f.pods[key]
+	if !ok {
+		return podstore.Pod{}, podstore.NoPodError(key)
+	}
+	return pod, nil
+}
+
+func (f *fakePodStore) Schedule(manifest manifest.Manifest, node types.NodeName) (types.PodUniqueKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.count++
+	key := types.PodUniqueKey(fmt.Sprintf("key-%d", f.count))
+	f.pods[key] = podstore.Pod{Manifest: manifest, Node: node}
+	return key, nil
+}
+
+func (f *fakePodStore) Unschedule(key types.PodUniqueKey) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.pods[key]; !ok {
+		return podstore.NoPodError(key)
+	}
+	delete(f.pods, key)
+	return nil
+}
+
+// Reports every pod as launched, optionally with a process exit
+type fakePodStatusStore struct {
+	crashed bool
+}
+
+func (f fakePodStatusStore) Get(key types.PodUniqueKey) (podstatus.PodStatus, *api.QueryMeta, error) {
+	status := podstatus.PodStatus{PodStatus: podstatus.PodLaunched}
+	if f.crashed {
+		status.ProcessStatuses = []podstatus.ProcessStatus{{
+			LaunchableID: "app",
+			EntryPoint:   "launch",
+			LastExit:     &podstatus.ExitStatus{ExitTime: time.Now(), ExitCode: 1},
+		}}
+	}
+	return status, nil, nil
+}
+
+// Reports the pod's health on every node as the next of statuses each time it's
+// asked, repeating the last one
+type fakeHealthChecker struct {
+	checker.HealthChecker
+
+	mu       sync.Mutex
+	statuses []health.HealthState
+}
+
+func (f *fakeHealthChecker) Service(serviceID string) (map[types.NodeName]health.Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	status := f.statuses[0]
+	if len(f.statuses) > 1 {
+		f.statuses = f.statuses[1:]
+	}
+	return map[types.NodeName]health.Result{
+		"node1": {ID: types.PodID(serviceID), Node: "node1", Status: status},
+	}, nil
+}
+
+func setup(t *testing.T, crashed bool, statuses ...health.HealthState) (Deployment, *fakePodStore, labels.Applicator, types.PodUniqueKey) {
+	if len(statuses) == 0 {
+		statuses = []health.HealthState{health.Passing}
+	}
+	builder := manifest.NewBuilder()
+	builder.SetID("app")
+	podManifest := builder.GetManifest()
+
+	podStore := newFakePodStore()
+	labeler := labels.NewFakeApplicator()
+	node := types.NodeName("node1")
+
+	blue, _ := podStore.Schedule(podManifest, node)
+	err := labeler.SetLabels(labels.POD, blue.String(), map[string]string{
+		PodIDLabel:   "app",
+		TrafficLabel: TrafficLive,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDeployment(
+		podManifest,
+		[]types.NodeName{node},
+		podStore,
+		fakePodStatusStore{crashed: crashed},
+		labeler,
+		&fakeHealthChecker{statuses: statuses},
+		logging.DefaultLogger,
+		time.Second,
+		10*time.Millisecond,
+	)
+	d.PollInterval = time.Millisecond
+	return d, podStore, labeler, blue
+}
+
+type recordingNotifier struct {
+	events []webhook.EventType
+}
+
+func (r *recordingNotifier) Notify(event webhook.Event) {
+	r.events = append(r.events, event.Type)
+}
+
+func TestRunReplacesBlueWithGreen(t *testing.T) {
+	d, podStore, labeler, blue := setup(t, false)
+	notifier := &recordingNotifier{}
+	d.Notifier = notifier
+
+	err := d.Run(nil)
+	if err != nil {
+		t.Fatalf("unexpected error running deployment: %s", err)
+	}
+
+	if _, err := podStore.ReadPod(blue); !podstore.IsNoPod(err) {
+		t.Errorf("expected blue instance to be unscheduled, got %v", err)
+	}
+	if len(podStore.pods) != 1 {
+		t.Fatalf("expected exactly one green instance, found %d pods", len(podStore.pods))
+	}
+	for key := range podStore.pods {
+		labeled, err := labeler.GetLabels(labels.POD, key.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if labeled.Labels[TrafficLabel] != TrafficLive {
+			t.Errorf("expected green instance to be live, was %q", labeled.Labels[TrafficLabel])
+		}
+	}
+
+	expected := []webhook.EventType{webhook.EventStarted, webhook.EventSucceeded}
+	if !reflect.DeepEqual(notifier.events, expected) {
+		t.Errorf("expected events %v, got %v", expected, notifier.events)
+	}
+}
+
+func TestRunRollsBackOnCrash(t *testing.T) {
+	d, podStore, labeler, blue := setup(t, true)
+	notifier := &recordingNotifier{}
+	d.Notifier = notifier
+
+	err := d.Run(nil)
+	if err == nil {
+		t.Fatal("expected an error when green instances crash")
+	}
+
+	if len(podStore.pods) != 1 {
+		t.Fatalf("expected only the blue instance to remain, found %d pods", len(podStore.pods))
+	}
+	if _, err := podStore.ReadPod(blue); err != nil {
+		t.Errorf("expected blue instance to still be scheduled: %s", err)
+	}
+	labeled, err := labeler.GetLabels(labels.POD, blue.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labeled.Labels[TrafficLabel] != TrafficLive {
+		t.Errorf("expected blue instance to be live after rollback, was %q", labeled.Labels[TrafficLabel])
+	}
+
+	expected := []webhook.EventType{webhook.EventStarted, webhook.EventRolledBack}
+	if !reflect.DeepEqual(notifier.events, expected) {
+		t.Errorf("expected events %v, got %v", expected, notifier.events)
+	}
+}
+
+func TestRunDoesNotFlipToUnhealthyGreen(t *testing.T) {
+	d, podStore, labeler, blue := setup(t, false, health.Critical)
+	d.LaunchTimeout = 20 * time.Millisecond
+
+	err := d.Run(nil)
+	if err == nil {
+		t.Fatal("expected an error when green instances never become healthy")
+	}
+
+	if len(podStore.pods) != 1 {
+		t.Fatalf("expected only the blue instance to remain, found %d pods", len(podStore.pods))
+	}
+	labeled, err := labeler.GetLabels(labels.POD, blue.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labeled.Labels[TrafficLabel] != TrafficLive {
+		t.Errorf("expected blue instance to stay live, was %q", labeled.Labels[TrafficLabel])
+	}
+}
+
+func TestRunRollsBackWhenGreenBecomesCritical(t *testing.T) {
+	// healthy when traffic is flipped, critical during verification
+	d, podStore, labeler, blue := setup(t, false, health.Passing, health.Critical)
+
+	err := d.Run(nil)
+	if err == nil {
+		t.Fatal("expected an error when green instances become critical")
+	}
+
+	if len(podStore.pods) != 1 {
+		t.Fatalf("expected only the blue instance to remain, found %d pods", len(podStore.pods))
+	}
+	labeled, err := labeler.GetLabels(labels.POD, blue.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labeled.Labels[TrafficLabel] != TrafficLive {
+		t.Errorf("expected blue instance to be live after rollback, was %q", labeled.Labels[TrafficLabel])
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
@@ -139,6 +140,27 @@ func (subsys Subsystems) Write(config Config) error {
 	return subsys.SetMemory(config.Name, int(config.Memory))
 }
 
+// OOMKillCount returns how many processes in the named memory cgroup have been
+// killed by the OOM killer since the cgroup was created. The count is read from
+// memory.oom_control, which only reports it on kernels 4.13 and later.
+func (subsys Subsystems) OOMKillCount(name CgroupID) (int, error) {
+	if subsys.Memory == "" {
+		return 0, UnsupportedError("memory")
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(subsys.Memory, name.String(), "memory.oom_control"))
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(contents), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			return strconv.Atoi(fields[1])
+		}
+	}
+	return 0, util.Errorf("%s/memory.oom_control does not report oom_kill", name)
+}
+
 func (subsys Subsystems) AddPID(name string, pid int) error {
 	err := appendIntToFile(filepath.Join(subsys.Memory, name, "cgroup.procs"), pid)
 	if err != nil {
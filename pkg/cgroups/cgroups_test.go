@@ -66,3 +66,38 @@ func expectCgroupFileToContain(t *testing.T, s string, file string) {
 		t.Errorf("expected %s, but got: %s", s, string(actual))
 	}
 }
+
+func TestOOMKillCount(t *testing.T) {
+	fs := &FakeSubsystemer{}
+	defer fs.cleanupTmpdir()
+	subsys, err := fs.Find()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	cgroupDir := filepath.Join(subsys.Memory, "p2", "app")
+	if err := os.MkdirAll(cgroupDir, 0755); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	oomControl := "oom_kill_disable 0\nunder_oom 0\noom_kill 3\n"
+	if err := ioutil.WriteFile(filepath.Join(cgroupDir, "memory.oom_control"), []byte(oomControl), 0644); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	count, err := subsys.OOMKillCount(CgroupID("p2/app"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 OOM kills, got %d", count)
+	}
+
+	// older kernels don't report oom_kill
+	oomControl = "oom_kill_disable 0\nunder_oom 0\n"
+	if err := ioutil.WriteFile(filepath.Join(cgroupDir, "memory.oom_control"), []byte(oomControl), 0644); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := subsys.OOMKillCount(CgroupID("p2/app")); err == nil {
+		t.Error("expected an error when the kernel doesn't report oom_kill")
+	}
+}
@@ -0,0 +1,104 @@
+// Package cohort deterministically divides the fleet into percentage based
+// subsets of nodes, e.g. for long-lived canary deployments.
+//
+// A node's position in the fleet is derived from a stable hash of its name, so
+// the N% cohort contains the same nodes no matter which tool computes it or
+// which other nodes are being considered. Cohorts are also nested: every node
+// in the 5% cohort is in the 10% cohort.
+//
+// A replication controller chooses its nodes by itself, so it is confined to
+// a cohort through its node selector. Each node is labeled with its bucket,
+// and the selector is restricted to the buckets of the cohort.
+package cohort
+
+import (
+	"hash/fnv"
+	"strconv"
+
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+// NodeLabel is the node label that holds the node's Bucket
+const NodeLabel = "p2_cohort_bucket"
+
+// Bucket returns the node's position in the fleet, between 0 and 99
+func Bucket(node types.NodeName) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(node))
+	return int(h.Sum32() % 100)
+}
+
+// Contains returns whether node is in the percent cohort
+func Contains(node types.NodeName, percent int) bool {
+	return Bucket(node) < percent
+}
+
+// Select returns the nodes that are in the percent cohort, preserving their
+// order
+func Select(nodes []types.NodeName, percent int) ([]types.NodeName, error) {
+	err := Validate(percent)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []types.NodeName
+	for _, node := range nodes {
+		if Contains(node, percent) {
+			selected = append(selected, node)
+		}
+	}
+	return selected, nil
+}
+
+func Validate(percent int) error {
+	if percent < 1 || percent > 100 {
+		return util.Errorf("percent must be between 1 and 100, was %d", percent)
+	}
+	return nil
+}
+
+// BucketLabel returns the value of NodeLabel for node
+func BucketLabel(node types.NodeName) string {
+	return strconv.Itoa(Bucket(node))
+}
+
+// RestrictSelector returns a node selector matching the nodes that both match
+// selector and are in the percent cohort according to their NodeLabel. Any
+// cohort that selector was already restricted to is replaced, so that a
+// cohort can be widened.
+func RestrictSelector(selector klabels.Selector, percent int) (klabels.Selector, error) {
+	err := Validate(percent)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make([]string, percent)
+	for i := range buckets {
+		buckets[i] = strconv.Itoa(i)
+	}
+	unrestricted, err := Unrestricted(selector)
+	if err != nil {
+		return nil, err
+	}
+	return unrestricted.Add(NodeLabel, klabels.InOperator, buckets), nil
+}
+
+// Unrestricted returns selector without any cohort restriction added by
+// RestrictSelector
+func Unrestricted(selector klabels.Selector) (klabels.Selector, error) {
+	requirements, ok := selector.(klabels.LabelSelector)
+	if !ok {
+		return nil, util.Errorf("cannot restrict node selector %q to a cohort", selector.String())
+	}
+
+	var unrestricted klabels.LabelSelector
+	for _, requirement := range requirements {
+		if requirement.Key() != NodeLabel {
+			unrestricted = append(unrestricted, requirement)
+		}
+	}
+	return unrestricted, nil
+}
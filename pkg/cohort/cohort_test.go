@@ -0,0 +1,118 @@
+package cohort
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/square/p2/pkg/types"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+func testNodes(n int) []types.NodeName {
+	nodes := make([]types.NodeName, n)
+	for i := range nodes {
+		nodes[i] = types.NodeName(fmt.Sprintf("node%d.example.com", i))
+	}
+	return nodes
+}
+
+func TestSelectIsStableAndNested(t *testing.T) {
+	nodes := testNodes(1000)
+
+	small, err := Select(nodes, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	large, err := Select(nodes, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// allow for some skew in the hash distribution
+	if len(small) < 50 || len(small) > 150 {
+		t.Errorf("expected roughly 100 nodes in the 10%% cohort, got %d", len(small))
+	}
+
+	inLarge := make(map[types.NodeName]bool)
+	for _, node := range large {
+		inLarge[node] = true
+	}
+	for _, node := range small {
+		if !inLarge[node] {
+			t.Errorf("%s was in the 10%% cohort but not the 30%% cohort", node)
+		}
+	}
+
+	// selecting from a subset of the fleet should not change membership
+	subset, err := Select(nodes[:500], 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range subset {
+		if !Contains(node, 10) {
+			t.Errorf("%s was selected from a subset but is not in the cohort", node)
+		}
+	}
+
+	all, err := Select(nodes, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != len(nodes) {
+		t.Errorf("expected every node in the 100%% cohort, got %d of %d", len(all), len(nodes))
+	}
+}
+
+func TestInvalidPercent(t *testing.T) {
+	for _, percent := range []int{-1, 0, 101} {
+		if _, err := Select(testNodes(1), percent); err == nil {
+			t.Errorf("expected an error selecting a %d%% cohort", percent)
+		}
+	}
+}
+
+func TestRestrictSelector(t *testing.T) {
+	selector, err := klabels.Parse("pool=web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := testNodes(1000)
+
+	for _, percent := range []int{10, 30} {
+		// restricting an already restricted selector replaces its cohort
+		selector, err = RestrictSelector(selector, percent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the selector is stored as a string, so it must survive parsing
+		selector, err = klabels.Parse(selector.String())
+		if err != nil {
+			t.Fatalf("could not parse restricted selector: %s", err)
+		}
+
+		for _, node := range nodes {
+			matches := selector.Matches(klabels.Set{
+				"pool":    "web",
+				NodeLabel: BucketLabel(node),
+			})
+			if matches != Contains(node, percent) {
+				t.Errorf("expected the %d%% selector to match %s only if it is in the cohort", percent, node)
+			}
+		}
+		if selector.Matches(klabels.Set{"pool": "db", NodeLabel: "0"}) {
+			t.Errorf("expected the %d%% selector to keep the pool requirement", percent)
+		}
+		if selector.Matches(klabels.Set{"pool": "web"}) {
+			t.Errorf("expected the %d%% selector not to match unlabeled nodes", percent)
+		}
+	}
+
+	unrestricted, err := Unrestricted(selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unrestricted.String() != "pool=web" {
+		t.Errorf("expected removing the cohort to leave pool=web, got %q", unrestricted.String())
+	}
+}
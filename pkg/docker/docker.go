@@ -251,6 +251,15 @@ func (l *Launchable) PostActivate() (string, error) {
 	return "", nil
 }
 
+func (l *Launchable) Reload(_ *runit.ServiceBuilder, _ runit.SV) error {
+	return util.Errorf("cannot reload docker container %s: reloading is not supported for docker containers", l.ServiceID())
+}
+
+func (l *Launchable) Migrate() (string, error) {
+	// migrations are not supported for docker containers
+	return "", nil
+}
+
 func (l *Launchable) PostInstall() (string, error) {
 	// there is no post install step for docker containers
 	return "", nil
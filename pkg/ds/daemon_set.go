@@ -33,8 +33,7 @@ import (
 
 const (
 	// This label is applied to pods owned by a DS.
-	DSIDLabel                = "daemon_set_id"
-	DaemonSetStatusNamespace = statusstore.Namespace("daemon_set_farm")
+	DSIDLabel = "daemon_set_id"
 )
 
 var (
@@ -102,7 +101,6 @@ type LabelWatcher interface {
 }
 
 type store interface {
-	DeletePodTxn(ctx context.Context, podPrefix consul.PodPrefix, nodename types.NodeName, podID types.PodID) error
 	NewUnmanagedSession(session, name string) consul.Session
 
 	// For passing to the replication package:
@@ -267,6 +265,31 @@ func (ds *daemonSet) EligibleNodes() ([]types.NodeName, error) {
 	return ds.scheduler.EligibleNodes(m, nodeSelector)
 }
 
+// schedulableNodes returns the eligible nodes that the daemon set's pod may
+// be deployed to: the ones that aren't cordoned, and the cordoned ones that
+// already have the pod, which keep getting its updates
+func (ds *daemonSet) schedulableNodes() ([]types.NodeName, error) {
+	eligible, err := ds.EligibleNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	cordoned, err := scheduler.CordonedNodes(ds.applicator)
+	if err != nil {
+		return nil, err
+	}
+	if cordoned.Len() == 0 {
+		return eligible, nil
+	}
+
+	podLocations, err := ds.CurrentPods()
+	if err != nil {
+		return nil, err
+	}
+	cordoned = cordoned.Difference(types.NewNodeSet(podLocations.Nodes()...))
+	return scheduler.Uncordoned(eligible, cordoned), nil
+}
+
 func (ds *daemonSet) MetricNames(suffix string) []string {
 	prefix := "daemonset"
 	middles := []string{
@@ -336,7 +359,7 @@ func (ds *daemonSet) WatchDesires(
 		// Schedule all the pods when we first start watching
 		if !ds.IsDisabled() {
 			ds.logger.NoFields().Infof("Received new daemon set: %s", ds.ID)
-			eligibleNodes, err = ds.EligibleNodes()
+			eligibleNodes, err = ds.schedulableNodes()
 			if err != nil {
 				err = util.Errorf("Unable to compute eligible nodes: %v", err)
 			}
@@ -435,7 +458,7 @@ func (ds *daemonSet) WatchDesires(
 
 					ds.logger.Infoln("kicking off replication for all nodes")
 					// schedule all the nodes again cuz the manifest changed or we unpaused
-					eligibleNodes, err = ds.EligibleNodes()
+					eligibleNodes, err = ds.schedulableNodes()
 					if err != nil {
 						err = util.Errorf("Unable to compute eligible nodes: %v", err)
 						continue
@@ -503,7 +526,7 @@ func (ds *daemonSet) WatchDesires(
 				if paused {
 					unpauseReplication <- struct{}{}
 					// schedule all the nodes again because we might have been paused for a while
-					eligibleNodes, err = ds.EligibleNodes()
+					eligibleNodes, err = ds.schedulableNodes()
 					if err != nil {
 						err = util.Errorf("Unable to compute eligible nodes: %v", err)
 						continue
@@ -567,7 +590,12 @@ func (ds *daemonSet) computeNodesToAdd() ([]types.NodeName, error) {
 
 	// Get the difference in nodes that we need to schedule on and then sort them
 	// for deterministic ordering
-	toScheduleSorted := types.NewNodeSet(eligible...).Difference(types.NewNodeSet(currentNodes...)).ListNodes()
+	// Cordoned nodes that don't have the pod yet must not get it
+	cordoned, err := scheduler.CordonedNodes(ds.applicator)
+	if err != nil {
+		return nil, util.Errorf("Error retrieving cordoned nodes: %v", err)
+	}
+	toScheduleSorted := types.NewNodeSet(eligible...).Difference(types.NewNodeSet(currentNodes...)).Difference(cordoned).ListNodes()
 
 	if len(toScheduleSorted) > 0 {
 		ds.logger.Infof("Need to schedule %d nodes: %s", len(toScheduleSorted), toScheduleSorted)
@@ -20,8 +20,10 @@ import (
 	"github.com/square/p2/pkg/store/consul/dsstore"
 	"github.com/square/p2/pkg/store/consul/statusstore"
 	"github.com/square/p2/pkg/store/consul/statusstore/daemonsetstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/nodestatus"
 	"github.com/square/p2/pkg/store/consul/transaction"
 	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/webhook"
 
 	. "github.com/anthonybishopric/gotcha"
 	"github.com/pborman/uuid"
@@ -623,6 +625,48 @@ func (n nullReplication) SetManifest(manifest.Manifest) {
 func (n nullReplication) SetTimeout(time.Duration) {
 	panic("SetTimeout() not implemented on nullReplication")
 }
+func (n nullReplication) NodeTimings() []replication.NodeTiming {
+	return nil
+}
+func (n nullReplication) SetCanary(int, time.Duration) {
+	panic("SetCanary() not implemented on nullReplication")
+}
+func (n nullReplication) SetRollbackPolicy(replication.RollbackPolicy) {
+	panic("SetRollbackPolicy() not implemented on nullReplication")
+}
+func (n nullReplication) ProgressUpdates() <-chan replication.NodeProgress {
+	panic("ProgressUpdates() not implemented on nullReplication")
+}
+func (n nullReplication) SetRecord(consul.ReplicationRecord) {
+	panic("SetRecord() not implemented on nullReplication")
+}
+func (n nullReplication) SetMinHealthy(replication.MinHealthy) {
+	panic("SetMinHealthy() not implemented on nullReplication")
+}
+func (n nullReplication) SetOrder(replication.Order) {
+	panic("SetOrder() not implemented on nullReplication")
+}
+func (n nullReplication) SetRetries(int) {
+	panic("SetRetries() not implemented on nullReplication")
+}
+func (n nullReplication) SetEventStore(replication.EventStore) {
+	panic("SetEventStore() not implemented on nullReplication")
+}
+func (n nullReplication) SetNodeResolver(replication.NodeResolver, time.Duration) {
+	panic("SetNodeResolver() not implemented on nullReplication")
+}
+func (n nullReplication) SetAckStore(replication.DeployStatusStore) {
+	panic("SetAckStore() not implemented on nullReplication")
+}
+func (n nullReplication) SetNodeStatusStore(nodestatus.Reader) {
+	panic("SetNodeStatusStore() not implemented on nullReplication")
+}
+func (n nullReplication) SetNodeOverrides(replication.NodeOverrides) {
+	panic("SetNodeOverrides() not implemented on nullReplication")
+}
+func (n nullReplication) SetNotifier(webhook.Notifier) {
+	panic("SetNotifier() not implemented on nullReplication")
+}
 
 func TestWriteNewestStatus(t *testing.T) {
 	type writeStatusTestCase struct {
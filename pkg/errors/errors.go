@@ -0,0 +1,292 @@
+// Package errors provides the error type used across P2. Its errors record
+// where they were created, the stack at that point, the error that caused
+// them and optionally a machine readable Code, so that callers can decide
+// whether to retry without parsing messages and logs and metrics can group
+// failures by code.
+//
+// It can be imported in place of the standard library's errors package. Its
+// Is, As and Unwrap behave like those Go 1.13 added to the standard library,
+// and Errorf understands %w, but unlike those they build with the Go release
+// P2 is built with.
+package errors
+
+import (
+	"bytes"
+	stderrors "errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// Code categorizes an error for callers and operators
+type Code string
+
+const (
+	// CodeUnknown is the code of errors that weren't given one
+	CodeUnknown Code = ""
+
+	// The thing operated on doesn't exist
+	CodeNotFound Code = "not_found"
+
+	// The thing operated on changed concurrently, e.g. a failed
+	// check-and-set
+	CodeConflict Code = "conflict"
+
+	// A dependency such as Consul couldn't be reached or failed
+	CodeUnavailable Code = "unavailable"
+
+	// An operation took too long
+	CodeTimeout Code = "timeout"
+
+	// The input of an operation is invalid, so retrying won't help
+	CodeInvalid Code = "invalid"
+)
+
+// Error is an error with a call site, a stack, an optional cause and an
+// optional Code. It implements the util.StackError interface, so that loggers
+// include its call site.
+type Error struct {
+	Code    Code
+	Message string
+
+	cause      error
+	filename   string
+	function   string
+	lineNumber int
+	stack      []uintptr
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the error that caused e, if any
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+func (e *Error) LineNumber() int {
+	return e.lineNumber
+}
+
+func (e *Error) Filename() string {
+	return e.filename
+}
+
+func (e *Error) Function() string {
+	return e.function
+}
+
+// Stack formats the stack of the goroutine that created e, starting with the
+// function that created it
+func (e *Error) Stack() []byte {
+	var b bytes.Buffer
+	frames := runtime.CallersFrames(e.stack)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&b, "%s()\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return []byte(b.String())
+}
+
+// newError creates an error whose call site is skip frames above its caller
+func newError(skip int, code Code, message string, cause error) *Error {
+	e := &Error{
+		Code:    code,
+		Message: message,
+		cause:   cause,
+	}
+	pc, file, line, ok := runtime.Caller(skip + 1)
+	if ok {
+		e.filename = filepath.Base(file)
+		e.function = runtime.FuncForPC(pc).Name()
+		e.lineNumber = line
+		e.Message = fmt.Sprintf("%s:%d: %s", e.filename, line, message)
+	}
+	stack := make([]uintptr, 32)
+	e.stack = stack[:runtime.Callers(skip+2, stack)]
+	return e
+}
+
+// Errorf formats according to fmt.Errorf, prefixing the message with the
+// file name and line number of the caller like util.Errorf. An error
+// formatted with %w becomes the cause of the returned error.
+func Errorf(format string, a ...interface{}) error {
+	format, cause := formatCause(format, a)
+	return newError(1, CodeUnknown, fmt.Sprintf(format, a...), cause)
+}
+
+// Codef is Errorf for errors with a code
+func Codef(code Code, format string, a ...interface{}) error {
+	format, cause := formatCause(format, a)
+	return newError(1, code, fmt.Sprintf(format, a...), cause)
+}
+
+// formatCause returns format with its first %w replaced by %v, since fmt
+// doesn't know %w before Go 1.13, along with the error it formats. Explicit
+// argument indexes such as %[1]w aren't supported.
+func formatCause(format string, a []interface{}) (string, error) {
+	arg := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		// skip the flags, width and precision, a * of which takes an
+		// argument
+		for i++; i < len(format) && strings.IndexByte("+-# 0123456789.*", format[i]) >= 0; i++ {
+			if format[i] == '*' {
+				arg++
+			}
+		}
+		if i == len(format) {
+			break
+		}
+		switch format[i] {
+		case '%':
+			continue
+		case 'w':
+			var cause error
+			if arg < len(a) {
+				cause, _ = a[arg].(error)
+			}
+			return format[:i] + "v" + format[i+1:], cause
+		}
+		arg++
+	}
+	return format, nil
+}
+
+// Wrap returns an error caused by err whose message is message followed by
+// err's, or nil if err is nil. The returned error has err's code.
+func Wrap(err error, message string) error {
+	if err == nil {
+		return nil
+	}
+	return newError(1, CodeOf(err), message+": "+err.Error(), err)
+}
+
+// New returns an error with the given text, like the standard library's
+// errors.New. It has no call site, so that it can be compared against as a
+// sentinel.
+func New(text string) error {
+	return stderrors.New(text)
+}
+
+// Unwrap returns the cause of err, if err has an Unwrap method
+func Unwrap(err error) error {
+	u, ok := err.(interface {
+		Unwrap() error
+	})
+	if !ok {
+		return nil
+	}
+	return u.Unwrap()
+}
+
+// Is returns whether err or any error in its chain of causes is target, or
+// has an Is method that reports it is
+func Is(err, target error) bool {
+	if target == nil {
+		return err == target
+	}
+	comparable := reflect.TypeOf(target).Comparable()
+	for err != nil {
+		if comparable && err == target {
+			return true
+		}
+		if x, ok := err.(interface {
+			Is(error) bool
+		}); ok && x.Is(target) {
+			return true
+		}
+		err = Unwrap(err)
+	}
+	return false
+}
+
+// As finds the first error in err's chain of causes that can be assigned to
+// the value target points to, or that has an As method that accepts target,
+// and sets target to it. It panics if target isn't a non-nil pointer to an
+// interface or to a type implementing error.
+func As(err error, target interface{}) bool {
+	if target == nil {
+		panic("errors: target cannot be nil")
+	}
+	val := reflect.ValueOf(target)
+	typ := val.Type()
+	if typ.Kind() != reflect.Ptr || val.IsNil() {
+		panic("errors: target must be a non-nil pointer")
+	}
+	targetType := typ.Elem()
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+	if targetType.Kind() != reflect.Interface && !targetType.Implements(errorType) {
+		panic("errors: *target must be interface or implement error")
+	}
+	for err != nil {
+		if reflect.TypeOf(err).AssignableTo(targetType) {
+			val.Elem().Set(reflect.ValueOf(err))
+			return true
+		}
+		if x, ok := err.(interface {
+			As(interface{}) bool
+		}); ok && x.As(target) {
+			return true
+		}
+		err = Unwrap(err)
+	}
+	return false
+}
+
+// coder is implemented by errors that carry a code without being an *Error,
+// such as consulutil.KVError
+type coder interface {
+	ErrCode() Code
+}
+
+// CodeOf returns the first code found in err's chain of causes, or
+// CodeUnknown if none has one
+func CodeOf(err error) Code {
+	for err != nil {
+		switch e := err.(type) {
+		case *Error:
+			if e.Code != CodeUnknown {
+				return e.Code
+			}
+		case coder:
+			if code := e.ErrCode(); code != CodeUnknown {
+				return code
+			}
+		}
+		err = Unwrap(err)
+	}
+	return CodeUnknown
+}
+
+// Cause returns the error at the end of err's chain of causes
+func Cause(err error) error {
+	for {
+		cause := Unwrap(err)
+		if cause == nil {
+			return err
+		}
+		err = cause
+	}
+}
+
+// Retryable returns whether the operation that failed with err could succeed
+// if it were retried as is, judging by err's code. Errors without a code are
+// assumed to be retryable, since most of P2's errors come from talking to
+// Consul.
+func Retryable(err error) bool {
+	switch CodeOf(err) {
+	case CodeNotFound, CodeInvalid:
+		return false
+	default:
+		return err != nil
+	}
+}
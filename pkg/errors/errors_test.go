@@ -0,0 +1,114 @@
+package errors
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/square/p2/pkg/util"
+)
+
+type codedError struct{}
+
+func (codedError) Error() string { return "consul is down" }
+func (codedError) ErrCode() Code { return CodeUnavailable }
+
+func TestErrorf(t *testing.T) {
+	cause := New("connection refused")
+	err := Errorf("could not read %s: %w", "intent", cause)
+	if !strings.HasPrefix(err.Error(), "errors_test.go:") || !strings.HasSuffix(err.Error(), "could not read intent: connection refused") {
+		t.Errorf("expected the message to be prefixed with the call site, got %q", err)
+	}
+	if !Is(err, cause) || Cause(err) != cause {
+		t.Errorf("expected %q to be caused by %q", err, cause)
+	}
+
+	stackErr, ok := err.(util.StackError)
+	if !ok {
+		t.Fatalf("expected a util.StackError, got %T", err)
+	}
+	if stackErr.Function() != "github.com/square/p2/pkg/errors.TestErrorf" || stackErr.Filename() != "errors_test.go" {
+		t.Errorf("unexpected call site %s in %s", stackErr.Function(), stackErr.Filename())
+	}
+	if !bytes.HasPrefix(stackErr.Stack(), []byte("github.com/square/p2/pkg/errors.TestErrorf()")) {
+		t.Errorf("expected the stack to start at the caller, got\n%s", stackErr.Stack())
+	}
+
+	if Errorf("no cause: %s", cause).(*Error).Unwrap() != nil {
+		t.Error("expected only %w to make an error a cause")
+	}
+}
+
+func TestCodes(t *testing.T) {
+	if code := CodeOf(Errorf("plain")); code != CodeUnknown {
+		t.Errorf("expected no code, got %q", code)
+	}
+
+	conflict := Codef(CodeConflict, "intent changed")
+	wrapped := Errorf("could not write intent: %w", conflict)
+	if code := CodeOf(wrapped); code != CodeConflict {
+		t.Errorf("expected the code of the cause, got %q", code)
+	}
+	if code := CodeOf(Wrap(codedError{}, "could not list pods")); code != CodeUnavailable {
+		t.Errorf("expected the code of an error implementing ErrCode, got %q", code)
+	}
+	if Wrap(nil, "nothing happened") != nil {
+		t.Error("expected wrapping nil to return nil")
+	}
+
+	if !Retryable(wrapped) || !Retryable(Errorf("plain")) {
+		t.Error("expected conflicts and errors without a code to be retryable")
+	}
+	if Retryable(Errorf("bad manifest: %w", Codef(CodeInvalid, "no id"))) || Retryable(nil) {
+		t.Error("expected invalid input and nil not to be retryable")
+	}
+}
+
+func TestFormatCause(t *testing.T) {
+	cause := New("connection refused")
+	type testCase struct {
+		format          string
+		args            []interface{}
+		expectedMessage string
+		expectedCause   error
+	}
+	for _, tc := range []testCase{
+		{"could not read %s: %w", []interface{}{"intent", cause}, "could not read intent: connection refused", cause},
+		{"100%% of %*d pods: %w", []interface{}{3, 2, cause}, "100% of   2 pods: connection refused", cause},
+		{"%q: %+w", []interface{}{"web", cause}, `"web": connection refused`, cause},
+		{"not an error: %w", []interface{}{"text"}, "not an error: text", nil},
+		{"no cause: %v", []interface{}{cause}, "no cause: connection refused", nil},
+	} {
+		err := Errorf(tc.format, tc.args...).(*Error)
+		if !strings.HasSuffix(err.Error(), ": "+tc.expectedMessage) {
+			t.Errorf("%q: expected the message %q, got %q", tc.format, tc.expectedMessage, err)
+		}
+		if err.Unwrap() != tc.expectedCause {
+			t.Errorf("%q: expected the cause %v, got %v", tc.format, tc.expectedCause, err.Unwrap())
+		}
+	}
+}
+
+func TestIsAndAs(t *testing.T) {
+	cause := codedError{}
+	err := Wrap(Errorf("could not read intent: %w", cause), "could not update pod")
+	if !Is(err, cause) || Is(err, New("connection refused")) || Is(nil, cause) || !Is(nil, nil) {
+		t.Error("expected Is to find exactly the errors in the chain of causes")
+	}
+
+	var coded codedError
+	if !As(err, &coded) {
+		t.Error("expected As to find the codedError cause")
+	}
+	var withCode coder
+	if !As(err, &withCode) || withCode.ErrCode() != CodeUnavailable {
+		t.Errorf("expected As to find the first error implementing an interface, got %v", withCode)
+	}
+	var p2Err *Error
+	if !As(err, &p2Err) || p2Err != err {
+		t.Errorf("expected As to find the outermost *Error, got %v", p2Err)
+	}
+	if As(New("plain"), &p2Err) {
+		t.Error("expected As not to match an error of another type")
+	}
+}
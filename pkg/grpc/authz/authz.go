@@ -0,0 +1,202 @@
+// Package authz implements role-based authorization for P2's gRPC API
+// servers. Callers are identified by their TLS client certificate or by an
+// OIDC bearer token, and a policy binds those identities to roles, optionally
+// restricted to some pods.
+package authz
+
+import (
+	"io/ioutil"
+
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	"gopkg.in/yaml.v2"
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+// Role is a set of operations granted to an identity. Each role includes
+// every operation of the roles below it.
+type Role string
+
+const (
+	// Viewers may read pod statuses, labels, daemon sets and audit logs
+	RoleViewer Role = "viewer"
+
+	// Deployers may additionally schedule pods and scale the nodes
+	// allocated to them
+	RoleDeployer Role = "deployer"
+
+	// Admins may additionally unschedule pods and delete records, and call
+	// any method the policy doesn't know about
+	RoleAdmin Role = "admin"
+)
+
+var roleRanks = map[Role]int{
+	RoleViewer:   1,
+	RoleDeployer: 2,
+	RoleAdmin:    3,
+}
+
+// Includes returns whether r grants every operation of other
+func (r Role) Includes(other Role) bool {
+	rank, ok := roleRanks[r]
+	return ok && rank >= roleRanks[other]
+}
+
+// Operation is the kind of change an API method makes
+type Operation string
+
+const (
+	OperationRead     Operation = "read"
+	OperationSchedule Operation = "schedule"
+	OperationScale    Operation = "scale"
+	OperationDelete   Operation = "delete"
+)
+
+// RequiredRole returns the least role that grants op
+func RequiredRole(op Operation) Role {
+	switch op {
+	case OperationRead:
+		return RoleViewer
+	case OperationSchedule, OperationScale:
+		return RoleDeployer
+	default:
+		return RoleAdmin
+	}
+}
+
+// Identity is the authenticated caller of an API method. A caller may be
+// known by several names, e.g. the common name and email address of its
+// certificate, or the subject, email and groups of its token.
+type Identity struct {
+	Names []string
+}
+
+// Resource is the pod an API method operates on. Methods that don't operate
+// on a particular pod have an empty resource, and can only be authorized by
+// bindings that aren't restricted to some pods.
+type Resource struct {
+	PodID types.PodID
+
+	// Labels are the labels of the pod, nil if it has none or they could
+	// not be determined
+	Labels klabels.Set
+}
+
+// Binding grants a role to some identities
+type Binding struct {
+	// Identities lists the names the role is granted to. Certificates are
+	// known by their common name and email addresses, and OIDC tokens by
+	// their subject, email and groups, with groups prefixed by "group:".
+	Identities []string `yaml:"identities"`
+
+	Role Role `yaml:"role"`
+
+	// PodIDs restricts the binding to the given pods. If empty, the
+	// binding applies to all pods.
+	PodIDs []types.PodID `yaml:"pod_ids,omitempty"`
+
+	// PodSelector restricts the binding to pods whose labels it matches.
+	// If empty, the binding applies to all pods.
+	PodSelector string `yaml:"pod_selector,omitempty"`
+
+	selector klabels.Selector
+}
+
+// Policy maps identities to roles
+type Policy struct {
+	Bindings []Binding `yaml:"bindings"`
+}
+
+// LoadPolicy reads a YAML policy from the given path
+func LoadPolicy(path string) (Policy, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Policy{}, util.Errorf("could not read authorization policy: %s", err)
+	}
+
+	var policy Policy
+	err = yaml.Unmarshal(bytes, &policy)
+	if err != nil {
+		return Policy{}, util.Errorf("could not parse authorization policy %s: %s", path, err)
+	}
+
+	err = policy.init()
+	if err != nil {
+		return Policy{}, util.Errorf("invalid authorization policy %s: %s", path, err)
+	}
+	return policy, nil
+}
+
+func (p *Policy) init() error {
+	for i := range p.Bindings {
+		binding := &p.Bindings[i]
+		if _, ok := roleRanks[binding.Role]; !ok {
+			return util.Errorf("binding %d has unknown role %q", i, binding.Role)
+		}
+		if len(binding.Identities) == 0 {
+			return util.Errorf("binding %d has no identities", i)
+		}
+
+		if binding.PodSelector != "" {
+			selector, err := klabels.Parse(binding.PodSelector)
+			if err != nil {
+				return util.Errorf("binding %d has an invalid pod selector: %s", i, err)
+			}
+			binding.selector = selector
+		}
+	}
+	return nil
+}
+
+// Authorize returns an error if no binding grants identity a role that
+// includes op on resource
+func (p Policy) Authorize(identity Identity, op Operation, resource Resource) error {
+	required := RequiredRole(op)
+	for _, binding := range p.Bindings {
+		if binding.Role.Includes(required) && binding.matchesIdentity(identity) && binding.matchesResource(resource) {
+			return nil
+		}
+	}
+	return util.Errorf("%v may not %s %s", identity.Names, op, describeResource(resource))
+}
+
+func (b Binding) matchesIdentity(identity Identity) bool {
+	for _, bound := range b.Identities {
+		for _, name := range identity.Names {
+			if bound == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (b Binding) matchesResource(resource Resource) bool {
+	if len(b.PodIDs) > 0 {
+		found := false
+		for _, podID := range b.PodIDs {
+			if podID == resource.PodID && podID != "" {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if b.selector != nil {
+		if resource.PodID == "" || !b.selector.Matches(resource.Labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func describeResource(resource Resource) string {
+	if resource.PodID == "" {
+		return "all pods"
+	}
+	return string(resource.PodID)
+}
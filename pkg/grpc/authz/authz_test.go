@@ -0,0 +1,103 @@
+package authz
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/types"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+func testPolicy(t *testing.T, bindings ...Binding) Policy {
+	policy := Policy{Bindings: bindings}
+	err := policy.init()
+	if err != nil {
+		t.Fatalf("Unexpected error initializing policy: %s", err)
+	}
+	return policy
+}
+
+func TestRoleIncludes(t *testing.T) {
+	if !RoleAdmin.Includes(RoleDeployer) || !RoleDeployer.Includes(RoleViewer) || !RoleViewer.Includes(RoleViewer) {
+		t.Error("Expected roles to include the roles below them")
+	}
+	if RoleViewer.Includes(RoleDeployer) || RoleDeployer.Includes(RoleAdmin) {
+		t.Error("Expected roles not to include the roles above them")
+	}
+	if Role("bogus").Includes(RoleViewer) {
+		t.Error("Expected an unknown role to include nothing")
+	}
+}
+
+func TestAuthorizeByRole(t *testing.T) {
+	policy := testPolicy(t,
+		Binding{Identities: []string{"alice"}, Role: RoleViewer},
+		Binding{Identities: []string{"group:deployers"}, Role: RoleDeployer},
+	)
+	resource := Resource{PodID: "web"}
+
+	alice := Identity{Names: []string{"alice"}}
+	if err := policy.Authorize(alice, OperationRead, resource); err != nil {
+		t.Errorf("Expected viewer to be allowed to read: %s", err)
+	}
+	if err := policy.Authorize(alice, OperationSchedule, resource); err == nil {
+		t.Error("Expected viewer not to be allowed to schedule")
+	}
+
+	bob := Identity{Names: []string{"bob", "group:deployers"}}
+	if err := policy.Authorize(bob, OperationScale, resource); err != nil {
+		t.Errorf("Expected deployer to be allowed to scale: %s", err)
+	}
+	if err := policy.Authorize(bob, OperationDelete, resource); err == nil {
+		t.Error("Expected deployer not to be allowed to delete")
+	}
+	if err := policy.Authorize(bob, Operation("/some.Service/Unknown"), resource); err == nil {
+		t.Error("Expected deployer not to be allowed to perform unknown operations")
+	}
+
+	mallory := Identity{Names: []string{"mallory"}}
+	if err := policy.Authorize(mallory, OperationRead, resource); err == nil {
+		t.Error("Expected an unbound identity not to be allowed to read")
+	}
+}
+
+func TestAuthorizeScopedBindings(t *testing.T) {
+	policy := testPolicy(t,
+		Binding{Identities: []string{"alice"}, Role: RoleDeployer, PodIDs: []types.PodID{"web"}},
+		Binding{Identities: []string{"bob"}, Role: RoleDeployer, PodSelector: "team=payments"},
+	)
+	alice := Identity{Names: []string{"alice"}}
+	bob := Identity{Names: []string{"bob"}}
+
+	if err := policy.Authorize(alice, OperationSchedule, Resource{PodID: "web"}); err != nil {
+		t.Errorf("Expected alice to be allowed to schedule web: %s", err)
+	}
+	if err := policy.Authorize(alice, OperationSchedule, Resource{PodID: "db"}); err == nil {
+		t.Error("Expected alice not to be allowed to schedule db")
+	}
+	if err := policy.Authorize(alice, OperationRead, Resource{}); err == nil {
+		t.Error("Expected a binding restricted to some pods not to authorize calls on all pods")
+	}
+
+	payments := Resource{PodID: "ledger", Labels: klabels.Set{"team": "payments"}}
+	if err := policy.Authorize(bob, OperationSchedule, payments); err != nil {
+		t.Errorf("Expected bob to be allowed to schedule a payments pod: %s", err)
+	}
+	other := Resource{PodID: "ledger", Labels: klabels.Set{"team": "search"}}
+	if err := policy.Authorize(bob, OperationSchedule, other); err == nil {
+		t.Error("Expected bob not to be allowed to schedule a search pod")
+	}
+}
+
+func TestInitRejectsInvalidBindings(t *testing.T) {
+	for _, binding := range []Binding{
+		{Identities: []string{"alice"}, Role: "superuser"},
+		{Role: RoleViewer},
+		{Identities: []string{"alice"}, Role: RoleViewer, PodSelector: "team in (("},
+	} {
+		policy := Policy{Bindings: []Binding{binding}}
+		if err := policy.init(); err == nil {
+			t.Errorf("Expected an error for invalid binding %+v", binding)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package authz
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/util"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Config configures authentication and authorization of an API server. It
+// is meant to be embedded in the server's YAML config.
+type Config struct {
+	TLS struct {
+		CertFile string `yaml:"cert_file"`
+		KeyFile  string `yaml:"key_file"`
+
+		// ClientCAFile holds the CAs that client certificates are
+		// verified against. Clients without a certificate must present
+		// a bearer token instead.
+		ClientCAFile string `yaml:"client_ca_file"`
+	} `yaml:"tls"`
+
+	OIDC struct {
+		Issuer   string `yaml:"issuer"`
+		Audience string `yaml:"audience"`
+	} `yaml:"oidc"`
+
+	// PolicyFile is the path of the authorization policy. If unset, every
+	// call is allowed.
+	PolicyFile string `yaml:"authorization_policy"`
+}
+
+// ServerOptions returns the gRPC server options that set up TLS, if a
+// certificate is configured
+func (c Config) ServerOptions() ([]grpc.ServerOption, error) {
+	if c.TLS.CertFile == "" {
+		return nil, nil
+	}
+
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	return []grpc.ServerOption{grpc.Creds(credentials.NewTLS(tlsConfig))}, nil
+}
+
+// Authorizer returns an authorizer implementing the config, or nil if no
+// policy is configured. pods and labeler are passed to NewAuthorizer.
+func (c Config) Authorizer(pods PodResolver, labeler Labeler, logger logging.Logger) (*Authorizer, error) {
+	if c.PolicyFile == "" {
+		return nil, nil
+	}
+
+	policy, err := LoadPolicy(c.PolicyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokenVerifier TokenVerifier
+	if c.OIDC.Issuer != "" {
+		if c.OIDC.Audience == "" {
+			return nil, util.Errorf("an OIDC audience must be set along with the issuer")
+		}
+		tokenVerifier = NewOIDCVerifier(c.OIDC.Issuer, c.OIDC.Audience, &http.Client{Timeout: 10 * time.Second})
+	}
+	if tokenVerifier == nil && c.TLS.ClientCAFile == "" {
+		return nil, util.Errorf("an authorization policy requires a client CA or an OIDC issuer to identify callers")
+	}
+
+	return NewAuthorizer(policy, tokenVerifier, pods, labeler, logger), nil
+}
+
+func (c Config) tlsConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.TLS.CertFile, c.TLS.KeyFile)
+	if err != nil {
+		return nil, util.Errorf("could not load server certificate: %s", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if c.TLS.ClientCAFile != "" {
+		caBytes, err := ioutil.ReadFile(c.TLS.ClientCAFile)
+		if err != nil {
+			return nil, util.Errorf("could not read client CAs: %s", err)
+		}
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caBytes) {
+			return nil, util.Errorf("no certificates found in %s", c.TLS.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,60 @@
+package authz
+
+import (
+	"crypto/x509"
+	"strings"
+
+	context "golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// TokenVerifier verifies a bearer token and returns the names its holder is
+// known by
+type TokenVerifier interface {
+	Verify(token string) ([]string, error)
+}
+
+// identify authenticates the caller of an API method, preferring a bearer
+// token in the "authorization" metadata over the TLS client certificate.
+// tokenVerifier may be nil if bearer tokens aren't accepted.
+func identify(ctx context.Context, tokenVerifier TokenVerifier) (Identity, error) {
+	if md, ok := metadata.FromContext(ctx); ok {
+		if values := md["authorization"]; len(values) > 0 {
+			if tokenVerifier == nil {
+				return Identity{}, grpc.Errorf(codes.Unauthenticated, "bearer tokens are not accepted by this server")
+			}
+			token := strings.TrimSpace(values[0])
+			if !strings.HasPrefix(strings.ToLower(token), "bearer ") {
+				return Identity{}, grpc.Errorf(codes.Unauthenticated, "authorization metadata must be a bearer token")
+			}
+			names, err := tokenVerifier.Verify(strings.TrimSpace(token[len("bearer "):]))
+			if err != nil {
+				return Identity{}, grpc.Errorf(codes.Unauthenticated, "invalid bearer token: %s", err)
+			}
+			return Identity{Names: names}, nil
+		}
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.VerifiedChains) > 0 && len(tlsInfo.State.VerifiedChains[0]) > 0 {
+			return Identity{Names: certificateNames(tlsInfo.State.VerifiedChains[0][0])}, nil
+		}
+	}
+
+	return Identity{}, grpc.Errorf(codes.Unauthenticated, "a verified client certificate or bearer token is required")
+}
+
+// certificateNames returns the names a client certificate is known by: its
+// common name and email addresses
+func certificateNames(cert *x509.Certificate) []string {
+	var names []string
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+	names = append(names, cert.EmailAddresses...)
+	return names
+}
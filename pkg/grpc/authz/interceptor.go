@@ -0,0 +1,198 @@
+package authz
+
+import (
+	podstore_protos "github.com/square/p2/pkg/grpc/podstore/protos"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/podstore"
+	"github.com/square/p2/pkg/types"
+
+	"github.com/Sirupsen/logrus"
+	context "golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// methodOperations maps the API methods to the operations they perform.
+// Methods missing from this map may only be called by admins.
+var methodOperations = map[string]Operation{
+	"/podstore.P2PodStore/SchedulePod":     OperationSchedule,
+	"/podstore.P2PodStore/WatchPodStatus":  OperationRead,
+	"/podstore.P2PodStore/UnschedulePod":   OperationDelete,
+	"/podstore.P2PodStore/ListPodStatus":   OperationRead,
+	"/podstore.P2PodStore/DeletePodStatus": OperationDelete,
+	"/podstore.P2PodStore/MarkPodFailed":   OperationSchedule,
+
+	"/label_store_protos.P2LabelStore/WatchMatches": OperationRead,
+
+	"/daemonsetstore.P2DaemonSetStore/ListDaemonSets":   OperationRead,
+	"/daemonsetstore.P2DaemonSetStore/WatchDaemonSets":  OperationRead,
+	"/daemonsetstore.P2DaemonSetStore/DisableDaemonSet": OperationSchedule,
+
+	"/auditlogstore.P2AuditLogStore/List":   OperationRead,
+	"/auditlogstore.P2AuditLogStore/Delete": OperationDelete,
+
+	"/scheduler_protos.P2Scheduler/EligibleNodes":   OperationRead,
+	"/scheduler_protos.P2Scheduler/AllocateNodes":   OperationScale,
+	"/scheduler_protos.P2Scheduler/DeallocateNodes": OperationScale,
+}
+
+// MethodOperation returns the operation performed by the API method with the
+// given full name. Unknown methods are their own operation, which only admins
+// may perform.
+func MethodOperation(fullMethod string) Operation {
+	op, ok := methodOperations[fullMethod]
+	if !ok {
+		return Operation(fullMethod)
+	}
+	return op
+}
+
+type PodResolver interface {
+	ReadPod(key types.PodUniqueKey) (podstore.Pod, error)
+}
+
+type Labeler interface {
+	GetLabels(labelType labels.Type, id string) (labels.Labeled, error)
+}
+
+// Authorizer provides gRPC interceptors that authorize every call against a
+// policy
+type Authorizer struct {
+	policy        Policy
+	tokenVerifier TokenVerifier
+	pods          PodResolver
+	labeler       Labeler
+	logger        logging.Logger
+}
+
+// NewAuthorizer returns an authorizer for the given policy. tokenVerifier may
+// be nil if bearer tokens aren't accepted. pods and labeler are used to find
+// the pod a method operates on, for bindings restricted to some pods.
+func NewAuthorizer(policy Policy, tokenVerifier TokenVerifier, pods PodResolver, labeler Labeler, logger logging.Logger) *Authorizer {
+	return &Authorizer{
+		policy:        policy,
+		tokenVerifier: tokenVerifier,
+		pods:          pods,
+		labeler:       labeler,
+		logger:        logger,
+	}
+}
+
+func (a *Authorizer) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	err := a.authorize(ctx, info.FullMethod, req)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamInterceptor authorizes streaming calls once their request has been
+// received, since the request determines the pod they operate on
+func (a *Authorizer) StreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &authorizingStream{
+		ServerStream: ss,
+		authorizer:   a,
+		method:       info.FullMethod,
+	})
+}
+
+func (a *Authorizer) authorize(ctx context.Context, method string, req interface{}) error {
+	identity, err := identify(ctx, a.tokenVerifier)
+	if err != nil {
+		return err
+	}
+
+	op := MethodOperation(method)
+	err = a.policy.Authorize(identity, op, a.resource(req))
+	if err != nil {
+		a.logger.WithErrorAndFields(err, logrus.Fields{
+			"method":     method,
+			"identities": identity.Names,
+		}).Warnln("Denied API call")
+		return grpc.Errorf(codes.PermissionDenied, "%s", err)
+	}
+	return nil
+}
+
+// resource returns the pod a request operates on. If the pod can't be
+// determined, an empty resource is returned so that only bindings that apply
+// to all pods can authorize the request.
+func (a *Authorizer) resource(req interface{}) Resource {
+	var podID types.PodID
+	var node types.NodeName
+
+	switch req := req.(type) {
+	case *podstore_protos.SchedulePodRequest:
+		man, err := manifest.FromBytes([]byte(req.GetManifest()))
+		if err != nil {
+			// the method will reject the request itself
+			return Resource{}
+		}
+		podID = man.ID()
+		node = types.NodeName(req.GetNodeName())
+	case interface {
+		GetPodUniqueKey() string
+	}:
+		key, err := types.ToPodUniqueKey(req.GetPodUniqueKey())
+		if err != nil {
+			return Resource{}
+		}
+		pod, err := a.pods.ReadPod(key)
+		if err != nil {
+			a.logger.WithError(err).WithField("pod_unique_key", key).Debugln("Could not read pod to authorize request")
+			return Resource{}
+		}
+		podID = pod.Manifest.ID()
+		node = pod.Node
+	default:
+		return Resource{}
+	}
+
+	resource := Resource{PodID: podID}
+	if node != "" {
+		labeled, err := a.labeler.GetLabels(labels.POD, labels.MakePodLabelKey(node, podID))
+		if err != nil {
+			a.logger.WithError(err).WithField("pod_id", podID).Debugln("Could not read pod labels to authorize request")
+		} else {
+			resource.Labels = labeled.Labels
+		}
+	}
+	return resource
+}
+
+type authorizingStream struct {
+	grpc.ServerStream
+
+	authorizer *Authorizer
+	method     string
+	authorized bool
+}
+
+func (s *authorizingStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err != nil {
+		return err
+	}
+	if !s.authorized {
+		err = s.authorizer.authorize(s.Context(), s.method, m)
+		if err != nil {
+			return err
+		}
+		s.authorized = true
+	}
+	return nil
+}
+
+func (s *authorizingStream) SendMsg(m interface{}) error {
+	if !s.authorized {
+		// nothing may be sent before the request has been authorized
+		err := s.authorizer.authorize(s.Context(), s.method, nil)
+		if err != nil {
+			return err
+		}
+		s.authorized = true
+	}
+	return s.ServerStream.SendMsg(m)
+}
@@ -0,0 +1,114 @@
+package authz
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	podstore_protos "github.com/square/p2/pkg/grpc/podstore/protos"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/podstore"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	context "golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+type fakePodResolver map[types.PodUniqueKey]podstore.Pod
+
+func (f fakePodResolver) ReadPod(key types.PodUniqueKey) (podstore.Pod, error) {
+	pod, ok := f[key]
+	if !ok {
+		return podstore.Pod{}, util.Errorf("no pod %s", key)
+	}
+	return pod, nil
+}
+
+type fakeTokenVerifier map[string][]string
+
+func (f fakeTokenVerifier) Verify(token string) ([]string, error) {
+	names, ok := f[token]
+	if !ok {
+		return nil, util.Errorf("bad token")
+	}
+	return names, nil
+}
+
+func certContext(commonName string) context.Context {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+	return peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{cert}},
+		}},
+	})
+}
+
+func tokenContext(token string) context.Context {
+	return metadata.NewContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+}
+
+func TestUnaryInterceptor(t *testing.T) {
+	builder := manifest.NewBuilder()
+	builder.SetID("web")
+	webManifest := builder.GetManifest()
+	manifestBytes, err := webManifest.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := types.NewPodUUID()
+	pods := fakePodResolver{key: {Manifest: webManifest, Node: "node1"}}
+	labeler := labels.NewFakeApplicator()
+	err = labeler.SetLabel(labels.POD, labels.MakePodLabelKey("node1", "web"), "team", "frontend")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := testPolicy(t,
+		Binding{Identities: []string{"deploy-bot"}, Role: RoleDeployer, PodSelector: "team=frontend"},
+		Binding{Identities: []string{"group:oncall"}, Role: RoleAdmin, PodIDs: []types.PodID{"web"}},
+	)
+	authorizer := NewAuthorizer(policy, fakeTokenVerifier{"oncall-token": {"carol", "group:oncall"}}, pods, labeler, logging.TestLogger())
+
+	handled := false
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		handled = true
+		return nil, nil
+	}
+	call := func(ctx context.Context, method string, req interface{}) codes.Code {
+		handled = false
+		_, err := authorizer.UnaryInterceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		if err == nil && !handled {
+			t.Errorf("Expected %s to be handled once authorized", method)
+		}
+		return grpc.Code(err)
+	}
+
+	schedule := &podstore_protos.SchedulePodRequest{Manifest: string(manifestBytes), NodeName: "node1"}
+	if code := call(certContext("deploy-bot"), "/podstore.P2PodStore/SchedulePod", schedule); code != codes.OK {
+		t.Errorf("Expected deploy-bot to be allowed to schedule web, got %s", code)
+	}
+
+	unschedule := &podstore_protos.UnschedulePodRequest{PodUniqueKey: key.String()}
+	if code := call(certContext("deploy-bot"), "/podstore.P2PodStore/UnschedulePod", unschedule); code != codes.PermissionDenied {
+		t.Errorf("Expected deploy-bot not to be allowed to unschedule web, got %s", code)
+	}
+	if code := call(tokenContext("oncall-token"), "/podstore.P2PodStore/UnschedulePod", unschedule); code != codes.OK {
+		t.Errorf("Expected oncall to be allowed to unschedule web, got %s", code)
+	}
+
+	if code := call(tokenContext("stolen-token"), "/podstore.P2PodStore/UnschedulePod", unschedule); code != codes.Unauthenticated {
+		t.Errorf("Expected an invalid token to be unauthenticated, got %s", code)
+	}
+	if code := call(context.Background(), "/podstore.P2PodStore/ListPodStatus", &podstore_protos.ListPodStatusRequest{}); code != codes.Unauthenticated {
+		t.Errorf("Expected a call without credentials to be unauthenticated, got %s", code)
+	}
+}
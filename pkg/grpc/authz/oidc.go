@@ -0,0 +1,233 @@
+package authz
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// How long fetched signing keys are used before they're fetched again. Keys
+// are also refetched whenever a token is signed by an unknown key.
+const oidcKeysTTL = 1 * time.Hour
+
+// OIDCVerifier verifies ID tokens issued by an OpenID Connect provider. Only
+// RS256 signed tokens are accepted.
+type OIDCVerifier struct {
+	issuer   string
+	audience string
+	client   *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+
+	now func() time.Time
+}
+
+// NewOIDCVerifier returns a verifier for tokens issued by issuer for the
+// given audience, i.e. the client ID of the API server. The provider's
+// signing keys are discovered from its openid-configuration document.
+func NewOIDCVerifier(issuer string, audience string, client *http.Client) *OIDCVerifier {
+	return &OIDCVerifier{
+		issuer:   strings.TrimSuffix(issuer, "/"),
+		audience: audience,
+		client:   client,
+		now:      time.Now,
+	}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type idTokenClaims struct {
+	Issuer        string          `json:"iss"`
+	Subject       string          `json:"sub"`
+	Audience      json.RawMessage `json:"aud"`
+	Expiry        int64           `json:"exp"`
+	NotBefore     int64           `json:"nbf"`
+	Email         string          `json:"email"`
+	EmailVerified bool            `json:"email_verified"`
+	Groups        []string        `json:"groups"`
+}
+
+// Verify checks the token's signature, issuer, audience and validity period,
+// and returns its subject, verified email and groups, the latter prefixed by
+// "group:"
+func (v *OIDCVerifier) Verify(token string) ([]string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, util.Errorf("token is not a JWT")
+	}
+
+	var header jwtHeader
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return nil, util.Errorf("could not decode token header: %s", err)
+	}
+	if header.Alg != "RS256" {
+		return nil, util.Errorf("unsupported token signing algorithm %q", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, util.Errorf("could not decode token signature: %s", err)
+	}
+	key, err := v.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature)
+	if err != nil {
+		return nil, util.Errorf("invalid token signature")
+	}
+
+	var claims idTokenClaims
+	err = decodeSegment(parts[1], &claims)
+	if err != nil {
+		return nil, util.Errorf("could not decode token claims: %s", err)
+	}
+	if claims.Issuer != v.issuer {
+		return nil, util.Errorf("token was issued by %q rather than %q", claims.Issuer, v.issuer)
+	}
+	if !claims.hasAudience(v.audience) {
+		return nil, util.Errorf("token was not issued for %q", v.audience)
+	}
+	now := v.now().Unix()
+	if claims.Expiry == 0 || now >= claims.Expiry {
+		return nil, util.Errorf("token has expired")
+	}
+	if claims.NotBefore != 0 && now < claims.NotBefore {
+		return nil, util.Errorf("token is not valid yet")
+	}
+	if claims.Subject == "" {
+		return nil, util.Errorf("token has no subject")
+	}
+
+	names := []string{claims.Subject}
+	if claims.Email != "" && claims.EmailVerified {
+		names = append(names, claims.Email)
+	}
+	for _, group := range claims.Groups {
+		names = append(names, "group:"+group)
+	}
+	return names, nil
+}
+
+func (c idTokenClaims) hasAudience(audience string) bool {
+	var single string
+	if err := json.Unmarshal(c.Audience, &single); err == nil {
+		return single == audience
+	}
+	var multiple []string
+	if err := json.Unmarshal(c.Audience, &multiple); err == nil {
+		for _, aud := range multiple {
+			if aud == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, out interface{}) error {
+	bytes, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bytes, out)
+}
+
+// key returns the provider's signing key with the given ID, fetching the
+// provider's keys if they're stale or the key is unknown
+func (v *OIDCVerifier) key(kid string) (*rsa.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if key, ok := v.keys[kid]; ok && v.now().Sub(v.fetchedAt) < oidcKeysTTL {
+		return key, nil
+	}
+
+	keys, err := v.fetchKeys()
+	if err != nil {
+		return nil, util.Errorf("could not fetch OIDC signing keys: %s", err)
+	}
+	v.keys = keys
+	v.fetchedAt = v.now()
+
+	key, ok := v.keys[kid]
+	if !ok {
+		return nil, util.Errorf("token was signed by unknown key %q", kid)
+	}
+	return key, nil
+}
+
+func (v *OIDCVerifier) fetchKeys() (map[string]*rsa.PublicKey, error) {
+	var discovery struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	err := v.getJSON(v.issuer+"/.well-known/openid-configuration", &discovery)
+	if err != nil {
+		return nil, err
+	}
+	if discovery.JWKSURI == "" {
+		return nil, util.Errorf("openid-configuration of %s has no jwks_uri", v.issuer)
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	err = v.getJSON(discovery.JWKSURI, &jwks)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, util.Errorf("could not decode modulus of key %q: %s", jwk.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, util.Errorf("could not decode exponent of key %q: %s", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
+
+func (v *OIDCVerifier) getJSON(url string, out interface{}) error {
+	resp, err := v.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return util.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
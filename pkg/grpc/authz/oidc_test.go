@@ -0,0 +1,124 @@
+package authz
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type testProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Could not generate key: %s", err)
+	}
+	p := &testProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"jwks_uri": p.server.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	p.server = httptest.NewServer(mux)
+	return p
+}
+
+func (p *testProvider) sign(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	encode := func(v interface{}) string {
+		bytes, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(bytes)
+	}
+	signed := encode(map[string]string{"alg": "RS256", "kid": "test-key"}) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (p *testProvider) claims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":            p.server.URL,
+		"aud":            []string{"p2"},
+		"sub":            "alice",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"groups":         []string{"deployers"},
+	}
+}
+
+func TestOIDCVerify(t *testing.T) {
+	provider := newTestProvider(t)
+	defer provider.server.Close()
+	verifier := NewOIDCVerifier(provider.server.URL, "p2", http.DefaultClient)
+
+	names, err := verifier.Verify(provider.sign(t, provider.key, provider.claims()))
+	if err != nil {
+		t.Fatalf("Unexpected error verifying token: %s", err)
+	}
+	expected := []string{"alice", "alice@example.com", "group:deployers"}
+	if len(names) != len(expected) {
+		t.Fatalf("Expected names %v but got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Errorf("Expected names %v but got %v", expected, names)
+		}
+	}
+}
+
+func TestOIDCVerifyRejectsInvalidTokens(t *testing.T) {
+	provider := newTestProvider(t)
+	defer provider.server.Close()
+	verifier := NewOIDCVerifier(provider.server.URL, "p2", http.DefaultClient)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired := provider.claims()
+	expired["exp"] = time.Now().Add(-time.Minute).Unix()
+	wrongAudience := provider.claims()
+	wrongAudience["aud"] = "some-other-client"
+	wrongIssuer := provider.claims()
+	wrongIssuer["iss"] = "https://evil.example.com"
+
+	for desc, token := range map[string]string{
+		"expired":        provider.sign(t, provider.key, expired),
+		"wrong audience": provider.sign(t, provider.key, wrongAudience),
+		"wrong issuer":   provider.sign(t, provider.key, wrongIssuer),
+		"bad signature":  provider.sign(t, otherKey, provider.claims()),
+		"not a JWT":      "garbage",
+	} {
+		if _, err := verifier.Verify(token); err == nil {
+			t.Errorf("Expected an error verifying a token with %s", desc)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Package interceptors combines several gRPC server interceptors, since a
+// server accepts only one unary and one stream interceptor.
+package interceptors
+
+import (
+	context "golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// ServerOptions returns the options that install the given interceptors on a
+// gRPC server. Interceptors are run in the order given, so the first one is
+// the outermost.
+func ServerOptions(unary []grpc.UnaryServerInterceptor, stream []grpc.StreamServerInterceptor) []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if len(unary) > 0 {
+		opts = append(opts, grpc.UnaryInterceptor(ChainUnary(unary...)))
+	}
+	if len(stream) > 0 {
+		opts = append(opts, grpc.StreamInterceptor(ChainStream(stream...)))
+	}
+	return opts
+}
+
+// ChainUnary returns a unary interceptor that runs each of interceptors in
+// turn before the handler
+func ChainUnary(interceptors ...grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], handler
+			handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, next)
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// ChainStream returns a stream interceptor that runs each of interceptors in
+// turn before the handler
+func ChainStream(interceptors ...grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], handler
+			handler = func(srv interface{}, ss grpc.ServerStream) error {
+				return interceptor(srv, ss, info, next)
+			}
+		}
+		return handler(srv, ss)
+	}
+}
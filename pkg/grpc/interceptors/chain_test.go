@@ -0,0 +1,46 @@
+package interceptors
+
+import (
+	"reflect"
+	"testing"
+
+	context "golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+func TestChainUnaryOrder(t *testing.T) {
+	var calls []string
+	record := func(name string) grpc.UnaryServerInterceptor {
+		return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			calls = append(calls, name)
+			return handler(ctx, req)
+		}
+	}
+
+	chained := ChainUnary(record("outer"), record("inner"))
+	resp, err := chained(context.Background(), "req", &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls = append(calls, "handler")
+		return req, nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if resp != "req" {
+		t.Errorf("Expected the handler's response to be returned, got %v", resp)
+	}
+
+	expected := []string{"outer", "inner", "handler"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected calls %v but got %v", expected, calls)
+	}
+
+	// the chain must be reusable
+	calls = nil
+	_, _ = chained(context.Background(), "req", &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls = append(calls, "handler")
+		return nil, nil
+	})
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected calls %v on reuse but got %v", expected, calls)
+	}
+}
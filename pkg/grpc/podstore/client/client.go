@@ -8,7 +8,7 @@ import (
 	podstore_protos "github.com/square/p2/pkg/grpc/podstore/protos"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
-	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/statusstore"
 	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
@@ -31,14 +31,23 @@ func New(conn *grpc.ClientConn, logger logging.Logger) (Client, error) {
 
 // matches podstore.consulStore signature so no context.Context argument
 func (c Client) Schedule(manifest manifest.Manifest, node types.NodeName) (types.PodUniqueKey, error) {
+	return c.ScheduleWithIdempotencyKey(manifest, node, "")
+}
+
+// ScheduleWithIdempotencyKey is like Schedule, but if a request with the same
+// idempotency key was already made, the pod it scheduled is returned instead
+// of scheduling another. Callers should generate one key per deployment and
+// reuse it when retrying.
+func (c Client) ScheduleWithIdempotencyKey(manifest manifest.Manifest, node types.NodeName, idempotencyKey string) (types.PodUniqueKey, error) {
 	manifestBytes, err := manifest.Marshal()
 	if err != nil {
 		return "", util.Errorf("Could not marshal manifest: %s", err)
 	}
 
 	req := &podstore_protos.SchedulePodRequest{
-		NodeName: node.String(),
-		Manifest: string(manifestBytes),
+		NodeName:       node.String(),
+		Manifest:       string(manifestBytes),
+		IdempotencyKey: idempotencyKey,
 	}
 
 	resp, err := c.client.SchedulePod(context.Background(), req)
@@ -66,7 +75,7 @@ func (c Client) WatchStatus(ctx context.Context, podUniqueKey types.PodUniqueKey
 
 	stream, err := c.client.WatchPodStatus(innerCtx, &podstore_protos.WatchPodStatusRequest{
 		PodUniqueKey:    podUniqueKey.String(),
-		StatusNamespace: consul.PreparerPodStatusNamespace.String(),
+		StatusNamespace: statusstore.PreparerPodStatusNamespace.String(),
 		WaitForExists:   waitForExists,
 	})
 	if err != nil {
@@ -101,7 +110,7 @@ func (c Client) WatchStatus(ctx context.Context, podUniqueKey types.PodUniqueKey
 
 					stream, err = c.client.WatchPodStatus(innerCtx, &podstore_protos.WatchPodStatusRequest{
 						PodUniqueKey:    podUniqueKey.String(),
-						StatusNamespace: consul.PreparerPodStatusNamespace.String(),
+						StatusNamespace: statusstore.PreparerPodStatusNamespace.String(),
 						WaitForExists:   waitForExists,
 					}, grpc.FailFast(false))
 					if err != nil {
@@ -136,7 +145,7 @@ func (c Client) ListPodStatus(ctx context.Context) (map[types.PodUniqueKey]podst
 		// TODO: the whole podstatus.PodStatus type is coupled to the preparer's notion
 		// of pod status, so we ought to just make this namespace a constant in the
 		// pod status store
-		StatusNamespace: consul.PreparerPodStatusNamespace.String(),
+		StatusNamespace: statusstore.PreparerPodStatusNamespace.String(),
 	})
 	if err != nil {
 		return nil, err
@@ -1,15 +1,17 @@
 package podstore
 
 import (
+	"crypto/sha256"
+	"fmt"
 	"time"
 
 	podstore_protos "github.com/square/p2/pkg/grpc/podstore/protos"
 	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/manifest"
-	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/podstore"
 	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/idempotencystatus"
 	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
 	"github.com/square/p2/pkg/store/consul/transaction"
 	"github.com/square/p2/pkg/types"
@@ -20,10 +22,15 @@ import (
 	"google.golang.org/grpc/codes"
 )
 
+// DefaultIdempotencyTTL is how long idempotency keys are honored by default
+const DefaultIdempotencyTTL = 24 * time.Hour
+
 type store struct {
-	scheduler      Scheduler
-	podStatusStore PodStatusStore
-	consulClient   consulutil.ConsulClient
+	scheduler        Scheduler
+	podStatusStore   PodStatusStore
+	idempotencyStore IdempotencyStore
+	idempotencyTTL   time.Duration
+	consulClient     consulutil.ConsulClient
 }
 
 var _ podstore_protos.P2PodStoreServer = store{}
@@ -41,15 +48,27 @@ type PodStatusStore interface {
 	MutateStatus(ctx context.Context, key types.PodUniqueKey, mutator func(podstatus.PodStatus) (podstatus.PodStatus, error)) error
 }
 
-func NewServer(scheduler Scheduler, podStatusStore PodStatusStore, consulClient consulutil.ConsulClient) store {
+type IdempotencyStore interface {
+	Get(key idempotencystatus.Key) (idempotencystatus.Status, *api.QueryMeta, error)
+	Set(key idempotencystatus.Key, status idempotencystatus.Status) error
+	CASTxn(ctx context.Context, key idempotencystatus.Key, modifyIndex uint64, status idempotencystatus.Status) error
+	Delete(key idempotencystatus.Key) error
+}
+
+// NewServer returns a pod store server. Idempotency keys supplied to
+// SchedulePod are recorded in idempotencyStore and honored for
+// idempotencyTTL.
+func NewServer(scheduler Scheduler, podStatusStore PodStatusStore, idempotencyStore IdempotencyStore, idempotencyTTL time.Duration, consulClient consulutil.ConsulClient) store {
 	return store{
-		scheduler:      scheduler,
-		podStatusStore: podStatusStore,
-		consulClient:   consulClient,
+		scheduler:        scheduler,
+		podStatusStore:   podStatusStore,
+		idempotencyStore: idempotencyStore,
+		idempotencyTTL:   idempotencyTTL,
+		consulClient:     consulClient,
 	}
 }
 
-func (s store) SchedulePod(_ context.Context, req *podstore_protos.SchedulePodRequest) (*podstore_protos.SchedulePodResponse, error) {
+func (s store) SchedulePod(ctx context.Context, req *podstore_protos.SchedulePodRequest) (*podstore_protos.SchedulePodResponse, error) {
 	if req.NodeName == "" {
 		return nil, grpc.Errorf(codes.InvalidArgument, "node_name must be provided")
 	}
@@ -63,6 +82,10 @@ func (s store) SchedulePod(_ context.Context, req *podstore_protos.SchedulePodRe
 		return nil, grpc.Errorf(codes.InvalidArgument, "could not parse passed manifest: %s", err)
 	}
 
+	if req.IdempotencyKey != "" {
+		return s.scheduleIdempotently(ctx, idempotencystatus.Key(req.IdempotencyKey), manifest, types.NodeName(req.NodeName))
+	}
+
 	podUniqueKey, err := s.scheduler.Schedule(manifest, types.NodeName(req.NodeName))
 	if err != nil {
 		return nil, grpc.Errorf(codes.Unavailable, "could not schedule pod: %s", err)
@@ -74,6 +97,92 @@ func (s store) SchedulePod(_ context.Context, req *podstore_protos.SchedulePodRe
 	return resp, nil
 }
 
+// scheduleIdempotently schedules a pod unless the idempotency key was already
+// used, in which case the pod scheduled by the first request with the key is
+// returned. The key is claimed before the pod is scheduled so that concurrent
+// retries can't both schedule a pod.
+func (s store) scheduleIdempotently(ctx context.Context, key idempotencystatus.Key, manifest manifest.Manifest, node types.NodeName) (*podstore_protos.SchedulePodResponse, error) {
+	err := idempotencystatus.ValidateKey(key)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "%s", err)
+	}
+
+	requestHash, err := scheduleRequestHash(manifest, node)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "could not hash manifest: %s", err)
+	}
+
+	status, queryMeta, err := s.idempotencyStore.Get(key)
+	var modifyIndex uint64
+	switch {
+	case statusstore.IsNoStatus(err):
+		// a modify index of 0 only claims the key if nobody else has
+		modifyIndex = 0
+	case err != nil:
+		return nil, grpc.Errorf(codes.Unavailable, "could not read idempotency key %q: %s", key, err)
+	case status.Expired(time.Now(), s.idempotencyTTL):
+		modifyIndex = queryMeta.LastIndex
+	case status.RequestHash != requestHash:
+		return nil, grpc.Errorf(codes.InvalidArgument, "idempotency key %q was already used for a different request", key)
+	case status.InProgress():
+		return nil, grpc.Errorf(codes.Aborted, "a request with idempotency key %q is still in progress", key)
+	default:
+		return &podstore_protos.SchedulePodResponse{
+			PodUniqueKey: status.PodUniqueKey.String(),
+		}, nil
+	}
+
+	claim := idempotencystatus.Status{
+		RequestHash: requestHash,
+		Created:     time.Now(),
+	}
+	trxctx, cancelFunc := transaction.New(ctx)
+	defer cancelFunc()
+	err = s.idempotencyStore.CASTxn(trxctx, key, modifyIndex, claim)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "failed to construct a consul transaction to claim idempotency key %q: %s", key, err)
+	}
+	ok, _, err := transaction.Commit(trxctx, s.consulClient.KV())
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "could not claim idempotency key %q: %s", key, err)
+	}
+	if !ok {
+		// another request claimed the key since we read it
+		return nil, grpc.Errorf(codes.Aborted, "a request with idempotency key %q is still in progress", key)
+	}
+
+	podUniqueKey, err := s.scheduler.Schedule(manifest, node)
+	if err != nil {
+		// release the key so the request can be retried
+		deleteErr := s.idempotencyStore.Delete(key)
+		if deleteErr != nil {
+			return nil, grpc.Errorf(codes.Unavailable, "could not schedule pod: %s (and could not release idempotency key %q: %s)", err, key, deleteErr)
+		}
+		return nil, grpc.Errorf(codes.Unavailable, "could not schedule pod: %s", err)
+	}
+
+	// If this fails the pod was still scheduled, so success is reported.
+	// Retries will be told the request is in progress until the key
+	// expires, which is preferable to scheduling a duplicate pod.
+	claim.PodUniqueKey = podUniqueKey
+	_ = s.idempotencyStore.Set(key, claim)
+
+	return &podstore_protos.SchedulePodResponse{
+		PodUniqueKey: podUniqueKey.String(),
+	}, nil
+}
+
+// scheduleRequestHash identifies a SchedulePod request by the SHA of its
+// manifest and its node, so that semantically identical retries match even
+// if the manifest was serialized differently
+func scheduleRequestHash(manifest manifest.Manifest, node types.NodeName) (string, error) {
+	manifestSHA, err := manifest.SHA()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(manifestSHA+"/"+node.String()))), nil
+}
+
 func (s store) UnschedulePod(_ context.Context, req *podstore_protos.UnschedulePodRequest) (*podstore_protos.UnschedulePodResponse, error) {
 	podUniqueKeyStr := req.GetPodUniqueKey()
 	if podUniqueKeyStr == "" {
@@ -103,9 +212,9 @@ type podStatusResult struct {
 }
 
 func (s store) WatchPodStatus(req *podstore_protos.WatchPodStatusRequest, stream podstore_protos.P2PodStore_WatchPodStatusServer) error {
-	if req.StatusNamespace != consul.PreparerPodStatusNamespace.String() {
+	if req.StatusNamespace != statusstore.PreparerPodStatusNamespace.String() {
 		// Today this is the only namespace so we just make sure it doesn't diverge from expected
-		return grpc.Errorf(codes.InvalidArgument, "%q is not an understood namespace, must be %q", req.StatusNamespace, consul.PreparerPodStatusNamespace)
+		return grpc.Errorf(codes.InvalidArgument, "%q is not an understood namespace, must be %q", req.StatusNamespace, statusstore.PreparerPodStatusNamespace)
 	}
 
 	podUniqueKey, err := types.ToPodUniqueKey(req.PodUniqueKey)
@@ -202,9 +311,9 @@ func (s store) WatchPodStatus(req *podstore_protos.WatchPodStatusRequest, stream
 }
 
 func (s store) ListPodStatus(_ context.Context, req *podstore_protos.ListPodStatusRequest) (*podstore_protos.ListPodStatusResponse, error) {
-	if req.StatusNamespace != consul.PreparerPodStatusNamespace.String() {
+	if req.StatusNamespace != statusstore.PreparerPodStatusNamespace.String() {
 		// Today this is the only namespace so we just make sure it doesn't diverge from expected
-		return nil, grpc.Errorf(codes.InvalidArgument, "%q is not an understood namespace, must be %q", req.StatusNamespace, consul.PreparerPodStatusNamespace)
+		return nil, grpc.Errorf(codes.InvalidArgument, "%q is not an understood namespace, must be %q", req.StatusNamespace, statusstore.PreparerPodStatusNamespace)
 	}
 
 	statusMap, err := s.podStatusStore.List()
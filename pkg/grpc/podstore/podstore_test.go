@@ -8,11 +8,11 @@ import (
 	"github.com/square/p2/pkg/grpc/testutil"
 	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/manifest"
-	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/podstore"
 	"github.com/square/p2/pkg/store/consul/podstore/podstoretest"
 	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/idempotencystatus"
 	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
 	"github.com/square/p2/pkg/store/consul/statusstore/statusstoretest"
 	"github.com/square/p2/pkg/types"
@@ -126,6 +126,58 @@ func TestUnschedulePodNotFound(t *testing.T) {
 	}
 }
 
+func TestSchedulePodIdempotencyKey(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+	podStore := podstore.NewConsul(fixture.Client.KV())
+	idempotencyStore := idempotencystatus.NewConsul(statusstore.NewConsul(fixture.Client), statusstore.SchedulePodIdempotencyNamespace)
+	server := NewServer(podStore, nil, idempotencyStore, DefaultIdempotencyTTL, fixture.Client)
+
+	req := &podstore_protos.SchedulePodRequest{
+		Manifest:       validManifestString(),
+		NodeName:       "test_node",
+		IdempotencyKey: "deploy-1",
+	}
+	first, err := server.SchedulePod(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Unexpected error from SchedulePod: %s", err)
+	}
+
+	retry, err := server.SchedulePod(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Unexpected error retrying SchedulePod: %s", err)
+	}
+	if retry.PodUniqueKey != first.PodUniqueKey {
+		t.Errorf("Expected retry to return pod %s but it scheduled %s", first.PodUniqueKey, retry.PodUniqueKey)
+	}
+
+	pods, _, err := fixture.Client.KV().List(podstore.PodTree+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods) != 1 {
+		t.Errorf("Expected one pod to be scheduled but there were %d", len(pods))
+	}
+
+	// reusing the key for another node is a client bug
+	req.NodeName = "other_node"
+	_, err = server.SchedulePod(context.Background(), req)
+	if grpc.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected %s reusing an idempotency key for a different request, got %v", codes.InvalidArgument, err)
+	}
+
+	// keys are honored only for the TTL
+	server.idempotencyTTL = 0
+	req.NodeName = "test_node"
+	expired, err := server.SchedulePod(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Unexpected error from SchedulePod after the key expired: %s", err)
+	}
+	if expired.PodUniqueKey == first.PodUniqueKey {
+		t.Error("Expected a new pod to be scheduled once the idempotency key expired")
+	}
+}
+
 func TestUnscheduleError(t *testing.T) {
 	// Create a server with a failing pod store so we can test what happens when
 	// a failure is encountered
@@ -184,7 +236,7 @@ func TestWatchPodStatus(t *testing.T) {
 
 	podUniqueKey := types.NewPodUUID()
 	req := &podstore_protos.WatchPodStatusRequest{
-		StatusNamespace: consul.PreparerPodStatusNamespace.String(),
+		StatusNamespace: statusstore.PreparerPodStatusNamespace.String(),
 		PodUniqueKey:    podUniqueKey.String(),
 		WaitForExists:   true,
 	}
@@ -279,7 +331,7 @@ func TestWatchPodStatus(t *testing.T) {
 func TestListPodStatus(t *testing.T) {
 	statusStore, server := setupServerWithFakePodStatusStore()
 	results, err := server.ListPodStatus(context.Background(), &podstore_protos.ListPodStatusRequest{
-		StatusNamespace: consul.PreparerPodStatusNamespace.String(),
+		StatusNamespace: statusstore.PreparerPodStatusNamespace.String(),
 	})
 	if err != nil {
 		t.Errorf("error listing pod status: %s", err)
@@ -298,7 +350,7 @@ func TestListPodStatus(t *testing.T) {
 	}
 
 	results, err = server.ListPodStatus(context.Background(), &podstore_protos.ListPodStatusRequest{
-		StatusNamespace: consul.PreparerPodStatusNamespace.String(),
+		StatusNamespace: statusstore.PreparerPodStatusNamespace.String(),
 	})
 	if err != nil {
 		t.Errorf("error listing pod status: %s", err)
@@ -330,7 +382,7 @@ func TestDeletePodStatus(t *testing.T) {
 
 	// confirm that there is one entry
 	results, err := server.ListPodStatus(context.Background(), &podstore_protos.ListPodStatusRequest{
-		StatusNamespace: consul.PreparerPodStatusNamespace.String(),
+		StatusNamespace: statusstore.PreparerPodStatusNamespace.String(),
 	})
 	if err != nil {
 		t.Errorf("error listing pod status: %s", err)
@@ -350,7 +402,7 @@ func TestDeletePodStatus(t *testing.T) {
 
 	// confirm that there are now no entries
 	results, err = server.ListPodStatus(context.Background(), &podstore_protos.ListPodStatusRequest{
-		StatusNamespace: consul.PreparerPodStatusNamespace.String(),
+		StatusNamespace: statusstore.PreparerPodStatusNamespace.String(),
 	})
 	if err != nil {
 		t.Errorf("error listing pod status: %s", err)
@@ -427,7 +479,7 @@ func TestPodStatusResposeToPodStatus(t *testing.T) {
 func TestMarkPodFailed(t *testing.T) {
 	fixture := consulutil.NewFixture(t)
 	defer fixture.Stop()
-	statusStore := podstatus.NewConsul(statusstore.NewConsul(fixture.Client), consul.PreparerPodStatusNamespace)
+	statusStore := podstatus.NewConsul(statusstore.NewConsul(fixture.Client), statusstore.PreparerPodStatusNamespace)
 	server := store{
 		podStatusStore: statusStore,
 		consulClient:   fixture.Client,
@@ -451,7 +503,7 @@ func TestMarkPodFailed(t *testing.T) {
 
 	// confirm that the record is now failed
 	resp, err := server.ListPodStatus(context.Background(), &podstore_protos.ListPodStatusRequest{
-		StatusNamespace: consul.PreparerPodStatusNamespace.String(),
+		StatusNamespace: statusstore.PreparerPodStatusNamespace.String(),
 	})
 	if err != nil {
 		t.Fatalf("could not list pod status to confirm marking pod as failed: %s", err)
@@ -483,7 +535,7 @@ type testPodStatusStore interface {
 }
 
 func setupServerWithFakePodStatusStore() (testPodStatusStore, store) {
-	fakePodStatusStore := podstatus.NewConsul(statusstoretest.NewFake(), consul.PreparerPodStatusNamespace)
+	fakePodStatusStore := podstatus.NewConsul(statusstoretest.NewFake(), statusstore.PreparerPodStatusNamespace)
 	return fakePodStatusStore, store{
 		podStatusStore: fakePodStatusStore,
 	}
@@ -47,8 +47,9 @@ var _ = math.Inf
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
 type SchedulePodRequest struct {
-	Manifest string `protobuf:"bytes,1,opt,name=manifest" json:"manifest,omitempty"`
-	NodeName string `protobuf:"bytes,2,opt,name=node_name,json=nodeName" json:"node_name,omitempty"`
+	Manifest       string `protobuf:"bytes,1,opt,name=manifest" json:"manifest,omitempty"`
+	NodeName       string `protobuf:"bytes,2,opt,name=node_name,json=nodeName" json:"node_name,omitempty"`
+	IdempotencyKey string `protobuf:"bytes,3,opt,name=idempotency_key,json=idempotencyKey" json:"idempotency_key,omitempty"`
 }
 
 func (m *SchedulePodRequest) Reset()                    { *m = SchedulePodRequest{} }
@@ -70,6 +71,13 @@ func (m *SchedulePodRequest) GetNodeName() string {
 	return ""
 }
 
+func (m *SchedulePodRequest) GetIdempotencyKey() string {
+	if m != nil {
+		return m.IdempotencyKey
+	}
+	return ""
+}
+
 type SchedulePodResponse struct {
 	PodUniqueKey string `protobuf:"bytes,1,opt,name=pod_unique_key,json=podUniqueKey" json:"pod_unique_key,omitempty"`
 }
@@ -605,48 +613,48 @@ var _P2PodStore_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("pkg/grpc/podstore/protos/podstore.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 675 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x9c, 0x55, 0x4d, 0x6f, 0xd3, 0x4a,
-	0x14, 0x8d, 0x9b, 0xbe, 0xa7, 0xf4, 0xa6, 0x69, 0xf2, 0xe6, 0xa5, 0x34, 0xa4, 0x40, 0xc3, 0x80,
-	0xa0, 0x6c, 0xfa, 0x11, 0x36, 0x08, 0x2a, 0x24, 0x3e, 0x5a, 0x09, 0xd1, 0x56, 0x91, 0x4b, 0x05,
-	0x12, 0x0b, 0x6b, 0x6a, 0xdf, 0xb6, 0x56, 0x1d, 0xcf, 0xd4, 0x33, 0x86, 0x76, 0xcf, 0x82, 0x25,
-	0x7f, 0x8b, 0x7f, 0x85, 0x66, 0xec, 0xd8, 0x4e, 0xe2, 0x96, 0xc2, 0x2e, 0xf7, 0xdc, 0x8f, 0x39,
-	0x73, 0xee, 0xc9, 0x18, 0x1e, 0x8b, 0xb3, 0x93, 0xf5, 0x93, 0x48, 0xb8, 0xeb, 0x82, 0x7b, 0x52,
-	0xf1, 0x08, 0xd7, 0x45, 0xc4, 0x15, 0x97, 0x59, 0xbc, 0x66, 0x62, 0x52, 0x1b, 0xc5, 0x74, 0x0f,
-	0xc8, 0x81, 0x7b, 0x8a, 0x5e, 0x1c, 0xe0, 0x80, 0x7b, 0x36, 0x9e, 0xc7, 0x28, 0x15, 0xe9, 0x42,
-	0x6d, 0xc8, 0x42, 0xff, 0x18, 0xa5, 0xea, 0x58, 0x3d, 0x6b, 0x75, 0xce, 0xce, 0x62, 0xb2, 0x0c,
-	0x73, 0x21, 0xf7, 0xd0, 0x09, 0xd9, 0x10, 0x3b, 0x33, 0x49, 0x52, 0x03, 0xfb, 0x6c, 0x88, 0xf4,
-	0x05, 0xfc, 0x3f, 0x36, 0x4e, 0x0a, 0x1e, 0x4a, 0x24, 0x0f, 0x61, 0x41, 0x70, 0xcf, 0x89, 0x43,
-	0xff, 0x3c, 0x46, 0xe7, 0x0c, 0x2f, 0xd3, 0xa9, 0xf3, 0x82, 0x7b, 0x87, 0x06, 0x7c, 0x8f, 0x97,
-	0xf4, 0x87, 0x05, 0x8b, 0x1f, 0x99, 0x72, 0x4f, 0x07, 0xdc, 0x3b, 0x50, 0x4c, 0xc5, 0x72, 0xc4,
-	0xe7, 0x46, 0xfd, 0xe4, 0x09, 0xb4, 0xa4, 0x69, 0x33, 0xdc, 0xa4, 0x60, 0x2e, 0x76, 0xaa, 0xa6,
-	0xae, 0x99, 0xe0, 0xfb, 0x23, 0x98, 0x3c, 0x82, 0xe6, 0x57, 0xe6, 0x2b, 0xe7, 0x98, 0x47, 0x0e,
-	0x5e, 0xf8, 0x52, 0xc9, 0xce, 0x6c, 0xcf, 0x5a, 0xad, 0xd9, 0x0d, 0x0d, 0xef, 0xf0, 0x68, 0xdb,
-	0x80, 0x9a, 0xd2, 0x7f, 0x05, 0x36, 0xe9, 0x75, 0x7e, 0x23, 0x8f, 0xa6, 0xaa, 0x0f, 0xcc, 0xe4,
-	0x11, 0xc9, 0x04, 0x24, 0xaf, 0xa1, 0x25, 0x22, 0xee, 0xa2, 0x94, 0x4e, 0xc2, 0x08, 0x65, 0xa7,
-	0xda, 0xab, 0xae, 0xd6, 0xfb, 0x4b, 0x6b, 0xd9, 0x8a, 0x06, 0x49, 0x45, 0x7a, 0x66, 0x53, 0x14,
-	0x43, 0x94, 0xf4, 0xbb, 0x05, 0x8d, 0xb1, 0x12, 0xf2, 0x00, 0x1a, 0x01, 0x8b, 0x43, 0xf7, 0x94,
-	0x1d, 0x05, 0xe8, 0xf8, 0xde, 0x48, 0x9c, 0x1c, 0x7c, 0xe7, 0x91, 0x15, 0xa8, 0x63, 0xa8, 0xa2,
-	0x4b, 0x47, 0x70, 0x3f, 0x54, 0x29, 0x33, 0x30, 0xd0, 0x40, 0x23, 0x64, 0x13, 0xe6, 0x02, 0x26,
-	0x95, 0x96, 0x43, 0x19, 0xd9, 0xea, 0xfd, 0x76, 0x4e, 0x6a, 0xfb, 0xc2, 0x57, 0x29, 0xa3, 0x9a,
-	0x2e, 0xd3, 0x31, 0x3d, 0x01, 0xc8, 0x71, 0x7d, 0x73, 0xdd, 0xeb, 0x28, 0x7f, 0x88, 0x86, 0x42,
-	0xd5, 0xae, 0x69, 0xe0, 0x83, 0x3f, 0xc4, 0x2c, 0xe9, 0x72, 0x2f, 0x91, 0x25, 0x4d, 0xbe, 0xe1,
-	0x1e, 0x1a, 0x6e, 0x3a, 0x99, 0x68, 0x62, 0x0e, 0xaf, 0xda, 0x80, 0xd9, 0x68, 0xba, 0x05, 0xed,
-	0xc3, 0x50, 0x4e, 0xfb, 0xf4, 0x66, 0xbe, 0x5a, 0x82, 0xc5, 0x89, 0xee, 0x64, 0x8f, 0xf4, 0x15,
-	0xb4, 0x77, 0x7d, 0xa9, 0xa6, 0xec, 0x56, 0x66, 0x24, 0xab, 0xd4, 0x48, 0xf4, 0xa7, 0x05, 0x8b,
-	0x13, 0x33, 0x52, 0x93, 0x1c, 0xc0, 0xfc, 0xc8, 0x08, 0x66, 0xcf, 0x96, 0xd9, 0xf3, 0x46, 0x2e,
-	0x69, 0x69, 0xdb, 0x5a, 0x86, 0xa0, 0xdc, 0xd6, 0xcb, 0xb1, 0xeb, 0x22, 0x47, 0xba, 0x9f, 0xa1,
-	0x35, 0x59, 0x40, 0x5a, 0x50, 0xcd, 0x6f, 0xae, 0x7f, 0x92, 0x4d, 0xf8, 0xe7, 0x0b, 0x0b, 0xe2,
-	0x44, 0xe8, 0x7a, 0x7f, 0xb9, 0xe0, 0xad, 0xc9, 0xf3, 0xec, 0xa4, 0xf2, 0xf9, 0xcc, 0x33, 0x8b,
-	0xbe, 0x84, 0x5b, 0x6f, 0x31, 0x40, 0x85, 0x7f, 0xf7, 0xff, 0xa3, 0xb7, 0x61, 0x69, 0xaa, 0x3f,
-	0x55, 0x7a, 0x0b, 0xda, 0x7b, 0x2c, 0x3a, 0x1b, 0x70, 0x6f, 0x87, 0xf9, 0x01, 0xfe, 0xf9, 0x02,
-	0x27, 0xba, 0x93, 0xb1, 0xfd, 0x6f, 0xb3, 0x00, 0x83, 0xbe, 0x39, 0x8e, 0x47, 0x48, 0x76, 0xa1,
-	0x5e, 0x78, 0x7d, 0xc8, 0x9d, 0xfc, 0xde, 0xd3, 0x6f, 0x5c, 0xf7, 0xee, 0x15, 0xd9, 0x94, 0x71,
-	0x85, 0xd8, 0xb0, 0x30, 0xfe, 0x1a, 0x91, 0x95, 0xbc, 0xa5, 0xf4, 0x9d, 0xea, 0x5e, 0xa7, 0x34,
-	0xad, 0x6c, 0x58, 0xc4, 0x86, 0xc6, 0x98, 0x15, 0xc9, 0xbd, 0xbc, 0xa3, 0xcc, 0xe1, 0xdd, 0x95,
-	0x2b, 0xf3, 0x05, 0x9e, 0x8d, 0x31, 0x2b, 0x15, 0x67, 0x96, 0xd9, 0xbb, 0x38, 0xb3, 0xd4, 0x83,
-	0xb4, 0x42, 0x3e, 0x41, 0x73, 0x62, 0x95, 0xa4, 0x97, 0x77, 0x95, 0xbb, 0xa4, 0x7b, 0xff, 0x9a,
-	0x8a, 0x22, 0xdb, 0xb1, 0x5d, 0x16, 0xd9, 0x96, 0x59, 0xa4, 0xc8, 0xb6, 0xd4, 0x04, 0xb4, 0x72,
-	0xf4, 0xaf, 0xf9, 0xaa, 0x3d, 0xfd, 0x15, 0x00, 0x00, 0xff, 0xff, 0xde, 0x69, 0x60, 0xc2, 0x00,
-	0x07, 0x00, 0x00,
+	// 680 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x9d, 0x55, 0x4b, 0x6f, 0xd3, 0x40,
+	0x10, 0x8e, 0x9b, 0x82, 0x92, 0x49, 0xf3, 0x60, 0x49, 0x49, 0x48, 0x81, 0x14, 0x83, 0x68, 0xb9,
+	0x24, 0x25, 0x5c, 0x10, 0x20, 0x24, 0x1e, 0xad, 0x84, 0x28, 0x55, 0xe4, 0xb4, 0x02, 0x89, 0x83,
+	0xe5, 0xda, 0xd3, 0xc4, 0x8a, 0x63, 0x1b, 0xef, 0xa6, 0x90, 0x3b, 0x07, 0x8e, 0xfc, 0x2d, 0xfe,
+	0x15, 0xbb, 0x6b, 0xc7, 0x76, 0x12, 0xb7, 0x14, 0x6e, 0x9e, 0x6f, 0x5e, 0xdf, 0xcc, 0x7c, 0xd9,
+	0xc0, 0x8e, 0x3f, 0x1e, 0x76, 0x87, 0x81, 0x6f, 0x76, 0x7d, 0xcf, 0xa2, 0xcc, 0x0b, 0xb0, 0xeb,
+	0x07, 0x1e, 0xf3, 0x68, 0x6c, 0x77, 0xa4, 0x4d, 0x0a, 0x73, 0x5b, 0x3d, 0x07, 0x32, 0x30, 0x47,
+	0x68, 0x4d, 0x1d, 0xec, 0x7b, 0x96, 0x86, 0x5f, 0xa7, 0x48, 0x19, 0x69, 0x41, 0x61, 0x62, 0xb8,
+	0xf6, 0x19, 0xff, 0x6e, 0x2a, 0xdb, 0xca, 0x6e, 0x51, 0x8b, 0x6d, 0xb2, 0x05, 0x45, 0xd7, 0xb3,
+	0x50, 0x77, 0x8d, 0x09, 0x36, 0xd7, 0x42, 0xa7, 0x00, 0x8e, 0xb8, 0x4d, 0x76, 0xa0, 0x6a, 0x5b,
+	0x38, 0xf1, 0x3d, 0x86, 0xae, 0x39, 0xd3, 0xc7, 0x38, 0x6b, 0xe6, 0x65, 0x48, 0x25, 0x05, 0x7f,
+	0xc0, 0x99, 0xfa, 0x02, 0x6e, 0x2e, 0xf4, 0xa5, 0xbe, 0xe7, 0x52, 0x24, 0x0f, 0xa1, 0xc2, 0xa9,
+	0xe9, 0x53, 0xd7, 0xe6, 0x44, 0x64, 0x7a, 0xd8, 0x7e, 0x83, 0xa3, 0x27, 0x12, 0x14, 0xc9, 0xbf,
+	0x14, 0xd8, 0xfc, 0x64, 0x30, 0x73, 0xc4, 0x53, 0x07, 0xcc, 0x60, 0x53, 0x3a, 0x27, 0x7e, 0xa5,
+	0x7c, 0xf2, 0x18, 0x6a, 0x54, 0xa6, 0xc9, 0x21, 0xa8, 0x6f, 0x98, 0x18, 0xd1, 0xac, 0x86, 0xf8,
+	0xd1, 0x1c, 0x26, 0x8f, 0xa0, 0xfa, 0xcd, 0xb0, 0x99, 0x7e, 0xe6, 0x05, 0x3a, 0x7e, 0xb7, 0x29,
+	0xa3, 0xcd, 0x75, 0x1e, 0x59, 0xd0, 0xca, 0x02, 0x3e, 0xf0, 0x82, 0x7d, 0x09, 0x0a, 0x4a, 0x37,
+	0x52, 0x6c, 0xa2, 0x71, 0xfe, 0xb2, 0x47, 0x41, 0x55, 0x34, 0x8c, 0xf7, 0xe8, 0x87, 0x15, 0x90,
+	0xbc, 0x81, 0x1a, 0xbf, 0x94, 0x89, 0x94, 0xea, 0x21, 0x23, 0xa4, 0x9c, 0x61, 0x7e, 0xb7, 0xd4,
+	0x6b, 0x74, 0xe2, 0x5b, 0xf6, 0xc3, 0x88, 0xa8, 0x67, 0xd5, 0x4f, 0x9b, 0x48, 0xd5, 0x9f, 0x0a,
+	0x94, 0x17, 0x42, 0xc8, 0x03, 0x28, 0x3b, 0xc6, 0xd4, 0x35, 0x47, 0xc6, 0xa9, 0x83, 0xba, 0x6d,
+	0xcd, 0x97, 0x93, 0x80, 0xef, 0x2d, 0xd2, 0x86, 0x12, 0xba, 0x2c, 0x98, 0xe9, 0xbe, 0x67, 0xbb,
+	0x2c, 0x62, 0x06, 0x12, 0xea, 0x0b, 0x84, 0x3c, 0x81, 0xa2, 0x63, 0x50, 0x26, 0xd6, 0xc1, 0xe4,
+	0xda, 0x4a, 0xbd, 0x7a, 0x42, 0x8a, 0xef, 0x83, 0x45, 0x8c, 0x0a, 0x22, 0x4c, 0xd8, 0xea, 0x10,
+	0x20, 0xc1, 0xc5, 0xe4, 0x22, 0x57, 0x67, 0x36, 0x57, 0x90, 0xa0, 0x90, 0xd7, 0x0a, 0x02, 0x38,
+	0xe6, 0x76, 0xec, 0x34, 0xb9, 0xa4, 0x64, 0xf3, 0xc8, 0xf9, 0x96, 0xdb, 0x92, 0x9b, 0x70, 0x86,
+	0x3b, 0x91, 0xcd, 0xf3, 0x9c, 0x5b, 0x5c, 0x5a, 0x7d, 0x09, 0xf5, 0x13, 0x97, 0xae, 0x0a, 0xfa,
+	0x6a, 0xba, 0x6a, 0xc0, 0xe6, 0x52, 0x76, 0x78, 0x47, 0xf5, 0x35, 0xd4, 0x0f, 0xf9, 0x99, 0x57,
+	0xe4, 0x96, 0x25, 0x24, 0x25, 0x53, 0x48, 0xea, 0x6f, 0xae, 0xd9, 0xa5, 0x1a, 0x91, 0x48, 0x06,
+	0xb0, 0x31, 0x17, 0x82, 0xbc, 0xb3, 0x22, 0xef, 0xbc, 0x97, 0xac, 0x34, 0x33, 0xad, 0x13, 0x23,
+	0x48, 0xf7, 0xc5, 0x71, 0xb4, 0x92, 0x9f, 0x20, 0xad, 0x2f, 0x50, 0x5b, 0x0e, 0x20, 0x35, 0xc8,
+	0x27, 0x93, 0x8b, 0x4f, 0x7e, 0xca, 0x6b, 0xe7, 0x86, 0x33, 0x0d, 0x17, 0x5d, 0xea, 0x6d, 0xa5,
+	0xb4, 0xb5, 0xdc, 0x4f, 0x0b, 0x23, 0x9f, 0xaf, 0x3d, 0x53, 0xd4, 0x57, 0x70, 0xeb, 0x1d, 0x3a,
+	0xc8, 0xf0, 0xff, 0x7e, 0x7f, 0xea, 0x6d, 0x68, 0xac, 0xe4, 0x47, 0x9b, 0xe6, 0x07, 0xfc, 0x68,
+	0x04, 0x63, 0xee, 0x38, 0x30, 0x6c, 0x07, 0xff, 0xfd, 0x80, 0x4b, 0xd9, 0x61, 0xd9, 0xde, 0x8f,
+	0x75, 0x80, 0x7e, 0x4f, 0xb6, 0xe3, 0xd3, 0x91, 0x43, 0x28, 0xa5, 0x5e, 0x1f, 0x72, 0x27, 0x99,
+	0x7b, 0xf5, 0x31, 0x6c, 0xdd, 0xbd, 0xc0, 0x1b, 0x31, 0xce, 0x11, 0x0d, 0x2a, 0x8b, 0xaf, 0x11,
+	0x69, 0x27, 0x29, 0x99, 0xef, 0x54, 0xeb, 0xb2, 0x4d, 0xab, 0xb9, 0x3d, 0x85, 0xd7, 0x2c, 0x2f,
+	0x48, 0x91, 0xdc, 0x4b, 0x32, 0xb2, 0x14, 0xde, 0x6a, 0x5f, 0xe8, 0x4f, 0xf1, 0x2c, 0x2f, 0x48,
+	0x29, 0x5d, 0x33, 0x4b, 0xde, 0xe9, 0x9a, 0x99, 0x1a, 0xe4, 0x35, 0x3f, 0x43, 0x75, 0xe9, 0x94,
+	0x64, 0x3b, 0xc9, 0xca, 0x56, 0x49, 0xeb, 0xfe, 0x25, 0x11, 0x69, 0xb6, 0x0b, 0xb7, 0x4c, 0xb3,
+	0xcd, 0x92, 0x48, 0x9a, 0x6d, 0xa6, 0x08, 0xd4, 0xdc, 0xe9, 0x75, 0xf9, 0xf7, 0xf7, 0xf4, 0x0f,
+	0xca, 0x43, 0xa0, 0xc3, 0x29, 0x07, 0x00, 0x00,
 }
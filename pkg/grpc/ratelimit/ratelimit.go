@@ -0,0 +1,256 @@
+// Package ratelimit protects consul and the cluster from runaway API clients.
+// It limits the rate of calls per client and the rate at which each pod ID
+// may be scheduled, and caps the number of calls in flight per client and of
+// mutating calls in flight across all clients.
+//
+// The limits are per pod ID rather than per namespace, since p2 has no
+// namespaces. There is no quota on simultaneous rolls: rolling updates are
+// written to consul by rctl and run by the farms, not by any method of these
+// servers, so the servers never see a roll to count.
+package ratelimit
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/square/p2/pkg/grpc/authz"
+	podstore_protos "github.com/square/p2/pkg/grpc/podstore/protos"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/util"
+
+	context "golang.org/x/net/context"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// How often idle rate limiters are forgotten. Only limiters whose buckets
+// have refilled are forgotten, so that doing so doesn't loosen the limits.
+const limiterSweepInterval = 10 * time.Minute
+
+// Config configures the limits enforced by an API server. A zero value for
+// any field disables the corresponding limit. It is meant to be embedded in
+// the server's YAML config.
+type Config struct {
+	// ClientRequestsPerSecond is the sustained rate of calls allowed per
+	// client, and ClientBurst the number of calls a client may make at
+	// once after being idle
+	ClientRequestsPerSecond float64 `yaml:"client_requests_per_second"`
+	ClientBurst             int     `yaml:"client_burst"`
+
+	// PodSchedulesPerSecond is the sustained rate at which pods with the
+	// same pod ID may be scheduled, across all clients, and PodBurst the
+	// number that may be scheduled at once
+	PodSchedulesPerSecond float64 `yaml:"pod_schedules_per_second"`
+	PodBurst              int     `yaml:"pod_burst"`
+
+	// MaxConcurrentPerClient is the number of calls, including open
+	// watches, that a client may have in flight
+	MaxConcurrentPerClient int `yaml:"max_concurrent_per_client"`
+
+	// MaxConcurrentMutations is the number of calls that change the
+	// cluster, e.g. scheduling pods, that may be in flight across all
+	// clients
+	MaxConcurrentMutations int `yaml:"max_concurrent_mutations"`
+}
+
+func (c Config) validate() error {
+	if c.ClientRequestsPerSecond < 0 || c.PodSchedulesPerSecond < 0 || c.MaxConcurrentPerClient < 0 || c.MaxConcurrentMutations < 0 {
+		return util.Errorf("rate limits may not be negative")
+	}
+	if c.ClientRequestsPerSecond > 0 && c.ClientBurst < 1 {
+		return util.Errorf("client_burst must be at least 1 when client_requests_per_second is set")
+	}
+	if c.PodSchedulesPerSecond > 0 && c.PodBurst < 1 {
+		return util.Errorf("pod_burst must be at least 1 when pod_schedules_per_second is set")
+	}
+	return nil
+}
+
+// Limiter provides gRPC interceptors that enforce a Config
+type Limiter struct {
+	config Config
+
+	mu            sync.Mutex
+	clientLimits  *limiterSet
+	podLimits     *limiterSet
+	clientCalls   map[string]int
+	mutationCalls int
+}
+
+func New(config Config) (*Limiter, error) {
+	err := config.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Limiter{
+		config:       config,
+		clientLimits: newLimiterSet(rate.Limit(config.ClientRequestsPerSecond), config.ClientBurst),
+		podLimits:    newLimiterSet(rate.Limit(config.PodSchedulesPerSecond), config.PodBurst),
+		clientCalls:  make(map[string]int),
+	}, nil
+}
+
+func (l *Limiter) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	release, err := l.admit(ctx, info.FullMethod, req)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return handler(ctx, req)
+}
+
+// StreamInterceptor limits streaming calls. Their requests aren't inspected,
+// since none of the streaming methods schedule pods.
+func (l *Limiter) StreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	release, err := l.admit(ss.Context(), info.FullMethod, nil)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return handler(srv, ss)
+}
+
+// admit checks a call against every limit. If it's admitted, the returned
+// function must be called once the call completes.
+func (l *Limiter) admit(ctx context.Context, method string, req interface{}) (func(), error) {
+	client := clientID(ctx)
+	mutation := authz.MethodOperation(method) != authz.OperationRead
+	// parsing the manifest can be slow, so it's done before taking the lock
+	// that every call waits on
+	podID := scheduledPodID(req)
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.config.MaxConcurrentPerClient > 0 && l.clientCalls[client] >= l.config.MaxConcurrentPerClient {
+		return nil, grpc.Errorf(codes.ResourceExhausted, "%s already has %d calls in flight", client, l.clientCalls[client])
+	}
+	if mutation && l.config.MaxConcurrentMutations > 0 && l.mutationCalls >= l.config.MaxConcurrentMutations {
+		return nil, grpc.Errorf(codes.ResourceExhausted, "%d mutating calls are already in flight", l.mutationCalls)
+	}
+	if l.config.ClientRequestsPerSecond > 0 && !l.clientLimits.allow(client, now) {
+		return nil, grpc.Errorf(codes.ResourceExhausted, "%s exceeded %v calls per second", client, l.config.ClientRequestsPerSecond)
+	}
+	if podID != "" && l.config.PodSchedulesPerSecond > 0 && !l.podLimits.allow(podID, now) {
+		return nil, grpc.Errorf(codes.ResourceExhausted, "%s exceeded %v schedules per second", podID, l.config.PodSchedulesPerSecond)
+	}
+
+	l.clientCalls[client]++
+	if mutation {
+		l.mutationCalls++
+	}
+
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		l.clientCalls[client]--
+		if l.clientCalls[client] == 0 {
+			delete(l.clientCalls, client)
+		}
+		if mutation {
+			l.mutationCalls--
+		}
+	}, nil
+}
+
+// clientID identifies the caller by the common name of its verified client
+// certificate, or else by its address. Callers authenticating with bearer
+// tokens are thus limited per host.
+func clientID(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "unknown"
+	}
+
+	if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.VerifiedChains) > 0 && len(tlsInfo.State.VerifiedChains[0]) > 0 {
+		if cn := tlsInfo.State.VerifiedChains[0][0].Subject.CommonName; cn != "" {
+			return cn
+		}
+	}
+
+	if p.Addr == nil {
+		return "unknown"
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// scheduledPodID returns the pod ID scheduled by a request, or "" if the
+// request doesn't schedule a pod
+func scheduledPodID(req interface{}) string {
+	schedule, ok := req.(*podstore_protos.SchedulePodRequest)
+	if !ok {
+		return ""
+	}
+
+	man, err := manifest.FromBytes([]byte(schedule.GetManifest()))
+	if err != nil {
+		// the method will reject the request itself
+		return ""
+	}
+	return man.ID().String()
+}
+
+// limiterSet holds a rate limiter per key, forgetting those that have been
+// idle for a while
+type limiterSet struct {
+	limit rate.Limit
+	burst int
+
+	// how long a limiter must be idle for its bucket to refill
+	refill time.Duration
+
+	limiters  map[string]*idleLimiter
+	lastSweep time.Time
+}
+
+type idleLimiter struct {
+	*rate.Limiter
+	lastUsed time.Time
+}
+
+func newLimiterSet(limit rate.Limit, burst int) *limiterSet {
+	var refill time.Duration
+	if limit > 0 {
+		refill = time.Duration(float64(burst) / float64(limit) * float64(time.Second))
+	}
+	return &limiterSet{
+		limit:    limit,
+		burst:    burst,
+		refill:   refill,
+		limiters: make(map[string]*idleLimiter),
+	}
+}
+
+// allow returns whether a call for the given key is within the limit. The
+// caller must hold the Limiter's lock.
+func (s *limiterSet) allow(key string, now time.Time) bool {
+	if now.Sub(s.lastSweep) > limiterSweepInterval {
+		for k, limiter := range s.limiters {
+			if now.Sub(limiter.lastUsed) > s.refill {
+				delete(s.limiters, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	limiter, ok := s.limiters[key]
+	if !ok {
+		limiter = &idleLimiter{Limiter: rate.NewLimiter(s.limit, s.burst)}
+		s.limiters[key] = limiter
+	}
+	limiter.lastUsed = now
+	return limiter.AllowN(now, 1)
+}
@@ -0,0 +1,142 @@
+package ratelimit
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	podstore_protos "github.com/square/p2/pkg/grpc/podstore/protos"
+
+	context "golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	scheduleMethod = "/podstore.P2PodStore/SchedulePod"
+	listMethod     = "/podstore.P2PodStore/ListPodStatus"
+)
+
+func clientContext(ip string) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 12345},
+	})
+}
+
+func call(l *Limiter, ctx context.Context, method string, req interface{}) codes.Code {
+	_, err := l.UnaryInterceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: method}, func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	return grpc.Code(err)
+}
+
+func TestClientRateLimit(t *testing.T) {
+	limiter, err := New(Config{ClientRequestsPerSecond: 0.001, ClientBurst: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice := clientContext("10.0.0.1")
+	for i := 0; i < 2; i++ {
+		if code := call(limiter, alice, listMethod, nil); code != codes.OK {
+			t.Fatalf("Expected call %d within the burst to be allowed, got %s", i, code)
+		}
+	}
+	if code := call(limiter, alice, listMethod, nil); code != codes.ResourceExhausted {
+		t.Errorf("Expected a call over the limit to be rejected, got %s", code)
+	}
+
+	bob := clientContext("10.0.0.2")
+	if code := call(limiter, bob, listMethod, nil); code != codes.OK {
+		t.Errorf("Expected another client not to be limited, got %s", code)
+	}
+}
+
+func TestPodScheduleRateLimit(t *testing.T) {
+	limiter, err := New(Config{PodSchedulesPerSecond: 0.001, PodBurst: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	web := &podstore_protos.SchedulePodRequest{Manifest: "id: web", NodeName: "node1"}
+	if code := call(limiter, clientContext("10.0.0.1"), scheduleMethod, web); code != codes.OK {
+		t.Fatalf("Expected the first schedule of web to be allowed, got %s", code)
+	}
+	// the limit applies across clients
+	if code := call(limiter, clientContext("10.0.0.2"), scheduleMethod, web); code != codes.ResourceExhausted {
+		t.Errorf("Expected a second schedule of web to be rejected, got %s", code)
+	}
+
+	db := &podstore_protos.SchedulePodRequest{Manifest: "id: db", NodeName: "node1"}
+	if code := call(limiter, clientContext("10.0.0.1"), scheduleMethod, db); code != codes.OK {
+		t.Errorf("Expected another pod ID not to be limited, got %s", code)
+	}
+	if code := call(limiter, clientContext("10.0.0.1"), listMethod, nil); code != codes.OK {
+		t.Errorf("Expected calls that don't schedule pods not to be limited, got %s", code)
+	}
+}
+
+func TestConcurrencyQuotas(t *testing.T) {
+	limiter, err := New(Config{MaxConcurrentPerClient: 2, MaxConcurrentMutations: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice := clientContext("10.0.0.1")
+	releaseList, err := limiter.admit(alice, listMethod, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error admitting a call: %s", err)
+	}
+	releaseSchedule, err := limiter.admit(alice, scheduleMethod, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error admitting a call: %s", err)
+	}
+
+	if _, err = limiter.admit(alice, listMethod, nil); grpc.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected a client over its concurrency quota to be rejected, got %v", err)
+	}
+	bob := clientContext("10.0.0.2")
+	if _, err = limiter.admit(bob, scheduleMethod, nil); grpc.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected a mutation over the global quota to be rejected, got %v", err)
+	}
+
+	releaseSchedule()
+	releaseBob, err := limiter.admit(bob, scheduleMethod, nil)
+	if err != nil {
+		t.Errorf("Expected a mutation to be admitted once another completed: %s", err)
+	} else {
+		releaseBob()
+	}
+	releaseList()
+
+	if len(limiter.clientCalls) != 0 || limiter.mutationCalls != 0 {
+		t.Errorf("Expected no calls to be in flight, got %v and %d mutations", limiter.clientCalls, limiter.mutationCalls)
+	}
+}
+
+func TestIdleLimitersAreForgotten(t *testing.T) {
+	set := newLimiterSet(1, 5)
+	now := time.Now()
+	set.allow("alice", now)
+
+	set.allow("bob", now.Add(limiterSweepInterval+time.Second))
+	if _, ok := set.limiters["alice"]; ok {
+		t.Error("Expected an idle limiter to be forgotten")
+	}
+	if _, ok := set.limiters["bob"]; !ok {
+		t.Error("Expected a limiter in use to be kept")
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	for _, config := range []Config{
+		{ClientRequestsPerSecond: 1},
+		{PodSchedulesPerSecond: 1},
+		{MaxConcurrentMutations: -1},
+	} {
+		if _, err := New(config); err == nil {
+			t.Errorf("Expected an error for invalid config %+v", config)
+		}
+	}
+}
@@ -2,16 +2,16 @@ package gzip
 
 import (
 	"os"
-	"os/exec"
 	"os/user"
-	"syscall"
 
+	"github.com/square/p2/pkg/uri"
 	p2user "github.com/square/p2/pkg/user"
 	"github.com/square/p2/pkg/util"
 )
 
 // ExtractTarGz extracts the specified tarball to the specified destination,
-// as the specified user.
+// as the specified user. Entries that would escape the destination, and
+// device nodes, cause extraction to fail; see uri.ExtractTar.
 func ExtractTarGz(owner string, filename string, dest string) (err error) {
 	ownerUID, ownerGID, err := p2user.IDs(owner)
 	if err != nil {
@@ -32,22 +32,26 @@ func ExtractTarGz(owner string, filename string, dest string) (err error) {
 		return util.Errorf("error setting ownership of root directory %s: %s", dest, err)
 	}
 
-	// Always pass --no-same-owner:
-	// this is default if extracting as non-root, but --same-owner is default if root.
-	// For run_as root apps, we DO want the files to end up owned by root,
-	// instead of an unknown user dictated by the build system that produced the artifact.
-	cmd := exec.Command("tar", "xpzf", filename, "--no-same-owner", "-C", dest)
-	if currentUser.Username != owner {
-		// If we are running as a non-root user (e.g. in tests), don't change user.
-		// Non-root users are understandably not allowed to change to other users...
-		// not even themselves.
-		cmd.SysProcAttr = &syscall.SysProcAttr{
-			Credential: &syscall.Credential{Uid: uint32(ownerUID), Gid: uint32(ownerGID)},
-		}
+	tarball, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer tarball.Close()
+
+	// Ownership recorded in the tarball is always ignored: for run_as root
+	// apps, we DO want the files to end up owned by root, instead of an
+	// unknown user dictated by the build system that produced the
+	// artifact.
+	opts := uri.ExtractOptions{UID: ownerUID, GID: ownerGID}
+	if currentUser.Username == owner {
+		// If we are running as a non-root user (e.g. in tests), don't
+		// change ownership. Non-root users are understandably not
+		// allowed to give files to other users.
+		opts = uri.CurrentUser
 	}
-	output, err := cmd.CombinedOutput()
+	err = uri.ExtractTarGz(tarball, dest, opts)
 	if err != nil {
-		return util.Errorf("error extracting: %v %s", err, string(output))
+		return util.Errorf("error extracting: %s", err)
 	}
 	return nil
 }
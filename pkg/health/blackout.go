@@ -0,0 +1,87 @@
+package health
+
+import (
+	"time"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// The format of the times of daily blackout windows
+const dailyTimeFormat = "15:04"
+
+// BlackoutWindow is a period during which a service is expected to be down,
+// such as a nightly restart. Critical results checked during it are marked
+// as suppressed, see Result.Suppressed. A window is either one-off, between
+// Start and End, or recurs every day between DailyStart and DailyEnd.
+type BlackoutWindow struct {
+	Start time.Time `json:"start,omitempty"`
+	End   time.Time `json:"end,omitempty"`
+
+	// Times of day in UTC such as "02:30". The window wraps around
+	// midnight if DailyEnd is before DailyStart
+	DailyStart string `json:"daily_start,omitempty"`
+	DailyEnd   string `json:"daily_end,omitempty"`
+}
+
+// Validate returns an error if the window isn't exactly one of one-off or
+// daily, or its times are invalid
+func (w BlackoutWindow) Validate() error {
+	oneOff := !w.Start.IsZero() || !w.End.IsZero()
+	daily := w.DailyStart != "" || w.DailyEnd != ""
+	switch {
+	case oneOff && daily:
+		return util.Errorf("a blackout window must be either one-off or daily, not both")
+	case oneOff:
+		if w.Start.IsZero() || w.End.IsZero() {
+			return util.Errorf("a one-off blackout window needs both a start and an end")
+		}
+		if !w.End.After(w.Start) {
+			return util.Errorf("blackout window ends at %s, before it starts at %s", w.End, w.Start)
+		}
+	case daily:
+		if _, err := time.Parse(dailyTimeFormat, w.DailyStart); err != nil {
+			return util.Errorf("invalid daily blackout start %q, expected a time such as 02:30", w.DailyStart)
+		}
+		if _, err := time.Parse(dailyTimeFormat, w.DailyEnd); err != nil {
+			return util.Errorf("invalid daily blackout end %q, expected a time such as 02:30", w.DailyEnd)
+		}
+	default:
+		return util.Errorf("a blackout window needs a start and an end")
+	}
+	return nil
+}
+
+// Contains returns whether t falls in the window. Invalid windows contain no
+// time.
+func (w BlackoutWindow) Contains(t time.Time) bool {
+	if w.DailyStart == "" {
+		return !t.Before(w.Start) && t.Before(w.End)
+	}
+
+	start, err := time.Parse(dailyTimeFormat, w.DailyStart)
+	if err != nil {
+		return false
+	}
+	end, err := time.Parse(dailyTimeFormat, w.DailyEnd)
+	if err != nil {
+		return false
+	}
+	t = t.UTC()
+	now := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	from := time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute
+	to := time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute
+	if from <= to {
+		return now >= from && now < to
+	}
+	return now >= from || now < to
+}
+
+// InBlackout returns whether t falls in any of the windows
+func InBlackout(windows []BlackoutWindow, t time.Time) bool {
+	for _, window := range windows {
+		if window.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
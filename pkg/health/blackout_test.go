@@ -0,0 +1,95 @@
+package health
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBlackoutWindowContains(t *testing.T) {
+	at := func(clock string) time.Time {
+		t, _ := time.Parse("2006-01-02 15:04", "2017-06-01 "+clock)
+		return t
+	}
+
+	nightly := BlackoutWindow{DailyStart: "02:00", DailyEnd: "02:30"}
+	overMidnight := BlackoutWindow{DailyStart: "23:30", DailyEnd: "00:15"}
+	oneOff := BlackoutWindow{Start: at("10:00"), End: at("11:00")}
+	for _, c := range []struct {
+		window   BlackoutWindow
+		clock    string
+		expected bool
+	}{
+		{nightly, "02:00", true},
+		{nightly, "02:29", true},
+		{nightly, "02:30", false},
+		{nightly, "14:15", false},
+		{overMidnight, "23:45", true},
+		{overMidnight, "00:10", true},
+		{overMidnight, "00:15", false},
+		{overMidnight, "12:00", false},
+		{oneOff, "10:30", true},
+		{oneOff, "11:00", false},
+		{oneOff, "09:59", false},
+	} {
+		if got := c.window.Contains(at(c.clock)); got != c.expected {
+			t.Errorf("expected %+v to contain %s: %t, got %t", c.window, c.clock, c.expected, got)
+		}
+	}
+
+	if !InBlackout([]BlackoutWindow{oneOff, nightly}, at("02:10")) {
+		t.Error("expected a time in any of the windows to be in blackout")
+	}
+	if InBlackout(nil, at("02:10")) {
+		t.Error("expected no windows to never be in blackout")
+	}
+}
+
+func TestBlackoutWindowValidate(t *testing.T) {
+	now := time.Now()
+	valid := []BlackoutWindow{
+		{DailyStart: "02:00", DailyEnd: "02:30"},
+		{Start: now, End: now.Add(time.Hour)},
+	}
+	for _, window := range valid {
+		if err := window.Validate(); err != nil {
+			t.Errorf("expected %+v to be valid, got %s", window, err)
+		}
+	}
+
+	invalid := []BlackoutWindow{
+		{},
+		{DailyStart: "2am", DailyEnd: "02:30"},
+		{DailyStart: "02:00"},
+		{Start: now},
+		{Start: now, End: now.Add(-time.Hour)},
+		{Start: now, End: now.Add(time.Hour), DailyStart: "02:00", DailyEnd: "02:30"},
+	}
+	for _, window := range invalid {
+		if err := window.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", window)
+		}
+	}
+}
+
+func TestGatingStatus(t *testing.T) {
+	if status := (Result{Status: Critical, Suppressed: true}).GatingStatus(); status != Passing {
+		t.Errorf("expected a suppressed result to gate as passing, got %s", status)
+	}
+	if status := (Result{Status: Critical}).GatingStatus(); status != Critical {
+		t.Errorf("expected a result that isn't suppressed to gate as its status, got %s", status)
+	}
+	if status := (Result{Status: Critical, Readiness: Passing, Liveness: Critical}).GatingStatus(); status != Passing {
+		t.Errorf("expected a result to gate as its readiness, got %s", status)
+	}
+}
+
+func TestReadinessAndLiveness(t *testing.T) {
+	res := Result{Status: Warning}
+	if res.ReadinessStatus() != Warning || res.LivenessStatus() != Warning {
+		t.Errorf("expected readiness and liveness to default to the status, got %s and %s", res.ReadinessStatus(), res.LivenessStatus())
+	}
+	res = Result{Status: Critical, Readiness: Critical, Liveness: Passing}
+	if res.ReadinessStatus() != Critical || res.LivenessStatus() != Passing {
+		t.Errorf("expected readiness critical and liveness passing, got %s and %s", res.ReadinessStatus(), res.LivenessStatus())
+	}
+}
@@ -0,0 +1,153 @@
+package checker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+)
+
+// CachingChecker is a ShadowTrafficHealthChecker that answers Service()
+// queries for consul health from a local cache. The first query for a service
+// starts a blocking watch of its health tree, and later queries are answered
+// from the latest results of the watch without going to consul. This keeps
+// tooling that repeatedly asks whether every node is healthy, such as the roll
+// orchestrator, from listing the whole health tree of the service each time.
+//
+// Queries are passed through to the wrapped checker while the cache has no
+// results yet or while the watch is failing, and whenever the health service
+// is asked for. A service's watch is stopped once it hasn't been queried for
+// idleTimeout.
+type CachingChecker struct {
+	ShadowTrafficHealthChecker
+
+	kv          healthKV
+	watchDelay  time.Duration
+	idleTimeout time.Duration
+	ctx         context.Context
+	cancel      context.CancelFunc
+
+	mu       sync.Mutex
+	services map[string]*cachedService
+}
+
+type cachedService struct {
+	// lastQueried is protected by CachingChecker.mu
+	lastQueried time.Time
+
+	mu      sync.Mutex
+	results map[types.NodeName]health.Result
+	// fresh is false until the first results arrive and after the watch
+	// fails, until it recovers
+	fresh bool
+}
+
+func NewCachingChecker(
+	checker ShadowTrafficHealthChecker,
+	client consulutil.ConsulClient,
+	watchDelay time.Duration,
+	idleTimeout time.Duration,
+) *CachingChecker {
+	return newCachingChecker(checker, client.KV(), watchDelay, idleTimeout)
+}
+
+func newCachingChecker(
+	checker ShadowTrafficHealthChecker,
+	kv healthKV,
+	watchDelay time.Duration,
+	idleTimeout time.Duration,
+) *CachingChecker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &CachingChecker{
+		ShadowTrafficHealthChecker: checker,
+		kv:                         kv,
+		watchDelay:                 watchDelay,
+		idleTimeout:                idleTimeout,
+		ctx:                        ctx,
+		cancel:                     cancel,
+		services:                   make(map[string]*cachedService),
+	}
+}
+
+func (c *CachingChecker) Service(
+	serviceID string,
+	nodeIDs []types.NodeName,
+	useHealthService bool,
+	status manifest.StatusStanza,
+) (map[types.NodeName]health.Result, error) {
+	if !useHealthService {
+		if results, ok := c.cached(serviceID); ok {
+			return results, nil
+		}
+	}
+	return c.ShadowTrafficHealthChecker.Service(serviceID, nodeIDs, useHealthService, status)
+}
+
+// Close stops every watch. Queries made afterwards are passed through to the
+// wrapped checker.
+func (c *CachingChecker) Close() {
+	c.cancel()
+}
+
+func (c *CachingChecker) cached(serviceID string) (map[types.NodeName]health.Result, bool) {
+	c.mu.Lock()
+	if c.ctx.Err() != nil {
+		c.mu.Unlock()
+		return nil, false
+	}
+	service, ok := c.services[serviceID]
+	if !ok {
+		service = &cachedService{}
+		c.services[serviceID] = service
+		go c.watch(serviceID, service)
+	}
+	service.lastQueried = time.Now()
+	c.mu.Unlock()
+
+	service.mu.Lock()
+	defer service.mu.Unlock()
+	if !service.fresh {
+		return nil, false
+	}
+	return healthResultsCopy(service.results), true
+}
+
+func (c *CachingChecker) watch(serviceID string, service *cachedService) {
+	ctx, cancel := context.WithCancel(c.ctx)
+	defer cancel()
+	resultCh := make(chan map[types.NodeName]health.Result)
+	errCh := make(chan error)
+	go watchConsulHealth(ctx, serviceID, c.kv, resultCh, errCh, c.watchDelay)
+
+	idleTimer := time.NewTimer(c.idleTimeout)
+	defer idleTimer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case results := <-resultCh:
+			service.mu.Lock()
+			service.results = results
+			service.fresh = true
+			service.mu.Unlock()
+		case <-errCh:
+			service.mu.Lock()
+			service.fresh = false
+			service.mu.Unlock()
+		case <-idleTimer.C:
+			c.mu.Lock()
+			idle := time.Since(service.lastQueried)
+			if idle >= c.idleTimeout {
+				delete(c.services, serviceID)
+				c.mu.Unlock()
+				return
+			}
+			c.mu.Unlock()
+			idleTimer.Reset(c.idleTimeout - idle)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package checker
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+)
+
+// fakeHealthKV answers blocking queries the way consul does: a List whose
+// WaitIndex is the current index blocks until the results change
+type fakeHealthKV struct {
+	mu      sync.Mutex
+	index   uint64
+	pairs   api.KVPairs
+	changed chan struct{}
+	lists   int
+}
+
+func newFakeHealthKV() *fakeHealthKV {
+	return &fakeHealthKV{index: 1, changed: make(chan struct{})}
+}
+
+func (f *fakeHealthKV) setHealth(t *testing.T, node types.NodeName, status health.HealthState) {
+	value, err := json.Marshal(consul.WatchResult{Id: "slug", Node: node, Service: "slug", Status: string(status)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pairs = api.KVPairs{{Key: consul.HealthPath("slug", node), Value: value}}
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeHealthKV) listCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lists
+}
+
+func (f *fakeHealthKV) List(prefix string, opts *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error) {
+	f.mu.Lock()
+	f.lists++
+	if opts != nil && opts.WaitIndex == f.index {
+		changed := f.changed
+		f.mu.Unlock()
+		select {
+		case <-changed:
+		case <-time.After(5 * time.Second):
+		}
+		f.mu.Lock()
+	}
+	defer f.mu.Unlock()
+	return f.pairs, &api.QueryMeta{LastIndex: f.index}, nil
+}
+
+// countingChecker stands in for the wrapped checker
+type countingChecker struct {
+	ShadowTrafficHealthChecker
+	mu      sync.Mutex
+	queries int
+}
+
+func (c *countingChecker) Service(string, []types.NodeName, bool, manifest.StatusStanza) (map[types.NodeName]health.Result, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queries++
+	return map[types.NodeName]health.Result{}, nil
+}
+
+func waitForStatus(t *testing.T, c *CachingChecker, status health.HealthState) {
+	timeout := time.After(5 * time.Second)
+	for {
+		results, _ := c.Service("slug", nil, false, manifest.StatusStanza{})
+		if results["node1"].Status == status {
+			return
+		}
+		select {
+		case <-timeout:
+			t.Fatalf("Expected node1 to become %s, last got %+v", status, results)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestCachingCheckerServesServiceFromWatch(t *testing.T) {
+	kv := newFakeHealthKV()
+	kv.setHealth(t, "node1", health.Critical)
+	inner := &countingChecker{}
+	c := newCachingChecker(inner, kv, time.Second, time.Minute)
+	defer c.Close()
+
+	waitForStatus(t, c, health.Critical)
+	listsBefore := kv.listCount()
+	for i := 0; i < 100; i++ {
+		results, err := c.Service("slug", nil, false, manifest.StatusStanza{})
+		if err != nil || results["node1"].Status != health.Critical {
+			t.Fatalf("Expected the cached health, got %+v, %v", results, err)
+		}
+	}
+	if lists := kv.listCount() - listsBefore; lists > 1 {
+		t.Errorf("Expected queries to be answered from the cache, but the health tree was listed %d times", lists)
+	}
+
+	// changes are picked up by the watch
+	kv.setHealth(t, "node1", health.Passing)
+	waitForStatus(t, c, health.Passing)
+
+	// the health service isn't cached
+	inner.mu.Lock()
+	inner.queries = 0
+	inner.mu.Unlock()
+	_, _ = c.Service("slug", nil, true, manifest.StatusStanza{})
+	if inner.queries != 1 {
+		t.Error("Expected health service queries to be passed through")
+	}
+}
+
+func TestCachingCheckerStopsIdleWatches(t *testing.T) {
+	kv := newFakeHealthKV()
+	kv.setHealth(t, "node1", health.Passing)
+	c := newCachingChecker(&countingChecker{}, kv, time.Second, 50*time.Millisecond)
+	defer c.Close()
+
+	waitForStatus(t, c, health.Passing)
+	time.Sleep(200 * time.Millisecond)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.services) != 0 {
+		t.Errorf("Expected the idle watch to be stopped, still watching %d services", len(c.services))
+	}
+}
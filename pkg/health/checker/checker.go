@@ -2,7 +2,6 @@ package checker
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net"
 	"net/url"
@@ -28,6 +27,10 @@ type HealthChecker interface {
 		podID types.PodID,
 		quitCh <-chan struct{},
 	) (chan health.Result, chan error)
+	// WatchService streams the health of the service on every node over
+	// resultCh until ctx is done, then closes it. A result is sent once
+	// and then each time the service's health changes, as reported by a
+	// blocking query, which is issued at most once every watchDelay.
 	WatchService(
 		ctx context.Context,
 		serviceID string,
@@ -42,6 +45,9 @@ type HealthChecker interface {
 		jitterWindow time.Duration,
 	)
 	Service(serviceID string) (map[types.NodeName]health.Result, error)
+	// History returns the last n statuses of a service on a node, oldest
+	// first, or all of those that are kept if n is not positive
+	History(node types.NodeName, serviceID string, n int) ([]health.HistoryEntry, error)
 }
 
 type ShadowTrafficHealthChecker interface {
@@ -336,11 +342,15 @@ func watchConsulHealth(
 				case errCh <- consulutil.NewKVError("list", consul.HealthPath(serviceID, "/"), err):
 				}
 			} else {
+				// A blocking query that times out returns the index
+				// it was given: nothing changed
+				if curIndex != 0 && queryMeta.LastIndex == curIndex {
+					continue
+				}
 				curIndex = queryMeta.LastIndex
 				out := make(map[types.NodeName]health.Result)
 				for _, result := range results {
-					var next consul.WatchResult
-					err = json.Unmarshal(result.Value, &next)
+					next, err := consul.UnmarshalWatchResult(result.Value)
 					if err != nil {
 						select {
 						case <-ctx.Done():
@@ -557,6 +567,21 @@ func (h healthChecker) Service(serviceID string) (map[types.NodeName]health.Resu
 	return ret, nil
 }
 
+func (h healthChecker) History(node types.NodeName, serviceID string, n int) ([]health.HistoryEntry, error) {
+	res, err := h.consulStore.GetHealth(serviceID, node)
+	if err != nil {
+		return nil, err
+	}
+	if res.History == nil {
+		return nil, nil
+	}
+	history := res.History.Entries
+	if n > 0 && len(history) > n {
+		history = history[len(history)-n:]
+	}
+	return history, nil
+}
+
 // Service returns a map where values are individual results (keys are nodes)
 func (h shadowTrafficHealthChecker) Service(
 	serviceID string,
@@ -610,20 +635,36 @@ func (h shadowTrafficHealthChecker) Service(
 
 func consulWatchToResult(w consul.WatchResult) health.Result {
 	return health.Result{
-		ID:      w.Id,
-		Node:    w.Node,
-		Service: w.Service,
-		Status:  health.ToHealthState(w.Status),
+		ID:         w.Id,
+		Node:       w.Node,
+		Service:    w.Service,
+		Status:     health.ToHealthState(w.Status),
+		Check:      w.Check,
+		Reason:     w.Reason,
+		Addresses:  w.Addresses,
+		Checks:     w.Checks,
+		Suppressed: w.Suppressed,
+		Readiness:  toOptionalHealthState(w.Readiness),
+		Liveness:   toOptionalHealthState(w.Liveness),
+	}
+}
+
+// toOptionalHealthState converts a status that may be empty, which stays
+// empty
+func toOptionalHealthState(status string) health.HealthState {
+	if status == "" {
+		return ""
 	}
+	return health.ToHealthState(status)
 }
 
 func kvpToResult(kv api.KVPair) (*health.Result, error) {
-	res := &health.Result{}
-	err := json.Unmarshal(kv.Value, &res)
+	watch, err := consul.UnmarshalWatchResult(kv.Value)
 	if err != nil {
 		return nil, util.Errorf("Could not unmarshal health at %s: %v", kv.Key, err)
 	}
-	return res, nil
+	res := consulWatchToResult(watch)
+	return &res, nil
 }
 
 // Maps a list of KV Pairs into a slice of health.Results
@@ -3,6 +3,8 @@ package checker
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"reflect"
 	"testing"
 	"time"
 
@@ -295,6 +297,70 @@ func TestService(t *testing.T) {
 	Assert(t).AreEqual(results["node1"], expected, "Unexpected results calling Service()")
 }
 
+func TestHistory(t *testing.T) {
+	start := time.Now()
+	entries := []health.HistoryEntry{
+		{Time: start, Status: health.Passing},
+		{Time: start.Add(time.Minute), Status: health.Critical, Reason: health.ReasonTimeout},
+		{Time: start.Add(2 * time.Minute), Status: health.Passing},
+	}
+	hc := healthChecker{
+		consulStore: fakeConsulStore{
+			results: map[string]consul.WatchResult{
+				"node1": {Service: "slug", Status: "passing", History: &health.History{Entries: entries}},
+				"node2": {Service: "slug", Status: "passing"},
+			},
+		},
+	}
+
+	history, err := hc.History("node1", "slug", 2)
+	Assert(t).IsNil(err, "Unexpected error calling History()")
+	Assert(t).IsTrue(reflect.DeepEqual(entries[1:], history), fmt.Sprintf("Expected the last 2 entries, got %+v", history))
+
+	history, err = hc.History("node1", "slug", 0)
+	Assert(t).IsNil(err, "Unexpected error calling History()")
+	Assert(t).AreEqual(len(history), 3, "Expected every entry without a limit")
+
+	history, err = hc.History("node2", "slug", 2)
+	Assert(t).IsNil(err, "Unexpected error calling History()")
+	Assert(t).AreEqual(len(history), 0, "Expected no history for a result without one")
+}
+
+type indexedHealthKV struct {
+	indexes []uint64
+	waits   chan uint64
+}
+
+func (f *indexedHealthKV) List(prefix string, opts *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error) {
+	f.waits <- opts.WaitIndex
+	index := f.indexes[0]
+	if len(f.indexes) > 1 {
+		f.indexes = f.indexes[1:]
+	}
+	result, _ := json.Marshal(consul.WatchResult{Id: "slug", Node: "node1", Service: "slug", Status: "passing"})
+	return api.KVPairs{{Key: "health/slug/node1", Value: result}}, &api.QueryMeta{LastIndex: index}, nil
+}
+
+func TestWatchServiceOnlyPublishesChanges(t *testing.T) {
+	kv := &indexedHealthKV{indexes: []uint64{7, 7, 9}, waits: make(chan uint64, 10)}
+	hc := healthChecker{kv: kv}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resultCh := make(chan map[types.NodeName]health.Result)
+	errCh := make(chan error)
+	go hc.WatchService(ctx, "slug", resultCh, errCh, 0)
+
+	results := <-resultCh
+	Assert(t).AreEqual(results["node1"].Status, health.Passing, "Expected the first result to be published")
+	// the second query times out at index 7, the third returns index 9
+	results = <-resultCh
+	Assert(t).AreEqual(len(results), 1, "Expected a result after the index changed")
+
+	waits := []uint64{<-kv.waits, <-kv.waits, <-kv.waits}
+	Assert(t).IsTrue(reflect.DeepEqual(waits, []uint64{0, 7, 7}), fmt.Sprintf("Expected queries to block on the last index, got %v", waits))
+}
+
 func TestPublishLatestHealth(t *testing.T) {
 	// This channel imitates the channel that consulutil.WatchPrefix would return
 	healthListChan := make(chan api.KVPairs)
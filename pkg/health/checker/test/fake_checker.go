@@ -101,6 +101,10 @@ func (s singleServiceChecker) Service(serviceID string) (map[types.NodeName]heal
 	return s.health, nil
 }
 
+func (s singleServiceChecker) History(node types.NodeName, serviceID string, n int) ([]health.HistoryEntry, error) {
+	panic("History not implemented")
+}
+
 type AlwaysHappyHealthChecker struct {
 	allNodes []types.NodeName
 }
@@ -147,6 +151,10 @@ func (h AlwaysHappyHealthChecker) Service(serviceID string) (map[types.NodeName]
 	return results, nil
 }
 
+func (h AlwaysHappyHealthChecker) History(node types.NodeName, serviceID string, n int) ([]health.HistoryEntry, error) {
+	return []health.HistoryEntry{{Status: health.Passing}}, nil
+}
+
 func (h AlwaysHappyHealthChecker) WatchService(
 	ctx context.Context,
 	serviceID string,
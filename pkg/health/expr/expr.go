@@ -0,0 +1,501 @@
+// Package expr implements the small expression language that can be used in a
+// pod manifest's status stanza to decide whether a status check response is
+// healthy, e.g.
+//
+//	json.status == "ok" && json.lag_seconds < 30
+//
+// Expressions support string, number, boolean and null literals, field access
+// with "." and array indexing with "[n]", comparisons (== != < <= > >=), the
+// logical operators && || and !, and parentheses. Accessing a field or index
+// that doesn't exist yields null rather than an error, so "json.a.b == null"
+// can be used to check for absence. An expression must evaluate to a boolean.
+package expr
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// Expr is a parsed expression
+type Expr struct {
+	source string
+	root   node
+}
+
+// Parse parses an expression, returning an error if it is malformed
+func Parse(source string) (*Expr, error) {
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenEOF {
+		return nil, util.Errorf("unexpected %q at position %d", p.peek().text, p.peek().pos)
+	}
+
+	return &Expr{source: source, root: root}, nil
+}
+
+func (e *Expr) String() string {
+	return e.source
+}
+
+// Eval evaluates the expression with the given variables in scope. Values are
+// expected to be the types produced by encoding/json when decoding into an
+// interface{}, i.e. float64, string, bool, nil, []interface{} and
+// map[string]interface{}. Ints are also accepted.
+func (e *Expr) Eval(vars map[string]interface{}) (bool, error) {
+	result, err := e.root.eval(vars)
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := result.(bool)
+	if !ok {
+		return false, util.Errorf("expression %q evaluated to %v, not a boolean", e.source, result)
+	}
+	return b, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", "[", "]", "."}
+
+func lex(source string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(source) {
+		c := rune(source[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			var sb bytes.Buffer
+			for end < len(source) && rune(source[end]) != c {
+				if source[end] == '\\' && end+1 < len(source) {
+					end++
+				}
+				sb.WriteByte(source[end])
+				end++
+			}
+			if end >= len(source) {
+				return nil, util.Errorf("unterminated string starting at position %d", i)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: sb.String(), pos: i})
+			i = end + 1
+		case unicode.IsDigit(c) || (c == '-' && i+1 < len(source) && unicode.IsDigit(rune(source[i+1]))):
+			end := i + 1
+			for end < len(source) && (unicode.IsDigit(rune(source[end])) || source[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: source[i:end], pos: i})
+			i = end
+		case c == '_' || unicode.IsLetter(c):
+			end := i + 1
+			for end < len(source) && (source[end] == '_' || unicode.IsLetter(rune(source[end])) || unicode.IsDigit(rune(source[end]))) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: source[i:end], pos: i})
+			i = end
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(source[i:], op) {
+					tokens = append(tokens, token{kind: tokenOp, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, util.Errorf("unexpected character %q at position %d", c, i)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(source)}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) acceptOp(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokenOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.next()
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expectOp(op string) error {
+	if _, ok := p.acceptOp(op); !ok {
+		return util.Errorf("expected %q at position %d", op, p.peek().pos)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.acceptOp("||"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalNode{op: "||", left: left, right: right}
+	}
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.acceptOp("&&"); !ok {
+			return left, nil
+		}
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalNode{op: "&&", left: left, right: right}
+	}
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.acceptOp("==", "!=", "<=", ">=", "<", ">")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return comparisonNode{op: op, left: left, right: right}, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if _, ok := p.acceptOp("!"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, util.Errorf("invalid number %q at position %d", t.text, t.pos)
+		}
+		return literalNode{value: f}, nil
+	case tokenString:
+		return literalNode{value: t.text}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return literalNode{value: true}, nil
+		case "false":
+			return literalNode{value: false}, nil
+		case "null":
+			return literalNode{value: nil}, nil
+		}
+		return p.parseAccessors(variableNode{name: t.text})
+	case tokenOp:
+		if t.text == "(" {
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		}
+	case tokenEOF:
+		return nil, util.Errorf("unexpected end of expression")
+	}
+	return nil, util.Errorf("unexpected %q at position %d", t.text, t.pos)
+}
+
+func (p *parser) parseAccessors(target node) (node, error) {
+	for {
+		op, ok := p.acceptOp(".", "[")
+		if !ok {
+			return target, nil
+		}
+		if op == "." {
+			t := p.next()
+			if t.kind != tokenIdent {
+				return nil, util.Errorf("expected a field name at position %d", t.pos)
+			}
+			target = fieldNode{target: target, field: t.text}
+			continue
+		}
+
+		t := p.next()
+		switch t.kind {
+		case tokenNumber:
+			index, err := strconv.Atoi(t.text)
+			if err != nil {
+				return nil, util.Errorf("invalid index %q at position %d", t.text, t.pos)
+			}
+			target = indexNode{target: target, index: index}
+		case tokenString:
+			target = fieldNode{target: target, field: t.text}
+		default:
+			return nil, util.Errorf("expected an index at position %d", t.pos)
+		}
+		if err := p.expectOp("]"); err != nil {
+			return nil, err
+		}
+	}
+}
+
+type node interface {
+	eval(vars map[string]interface{}) (interface{}, error)
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n literalNode) eval(map[string]interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+type variableNode struct {
+	name string
+}
+
+func (n variableNode) eval(vars map[string]interface{}) (interface{}, error) {
+	value, ok := vars[n.name]
+	if !ok {
+		return nil, util.Errorf("unknown variable %q", n.name)
+	}
+	return normalize(value), nil
+}
+
+type fieldNode struct {
+	target node
+	field  string
+}
+
+func (n fieldNode) eval(vars map[string]interface{}) (interface{}, error) {
+	target, err := n.target.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	object, ok := target.(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	return normalize(object[n.field]), nil
+}
+
+type indexNode struct {
+	target node
+	index  int
+}
+
+func (n indexNode) eval(vars map[string]interface{}) (interface{}, error) {
+	target, err := n.target.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	array, ok := target.([]interface{})
+	if !ok || n.index < 0 || n.index >= len(array) {
+		return nil, nil
+	}
+	return normalize(array[n.index]), nil
+}
+
+type notNode struct {
+	operand node
+}
+
+func (n notNode) eval(vars map[string]interface{}) (interface{}, error) {
+	value, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return nil, util.Errorf("cannot apply ! to %v", value)
+	}
+	return !b, nil
+}
+
+type logicalNode struct {
+	op          string
+	left, right node
+}
+
+func (n logicalNode) eval(vars map[string]interface{}) (interface{}, error) {
+	left, err := evalBool(n.left, vars, n.op)
+	if err != nil {
+		return nil, err
+	}
+	// short circuit
+	if n.op == "&&" && !left {
+		return false, nil
+	}
+	if n.op == "||" && left {
+		return true, nil
+	}
+	return evalBool(n.right, vars, n.op)
+}
+
+func evalBool(n node, vars map[string]interface{}, op string) (bool, error) {
+	value, err := n.eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, util.Errorf("operands of %s must be booleans, got %v", op, value)
+	}
+	return b, nil
+}
+
+type comparisonNode struct {
+	op          string
+	left, right node
+}
+
+func (n comparisonNode) eval(vars map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	}
+
+	// ordering comparisons against a missing value are false rather than
+	// an error, since a response missing a field is simply unhealthy
+	if left == nil || right == nil {
+		return false, nil
+	}
+
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return nil, util.Errorf("cannot compare %v %s %v", left, n.op, right)
+		}
+		return compare(n.op, l < r, l == r), nil
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return nil, util.Errorf("cannot compare %q %s %v", left, n.op, right)
+		}
+		return compare(n.op, l < r, l == r), nil
+	}
+	return nil, util.Errorf("cannot compare %v %s %v", left, n.op, right)
+}
+
+func compare(op string, less bool, equal bool) bool {
+	switch op {
+	case "<":
+		return less
+	case "<=":
+		return less || equal
+	case ">":
+		return !less && !equal
+	default: // ">="
+		return !less
+	}
+}
+
+func equal(left, right interface{}) bool {
+	switch left.(type) {
+	case map[string]interface{}, []interface{}:
+		return false
+	}
+	switch right.(type) {
+	case map[string]interface{}, []interface{}:
+		return false
+	}
+	return left == right
+}
+
+// normalize converts numeric types to float64 so that values that weren't
+// produced by encoding/json can be compared with number literals
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	}
+	return value
+}
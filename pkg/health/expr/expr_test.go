@@ -0,0 +1,84 @@
+package expr
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func evalJSON(t *testing.T, source string, body string) (bool, error) {
+	var decoded interface{}
+	err := json.Unmarshal([]byte(body), &decoded)
+	if err != nil {
+		t.Fatalf("bad test body %s: %s", body, err)
+	}
+
+	e, err := Parse(source)
+	if err != nil {
+		t.Fatalf("could not parse %q: %s", source, err)
+	}
+	return e.Eval(map[string]interface{}{"json": decoded, "status_code": 200})
+}
+
+func TestEval(t *testing.T) {
+	body := `{"status": "ok", "lag_seconds": 12.5, "ready": true, "replicas": [{"name": "a"}, {"name": "b"}]}`
+
+	type testCase struct {
+		source   string
+		expected bool
+	}
+	for _, tc := range []testCase{
+		{`json.status == "ok" && json.lag_seconds < 30`, true},
+		{`json.status == "ok" && json.lag_seconds < 10`, false},
+		{`json.status != 'ok' || json.ready`, true},
+		{`!json.ready`, false},
+		{`json.replicas[1].name == "b"`, true},
+		{`json["status"] == "ok"`, true},
+		{`json.replicas[5].name == null`, true},
+		{`json.missing.field == null`, true},
+		{`json.missing > 3`, false},
+		{`status_code >= 200 && status_code < 300`, true},
+		{`(json.lag_seconds > 100 || json.ready) && json.status == "ok"`, true},
+		{`json.lag_seconds >= -1`, true},
+	} {
+		result, err := evalJSON(t, tc.source, body)
+		if err != nil {
+			t.Errorf("unexpected error evaluating %q: %s", tc.source, err)
+			continue
+		}
+		if result != tc.expected {
+			t.Errorf("expected %q to be %t", tc.source, tc.expected)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	body := `{"status": "ok", "lag_seconds": 12}`
+	for _, source := range []string{
+		`json.status`,
+		`json.status < 3`,
+		`json.status && true`,
+		`unknown == 1`,
+	} {
+		_, err := evalJSON(t, source, body)
+		if err == nil {
+			t.Errorf("expected an error evaluating %q", source)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, source := range []string{
+		``,
+		`json.status ==`,
+		`(json.ready`,
+		`json.status == "ok`,
+		`json. == 1`,
+		`json.ready $ true`,
+		`json.ready true`,
+	} {
+		_, err := Parse(source)
+		if err == nil {
+			t.Errorf("expected an error parsing %q", source)
+		}
+	}
+}
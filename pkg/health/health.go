@@ -1,6 +1,9 @@
 package health
 
 import (
+	"reflect"
+	"time"
+
 	"github.com/square/p2/pkg/types"
 )
 
@@ -10,6 +13,241 @@ type Result struct {
 	Node    types.NodeName
 	Service string
 	Status  HealthState
+
+	// The configuration of the check that produced this result, if known
+	Check *CheckConfig `json:",omitempty"`
+
+	// Why the check failed. Empty if the check passed or the reason is
+	// unknown
+	Reason Reason `json:",omitempty"`
+
+	// The result of checking each address, if the check was configured
+	// with several addresses. It's a pointer so that results stay
+	// comparable
+	Addresses *AddressResults `json:",omitempty"`
+
+	// The result of each of the service's named checks, if it has any. The
+	// service's status is the least healthy of them and its own check. It's
+	// a pointer so that results stay comparable
+	Checks *CheckResults `json:",omitempty"`
+
+	// Set for critical results checked during one of the service's
+	// blackout windows, when it is expected to be down. See BlackoutWindow
+	Suppressed bool `json:",omitempty"`
+
+	// Whether the service is ready, i.e. should be sent traffic and
+	// counted as up by deploys, and whether it is alive, i.e. shouldn't be
+	// restarted. They differ from Status when some of the service's named
+	// checks only decide one of them, see RoleReadiness and RoleLiveness,
+	// and are empty otherwise. Use ReadinessStatus and LivenessStatus
+	Readiness HealthState `json:",omitempty"`
+	Liveness  HealthState `json:",omitempty"`
+}
+
+// The roles of checks that only decide one of a service's readiness and
+// liveness. Checks without a role decide both
+const (
+	RoleReadiness = "readiness"
+	RoleLiveness  = "liveness"
+)
+
+// ReadinessStatus returns whether the service is ready to be sent traffic and
+// counted as up by deploys
+func (r Result) ReadinessStatus() HealthState {
+	if r.Readiness != "" {
+		return r.Readiness
+	}
+	return r.Status
+}
+
+// LivenessStatus returns whether the service is alive, so that it shouldn't
+// be restarted even if it isn't ready
+func (r Result) LivenessStatus() HealthState {
+	if r.Liveness != "" {
+		return r.Liveness
+	}
+	return r.Status
+}
+
+// GatingStatus is the readiness status that deploys should wait on.
+// Suppressed results count as passing, so that expected downtime doesn't hold
+// up deploys of other nodes.
+func (r Result) GatingStatus() HealthState {
+	if r.Suppressed {
+		return Passing
+	}
+	return r.ReadinessStatus()
+}
+
+// History holds a service's recent health statuses on a node, oldest first
+type History struct {
+	Entries []HistoryEntry
+}
+
+// HistoryEntry is one of a service's recent health statuses on a node, as of
+// when the service changed to it
+type HistoryEntry struct {
+	Time   time.Time
+	Status HealthState
+	Reason Reason `json:",omitempty"`
+}
+
+// AddressResults holds the outcome of checking each of a service's addresses
+type AddressResults struct {
+	Results []AddressResult
+}
+
+// AddressResult is the outcome of checking one of the addresses of a service
+type AddressResult struct {
+	Address string
+	Status  HealthState
+	Reason  Reason `json:",omitempty"`
+}
+
+// CheckResults holds the outcome of each of a service's named checks, sorted
+// by name
+type CheckResults struct {
+	Results []CheckResult
+}
+
+// CheckResult is the outcome of one of the named checks of a service
+type CheckResult struct {
+	Name   string
+	Status HealthState
+	Reason Reason `json:",omitempty"`
+	// RoleReadiness or RoleLiveness if the check only decides one of them
+	Role string `json:",omitempty"`
+}
+
+// Reason is a machine readable category of health check failure, so that
+// dashboards and automation don't have to parse check output
+type Reason string
+
+const (
+	ReasonConnectionRefused Reason = "connection_refused"
+	ReasonTimeout           Reason = "timeout"
+	ReasonTLSError          Reason = "tls_error"
+	// Any other error making the request
+	ReasonRequestError Reason = "request_error"
+
+	ReasonHTTP5xx Reason = "http_5xx"
+	// Any other response status that isn't 2xx
+	ReasonHTTPStatus Reason = "http_status"
+	// The response body doesn't satisfy the status expression or body
+	// assertions
+	ReasonBodyMismatch Reason = "body_mismatch"
+	// One of the pod's named processes isn't healthy
+	ReasonProcessUnhealthy Reason = "process_unhealthy"
+	// The check itself is misconfigured, e.g. its status expression
+	// doesn't parse
+	ReasonInvalidCheck Reason = "invalid_check"
+	// A gRPC health check reported that the service isn't serving
+	ReasonGRPCNotServing Reason = "grpc_not_serving"
+	// None of the addresses the check is configured with could be found,
+	// e.g. the node's name has no addresses of the configured families
+	ReasonNoAddresses Reason = "no_addresses"
+	// An exec status check exited with a code other than 0
+	ReasonExitCode Reason = "exit_code"
+	// The health monitor is shutting down, so the service is no longer
+	// being checked
+	ReasonShuttingDown Reason = "shutting_down"
+	// Too few of the service's recent checks passed, or they were too
+	// slow, to meet its SLA. See manifest.SLAStanza
+	ReasonSLASuccessRate Reason = "sla_success_rate"
+	ReasonSLALatency     Reason = "sla_latency"
+	// The service hasn't been checked enough times yet to tell whether it
+	// meets its SLA
+	ReasonSLAPending Reason = "sla_pending"
+)
+
+// CheckConfig describes how a service's health is checked, so that consumers
+// of health results can tell what "passing" means for that service.
+type CheckConfig struct {
+	// The URI that is requested. Empty if the service has no status check
+	// and is always reported as passing
+	URI string `json:"uri,omitempty"`
+
+	// The unix socket that requests to the URI are made over, if the
+	// service's status endpoint is served on one
+	Socket string `json:"socket,omitempty"`
+
+	// The service name sent in gRPC health checks, whose URIs have the
+	// "grpc" scheme. Empty if the server as a whole is checked
+	GRPCService string `json:"grpc_service,omitempty"`
+
+	// The command of an exec status check, in which case URI is empty
+	Exec []string `json:"exec,omitempty"`
+
+	// The status expression that a JSON response must satisfy, if any.
+	// Otherwise any 2xx response is passing
+	Expression string `json:"expression,omitempty"`
+
+	// The regular expression that the body of a 2xx response must match,
+	// and the values that fields of its JSON body must have, if any
+	BodyRegex string            `json:"body_regex,omitempty"`
+	BodyJSON  map[string]string `json:"body_json,omitempty"`
+
+	// The HTTP method and headers of status requests, and the response
+	// codes that are passing, if they aren't the defaults
+	Method         string            `json:"method,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	ExpectedStatus string            `json:"expected_status,omitempty"`
+
+	// The URIs of the status checks of the pod's named processes, keyed by
+	// "<launchable>/<process>". Each must respond successfully for the
+	// service to be passing
+	Processes map[string]string `json:"processes,omitempty"`
+
+	// The configuration of each of the service's named checks
+	Checks map[string]*CheckConfig `json:"checks,omitempty"`
+
+	// RoleReadiness or RoleLiveness if this is a named check that only
+	// decides one of them
+	Role string `json:"role,omitempty"`
+
+	// The addresses that are checked in place of the URI's host, and
+	// whether "all" or "any" of them must be healthy
+	Addresses     []string `json:"addresses,omitempty"`
+	AddressPolicy string   `json:"address_policy,omitempty"`
+
+	Interval time.Duration `json:"interval"`
+	Timeout  time.Duration `json:"timeout"`
+
+	// How long a result is valid for unless it's rewritten. Zero if
+	// results are valid until the session of their writer expires
+	TTL time.Duration `json:"ttl,omitempty"`
+
+	// How many consecutive results it takes to report a passing service as
+	// critical, and a critical one as passing. Zero unless either is more
+	// than one
+	FailureThreshold int `json:"failure_threshold,omitempty"`
+	SuccessThreshold int `json:"success_threshold,omitempty"`
+
+	// How long after the pod is launched critical results are reported as
+	// unknown, if at all
+	GracePeriod time.Duration `json:"grace_period,omitempty"`
+
+	// The budget the service's recent checks must meet for it to be
+	// passing, if it has an SLA
+	SLA *SLAConfig `json:"sla,omitempty"`
+}
+
+// SLAConfig is the SLA of a service, see manifest.SLAStanza
+type SLAConfig struct {
+	Window              int           `json:"window"`
+	WarningSuccessRate  float64       `json:"warning_success_rate,omitempty"`
+	CriticalSuccessRate float64       `json:"critical_success_rate,omitempty"`
+	WarningP95Latency   time.Duration `json:"warning_p95_latency,omitempty"`
+	CriticalP95Latency  time.Duration `json:"critical_p95_latency,omitempty"`
+}
+
+// Equal returns whether two check configurations are the same. Either may be
+// nil.
+func (c *CheckConfig) Equal(other *CheckConfig) bool {
+	if c == nil || other == nil {
+		return c == other
+	}
+	return reflect.DeepEqual(*c, *other)
 }
 
 // ResultList is a type alias that adds some extra methods that operate on the list.
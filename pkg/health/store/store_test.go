@@ -32,6 +32,10 @@ func (hc *FakeHealthChecker) Service(serviceID string) (map[types.NodeName]healt
 	panic("not implemented")
 }
 
+func (hc *FakeHealthChecker) History(node types.NodeName, serviceID string, n int) ([]health.HistoryEntry, error) {
+	panic("not implemented")
+}
+
 func (hc *FakeHealthChecker) WatchHealth(resultCh chan []*health.Result, errCh chan<- error, quitCh <-chan struct{}, _ time.Duration) {
 	hc.results = resultCh
 	close(hc.ready)
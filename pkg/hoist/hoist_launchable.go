@@ -40,28 +40,31 @@ var IncludePodIDArg = param.Bool("include_pod_id_arg", false)
 
 // A HoistLaunchable represents a particular install of a hoist artifact.
 type Launchable struct {
-	Id               launch.LaunchableID        // A (pod-wise) unique identifier for this launchable, used to distinguish it from other launchables in the pod
-	Version          launch.LaunchableVersionID // A version identifier
-	PodID            types.PodID                // A (possibly-null) PodID denoting which launchable this belongs to
-	ServiceId        string                     // A (host-wise) unique identifier for this launchable, used when creating runit services
-	RunAs            string                     // The user to assume when launching the executable
-	OwnAs            string                     // The user that owns all the launcable's artifacts
-	PodEnvDir        string                     // The value for chpst -e. See http://smarden.org/runit/chpst.8.html
-	RootDir          string                     // The root directory of the launchable, containing N:N>=1 installs.
-	P2Exec           string                     // Struct that can be used to build a p2-exec invocation with appropriate flags
-	ExecNoLimit      bool                       // If set, execute with the -n (--no-limit) argument to p2-exec
-	PodCgroupConfig  cgroups.Config             // PodCgroupConfig
-	CgroupConfig     cgroups.Config             // Cgroup parameters to use with p2-exec
-	CgroupConfigName string                     // The string in PLATFORM_CONFIG to pass to p2-exec
-	CgroupName       string                     // The name of the cgroup to run this launchable in
-	RequireFile      string                     // Do not run this launchable until this file exists
-	RestartTimeout   time.Duration              // How long to wait when restarting the services in this launchable.
-	RestartPolicy_   runit.RestartPolicy        // Dictates whether the launchable should be automatically restarted upon exit.
-	NoHaltOnUpdate_  bool                       // If set, the launchable's process(es) should not be stopped if the pod is being updated (it will arrange for its own signaling)
-	SuppliedEnvVars  map[string]string          // A map of user-supplied environment variables to be exported for this launchable
-	Location         *url.URL                   // URL to download the artifact from
-	VerificationData auth.VerificationData      // Paths to files used to verify the artifact
-	EntryPoints      EntryPoints                // paths to entry points to launch under runit
+	Id               launch.LaunchableID             // A (pod-wise) unique identifier for this launchable, used to distinguish it from other launchables in the pod
+	Version          launch.LaunchableVersionID      // A version identifier
+	PodID            types.PodID                     // A (possibly-null) PodID denoting which launchable this belongs to
+	ServiceId        string                          // A (host-wise) unique identifier for this launchable, used when creating runit services
+	RunAs            string                          // The user to assume when launching the executable
+	OwnAs            string                          // The user that owns all the launcable's artifacts
+	PodEnvDir        string                          // The value for chpst -e. See http://smarden.org/runit/chpst.8.html
+	RootDir          string                          // The root directory of the launchable, containing N:N>=1 installs.
+	P2Exec           string                          // Struct that can be used to build a p2-exec invocation with appropriate flags
+	ExecNoLimit      bool                            // If set, execute with the -n (--no-limit) argument to p2-exec
+	PodCgroupConfig  cgroups.Config                  // PodCgroupConfig
+	CgroupConfig     cgroups.Config                  // Cgroup parameters to use with p2-exec
+	CgroupConfigName string                          // The string in PLATFORM_CONFIG to pass to p2-exec
+	CgroupName       string                          // The name of the cgroup to run this launchable in
+	RequireFile      string                          // Do not run this launchable until this file exists
+	RestartTimeout   time.Duration                   // How long to wait when restarting the services in this launchable.
+	RestartPolicy_   runit.RestartPolicy             // Dictates whether the launchable should be automatically restarted upon exit.
+	NoHaltOnUpdate_  bool                            // If set, the launchable's process(es) should not be stopped if the pod is being updated (it will arrange for its own signaling)
+	ReloadSignal     string                          // The signal that makes the launchable's processes reload their config, or "script" to run bin/reload. Defaults to HUP
+	StopSignal       string                          // The signal that asks the launchable's processes to stop. Defaults to runit's TERM
+	SuppliedEnvVars  map[string]string               // A map of user-supplied environment variables to be exported for this launchable
+	Location         *url.URL                        // URL to download the artifact from
+	VerificationData auth.VerificationData           // Paths to files used to verify the artifact
+	EntryPoints      EntryPoints                     // paths to entry points to launch under runit
+	Processes        map[string]launch.ProcessStanza // named processes to launch under runit instead of EntryPoints
 
 	// IsUUIDPod indicates whether the launchable is part of a "uuid pod"
 	// vs a "legacy pod". Currently this information is used for determining the name of the runit service directories to use
@@ -164,6 +167,30 @@ func (hl *Launchable) Launch(serviceBuilder *runit.ServiceBuilder, sv runit.SV)
 	return nil
 }
 
+func (hl *Launchable) Reload(serviceBuilder *runit.ServiceBuilder, sv runit.SV) error {
+	if hl.ReloadSignal == launch.ReloadScript {
+		output, err := hl.InvokeBinScript("reload")
+		if err != nil {
+			return util.Errorf("Could not reload %s: %s\n%s", hl.ServiceId, err, output)
+		}
+		return nil
+	}
+
+	signal := runit.SignalHUP
+	if hl.ReloadSignal != "" {
+		var err error
+		signal, err = runit.ParseSignal(hl.ReloadSignal)
+		if err != nil {
+			return err
+		}
+	}
+	executables, err := hl.Executables(serviceBuilder)
+	if err != nil {
+		return err
+	}
+	return launch.SignalExecutables(executables, sv, signal)
+}
+
 func (hl *Launchable) PostActivate() (string, error) {
 	// TODO: unexport this method (requires integrating BuildRunitServices into this API)
 	output, err := hl.InvokeBinScript("post-activate")
@@ -176,6 +203,17 @@ func (hl *Launchable) PostActivate() (string, error) {
 	return output, nil
 }
 
+func (hl *Launchable) Migrate() (string, error) {
+	output, err := hl.InvokeBinScript("migrate")
+
+	// providing a migrate script is optional, ignore those errors
+	if err != nil && !os.IsNotExist(err) {
+		return output, err
+	}
+
+	return output, nil
+}
+
 func (hl *Launchable) disable() (string, error) {
 	output, err := hl.InvokeBinScript("disable")
 
@@ -243,8 +281,16 @@ func (hl *Launchable) stop(serviceBuilder *runit.ServiceBuilder, sv runit.SV) er
 		return err
 	}
 
+	stopSignal := runit.SignalTERM
+	if hl.StopSignal != "" {
+		stopSignal, err = runit.ParseSignal(hl.StopSignal)
+		if err != nil {
+			return err
+		}
+	}
+
 	for _, executable := range executables {
-		_, err := sv.Stop(&executable.Service, hl.RestartTimeout)
+		_, err := runit.StopWithSignal(sv, &executable.Service, stopSignal, hl.RestartTimeout)
 		if err != nil && err != runit.Killed {
 			// TODO: FAILURE SCENARIO (what should we do here?)
 			// 1) does `sv stop` ever exit nonzero?
@@ -265,7 +311,11 @@ func (hl *Launchable) start(serviceBuilder *runit.ServiceBuilder, sv runit.SV) e
 
 	for _, executable := range executables {
 		var err error
-		if hl.RestartPolicy_ == runit.RestartPolicyAlways {
+		restartPolicy := executable.RestartPolicy
+		if restartPolicy == "" {
+			restartPolicy = hl.RestartPolicy_
+		}
+		if restartPolicy == runit.RestartPolicyAlways {
 			// TODO: can we use start always?
 			if hl.NoHaltOnUpdate_ {
 				_, err = sv.Start(&executable.Service)
@@ -321,6 +371,10 @@ func (hl *Launchable) Executables(
 		return []launch.Executable{}, util.Errorf("%s is not installed", hl.ServiceId)
 	}
 
+	if len(hl.Processes) > 0 {
+		return hl.processExecutables(serviceBuilder)
+	}
+
 	// Maps service name to a launch.Executable to guarantee that no two services can share
 	// a name.
 	executableMap := make(map[string]launch.Executable)
@@ -382,34 +436,8 @@ func (hl *Launchable) Executables(
 				return nil, util.Errorf("Multiple services found with name %s", serviceName)
 			}
 
-			p2ExecArgs := p2exec.P2ExecArgs{
-				Command:          []string{filepath.Join(hl.InstallDir(), relativePath)},
-				User:             hl.RunAs,
-				EnvDirs:          []string{hl.PodEnvDir, hl.EnvDir()},
-				ExtraEnv:         map[string]string{launch.EntryPointEnvVar: relativePath},
-				NoLimits:         hl.ExecNoLimit,
-				CgroupConfigName: hl.CgroupConfigName,
-				CgroupName:       hl.CgroupName,
-				RequireFile:      hl.RequireFile,
-			}
-			if *IncludePodIDArg {
-				p2ExecArgs.PodID = &hl.PodID
-			}
-			execCmd := append([]string{hl.P2Exec}, p2ExecArgs.CommandLine()...)
-
-			executableMap[serviceName] = launch.Executable{
-				ServiceName:  entryPointName,
-				RelativePath: relativePath,
-				Service: runit.Service{
-					Path: filepath.Join(serviceBuilder.RunitRoot, serviceName),
-					Name: serviceName,
-				},
-				LogAgent: runit.Service{
-					Path: filepath.Join(serviceBuilder.RunitRoot, serviceName, "log"),
-					Name: serviceName + " logAgent",
-				},
-				Exec: execCmd,
-			}
+			command := []string{filepath.Join(hl.InstallDir(), relativePath)}
+			executableMap[serviceName] = hl.executable(serviceBuilder, entryPointName, relativePath, command)
 		}
 	}
 
@@ -421,6 +449,61 @@ func (hl *Launchable) Executables(
 	return executables, nil
 }
 
+// processExecutables returns an executable for each of the launchable's named
+// processes. Their service names are <service id>__<process name> regardless
+// of whether the launchable is part of a uuid pod.
+func (hl *Launchable) processExecutables(serviceBuilder *runit.ServiceBuilder) ([]launch.Executable, error) {
+	var executables []launch.Executable
+	for name, process := range hl.Processes {
+		absEntryPointPath := filepath.Join(hl.InstallDir(), process.EntryPoint)
+		if _, err := os.Stat(absEntryPointPath); err != nil {
+			return nil, MissingEntryPoints{
+				message: util.Errorf("missing entry point %s for process %s: %s", absEntryPointPath, name, err).Error(),
+			}
+		}
+
+		command := append([]string{absEntryPointPath}, process.Args...)
+		executable := hl.executable(serviceBuilder, name, name, command)
+		executable.RestartPolicy = process.RestartPolicy(hl.RestartPolicy_)
+		executables = append(executables, executable)
+	}
+	return executables, nil
+}
+
+func (hl *Launchable) executable(serviceBuilder *runit.ServiceBuilder, entryPointName string, relativePath string, command []string) launch.Executable {
+	serviceName := fmt.Sprintf("%s__%s", hl.ServiceId, entryPointName)
+
+	p2ExecArgs := p2exec.P2ExecArgs{
+		Command:          command,
+		User:             hl.RunAs,
+		EnvDirs:          []string{hl.PodEnvDir, hl.EnvDir()},
+		ExtraEnv:         map[string]string{launch.EntryPointEnvVar: relativePath},
+		NoLimits:         hl.ExecNoLimit,
+		CgroupConfigName: hl.CgroupConfigName,
+		CgroupName:       hl.CgroupName,
+		RequireFile:      hl.RequireFile,
+	}
+	if *IncludePodIDArg {
+		p2ExecArgs.PodID = &hl.PodID
+	}
+	execCmd := append([]string{hl.P2Exec}, p2ExecArgs.CommandLine()...)
+
+	return launch.Executable{
+		ServiceName:  entryPointName,
+		RelativePath: relativePath,
+		Service: runit.Service{
+			Path: filepath.Join(serviceBuilder.RunitRoot, serviceName),
+			Name: serviceName,
+		},
+		LogAgent: runit.Service{
+			Path: filepath.Join(serviceBuilder.RunitRoot, serviceName, "log"),
+			Name: serviceName + " logAgent",
+		},
+		Exec:       execCmd,
+		CgroupName: hl.CgroupName,
+	}
+}
+
 func (hl *Launchable) Installed() bool {
 	installDir := hl.InstallDir()
 	_, err := os.Stat(installDir)
@@ -6,6 +6,7 @@ import (
 	"path"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/runit"
@@ -179,6 +180,52 @@ func TestErrorIfConflictingServiceNames(t *testing.T) {
 	Assert(t).AreEqual(0, len(executables), "Found an unexpected number of runit services")
 }
 
+func TestNamedProcesses(t *testing.T) {
+	// This test's behavior is not dependent on whether the pod is a legacy or uuid pod
+	fakeLaunchable, sb := FakeHoistLaunchableForDirUUIDPod("multiple_script_test_hoist_launchable")
+	defer CleanupFakeLaunchable(fakeLaunchable, sb)
+
+	fakeLaunchable.RestartPolicy_ = runit.RestartPolicyAlways
+	fakeLaunchable.Processes = map[string]launch.ProcessStanza{
+		"web":    {EntryPoint: "bin/start", Args: []string{"--port", "8080"}},
+		"worker": {EntryPoint: "bin/start", Args: []string{"--worker"}},
+		"cron":   {EntryPoint: "bin/launch/script1", RestartPolicy_: runit.RestartPolicyNever},
+	}
+	executables, err := fakeLaunchable.Executables(runit.DefaultBuilder)
+	Assert(t).IsNil(err, "Error occurred when obtaining runit services for launchable")
+
+	expectedServicePaths := []string{
+		"/var/service/testPod__testLaunchable__web",
+		"/var/service/testPod__testLaunchable__worker",
+		"/var/service/testPod__testLaunchable__cron",
+	}
+	Assert(t).AreEqual(3, len(executables), "Found an unexpected number of runit services")
+	assertExpectedServices(t, expectedServicePaths, executables)
+
+	for _, executable := range executables {
+		exec := strings.Join(executable.Exec, " ")
+		Assert(t).IsTrue(strings.Contains(exec, launch.EntryPointEnvVar+"="+executable.ServiceName), fmt.Sprintf("expected the process name as the entry point in %q", exec))
+		switch executable.ServiceName {
+		case "web":
+			Assert(t).IsTrue(strings.HasSuffix(exec, "bin/start --port 8080"), fmt.Sprintf("expected web arguments in %q", exec))
+			Assert(t).AreEqual(executable.RestartPolicy, runit.RestartPolicyAlways, "expected the launchable's restart policy")
+		case "cron":
+			Assert(t).AreEqual(executable.RestartPolicy, runit.RestartPolicyNever, "expected the process's restart policy")
+		}
+	}
+}
+
+func TestMissingNamedProcessEntryPointError(t *testing.T) {
+	fakeLaunchable, sb := FakeHoistLaunchableForDirUUIDPod("multiple_script_test_hoist_launchable")
+	defer CleanupFakeLaunchable(fakeLaunchable, sb)
+
+	fakeLaunchable.Processes = map[string]launch.ProcessStanza{
+		"web": {EntryPoint: "bin/missing"},
+	}
+	_, err := fakeLaunchable.Executables(runit.DefaultBuilder)
+	Assert(t).IsTrue(IsMissingEntryPoints(err), "expected an error if a named process's entry point is missing")
+}
+
 func TestSingleRunitServiceLegacy(t *testing.T) {
 	launchable, sb := FakeHoistLaunchableForDirLegacyPod("single_script_test_hoist_launchable")
 	defer CleanupFakeLaunchable(launchable, sb)
@@ -404,6 +451,38 @@ func TestStop(t *testing.T) {
 	Assert(t).IsNil(err, "Got an unexpected error when attempting to stop runit services")
 }
 
+func TestStopWithStopSignal(t *testing.T) {
+	hl, sb := FakeHoistLaunchableForDirLegacyPod("multiple_script_test_hoist_launchable")
+	defer CleanupFakeLaunchable(hl, sb)
+	hl.StopSignal = "SIGQUIT"
+	hl.RestartTimeout = time.Second
+
+	sv := runit.NewRecordingSV().(*runit.RecordingSV)
+	err := hl.stop(sb, sv)
+	Assert(t).IsNil(err, "Got an unexpected error when attempting to stop runit services")
+	Assert(t).AreEqual(
+		fmt.Sprint(sv.Commands),
+		fmt.Sprint([]string{"once", "quit", "stat", "stop", "once", "quit", "stat", "stop"}),
+		"should have sent the stop signal to each service before stopping it",
+	)
+}
+
+func TestReloadSignalsServices(t *testing.T) {
+	hl, sb := FakeHoistLaunchableForDirLegacyPod("multiple_script_test_hoist_launchable")
+	defer CleanupFakeLaunchable(hl, sb)
+
+	sv := runit.NewRecordingSV().(*runit.RecordingSV)
+	err := hl.Reload(sb, sv)
+	Assert(t).IsNil(err, "Got an unexpected error when attempting to reload runit services")
+	Assert(t).AreEqual(fmt.Sprint(sv.Commands), fmt.Sprint([]string{"hup", "hup"}), "should have sent each service a HUP by default")
+
+	hl.ReloadSignal = "SIGUSR2"
+	sv = runit.NewRecordingSV().(*runit.RecordingSV)
+	err = hl.Reload(sb, sv)
+	Assert(t).IsNil(err, "Got an unexpected error when attempting to reload runit services")
+	Assert(t).AreEqual(fmt.Sprint(sv.Commands), fmt.Sprint([]string{"2", "2"}), "should have sent each service the reload signal")
+}
+
 func TestNoDisableForUUIDPods(t *testing.T) {
 	hl, sb := FakeHoistLaunchableForDirUUIDPod("failing_scripts_test_hoist_launchable")
 	defer CleanupFakeLaunchable(hl, sb)
@@ -8,11 +8,14 @@ import (
 	"os/exec"
 	"path"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
 )
 
 func NewContext(dirpath string, podRoot string, logger *logging.Logger, auditLogger AuditLogger) *hookContext {
@@ -24,24 +27,57 @@ func NewContext(dirpath string, podRoot string, logger *logging.Logger, auditLog
 	}
 }
 
-// runDirectory executes all executable files in a given directory path.
-func (h *hookContext) runDirectory(hookEnv *HookExecutionEnvironment, logger logging.Logger) error {
+// SetResultRecorder makes the results of the hooks that are run for a pod be
+// passed to recorder
+func (h *hookContext) SetResultRecorder(recorder ResultRecorder) {
+	h.resultRecorder = recorder
+}
+
+// runDirectory executes all executable files in a given directory path, and
+// returns the result of each. Each hook is run per its policy, and if a
+// failed hook's policy aborts the install of the hooked pod the remaining
+// hooks aren't run and ErrHookAborted is returned along with the results so
+// far.
+func (h *hookContext) runDirectory(hookEnv *HookExecutionEnvironment, logger logging.Logger) ([]podstatus.HookResult, error) {
 	entries, err := ioutil.ReadDir(h.dirpath)
 	if os.IsNotExist(err) {
 		logger.WithField("dir", h.dirpath).Debugln("Hooks not set up")
-		return nil
+		return nil, nil
 	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	event := HookType(hookEnv.HookEventEnvVar)
+	var results []podstatus.HookResult
 	for _, f := range entries {
+		if strings.HasPrefix(f.Name(), ".") {
+			// hidden files include the temporary files of
+			// interrupted atomic writes and hook policies
+			continue
+		}
 		fullpath := path.Join(h.dirpath, f.Name())
-		hec := NewHookExecContext(fullpath, f.Name(), DefaultTimeout, *hookEnv, logger)
+		policy, err := ReadPolicy(fullpath)
+		if err != nil {
+			logger.WithErrorAndFields(err, logrus.Fields{
+				"path": fullpath,
+			}).Warnln("Could not read hook policy, using the default")
+			policy = DefaultPolicy
+		}
+		hec := NewHookExecContext(fullpath, f.Name(), policy.Timeout, *hookEnv, logger)
 		executable := (f.Mode() & 0111) != 0
 		if !executable {
 			h.auditLogger.LogFailure(hec, nil)
 			logger.WithField("path", fullpath).Warnln("Hook is not executable")
+			if !f.IsDir() {
+				results = append(results, podstatus.HookResult{
+					Hook:     hec.Name,
+					Event:    hookEnv.HookEventEnvVar,
+					Time:     time.Now(),
+					ExitCode: -1,
+					Error:    "hook is not executable",
+				})
+			}
 			continue
 		}
 		if f.IsDir() {
@@ -53,22 +89,53 @@ func (h *hookContext) runDirectory(hookEnv *HookExecutionEnvironment, logger log
 			"hook_name": hec.Name,
 		})
 
-		err := hec.RunWithTimeout(logger)
+		var result podstatus.HookResult
+		for attempt := 1; attempt <= policy.Retries+1; attempt++ {
+			result, err = hec.runWithTimeout(logger)
+			if policy.Retries > 0 {
+				result.Attempts = attempt
+			}
+			if err == nil && !result.Failed() {
+				break
+			}
+			if attempt <= policy.Retries {
+				logger.WithField("attempt", attempt).Warnln("Hook failed, retrying")
+			}
+		}
+		result.Event = hookEnv.HookEventEnvVar
+
 		if htErr, ok := err.(ErrHookTimeout); ok {
 			h.auditLogger.LogFailure(hec, err)
 			logger.WithErrorAndFields(htErr, logrus.Fields{
 				"timeout": hec.Timeout,
 			}).Warnln(htErr.Error())
-			// we intentionally swallow timeout HookTimeoutErrors
-			continue
+			// timeouts are handled by the hook's failure strategy below
 		} else if err != nil {
 			h.auditLogger.LogFailure(hec, err)
 			logger.WithError(err).Warningf("Unknown error in hook %s: %s", hec.Name, err)
+		} else {
+			h.auditLogger.LogSuccess(hec)
+		}
+
+		if !result.Failed() {
+			results = append(results, result)
 			continue
 		}
-		h.auditLogger.LogSuccess(hec)
+		switch policy.OnFailure {
+		case manifest.HookFailureDegrade:
+			result.Degraded = true
+			logger.NoFields().Errorln("Hook failed, marking the pod as degraded")
+		case manifest.HookFailureAbort:
+			if canAbort(event) {
+				results = append(results, result)
+				logger.NoFields().Errorln("Hook failed, aborting the install of the pod")
+				return results, ErrHookAborted{Hook: hec.Name, Event: event}
+			}
+			logger.NoFields().Warnf("Hook failed, but %s hooks can't abort an install", event)
+		}
+		results = append(results, result)
 	}
-	return nil
+	return results, nil
 }
 
 func (h *hookContext) Close() error {
@@ -82,31 +149,70 @@ func (h *hookContext) Close() error {
 //
 // NB: in the event of a timeout this will leak descriptors
 func (h *HookExecContext) RunWithTimeout(logger logging.Logger) error {
-	finished := make(chan struct{})
+	_, err := h.runWithTimeout(logger)
+	return err
+}
+
+// runWithTimeout is RunWithTimeout, but also returns the result of the hook.
+// The result of a hook that times out only records that it did.
+func (h *HookExecContext) runWithTimeout(logger logging.Logger) (podstatus.HookResult, error) {
+	start := time.Now()
+	finished := make(chan podstatus.HookResult, 1)
 	go func() {
-		h.Run(logger)
-		close(finished)
+		finished <- h.run(logger)
 	}()
 
 	select {
-	case <-finished:
+	case result := <-finished:
+		return result, nil
 	case <-time.After(h.Timeout):
-		return ErrHookTimeout{*h}
+		err := ErrHookTimeout{*h}
+		return podstatus.HookResult{
+			Hook:     h.Name,
+			Time:     time.Now(),
+			Duration: time.Since(start),
+			ExitCode: -1,
+			TimedOut: true,
+			Error:    err.Error(),
+		}, err
 	}
-
-	return nil
 }
 
 // Run executes the hook in the context of its environment and logs the output
 func (h *HookExecContext) Run(logger logging.Logger) {
+	h.run(logger)
+}
+
+func (h *HookExecContext) run(logger logging.Logger) podstatus.HookResult {
 	logger.Infof("Executing hook %s", h.Name)
+	start := time.Now()
 	cmd := exec.Command(h.Path)
 	hookOut := &bytes.Buffer{}
 	cmd.Stdout = hookOut
 	cmd.Stderr = hookOut
 	cmd.Env = h.env.Env()
 	err := cmd.Run()
+
+	result := podstatus.HookResult{
+		Hook:     h.Name,
+		Time:     time.Now(),
+		Duration: time.Since(start),
+	}
+	output := hookOut.Bytes()
+	if len(output) > podstatus.MaxHookOutputBytes {
+		output = output[len(output)-podstatus.MaxHookOutputBytes:]
+		result.OutputTruncated = true
+	}
+	result.Output = string(output)
+
 	if err != nil {
+		result.ExitCode = -1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Exited() {
+				result.ExitCode = status.ExitStatus()
+			}
+		}
+		result.Error = err.Error()
 		logger.WithErrorAndFields(err, logrus.Fields{
 			"output": hookOut.String(),
 		}).Warnf("Could not execute hook %s", h.Name)
@@ -115,6 +221,7 @@ func (h *HookExecContext) Run(logger logging.Logger) {
 			"output": hookOut.String(),
 		}).Debugln("Executed hook")
 	}
+	return result
 }
 
 func (h *hookContext) runHooks(dirpath string, hType HookType, pod Pod, podManifest manifest.Manifest, logger logging.Logger) error {
@@ -157,7 +264,11 @@ func (h *hookContext) runHooks(dirpath string, hType HookType, pod Pod, podManif
 		HookedPodUniqueKeyEnvVar:  pod.UniqueKey().String(),
 		HookedPodReadOnly:         strconv.FormatBool(podManifest.GetReadOnly()),
 	}
-	return h.runDirectory(hec, logger)
+	results, err := h.runDirectory(hec, logger)
+	if h.resultRecorder != nil && len(results) > 0 {
+		h.resultRecorder.RecordHookResults(pod, podManifest.ID(), hType, results)
+	}
+	return err
 }
 
 func (h *hookContext) RunHookType(hookType HookType, pod Pod, manifest manifest.Manifest) error {
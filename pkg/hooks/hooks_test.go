@@ -1,10 +1,12 @@
 package hooks
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,6 +16,8 @@ import (
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
+	"github.com/square/p2/pkg/types"
 )
 
 const podId = "TestPod"
@@ -170,3 +174,144 @@ func tempFileWithContents(name string, contents []byte) (string, error) {
 
 	return path, nil
 }
+
+type fakeResultRecorder struct {
+	podID   types.PodID
+	event   HookType
+	results []podstatus.HookResult
+}
+
+func (f *fakeResultRecorder) RecordHookResults(pod Pod, podID types.PodID, event HookType, results []podstatus.HookResult) {
+	f.podID = podID
+	f.event = event
+	f.results = results
+}
+
+func TestHookResultsAreRecorded(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "hook")
+	Assert(t).IsNil(err, "the error should have been nil")
+	defer os.RemoveAll(tempDir)
+
+	podDir, err := ioutil.TempDir("", "pod")
+	defer os.RemoveAll(podDir)
+	Assert(t).IsNil(err, "the error should have been nil")
+
+	ioutil.WriteFile(path.Join(tempDir, "a_fails"), []byte("#!/bin/sh\necho disk full >&2\nexit 3"), 0755)
+	ioutil.WriteFile(path.Join(tempDir, "b_noisy"), []byte(fmt.Sprintf("#!/bin/sh\nyes | head -c %d\necho end", 2*podstatus.MaxHookOutputBytes)), 0755)
+	ioutil.WriteFile(path.Join(tempDir, "c_not_executable"), []byte("#!/bin/sh\n"), 0644)
+	ioutil.WriteFile(path.Join(podDir, "current_manifest.yaml"), []byte("id: my_hook"), 0755)
+
+	hooks := NewContext(tempDir, pods.DefaultPath, &logging.DefaultLogger, NewFileAuditLogger(&logging.DefaultLogger))
+	recorder := &fakeResultRecorder{}
+	hooks.SetResultRecorder(recorder)
+	pod, err := pods.PodFromPodHome("testNode", podDir)
+	Assert(t).IsNil(err, "the error should have been nil")
+	err = hooks.runHooks(tempDir, BeforeInstall, pod, testManifest(), logging.DefaultLogger)
+	Assert(t).IsNil(err, "the error should have been nil")
+
+	Assert(t).AreEqual(recorder.podID, types.PodID(podId), "results should be recorded for the pod")
+	Assert(t).AreEqual(recorder.event, BeforeInstall, "results should be recorded for the event")
+	if len(recorder.results) != 3 {
+		t.Fatalf("expected 3 results, got %+v", recorder.results)
+	}
+
+	failed := recorder.results[0]
+	if failed.Hook != "a_fails" || failed.Event != BeforeInstall.String() || failed.ExitCode != 3 || failed.Output != "disk full\n" || !failed.Failed() {
+		t.Errorf("unexpected result of the failing hook: %+v", failed)
+	}
+
+	noisy := recorder.results[1]
+	if noisy.ExitCode != 0 || noisy.Failed() || !noisy.OutputTruncated || len(noisy.Output) != podstatus.MaxHookOutputBytes || !strings.HasSuffix(noisy.Output, "y\nend\n") {
+		t.Errorf("expected the end of the noisy hook's output to be kept, got %d bytes, truncated: %t", len(noisy.Output), noisy.OutputTruncated)
+	}
+
+	notExecutable := recorder.results[2]
+	if notExecutable.Hook != "c_not_executable" || !notExecutable.Failed() {
+		t.Errorf("expected the non-executable hook to be recorded as failed, got %+v", notExecutable)
+	}
+}
+
+func TestHookPolicies(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "hook")
+	Assert(t).IsNil(err, "the error should have been nil")
+	defer os.RemoveAll(tempDir)
+
+	podDir, err := ioutil.TempDir("", "pod")
+	defer os.RemoveAll(podDir)
+	Assert(t).IsNil(err, "the error should have been nil")
+	ioutil.WriteFile(path.Join(podDir, "current_manifest.yaml"), []byte("id: my_hook"), 0755)
+
+	// fails the first time it is run
+	flaky := path.Join(tempDir, "a_flaky")
+	ioutil.WriteFile(flaky, []byte("#!/bin/sh\nif [ -e $(dirname $0)/.flaky_ran ]; then exit 0; fi\ntouch $(dirname $0)/.flaky_ran\nexit 1"), 0755)
+	err = WritePolicy(flaky, manifest.HookPolicyStanza{Retries: 2})
+	Assert(t).IsNil(err, "the error should have been nil")
+
+	slow := path.Join(tempDir, "b_slow")
+	ioutil.WriteFile(slow, []byte("#!/bin/sh\nsleep 5"), 0755)
+	err = WritePolicy(slow, manifest.HookPolicyStanza{Timeout: "100ms", OnFailure: manifest.HookFailureDegrade})
+	Assert(t).IsNil(err, "the error should have been nil")
+
+	failing := path.Join(tempDir, "c_failing")
+	ioutil.WriteFile(failing, []byte("#!/bin/sh\nexit 1"), 0755)
+	err = WritePolicy(failing, manifest.HookPolicyStanza{OnFailure: manifest.HookFailureAbort})
+	Assert(t).IsNil(err, "the error should have been nil")
+
+	ioutil.WriteFile(path.Join(tempDir, "d_after"), []byte("#!/bin/sh\ntouch $(dirname $0)/after_ran"), 0755)
+
+	hooks := NewContext(tempDir, pods.DefaultPath, &logging.DefaultLogger, NewFileAuditLogger(&logging.DefaultLogger))
+	recorder := &fakeResultRecorder{}
+	hooks.SetResultRecorder(recorder)
+	pod, err := pods.PodFromPodHome("testNode", podDir)
+	Assert(t).IsNil(err, "the error should have been nil")
+
+	err = hooks.runHooks(tempDir, BeforeInstall, pod, testManifest(), logging.DefaultLogger)
+	if !IsHookAborted(err) {
+		t.Fatalf("expected the failing hook to abort the install, got %v", err)
+	}
+	if _, err := os.Stat(path.Join(tempDir, "after_ran")); err == nil {
+		t.Error("expected the hooks after an aborting hook not to run")
+	}
+	if len(recorder.results) != 3 {
+		t.Fatalf("expected 3 results, got %+v", recorder.results)
+	}
+	if flakyRes := recorder.results[0]; flakyRes.Failed() || flakyRes.Attempts != 2 {
+		t.Errorf("expected the flaky hook to pass when retried, got %+v", flakyRes)
+	}
+	if slowRes := recorder.results[1]; !slowRes.TimedOut || !slowRes.Degraded {
+		t.Errorf("expected the slow hook to time out and mark the pod as degraded, got %+v", slowRes)
+	}
+	if !podstatus.HooksDegraded(recorder.results) {
+		t.Error("expected the results to mark the pod as degraded")
+	}
+
+	// after_launch hooks run after the install, so they can't abort it
+	err = hooks.runHooks(tempDir, AfterLaunch, pod, testManifest(), logging.DefaultLogger)
+	Assert(t).IsNil(err, "the error should have been nil")
+	if _, err := os.Stat(path.Join(tempDir, "after_ran")); err != nil {
+		t.Error("expected the hooks after a failing after_launch hook to run")
+	}
+}
+
+func TestReadPolicy(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "hook")
+	Assert(t).IsNil(err, "the error should have been nil")
+	defer os.RemoveAll(tempDir)
+	hookPath := path.Join(tempDir, "hook")
+
+	policy, err := ReadPolicy(hookPath)
+	Assert(t).IsNil(err, "the error should have been nil")
+	Assert(t).AreEqual(policy, DefaultPolicy, "hooks without a policy file should get the default policy")
+
+	err = WritePolicy(hookPath, manifest.HookPolicyStanza{Timeout: "30s", Retries: 1})
+	Assert(t).IsNil(err, "the error should have been nil")
+	policy, err = ReadPolicy(hookPath)
+	Assert(t).IsNil(err, "the error should have been nil")
+	expected := Policy{Timeout: 30 * time.Second, Retries: 1, OnFailure: manifest.HookFailureContinue}
+	Assert(t).AreEqual(policy, expected, "did not read the policy")
+
+	err = ioutil.WriteFile(PolicyPath(hookPath), []byte("on_failure: explode\n"), 0644)
+	Assert(t).IsNil(err, "the error should have been nil")
+	_, err = ReadPolicy(hookPath)
+	Assert(t).IsNotNil(err, "an invalid policy should be an error")
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/pods"
 	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
 )
 
@@ -22,20 +23,9 @@ func InstallHookScripts(dir string, hookPod *pods.Pod, manifest manifest.Manifes
 		return err
 	}
 
-	// TODO: globbing based on the structure of the name is gross, each hook pod
-	// should have its own dir of scripts and running hooks should iterate over
-	// the directories
-	rmPattern := filepath.Join(dir, fmt.Sprintf("%s__*", hookPod.Id))
-	matches, err := filepath.Glob(rmPattern)
+	err = RemoveHookScripts(dir, hookPod.Id, logger)
 	if err != nil {
-		// error return from filepath.Glob is guaranteed to be ErrBadPattern
-		return util.Errorf("error while removing old hook scripts: pattern %q is malformed", rmPattern)
-	}
-	for _, match := range matches {
-		err = os.Remove(match)
-		if err != nil {
-			logger.WithErrorAndFields(err, logrus.Fields{"script_path": match}).Errorln("Could not remove old hook script")
-		}
+		return err
 	}
 
 	launchables, err := hookPod.Launchables(manifest)
@@ -59,15 +49,18 @@ func InstallHookScripts(dir string, hookPod *pods.Pod, manifest manifest.Manifes
 			// Write a script to the event directory that executes the pod's executables
 			// with the correct environment for that pod.
 			scriptPath := filepath.Join(dir, executable.Service.Name)
-			file, err := os.OpenFile(scriptPath, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0744)
-			defer file.Close()
-			if err != nil {
-				logger.WithErrorAndFields(err, logrus.Fields{"script_path": scriptPath}).Errorln("Could not open new hook script")
-			}
-			err = executable.WriteExecutor(file)
+			opts := util.DefaultAtomicWriteOptions
+			opts.Perm = 0744
+			err = util.WriteAtomic(scriptPath, opts, executable.WriteExecutor)
 			if err != nil {
 				logger.WithErrorAndFields(err, logrus.Fields{"script_path": scriptPath}).Errorln("Could not write new hook script")
 			}
+			if !manifest.GetHookPolicy().IsEmpty() {
+				err = WritePolicy(scriptPath, manifest.GetHookPolicy())
+				if err != nil {
+					logger.WithErrorAndFields(err, logrus.Fields{"script_path": scriptPath}).Errorln("Could not write hook policy")
+				}
+			}
 		}
 		// for convenience as we do with regular launchables, make these ones
 		// current under the launchable directory
@@ -79,3 +72,29 @@ func InstallHookScripts(dir string, hookPod *pods.Pod, manifest manifest.Manifes
 	}
 	return nil
 }
+
+// RemoveHookScripts removes the executor scripts, and their policies, that
+// InstallHookScripts wrote to the directory for the hook pod
+func RemoveHookScripts(dir string, podID types.PodID, logger logging.Logger) error {
+	// TODO: globbing based on the structure of the name is gross, each hook pod
+	// should have its own dir of scripts and running hooks should iterate over
+	// the directories
+	rmPattern := filepath.Join(dir, fmt.Sprintf("%s__*", podID))
+	matches, err := filepath.Glob(rmPattern)
+	if err != nil {
+		// error return from filepath.Glob is guaranteed to be ErrBadPattern
+		return util.Errorf("error while removing old hook scripts: pattern %q is malformed", rmPattern)
+	}
+	policyMatches, err := filepath.Glob(PolicyPath(rmPattern))
+	if err != nil {
+		return util.Errorf("error while removing old hook policies: pattern %q is malformed", PolicyPath(rmPattern))
+	}
+	matches = append(matches, policyMatches...)
+	for _, match := range matches {
+		err = os.Remove(match)
+		if err != nil {
+			logger.WithErrorAndFields(err, logrus.Fields{"script_path": match}).Errorln("Could not remove old hook script")
+		}
+	}
+	return nil
+}
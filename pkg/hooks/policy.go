@@ -0,0 +1,84 @@
+package hooks
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/util"
+)
+
+// Policy is how a hook is run and what its failure does. Hooks without a
+// policy file get DefaultPolicy.
+type Policy struct {
+	Timeout   time.Duration
+	Retries   int
+	OnFailure manifest.HookFailureStrategy
+}
+
+var DefaultPolicy = Policy{
+	Timeout:   DefaultTimeout,
+	OnFailure: manifest.HookFailureContinue,
+}
+
+// PolicyFromStanza builds the policy of a hook from the hook_policy stanza of
+// its manifest
+func PolicyFromStanza(stanza manifest.HookPolicyStanza) (Policy, error) {
+	if err := stanza.Validate(); err != nil {
+		return Policy{}, util.Errorf("invalid hook policy: %s", err)
+	}
+	policy := DefaultPolicy
+	timeout, _ := stanza.GetTimeout()
+	if timeout != 0 {
+		policy.Timeout = timeout
+	}
+	policy.Retries = stanza.Retries
+	policy.OnFailure = stanza.GetOnFailure()
+	return policy, nil
+}
+
+// PolicyPath returns where the policy of the hook at hookPath is kept. The
+// file is a hook_policy stanza in YAML. It is hidden so that it isn't
+// mistaken for a hook itself.
+func PolicyPath(hookPath string) string {
+	dir, name := filepath.Split(hookPath)
+	return filepath.Join(dir, "."+name+".policy")
+}
+
+// WritePolicy writes the policy file of the hook at hookPath
+func WritePolicy(hookPath string, stanza manifest.HookPolicyStanza) error {
+	policyBytes, err := yaml.Marshal(stanza)
+	if err != nil {
+		return util.Errorf("could not marshal hook policy: %s", err)
+	}
+	return util.WriteFileAtomic(PolicyPath(hookPath), policyBytes, util.DefaultAtomicWriteOptions)
+}
+
+// ReadPolicy reads the policy of the hook at hookPath, which is DefaultPolicy
+// if it has no policy file
+func ReadPolicy(hookPath string) (Policy, error) {
+	policyBytes, err := ioutil.ReadFile(PolicyPath(hookPath))
+	if os.IsNotExist(err) {
+		return DefaultPolicy, nil
+	}
+	if err != nil {
+		return Policy{}, util.Errorf("could not read hook policy: %s", err)
+	}
+
+	var stanza manifest.HookPolicyStanza
+	err = yaml.Unmarshal(policyBytes, &stanza)
+	if err != nil {
+		return Policy{}, util.Errorf("could not parse hook policy: %s", err)
+	}
+	return PolicyFromStanza(stanza)
+}
+
+// canAbort returns whether hooks of the event run before the hooked pod is
+// launched, which is when a failed hook can still abort its install
+func canAbort(event HookType) bool {
+	return event == BeforeInstall || event == AfterInstall || event == BeforeLaunch
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
 	"github.com/square/p2/pkg/types"
 )
 
@@ -80,10 +81,11 @@ type Pod interface {
 }
 
 type hookContext struct {
-	dirpath     string
-	podRoot     string
-	logger      *logging.Logger
-	auditLogger AuditLogger
+	dirpath        string
+	podRoot        string
+	logger         *logging.Logger
+	auditLogger    AuditLogger
+	resultRecorder ResultRecorder
 }
 
 // The set of environment variables exposed to the hook as it runs
@@ -132,6 +134,15 @@ type AuditLogger interface {
 	Close() error
 }
 
+// ResultRecorder stores the results of the hooks run for a pod, such as in
+// the pod's status, so that hook failures can be seen without logging in to
+// the node
+type ResultRecorder interface {
+	// RecordHookResults is passed the results of all the hooks run for
+	// one event
+	RecordHookResults(pod Pod, podID types.PodID, event HookType, results []podstatus.HookResult)
+}
+
 type HookExecContext struct {
 	Path        string // path to hook's executable
 	Name        string // human-readable name of Hook
@@ -167,3 +178,20 @@ func (e ErrHookTimeout) Error() string {
 	sec := e.Hook.Timeout / time.Millisecond
 	return fmt.Sprintf("Hook %s timed out after %dms", e.Hook.Name, sec)
 }
+
+// ErrHookAborted is returned when a hook fails and its policy aborts the
+// install of the hooked pod
+type ErrHookAborted struct {
+	Hook  string
+	Event HookType
+}
+
+func (e ErrHookAborted) Error() string {
+	return fmt.Sprintf("Hook %s failed during %s, aborting the install", e.Hook, e.Event)
+}
+
+// IsHookAborted returns whether err is an ErrHookAborted
+func IsHookAborted(err error) bool {
+	_, ok := err.(ErrHookAborted)
+	return ok
+}
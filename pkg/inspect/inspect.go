@@ -7,6 +7,7 @@ import (
 	"github.com/square/p2/pkg/health"
 	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
 	"github.com/square/p2/pkg/types"
 )
 
@@ -28,6 +29,19 @@ type NodePodStatus struct {
 	IntentVersions     map[launch.LaunchableID]LaunchableVersion `json:"intent_versions,omitempty"`
 	RealityVersions    map[launch.LaunchableID]LaunchableVersion `json:"reality_versions,omitempty"`
 	Health             health.HealthState                        `json:"health,omitempty"`
+	HealthCheck        *health.CheckConfig                       `json:"health_check,omitempty"`
+
+	// The last exit and recent abnormal exits (including OOM kills) of
+	// each of the pod's processes on the node
+	ProcessStatuses []podstatus.ProcessStatus `json:"process_status,omitempty"`
+
+	// The output and exit code of the last run of each of the pod's hooks
+	// on the node
+	HookResults []podstatus.HookResult `json:"hook_results,omitempty"`
+
+	// The deploy in effect, when another one that raced it with a different
+	// manifest was refused. See consul.SetPodChecked()
+	ConflictingDeploys *consul.IntentWrite `json:"conflicting_deploys,omitempty"`
 
 	// These fields are kept for backwards compatibility with tools that
 	// parse the output of p2-inspect. intent_versions and reality_versions
@@ -59,12 +59,33 @@ type LaunchableStanza struct {
 	// that should be implemented by the pod itself via bin/post-activate
 	NoHaltOnUpdate bool `yaml:"no_halt_on_update,omitempty"`
 
+	// ReloadSignal is the signal sent to the launchable's processes to make
+	// them re-read their config when only the config of a pod with
+	// reloadable_config changed, e.g. "SIGUSR2". When set to "script" the
+	// launchable's bin/reload script is run instead. Defaults to SIGHUP.
+	// Not supported by docker launchables
+	ReloadSignal string `yaml:"reload_signal,omitempty"`
+
+	// StopSignal is the signal sent to ask the launchable's processes to
+	// stop, for processes that drain gracefully on something other than
+	// SIGTERM, e.g. "SIGQUIT". Processes still running after the restart
+	// timeout are stopped as usual. Not supported by docker launchables
+	StopSignal string `yaml:"stop_signal,omitempty"`
+
 	// Specifies which files or directories (relative to launchable root)
 	// should be launched under runit. Only launchables of type "hoist"
 	// make use of this field, and if empty, a default of ["bin/launch"]
 	// is used
 	EntryPoints []string `yaml:"entry_points,omitempty"`
 
+	// Named processes to launch under runit, e.g. "web", "worker" and
+	// "cron", as an alternative to EntryPoints. Each process gets its own
+	// runit service and may override the launchable's restart policy and
+	// declare its own status check. Only launchables of type "hoist" make
+	// use of this field, and it may not be used in conjunction with
+	// EntryPoints
+	Processes map[string]ProcessStanza `yaml:"processes,omitempty"`
+
 	// The URL from which the launchable can be downloaded. May not be used
 	// in conjunction with Version
 	Location string `yaml:"location,omitempty"`
@@ -79,6 +100,69 @@ type LaunchableStanza struct {
 	Image DockerImage `yaml:"image,omitempty"`
 }
 
+// ProcessStanza declares a named process of a launchable.
+//
+// The process name takes the place of the entry point's path in the
+// ENTRY_POINT environment variable and in the pod's process statuses, so
+// several processes may run the same executable with different arguments.
+type ProcessStanza struct {
+	// The executable to run, relative to the launchable root, e.g. "bin/web"
+	EntryPoint string `yaml:"entry_point"`
+
+	// Arguments passed to the executable
+	Args []string `yaml:"args,omitempty"`
+
+	// Overrides the launchable's restart policy for this process
+	RestartPolicy_ runit.RestartPolicy `yaml:"restart_policy,omitempty"`
+
+	// If StatusPort is set the pod is only reported healthy while this
+	// process responds successfully on StatusPort and StatusPath. It is
+	// checked with the same scheme and host as the pod's status check.
+	StatusPort int    `yaml:"status_port,omitempty"`
+	StatusPath string `yaml:"status_path,omitempty"`
+}
+
+var processNameRegex = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// Validate returns an error if the process named name is malformed
+func (p ProcessStanza) Validate(name string) error {
+	if !processNameRegex.MatchString(name) {
+		return util.Errorf("process name %q must only contain lowercase letters, digits, '-' and '_'", name)
+	}
+	if p.EntryPoint == "" {
+		return util.Errorf("process %q must contain an 'entry_point'", name)
+	}
+	if path.IsAbs(p.EntryPoint) || strings.HasPrefix(path.Clean(p.EntryPoint), "..") {
+		return util.Errorf("process %q: entry_point %q must be relative to the launchable root", name, p.EntryPoint)
+	}
+	switch p.RestartPolicy_ {
+	case "", runit.RestartPolicyAlways, runit.RestartPolicyNever:
+	default:
+		return util.Errorf("process %q: invalid restart_policy %q", name, p.RestartPolicy_)
+	}
+	if p.StatusPort < 0 || p.StatusPort > 65535 {
+		return util.Errorf("process %q: invalid status_port %d", name, p.StatusPort)
+	}
+	return nil
+}
+
+// RestartPolicy returns the process's restart policy, defaulting to that of
+// its launchable
+func (p ProcessStanza) RestartPolicy(launchableDefault runit.RestartPolicy) runit.RestartPolicy {
+	if p.RestartPolicy_ == "" {
+		return launchableDefault
+	}
+	return p.RestartPolicy_
+}
+
+// GetStatusPath returns the path requested by the process's status check
+func (p ProcessStanza) GetStatusPath() string {
+	if p.StatusPath != "" {
+		return path.Join("/", p.StatusPath)
+	}
+	return "/_status"
+}
+
 // DockerImage contains launchable information specific to the "docker" launchable type.
 type DockerImage struct {
 	Name string `yaml:"name"`
@@ -100,6 +184,44 @@ func (l LaunchableStanza) RestartPolicy() runit.RestartPolicy {
 	return l.RestartPolicy_
 }
 
+// ReloadScript is the reload_signal value that runs the launchable's
+// bin/reload script instead of sending a signal
+const ReloadScript = "script"
+
+// ValidateSignals returns an error if the launchable's reload or stop signal is
+// malformed or not supported by its type
+func (l LaunchableStanza) ValidateSignals() error {
+	if l.LaunchableType == "docker" && (l.ReloadSignal != "" || l.StopSignal != "") {
+		return util.Errorf("docker launchables do not support reload_signal or stop_signal")
+	}
+	if l.ReloadSignal == ReloadScript {
+		if l.LaunchableType != "hoist" {
+			return util.Errorf("only hoist launchables may reload with a script")
+		}
+	} else if l.ReloadSignal != "" {
+		if _, err := runit.ParseSignal(l.ReloadSignal); err != nil {
+			return util.Errorf("invalid reload_signal: %s", err)
+		}
+	}
+	if l.StopSignal != "" {
+		if _, err := runit.ParseSignal(l.StopSignal); err != nil {
+			return util.Errorf("invalid stop_signal: %s", err)
+		}
+	}
+	return nil
+}
+
+// SignalExecutables sends signal to the runit service of every executable
+func SignalExecutables(executables []Executable, sv runit.SV, signal runit.Signal) error {
+	for _, executable := range executables {
+		_, err := sv.Signal(&executable.Service, signal)
+		if err != nil && err != runit.SuperviseOkMissing {
+			return err
+		}
+	}
+	return nil
+}
+
 // Uses the assumption that all locations have a Path component ending in
 // /<launchable_id>_<version>.tar.gz, which is intended to be phased out in
 // favor of explicit launchable versions specified in pod manifests.
@@ -163,8 +285,15 @@ type Launchable interface {
 
 	// PostActive runs a Hoist-specific "post-activate" script in the launchable.
 	PostActivate() (string, error)
+	// Migrate runs a Hoist-specific "migrate" script in the launchable. It is
+	// only invoked for pods using the fresh install upgrade strategy, after the
+	// previous version was halted and before this one is made current.
+	Migrate() (string, error)
 	// Launch begins execution.
 	Launch(serviceBuilder *runit.ServiceBuilder, sv runit.SV) error
+	// Reload asks the launchable's processes to re-read their config
+	// without restarting them.
+	Reload(serviceBuilder *runit.ServiceBuilder, sv runit.SV) error
 	// Disable allows a launchable to stop work and do cleanup prior to Stop
 	Disable() error
 	// Stop stops execution.
@@ -190,11 +319,12 @@ type Launchable interface {
 // service running.
 type Executable struct {
 	ServiceName   string // e.g. "bin__launch"
-	RelativePath  string // relative path to executable within launchable, e.g. "bin/launch"
+	RelativePath  string // relative path to executable within launchable, e.g. "bin/launch", or the process name for named processes
 	Service       runit.Service
 	LogAgent      runit.Service
 	Exec          []string
-	RestartPolicy runit.RestartPolicy
+	RestartPolicy runit.RestartPolicy // if empty, the launchable's restart policy applies
+	CgroupName    string              // the cgroup p2-exec runs the executable in, if any
 }
 
 func (e Executable) WriteExecutor(writer io.Writer) error {
@@ -8,6 +8,7 @@ import (
 
 	"github.com/Sirupsen/logrus"
 
+	"github.com/square/p2/pkg/errors"
 	"github.com/square/p2/pkg/util"
 )
 
@@ -71,6 +72,10 @@ func (l Logger) WithError(err error) Logger {
 		fields["filename"] = stackErr.Filename()
 		fields["function"] = stackErr.Function()
 	}
+	// and the error's code, so that failures can be grouped by it
+	if code := errors.CodeOf(err); code != errors.CodeUnknown {
+		fields["error_code"] = code
+	}
 	return l.WithFields(fields)
 }
 
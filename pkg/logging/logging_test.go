@@ -10,6 +10,8 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	. "github.com/anthonybishopric/gotcha"
+
+	"github.com/square/p2/pkg/errors"
 )
 
 func TestLoggingCanMergeFields(t *testing.T) {
@@ -105,6 +107,11 @@ func TestWithError(t *testing.T) {
 	Assert(t).AreEqual(45, logger.WithField("a", 1).WithError(err).Data["line_number"], "no error when chained second")
 	Assert(t).AreEqual(45, logger.WithError(err).WithField("a", 1).Data["line_number"], "no error when chained first")
 	Assert(t).AreEqual(45, logger.WithErrorAndFields(err, logrus.Fields{"a": 1}).Data["line_number"], "no error with combined call")
+
+	coded := errors.Codef(errors.CodeConflict, "concurrent update")
+	Assert(t).AreEqual(errors.CodeConflict, logger.WithError(coded).Data["error_code"], "bad error code")
+	_, ok := logger.WithError(err).Data["error_code"]
+	Assert(t).IsFalse(ok, "errors without a code should not have one logged")
 }
 
 func TestAddSocketHook(t *testing.T) {
@@ -13,9 +13,14 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/square/p2/pkg/artifact"
 	"github.com/square/p2/pkg/cgroups"
+	"github.com/square/p2/pkg/health/expr"
 	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/types"
@@ -30,6 +35,337 @@ type StatusStanza struct {
 	Path          string `yaml:"path,omitempty"`
 	Port          int    `yaml:"port,omitempty"`
 	LocalhostOnly bool   `yaml:"localhost_only,omitempty"`
+
+	// Socket, if set, is the path of a unix socket, relative to the pod's
+	// home directory, that the status endpoint is served on instead of a
+	// port, e.g. "run/status.sock". Requests to it are plain HTTP. Only
+	// applies to http status checks
+	Socket string `yaml:"socket,omitempty"`
+
+	// Expression, if set, is evaluated against the status check response
+	// to decide whether the pod is healthy, instead of only looking at the
+	// response code. See the pkg/health/expr package for the syntax.
+	Expression string `yaml:"expression,omitempty"`
+
+	// BodyRegex, if set, is a regular expression that the body of a
+	// successful status response must match, e.g. "^OK" for an app that
+	// responds 200 with "DEGRADED" when it isn't healthy
+	BodyRegex string `yaml:"body_regex,omitempty"`
+
+	// BodyJSON, if set, maps fields of the JSON body of a successful status
+	// response to the values they must have. Fields of nested objects are
+	// separated by dots, e.g. {status: ok, db.connected: "true"}
+	BodyJSON map[string]string `yaml:"body_json,omitempty"`
+
+	// Method is the HTTP method of the status request. Defaults to HEAD, or
+	// GET if the body of the response is checked
+	Method string `yaml:"method,omitempty"`
+
+	// Headers are sent with the status request, e.g. {Host: app.example.com}
+	// for an app behind a router that dispatches on the virtual host
+	Headers map[string]string `yaml:"headers,omitempty"`
+
+	// ExpectedStatus lists the response codes that are passing, as codes
+	// and inclusive ranges separated by commas, e.g. "200-299,304".
+	// Defaults to any 2xx code
+	ExpectedStatus string `yaml:"expected_status,omitempty"`
+
+	// Timeout bounds the status request, e.g. "2s", overriding the
+	// preparer's healthcheck_timeout
+	Timeout string `yaml:"timeout,omitempty"`
+
+	// Type is the protocol the status check speaks: "http" (the default),
+	// "grpc" for services implementing the standard grpc.health.v1 health
+	// checking protocol, or "tcp" for services that are healthy as long as
+	// they accept connections on the status port
+	Type string `yaml:"type,omitempty"`
+
+	// Protocol is an alias of Type
+	Protocol string `yaml:"protocol,omitempty"`
+
+	// GRPCService is the service name sent in gRPC health checks. If empty,
+	// the health of the server as a whole is checked
+	GRPCService string `yaml:"grpc_service,omitempty"`
+
+	// Plaintext disables TLS for gRPC health checks. HTTP checks use the
+	// http field instead
+	Plaintext bool `yaml:"plaintext,omitempty"`
+
+	// TLSServerName, if set, is the name that the server certificate of a
+	// gRPC health check is verified against instead of the host name
+	TLSServerName string `yaml:"tls_server_name,omitempty"`
+
+	// Addresses, if set, are checked instead of the node's address. Each
+	// is an IP address, a host name, or "ipv4" or "ipv6" for every address
+	// of that family that the node's name resolves to, e.g. [ipv4, ipv6]
+	// for a dual-stack node. The results are combined per AddressPolicy
+	Addresses []string `yaml:"addresses,omitempty"`
+
+	// AddressPolicy is "all" (the default) if every address must be
+	// healthy, or "any" if one healthy address is enough
+	AddressPolicy string `yaml:"address_policy,omitempty"`
+
+	// Interval is how often the pod is checked, e.g. "10s", overriding the
+	// preparer's default
+	Interval string `yaml:"interval,omitempty"`
+
+	// TTL is how long a result of the check is valid for unless it's
+	// rewritten, e.g. "5m", overriding the preparer's default
+	TTL string `yaml:"ttl,omitempty"`
+
+	// GracePeriod is how long after the pod is launched that failing checks
+	// are reported as unknown rather than critical, e.g. "2m", so that pods
+	// that are slow to start don't fail deploys. It ends early once the pod
+	// passes
+	GracePeriod string `yaml:"grace_period,omitempty"`
+
+	// FailureThreshold is how many consecutive critical or warning results
+	// it takes for a passing pod to be reported as critical, and SuccessThreshold
+	// how many consecutive passing results it takes for a critical pod to
+	// be reported as passing, so that transient blips don't flip the pod's
+	// health. Both default to 1
+	FailureThreshold int `yaml:"failure_threshold,omitempty"`
+	SuccessThreshold int `yaml:"success_threshold,omitempty"`
+
+	// Exec is the command of an "exec" status check, which is run as the
+	// pod's user with the pod's environment. Exiting 0 is passing, 1 is
+	// warning and anything else is critical. Setting it implies the exec
+	// type
+	Exec []string `yaml:"exec,omitempty"`
+
+	// Checks are further named checks of the pod, e.g. a liveness check on
+	// /healthz and a TCP check of a sidecar's port. Each is configured like
+	// the status stanza itself, except that its port defaults to the pod's
+	// status port and it can't have checks, an interval, a TTL, a grace
+	// period, thresholds or an SLA of its own. The pod is only as healthy as the
+	// least healthy of its checks
+	Checks map[string]StatusStanza `yaml:"checks,omitempty"`
+
+	// Role, for named checks, is "readiness" if the check only decides
+	// whether the pod is ready, i.e. should be sent traffic and counted as
+	// up by deploys, or "liveness" if it only decides whether the pod is
+	// alive, i.e. shouldn't be restarted. Checks without a role, and the
+	// status stanza itself, decide both
+	Role string `yaml:"role,omitempty"`
+
+	// SLA is a success rate and latency budget over the pod's recent
+	// checks, so that a pod that responded once isn't passing unless it
+	// also responds reliably and fast. See SLAStanza
+	SLA *SLAStanza `yaml:"sla,omitempty"`
+}
+
+// SLAStanza is a budget that the last Window checks of a pod must meet. Until
+// Window checks have been made, a passing pod is reported as warning. After
+// that, a pod that would otherwise pass is reported as warning or critical
+// while the share of its last Window checks that passed is below the
+// corresponding success rate, or the 95th percentile of their latencies is
+// above the corresponding latency. Thresholds that aren't set aren't
+// enforced, but at least one must be.
+type SLAStanza struct {
+	Window int `yaml:"window"`
+
+	// Success rates are between 0 and 1, e.g. 0.99
+	WarningSuccessRate  float64 `yaml:"warning_success_rate,omitempty"`
+	CriticalSuccessRate float64 `yaml:"critical_success_rate,omitempty"`
+
+	// Latencies are durations, e.g. "250ms"
+	WarningP95Latency  string `yaml:"warning_p95_latency,omitempty"`
+	CriticalP95Latency string `yaml:"critical_p95_latency,omitempty"`
+}
+
+// maxSLAWindow bounds how many checks are kept per pod
+const maxSLAWindow = 1000
+
+// GetP95Latencies returns the warning and critical latency thresholds, zero
+// if they aren't set
+func (sla SLAStanza) GetP95Latencies() (warning time.Duration, critical time.Duration, err error) {
+	warning, err = parseDuration(sla.WarningP95Latency)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid warning_p95_latency %q: %s", sla.WarningP95Latency, err)
+	}
+	critical, err = parseDuration(sla.CriticalP95Latency)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid critical_p95_latency %q: %s", sla.CriticalP95Latency, err)
+	}
+	return warning, critical, nil
+}
+
+func validSLA(sla SLAStanza) error {
+	if sla.Window < 1 || sla.Window > maxSLAWindow {
+		return fmt.Errorf("window must be between 1 and %d", maxSLAWindow)
+	}
+	for _, rate := range []float64{sla.WarningSuccessRate, sla.CriticalSuccessRate} {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("success rates must be between 0 and 1")
+		}
+	}
+	if sla.WarningSuccessRate != 0 && sla.WarningSuccessRate < sla.CriticalSuccessRate {
+		return fmt.Errorf("warning_success_rate can't be below critical_success_rate")
+	}
+	warning, critical, err := sla.GetP95Latencies()
+	if err != nil {
+		return err
+	}
+	if critical != 0 && warning > critical {
+		return fmt.Errorf("warning_p95_latency can't be above critical_p95_latency")
+	}
+	if sla.WarningSuccessRate == 0 && sla.CriticalSuccessRate == 0 && warning == 0 && critical == 0 {
+		return fmt.Errorf("at least one success rate or latency must be set")
+	}
+	return nil
+}
+
+const (
+	StatusTypeHTTP = "http"
+	StatusTypeGRPC = "grpc"
+	StatusTypeTCP  = "tcp"
+	StatusTypeExec = "exec"
+
+	StatusAddressIPv4 = "ipv4"
+	StatusAddressIPv6 = "ipv6"
+
+	AddressPolicyAll = "all"
+	AddressPolicyAny = "any"
+
+	StatusRoleReadiness = "readiness"
+	StatusRoleLiveness  = "liveness"
+)
+
+// GetAddressPolicy returns how the results of checking each address are
+// combined, defaulting to requiring all of them to be healthy
+func (status StatusStanza) GetAddressPolicy() string {
+	if status.AddressPolicy == "" {
+		return AddressPolicyAll
+	}
+	return status.AddressPolicy
+}
+
+// GetCheckPort returns the port of one of the pod's named checks, which
+// defaults to the pod's status port
+func (status StatusStanza) GetCheckPort(statusPort int) int {
+	if status.Port != 0 {
+		return status.Port
+	}
+	return statusPort
+}
+
+// GetInterval returns how often the pod is checked, or zero if the
+// preparer's default applies
+func (status StatusStanza) GetInterval() (time.Duration, error) {
+	return parseDuration(status.Interval)
+}
+
+// GetTTL returns how long a result of the check is valid for, or zero if the
+// preparer's default applies
+func (status StatusStanza) GetTTL() (time.Duration, error) {
+	return parseDuration(status.TTL)
+}
+
+// GetGracePeriod returns how long after the pod is launched that failing
+// checks aren't critical, or zero if they always are
+func (status StatusStanza) GetGracePeriod() (time.Duration, error) {
+	return parseDuration(status.GracePeriod)
+}
+
+// GetTimeout returns how long the status request may take, or zero if the
+// preparer's default applies
+func (status StatusStanza) GetTimeout() (time.Duration, error) {
+	return parseDuration(status.Timeout)
+}
+
+// StatusCodeRange is an inclusive range of HTTP response codes
+type StatusCodeRange struct {
+	Min int
+	Max int
+}
+
+func (r StatusCodeRange) Contains(code int) bool {
+	return r.Min <= code && code <= r.Max
+}
+
+func (r StatusCodeRange) String() string {
+	if r.Min == r.Max {
+		return strconv.Itoa(r.Min)
+	}
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+// GetExpectedStatus parses the response codes that are passing, or returns
+// nil if any 2xx code is
+func (status StatusStanza) GetExpectedStatus() ([]StatusCodeRange, error) {
+	if status.ExpectedStatus == "" {
+		return nil, nil
+	}
+	var ranges []StatusCodeRange
+	for _, part := range strings.Split(status.ExpectedStatus, ",") {
+		part = strings.TrimSpace(part)
+		bounds := strings.SplitN(part, "-", 2)
+		min, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code %q", part)
+		}
+		max := min
+		if len(bounds) == 2 {
+			max, err = strconv.Atoi(bounds[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid status code range %q", part)
+			}
+		}
+		if min < 100 || max > 599 || min > max {
+			return nil, fmt.Errorf("invalid status code range %q", part)
+		}
+		ranges = append(ranges, StatusCodeRange{Min: min, Max: max})
+	}
+	return ranges, nil
+}
+
+// GetFailureThreshold returns how many consecutive critical or warning
+// results it takes for the pod to be reported as critical
+func (status StatusStanza) GetFailureThreshold() int {
+	if status.FailureThreshold <= 0 {
+		return 1
+	}
+	return status.FailureThreshold
+}
+
+// GetSuccessThreshold returns how many consecutive passing results it takes
+// for the pod to be reported as passing
+func (status StatusStanza) GetSuccessThreshold() int {
+	if status.SuccessThreshold <= 0 {
+		return 1
+	}
+	return status.SuccessThreshold
+}
+
+// parseDuration parses a positive duration, or returns zero if s is empty
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("must be positive")
+	}
+	return d, nil
+}
+
+// GetType returns the protocol of the status check, defaulting to exec if
+// there is a command and to HTTP otherwise
+func (status StatusStanza) GetType() string {
+	statusType := status.Type
+	if statusType == "" {
+		statusType = status.Protocol
+	}
+	if statusType == "" && len(status.Exec) > 0 {
+		return StatusTypeExec
+	}
+	if statusType == "" {
+		return StatusTypeHTTP
+	}
+	return statusType
 }
 
 type Builder interface {
@@ -42,6 +378,11 @@ type Builder interface {
 	SetStatusPort(port int)
 	SetLaunchables(launchableStanzas map[launch.LaunchableID]launch.LaunchableStanza)
 	SetResourceLimits(limits ResourceLimitsStanza)
+	SetPrerequisites(prerequisites PrerequisitesStanza)
+	SetUpgradeStrategy(strategy UpgradeStrategy)
+	SetPorts(ports map[string]int)
+	SetReloadableConfig(reloadable bool)
+	SetHook(hook bool)
 }
 
 var _ Builder = builder{}
@@ -86,6 +427,12 @@ type Manifest interface {
 	Marshal() ([]byte, error)
 	SignatureData() (plaintext, signature []byte)
 	GetNodeRequirements() map[string]string
+	GetPrerequisites() PrerequisitesStanza
+	GetUpgradeStrategy() UpgradeStrategy
+	GetPorts() map[string]int
+	GetReloadableConfig() bool
+	GetHookPolicy() HookPolicyStanza
+	IsHook() bool
 
 	GetBuilder() Builder
 }
@@ -97,6 +444,118 @@ type ResourceLimitsStanza struct {
 	Cgroup *cgroups.Config `yaml:"cgroup,omitempty"`
 }
 
+// PrerequisitesStanza declares what a host must provide for a pod to be
+// installed on it. The preparer checks these before installing the pod, and
+// keeps retrying until they are met.
+type PrerequisitesStanza struct {
+	// The minimum kernel version, e.g. "3.10" or "4.4.0"
+	KernelVersion string `yaml:"kernel_version,omitempty"`
+
+	// Packages that must be installed
+	Packages []string `yaml:"packages,omitempty"`
+
+	// Expected values of kernel parameters, keyed by their sysctl name, e.g.
+	// net.core.somaxconn
+	Sysctls map[string]string `yaml:"sysctls,omitempty"`
+
+	// Paths that must be mount points
+	Mounts []string `yaml:"mounts,omitempty"`
+}
+
+// IsEmpty returns whether no prerequisites are declared
+func (p PrerequisitesStanza) IsEmpty() bool {
+	return p.KernelVersion == "" && len(p.Packages) == 0 && len(p.Sysctls) == 0 && len(p.Mounts) == 0
+}
+
+// HookPolicyStanza configures how the preparer runs the hooks of a hook pod.
+// It has no effect on other pods.
+type HookPolicyStanza struct {
+	// How long each run of a hook may take, e.g. "30s". Defaults to two
+	// minutes
+	Timeout string `yaml:"timeout,omitempty"`
+
+	// How many more times a failed hook is run before its failure strategy
+	// applies
+	Retries int `yaml:"retries,omitempty"`
+
+	// What a failure of the hook does, see HookFailureStrategy. Defaults
+	// to HookFailureContinue
+	OnFailure HookFailureStrategy `yaml:"on_failure,omitempty"`
+}
+
+// HookFailureStrategy determines what happens when a hook fails, after any
+// retries
+type HookFailureStrategy string
+
+const (
+	// The failure is logged as a warning and the preparer carries on. This
+	// is the default.
+	HookFailureContinue HookFailureStrategy = "continue"
+
+	// The install of the hooked pod is abandoned and retried later, the
+	// same as when the pod's install fails. Only before_install,
+	// after_install and before_launch hooks can abort an install, a
+	// failure of another hook is treated as "continue".
+	HookFailureAbort HookFailureStrategy = "abort"
+
+	// The preparer carries on, but the hook's result marks the hooked pod
+	// as degraded until the hook next succeeds
+	HookFailureDegrade HookFailureStrategy = "degrade"
+)
+
+// IsEmpty returns whether the policy sets nothing, so that defaults apply
+func (policy HookPolicyStanza) IsEmpty() bool {
+	return policy == HookPolicyStanza{}
+}
+
+// GetOnFailure returns the failure strategy of the hook, defaulting to
+// HookFailureContinue
+func (policy HookPolicyStanza) GetOnFailure() HookFailureStrategy {
+	if policy.OnFailure == "" {
+		return HookFailureContinue
+	}
+	return policy.OnFailure
+}
+
+// GetTimeout returns the timeout of each run of the hook, or zero if the
+// default applies
+func (policy HookPolicyStanza) GetTimeout() (time.Duration, error) {
+	return parseDuration(policy.Timeout)
+}
+
+// Validate checks that the policy's fields have valid values
+func (policy HookPolicyStanza) Validate() error {
+	if _, err := policy.GetTimeout(); err != nil {
+		return fmt.Errorf("invalid timeout %q: %s", policy.Timeout, err)
+	}
+	if policy.Retries < 0 {
+		return fmt.Errorf("invalid retries %d, must not be negative", policy.Retries)
+	}
+	switch strategy := policy.GetOnFailure(); strategy {
+	case HookFailureContinue, HookFailureAbort, HookFailureDegrade:
+	default:
+		return fmt.Errorf("invalid on_failure %q, must be %q, %q or %q", strategy, HookFailureContinue, HookFailureAbort, HookFailureDegrade)
+	}
+	return nil
+}
+
+// UpgradeStrategy determines how the preparer replaces a running version of a
+// pod with a new one.
+type UpgradeStrategy string
+
+const (
+	// The new version is installed next to the running one and reuses the
+	// pod's home, config and data directories. The running version is only
+	// halted right before the new one is launched. This is the default.
+	InPlaceUpgrade UpgradeStrategy = "in_place"
+
+	// Leftovers of earlier installs of the new version are discarded so that
+	// it is installed into a new directory. After the running version is
+	// halted, each launchable's bin/migrate script is run before its
+	// "current" symlink is switched to the new version.
+	FreshInstallUpgrade UpgradeStrategy = "fresh_install"
+)
+
 type manifest struct {
 	Id                  types.PodID                                     `yaml:"id"` // public for yaml marshaling access. Use ID() instead.
 	RunAs               string                                          `yaml:"run_as,omitempty"`
@@ -109,6 +568,27 @@ type manifest struct {
 	ReadOnly            *bool                                           `yaml:"readonly,omitempty"`
 	ArtifactRegistryURL string                                          `yaml:"artifact_registry,omitempty"`
 	NodeRequirements    map[string]string                               `yaml:"node_requirements,omitempty"`
+	Prerequisites       PrerequisitesStanza                             `yaml:"prerequisites,omitempty"`
+	UpgradeStrategy     UpgradeStrategy                                 `yaml:"upgrade_strategy,omitempty"`
+
+	// Ports the pod listens on, keyed by a name such as "http". They are
+	// published as SRV records while the pod is healthy.
+	Ports map[string]int `yaml:"ports,omitempty"`
+
+	// ReloadableConfig declares that the pod's processes re-read the file
+	// at $CONFIG_PATH when they receive a SIGHUP. When only the config
+	// section of such a pod changes, the preparer rewrites the config and
+	// signals the processes instead of restarting them.
+	ReloadableConfig bool `yaml:"reloadable_config,omitempty"`
+
+	// Hook declares that the pod is a bundle of hooks. Instead of launching
+	// it, the preparer installs its launchables' executables into the hooks
+	// directory, so that hooks are rolled out like any other pod.
+	Hook bool `yaml:"hook,omitempty"`
+
+	// HookPolicy configures how the preparer runs the pod's hooks, if the
+	// pod is a hook
+	HookPolicy HookPolicyStanza `yaml:"hook_policy,omitempty"`
 
 	// Used to track the original bytes so that we don't reorder them when
 	// doing a yaml.Unmarshal and a yaml.Marshal in succession
@@ -260,6 +740,26 @@ func (manifest *manifest) SetResourceLimits(limits ResourceLimitsStanza) {
 	manifest.ResourceLimits = limits
 }
 
+func (manifest *manifest) SetPrerequisites(prerequisites PrerequisitesStanza) {
+	manifest.Prerequisites = prerequisites
+}
+
+func (manifest *manifest) SetUpgradeStrategy(strategy UpgradeStrategy) {
+	manifest.UpgradeStrategy = strategy
+}
+
+func (manifest *manifest) SetPorts(ports map[string]int) {
+	manifest.Ports = ports
+}
+
+func (manifest *manifest) SetReloadableConfig(reloadable bool) {
+	manifest.ReloadableConfig = reloadable
+}
+
+func (manifest *manifest) SetHook(hook bool) {
+	manifest.Hook = hook
+}
+
 func (manifest *manifest) RunAsUser() string {
 	if manifest.RunAs != "" {
 		return manifest.RunAs
@@ -510,16 +1010,283 @@ func (m manifest) GetNodeRequirements() map[string]string {
 	return m.NodeRequirements
 }
 
+func (m manifest) GetPrerequisites() PrerequisitesStanza {
+	return m.Prerequisites
+}
+
+func (m manifest) GetUpgradeStrategy() UpgradeStrategy {
+	if m.UpgradeStrategy == "" {
+		return InPlaceUpgrade
+	}
+	return m.UpgradeStrategy
+}
+
+func (m manifest) GetPorts() map[string]int {
+	return m.Ports
+}
+
+func (m manifest) GetReloadableConfig() bool {
+	return m.ReloadableConfig
+}
+
+func (m manifest) GetHookPolicy() HookPolicyStanza {
+	return m.HookPolicy
+}
+
+func (m manifest) IsHook() bool {
+	return m.Hook
+}
+
+// OnlyConfigChanged returns whether the two manifests are the same apart from
+// their config sections
+func OnlyConfigChanged(oldManifest, newManifest Manifest) (bool, error) {
+	oldBuilder := oldManifest.GetBuilder()
+	newBuilder := newManifest.GetBuilder()
+	// both configs are set so that they are normalized the same way
+	err := oldBuilder.SetConfig(oldManifest.GetConfig())
+	if err != nil {
+		return false, err
+	}
+	err = newBuilder.SetConfig(oldManifest.GetConfig())
+	if err != nil {
+		return false, err
+	}
+
+	oldSHA, err := oldBuilder.GetManifest().SHA()
+	if err != nil {
+		return false, err
+	}
+	newSHA, err := newBuilder.GetManifest().SHA()
+	if err != nil {
+		return false, err
+	}
+	return oldSHA == newSHA, nil
+}
+
+// Port names are used as SRV record service names, so they are restricted to
+// what is valid in a DNS label
+var portNamePattern = regexp.MustCompile("^[a-z0-9]([a-z0-9-]*[a-z0-9])?$")
+
+func validStatusStanza(m Manifest) error {
+	status := m.GetStatusStanza()
+	if err := validStatusCheck(status, m.GetStatusHTTP(), m.GetStatusPort()); err != nil {
+		return err
+	}
+
+	interval, err := status.GetInterval()
+	if err != nil {
+		return fmt.Errorf("invalid status interval %q: %s", status.Interval, err)
+	}
+	ttl, err := status.GetTTL()
+	if err != nil {
+		return fmt.Errorf("invalid status ttl %q: %s", status.TTL, err)
+	}
+	if interval != 0 && ttl != 0 && ttl < 2*interval {
+		return fmt.Errorf("status ttl %s must be at least twice the interval %s, so that results are rewritten before they expire", ttl, interval)
+	}
+	if _, err = status.GetGracePeriod(); err != nil {
+		return fmt.Errorf("invalid status grace_period %q: %s", status.GracePeriod, err)
+	}
+	if status.FailureThreshold < 0 || status.SuccessThreshold < 0 {
+		return fmt.Errorf("status failure_threshold and success_threshold can't be negative")
+	}
+	if status.SLA != nil {
+		if err = validSLA(*status.SLA); err != nil {
+			return fmt.Errorf("invalid status sla: %s", err)
+		}
+	}
+	if status.Role != "" {
+		return fmt.Errorf("status role only applies to named status checks")
+	}
+
+	for name, check := range status.Checks {
+		if !portNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid status check name %q, must match %s", name, portNamePattern)
+		}
+		if len(check.Checks) > 0 || check.Interval != "" || check.TTL != "" || check.GracePeriod != "" ||
+			check.FailureThreshold != 0 || check.SuccessThreshold != 0 || check.SLA != nil {
+			return fmt.Errorf("status check %q can't have checks, an interval, a ttl, a grace period, thresholds or an sla of its own", name)
+		}
+		switch check.Role {
+		case "", StatusRoleReadiness, StatusRoleLiveness:
+		default:
+			return fmt.Errorf("invalid role %q of status check %q, must be %q or %q", check.Role, name, StatusRoleReadiness, StatusRoleLiveness)
+		}
+		if check.Expression != "" {
+			if _, err := expr.Parse(check.Expression); err != nil {
+				return fmt.Errorf("invalid expression of status check %q: %s", name, err)
+			}
+		}
+		if check.GetType() != StatusTypeExec && check.Socket == "" && check.GetCheckPort(m.GetStatusPort()) == 0 {
+			return fmt.Errorf("status check %q requires a port or socket", name)
+		}
+		if err := validStatusCheck(check, check.HTTP, check.GetCheckPort(m.GetStatusPort())); err != nil {
+			return fmt.Errorf("invalid status check %q: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// validStatusCheck validates the fields that configure a single check, of
+// the pod's status stanza or one of its named checks
+func validStatusCheck(status StatusStanza, statusHTTP bool, statusPort int) error {
+	if status.Type != "" && status.Protocol != "" && status.Type != status.Protocol {
+		return fmt.Errorf("status type %q and protocol %q conflict, set only one of them", status.Type, status.Protocol)
+	}
+	switch status.GetType() {
+	case StatusTypeHTTP:
+		if status.BodyRegex != "" {
+			if _, err := regexp.Compile(status.BodyRegex); err != nil {
+				return fmt.Errorf("invalid status body_regex: %s", err)
+			}
+		}
+		for field := range status.BodyJSON {
+			if field == "" || strings.HasPrefix(field, ".") || strings.HasSuffix(field, ".") || strings.Contains(field, "..") {
+				return fmt.Errorf("invalid status body_json field %q", field)
+			}
+		}
+		if status.GRPCService != "" || status.Plaintext || status.TLSServerName != "" {
+			return fmt.Errorf("grpc_service, plaintext and tls_server_name only apply to grpc status checks")
+		}
+		switch status.Method {
+		case "", "GET", "HEAD", "POST", "OPTIONS":
+		default:
+			return fmt.Errorf("invalid status method %q, must be GET, HEAD, POST or OPTIONS", status.Method)
+		}
+		if status.Method == "HEAD" && (status.Expression != "" || status.BodyRegex != "" || len(status.BodyJSON) > 0) {
+			return fmt.Errorf("status expressions and body assertions need a response body, which HEAD requests don't get")
+		}
+		for name := range status.Headers {
+			if name == "" || strings.ContainsAny(name, " :\r\n") {
+				return fmt.Errorf("invalid status header %q", name)
+			}
+		}
+		if _, err := status.GetExpectedStatus(); err != nil {
+			return fmt.Errorf("invalid status expected_status: %s", err)
+		}
+		if _, err := status.GetTimeout(); err != nil {
+			return fmt.Errorf("invalid status timeout %q: %s", status.Timeout, err)
+		}
+		if status.Socket != "" {
+			clean := path.Clean(status.Socket)
+			if path.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+				return fmt.Errorf("invalid status socket %q, must be a path within the pod's home directory", status.Socket)
+			}
+			if len(status.Addresses) > 0 {
+				return fmt.Errorf("status addresses don't apply to status sockets")
+			}
+		}
+	case StatusTypeGRPC:
+		if status.Expression != "" || status.BodyRegex != "" || len(status.BodyJSON) > 0 {
+			return fmt.Errorf("status expressions and body assertions only apply to http status checks")
+		}
+		if status.Path != "" || statusHTTP {
+			return fmt.Errorf("path and http only apply to http status checks")
+		}
+	case StatusTypeTCP:
+		if status.Expression != "" || status.BodyRegex != "" || len(status.BodyJSON) > 0 {
+			return fmt.Errorf("status expressions and body assertions only apply to http status checks")
+		}
+		if status.Path != "" || statusHTTP {
+			return fmt.Errorf("path and http only apply to http status checks")
+		}
+		if status.GRPCService != "" || status.Plaintext || status.TLSServerName != "" {
+			return fmt.Errorf("grpc_service, plaintext and tls_server_name only apply to grpc status checks")
+		}
+		if statusPort == 0 {
+			return fmt.Errorf("tcp status checks require a status port")
+		}
+	case StatusTypeExec:
+		if len(status.Exec) == 0 || status.Exec[0] == "" {
+			return fmt.Errorf("exec status checks require a command")
+		}
+		if status.Expression != "" || status.BodyRegex != "" || len(status.BodyJSON) > 0 {
+			return fmt.Errorf("status expressions and body assertions only apply to http status checks")
+		}
+		if status.Path != "" || statusHTTP {
+			return fmt.Errorf("path and http only apply to http status checks")
+		}
+		if status.GRPCService != "" || status.Plaintext || status.TLSServerName != "" {
+			return fmt.Errorf("grpc_service, plaintext and tls_server_name only apply to grpc status checks")
+		}
+		if len(status.Addresses) > 0 {
+			return fmt.Errorf("status addresses don't apply to exec status checks")
+		}
+	default:
+		return fmt.Errorf("invalid status type %q, must be %q, %q, %q or %q", status.GetType(), StatusTypeHTTP, StatusTypeGRPC, StatusTypeTCP, StatusTypeExec)
+	}
+	if status.GetType() != StatusTypeExec && len(status.Exec) > 0 {
+		return fmt.Errorf("exec only applies to exec status checks")
+	}
+	if status.GetType() != StatusTypeHTTP && (status.Method != "" || len(status.Headers) > 0 || status.ExpectedStatus != "" || status.Timeout != "") {
+		return fmt.Errorf("method, headers, expected_status and timeout only apply to http status checks")
+	}
+	if status.GetType() != StatusTypeHTTP && status.Socket != "" {
+		return fmt.Errorf("socket only applies to http status checks")
+	}
+
+	switch policy := status.GetAddressPolicy(); policy {
+	case AddressPolicyAll, AddressPolicyAny:
+	default:
+		return fmt.Errorf("invalid status address_policy %q, must be %q or %q", policy, AddressPolicyAll, AddressPolicyAny)
+	}
+	if len(status.Addresses) > 0 && statusPort == 0 {
+		return fmt.Errorf("status addresses require a status port")
+	}
+	for _, address := range status.Addresses {
+		if address == "" || strings.ContainsAny(address, "/ ") {
+			return fmt.Errorf("invalid status address %q", address)
+		}
+	}
+	return nil
+}
+
 // ValidManifest checks the internal consistency of a manifest. Returns an error if the
 // data is inconsistent or "nil" otherwise.
 func ValidManifest(m Manifest) error {
 	if m.ID() == "" {
 		return fmt.Errorf("manifest must contain an 'id'")
 	}
+	if expression := m.GetStatusStanza().Expression; expression != "" {
+		if _, err := expr.Parse(expression); err != nil {
+			return fmt.Errorf("invalid status expression: %s", err)
+		}
+	}
+	if err := validStatusStanza(m); err != nil {
+		return err
+	}
+	switch strategy := m.GetUpgradeStrategy(); strategy {
+	case InPlaceUpgrade, FreshInstallUpgrade:
+	default:
+		return fmt.Errorf("invalid upgrade_strategy %q, must be %q or %q", strategy, InPlaceUpgrade, FreshInstallUpgrade)
+	}
+	if err := m.GetHookPolicy().Validate(); err != nil {
+		return fmt.Errorf("invalid hook_policy: %s", err)
+	}
+	for name, port := range m.GetPorts() {
+		if !portNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid port name %q, must match %s", name, portNamePattern)
+		}
+		if port <= 0 || port > 65535 {
+			return fmt.Errorf("invalid port %d for %q", port, name)
+		}
+	}
+	if version := m.GetPrerequisites().KernelVersion; version != "" {
+		if _, err := ParseKernelVersion(version); err != nil {
+			return fmt.Errorf("invalid kernel_version prerequisite: %s", err)
+		}
+	}
 	for launchableID, stanza := range m.GetLaunchableStanzas() {
 		if stanza.LaunchableType == "" {
 			return fmt.Errorf("'%s': launchable must contain a 'launchable_type'", launchableID)
 		}
+		if err := stanza.ValidateSignals(); err != nil {
+			return fmt.Errorf("'%s': %s", launchableID, err)
+		}
+
+		if m.IsHook() && stanza.LaunchableType != "hoist" {
+			return fmt.Errorf("'%s': hook pods may only contain hoist launchables", launchableID)
+		}
 
 		if stanza.LaunchableType == "hoist" || stanza.LaunchableType == "opencontainer" {
 			switch {
@@ -528,6 +1295,19 @@ func ValidManifest(m Manifest) error {
 			case stanza.Location != "" && stanza.Version.ID != "":
 				return fmt.Errorf("'%s': launchable must not contain both 'location' and 'version'", launchableID)
 			}
+			if len(stanza.Processes) > 0 {
+				if stanza.LaunchableType != "hoist" {
+					return fmt.Errorf("'%s': only hoist launchables may contain 'processes'", launchableID)
+				}
+				if len(stanza.EntryPoints) > 0 {
+					return fmt.Errorf("'%s': launchable must not contain both 'entry_points' and 'processes'", launchableID)
+				}
+				for name, process := range stanza.Processes {
+					if err := process.Validate(name); err != nil {
+						return fmt.Errorf("'%s': %s", launchableID, err)
+					}
+				}
+			}
 			continue
 		}
 
@@ -539,3 +1319,48 @@ func ValidManifest(m Manifest) error {
 	}
 	return nil
 }
+
+// ParseKernelVersion parses the leading dotted numbers of a kernel version, so
+// "3.10.0-514.el7.x86_64" becomes [3 10 0]
+func ParseKernelVersion(version string) ([]int, error) {
+	numeric := version
+	if i := strings.IndexFunc(version, func(r rune) bool {
+		return r != '.' && (r < '0' || r > '9')
+	}); i >= 0 {
+		numeric = version[:i]
+	}
+	numeric = strings.TrimRight(numeric, ".")
+	if numeric == "" {
+		return nil, fmt.Errorf("%q does not start with a version number", version)
+	}
+
+	parts := strings.Split(numeric, ".")
+	parsed := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid version number", version)
+		}
+		parsed[i] = n
+	}
+	return parsed, nil
+}
+
+// CompareKernelVersions returns a negative number if a is older than b, 0 if
+// they are the same, and a positive number if a is newer. Missing components
+// count as 0, so 4.4 and 4.4.0 are the same.
+func CompareKernelVersions(a []int, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			return x - y
+		}
+	}
+	return 0
+}
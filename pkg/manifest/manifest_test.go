@@ -3,12 +3,15 @@ package manifest
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
 
 	"github.com/square/p2/pkg/cgroups"
 	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/runit"
 	"github.com/square/p2/pkg/uri"
 	"github.com/square/p2/pkg/util/size"
 
@@ -386,3 +389,680 @@ func TestArtifactRegistryOverride(t *testing.T) {
 		t.Error("Expected registry override to occur, but didn't find one")
 	}
 }
+
+func TestPrerequisites(t *testing.T) {
+	manifest, err := FromBytes([]byte(`
+id: thepod
+prerequisites:
+  kernel_version: "4.4"
+  packages: [nginx]
+  sysctls:
+    net.core.somaxconn: "1024"
+  mounts: [/data]
+`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+
+	prerequisites := manifest.GetPrerequisites()
+	Assert(t).AreEqual(prerequisites.KernelVersion, "4.4", "did not read kernel version")
+	Assert(t).AreEqual(len(prerequisites.Packages), 1, "did not read packages")
+	Assert(t).AreEqual(prerequisites.Sysctls["net.core.somaxconn"], "1024", "did not read sysctls")
+	Assert(t).AreEqual(len(prerequisites.Mounts), 1, "did not read mounts")
+	Assert(t).IsNil(ValidManifest(manifest), "manifest should be valid")
+
+	builder := manifest.GetBuilder()
+	builder.SetPrerequisites(PrerequisitesStanza{KernelVersion: "latest"})
+	Assert(t).IsNotNil(ValidManifest(builder.GetManifest()), "an unparseable kernel version should be invalid")
+
+	empty, err := FromBytes([]byte(`{ id: thepod }`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).IsTrue(empty.GetPrerequisites().IsEmpty(), "a manifest without prerequisites should have none")
+}
+
+func TestUpgradeStrategy(t *testing.T) {
+	manifest, err := FromBytes([]byte(`{ id: thepod }`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).AreEqual(manifest.GetUpgradeStrategy(), InPlaceUpgrade, "upgrades should be in place by default")
+
+	manifest, err = FromBytes([]byte(`{ id: thepod, upgrade_strategy: fresh_install }`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).AreEqual(manifest.GetUpgradeStrategy(), FreshInstallUpgrade, "did not read upgrade strategy")
+	Assert(t).IsNil(ValidManifest(manifest), "manifest should be valid")
+
+	builder := manifest.GetBuilder()
+	builder.SetUpgradeStrategy("blue_green")
+	Assert(t).IsNotNil(ValidManifest(builder.GetManifest()), "an unknown upgrade strategy should be invalid")
+}
+
+func TestOnlyConfigChanged(t *testing.T) {
+	oldManifest, err := FromBytes([]byte(`{ id: thepod, reloadable_config: true, config: { level: info } }`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).IsTrue(oldManifest.GetReloadableConfig(), "did not read reloadable_config")
+
+	newManifest, err := FromBytes([]byte(`{ id: thepod, reloadable_config: true, config: { level: debug } }`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	onlyConfig, err := OnlyConfigChanged(oldManifest, newManifest)
+	Assert(t).IsNil(err, "should not have erred comparing manifests")
+	Assert(t).IsTrue(onlyConfig, "only the config should have changed")
+
+	builder := newManifest.GetBuilder()
+	builder.SetRunAsUser("someone")
+	onlyConfig, err = OnlyConfigChanged(oldManifest, builder.GetManifest())
+	Assert(t).IsNil(err, "should not have erred comparing manifests")
+	Assert(t).IsFalse(onlyConfig, "a change outside the config should have been noticed")
+}
+
+func TestPorts(t *testing.T) {
+	manifest, err := FromBytes([]byte(`{ id: thepod, ports: { http: 8080, admin-rpc: 9090 } }`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).IsNil(ValidManifest(manifest), "manifest should be valid")
+	Assert(t).AreEqual(manifest.GetPorts()["admin-rpc"], 9090, "did not read ports")
+
+	builder := manifest.GetBuilder()
+	builder.SetPorts(map[string]int{"Not_A_Label": 8080})
+	Assert(t).IsNotNil(ValidManifest(builder.GetManifest()), "a port name that isn't a DNS label should be invalid")
+
+	builder.SetPorts(map[string]int{"http": 70000})
+	Assert(t).IsNotNil(ValidManifest(builder.GetManifest()), "an out of range port should be invalid")
+}
+
+func TestNamedProcesses(t *testing.T) {
+	manifest, err := FromBytes([]byte(`
+id: thepod
+launchables:
+  app:
+    launchable_type: hoist
+    location: https://localhost:4444/foo/bar/baz_3c021aff048ca8117593f9c71e03b87cf72fd440.tar.gz
+    restart_policy: always
+    processes:
+      web:
+        entry_point: bin/app
+        args: [serve]
+        status_port: 8080
+      cron:
+        entry_point: bin/app
+        args: [cron]
+        restart_policy: never
+`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).IsNil(ValidManifest(manifest), "manifest should be valid")
+
+	stanza := manifest.GetLaunchableStanzas()["app"]
+	Assert(t).AreEqual(len(stanza.Processes), 2, "did not read processes")
+	web := stanza.Processes["web"]
+	Assert(t).AreEqual(web.EntryPoint, "bin/app", "did not read entry point")
+	Assert(t).AreEqual(len(web.Args), 1, "did not read args")
+	Assert(t).AreEqual(web.GetStatusPath(), "/_status", "expected the default status path")
+	Assert(t).AreEqual(web.RestartPolicy(stanza.RestartPolicy()), runit.RestartPolicyAlways, "expected the launchable's restart policy")
+	Assert(t).AreEqual(stanza.Processes["cron"].RestartPolicy(stanza.RestartPolicy()), runit.RestartPolicyNever, "expected the process's restart policy")
+
+	stanza.EntryPoints = []string{"bin/launch"}
+	builder := manifest.GetBuilder()
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{"app": stanza})
+	Assert(t).IsNotNil(ValidManifest(builder.GetManifest()), "entry_points and processes should be mutually exclusive")
+
+	stanza.EntryPoints = nil
+	stanza.Processes = map[string]launch.ProcessStanza{"Web Server": {EntryPoint: "bin/app"}}
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{"app": stanza})
+	Assert(t).IsNotNil(ValidManifest(builder.GetManifest()), "a malformed process name should be invalid")
+
+	stanza.Processes = map[string]launch.ProcessStanza{"web": {EntryPoint: "../../bin/sh"}}
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{"app": stanza})
+	Assert(t).IsNotNil(ValidManifest(builder.GetManifest()), "an entry point outside the launchable should be invalid")
+}
+
+func TestGRPCStatusCheck(t *testing.T) {
+	manifest, err := FromBytes([]byte(`
+id: thepod
+status:
+  type: grpc
+  port: 8443
+  grpc_service: payments
+  tls_server_name: payments.internal
+`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).IsNil(ValidManifest(manifest), "manifest should be valid")
+
+	status := manifest.GetStatusStanza()
+	Assert(t).AreEqual(status.GetType(), StatusTypeGRPC, "did not read status type")
+	Assert(t).AreEqual(status.GRPCService, "payments", "did not read grpc service")
+	Assert(t).AreEqual(status.TLSServerName, "payments.internal", "did not read tls server name")
+
+	builder := manifest.GetBuilder()
+	builder.SetStatusPath("/_status")
+	Assert(t).IsNotNil(ValidManifest(builder.GetManifest()), "a path should be invalid for grpc checks")
+
+	Assert(t).AreEqual(StatusStanza{}.GetType(), StatusTypeHTTP, "status checks should default to http")
+
+	_, err = FromBytes([]byte(`
+id: thepod
+status:
+  port: 8443
+  grpc_service: payments
+`))
+	Assert(t).IsNotNil(err, "a grpc service should be invalid for http checks")
+
+	_, err = FromBytes([]byte(`
+id: thepod
+status:
+  type: thrift
+`))
+	Assert(t).IsNotNil(err, "an unknown status type should be invalid")
+
+	manifest, err = FromBytes([]byte(`
+id: thepod
+status:
+  protocol: grpc
+  port: 8443
+  grpc_service: payments
+`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).AreEqual(manifest.GetStatusStanza().GetType(), StatusTypeGRPC, "protocol should be an alias of type")
+
+	_, err = FromBytes([]byte(`
+id: thepod
+status:
+  type: http
+  protocol: grpc
+`))
+	Assert(t).IsNotNil(err, "a conflicting type and protocol should be invalid")
+}
+
+func TestTCPStatusCheck(t *testing.T) {
+	manifest, err := FromBytes([]byte(`
+id: thepod
+status:
+  type: tcp
+  port: 6379
+`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).IsNil(ValidManifest(manifest), "manifest should be valid")
+	Assert(t).AreEqual(manifest.GetStatusStanza().GetType(), StatusTypeTCP, "did not read status type")
+
+	builder := manifest.GetBuilder()
+	builder.SetStatusPath("/_status")
+	Assert(t).IsNotNil(ValidManifest(builder.GetManifest()), "a path should be invalid for tcp checks")
+
+	_, err = FromBytes([]byte(`
+id: thepod
+status:
+  type: tcp
+  port: 6379
+  grpc_service: payments
+`))
+	Assert(t).IsNotNil(err, "a grpc service should be invalid for tcp checks")
+
+	_, err = FromBytes([]byte(`
+id: thepod
+status:
+  type: tcp
+`))
+	Assert(t).IsNotNil(err, "a tcp check without a port should be invalid")
+}
+
+func TestStatusBodyAssertions(t *testing.T) {
+	manifest, err := FromBytes([]byte(`
+id: thepod
+status:
+  port: 8080
+  body_regex: ^OK
+  body_json:
+    status: ok
+    db.connected: "true"
+`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).IsNil(ValidManifest(manifest), "manifest should be valid")
+	Assert(t).AreEqual(manifest.GetStatusStanza().BodyRegex, "^OK", "did not read body regex")
+	Assert(t).AreEqual(manifest.GetStatusStanza().BodyJSON["db.connected"], "true", "did not read body json")
+
+	_, err = FromBytes([]byte(`
+id: thepod
+status:
+  port: 8080
+  body_regex: "(OK"
+`))
+	Assert(t).IsNotNil(err, "an invalid body regex should be invalid")
+
+	_, err = FromBytes([]byte(`
+id: thepod
+status:
+  port: 8080
+  body_json:
+    db..connected: "true"
+`))
+	Assert(t).IsNotNil(err, "an invalid body json field should be invalid")
+
+	_, err = FromBytes([]byte(`
+id: thepod
+status:
+  type: tcp
+  port: 6379
+  body_regex: ^OK
+`))
+	Assert(t).IsNotNil(err, "body assertions should be invalid for tcp checks")
+}
+
+func TestStatusRequestOptions(t *testing.T) {
+	manifest, err := FromBytes([]byte(`
+id: thepod
+status:
+  port: 8080
+  method: GET
+  headers:
+    Host: thepod.example.com
+  expected_status: 200-299, 304
+  timeout: 2s
+`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	status := manifest.GetStatusStanza()
+	Assert(t).AreEqual(status.Headers["Host"], "thepod.example.com", "did not read headers")
+	expected, err := status.GetExpectedStatus()
+	Assert(t).IsNil(err, "should have parsed expected status")
+	Assert(t).AreEqual(len(expected), 2, "should have parsed two ranges")
+	Assert(t).IsTrue(expected[0].Contains(204) && !expected[0].Contains(304), "did not parse the 2xx range")
+	Assert(t).AreEqual(expected[1].String(), "304", "did not parse the single code")
+	timeout, err := status.GetTimeout()
+	Assert(t).IsNil(err, "should have parsed timeout")
+	Assert(t).AreEqual(timeout, 2*time.Second, "did not read timeout")
+
+	for _, invalid := range []string{
+		"method: DELETE",
+		"expected_status: 200-",
+		"expected_status: 299-200",
+		"expected_status: 700",
+		"timeout: soon",
+		"method: HEAD\n  body_regex: ^OK",
+	} {
+		_, err = FromBytes([]byte("id: thepod\nstatus:\n  port: 8080\n  " + invalid + "\n"))
+		Assert(t).IsNotNil(err, fmt.Sprintf("%q should be invalid", invalid))
+	}
+
+	_, err = FromBytes([]byte(`
+id: thepod
+status:
+  type: tcp
+  port: 6379
+  timeout: 2s
+`))
+	Assert(t).IsNotNil(err, "request options should be invalid for tcp checks")
+}
+
+func TestStatusSLA(t *testing.T) {
+	manifest, err := FromBytes([]byte(`
+id: thepod
+status:
+  port: 8080
+  sla:
+    window: 20
+    warning_success_rate: 0.99
+    critical_success_rate: 0.9
+    warning_p95_latency: 250ms
+`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	sla := manifest.GetStatusStanza().SLA
+	Assert(t).IsNotNil(sla, "did not read sla")
+	Assert(t).AreEqual(sla.Window, 20, "did not read sla window")
+	warning, critical, err := sla.GetP95Latencies()
+	Assert(t).IsNil(err, "should have parsed latencies")
+	Assert(t).AreEqual(warning, 250*time.Millisecond, "did not read warning latency")
+	Assert(t).AreEqual(critical, time.Duration(0), "critical latency should be unset")
+
+	for _, invalid := range []string{
+		"window: 0\n    critical_success_rate: 0.9",
+		"window: 20",
+		"window: 20\n    critical_success_rate: 1.5",
+		"window: 20\n    warning_success_rate: 0.9\n    critical_success_rate: 0.99",
+		"window: 20\n    warning_p95_latency: 2s\n    critical_p95_latency: 1s",
+		"window: 20\n    critical_p95_latency: soon",
+	} {
+		_, err = FromBytes([]byte("id: thepod\nstatus:\n  port: 8080\n  sla:\n    " + invalid + "\n"))
+		Assert(t).IsNotNil(err, fmt.Sprintf("%q should be invalid", invalid))
+	}
+}
+
+func TestStatusSocket(t *testing.T) {
+	manifest, err := FromBytes([]byte(`
+id: thepod
+status:
+  socket: run/status.sock
+  checks:
+    admin:
+      socket: run/admin.sock
+`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).AreEqual(manifest.GetStatusStanza().Socket, "run/status.sock", "did not read socket")
+
+	for _, invalid := range []string{
+		"socket: /run/status.sock",
+		"socket: ../other/status.sock",
+		"socket: .",
+		"type: tcp\n  port: 8080\n  socket: run/status.sock",
+		"socket: run/status.sock\n  addresses: [ipv4]",
+	} {
+		_, err = FromBytes([]byte("id: thepod\nstatus:\n  " + invalid + "\n"))
+		Assert(t).IsNotNil(err, fmt.Sprintf("%q should be invalid", invalid))
+	}
+}
+
+func TestExecStatusCheck(t *testing.T) {
+	manifest, err := FromBytes([]byte(`
+id: thepod
+status:
+  exec: [bin/check, --quick]
+`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).AreEqual(manifest.GetStatusStanza().GetType(), StatusTypeExec, "a command should imply the exec type")
+
+	_, err = FromBytes([]byte(`
+id: thepod
+status:
+  type: exec
+`))
+	Assert(t).IsNotNil(err, "an exec check without a command should be invalid")
+
+	_, err = FromBytes([]byte(`
+id: thepod
+status:
+  type: http
+  exec: [bin/check]
+`))
+	Assert(t).IsNotNil(err, "a command should be invalid for http checks")
+
+	_, err = FromBytes([]byte(`
+id: thepod
+status:
+  exec: [bin/check]
+  path: /_status
+`))
+	Assert(t).IsNotNil(err, "a path should be invalid for exec checks")
+}
+
+func TestHookPolicy(t *testing.T) {
+	manifest, err := FromBytes([]byte(`
+id: thehook
+hook_policy:
+  timeout: 30s
+  retries: 2
+  on_failure: abort
+`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	policy := manifest.GetHookPolicy()
+	timeout, err := policy.GetTimeout()
+	Assert(t).IsNil(err, "should not have erred parsing the timeout")
+	Assert(t).AreEqual(timeout, 30*time.Second, "did not read hook timeout")
+	Assert(t).AreEqual(policy.Retries, 2, "did not read hook retries")
+	Assert(t).AreEqual(policy.GetOnFailure(), HookFailureAbort, "did not read hook failure strategy")
+
+	Assert(t).AreEqual(HookPolicyStanza{}.GetOnFailure(), HookFailureContinue, "hook failures should default to continue")
+	Assert(t).IsTrue(HookPolicyStanza{}.IsEmpty(), "an unset policy should be empty")
+
+	for _, invalid := range []string{"timeout: forever", "timeout: -1s", "retries: -1", "on_failure: explode"} {
+		_, err = FromBytes([]byte("id: thehook\nhook_policy:\n  " + invalid + "\n"))
+		Assert(t).IsNotNil(err, fmt.Sprintf("%q should be an invalid hook policy", invalid))
+	}
+}
+
+func TestHookPods(t *testing.T) {
+	manifest, err := FromBytes([]byte(`
+id: thehook
+hook: true
+launchables:
+  check:
+    launchable_type: hoist
+    location: https://localhost:4444/check.tar.gz
+`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).IsTrue(manifest.IsHook(), "did not read hook")
+
+	_, err = FromBytes([]byte(`
+id: thehook
+hook: true
+launchables:
+  check:
+    launchable_type: opencontainer
+    location: https://localhost:4444/check.tar.gz
+`))
+	Assert(t).IsNotNil(err, "hook pods with launchables other than hoist should be invalid")
+}
+
+func TestStatusAddresses(t *testing.T) {
+	manifest, err := FromBytes([]byte(`
+id: thepod
+status:
+  port: 8443
+  addresses: [ipv4, ipv6, 10.0.0.5]
+  address_policy: any
+`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	status := manifest.GetStatusStanza()
+	Assert(t).AreEqual(len(status.Addresses), 3, "did not read addresses")
+	Assert(t).AreEqual(status.GetAddressPolicy(), AddressPolicyAny, "did not read address policy")
+	Assert(t).AreEqual(StatusStanza{}.GetAddressPolicy(), AddressPolicyAll, "every address should have to be healthy by default")
+
+	_, err = FromBytes([]byte(`
+id: thepod
+status:
+  port: 8443
+  addresses: [ipv4]
+  address_policy: most
+`))
+	Assert(t).IsNotNil(err, "an unknown address policy should be invalid")
+
+	_, err = FromBytes([]byte(`
+id: thepod
+status:
+  addresses: [ipv4]
+`))
+	Assert(t).IsNotNil(err, "addresses without a status port should be invalid")
+}
+
+func TestLaunchableSignals(t *testing.T) {
+	manifest, err := FromBytes([]byte(`
+id: thepod
+launchables:
+  app:
+    launchable_type: hoist
+    location: https://localhost:4444/foo/bar/baz_3c021aff048ca8117593f9c71e03b87cf72fd440.tar.gz
+    reload_signal: SIGUSR2
+    stop_signal: QUIT
+`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).IsNil(ValidManifest(manifest), "manifest should be valid")
+
+	stanza := manifest.GetLaunchableStanzas()["app"]
+	Assert(t).AreEqual(stanza.ReloadSignal, "SIGUSR2", "did not read reload signal")
+	Assert(t).AreEqual(stanza.StopSignal, "QUIT", "did not read stop signal")
+
+	builder := manifest.GetBuilder()
+	stanza.ReloadSignal = launch.ReloadScript
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{"app": stanza})
+	Assert(t).IsNil(ValidManifest(builder.GetManifest()), "a hoist launchable should be able to reload with a script")
+
+	stanza.StopSignal = "SIGBOGUS"
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{"app": stanza})
+	Assert(t).IsNotNil(ValidManifest(builder.GetManifest()), "an unknown signal should be invalid")
+
+	stanza.StopSignal = ""
+	stanza.LaunchableType = "opencontainer"
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{"app": stanza})
+	Assert(t).IsNotNil(ValidManifest(builder.GetManifest()), "only hoist launchables should be able to reload with a script")
+
+	stanza.ReloadSignal = "HUP"
+	stanza.LaunchableType = "docker"
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{"app": stanza})
+	Assert(t).IsNotNil(ValidManifest(builder.GetManifest()), "docker launchables should not accept signals")
+}
+
+func TestCompareKernelVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"3.10.0-514.el7.x86_64", "3.10", 0},
+		{"4.4", "4.4.0", 0},
+		{"3.10.0", "4.4", -1},
+		{"4.15.0-generic", "4.4", 1},
+	}
+	for _, test := range tests {
+		a, err := ParseKernelVersion(test.a)
+		Assert(t).IsNil(err, "should have parsed kernel version")
+		b, err := ParseKernelVersion(test.b)
+		Assert(t).IsNil(err, "should have parsed kernel version")
+
+		result := CompareKernelVersions(a, b)
+		switch {
+		case result < 0:
+			result = -1
+		case result > 0:
+			result = 1
+		}
+		Assert(t).AreEqual(result, test.expected, "unexpected comparison of "+test.a+" and "+test.b)
+	}
+}
+
+func TestNamedStatusChecks(t *testing.T) {
+	manifest, err := FromBytes([]byte(`
+id: thepod
+status_port: 8080
+status:
+  checks:
+    live:
+      path: /healthz
+    sidecar:
+      type: tcp
+      port: 9090
+    script:
+      exec: [bin/check]
+`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	checks := manifest.GetStatusStanza().Checks
+	Assert(t).AreEqual(len(checks), 3, "did not read named checks")
+	Assert(t).AreEqual(checks["live"].GetCheckPort(manifest.GetStatusPort()), 8080, "check port should default to the status port")
+	Assert(t).AreEqual(checks["sidecar"].GetCheckPort(manifest.GetStatusPort()), 9090, "check port should override the status port")
+
+	_, err = FromBytes([]byte(`
+id: thepod
+status:
+  checks:
+    live:
+      path: /healthz
+`))
+	Assert(t).IsNotNil(err, "a check without a port should be invalid")
+
+	_, err = FromBytes([]byte(`
+id: thepod
+status_port: 8080
+status:
+  checks:
+    Live:
+      path: /healthz
+`))
+	Assert(t).IsNotNil(err, "an invalid check name should be invalid")
+
+	_, err = FromBytes([]byte(`
+id: thepod
+status_port: 8080
+status:
+  checks:
+    live:
+      interval: 5s
+`))
+	Assert(t).IsNotNil(err, "a check with its own interval should be invalid")
+
+	_, err = FromBytes([]byte(`
+id: thepod
+status_port: 8080
+status:
+  checks:
+    live:
+      type: tcp
+      path: /healthz
+`))
+	Assert(t).IsNotNil(err, "named checks should be validated like the status stanza")
+}
+
+func TestStatusCheckRoles(t *testing.T) {
+	manifest, err := FromBytes([]byte(`
+id: thepod
+status_port: 8080
+status:
+  checks:
+    ready:
+      path: /ready
+      role: readiness
+    live:
+      path: /healthz
+      role: liveness
+`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).AreEqual(manifest.GetStatusStanza().Checks["ready"].Role, StatusRoleReadiness, "did not read role")
+
+	_, err = FromBytes([]byte(`
+id: thepod
+status_port: 8080
+status:
+  checks:
+    ready:
+      path: /ready
+      role: startup
+`))
+	Assert(t).IsNotNil(err, "an unknown role should be invalid")
+
+	_, err = FromBytes([]byte(`
+id: thepod
+status_port: 8080
+status:
+  role: readiness
+`))
+	Assert(t).IsNotNil(err, "the status stanza itself should not have a role")
+}
+
+func TestStatusGracePeriod(t *testing.T) {
+	manifest, err := FromBytes([]byte(`
+id: thepod
+status_port: 8080
+status:
+  grace_period: 2m
+`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	period, err := manifest.GetStatusStanza().GetGracePeriod()
+	Assert(t).IsNil(err, "should have parsed the grace period")
+	Assert(t).AreEqual(period, 2*time.Minute, "did not read grace period")
+
+	_, err = FromBytes([]byte(`
+id: thepod
+status_port: 8080
+status:
+  grace_period: -1m
+`))
+	Assert(t).IsNotNil(err, "a negative grace period should be invalid")
+
+	_, err = FromBytes([]byte(`
+id: thepod
+status_port: 8080
+status:
+  checks:
+    live:
+      grace_period: 1m
+`))
+	Assert(t).IsNotNil(err, "a named check with its own grace period should be invalid")
+}
+
+func TestStatusThresholds(t *testing.T) {
+	manifest, err := FromBytes([]byte(`
+id: thepod
+status_port: 8080
+status:
+  failure_threshold: 3
+`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).AreEqual(manifest.GetStatusStanza().GetFailureThreshold(), 3, "did not read failure threshold")
+	Assert(t).AreEqual(manifest.GetStatusStanza().GetSuccessThreshold(), 1, "success threshold should default to 1")
+
+	_, err = FromBytes([]byte(`
+id: thepod
+status_port: 8080
+status:
+  success_threshold: -1
+`))
+	Assert(t).IsNotNil(err, "a negative threshold should be invalid")
+}
@@ -42,6 +42,8 @@ type Launchable struct {
 	P2Exec            string                     // The path to p2-exec
 	RestartTimeout    time.Duration              // How long to wait when restarting the services in this launchable.
 	RestartPolicy_    runit.RestartPolicy        // Dictates whether the container should be automatically restarted upon exit.
+	ReloadSignal      string                     // The signal that makes the container reload its config. Defaults to HUP
+	StopSignal        string                     // The signal that asks the container to stop. Defaults to runit's TERM
 	CgroupConfig      cgroups.Config             // Cgroup parameters to use with p2-exec
 	Version_          launch.LaunchableVersionID // Version of the specified launchable
 	SuppliedEnvVars   map[string]string          // User-supplied env variables
@@ -184,6 +186,7 @@ func (l *Launchable) Executables(serviceBuilder *runit.ServiceBuilder) ([]launch
 				CgroupName:       l.CgroupName,
 			}.CommandLine()...,
 		),
+		CgroupName: l.CgroupName,
 	}}, nil
 }
 
@@ -256,6 +259,11 @@ func (l *Launchable) PostActivate() (string, error) {
 	return "", nil
 }
 
+func (l *Launchable) Migrate() (string, error) {
+	// Not supported in OpenContainer
+	return "", nil
+}
+
 func (l *Launchable) flipSymlink(newLinkPath string) error {
 	dir, err := ioutil.TempDir(l.RootDir, l.ServiceID_)
 	if err != nil {
@@ -349,8 +357,16 @@ func (l *Launchable) stop(serviceBuilder *runit.ServiceBuilder, sv runit.SV) err
 		return err
 	}
 
+	stopSignal := runit.SignalTERM
+	if l.StopSignal != "" {
+		stopSignal, err = runit.ParseSignal(l.StopSignal)
+		if err != nil {
+			return err
+		}
+	}
+
 	for _, executable := range executables {
-		_, err := sv.Stop(&executable.Service, l.RestartTimeout)
+		_, err := runit.StopWithSignal(sv, &executable.Service, stopSignal, l.RestartTimeout)
 		if err != nil {
 			cmd := exec.Command(
 				l.P2Exec,
@@ -368,6 +384,22 @@ func (l *Launchable) stop(serviceBuilder *runit.ServiceBuilder, sv runit.SV) err
 	return nil
 }
 
+func (l *Launchable) Reload(serviceBuilder *runit.ServiceBuilder, sv runit.SV) error {
+	signal := runit.SignalHUP
+	if l.ReloadSignal != "" {
+		var err error
+		signal, err = runit.ParseSignal(l.ReloadSignal)
+		if err != nil {
+			return err
+		}
+	}
+	executables, err := l.Executables(serviceBuilder)
+	if err != nil {
+		return err
+	}
+	return launch.SignalExecutables(executables, sv, signal)
+}
+
 func (l *Launchable) Disable() error {
 	// "disable" script not supported for containers
 	return nil
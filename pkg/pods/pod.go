@@ -53,6 +53,10 @@ const (
 	PlatformConfigPathEnvVar       = "PLATFORM_CONFIG_PATH"
 	ResourceLimitsPathEnvVar       = "RESOURCE_LIMIT_PATH" // ResourceLimits is a superset of PlatformConfig
 	LaunchableRestartTimeoutEnvVar = "RESTART_TIMEOUT"
+
+	// Set for finish scripts so the exit of a process killed by the OOM
+	// killer can be attributed to its cgroup
+	CgroupNameEnvVar = "CGROUP_NAME"
 )
 
 type Pod struct {
@@ -89,6 +93,10 @@ type Pod struct {
 	readOnly bool
 
 	DockerClient *dockerclient.Client
+
+	// how long the last call to Install spent on each step of downloading
+	// artifacts
+	installTimings artifact.DownloadTimings
 }
 
 type ManifestFinder interface {
@@ -102,6 +110,10 @@ func (dmf *diskManifestFinder) Find(pod Pod) (manifest.Manifest, error) {
 	if _, err := os.Stat(currentManPath); os.IsNotExist(err) {
 		return nil, NoCurrentManifest
 	}
+	err := util.VerifyChecksum(currentManPath)
+	if err != nil {
+		return nil, err
+	}
 	return manifest.FromPath(currentManPath)
 }
 
@@ -246,6 +258,64 @@ func (pod *Pod) Launch(manifest manifest.Manifest) (bool, error) {
 	return success, nil
 }
 
+// Reload updates the config of a running pod from oldManifest to newManifest,
+// which must only differ in their config, and has every launchable reload its
+// config, which by default sends its runit services a HUP. The processes were
+// started with the config path of oldManifest in their environment, so that
+// file is rewritten with the new config as well. Errors reloading launchables
+// are logged and make the first return value false, other errors are returned.
+func (pod *Pod) Reload(oldManifest manifest.Manifest, newManifest manifest.Manifest) (bool, error) {
+	launchables, err := pod.Launchables(newManifest)
+	if err != nil {
+		return false, err
+	}
+
+	err = pod.setupConfig(newManifest, launchables)
+	if err != nil {
+		return false, util.Errorf("Could not setup config: %s", err)
+	}
+
+	uid, gid, err := user.IDs(newManifest.UnpackAsUser())
+	if err != nil {
+		return false, util.Errorf("Could not determine pod UID/GID: %s", err)
+	}
+	var configData bytes.Buffer
+	err = newManifest.WriteConfig(&configData)
+	if err != nil {
+		return false, err
+	}
+	runningConfigFileName, err := oldManifest.ConfigFileName()
+	if err != nil {
+		return false, err
+	}
+	err = writeFileChown(filepath.Join(pod.ConfigDir(), runningConfigFileName), configData.Bytes(), uid, gid)
+	if err != nil {
+		return false, util.Errorf("Error rewriting running config file for pod %s: %s", newManifest.ID(), err)
+	}
+
+	oldManifestTemp, err := pod.WriteCurrentManifest(newManifest)
+	defer os.RemoveAll(oldManifestTemp)
+	if err != nil {
+		return false, err
+	}
+
+	success := true
+	for _, launchable := range launchables {
+		err = launchable.Reload(pod.ServiceBuilder, pod.SV)
+		if err != nil {
+			pod.logLaunchableError(launchable.ServiceID(), err, "Could not reload launchable")
+			success = false
+		}
+	}
+
+	if success {
+		pod.logInfo("Successfully reloaded config")
+	} else {
+		pod.logInfo("Reloaded config but one or more launchables could not be reloaded")
+	}
+	return success, nil
+}
+
 func (pod *Pod) Prune(max size.ByteCount, manifest manifest.Manifest) {
 	launchables, err := pod.Launchables(manifest)
 	if err != nil {
@@ -295,11 +365,15 @@ func (pod *Pod) buildRunitServices(launchables []launch.Launchable, newManifest
 			if _, ok := sbTemplate[executable.Service.Name]; ok {
 				return util.Errorf("Duplicate executable %q for launchable %q", executable.Service.Name, launchable.ServiceID())
 			}
+			restartPolicy := executable.RestartPolicy
+			if restartPolicy == "" {
+				restartPolicy = launchable.RestartPolicy()
+			}
 			sbTemplate[executable.Service.Name] = runit.ServiceTemplate{
 				Log:           pod.LogExec,
 				Run:           executable.Exec,
 				Finish:        pod.FinishExecForExecutable(launchable, executable),
-				RestartPolicy: launchable.RestartPolicy(),
+				RestartPolicy: restartPolicy,
 			}
 		}
 	}
@@ -333,50 +407,28 @@ func (pod *Pod) WriteCurrentManifest(manifest manifest.Manifest) (string, error)
 		}
 	}
 
-	f, err := os.OpenFile(pod.currentPodManifestPath(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-	if err != nil {
-		pod.logError(err, "Unable to open current manifest file")
-		err = pod.revertCurrentManifest(lastManifest)
-		if err != nil {
-			pod.logError(err, "Couldn't replace old manifest as current")
-		}
-		return "", err
-	}
-	defer f.Close()
-
-	err = manifest.Write(f)
-	if err != nil {
-		pod.logError(err, "Unable to write current manifest file")
-		err = pod.revertCurrentManifest(lastManifest)
-		if err != nil {
-			pod.logError(err, "Couldn't replace old manifest as current")
-		}
-		return "", err
-	}
-
 	uid, gid, err := user.IDs(manifest.RunAsUser())
 	if err != nil {
 		pod.logError(err, "Unable to find pod UID/GID")
-		// the write was still successful so we are not going to revert
 		return "", err
 	}
-	err = f.Chown(uid, gid)
+
+	// the write is atomic, so the old manifest is left in place if it
+	// fails
+	err = util.WriteAtomic(pod.currentPodManifestPath(), util.AtomicWriteOptions{
+		Perm:     0644,
+		UID:      uid,
+		GID:      gid,
+		Checksum: true,
+	}, manifest.Write)
 	if err != nil {
-		pod.logError(err, "Unable to chown current manifest")
+		pod.logError(err, "Unable to write current manifest file")
 		return "", err
 	}
 
 	return lastManifest, nil
 }
 
-func (pod *Pod) revertCurrentManifest(lastPath string) error {
-	if _, err := os.Stat(lastPath); err == nil {
-		return os.Rename(lastPath, pod.currentPodManifestPath())
-	} else {
-		return err
-	}
-}
-
 func (pod *Pod) currentPodManifestPath() string {
 	return filepath.Join(pod.home, "current_manifest.yaml")
 }
@@ -459,7 +511,17 @@ func (pod *Pod) Install(manifest manifest.Manifest, verifier auth.ArtifactVerifi
 		return err
 	}
 
-	downloader := artifact.NewLocationDownloader(pod.Fetcher, verifier)
+	freshInstall := usesFreshInstall(manifest)
+	var inUse map[string]bool
+	if freshInstall {
+		inUse, err = pod.inUseInstallDirs()
+		if err != nil {
+			return err
+		}
+	}
+
+	pod.installTimings = artifact.DownloadTimings{}
+	downloader := artifact.NewTimedLocationDownloader(pod.Fetcher, verifier, &pod.installTimings)
 	for launchableID, stanza := range manifest.GetLaunchableStanzas() {
 		// TODO: investigate passing in necessary fields to InstallDir()
 		launchable, err := pod.getLaunchable(launchableID, stanza, manifest.RunAsUser(), manifest.UnpackAsUser())
@@ -468,13 +530,24 @@ func (pod *Pod) Install(manifest manifest.Manifest, verifier auth.ArtifactVerifi
 			return err
 		}
 
+		isArtifact := launchable.Type() == "hoist" || launchable.Type() == "opencontainer"
 		if launchable.Installed() {
-			continue
+			// A fresh install never reuses an earlier install of this version unless
+			// it is the one currently running
+			if !freshInstall || !isArtifact || inUse[launchable.InstallDir()] {
+				continue
+			}
+			pod.logger.WithField("install_dir", launchable.InstallDir()).Infoln("Removing previous install of launchable for a fresh install")
+			err = os.RemoveAll(launchable.InstallDir())
+			if err != nil {
+				pod.logLaunchableError(launchable.ServiceID(), err, "Unable to remove previous install of launchable")
+				return err
+			}
 		}
 
 		// TODO: make this code better, probably abstract away launchable installation
 		// into something that understands the types
-		if launchable.Type() == "hoist" || launchable.Type() == "opencontainer" {
+		if isArtifact {
 			launchableURL, verificationData, err := artifactRegistry.LocationDataForLaunchable(pod.Id, launchableID, stanza)
 			if err != nil {
 				pod.logLaunchableError(launchable.ServiceID(), err, "Unable to install launchable")
@@ -518,6 +591,66 @@ func (pod *Pod) Install(manifest manifest.Manifest, verifier auth.ArtifactVerifi
 	return nil
 }
 
+// InstallTimings returns how long the last call to Install spent fetching,
+// verifying and extracting artifacts
+func (pod *Pod) InstallTimings() artifact.DownloadTimings {
+	return pod.installTimings
+}
+
+func usesFreshInstall(m manifest.Manifest) bool {
+	return m.GetUpgradeStrategy() == manifest.FreshInstallUpgrade
+}
+
+// inUseInstallDirs returns the install directories of the launchables in the
+// pod's current manifest
+func (pod *Pod) inUseInstallDirs() (map[string]bool, error) {
+	inUse := make(map[string]bool)
+	currentManifest, err := pod.CurrentManifest()
+	if err == NoCurrentManifest {
+		return inUse, nil
+	} else if err != nil {
+		return nil, util.Errorf("Could not read current manifest: %s", err)
+	}
+
+	launchables, err := pod.Launchables(currentManifest)
+	if err != nil {
+		return nil, err
+	}
+	for _, launchable := range launchables {
+		inUse[launchable.InstallDir()] = true
+	}
+	return inUse, nil
+}
+
+// Migrate runs the migrate script of every launchable in the manifest. It is
+// used by the fresh install upgrade strategy after the previous version of the
+// pod was halted and before Launch makes the new version current. An error is
+// returned for the first launchable whose migration fails.
+func (pod *Pod) Migrate(manifest manifest.Manifest) error {
+	launchables, err := pod.Launchables(manifest)
+	if err != nil {
+		return err
+	}
+
+	for _, launchable := range launchables {
+		var out string
+		migrateFunc := func() {
+			out, err = launchable.Migrate()
+		}
+		pod.withTimeWarnings("migrate", launchable.ServiceID(), migrateFunc)
+		if err != nil {
+			pod.logLaunchableError(launchable.ServiceID(), err, out)
+			return util.Errorf("Could not migrate %s: %s", launchable.ServiceID(), err)
+		}
+		if out != "" {
+			pod.logger.WithField("output", out).Infoln("Successfully migrated")
+		}
+	}
+
+	pod.logInfo("Successfully migrated")
+	return nil
+}
+
 func (pod *Pod) Verify(manifest manifest.Manifest, authPolicy auth.Policy) error {
 	for launchableID, stanza := range manifest.GetLaunchableStanzas() {
 		if stanza.DigestLocation == "" {
@@ -712,23 +845,9 @@ func writeEnvFile(envDir, name, value string, uid, gid int) error {
 	return writeFileChown(filepath.Join(envDir, name), []byte(value), uid, gid)
 }
 
-// writeFileChown writes data to a file and sets its owner.
+// writeFileChown atomically writes data to a file and sets its owner.
 func writeFileChown(filename string, data []byte, uid, gid int) error {
-	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-	if err != nil {
-		return err
-	}
-	_, err = file.Write(data)
-	if err != nil {
-		_ = file.Close()
-		return err
-	}
-	err = file.Chown(uid, gid)
-	if err != nil {
-		_ = file.Close()
-		return err
-	}
-	return file.Close()
+	return util.WriteFileAtomic(filename, data, util.AtomicWriteOptions{Perm: 0644, UID: uid, GID: gid})
 }
 
 func (pod *Pod) Launchables(manifest manifest.Manifest) ([]launch.Launchable, error) {
@@ -751,11 +870,15 @@ func (pod *Pod) SetFinishExec(finishExec []string) {
 }
 
 func (pod *Pod) FinishExecForExecutable(launchable launch.Launchable, executable launch.Executable) runit.Exec {
+	extraEnv := map[string]string{launch.EntryPointEnvVar: executable.RelativePath}
+	if executable.CgroupName != "" {
+		extraEnv[CgroupNameEnvVar] = executable.CgroupName
+	}
 	p2ExecArgs := p2exec.P2ExecArgs{
 		Command:  pod.FinishExec,
 		User:     "nobody",
 		EnvDirs:  []string{pod.EnvDir(), launchable.EnvDir()},
-		ExtraEnv: map[string]string{launch.EntryPointEnvVar: executable.RelativePath},
+		ExtraEnv: extraEnv,
 	}
 
 	return append([]string{pod.P2Exec}, p2ExecArgs.CommandLine()...)
@@ -849,9 +972,12 @@ func (pod *Pod) getLaunchable(launchableID launch.LaunchableID, launchableStanza
 			CgroupName:       cgroupName,
 			SuppliedEnvVars:  launchableStanza.Env,
 			EntryPoints:      entryPoints,
+			Processes:        launchableStanza.Processes,
 			IsUUIDPod:        pod.uniqueKey != "",
 			RequireFile:      pod.RequireFile,
 			NoHaltOnUpdate_:  launchableStanza.NoHaltOnUpdate,
+			ReloadSignal:     launchableStanza.ReloadSignal,
+			StopSignal:       launchableStanza.StopSignal,
 		}
 		ret.CgroupConfig.Name = cgroups.CgroupID(ret.ServiceId)
 		return ret.If(), nil
@@ -872,6 +998,8 @@ func (pod *Pod) getLaunchable(launchableID launch.LaunchableID, launchableStanza
 			CgroupConfigName:  launchableID.String(),
 			PodEnvDir:         pod.EnvDir(),
 			ExecNoLimit:       true,
+			ReloadSignal:      launchableStanza.ReloadSignal,
+			StopSignal:        launchableStanza.StopSignal,
 		}
 		ret.CgroupConfig.Name = cgroups.CgroupID(serviceId)
 		return ret, nil
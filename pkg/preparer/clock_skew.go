@@ -0,0 +1,275 @@
+package preparer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rcrowley/go-metrics"
+
+	"github.com/square/p2/pkg/logging"
+	p2metrics "github.com/square/p2/pkg/metrics"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/statusstore/nodestatus"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/param"
+)
+
+var (
+	// ClockSkewIntervalSec is how often the preparer compares the node's clock with its
+	// reference clock
+	ClockSkewIntervalSec = param.Int("clock_skew_interval_sec", 60)
+
+	// ClockSkewThresholdMs is how far, in milliseconds, the node's clock may be from its
+	// reference clock before it is considered skewed
+	ClockSkewThresholdMs = param.Int("clock_skew_threshold_ms", 2000)
+)
+
+// Gauge of the last measured offset of the node's clock from its reference clock, in
+// milliseconds. Positive when the node's clock is ahead
+const clockSkewMetric = "preparer_clock_skew_ms"
+
+// ClockReference is a clock that the node's clock is compared with
+type ClockReference interface {
+	// Offset returns how far the local clock is ahead of the reference clock. It is
+	// negative when the local clock is behind
+	Offset() (time.Duration, error)
+}
+
+// NewClockReference returns the reference clock described by reference, either an NTP
+// server as ntp://host[:port], or an HTTP server whose Date header is read, such as a
+// Consul server's http://host:8500/v1/status/leader. The Date header only has a
+// resolution of one second, so the threshold used with an HTTP reference must be well
+// above that. The local Consul agent shares the node's clock, so it can't be a reference.
+func NewClockReference(reference string, client *http.Client) (ClockReference, error) {
+	u, err := url.Parse(reference)
+	if err != nil {
+		return nil, util.Errorf("invalid clock reference %q: %s", reference, err)
+	}
+	switch u.Scheme {
+	case "ntp":
+		address := u.Host
+		if u.Port() == "" {
+			address = net.JoinHostPort(u.Hostname(), "123")
+		}
+		return ntpReference{address: address, timeout: 5 * time.Second}, nil
+	case "http", "https":
+		return httpDateReference{url: reference, client: client}, nil
+	default:
+		return nil, util.Errorf("unsupported clock reference %q, expected an ntp:// or http(s):// URL", reference)
+	}
+}
+
+// The number of seconds between the NTP epoch, 1900, and the Unix epoch
+const ntpEpochOffset = 2208988800
+
+// ntpReference queries an NTP server with a single SNTP request (RFC 4330)
+type ntpReference struct {
+	address string
+	timeout time.Duration
+}
+
+func (r ntpReference) Offset() (time.Duration, error) {
+	conn, err := net.DialTimeout("udp", r.address, r.timeout)
+	if err != nil {
+		return 0, util.Errorf("could not reach NTP server %s: %s", r.address, err)
+	}
+	defer conn.Close()
+	if err = conn.SetDeadline(time.Now().Add(r.timeout)); err != nil {
+		return 0, err
+	}
+
+	request := make([]byte, 48)
+	request[0] = 0x23 // no leap second warning, version 4, client mode
+	sent := time.Now()
+	binary.BigEndian.PutUint64(request[40:], toNTPTime(sent))
+	if _, err = conn.Write(request); err != nil {
+		return 0, util.Errorf("could not query NTP server %s: %s", r.address, err)
+	}
+
+	response := make([]byte, 48)
+	n, err := conn.Read(response)
+	received := time.Now()
+	if err != nil {
+		return 0, util.Errorf("could not read response of NTP server %s: %s", r.address, err)
+	}
+	if n < len(response) {
+		return 0, util.Errorf("short response from NTP server %s", r.address)
+	}
+	return ntpOffset(request, response, sent, received)
+}
+
+// ntpOffset computes the local clock's offset from an NTP server's response to request,
+// which was sent and received at the given local times
+func ntpOffset(request []byte, response []byte, sent time.Time, received time.Time) (time.Duration, error) {
+	if mode := response[0] & 0x7; mode != 4 {
+		return 0, util.Errorf("NTP response is not from a server, mode %d", mode)
+	}
+	if stratum := response[1]; stratum == 0 {
+		return 0, util.Errorf("NTP server is not synchronized")
+	}
+	// The server echoes the request's transmit time as the originate time
+	if !bytes.Equal(response[24:32], request[40:48]) {
+		return 0, util.Errorf("NTP response does not answer the request")
+	}
+
+	serverReceived := fromNTPTime(binary.BigEndian.Uint64(response[32:]))
+	serverSent := fromNTPTime(binary.BigEndian.Uint64(response[40:]))
+	serverAhead := (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2
+	return -serverAhead, nil
+}
+
+func toNTPTime(t time.Time) uint64 {
+	seconds := uint64(t.Unix() + ntpEpochOffset)
+	fraction := (uint64(t.Nanosecond()) << 32) / uint64(time.Second)
+	return seconds<<32 | fraction
+}
+
+func fromNTPTime(ntp uint64) time.Time {
+	seconds := int64(ntp>>32) - ntpEpochOffset
+	nanoseconds := int64(((ntp & 0xffffffff) * uint64(time.Second)) >> 32)
+	return time.Unix(seconds, nanoseconds)
+}
+
+// httpDateReference reads the clock of an HTTP server from the Date header of its
+// responses
+type httpDateReference struct {
+	url    string
+	client *http.Client
+}
+
+func (r httpDateReference) Offset() (time.Duration, error) {
+	sent := time.Now()
+	resp, err := r.client.Get(r.url)
+	received := time.Now()
+	if err != nil {
+		return 0, util.Errorf("could not reach clock reference %s: %s", r.url, err)
+	}
+	defer resp.Body.Close()
+
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, util.Errorf("clock reference %s did not send a valid Date header: %s", r.url, err)
+	}
+	// Date is truncated to the second, so on average it's half a second behind the
+	// server's clock. Likewise the server is assumed to have answered halfway through
+	// the request
+	server := date.Add(500 * time.Millisecond)
+	local := sent.Add(received.Sub(sent) / 2)
+	return local.Sub(server), nil
+}
+
+// ClockSkew periodically compares the node's clock with a reference clock. Health
+// result expiry and session refreshes assume that the clocks of the nodes are in sync,
+// so while the node's clock is further from the reference than ClockSkewThresholdMs
+// the preparer publishes the clock_skewed node condition, and the health results it
+// writes are marked so that their freshness is judged by their sessions rather than
+// their timestamps.
+type ClockSkew struct {
+	reference ClockReference
+	interval  time.Duration
+	threshold time.Duration
+	publish   func(skewed bool, since time.Time, offset time.Duration) error
+	logger    logging.Logger
+	gauge     metrics.Gauge
+
+	mu          sync.Mutex
+	offset      time.Duration
+	skewedSince time.Time
+	published   bool // whether the current state has been published
+}
+
+func NewClockSkew(
+	reference ClockReference,
+	publish func(skewed bool, since time.Time, offset time.Duration) error,
+	logger logging.Logger,
+) *ClockSkew {
+	return &ClockSkew{
+		reference: reference,
+		interval:  time.Duration(*ClockSkewIntervalSec) * time.Second,
+		threshold: time.Duration(*ClockSkewThresholdMs) * time.Millisecond,
+		publish:   publish,
+		logger:    logger,
+		gauge:     metrics.GetOrRegisterGauge(clockSkewMetric, p2metrics.Registry),
+	}
+}
+
+// Run checks the node's clock until quit is closed
+func (c *ClockSkew) Run(quit <-chan struct{}) {
+	for {
+		c.check()
+		select {
+		case <-quit:
+			return
+		case <-time.After(c.interval):
+		}
+	}
+}
+
+func (c *ClockSkew) check() {
+	offset, err := c.reference.Offset()
+	if err != nil {
+		// Whether the clock is skewed is unknown, so the last state stands
+		c.logger.WithError(err).Warnln("Could not compare the node's clock with its reference")
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.offset = offset
+	c.gauge.Update(int64(offset / time.Millisecond))
+
+	skewed := offset > c.threshold || -offset > c.threshold
+	wasSkewed := !c.skewedSince.IsZero()
+	if skewed && !wasSkewed {
+		c.skewedSince = time.Now()
+		c.published = false
+		c.logger.WithFields(logrus.Fields{
+			"offset":    offset,
+			"threshold": c.threshold,
+		}).Errorln("The node's clock is skewed")
+	} else if !skewed && wasSkewed {
+		c.skewedSince = time.Time{}
+		c.published = false
+		c.logger.WithField("offset", offset).Infoln("The node's clock is no longer skewed")
+	}
+
+	if !c.published {
+		err = c.publish(skewed, c.skewedSince, offset)
+		if err != nil {
+			c.logger.WithError(err).Errorln("Could not publish clock skew")
+			return
+		}
+		c.published = true
+	}
+}
+
+// Skewed returns whether the node's clock is currently considered skewed, and its last
+// measured offset from the reference clock. A nil ClockSkew is never skewed.
+func (c *ClockSkew) Skewed() (bool, time.Duration) {
+	if c == nil {
+		return false, 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.skewedSince.IsZero(), c.offset
+}
+
+// publishClockSkew records whether the node's clock is skewed in the node's status and
+// on the health results the node writes
+func (p *Preparer) publishClockSkew(skewed bool, since time.Time, offset time.Duration) error {
+	consul.SetLocalClockSkewed(skewed)
+	if !skewed {
+		return p.setNodeCondition(nodestatus.ClockSkewed, nil)
+	}
+	return p.setNodeCondition(nodestatus.ClockSkewed, &nodestatus.Condition{
+		Since:   since,
+		Message: fmt.Sprintf("clock is %s off its reference", offset),
+	})
+}
@@ -0,0 +1,195 @@
+package preparer
+
+import (
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/consulutil/consulutiltest"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/nodestatus"
+	"github.com/square/p2/pkg/util"
+)
+
+type fakeClockReference struct {
+	offset time.Duration
+	err    error
+}
+
+func (f *fakeClockReference) Offset() (time.Duration, error) {
+	return f.offset, f.err
+}
+
+type publishedSkew struct {
+	skewed bool
+	offset time.Duration
+}
+
+func TestClockSkewPublishesTransitions(t *testing.T) {
+	reference := &fakeClockReference{}
+	var published []publishedSkew
+	publishErr := error(nil)
+	publish := func(skewed bool, since time.Time, offset time.Duration) error {
+		if skewed == since.IsZero() {
+			t.Errorf("expected skew to be published with when it started, got %s", since)
+		}
+		published = append(published, publishedSkew{skewed, offset})
+		return publishErr
+	}
+	skew := NewClockSkew(reference, publish, logging.TestLogger())
+	skew.threshold = time.Second
+
+	skew.check()
+	if skewed, _ := skew.Skewed(); skewed {
+		t.Fatal("clock shouldn't be skewed without an offset")
+	}
+	if len(published) != 1 || published[0].skewed {
+		t.Fatalf("expected the initial state to be published, got %v", published)
+	}
+
+	reference.offset = -2 * time.Second
+	skew.check()
+	skewed, offset := skew.Skewed()
+	if !skewed || offset != -2*time.Second {
+		t.Fatalf("expected clock behind the reference to be skewed, got %t and %s", skewed, offset)
+	}
+	if len(published) != 2 || !published[1].skewed {
+		t.Fatalf("expected the skew to be published, got %v", published)
+	}
+	if skew.gauge.Value() != -2000 {
+		t.Errorf("expected skew gauge to be -2000, was %d", skew.gauge.Value())
+	}
+
+	// failing to measure keeps the last state
+	reference.err = util.Errorf("timed out")
+	skew.check()
+	if skewed, _ := skew.Skewed(); !skewed {
+		t.Fatal("clock should still be skewed when the reference can't be reached")
+	}
+
+	// failing to publish is retried
+	reference.err = nil
+	reference.offset = 100 * time.Millisecond
+	publishErr = util.Errorf("consul is down")
+	skew.check()
+	publishErr = nil
+	skew.check()
+	if skewed, _ := skew.Skewed(); skewed {
+		t.Fatal("clock shouldn't be skewed once it's back within the threshold")
+	}
+	if len(published) != 4 || published[3].skewed {
+		t.Fatalf("expected the end of the skew to be published until it succeeds, got %v", published)
+	}
+
+	skew.check()
+	if len(published) != 4 {
+		t.Errorf("expected an unchanged state not to be published again, got %v", published)
+	}
+}
+
+func TestNilClockSkewIsNotSkewed(t *testing.T) {
+	var skew *ClockSkew
+	if skewed, _ := skew.Skewed(); skewed {
+		t.Error("a nil ClockSkew should never be skewed")
+	}
+}
+
+func TestNTPOffset(t *testing.T) {
+	sent := time.Unix(1500000000, 0)
+	received := sent.Add(100 * time.Millisecond)
+	request := make([]byte, 48)
+	binary.BigEndian.PutUint64(request[40:], toNTPTime(sent))
+
+	// a server 5s ahead that took 20ms to answer
+	response := make([]byte, 48)
+	response[0] = 0x24
+	response[1] = 2
+	copy(response[24:32], request[40:48])
+	binary.BigEndian.PutUint64(response[32:], toNTPTime(sent.Add(5*time.Second+40*time.Millisecond)))
+	binary.BigEndian.PutUint64(response[40:], toNTPTime(sent.Add(5*time.Second+60*time.Millisecond)))
+
+	offset, err := ntpOffset(request, response, sent, received)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset < -5*time.Second-time.Millisecond || offset > -5*time.Second+time.Millisecond {
+		t.Errorf("expected the local clock to be 5s behind, got %s", offset)
+	}
+
+	other := make([]byte, 48)
+	binary.BigEndian.PutUint64(other[40:], toNTPTime(sent.Add(time.Second)))
+	if _, err = ntpOffset(other, response, sent, received); err == nil {
+		t.Error("expected a response to another request to be an error")
+	}
+	response[1] = 0
+	if _, err = ntpOffset(request, response, sent, received); err == nil {
+		t.Error("expected a response from an unsynchronized server to be an error")
+	}
+}
+
+func TestHTTPDateReference(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+	}))
+	defer server.Close()
+
+	reference, err := NewClockReference(server.URL, http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset, err := reference.Offset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset < time.Hour-2*time.Second || offset > time.Hour+2*time.Second {
+		t.Errorf("expected the local clock to be an hour ahead, got %s", offset)
+	}
+
+	if _, err = NewClockReference("ftp://clock", http.DefaultClient); err == nil {
+		t.Error("expected an unsupported clock reference to be an error")
+	}
+}
+
+func TestPublishClockSkewSetsNodeCondition(t *testing.T) {
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	defer consul.SetLocalClockSkewed(false)
+
+	p.client = consulutiltest.NewConsul()
+	nodeStatusStore := nodestatus.NewConsul(statusstore.NewConsul(p.client), statusstore.PreparerPodStatusNamespace)
+	p.nodeStatusStore = nodeStatusStore
+	if err := p.MarkNodeRunning(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.publishClockSkew(true, time.Now(), 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	status, _, err := nodeStatusStore.Get(p.node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.HasCondition(nodestatus.ClockSkewed) {
+		t.Error("expected the node to have the clock_skewed condition")
+	}
+	if status.State != nodestatus.NodeRunning {
+		t.Errorf("expected publishing a condition to keep the node's state, got %q", status.State)
+	}
+
+	if err = p.publishClockSkew(false, time.Time{}, 0); err != nil {
+		t.Fatal(err)
+	}
+	status, _, err = nodeStatusStore.Get(p.node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.HasCondition(nodestatus.ClockSkewed) {
+		t.Error("expected the clock_skewed condition to be cleared")
+	}
+}
@@ -0,0 +1,117 @@
+package preparer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/consul/api"
+	"github.com/rcrowley/go-metrics"
+
+	"github.com/square/p2/pkg/logging"
+	p2metrics "github.com/square/p2/pkg/metrics"
+	"github.com/square/p2/pkg/util/param"
+)
+
+var (
+	// ConsulLivenessIntervalSec is how often the preparer checks that it can reach Consul
+	// through its local agent
+	ConsulLivenessIntervalSec = param.Int("consul_liveness_interval_sec", 5)
+
+	// ConsulLivenessFailures is how many consecutive failed checks put the preparer into
+	// degraded mode
+	ConsulLivenessFailures = param.Int("consul_liveness_failures", 3)
+)
+
+// The key read to check Consul liveness. It doesn't need to exist: a read of a missing key
+// still has to make it through the agent to a server.
+const consulLivenessKey = "p2-preparer/liveness"
+
+// Gauge that is 1 while the preparer is in degraded mode and 0 otherwise
+const consulDegradedMetric = "preparer_consul_degraded"
+
+type LivenessKV interface {
+	Get(key string, q *api.QueryOptions) (*api.KVPair, *api.QueryMeta, error)
+}
+
+// ConsulLiveness periodically checks whether Consul can be reached through the local
+// agent. After ConsulLivenessFailures consecutive failures the preparer is "degraded":
+// pod workers back off to their maximum retry interval instead of hammering an
+// unavailable agent, errors that are only symptoms of the outage stop being logged, and
+// the status server and the preparer_consul_degraded gauge report the outage so operators
+// can alert on it. Pods that are already running are left alone, and health results keep
+// being checked locally and are written once Consul is reachable again.
+type ConsulLiveness struct {
+	kv       LivenessKV
+	interval time.Duration
+	failures int
+	logger   logging.Logger
+	gauge    metrics.Gauge
+
+	mu                  sync.Mutex
+	consecutiveFailures int
+	degradedSince       time.Time
+	lastErr             error
+}
+
+func NewConsulLiveness(kv LivenessKV, logger logging.Logger) *ConsulLiveness {
+	return &ConsulLiveness{
+		kv:       kv,
+		interval: time.Duration(*ConsulLivenessIntervalSec) * time.Second,
+		failures: *ConsulLivenessFailures,
+		logger:   logger,
+		gauge:    metrics.GetOrRegisterGauge(consulDegradedMetric, p2metrics.Registry),
+	}
+}
+
+// Run checks Consul liveness until quit is closed
+func (c *ConsulLiveness) Run(quit <-chan struct{}) {
+	for {
+		c.check()
+		select {
+		case <-quit:
+			return
+		case <-time.After(c.interval):
+		}
+	}
+}
+
+func (c *ConsulLiveness) check() {
+	// A stale read can be served by any server, so this only fails when the agent
+	// can't reach the cluster at all
+	_, _, err := c.kv.Get(consulLivenessKey, &api.QueryOptions{AllowStale: true})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil {
+		if !c.degradedSince.IsZero() {
+			c.logger.WithField("duration", time.Since(c.degradedSince)).Infoln("Consul is reachable again, leaving degraded mode")
+			c.gauge.Update(0)
+		}
+		c.consecutiveFailures = 0
+		c.degradedSince = time.Time{}
+		c.lastErr = nil
+		return
+	}
+
+	c.consecutiveFailures++
+	c.lastErr = err
+	if c.degradedSince.IsZero() && c.consecutiveFailures >= c.failures {
+		c.degradedSince = time.Now()
+		c.gauge.Update(1)
+		c.logger.WithErrorAndFields(err, logrus.Fields{
+			"failures": c.consecutiveFailures,
+		}).Errorln("Consul is unreachable, entering degraded mode")
+	}
+}
+
+// Degraded returns whether Consul is currently considered unreachable, and if so since
+// when and why. A nil ConsulLiveness is never degraded.
+func (c *ConsulLiveness) Degraded() (bool, time.Time, error) {
+	if c == nil {
+		return false, time.Time{}, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.degradedSince.IsZero(), c.degradedSince, c.lastErr
+}
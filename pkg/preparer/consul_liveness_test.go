@@ -0,0 +1,63 @@
+package preparer
+
+import (
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/util"
+)
+
+type fakeLivenessKV struct {
+	err error
+}
+
+func (f *fakeLivenessKV) Get(key string, q *api.QueryOptions) (*api.KVPair, *api.QueryMeta, error) {
+	return nil, nil, f.err
+}
+
+func TestConsulLivenessDegradesAfterConsecutiveFailures(t *testing.T) {
+	kv := &fakeLivenessKV{}
+	liveness := NewConsulLiveness(kv, logging.TestLogger())
+	liveness.failures = 2
+
+	liveness.check()
+	if degraded, _, _ := liveness.Degraded(); degraded {
+		t.Fatal("should not be degraded while consul is reachable")
+	}
+
+	kv.err = util.Errorf("connection refused")
+	liveness.check()
+	if degraded, _, _ := liveness.Degraded(); degraded {
+		t.Fatal("should not be degraded after a single failure")
+	}
+
+	liveness.check()
+	degraded, since, err := liveness.Degraded()
+	if !degraded {
+		t.Fatal("should be degraded after consecutive failures")
+	}
+	if since.IsZero() || err == nil {
+		t.Errorf("expected degraded mode to report when and why, got %s and %v", since, err)
+	}
+	if liveness.gauge.Value() != 1 {
+		t.Errorf("expected degraded gauge to be 1, was %d", liveness.gauge.Value())
+	}
+
+	kv.err = nil
+	liveness.check()
+	if degraded, _, _ := liveness.Degraded(); degraded {
+		t.Fatal("should leave degraded mode once consul is reachable")
+	}
+	if liveness.gauge.Value() != 0 {
+		t.Errorf("expected degraded gauge to be 0, was %d", liveness.gauge.Value())
+	}
+}
+
+func TestNilConsulLivenessIsNotDegraded(t *testing.T) {
+	var liveness *ConsulLiveness
+	if degraded, _, _ := liveness.Degraded(); degraded {
+		t.Error("a nil ConsulLiveness should never be degraded")
+	}
+}
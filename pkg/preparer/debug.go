@@ -0,0 +1,273 @@
+package preparer
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime/pprof"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+)
+
+// The number of log entries at warning level or above kept for debug bundles
+const recentErrorCount = 200
+
+// PodView summarizes the intent and reality manifests of a pod as last read
+// by the preparer
+type PodView struct {
+	ID           types.PodID        `json:"id"`
+	PodUniqueKey types.PodUniqueKey `json:"pod_unique_key,omitempty"`
+	IntentSHA    string             `json:"intent_sha,omitempty"`
+	RealitySHA   string             `json:"reality_sha,omitempty"`
+}
+
+// PendingOperation describes a pod whose intent the preparer has not yet
+// managed to enact
+type PendingOperation struct {
+	ID           types.PodID        `json:"id"`
+	PodUniqueKey types.PodUniqueKey `json:"pod_unique_key,omitempty"`
+	IntentSHA    string             `json:"intent_sha,omitempty"`
+	Since        time.Time          `json:"since"`
+	Attempts     int                `json:"attempts"`
+	NextAttempt  time.Time          `json:"next_attempt,omitempty"`
+}
+
+// LoggedError is a log entry at warning level or above
+type LoggedError struct {
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// DebugSnapshot is the preparer's internal state as included in debug bundles
+type DebugSnapshot struct {
+	Node         types.NodeName     `json:"node"`
+	Time         time.Time          `json:"time"`
+	Pods         []PodView          `json:"pods"`
+	Pending      []PendingOperation `json:"pending"`
+	RecentErrors []LoggedError      `json:"recent_errors"`
+}
+
+// debugState records what the preparer is doing for debug bundles. A nil
+// *debugState records nothing.
+type debugState struct {
+	mu      sync.Mutex
+	pods    []PodView
+	pending map[podWorkerID]*PendingOperation
+	errors  []LoggedError
+}
+
+func newDebugState() *debugState {
+	return &debugState{
+		pending: make(map[podWorkerID]*PendingOperation),
+	}
+}
+
+func viewOf(pair ManifestPair) PodView {
+	view := PodView{ID: pair.ID, PodUniqueKey: pair.PodUniqueKey}
+	view.IntentSHA = manifestSHA(pair.Intent)
+	view.RealitySHA = manifestSHA(pair.Reality)
+	return view
+}
+
+func manifestSHA(m manifest.Manifest) string {
+	if m == nil {
+		return ""
+	}
+	sha, err := m.SHA()
+	if err != nil {
+		return fmt.Sprintf("<error: %s>", err)
+	}
+	return sha
+}
+
+func (d *debugState) setPairs(pairs []ManifestPair) {
+	if d == nil {
+		return
+	}
+	views := make([]PodView, len(pairs))
+	for i, pair := range pairs {
+		views[i] = viewOf(pair)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pods = views
+}
+
+// received records that a pod's worker got a pair to enact
+func (d *debugState) received(id podWorkerID, pair ManifestPair) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pending[id] = &PendingOperation{
+		ID:           id.podID,
+		PodUniqueKey: id.podUniqueKey,
+		IntentSHA:    manifestSHA(pair.Intent),
+		Since:        time.Now(),
+	}
+}
+
+// failed records that an attempt to enact a pod's pair failed and when the
+// next attempt will be made
+func (d *debugState) failed(id podWorkerID, backoff time.Duration) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if op, ok := d.pending[id]; ok {
+		op.Attempts++
+		op.NextAttempt = time.Now().Add(backoff)
+	}
+}
+
+// done records that a pod's worker has nothing left to do
+func (d *debugState) done(id podWorkerID) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.pending, id)
+}
+
+func (d *debugState) snapshot() ([]PodView, []PendingOperation, []LoggedError) {
+	if d == nil {
+		return nil, nil, nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	pods := make([]PodView, len(d.pods))
+	copy(pods, d.pods)
+	pending := make([]PendingOperation, 0, len(d.pending))
+	for _, op := range d.pending {
+		pending = append(pending, *op)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Since.Before(pending[j].Since)
+	})
+	errors := make([]LoggedError, len(d.errors))
+	copy(errors, d.errors)
+	return pods, pending, errors
+}
+
+// Levels implements logrus.Hook, so that recent errors are kept
+func (d *debugState) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel, logrus.WarnLevel}
+}
+
+// Fire implements logrus.Hook
+func (d *debugState) Fire(entry *logrus.Entry) error {
+	if d == nil {
+		return nil
+	}
+	logged := LoggedError{
+		Time:    entry.Time,
+		Level:   entry.Level.String(),
+		Message: entry.Message,
+	}
+	if len(entry.Data) > 0 {
+		logged.Fields = make(map[string]string, len(entry.Data))
+		for k, v := range entry.Data {
+			logged.Fields[k] = fmt.Sprint(v)
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.errors = append(d.errors, logged)
+	if len(d.errors) > recentErrorCount {
+		d.errors = d.errors[len(d.errors)-recentErrorCount:]
+	}
+	return nil
+}
+
+// DebugSnapshot returns the preparer's view of intent and reality, the pod
+// changes it has yet to enact and the warnings and errors it logged recently
+func (p *Preparer) DebugSnapshot() (interface{}, error) {
+	pods, pending, errors := p.debug.snapshot()
+	return DebugSnapshot{
+		Node:         p.node,
+		Time:         time.Now(),
+		Pods:         pods,
+		Pending:      pending,
+		RecentErrors: errors,
+	}, nil
+}
+
+// DebugSection is a file in a debug bundle. Snapshot returns a value that is
+// written to the file as JSON
+type DebugSection struct {
+	Name     string
+	Snapshot func() (interface{}, error)
+}
+
+// WriteDebugBundle writes a gzipped tarball holding the goroutine stacks of
+// the process and a JSON file per section. A section that fails is replaced
+// by a file holding its error, so that the rest of the bundle is still useful.
+func WriteDebugBundle(w io.Writer, sections []DebugSection) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+
+	addFile := func(name string, content []byte) error {
+		err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(content)),
+			ModTime: now,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(content)
+		return err
+	}
+
+	stacks := &bytes.Buffer{}
+	err := pprof.Lookup("goroutine").WriteTo(stacks, 2)
+	if err != nil {
+		fmt.Fprintf(stacks, "could not dump goroutines: %s", err)
+	}
+	err = addFile("goroutines.txt", stacks.Bytes())
+	if err != nil {
+		return err
+	}
+
+	for _, section := range sections {
+		value, err := section.Snapshot()
+		var content []byte
+		if err == nil {
+			content, err = json.MarshalIndent(value, "", "  ")
+		}
+		name := section.Name + ".json"
+		if err != nil {
+			name = section.Name + ".error"
+			content = []byte(err.Error())
+		}
+		err = addFile(name, content)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,117 @@
+package preparer
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+)
+
+func TestDebugStateTracksPendingOperations(t *testing.T) {
+	debug := newDebugState()
+	builder := manifest.NewBuilder()
+	builder.SetID("web")
+	pair := ManifestPair{ID: "web", Intent: builder.GetManifest()}
+	id := workerIDOf(pair)
+
+	debug.setPairs([]ManifestPair{pair})
+	debug.received(id, pair)
+	debug.failed(id, time.Minute)
+	debug.failed(id, time.Minute)
+
+	pods, pending, _ := debug.snapshot()
+	if len(pods) != 1 || pods[0].IntentSHA == "" || pods[0].RealitySHA != "" {
+		t.Errorf("Expected a pod with only an intent manifest, got %+v", pods)
+	}
+	if len(pending) != 1 {
+		t.Fatalf("Expected one pending operation, got %d", len(pending))
+	}
+	if pending[0].ID != "web" || pending[0].Attempts != 2 || pending[0].NextAttempt.IsZero() {
+		t.Errorf("Unexpected pending operation %+v", pending[0])
+	}
+
+	debug.done(id)
+	_, pending, _ = debug.snapshot()
+	if len(pending) != 0 {
+		t.Errorf("Expected no pending operations once done, got %+v", pending)
+	}
+
+	// a preparer without debug state must not panic
+	var nilState *debugState
+	nilState.received(id, pair)
+	nilState.done(id)
+}
+
+func TestDebugStateKeepsRecentErrors(t *testing.T) {
+	debug := newDebugState()
+	logger := logging.TestLogger()
+	logger.Logger.Hooks.Add(debug)
+
+	logger.NoFields().Infoln("not an error")
+	for i := 0; i < recentErrorCount+10; i++ {
+		logger.WithField("pod", "web").Errorln("could not launch")
+	}
+
+	_, _, errs := debug.snapshot()
+	if len(errs) != recentErrorCount {
+		t.Fatalf("Expected the %d most recent errors to be kept, got %d", recentErrorCount, len(errs))
+	}
+	if errs[0].Message != "could not launch" || errs[0].Fields["pod"] != "web" || errs[0].Level != logrus.ErrorLevel.String() {
+		t.Errorf("Unexpected logged error %+v", errs[0])
+	}
+}
+
+func TestWriteDebugBundle(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := WriteDebugBundle(buf, []DebugSection{
+		{Name: "ok", Snapshot: func() (interface{}, error) { return map[string]int{"pods": 3}, nil }},
+		{Name: "broken", Snapshot: func() (interface{}, error) { return nil, errors.New("unavailable") }},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error writing debug bundle: %s", err)
+	}
+
+	gz, err := gzip.NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[header.Name] = string(content)
+	}
+
+	if !strings.Contains(files["goroutines.txt"], "TestWriteDebugBundle") {
+		t.Error("Expected the bundle to contain goroutine stacks")
+	}
+	var ok map[string]int
+	err = json.Unmarshal([]byte(files["ok.json"]), &ok)
+	if err != nil || ok["pods"] != 3 {
+		t.Errorf("Expected ok.json to hold the section's snapshot, got %q", files["ok.json"])
+	}
+	if files["broken.error"] != "unavailable" {
+		t.Errorf("Expected broken.error to hold the section's error, got %q", files["broken.error"])
+	}
+}
@@ -0,0 +1,88 @@
+package preparer
+
+import (
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/deploystatus"
+	"github.com/square/p2/pkg/types"
+)
+
+type DeployStatusStore interface {
+	Get(node types.NodeName) (deploystatus.Status, *api.QueryMeta, error)
+	Set(node types.NodeName, status deploystatus.Status) error
+}
+
+// recordDeployTimings stores how long each phase of the deploy of pair.Intent
+// took on this node, so that deploy tooling can tell which nodes and phases
+// slowed a rollout down. Failures are logged but otherwise ignored, the
+// timings are informational.
+func (p *Preparer) recordDeployTimings(pair ManifestPair, timings deploystatus.Deploy, logger logging.Logger) {
+	sha, err := pair.Intent.SHA()
+	if err != nil {
+		logger.WithError(err).Warnln("Could not compute SHA for deploy timings")
+		return
+	}
+	timings.SHA = sha
+	timings.Finished = time.Now()
+	if timings.Install < 0 {
+		timings.Install = 0
+	}
+
+	// pods are resolved concurrently, and they all share this node's status
+	p.deployStatusLock.Lock()
+	defer p.deployStatusLock.Unlock()
+	status, _, err := p.deployStatusStore.Get(p.node)
+	switch {
+	case statusstore.IsNoStatus(err):
+	case err != nil:
+		logger.WithError(err).Warnln("Could not read deploy timings")
+		return
+	}
+	if status.Pods == nil {
+		status.Pods = make(map[types.PodID]deploystatus.Deploy)
+	}
+	status.Pods[pair.ID] = timings
+
+	err = p.deployStatusStore.Set(p.node, status)
+	if err != nil {
+		logger.WithError(err).Warnln("Could not write deploy timings")
+	}
+}
+
+// acknowledgeIntent records that this node saw the intent manifest with the
+// given SHA for a pod and started acting on it, so that deploy tooling can
+// tell the write landed without waiting for the whole deploy. Each manifest
+// is acknowledged once. Failures are logged but otherwise ignored.
+func (p *Preparer) acknowledgeIntent(podID types.PodID, sha string, logger logging.Logger) {
+	p.deployStatusLock.Lock()
+	defer p.deployStatusLock.Unlock()
+	if p.acknowledged[podID] == sha {
+		return
+	}
+
+	status, _, err := p.deployStatusStore.Get(p.node)
+	switch {
+	case statusstore.IsNoStatus(err):
+	case err != nil:
+		logger.WithError(err).Warnln("Could not read deploy status to acknowledge intent")
+		return
+	}
+	if status.Acks == nil {
+		status.Acks = make(map[types.PodID]deploystatus.Ack)
+	}
+	status.Acks[podID] = deploystatus.Ack{SHA: sha, At: time.Now()}
+
+	err = p.deployStatusStore.Set(p.node, status)
+	if err != nil {
+		logger.WithError(err).Warnln("Could not acknowledge intent")
+		return
+	}
+	if p.acknowledged == nil {
+		p.acknowledged = make(map[types.PodID]string)
+	}
+	p.acknowledged[podID] = sha
+}
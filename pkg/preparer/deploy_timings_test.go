@@ -0,0 +1,60 @@
+package preparer
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul/statusstore/deploystatus"
+	"github.com/square/p2/pkg/types"
+)
+
+type fakeDeployStatusStore struct {
+	statuses map[types.NodeName]deploystatus.Status
+}
+
+func (f *fakeDeployStatusStore) Get(node types.NodeName) (deploystatus.Status, *api.QueryMeta, error) {
+	return f.statuses[node], nil, nil
+}
+
+func (f *fakeDeployStatusStore) Set(node types.NodeName, status deploystatus.Status) error {
+	f.statuses[node] = status
+	return nil
+}
+
+func TestPreparerRecordsDeployTimings(t *testing.T) {
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	statuses := &fakeDeployStatusStore{statuses: map[types.NodeName]deploystatus.Status{
+		p.node: {Pods: map[types.PodID]deploystatus.Deploy{"other": {SHA: "abc123"}}},
+	}}
+	p.deployStatusStore = statuses
+
+	man := testManifest(t)
+	sha, _ := man.SHA()
+	pair := ManifestPair{ID: man.ID(), Intent: man}
+	if !p.resolvePair(pair, &TestPod{launchSuccess: true}, logging.DefaultLogger) {
+		t.Fatal("Expected the pod to be launched")
+	}
+
+	pods := statuses.statuses[p.node].Pods
+	if _, ok := pods["other"]; !ok {
+		t.Error("Expected the timings of other pods to be kept")
+	}
+	timings := pods[man.ID()]
+	if timings.SHA != sha || timings.Finished.IsZero() {
+		t.Errorf("Expected timings for %s, got %+v", sha, timings)
+	}
+	if timings.Fetch != time.Second || timings.Install < 0 {
+		t.Errorf("Expected the pod's install timings to be recorded, got %+v", timings)
+	}
+
+	ack := statuses.statuses[p.node].Acks[man.ID()]
+	if ack.SHA != sha || ack.At.IsZero() || ack.At.After(timings.Finished) {
+		t.Errorf("Expected the intent to be acknowledged before it was deployed, got %+v", ack)
+	}
+}
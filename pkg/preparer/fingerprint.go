@@ -0,0 +1,137 @@
+package preparer
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/osversion"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/fingerprintstatus"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/version"
+)
+
+type FingerprintStatusStore interface {
+	Get(node types.NodeName) (fingerprintstatus.Status, *api.QueryMeta, error)
+	Set(node types.NodeName, status fingerprintstatus.Status) error
+}
+
+// A Fingerprinter describes the environment of this host. Whatever it can't
+// determine is left empty, a fingerprint is only informational.
+type Fingerprinter interface {
+	Fingerprint() fingerprintstatus.Fingerprint
+}
+
+type hostFingerprinter struct {
+	// Where procfs is mounted, overridden in tests
+	procRoot string
+
+	osVersionDetector osversion.Detector
+
+	// The packages whose versions are recorded
+	packages       []string
+	packageVersion func(name string) (string, error)
+}
+
+func NewHostFingerprinter(osVersionDetector osversion.Detector, packages []string) Fingerprinter {
+	return hostFingerprinter{
+		procRoot:          "/proc",
+		osVersionDetector: osVersionDetector,
+		packages:          packages,
+		packageVersion:    systemPackageVersion,
+	}
+}
+
+func (h hostFingerprinter) Fingerprint() fingerprintstatus.Fingerprint {
+	fingerprint := fingerprintstatus.Fingerprint{
+		P2Version: version.VERSION,
+	}
+
+	if name, osVersion, err := h.osVersionDetector.Version(); err == nil {
+		fingerprint.OS = name.String() + " " + osVersion.String()
+	}
+	if release, err := ioutil.ReadFile(filepath.Join(h.procRoot, "sys", "kernel", "osrelease")); err == nil {
+		fingerprint.Kernel = strings.TrimSpace(string(release))
+	}
+
+	for _, pkg := range h.packages {
+		packageVersion, err := h.packageVersion(pkg)
+		if err != nil || packageVersion == "" {
+			continue
+		}
+		if fingerprint.Packages == nil {
+			fingerprint.Packages = make(map[string]string)
+		}
+		fingerprint.Packages[pkg] = packageVersion
+	}
+	return fingerprint
+}
+
+// systemPackageVersion asks whichever of rpm or dpkg the host has for the
+// installed version of a package. It returns "" if the package isn't
+// installed.
+func systemPackageVersion(name string) (string, error) {
+	var cmd *exec.Cmd
+	if _, err := exec.LookPath("rpm"); err == nil {
+		cmd = exec.Command("rpm", "-q", "--queryformat", "%{VERSION}-%{RELEASE}", name)
+	} else if _, err := exec.LookPath("dpkg-query"); err == nil {
+		cmd = exec.Command("dpkg-query", "-W", "-f=${Version}", name)
+	} else {
+		return "", util.Errorf("could not check the version of package %s: neither rpm nor dpkg-query is available", name)
+	}
+
+	out, err := cmd.Output()
+	if _, ok := err.(*exec.ExitError); ok {
+		return "", nil
+	}
+	if err != nil {
+		return "", util.Errorf("could not check the version of package %s: %s", name, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// recordFingerprint stores the environment this node had when pair.Intent
+// was written to reality, so that failures can later be correlated with
+// changes to the environment. Like deploy timings, failures are logged but
+// otherwise ignored.
+func (p *Preparer) recordFingerprint(pair ManifestPair, fingerprint fingerprintstatus.Fingerprint, logger logging.Logger) {
+	if p.fingerprintStatusStore == nil {
+		return
+	}
+	sha, err := pair.Intent.SHA()
+	if err != nil {
+		logger.WithError(err).Warnln("Could not compute SHA for fingerprint")
+		return
+	}
+
+	// the fingerprints of every pod on the node are written as one status
+	p.fingerprintStatusLock.Lock()
+	defer p.fingerprintStatusLock.Unlock()
+	status, _, err := p.fingerprintStatusStore.Get(p.node)
+	switch {
+	case statusstore.IsNoStatus(err):
+	case err != nil:
+		logger.WithError(err).Warnln("Could not read fingerprints")
+		return
+	}
+	if status.Pods == nil {
+		status.Pods = make(map[types.PodID]fingerprintstatus.Entry)
+	}
+	status.Pods[pair.ID] = fingerprintstatus.Entry{
+		SHA:         sha,
+		Time:        time.Now(),
+		Fingerprint: fingerprint,
+	}
+
+	err = p.fingerprintStatusStore.Set(p.node, status)
+	if err != nil {
+		logger.WithError(err).Warnln("Could not write fingerprints")
+	}
+}
@@ -0,0 +1,97 @@
+package preparer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/osversion"
+	"github.com/square/p2/pkg/store/consul/statusstore/fingerprintstatus"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/version"
+)
+
+type fakeFingerprintStatusStore struct {
+	statuses map[types.NodeName]fingerprintstatus.Status
+}
+
+func (f *fakeFingerprintStatusStore) Get(node types.NodeName) (fingerprintstatus.Status, *api.QueryMeta, error) {
+	return f.statuses[node], nil, nil
+}
+
+func (f *fakeFingerprintStatusStore) Set(node types.NodeName, status fingerprintstatus.Status) error {
+	f.statuses[node] = status
+	return nil
+}
+
+type fakeFingerprinter fingerprintstatus.Fingerprint
+
+func (f fakeFingerprinter) Fingerprint() fingerprintstatus.Fingerprint {
+	return fingerprintstatus.Fingerprint(f)
+}
+
+func TestHostFingerprinter(t *testing.T) {
+	procRoot := fakeProc(t)
+	defer os.RemoveAll(procRoot)
+	releaseFile := filepath.Join(procRoot, "redhat-release")
+	err := ioutil.WriteFile(releaseFile, []byte("CentOS Linux release 7.2.1511 (Core)\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fingerprinter := hostFingerprinter{
+		procRoot:          procRoot,
+		osVersionDetector: osversion.NewDetector(releaseFile),
+		packages:          []string{"openssl", "missing"},
+		packageVersion: func(name string) (string, error) {
+			if name == "openssl" {
+				return "1.0.1e-42.el7", nil
+			}
+			return "", nil
+		},
+	}
+
+	expected := fingerprintstatus.Fingerprint{
+		OS:        "CentOS 7.2.1511",
+		Kernel:    "3.10.0-514.el7.x86_64",
+		P2Version: version.VERSION,
+		Packages:  map[string]string{"openssl": "1.0.1e-42.el7"},
+	}
+	fingerprint := fingerprinter.Fingerprint()
+	if !reflect.DeepEqual(fingerprint, expected) {
+		t.Errorf("expected %+v, got %+v", expected, fingerprint)
+	}
+}
+
+func TestPreparerRecordsFingerprintWithReality(t *testing.T) {
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	statuses := &fakeFingerprintStatusStore{statuses: map[types.NodeName]fingerprintstatus.Status{
+		p.node: {Pods: map[types.PodID]fingerprintstatus.Entry{"other": {SHA: "abc123"}}},
+	}}
+	p.fingerprintStatusStore = statuses
+	fingerprint := fingerprintstatus.Fingerprint{Kernel: "4.4.0", P2Version: "1.2.3"}
+	p.fingerprinter = fakeFingerprinter(fingerprint)
+
+	man := testManifest(t)
+	sha, _ := man.SHA()
+	pair := ManifestPair{ID: man.ID(), Intent: man}
+	if !p.resolvePair(pair, &TestPod{launchSuccess: true}, logging.DefaultLogger) {
+		t.Fatal("Expected the pod to be launched")
+	}
+
+	pods := statuses.statuses[p.node].Pods
+	if _, ok := pods["other"]; !ok {
+		t.Error("Expected the fingerprints of other pods to be kept")
+	}
+	entry := pods[man.ID()]
+	if entry.SHA != sha || entry.Time.IsZero() || !reflect.DeepEqual(entry.Fingerprint, fingerprint) {
+		t.Errorf("Expected a fingerprint for %s, got %+v", sha, entry)
+	}
+}
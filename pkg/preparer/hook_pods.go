@@ -0,0 +1,90 @@
+package preparer
+
+import (
+	"os"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/hooks"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/store/consul"
+)
+
+// isHookPair returns whether the pair is of a hook pod, which are resolved by
+// resolveHookPair instead of resolvePair
+func isHookPair(pair ManifestPair) bool {
+	if pair.Intent != nil {
+		return pair.Intent.IsHook()
+	}
+	return pair.Reality != nil && pair.Reality.IsHook()
+}
+
+// resolveHookPair is resolvePair for hook pods. A hook pod isn't launched,
+// instead its launchables' executables are installed into the hooks
+// directory, the same way as the hooks manifest of the preparer's config.
+// Since hook pods are written to reality once their hooks are installed,
+// they can be rolled out with the same tools as any other pod.
+func (p *Preparer) resolveHookPair(pair ManifestPair, pod *pods.Pod, logger logging.Logger) bool {
+	if pair.PodUniqueKey != "" {
+		logger.NoFields().Errorln("Hook pods can't be scheduled with a uuid, ignoring")
+		return true
+	}
+
+	var oldSHA, newSHA string
+	if pair.Reality != nil {
+		oldSHA, _ = pair.Reality.SHA()
+	}
+	if pair.Intent != nil {
+		newSHA, _ = pair.Intent.SHA()
+	}
+
+	if newSHA == "" {
+		logger.NoFields().Infoln("hook manifest was deleted from intent, will remove")
+		return p.uninstallHookPod(pair, pod, logger)
+	}
+	if oldSHA == newSHA {
+		logger.NoFields().Debugln("hook manifest is unchanged, no action required")
+		return true
+	}
+
+	if !p.authorize(pair.Intent, logger) {
+		// prevent future unnecessary loops, we don't need to check again.
+		return true
+	}
+	validated, ok := p.validateIntent(pair, logger)
+	if !validated {
+		return ok
+	}
+
+	logger.NoFields().Infoln("Installing hook pod")
+	err := p.installHookPod(pod, pair.Intent, logger)
+	if err != nil {
+		return false
+	}
+	p.writeReality(pair, logger)
+	return true
+}
+
+// uninstallHookPod removes a hook pod's executor scripts from the hooks
+// directory, then the pod itself
+func (p *Preparer) uninstallHookPod(pair ManifestPair, pod *pods.Pod, logger logging.Logger) bool {
+	err := hooks.RemoveHookScripts(p.hooksExecDir, pair.ID, logger)
+	if err != nil {
+		logger.WithError(err).Errorln("Could not remove hook scripts")
+		return false
+	}
+	err = os.RemoveAll(pod.Home())
+	if err != nil {
+		logger.WithError(err).Errorln("Could not remove hook pod")
+		return false
+	}
+	logger.NoFields().Infoln("Successfully uninstalled hook pod")
+
+	dur, err := p.store.DeletePod(consul.REALITY_TREE, p.node, pair.ID)
+	if err != nil {
+		logger.WithErrorAndFields(err, logrus.Fields{"duration": dur}).
+			Errorln("Could not delete hook pod from reality store")
+	}
+	return true
+}
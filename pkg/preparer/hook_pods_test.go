@@ -0,0 +1,79 @@
+package preparer
+
+import (
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+)
+
+func testHookManifest(t *testing.T) manifest.Manifest {
+	currentUser, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := manifest.NewBuilder()
+	builder.SetID("check_disk")
+	builder.SetRunAsUser(currentUser.Username)
+	builder.SetHook(true)
+	return builder.GetManifest()
+}
+
+func TestIsHookPair(t *testing.T) {
+	hookManifest := testHookManifest(t)
+	if !isHookPair(ManifestPair{ID: hookManifest.ID(), Intent: hookManifest}) {
+		t.Error("expected a pair with a hook intent to be a hook pair")
+	}
+	if !isHookPair(ManifestPair{ID: hookManifest.ID(), Reality: hookManifest}) {
+		t.Error("expected a hook pod that was removed from intent to be a hook pair")
+	}
+	if isHookPair(ManifestPair{ID: "web", Intent: testManifest(t), Reality: hookManifest}) {
+		t.Error("expected a pod whose intent isn't a hook not to be a hook pair")
+	}
+}
+
+func TestResolveHookPair(t *testing.T) {
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	hooksDir, err := ioutil.TempDir("", "hooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(hooksDir)
+	p.hooksExecDir = hooksDir
+
+	hookManifest := testHookManifest(t)
+	pod := p.hookPodFactory.NewHookPod(hookManifest.ID())
+	pair := ManifestPair{ID: hookManifest.ID(), Intent: hookManifest}
+	if !p.resolveHookPair(pair, pod, logging.DefaultLogger) {
+		t.Fatal("expected the hook pod to be installed")
+	}
+	current, err := pod.CurrentManifest()
+	if err != nil {
+		t.Fatalf("expected the hook pod's current manifest to be written: %s", err)
+	}
+	if current.ID() != hookManifest.ID() {
+		t.Errorf("expected the current manifest to be %s, got %s", hookManifest.ID(), current.ID())
+	}
+
+	// a script that an earlier version of the hook pod installed
+	oldScript := filepath.Join(hooksDir, "check_disk__check_disk__launch")
+	if err := ioutil.WriteFile(oldScript, []byte("#!/bin/sh\n"), 0744); err != nil {
+		t.Fatal(err)
+	}
+	pair = ManifestPair{ID: hookManifest.ID(), Reality: hookManifest}
+	if !p.resolveHookPair(pair, pod, logging.DefaultLogger) {
+		t.Fatal("expected the hook pod to be uninstalled")
+	}
+	if _, err := os.Stat(oldScript); !os.IsNotExist(err) {
+		t.Error("expected the hook pod's scripts to be removed")
+	}
+	if _, err := os.Stat(pod.Home()); !os.IsNotExist(err) {
+		t.Error("expected the hook pod's home to be removed")
+	}
+}
@@ -0,0 +1,63 @@
+package preparer
+
+import (
+	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/hooks"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/hookstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
+	"github.com/square/p2/pkg/types"
+)
+
+type HookStatusStore interface {
+	Get(node types.NodeName) (hookstatus.Status, *api.QueryMeta, error)
+	Set(node types.NodeName, status hookstatus.Status) error
+}
+
+var _ hooks.ResultRecorder = &Preparer{}
+
+// RecordHookResults stores the results of the hooks run for a pod, replacing
+// those of the last time the event's hooks were run for it. Pods with a
+// unique key have them in their pod status, while those of legacy pods are
+// recorded per node. Failures are logged but otherwise ignored.
+func (p *Preparer) RecordHookResults(pod hooks.Pod, podID types.PodID, event hooks.HookType, results []podstatus.HookResult) {
+	logger := p.Logger.SubLogger(logrus.Fields{
+		"pod":   podID,
+		"event": event,
+	})
+
+	if podUniqueKey := pod.UniqueKey(); podUniqueKey != "" {
+		p.updatePodStatus(podUniqueKey, "record hook results", func(ps podstatus.PodStatus) (podstatus.PodStatus, error) {
+			ps.HookResults = podstatus.RecordHookResults(ps.HookResults, event.String(), results)
+			return ps, nil
+		}, logger)
+		return
+	}
+
+	if p.hookStatusStore == nil {
+		return
+	}
+
+	// hooks for different pods can finish at once, and their results are
+	// kept in one status per node
+	p.hookStatusLock.Lock()
+	defer p.hookStatusLock.Unlock()
+	status, _, err := p.hookStatusStore.Get(p.node)
+	switch {
+	case statusstore.IsNoStatus(err):
+	case err != nil:
+		logger.WithError(err).Warnln("Could not read hook results")
+		return
+	}
+	if status.Pods == nil {
+		status.Pods = make(map[types.PodID][]podstatus.HookResult)
+	}
+	status.Pods[podID] = podstatus.RecordHookResults(status.Pods[podID], event.String(), results)
+
+	err = p.hookStatusStore.Set(p.node, status)
+	if err != nil {
+		logger.WithError(err).Warnln("Could not write hook results")
+	}
+}
@@ -0,0 +1,53 @@
+package preparer
+
+import (
+	"os"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/hooks"
+	"github.com/square/p2/pkg/store/consul/statusstore/hookstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
+	"github.com/square/p2/pkg/types"
+)
+
+type fakeHookStatusStore struct {
+	statuses map[types.NodeName]hookstatus.Status
+}
+
+func (f *fakeHookStatusStore) Get(node types.NodeName) (hookstatus.Status, *api.QueryMeta, error) {
+	return f.statuses[node], nil, nil
+}
+
+func (f *fakeHookStatusStore) Set(node types.NodeName, status hookstatus.Status) error {
+	f.statuses[node] = status
+	return nil
+}
+
+func TestPreparerRecordsHookResultsOfLegacyPods(t *testing.T) {
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	statuses := &fakeHookStatusStore{statuses: map[types.NodeName]hookstatus.Status{}}
+	p.hookStatusStore = statuses
+
+	pod := &TestPod{}
+	install := []podstatus.HookResult{{Hook: "check_disk", Event: hooks.BeforeInstall.String(), ExitCode: 1, Output: "disk full\n"}}
+	launch := []podstatus.HookResult{{Hook: "notify", Event: hooks.AfterLaunch.String()}}
+	p.RecordHookResults(pod, "web", hooks.BeforeInstall, install)
+	p.RecordHookResults(pod, "web", hooks.AfterLaunch, launch)
+
+	// running the install hooks again replaces only their results
+	install[0].ExitCode = 0
+	install[0].Output = ""
+	p.RecordHookResults(pod, "web", hooks.BeforeInstall, install)
+
+	results := statuses.statuses[p.node].Pods["web"]
+	if len(results) != 2 {
+		t.Fatalf("expected the results of two hooks, got %+v", results)
+	}
+	if results[0].Hook != "notify" || results[1].Hook != "check_disk" || results[1].Failed() {
+		t.Errorf("expected the latest results of each event, got %+v", results)
+	}
+}
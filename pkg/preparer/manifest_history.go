@@ -0,0 +1,21 @@
+package preparer
+
+import (
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/util/param"
+)
+
+// ManifestHistorySize is how many of the manifests deployed for each pod are
+// kept, so that p2-rollback can return to one of them
+var ManifestHistorySize = param.Int("manifest_history_size", 5)
+
+// recordManifestHistory adds a manifest that was just launched to the pod's
+// manifest history. Failures are logged but otherwise ignored, the history is
+// only a convenience for rollbacks.
+func (p *Preparer) recordManifestHistory(man manifest.Manifest, logger logging.Logger) {
+	err := p.store.RecordManifest(p.node, man, *ManifestHistorySize)
+	if err != nil {
+		logger.WithError(err).Warnln("Could not record manifest history")
+	}
+}
@@ -15,6 +15,9 @@ import (
 	"github.com/square/p2/pkg/pods"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/deploystatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/fingerprintstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/intentstatus"
 	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
 	"github.com/square/p2/pkg/store/consul/transaction"
 	"github.com/square/p2/pkg/types"
@@ -26,6 +29,11 @@ import (
 // Used because the preparer special-cases itself in a few places.
 const (
 	minimumBackoffTime = 1 * time.Second
+	maximumBackoffTime = 1 * time.Minute
+
+	// How often every pod is checked against reality even if its intent
+	// hasn't changed
+	intentResyncInterval = 5 * time.Minute
 )
 
 // slice literals are not const
@@ -35,9 +43,12 @@ type Pod interface {
 	hooks.Pod
 	Launch(manifest.Manifest) (bool, error)
 	Install(manifest.Manifest, auth.ArtifactVerifier, artifact.Registry, string) error
+	InstallTimings() artifact.DownloadTimings
 	Uninstall() error
 	Verify(manifest.Manifest, auth.Policy) error
 	Halt(man manifest.Manifest, force bool) (bool, error)
+	Migrate(manifest.Manifest) error
+	Reload(oldManifest manifest.Manifest, newManifest manifest.Manifest) (bool, error)
 	Prune(size.ByteCount, manifest.Manifest)
 }
 
@@ -58,6 +69,14 @@ type Store interface {
 		errorChan chan<- error,
 		podChan chan<- []consul.ManifestResult,
 	)
+	WatchPodChanges(
+		podPrefix consul.PodPrefix,
+		nodeName types.NodeName,
+		quitChan <-chan struct{},
+		errorChan chan<- error,
+		changesChan chan<- consul.PodChanges,
+	)
+	RecordManifest(nodeName types.NodeName, podManifest manifest.Manifest, keep int) error
 }
 
 // Identifies a pod which will be serviced by a goroutine. This struct is used
@@ -79,6 +98,13 @@ func (p podWorkerID) String() string {
 	return fmt.Sprintf("%s-%s", p.podID.String(), p.podUniqueKey)
 }
 
+func workerIDOf(pair ManifestPair) podWorkerID {
+	return podWorkerID{
+		podID:        pair.ID,
+		podUniqueKey: pair.PodUniqueKey,
+	}
+}
+
 func (p *Preparer) WatchForPodManifestsForNode(quitAndAck chan struct{}) {
 	pods.Log = p.Logger
 
@@ -89,19 +115,38 @@ func (p *Preparer) WatchForPodManifestsForNode(quitAndAck chan struct{}) {
 	// buffer this with 1 manifest so that we can make sure that the
 	// consumer is always reading the latest manifest. Before writing to
 	// this channel, we will attempt to drain it first
-	podChan := make(chan []consul.ManifestResult, 1)
+	changesChan := make(chan consul.PodChanges, 1)
 
-	go p.store.WatchPods(consul.INTENT_TREE, p.node, quitChan, errChan, podChan)
+	go p.store.WatchPodChanges(consul.INTENT_TREE, p.node, quitChan, errChan, changesChan)
 
 	podChanMap := make(map[podWorkerID]chan ManifestPair)
 	quitChanMap := make(map[podWorkerID]chan struct{})
 
+	// Reality only needs to be read and the pods handed to their workers
+	// when intent has changed, or now and then in case reality has been
+	// changed behind the preparer's back
+	syncPending := true
+	var lastSync time.Time
+
 	for {
 		select {
 		case err := <-errChan:
+			if degraded, _, _ := p.ConsulLiveness.Degraded(); degraded {
+				// the outage has already been reported
+				p.Logger.WithError(err).Debugln("there was an error reading the manifest")
+				break
+			}
 			p.Logger.WithError(err).
 				Errorln("there was an error reading the manifest")
-		case intentResults := <-podChan:
+		case changes := <-changesChan:
+			if !changes.Empty() {
+				syncPending = true
+			}
+			if !syncPending && time.Since(lastSync) < intentResyncInterval {
+				break
+			}
+
+			intentResults := changes.Current
 			realityResults, _, err := p.store.ListPods(consul.REALITY_TREE, p.node)
 			if err != nil {
 				p.Logger.WithError(err).Errorln("Could not check reality")
@@ -112,17 +157,15 @@ func (p *Preparer) WatchForPodManifestsForNode(quitAndAck chan struct{}) {
 					p.Logger.NoFields().Errorln("Intent results set did not contain p2-preparer pod ID, consul data may be corrupted")
 				} else {
 					pairs := p.ZipResultSets(intentResults, realityResults)
+					p.debug.setPairs(pairs)
 
 					for _, pair := range pairs {
-						workerID := podWorkerID{
-							podID:        pair.ID,
-							podUniqueKey: pair.PodUniqueKey,
-						}
+						workerID := workerIDOf(pair)
 						if _, ok := podChanMap[workerID]; !ok {
 							// spin goroutine for this pod
 							podChanMap[workerID] = make(chan ManifestPair)
 							quitChanMap[workerID] = make(chan struct{})
-							go p.handlePods(podChanMap[workerID], quitChanMap[workerID])
+							go p.handlePods(podChanMap[workerID], p.registerPodWorker(workerID), quitChanMap[workerID])
 						}
 
 						// Attempt to drain the channel first. If a value is in the channel's buffer,
@@ -144,6 +187,8 @@ func (p *Preparer) WatchForPodManifestsForNode(quitAndAck chan struct{}) {
 						podChanMap[workerID] <- pair
 					}
 
+					syncPending = false
+					lastSync = time.Now()
 				}
 			}
 		case <-quitAndAck:
@@ -154,6 +199,7 @@ func (p *Preparer) WatchForPodManifestsForNode(quitAndAck chan struct{}) {
 				}).Infof("p2-preparer quitting, ceasing to watch for updates to %s", podToQuit.String())
 				quitCh <- struct{}{}
 			}
+			p.unregisterPodWorkers()
 			close(quitChan)
 			p.Logger.NoFields().Infoln("Done, acknowledging quit")
 			quitAndAck <- struct{}{} // acknowledge quit
@@ -163,17 +209,28 @@ func (p *Preparer) WatchForPodManifestsForNode(quitAndAck chan struct{}) {
 	}
 }
 
-func (p *Preparer) tryRunHooks(hookType hooks.HookType, pod hooks.Pod, manifest manifest.Manifest, logger logging.Logger) {
+// tryRunHooks runs the hooks of a type for a pod. Failures are only logged,
+// unless a failed hook's policy aborts the install of the pod, in which case
+// false is returned.
+func (p *Preparer) tryRunHooks(hookType hooks.HookType, pod hooks.Pod, manifest manifest.Manifest, logger logging.Logger) bool {
 	err := p.hooks.RunHookType(hookType, pod, manifest)
+	if hooks.IsHookAborted(err) {
+		logger.WithErrorAndFields(err, logrus.Fields{
+			"hooks": hookType}).Errorln("A hook aborted the install, will retry")
+		return false
+	}
 	if err != nil {
 		logger.WithErrorAndFields(err, logrus.Fields{
 			"hooks": hookType}).Warnln("Could not run hooks")
 	}
+	return true
 }
 
 // no return value, no output channels. This should do everything it needs to do
-// without outside intervention (other than being signalled to quit)
-func (p *Preparer) handlePods(podChan <-chan ManifestPair, quit <-chan struct{}) {
+// without outside intervention (other than being signalled to quit). Restarts
+// of the pod by the supervisor are received on restarts, so that they never
+// happen while the pod is being updated.
+func (p *Preparer) handlePods(podChan <-chan ManifestPair, restarts <-chan restartRequest, quit <-chan struct{}) {
 	// install new launchables
 	var nextLaunch ManifestPair
 
@@ -209,6 +266,13 @@ func (p *Preparer) handlePods(podChan <-chan ManifestPair, quit <-chan struct{})
 			manifestLogger.NoFields().Debugln("New manifest received")
 
 			working = true
+			p.debug.received(workerIDOf(nextLaunch), nextLaunch)
+		case req := <-restarts:
+			if working {
+				req.result <- restartSkippedError{podID: req.podID, reason: "an update of it is in progress"}
+				break
+			}
+			req.result <- p.restartInstalledPod(req.podID, req.logger)
 		case <-time.After(backoffTime):
 			if working {
 				var pod *pods.Pod
@@ -223,22 +287,7 @@ func (p *Preparer) handlePods(podChan <-chan ManifestPair, quit <-chan struct{})
 					}
 				}
 
-				// TODO better solution: force the preparer to have a 0s default timeout, prevent KILLs
-				if pod.Id == constants.PreparerPodID {
-					pod.DefaultTimeout = time.Duration(0)
-				}
-
-				effectiveLogBridgeExec := p.logExec
-				// pods that are in the blacklist for this preparer shall not use the
-				// preparer's log exec. Instead, they will use the default svlogd logexec.
-				for _, podID := range p.logBridgeBlacklist {
-					if pod.Id.String() == podID {
-						effectiveLogBridgeExec = svlogdExec
-						break
-					}
-				}
-				pod.SetLogBridgeExec(effectiveLogBridgeExec)
-				pod.SetFinishExec(p.finishExec)
+				p.configurePod(pod)
 
 				// podChan is being fed values gathered from a consul.Watch() in
 				// WatchForPodManifestsForNode(). If the watch returns a new pair of
@@ -294,25 +343,58 @@ func (p *Preparer) handlePods(podChan <-chan ManifestPair, quit <-chan struct{})
 					}
 				}
 
-				ok := p.resolvePair(nextLaunch, pod, manifestLogger)
+				var ok bool
+				if isHookPair(nextLaunch) {
+					ok = p.resolveHookPair(nextLaunch, p.hookPodFactory.NewHookPod(nextLaunch.ID), manifestLogger)
+				} else {
+					ok = p.resolvePair(nextLaunch, pod, manifestLogger)
+				}
 				if ok {
+					p.debug.done(workerIDOf(nextLaunch))
 					nextLaunch = ManifestPair{}
 					working = false
 
 					// Reset the backoff time
 					backoffTime = minimumBackoffTime
+				} else if degraded, _, _ := p.ConsulLiveness.Degraded(); degraded {
+					// Most of the work needs Consul, so don't retry any more
+					// often than necessary until it's back
+					backoffTime = maximumBackoffTime
 				} else {
 					// Double the backoff time with a maximum of 1 minute
 					backoffTime = backoffTime * 2
-					if backoffTime > 1*time.Minute {
-						backoffTime = 1 * time.Minute
+					if backoffTime > maximumBackoffTime {
+						backoffTime = maximumBackoffTime
 					}
 				}
+				if !ok {
+					p.debug.failed(workerIDOf(nextLaunch), backoffTime)
+				}
 			}
 		}
 	}
 }
 
+// configurePod sets up how pod's services are run by this preparer
+func (p *Preparer) configurePod(pod *pods.Pod) {
+	// TODO better solution: force the preparer to have a 0s default timeout, prevent KILLs
+	if pod.Id == constants.PreparerPodID {
+		pod.DefaultTimeout = time.Duration(0)
+	}
+
+	effectiveLogBridgeExec := p.logExec
+	// pods that are in the blacklist for this preparer shall not use the
+	// preparer's log exec. Instead, they will use the default svlogd logexec.
+	for _, podID := range p.logBridgeBlacklist {
+		if pod.Id.String() == podID {
+			effectiveLogBridgeExec = svlogdExec
+			break
+		}
+	}
+	pod.SetLogBridgeExec(effectiveLogBridgeExec)
+	pod.SetFinishExec(p.finishExec)
+}
+
 // check if a manifest satisfies the authorization requirement of this preparer
 func (p *Preparer) authorize(manifest manifest.Manifest, logger logging.Logger) bool {
 	err := p.authPolicy.AuthorizeApp(manifest, logger)
@@ -336,6 +418,9 @@ func (p *Preparer) resolvePair(pair ManifestPair, pod Pod, logger logging.Logger
 	if pair.Intent != nil {
 		newSHA, _ = pair.Intent.SHA()
 	}
+	if newSHA != "" && newSHA != oldSHA {
+		p.acknowledgeIntent(pair.ID, newSHA, logger)
+	}
 
 	if oldSHA == "" && newSHA != "" {
 		logger.NoFields().Infoln("manifest is new, will update")
@@ -350,6 +435,10 @@ func (p *Preparer) resolvePair(pair ManifestPair, pod Pod, logger logging.Logger
 			// prevent future unnecessary loops, we don't need to check again.
 			return true
 		}
+		validated, ok := p.validateIntent(pair, logger)
+		if !validated {
+			return ok
+		}
 		return p.installAndLaunchPod(pair, pod, logger)
 	}
 
@@ -375,11 +464,144 @@ func (p *Preparer) resolvePair(pair ManifestPair, pod Pod, logger logging.Logger
 		return true
 	}
 
+	validated, ok := p.validateIntent(pair, logger)
+	if !validated {
+		return ok
+	}
+
+	if canReload(pair, logger) {
+		logger.WithField("old_sha", oldSHA).Infoln("only the config has changed, will reload")
+		return p.reloadPod(pair, pod, logger)
+	}
+
 	logger.WithField("old_sha", oldSHA).Infoln("manifest SHA has changed, will update")
 	return p.installAndLaunchPod(pair, pod, logger)
 
 }
 
+// validateIntent asks the configured intent validator, if any, whether the
+// intent manifest in pair may be enacted. The first return value is whether
+// the caller should proceed. If it shouldn't, the second return value should be
+// returned from resolvePair(): true if the change was rejected (so that it
+// isn't retried), false if the validator couldn't be consulted.
+func (p *Preparer) validateIntent(pair ManifestPair, logger logging.Logger) (bool, bool) {
+	// The preparer must always be able to update itself, otherwise a
+	// broken validator could never be fixed by deploying a new preparer
+	if p.intentValidator == nil || pair.ID == constants.PreparerPodID {
+		return true, true
+	}
+
+	err := p.intentValidator.Validate(p.node, pair)
+	switch {
+	case err == nil:
+		return true, true
+	case IsIntentRejected(err):
+		logger.WithError(err).Errorln("Intent validator rejected the manifest, it will not be enacted")
+		p.recordIntentRejection(pair, err.(IntentRejectedError).Reason, logger)
+		return false, true
+	default:
+		logger.WithError(err).Errorln("Could not validate intent manifest, will retry")
+		return false, false
+	}
+}
+
+// recordIntentRejection writes the rejection reason to the pod's status so that
+// whoever scheduled it can find out why it wasn't enacted. Legacy pods don't
+// have a pod status, so theirs are recorded per node.
+func (p *Preparer) recordIntentRejection(pair ManifestPair, reason string, logger logging.Logger) {
+	sha, _ := pair.Intent.SHA()
+	rejection := podstatus.IntentRejection{
+		SHA:    sha,
+		Reason: reason,
+		Time:   time.Now(),
+	}
+
+	if pair.PodUniqueKey != "" {
+		p.updatePodStatus(pair.PodUniqueKey, "record intent rejection", func(ps podstatus.PodStatus) (podstatus.PodStatus, error) {
+			ps.IntentRejection = &rejection
+			return ps, nil
+		}, logger)
+		return
+	}
+
+	p.updateIntentStatus(logger, func(status intentstatus.Status) (intentstatus.Status, bool) {
+		if status.Pods == nil {
+			status.Pods = make(map[types.PodID]podstatus.IntentRejection)
+		}
+		status.Pods[pair.ID] = rejection
+		return status, true
+	})
+}
+
+// clearIntentRejection removes the recorded rejection of a legacy pod once a
+// manifest for it has been launched
+func (p *Preparer) clearIntentRejection(podID types.PodID, logger logging.Logger) {
+	p.updateIntentStatus(logger, func(status intentstatus.Status) (intentstatus.Status, bool) {
+		if _, ok := status.Pods[podID]; !ok {
+			return status, false
+		}
+		delete(status.Pods, podID)
+		return status, true
+	})
+}
+
+// updateIntentStatus applies mutator to the intent rejections of the node's
+// legacy pods, and writes them back if it returns true. Failures are only
+// logged.
+func (p *Preparer) updateIntentStatus(logger logging.Logger, mutator func(intentstatus.Status) (intentstatus.Status, bool)) {
+	if p.intentStatusStore == nil {
+		return
+	}
+
+	// the rejections of every legacy pod on the node are written as one
+	// status
+	p.intentStatusLock.Lock()
+	defer p.intentStatusLock.Unlock()
+	status, _, err := p.intentStatusStore.Get(p.node)
+	switch {
+	case statusstore.IsNoStatus(err):
+	case err != nil:
+		logger.WithError(err).Warnln("Could not read intent rejections")
+		return
+	}
+
+	status, changed := mutator(status)
+	if !changed {
+		return
+	}
+	err = p.intentStatusStore.Set(p.node, status)
+	if err != nil {
+		logger.WithError(err).Warnln("Could not write intent rejections")
+	}
+}
+
+// updatePodStatus applies mutator to the status of a uuid pod. Failures are
+// only logged, so this is meant for informational fields of the status.
+func (p *Preparer) updatePodStatus(
+	podUniqueKey types.PodUniqueKey,
+	description string,
+	mutator func(podstatus.PodStatus) (podstatus.PodStatus, error),
+	logger logging.Logger,
+) {
+	ctx, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
+	err := p.podStatusStore.MutateStatus(ctx, podUniqueKey, mutator)
+	if err != nil {
+		logger.WithError(err).Errorf("Could not add '%s in pod status' to transaction", description)
+		return
+	}
+
+	ok, resp, err := transaction.Commit(ctx, p.client.KV())
+	if err != nil {
+		logger.WithError(err).Errorf("Could not %s in pod status", description)
+		return
+	}
+	if !ok {
+		logger.WithError(util.Errorf("transaction rolled back: %s", transaction.TxnErrorsToString(resp.Errors))).
+			Errorf("Could not %s in pod status", description)
+	}
+}
+
 // artifactRegistryFor allows for overriding the artifact registry for
 // installation (or otherwise) on a per manifest basis
 func (p *Preparer) artifactRegistryFor(manifest manifest.Manifest) artifact.Registry {
@@ -396,18 +618,32 @@ func (p *Preparer) artifactRegistryFor(manifest manifest.Manifest) artifact.Regi
 }
 
 func (p *Preparer) installAndLaunchPod(pair ManifestPair, pod Pod, logger logging.Logger) bool {
-	p.tryRunHooks(hooks.BeforeInstall, pod, pair.Intent, logger)
+	if !p.checkPrerequisites(pair, logger) {
+		return false
+	}
+
+	if !p.tryRunHooks(hooks.BeforeInstall, pod, pair.Intent, logger) {
+		return false
+	}
 
 	logger.NoFields().Infoln("Installing pod and launchables")
 
 	registry := p.artifactRegistryFor(pair.Intent)
+	installStart := time.Now()
 	err := pod.Install(pair.Intent, p.artifactVerifier, registry, p.containerRegistryAuthStr)
 	if err != nil {
 		// install failed, abort and retry
 		logger.WithError(err).Errorln("Install failed")
 		return false
 	}
+	installTimings := pod.InstallTimings()
+	timings := deploystatus.Deploy{
+		Fetch:   installTimings.Fetch,
+		Verify:  installTimings.Verify,
+		Install: time.Since(installStart) - installTimings.Fetch - installTimings.Verify,
+	}
 
+	verifyStart := time.Now()
 	err = pod.Verify(pair.Intent, p.authPolicy)
 	if err != nil {
 		logger.WithError(err).
@@ -415,9 +651,27 @@ func (p *Preparer) installAndLaunchPod(pair ManifestPair, pod Pod, logger loggin
 		p.tryRunHooks(hooks.AfterAuthFail, pod, pair.Intent, logger)
 		return false
 	}
+	timings.Verify += time.Since(verifyStart)
 
-	p.tryRunHooks(hooks.AfterInstall, pod, pair.Intent, logger)
+	if !p.tryRunHooks(hooks.AfterInstall, pod, pair.Intent, logger) {
+		return false
+	}
+
+	// The preparer must always be able to update itself, otherwise a
+	// stuck update slot could never be fixed by deploying a new preparer
+	if p.updateSlots != nil && pair.ID != constants.PreparerPodID {
+		release, err := p.updateSlots.acquire(pair.ID)
+		if err == errNoUpdateSlot {
+			logger.NoFields().Infoln("Too many pods are being updated on this node, will retry")
+			return false
+		} else if err != nil {
+			logger.WithError(err).Errorln("Could not acquire node update slot")
+			return false
+		}
+		defer release()
+	}
 
+	restartStart := time.Now()
 	if pair.Reality != nil {
 		// installAndLaunchPod implies that something was in intent, so let
 		// launchables decide whether they want to be halted
@@ -433,7 +687,31 @@ func (p *Preparer) installAndLaunchPod(pair ManifestPair, pod Pod, logger loggin
 		}
 	}
 
-	p.tryRunHooks(hooks.BeforeLaunch, pod, pair.Intent, logger)
+	if pair.Intent.GetUpgradeStrategy() == manifest.FreshInstallUpgrade {
+		logger.NoFields().Infoln("Running migrations for a fresh install")
+		err = pod.Migrate(pair.Intent)
+		if err != nil {
+			logger.WithError(err).Errorln("Migration failed, relaunching the previous version")
+			if pair.Reality != nil {
+				_, err = pod.Launch(pair.Reality)
+				if err != nil {
+					logger.WithError(err).Errorln("Could not relaunch the previous version")
+				}
+			}
+			return false
+		}
+	}
+
+	if !p.tryRunHooks(hooks.BeforeLaunch, pod, pair.Intent, logger) {
+		// the previous version was halted already
+		if pair.Reality != nil {
+			_, err = pod.Launch(pair.Reality)
+			if err != nil {
+				logger.WithError(err).Errorln("Could not relaunch the previous version")
+			}
+		}
+		return false
+	}
 
 	logger.NoFields().Infoln("Setting up new runit services and running the enable hook")
 
@@ -443,23 +721,12 @@ func (p *Preparer) installAndLaunchPod(pair ManifestPair, pod Pod, logger loggin
 			Errorln("Launch failed")
 	} else {
 		if pair.PodUniqueKey == "" {
-			// legacy pod, write the manifest back to reality tree
-			duration, err := p.store.SetPod(consul.REALITY_TREE, p.node, pair.Intent)
-			if err != nil {
-				logger.WithErrorAndFields(err, logrus.Fields{
-					"duration": duration}).
-					Errorln("Could not set pod in reality store")
-			}
-		} else {
-			backoff := 100 * time.Millisecond
-			for err := p.writeStatusRecord(pair, logger); err != nil; err = p.writeStatusRecord(pair, logger) {
-				time.Sleep(backoff)
-				backoff = 2 * backoff
-				if backoff > time.Minute {
-					backoff = time.Minute
-				}
-			}
+			// the timings are recorded before reality so that they are
+			// there for whoever is waiting on reality
+			timings.Restart = time.Since(restartStart)
+			p.recordDeployTimings(pair, timings, logger)
 		}
+		p.writeReality(pair, logger)
 
 		p.tryRunHooks(hooks.AfterLaunch, pod, pair.Intent, logger)
 
@@ -468,6 +735,37 @@ func (p *Preparer) installAndLaunchPod(pair ManifestPair, pod Pod, logger loggin
 	return err == nil && ok
 }
 
+// writeReality records that the intent manifest in pair is now running, in the
+// reality tree for legacy pods and in the pod status tree for uuid pods
+func (p *Preparer) writeReality(pair ManifestPair, logger logging.Logger) {
+	if pair.PodUniqueKey == "" {
+		// legacy pod, write the manifest back to reality tree
+		duration, err := p.store.SetPod(consul.REALITY_TREE, p.node, pair.Intent)
+		if err != nil {
+			logger.WithErrorAndFields(err, logrus.Fields{
+				"duration": duration}).
+				Errorln("Could not set pod in reality store")
+		} else {
+			p.clearIntentRejection(pair.ID, logger)
+			p.clearPrerequisiteFailure(pair.ID, logger)
+			if p.fingerprinter != nil {
+				p.recordFingerprint(pair, p.fingerprinter.Fingerprint(), logger)
+			}
+		}
+		p.recordManifestHistory(pair.Intent, logger)
+		return
+	}
+
+	backoff := 100 * time.Millisecond
+	for err := p.writeStatusRecord(pair, logger); err != nil; err = p.writeStatusRecord(pair, logger) {
+		time.Sleep(backoff)
+		backoff = 2 * backoff
+		if backoff > time.Minute {
+			backoff = time.Minute
+		}
+	}
+}
+
 func (p *Preparer) writeStatusRecord(pair ManifestPair, logger logging.Logger) error {
 	ctx, cancelFunc := transaction.New(context.Background())
 	defer cancelFunc()
@@ -478,6 +776,12 @@ func (p *Preparer) writeStatusRecord(pair ManifestPair, logger logging.Logger) e
 		return err
 	}
 
+	var fingerprint *fingerprintstatus.Fingerprint
+	if p.fingerprinter != nil {
+		f := p.fingerprinter.Fingerprint()
+		fingerprint = &f
+	}
+
 	// uuid pod, write the manifest to the pod status tree.
 	mutator := func(ps podstatus.PodStatus) (podstatus.PodStatus, error) {
 		manifestBytes, err := pair.Intent.Marshal()
@@ -487,6 +791,9 @@ func (p *Preparer) writeStatusRecord(pair ManifestPair, logger logging.Logger) e
 
 		ps.PodStatus = podstatus.PodLaunched
 		ps.Manifest = string(manifestBytes)
+		ps.IntentRejection = nil
+		ps.PrerequisiteFailure = nil
+		ps.Fingerprint = fingerprint
 		return ps, nil
 	}
 	err = p.podStatusStore.MutateStatus(ctx, pair.PodUniqueKey, mutator)
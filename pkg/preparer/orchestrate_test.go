@@ -26,10 +26,10 @@ import (
 )
 
 type TestPod struct {
-	currentManifest                                                                   manifest.Manifest
-	installed, uninstalled, launched, launchSuccess, halted, haltSuccess, forceHalted bool
-	installErr, uninstallErr, launchErr, haltError, currentManifestError              error
-	configDir, envDir                                                                 string
+	currentManifest                                                                                       manifest.Manifest
+	installed, uninstalled, launched, launchSuccess, halted, haltSuccess, forceHalted, migrated, reloaded bool
+	installErr, uninstallErr, launchErr, haltError, migrateErr, currentManifestError                      error
+	configDir, envDir                                                                                     string
 }
 
 func (t *TestPod) Prune(_ size.ByteCount, _ manifest.Manifest) {
@@ -54,6 +54,10 @@ func (t *TestPod) Install(manifest manifest.Manifest, _ auth.ArtifactVerifier, _
 	return t.installErr
 }
 
+func (t *TestPod) InstallTimings() artifact.DownloadTimings {
+	return artifact.DownloadTimings{Fetch: time.Second}
+}
+
 func (t *TestPod) Uninstall() error {
 	t.uninstalled = true
 	return t.uninstallErr
@@ -69,6 +73,17 @@ func (t *TestPod) Halt(manifest manifest.Manifest, forceHalt bool) (bool, error)
 	return t.haltSuccess, t.haltError
 }
 
+func (t *TestPod) Migrate(manifest manifest.Manifest) error {
+	t.migrated = true
+	return t.migrateErr
+}
+
+func (t *TestPod) Reload(oldManifest manifest.Manifest, newManifest manifest.Manifest) (bool, error) {
+	t.currentManifest = newManifest
+	t.reloaded = true
+	return true, nil
+}
+
 func (t *TestPod) ConfigDir() string {
 	if t.configDir != "" {
 		return t.configDir
@@ -203,6 +218,13 @@ func (f *FakeStore) DeletePod(consul.PodPrefix, types.NodeName, types.PodID) (ti
 func (f *FakeStore) WatchPods(consul.PodPrefix, types.NodeName, <-chan struct{}, chan<- error, chan<- []consul.ManifestResult) {
 }
 
+func (f *FakeStore) WatchPodChanges(consul.PodPrefix, types.NodeName, <-chan struct{}, chan<- error, chan<- consul.PodChanges) {
+}
+
+func (f *FakeStore) RecordManifest(types.NodeName, manifest.Manifest, int) error {
+	return nil
+}
+
 func testPreparer(t *testing.T, f *FakeStore) (*Preparer, *fakeHooks, string) {
 	podRoot, _ := ioutil.TempDir("", "pod_root")
 	cfg := &PreparerConfig{
@@ -275,6 +297,177 @@ func TestPreparerLaunchesPodsThatHaveDifferentSHAs(t *testing.T) {
 	Assert(t).AreEqual(newManifest, testPod.currentManifest, "the current manifest should now be the new manifest")
 }
 
+func TestPreparerRetriesInstallsAbortedByHooks(t *testing.T) {
+	testPod := &TestPod{launchSuccess: true}
+	newManifest := testManifest(t)
+	newPair := ManifestPair{
+		ID:     newManifest.ID(),
+		Intent: newManifest,
+	}
+
+	p, testHooks, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+
+	testHooks.beforeInstallErr = hooks.ErrHookAborted{Hook: "check_disk", Event: hooks.BeforeInstall}
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsFalse(success, "should have failed so that the install is retried")
+	Assert(t).IsFalse(testPod.installed, "should not have installed")
+
+	// other hook errors don't stop the install
+	testHooks.beforeInstallErr = fmt.Errorf("could not read hooks directory")
+	success = p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsTrue(success, "should have succeeded")
+	Assert(t).IsTrue(testPod.launched, "should have launched")
+}
+
+func TestPreparerRelaunchesWhenBeforeLaunchHooksAbort(t *testing.T) {
+	builder := manifest.NewBuilder()
+	builder.SetID("hello")
+	existing := builder.GetManifest()
+
+	testPod := &TestPod{
+		launchSuccess:   true,
+		haltSuccess:     true,
+		currentManifest: existing,
+	}
+	newManifest := testManifest(t)
+	newPair := ManifestPair{
+		ID:      newManifest.ID(),
+		Reality: existing,
+		Intent:  newManifest,
+	}
+
+	p, testHooks, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+
+	testHooks.beforeLaunchErr = hooks.ErrHookAborted{Hook: "drain", Event: hooks.BeforeLaunch}
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsFalse(success, "should have failed so that the install is retried")
+	Assert(t).IsTrue(testPod.halted, "should have halted the previous version")
+	Assert(t).AreEqual(existing, testPod.currentManifest, "the previous version should have been relaunched")
+}
+
+func TestPreparerMigratesFreshInstalls(t *testing.T) {
+	builder := manifest.NewBuilder()
+	builder.SetID("hello")
+	existing := builder.GetManifest()
+
+	testPod := &TestPod{
+		launchSuccess:   true,
+		haltSuccess:     true,
+		currentManifest: existing,
+	}
+	builder = testManifest(t).GetBuilder()
+	builder.SetUpgradeStrategy(manifest.FreshInstallUpgrade)
+	newManifest := builder.GetManifest()
+	newPair := ManifestPair{
+		ID:      newManifest.ID(),
+		Reality: existing,
+		Intent:  newManifest,
+	}
+
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+
+	testPod.migrateErr = fmt.Errorf("migration failed")
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsFalse(success, "should have failed so that the migration is retried")
+	Assert(t).IsTrue(testPod.halted, "should have halted the previous version before migrating")
+	Assert(t).IsTrue(testPod.migrated, "should have migrated")
+	Assert(t).AreEqual(existing, testPod.currentManifest, "the previous version should have been relaunched")
+
+	testPod.migrateErr = nil
+	success = p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsTrue(success, "should have succeeded")
+	Assert(t).AreEqual(newManifest, testPod.currentManifest, "the current manifest should now be the new manifest")
+}
+
+func TestPreparerDoesNotMigrateInPlaceUpgrades(t *testing.T) {
+	testPod := &TestPod{launchSuccess: true}
+	newManifest := testManifest(t)
+	newPair := ManifestPair{
+		ID:     newManifest.ID(),
+		Intent: newManifest,
+	}
+
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsTrue(success, "should have succeeded")
+	Assert(t).IsFalse(testPod.migrated, "should not have migrated an in place upgrade")
+}
+
+func TestPreparerReloadsPodsWhenOnlyConfigChanged(t *testing.T) {
+	builder := testManifest(t).GetBuilder()
+	builder.SetReloadableConfig(true)
+	existing := builder.GetManifest()
+
+	testPod := &TestPod{
+		launchSuccess:   true,
+		haltSuccess:     true,
+		currentManifest: existing,
+	}
+	builder = existing.GetBuilder()
+	err := builder.SetConfig(map[interface{}]interface{}{"level": "debug"})
+	Assert(t).IsNil(err, "should have set config")
+	newManifest := builder.GetManifest()
+	newPair := ManifestPair{
+		ID:      newManifest.ID(),
+		Reality: existing,
+		Intent:  newManifest,
+	}
+
+	store := &FakeStore{}
+	p, _, fakePodRoot := testPreparer(t, store)
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+
+	Assert(t).IsTrue(success, "should have succeeded")
+	Assert(t).IsTrue(testPod.reloaded, "should have reloaded")
+	Assert(t).IsFalse(testPod.installed, "should not have installed")
+	Assert(t).IsFalse(testPod.halted, "should not have halted")
+	Assert(t).IsFalse(testPod.launched, "should not have launched")
+	Assert(t).AreEqual(newManifest, testPod.currentManifest, "the current manifest should now be the new manifest")
+}
+
+func TestPreparerRestartsReloadablePodsWhenMoreThanConfigChanged(t *testing.T) {
+	builder := testManifest(t).GetBuilder()
+	builder.SetReloadableConfig(true)
+	existing := builder.GetManifest()
+
+	testPod := &TestPod{
+		launchSuccess:   true,
+		haltSuccess:     true,
+		currentManifest: existing,
+	}
+	builder = existing.GetBuilder()
+	err := builder.SetConfig(map[interface{}]interface{}{"level": "debug"})
+	Assert(t).IsNil(err, "should have set config")
+	builder.SetStatusPort(9999)
+	newManifest := builder.GetManifest()
+	newPair := ManifestPair{
+		ID:      newManifest.ID(),
+		Reality: existing,
+		Intent:  newManifest,
+	}
+
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+
+	Assert(t).IsTrue(success, "should have succeeded")
+	Assert(t).IsFalse(testPod.reloaded, "should not have reloaded")
+	Assert(t).IsTrue(testPod.halted, "should have halted")
+	Assert(t).IsTrue(testPod.launched, "should have launched")
+}
+
 func TestPreparerFailsIfInstallFails(t *testing.T) {
 	testPod := &TestPod{
 		installErr: fmt.Errorf("There was an error installing"),
@@ -2,7 +2,9 @@ package podprocess
 
 import (
 	"os"
+	"syscall"
 
+	"github.com/square/p2/pkg/cgroups"
 	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/pods"
@@ -15,6 +17,10 @@ import (
 type EnvironmentExtractor struct {
 	DatabasePath string
 	Logger       logging.Logger
+
+	// Finds the memory cgroup mount to read OOM kill counts from.
+	// Optionally nil, overridden in tests
+	subsystemer cgroups.Subsystemer
 }
 
 type RetryableError struct {
@@ -47,6 +53,8 @@ func (e EnvironmentExtractor) WriteFinish(exitCode int, exitStatus int) error {
 		return err
 	}
 
+	e.recordOOMKills(&finish, finishService, logger)
+
 	err = finishService.Insert(finish)
 	if err != nil {
 		return RetryableError{
@@ -83,5 +91,44 @@ func (e EnvironmentExtractor) constructFinishFromEnvironment(exitCode int, exitS
 		PodUniqueKey: types.PodUniqueKey(podUniqueKey),
 		ExitCode:     exitCode,
 		ExitStatus:   exitStatus,
+		OOMKills:     -1,
 	}, nil
 }
+
+// recordOOMKills reads how many processes of the launchable's memory cgroup
+// have been killed by the OOM killer. The kernel OOM killer sends SIGKILL, so a
+// process that was killed by SIGKILL while that count went up since the
+// launchable's last finish is considered to have been OOM killed. Failures are
+// only logged, since the exit itself must still be recorded.
+func (e EnvironmentExtractor) recordOOMKills(finish *FinishOutput, finishService FinishService, logger logging.Logger) {
+	cgroupName := os.Getenv(pods.CgroupNameEnvVar)
+	if cgroupName == "" {
+		return
+	}
+
+	subsystemer := e.subsystemer
+	if subsystemer == nil {
+		subsystemer = cgroups.DefaultSubsystemer
+	}
+	subsystems, err := subsystemer.Find()
+	if err != nil {
+		logger.WithError(err).Warnln("Could not find cgroup subsystems, OOM kills will not be detected")
+		return
+	}
+	oomKills, err := subsystems.OOMKillCount(cgroups.CgroupID(cgroupName))
+	if err != nil {
+		logger.WithError(err).Warnln("Could not read OOM kill count, OOM kills will not be detected")
+		return
+	}
+	finish.OOMKills = oomKills
+
+	if finish.ExitCode != -1 || finish.ExitStatus != int(syscall.SIGKILL) {
+		return
+	}
+	lastOOMKills, err := finishService.LastOOMKills(finish.PodID, finish.PodUniqueKey, finish.LaunchableID)
+	if err != nil {
+		logger.WithError(err).Warnln("Could not read previous OOM kill count, OOM kills will not be detected")
+		return
+	}
+	finish.OOMKilled = oomKills > 0 && oomKills > lastOOMKills
+}
@@ -0,0 +1,76 @@
+package podprocess
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/square/p2/pkg/cgroups"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/pods"
+)
+
+type fakeSubsystemer struct {
+	memory string
+}
+
+func (f fakeSubsystemer) Find() (cgroups.Subsystems, error) {
+	return cgroups.Subsystems{Memory: f.memory}, nil
+}
+
+func writeOOMKills(t *testing.T, cgroupDir string, oomKills string) {
+	err := ioutil.WriteFile(filepath.Join(cgroupDir, "memory.oom_control"), []byte("oom_kill_disable 0\nunder_oom 0\noom_kill "+oomKills+"\n"), 0644)
+	if err != nil {
+		t.Fatalf("Could not write oom_control: %s", err)
+	}
+}
+
+func TestRecordOOMKills(t *testing.T) {
+	finishService, _, closeFunc := initFinishService(t)
+	defer closeFunc()
+	defer finishService.Close()
+
+	memory, err := ioutil.TempDir("", "env_extractor_test")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %s", err)
+	}
+	defer os.RemoveAll(memory)
+	cgroupDir := filepath.Join(memory, "some_pod__some_launchable")
+	if err = os.MkdirAll(cgroupDir, 0755); err != nil {
+		t.Fatalf("Could not create fake cgroup: %s", err)
+	}
+
+	os.Setenv(pods.CgroupNameEnvVar, "some_pod__some_launchable")
+	defer os.Unsetenv(pods.CgroupNameEnvVar)
+	extractor := EnvironmentExtractor{
+		Logger:      logging.TestLogger(),
+		subsystemer: fakeSubsystemer{memory: memory},
+	}
+
+	// a SIGKILL after the count went up is an OOM kill
+	writeOOMKills(t, cgroupDir, "1")
+	killed := FinishOutput{PodID: "some_pod", LaunchableID: "some_launchable", EntryPoint: "launch", ExitCode: -1, ExitStatus: 9}
+	extractor.recordOOMKills(&killed, finishService, extractor.Logger)
+	if !killed.OOMKilled || killed.OOMKills != 1 {
+		t.Errorf("Expected the process to be recorded as OOM killed, got %+v", killed)
+	}
+	if err = finishService.Insert(killed); err != nil {
+		t.Fatal(err)
+	}
+
+	// a later SIGKILL without new OOM kills is not
+	killed = FinishOutput{PodID: "some_pod", LaunchableID: "some_launchable", EntryPoint: "launch", ExitCode: -1, ExitStatus: 9}
+	extractor.recordOOMKills(&killed, finishService, extractor.Logger)
+	if killed.OOMKilled {
+		t.Errorf("Expected a SIGKILL without new OOM kills not to be recorded as an OOM kill, got %+v", killed)
+	}
+
+	// nor is a regular failure
+	writeOOMKills(t, cgroupDir, "2")
+	failed := FinishOutput{PodID: "some_pod", LaunchableID: "some_launchable", EntryPoint: "launch", ExitCode: 1}
+	extractor.recordOOMKills(&failed, finishService, extractor.Logger)
+	if failed.OOMKilled || failed.OOMKills != 2 {
+		t.Errorf("Expected a non-zero exit not to be recorded as an OOM kill, got %+v", failed)
+	}
+}
@@ -29,6 +29,9 @@ type FinishService interface {
 	// useful for repairing the workspace file which is meant to contain
 	// the last processed ID.
 	LastFinishID() (int64, error)
+	// Gets the OOM kill count recorded by the last finish of any of a
+	// launchable's processes, or -1 if none was recorded
+	LastOOMKills(podID types.PodID, podUniqueKey types.PodUniqueKey, launchableID launch.LaunchableID) (int, error)
 }
 
 type sqliteFinishService struct {
@@ -60,6 +63,15 @@ type FinishOutput struct {
 	ExitCode   int `json:"exit_code"`
 	ExitStatus int `json:"exit_status"`
 
+	// The number of processes in the launchable's memory cgroup that had
+	// been killed by the OOM killer when the process exited, or -1 if it
+	// could not be determined
+	OOMKills int `json:"oom_kills"`
+
+	// Set if the process was killed because the OOM kill count of its
+	// cgroup went up since the launchable's previous finish
+	OOMKilled bool `json:"oom_killed"`
+
 	// This is never written explicitly and is determined automatically by
 	// sqlite (via AUTOINCREMENT)
 	ID int64
@@ -76,8 +88,10 @@ func (s sqliteFinishService) Insert(finish FinishOutput) error {
 		    launchable_id,
 		    entry_point,
 		    exit_code,
-		    exit_status
-		  ) VALUES(?, ?, ?, ?, ?, ?)`
+		    exit_status,
+		    oom_kills,
+		    oom_killed
+		  ) VALUES(?, ?, ?, ?, ?, ?, ?, ?)`
 	_, err := s.db.Exec(stmt,
 		finish.PodID.String(),
 		finish.PodUniqueKey.String(),
@@ -85,6 +99,8 @@ func (s sqliteFinishService) Insert(finish FinishOutput) error {
 		finish.EntryPoint,
 		finish.ExitCode,
 		finish.ExitStatus,
+		finish.OOMKills,
+		finish.OOMKilled,
 	)
 	if err != nil {
 		return util.Errorf("Couldn't insert finish line into sqlite database: %s", err)
@@ -120,6 +136,8 @@ var (
 	    exit_status integer
 	);`,
 		"create index finish_date on finishes(date);",
+		"alter table finishes add column oom_kills integer not null default -1;",
+		"alter table finishes add column oom_killed boolean not null default 0;",
 		// FUTURE MIGRATIONS GO HERE
 	}
 )
@@ -195,7 +213,7 @@ func (s sqliteFinishService) Close() error {
 
 func (f sqliteFinishService) GetLatestFinishes(lastID int64) ([]FinishOutput, error) {
 	rows, err := f.db.Query(`
-	    SELECT id, date, pod_id, pod_unique_key, launchable_id, entry_point, exit_code, exit_status
+	    SELECT id, date, pod_id, pod_unique_key, launchable_id, entry_point, exit_code, exit_status, oom_kills, oom_killed
 	    FROM finishes
 	    WHERE id > ?
 	    `, lastID)
@@ -220,7 +238,7 @@ func (f sqliteFinishService) GetLatestFinishes(lastID int64) ([]FinishOutput, er
 
 func (f sqliteFinishService) LastFinishForPodUniqueKey(podUniqueKey types.PodUniqueKey) (FinishOutput, error) {
 	row := f.db.QueryRow(`
-  SELECT id, date, pod_id, pod_unique_key, launchable_id, entry_point, exit_code, exit_status
+  SELECT id, date, pod_id, pod_unique_key, launchable_id, entry_point, exit_code, exit_status, oom_kills, oom_killed
   FROM finishes
   WHERE pod_unique_key = ?
   `, podUniqueKey.String())
@@ -240,6 +258,25 @@ func (f sqliteFinishService) LastFinishID() (int64, error) {
 	return id, nil
 }
 
+func (f sqliteFinishService) LastOOMKills(podID types.PodID, podUniqueKey types.PodUniqueKey, launchableID launch.LaunchableID) (int, error) {
+	var oomKills int
+	row := f.db.QueryRow(`
+  SELECT oom_kills
+  FROM finishes
+  WHERE pod_id = ? AND pod_unique_key = ? AND launchable_id = ?
+  ORDER BY id DESC LIMIT 1;
+  `, podID.String(), podUniqueKey.String(), launchableID.String())
+	err := row.Scan(&oomKills)
+	switch {
+	case err == sql.ErrNoRows:
+		return -1, nil
+	case err != nil:
+		return 0, util.Errorf("could not read last OOM kill count from database: %s", err)
+	}
+
+	return oomKills, nil
+}
+
 // Implemented by both *sql.Row and *sql.Rows
 type Scanner interface {
 	Scan(...interface{}) error
@@ -250,9 +287,10 @@ func scanRow(scanner Scanner) (FinishOutput, error) {
 	var id int64
 	var date time.Time
 	var podID, podUniqueKey, launchableID, entryPoint string
-	var exitCode, exitStatus int
+	var exitCode, exitStatus, oomKills int
+	var oomKilled bool
 
-	err := scanner.Scan(&id, &date, &podID, &podUniqueKey, &launchableID, &entryPoint, &exitCode, &exitStatus)
+	err := scanner.Scan(&id, &date, &podID, &podUniqueKey, &launchableID, &entryPoint, &exitCode, &exitStatus, &oomKills, &oomKilled)
 	if err != nil {
 		return FinishOutput{}, err
 	}
@@ -265,6 +303,8 @@ func scanRow(scanner Scanner) (FinishOutput, error) {
 		PodUniqueKey: types.PodUniqueKey(podUniqueKey),
 		ExitCode:     exitCode,
 		ExitStatus:   exitStatus,
+		OOMKills:     oomKills,
+		OOMKilled:    oomKilled,
 		ExitTime:     date,
 	}, nil
 }
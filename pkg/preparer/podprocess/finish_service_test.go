@@ -165,3 +165,44 @@ func TestLastFinishID(t *testing.T) {
 		t.Errorf("expected last written ID to be %d but was %d", 3, lastID)
 	}
 }
+
+func TestLastOOMKills(t *testing.T) {
+	finishService, _, closeFunc := initFinishService(t)
+	defer closeFunc()
+	defer finishService.Close()
+
+	oomKills, err := finishService.LastOOMKills("some_pod", "", "some_launchable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oomKills != -1 {
+		t.Errorf("expected -1 OOM kills before any finish was recorded, got %d", oomKills)
+	}
+
+	for _, finish := range []FinishOutput{
+		{PodID: "some_pod", LaunchableID: "some_launchable", EntryPoint: "launch", ExitCode: -1, ExitStatus: 9, OOMKills: 1, OOMKilled: true},
+		{PodID: "some_pod", LaunchableID: "some_launchable", EntryPoint: "worker", ExitCode: 0, OOMKills: 2},
+		{PodID: "some_pod", LaunchableID: "other_launchable", EntryPoint: "launch", ExitCode: 0, OOMKills: 5},
+	} {
+		err = finishService.Insert(finish)
+		if err != nil {
+			t.Fatalf("Could not insert a finish row: %s", err)
+		}
+	}
+
+	oomKills, err = finishService.LastOOMKills("some_pod", "", "some_launchable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oomKills != 2 {
+		t.Errorf("expected the launchable's latest OOM kill count of 2, got %d", oomKills)
+	}
+
+	finishes, err := finishService.GetLatestFinishes(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(finishes) != 3 || !finishes[0].OOMKilled || finishes[1].OOMKilled {
+		t.Errorf("expected only the first finish to be recorded as OOM killed, got %+v", finishes)
+	}
+}
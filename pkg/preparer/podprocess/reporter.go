@@ -26,8 +26,7 @@ import (
 )
 
 const (
-	workspaceFileName     = "last_synced_finish_id"
-	workspaceTempFileName = "last_synced_finish_id.tmp"
+	workspaceFileName = "last_synced_finish_id"
 
 	// Specifies the amount of time to wait between SQLite queries for the latest finish events
 	DefaultPollInterval = 15 * time.Second
@@ -104,18 +103,26 @@ type PodStatusStore interface {
 	SetLastExit(ctx context.Context, podUniqueKey types.PodUniqueKey, launchableID launch.LaunchableID, entryPoint string, exitStatus podstatus.ExitStatus) error
 }
 
+// ProcessStatusStore records the process exits of legacy pods, which have no
+// pod status of their own
+type ProcessStatusStore interface {
+	SetLastExit(ctx context.Context, node types.NodeName, podID types.PodID, launchableID launch.LaunchableID, entryPoint string, exitStatus podstatus.ExitStatus) error
+}
+
 type Reporter struct {
 	// Abstracts database operations
 	finishService            FinishService
 	environmentExtractorPath string
 	workspaceDirPath         string
 
-	logger         logging.Logger
-	client         consulutil.ConsulClient
-	podStatusStore PodStatusStore
-	pollInterval   time.Duration
-	pruneAfter     time.Duration
-	pruneInterval  time.Duration
+	logger             logging.Logger
+	client             consulutil.ConsulClient
+	node               types.NodeName
+	podStatusStore     PodStatusStore
+	processStatusStore ProcessStatusStore
+	pollInterval       time.Duration
+	pruneAfter         time.Duration
+	pruneInterval      time.Duration
 
 	timeoutPath string
 
@@ -127,7 +134,14 @@ type Reporter struct {
 
 // Should only be called if config.FullyConfigured() returned true.
 // Returns an error iff there is a configuration problem.
-func New(config ReporterConfig, logger logging.Logger, podStatusStore PodStatusStore, client consulutil.ConsulClient) (*Reporter, error) {
+func New(
+	config ReporterConfig,
+	logger logging.Logger,
+	node types.NodeName,
+	podStatusStore PodStatusStore,
+	processStatusStore ProcessStatusStore,
+	client consulutil.ConsulClient,
+) (*Reporter, error) {
 	if config.SQLiteDatabasePath == "" {
 		// If the caller uses config.FullyConfigured() properly, this shouldn't happen
 		return nil, util.Errorf("sqlite_database_path not configured, process exit status will not be captured")
@@ -196,7 +210,9 @@ func New(config ReporterConfig, logger logging.Logger, podStatusStore PodStatusS
 		environmentExtractorPath: config.EnvironmentExtractorPath,
 		workspaceDirPath:         config.WorkspaceDirPath,
 		logger:                   logger,
+		node:                     node,
 		podStatusStore:           podStatusStore,
+		processStatusStore:       processStatusStore,
 		client:                   client,
 		pollInterval:             pollInterval,
 		pruneInterval:            pruneInterval,
@@ -367,23 +383,29 @@ func (r *Reporter) reportLatestExits() {
 			"pod_unique_key": finish.PodUniqueKey,
 			"exit_code":      finish.ExitCode,
 			"exit_status":    finish.ExitStatus,
+			"oom_killed":     finish.OOMKilled,
 			"finish_id":      finish.ID,
 			"exit_time":      finish.ExitTime,
 		})
 		subLogger.Debugln("Received process exit information")
-
-		if finish.PodUniqueKey == "" {
-			// Status is only written to consul for uuid pods
-			lastID = finish.ID
-			continue
+		if finish.OOMKilled {
+			subLogger.Warnln("Process was killed by the OOM killer")
 		}
 
-		ctx, cancelFunc := transaction.New(context.Background())
-		err = r.podStatusStore.SetLastExit(ctx, finish.PodUniqueKey, finish.LaunchableID, finish.EntryPoint, podstatus.ExitStatus{
+		exitStatus := podstatus.ExitStatus{
 			ExitTime:   finish.ExitTime,
 			ExitCode:   finish.ExitCode,
 			ExitStatus: finish.ExitStatus,
-		})
+			OOMKilled:  finish.OOMKilled,
+		}
+
+		ctx, cancelFunc := transaction.New(context.Background())
+		if finish.PodUniqueKey == "" {
+			// legacy pods have no pod status, so their exits are recorded per node
+			err = r.processStatusStore.SetLastExit(ctx, r.node, finish.PodID, finish.LaunchableID, finish.EntryPoint, exitStatus)
+		} else {
+			err = r.podStatusStore.SetLastExit(ctx, finish.PodUniqueKey, finish.LaunchableID, finish.EntryPoint, exitStatus)
+		}
 		if err != nil {
 			subLogger.WithError(err).Errorln("Failed to add 'record status' to transaction'")
 		}
@@ -406,26 +428,15 @@ func (r *Reporter) reportLatestExits() {
 }
 
 // Atomically updates the contents of r.WorkspacePath to contain the id
-// (primary key) last read and processed from the sqlite database. Writes the
-// value to a new file and then uses os.Rename() so that an intermediate error
-// doesn't cause data to be lost.
+// (primary key) last read and processed from the sqlite database, so that an
+// intermediate error doesn't cause data to be lost.
 //
 // Not threadsafe.
 func (r *Reporter) writeLastID(id int64) error {
-	tmpFile, err := os.Create(r.workspaceTempFilePath())
-	if err != nil {
-		return err
-	}
-
 	stringToWrite := strconv.FormatInt(id, 10)
-	_, err = tmpFile.WriteString(stringToWrite)
+	err := util.WriteFileAtomic(r.workspaceFilePath(), []byte(stringToWrite), util.DefaultAtomicWriteOptions)
 	if err != nil {
-		return util.Errorf("Could not write newest ID to temporary file: %s", err)
-	}
-
-	err = os.Rename(r.workspaceTempFilePath(), r.workspaceFilePath())
-	if err != nil {
-		return util.Errorf("Could not rename temp file over workspace file: %s", err)
+		return util.Errorf("Could not write newest ID to workspace file: %s", err)
 	}
 	return nil
 }
@@ -466,7 +477,3 @@ func (r *Reporter) repairLastID() (int64, error) {
 func (r *Reporter) workspaceFilePath() string {
 	return filepath.Join(r.workspaceDirPath, workspaceFileName)
 }
-
-func (r *Reporter) workspaceTempFilePath() string {
-	return filepath.Join(r.workspaceDirPath, workspaceTempFileName)
-}
@@ -10,10 +10,10 @@ import (
 	"github.com/hashicorp/consul/api"
 
 	"github.com/square/p2/pkg/logging"
-	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/statusstore"
 	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/processstatus"
 	"github.com/square/p2/pkg/store/consul/statusstore/statusstoretest"
 	"github.com/square/p2/pkg/types"
 )
@@ -51,7 +51,7 @@ func TestFullyConfigured(t *testing.T) {
 func TestNew(t *testing.T) {
 	fixture := consulutil.NewFixture(t)
 	defer fixture.Stop()
-	reporter, err := New(ReporterConfig{}, logging.DefaultLogger, podstatus.NewConsul(statusstoretest.NewFake(), consul.PreparerPodStatusNamespace), fixture.Client)
+	reporter, err := New(ReporterConfig{}, logging.DefaultLogger, "node1", podstatus.NewConsul(statusstoretest.NewFake(), statusstore.PreparerPodStatusNamespace), processstatus.NewConsul(statusstoretest.NewFake(), statusstore.ProcessExitStatusNamespace), fixture.Client)
 	if reporter != nil || err == nil {
 		t.Errorf("Should have gotten a nil reporter and an error with empty config")
 	}
@@ -59,7 +59,7 @@ func TestNew(t *testing.T) {
 	reporter, err = New(ReporterConfig{
 		SQLiteDatabasePath:       "bar",
 		EnvironmentExtractorPath: "/some/nonexistent/path",
-	}, logging.DefaultLogger, podstatus.NewConsul(statusstoretest.NewFake(), consul.PreparerPodStatusNamespace), fixture.Client)
+	}, logging.DefaultLogger, "node1", podstatus.NewConsul(statusstoretest.NewFake(), statusstore.PreparerPodStatusNamespace), processstatus.NewConsul(statusstoretest.NewFake(), statusstore.ProcessExitStatusNamespace), fixture.Client)
 	if reporter != nil || err == nil {
 		t.Errorf("Should have gotten a nil reporter when EnvironmentExtractorPath doesn't exist")
 	}
@@ -79,7 +79,7 @@ func TestNew(t *testing.T) {
 	reporter, err = New(ReporterConfig{
 		SQLiteDatabasePath:       "foo",
 		EnvironmentExtractorPath: nonExecutableExtractor.Name(),
-	}, logging.DefaultLogger, podstatus.NewConsul(statusstoretest.NewFake(), consul.PreparerPodStatusNamespace), fixture.Client)
+	}, logging.DefaultLogger, "node1", podstatus.NewConsul(statusstoretest.NewFake(), statusstore.PreparerPodStatusNamespace), processstatus.NewConsul(statusstoretest.NewFake(), statusstore.ProcessExitStatusNamespace), fixture.Client)
 	if reporter != nil || err == nil {
 		t.Errorf("Should have gotten a nil reporter with non-executable environemnt_extractor_path")
 	}
@@ -94,7 +94,7 @@ func TestNew(t *testing.T) {
 	reporter, err = New(ReporterConfig{
 		SQLiteDatabasePath:       "foo",
 		EnvironmentExtractorPath: executableExtractor.Name(),
-	}, logging.DefaultLogger, podstatus.NewConsul(statusstoretest.NewFake(), consul.PreparerPodStatusNamespace), fixture.Client)
+	}, logging.DefaultLogger, "node1", podstatus.NewConsul(statusstoretest.NewFake(), statusstore.PreparerPodStatusNamespace), processstatus.NewConsul(statusstoretest.NewFake(), statusstore.ProcessExitStatusNamespace), fixture.Client)
 	if err != nil {
 		t.Errorf("Unexpected error calling New(): %s", err)
 	}
@@ -149,6 +149,56 @@ func TestRun(t *testing.T) {
 	assertStatusUpdated(t, finishOutput2, podStatusStore)
 }
 
+func TestRunRecordsLegacyPodExits(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "process_reporter")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	dbPath, quitCh, _, _, fixture := startReporter(t, tempDir)
+	defer fixture.Stop()
+	defer close(quitCh)
+
+	finishService, err := NewSQLiteFinishService(dbPath, logging.DefaultLogger)
+	if err != nil {
+		t.Fatalf("Could not initialize finish service: %s", err)
+	}
+	defer finishService.Close()
+
+	err = finishService.Insert(FinishOutput{
+		PodID:        "legacy_pod",
+		LaunchableID: "some_launchable",
+		EntryPoint:   "launch",
+		ExitCode:     -1,
+		ExitStatus:   9,
+		OOMKills:     1,
+		OOMKilled:    true,
+	})
+	if err != nil {
+		t.Fatalf("Could not insert finish value into the database: %s", err)
+	}
+
+	processStore := processstatus.NewConsul(statusstore.NewConsul(fixture.Client), statusstore.ProcessExitStatusNamespace)
+	var status processstatus.Status
+	for {
+		status, _, err = processStore.Get("node1")
+		if err == nil {
+			break
+		}
+
+		time.Sleep(15 * time.Millisecond)
+	}
+
+	processes := status.Pods["legacy_pod"]
+	if len(processes) != 1 {
+		t.Fatalf("Expected one process to be recorded for the legacy pod, got %+v", processes)
+	}
+	if len(processes[0].AbnormalExits) != 1 || !processes[0].AbnormalExits[0].OOMKilled {
+		t.Errorf("Expected the OOM kill to be recorded as an abnormal exit, got %+v", processes[0].AbnormalExits)
+	}
+}
+
 // The reporter operates by processing events from sqlite and then writing the
 // highest handled ID to a file for use in the next iteration to avoid
 // double-submitting a pod process finish. This test confirms that the reporter
@@ -300,8 +350,9 @@ func startReporter(t *testing.T, tempDir string) (string, chan struct{}, testPod
 		PollInterval:             1 * time.Millisecond,
 	}
 
-	store := podstatus.NewConsul(statusstore.NewConsul(fixture.Client), consul.PreparerPodStatusNamespace)
-	reporter, err := New(config, logging.DefaultLogger, store, fixture.Client)
+	store := podstatus.NewConsul(statusstore.NewConsul(fixture.Client), statusstore.PreparerPodStatusNamespace)
+	processStore := processstatus.NewConsul(statusstore.NewConsul(fixture.Client), statusstore.ProcessExitStatusNamespace)
+	reporter, err := New(config, logging.DefaultLogger, "node1", store, processStore, fixture.Client)
 	if err != nil {
 		t.Fatalf("Error creating reporter: %s", err)
 	}
@@ -0,0 +1,167 @@
+package preparer
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/prefetchstatus"
+	"github.com/square/p2/pkg/types"
+)
+
+type PrefetchStatusStore interface {
+	Get(node types.NodeName) (prefetchstatus.Status, *api.QueryMeta, error)
+	Set(node types.NodeName, status prefetchstatus.Status) error
+}
+
+// WatchForPrefetchRequests installs the launchables of the manifests in this
+// node's prefetch tree, without launching them, and records the outcome in
+// the node's prefetch status. Deploy tooling writes these requests so that
+// artifacts are downloaded and verified on every node before any pod is
+// restarted. Later installs of the same manifest find the launchables in
+// place and skip the download.
+//
+// Requests are handled one at a time, so that prefetching doesn't compete
+// with pod updates for bandwidth more than it has to.
+func (p *Preparer) WatchForPrefetchRequests(quit <-chan struct{}) {
+	quitWatch := make(chan struct{})
+	defer close(quitWatch)
+	errChan := make(chan error)
+	requestsChan := make(chan []consul.ManifestResult)
+	go p.store.WatchPods(consul.PREFETCH_TREE, p.node, quitWatch, errChan, requestsChan)
+
+	// results are kept across requests so that a manifest isn't prefetched
+	// again every time another request is added
+	results := make(map[types.PodID]prefetchstatus.Result)
+	var warmedUp time.Time
+	status, _, err := p.prefetchStatusStore.Get(p.node)
+	switch {
+	case err == nil:
+		for id, result := range status.Pods {
+			results[id] = result
+		}
+		warmedUp = status.WarmedUp
+	case !statusstore.IsNoStatus(err):
+		p.Logger.WithError(err).Warnln("Could not read prefetch status, previous requests will be prefetched again")
+		// don't warm up again just because the status couldn't be read
+		warmedUp = time.Now()
+	}
+
+	// Warming up happens here so that it is serialized with prefetch
+	// requests, which write the same status
+	if p.warmUpRCs != nil && warmedUp.IsZero() {
+		if p.warmUpArtifacts(quit) {
+			warmedUp = time.Now()
+			p.writePrefetchStatus(prefetchstatus.Status{Pods: results, WarmedUp: warmedUp})
+		}
+	}
+
+	for {
+		select {
+		case <-quit:
+			return
+		case err := <-errChan:
+			p.Logger.WithError(err).Errorln("There was an error reading prefetch requests")
+		case requests, ok := <-requestsChan:
+			if !ok {
+				return
+			}
+			results = p.handlePrefetchRequests(requests, results, warmedUp)
+		}
+	}
+}
+
+// handlePrefetchRequests prefetches each requested manifest that doesn't
+// already have a result, and returns the results for the current requests.
+// Results for requests that have been withdrawn are dropped, so that a
+// request made again later is retried. warmedUp is recorded in the status
+// as is.
+func (p *Preparer) handlePrefetchRequests(
+	requests []consul.ManifestResult,
+	previous map[types.PodID]prefetchstatus.Result,
+	warmedUp time.Time,
+) map[types.PodID]prefetchstatus.Result {
+	status := prefetchstatus.Status{
+		Pods:     make(map[types.PodID]prefetchstatus.Result),
+		WarmedUp: warmedUp,
+	}
+	for _, request := range requests {
+		id := request.Manifest.ID()
+		sha, err := request.Manifest.SHA()
+		if err != nil {
+			p.Logger.WithErrorAndFields(err, logrus.Fields{"pod": id}).Errorln("Could not compute SHA of prefetch request")
+			continue
+		}
+		if result, ok := previous[id]; ok && result.SHA == sha {
+			status.Pods[id] = result
+		}
+	}
+
+	for _, request := range requests {
+		id := request.Manifest.ID()
+		if _, ok := status.Pods[id]; ok {
+			continue
+		}
+		sha, err := request.Manifest.SHA()
+		if err != nil {
+			continue
+		}
+		logger := p.Logger.SubLogger(logrus.Fields{
+			"pod": id,
+			"sha": sha,
+		})
+		pod := p.podFactory.NewLegacyPod(id)
+		status.Pods[id] = p.prefetch(request.Manifest, pod, logger)
+
+		// report each result as soon as it's known, since the deploy
+		// is waiting on them
+		p.writePrefetchStatus(status)
+	}
+
+	p.writePrefetchStatus(status)
+	return status.Pods
+}
+
+func (p *Preparer) writePrefetchStatus(status prefetchstatus.Status) {
+	err := p.prefetchStatusStore.Set(p.node, status)
+	if err != nil {
+		p.Logger.WithError(err).Errorln("Could not write prefetch status")
+	}
+}
+
+// prefetch installs the launchables of man without launching them. The
+// manifest must pass the same authorization and verification as intent
+// would.
+func (p *Preparer) prefetch(man manifest.Manifest, pod Pod, logger logging.Logger) (result prefetchstatus.Result) {
+	result.SHA, _ = man.SHA()
+	defer func() { result.Time = time.Now() }()
+
+	if !p.authorize(man, logger) {
+		result.Error = "the manifest is not authorized to be deployed to this node"
+		return result
+	}
+
+	logger.NoFields().Infoln("Prefetching launchables")
+	registry := p.artifactRegistryFor(man)
+	err := pod.Install(man, p.artifactVerifier, registry, p.containerRegistryAuthStr)
+	if err != nil {
+		logger.WithError(err).Errorln("Prefetch failed")
+		result.Error = err.Error()
+		return result
+	}
+
+	err = pod.Verify(man, p.authPolicy)
+	if err != nil {
+		logger.WithError(err).Errorln("Prefetched pod failed digest verification")
+		result.Error = err.Error()
+		return result
+	}
+
+	logger.NoFields().Infoln("Prefetched launchables")
+	return result
+}
@@ -0,0 +1,86 @@
+package preparer
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/auth"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/statusstore/prefetchstatus"
+	"github.com/square/p2/pkg/types"
+)
+
+type fakePrefetchStatusStore struct {
+	statuses map[types.NodeName]prefetchstatus.Status
+}
+
+func (f *fakePrefetchStatusStore) Get(node types.NodeName) (prefetchstatus.Status, *api.QueryMeta, error) {
+	return f.statuses[node], nil, nil
+}
+
+func (f *fakePrefetchStatusStore) Set(node types.NodeName, status prefetchstatus.Status) error {
+	f.statuses[node] = status
+	return nil
+}
+
+func TestPrefetchInstallsWithoutLaunching(t *testing.T) {
+	p, hooks, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	man := testManifest(t)
+	sha, _ := man.SHA()
+
+	testPod := &TestPod{}
+	result := p.prefetch(man, testPod, logging.DefaultLogger)
+	if !result.Succeeded(sha) || result.Time.IsZero() {
+		t.Errorf("Expected the prefetch to succeed, got %+v", result)
+	}
+	if !testPod.installed || testPod.launched || testPod.halted {
+		t.Error("Expected the pod to be installed but neither halted nor launched")
+	}
+	if hooks.ranBeforeInstall || hooks.ranAfterInstall {
+		t.Error("Expected no hooks to run for a prefetch")
+	}
+
+	testPod = &TestPod{installErr: fmt.Errorf("could not download artifact")}
+	result = p.prefetch(man, testPod, logging.DefaultLogger)
+	if !result.Failed(sha) || result.Error != "could not download artifact" {
+		t.Errorf("Expected the install error to be reported, got %+v", result)
+	}
+
+	p.authPolicy = auth.FixedKeyringPolicy{}
+	testPod = &TestPod{}
+	result = p.prefetch(man, testPod, logging.DefaultLogger)
+	if !result.Failed(sha) || testPod.installed {
+		t.Errorf("Expected an unauthorized manifest not to be installed, got %+v", result)
+	}
+}
+
+func TestHandlePrefetchRequestsDropsWithdrawnRequests(t *testing.T) {
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	statuses := &fakePrefetchStatusStore{statuses: make(map[types.NodeName]prefetchstatus.Status)}
+	p.prefetchStatusStore = statuses
+
+	man := testManifest(t)
+	sha, _ := man.SHA()
+	previous := map[types.PodID]prefetchstatus.Result{
+		man.ID():    {SHA: sha},
+		"withdrawn": {SHA: "abc123"},
+	}
+
+	results := p.handlePrefetchRequests([]consul.ManifestResult{{Manifest: man}}, previous, time.Time{})
+	if len(results) != 1 || !results[man.ID()].Succeeded(sha) {
+		t.Errorf("Expected only the result of the current request to be kept, got %+v", results)
+	}
+	written := statuses.statuses[p.node].Pods
+	if len(written) != 1 || !written[man.ID()].Succeeded(sha) {
+		t.Errorf("Expected the status to only hold the current request, got %+v", written)
+	}
+}
@@ -0,0 +1,301 @@
+package preparer
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/prerequisitestatus"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// PrerequisiteChecker checks whether this host meets the prerequisites
+// declared in a pod manifest. An error means the check itself could not be
+// performed.
+type PrerequisiteChecker interface {
+	Check(prerequisites manifest.PrerequisitesStanza) ([]podstatus.UnmetPrerequisite, error)
+}
+
+type hostPrerequisiteChecker struct {
+	// Where procfs is mounted, overridden in tests
+	procRoot string
+
+	packageInstalled func(name string) (bool, error)
+}
+
+func NewHostPrerequisiteChecker() PrerequisiteChecker {
+	return hostPrerequisiteChecker{
+		procRoot:         "/proc",
+		packageInstalled: systemPackageInstalled,
+	}
+}
+
+func (h hostPrerequisiteChecker) Check(prerequisites manifest.PrerequisitesStanza) ([]podstatus.UnmetPrerequisite, error) {
+	var unmet []podstatus.UnmetPrerequisite
+
+	if prerequisites.KernelVersion != "" {
+		minimum, err := manifest.ParseKernelVersion(prerequisites.KernelVersion)
+		if err != nil {
+			return nil, err
+		}
+		release, err := ioutil.ReadFile(filepath.Join(h.procRoot, "sys", "kernel", "osrelease"))
+		if err != nil {
+			return nil, util.Errorf("could not read kernel version: %s", err)
+		}
+		actual := strings.TrimSpace(string(release))
+		current, err := manifest.ParseKernelVersion(actual)
+		if err != nil {
+			return nil, err
+		}
+		if manifest.CompareKernelVersions(current, minimum) < 0 {
+			unmet = append(unmet, podstatus.UnmetPrerequisite{
+				Kind:     "kernel_version",
+				Name:     "kernel_version",
+				Expected: ">= " + prerequisites.KernelVersion,
+				Actual:   actual,
+			})
+		}
+	}
+
+	for _, pkg := range prerequisites.Packages {
+		installed, err := h.packageInstalled(pkg)
+		if err != nil {
+			return nil, err
+		}
+		if !installed {
+			unmet = append(unmet, podstatus.UnmetPrerequisite{
+				Kind:     "package",
+				Name:     pkg,
+				Expected: "installed",
+			})
+		}
+	}
+
+	// sorted so that the reported prerequisites don't change order between checks
+	var sysctls []string
+	for name := range prerequisites.Sysctls {
+		sysctls = append(sysctls, name)
+	}
+	sort.Strings(sysctls)
+	for _, name := range sysctls {
+		expected := normalizeSysctl(prerequisites.Sysctls[name])
+		path := filepath.Join(h.procRoot, "sys", strings.Replace(name, ".", "/", -1))
+		value, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, util.Errorf("could not read sysctl %s: %s", name, err)
+		}
+		actual := normalizeSysctl(string(value))
+		if actual != expected {
+			unmet = append(unmet, podstatus.UnmetPrerequisite{
+				Kind:     "sysctl",
+				Name:     name,
+				Expected: expected,
+				Actual:   actual,
+			})
+		}
+	}
+
+	if len(prerequisites.Mounts) > 0 {
+		mounts, err := h.mountPoints()
+		if err != nil {
+			return nil, err
+		}
+		for _, mount := range prerequisites.Mounts {
+			if !mounts[filepath.Clean(mount)] {
+				unmet = append(unmet, podstatus.UnmetPrerequisite{
+					Kind:     "mount",
+					Name:     mount,
+					Expected: "mounted",
+				})
+			}
+		}
+	}
+
+	return unmet, nil
+}
+
+// Multi-valued sysctls like net.ipv4.tcp_rmem are tab separated
+func normalizeSysctl(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+func (h hostPrerequisiteChecker) mountPoints() (map[string]bool, error) {
+	f, err := os.Open(filepath.Join(h.procRoot, "mounts"))
+	if err != nil {
+		return nil, util.Errorf("could not read mounts: %s", err)
+	}
+	defer f.Close()
+
+	mounts := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		mounts[unescapeMountPath(fields[1])] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, util.Errorf("could not read mounts: %s", err)
+	}
+	return mounts, nil
+}
+
+// /proc/mounts escapes whitespace and backslashes in paths as octal, e.g. \040
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, `\`) {
+		return path
+	}
+	unescaped := make([]byte, 0, len(path))
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if b, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				unescaped = append(unescaped, byte(b))
+				i += 3
+				continue
+			}
+		}
+		unescaped = append(unescaped, path[i])
+	}
+	return string(unescaped)
+}
+
+// systemPackageInstalled asks whichever of rpm or dpkg the host has whether a
+// package is installed
+func systemPackageInstalled(name string) (bool, error) {
+	if _, err := exec.LookPath("rpm"); err == nil {
+		err := exec.Command("rpm", "-q", "--quiet", name).Run()
+		if _, ok := err.(*exec.ExitError); ok {
+			return false, nil
+		}
+		if err != nil {
+			return false, util.Errorf("could not check for package %s: %s", name, err)
+		}
+		return true, nil
+	}
+
+	if _, err := exec.LookPath("dpkg-query"); err == nil {
+		out, err := exec.Command("dpkg-query", "-W", "-f=${Status}", name).Output()
+		if _, ok := err.(*exec.ExitError); ok {
+			return false, nil
+		}
+		if err != nil {
+			return false, util.Errorf("could not check for package %s: %s", name, err)
+		}
+		return strings.TrimSpace(string(out)) == "install ok installed", nil
+	}
+
+	return false, util.Errorf("could not check for package %s: neither rpm nor dpkg-query is available", name)
+}
+
+// PrerequisiteStatusStore records the unmet prerequisites of the legacy pods on
+// a node
+type PrerequisiteStatusStore interface {
+	Get(node types.NodeName) (prerequisitestatus.Status, *api.QueryMeta, error)
+	Set(node types.NodeName, status prerequisitestatus.Status) error
+}
+
+// checkPrerequisites returns whether the host meets the prerequisites declared
+// by the intent manifest. Unmet prerequisites are recorded in the pod's status,
+// or per node for legacy pods, so that whoever scheduled it can see why it
+// isn't being installed.
+func (p *Preparer) checkPrerequisites(pair ManifestPair, logger logging.Logger) bool {
+	prerequisites := pair.Intent.GetPrerequisites()
+	if p.prerequisiteChecker == nil || prerequisites.IsEmpty() {
+		return true
+	}
+
+	unmet, err := p.prerequisiteChecker.Check(prerequisites)
+	if err != nil {
+		logger.WithError(err).Errorln("Could not check host prerequisites, will retry")
+		return false
+	}
+	if len(unmet) == 0 {
+		return true
+	}
+
+	logger.WithField("unmet_prerequisites", unmet).Errorln("Host does not meet the pod's prerequisites, will retry")
+	sha, _ := pair.Intent.SHA()
+	failure := podstatus.PrerequisiteFailure{
+		SHA:   sha,
+		Unmet: unmet,
+		Time:  time.Now(),
+	}
+	if pair.PodUniqueKey != "" {
+		p.updatePodStatus(pair.PodUniqueKey, "record unmet prerequisites", func(ps podstatus.PodStatus) (podstatus.PodStatus, error) {
+			ps.PrerequisiteFailure = &failure
+			return ps, nil
+		}, logger)
+		return false
+	}
+
+	p.updatePrerequisiteStatus(logger, func(status prerequisitestatus.Status) (prerequisitestatus.Status, bool) {
+		// the check is retried until the prerequisites are met, so
+		// don't rewrite the status each time
+		if recorded, ok := status.Pods[pair.ID]; ok && recorded.SHA == sha && reflect.DeepEqual(recorded.Unmet, unmet) {
+			return status, false
+		}
+		if status.Pods == nil {
+			status.Pods = make(map[types.PodID]podstatus.PrerequisiteFailure)
+		}
+		status.Pods[pair.ID] = failure
+		return status, true
+	})
+	return false
+}
+
+// clearPrerequisiteFailure removes the recorded unmet prerequisites of a legacy
+// pod once a manifest for it has been launched
+func (p *Preparer) clearPrerequisiteFailure(podID types.PodID, logger logging.Logger) {
+	p.updatePrerequisiteStatus(logger, func(status prerequisitestatus.Status) (prerequisitestatus.Status, bool) {
+		if _, ok := status.Pods[podID]; !ok {
+			return status, false
+		}
+		delete(status.Pods, podID)
+		return status, true
+	})
+}
+
+// updatePrerequisiteStatus applies mutator to the unmet prerequisites of the
+// node's legacy pods, and writes them back if it returns true. Failures are
+// only logged.
+func (p *Preparer) updatePrerequisiteStatus(logger logging.Logger, mutator func(prerequisitestatus.Status) (prerequisitestatus.Status, bool)) {
+	if p.prerequisiteStatusStore == nil {
+		return
+	}
+
+	// the unmet prerequisites of every legacy pod on the node are
+	// written as one status
+	p.prerequisiteStatusLock.Lock()
+	defer p.prerequisiteStatusLock.Unlock()
+	status, _, err := p.prerequisiteStatusStore.Get(p.node)
+	switch {
+	case statusstore.IsNoStatus(err):
+	case err != nil:
+		logger.WithError(err).Warnln("Could not read unmet prerequisites")
+		return
+	}
+
+	status, changed := mutator(status)
+	if !changed {
+		return
+	}
+	err = p.prerequisiteStatusStore.Set(p.node, status)
+	if err != nil {
+		logger.WithError(err).Warnln("Could not write unmet prerequisites")
+	}
+}
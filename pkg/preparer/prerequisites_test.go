@@ -0,0 +1,148 @@
+package preparer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/prerequisitestatus"
+	"github.com/square/p2/pkg/types"
+)
+
+func fakeProc(t *testing.T) string {
+	procRoot, err := ioutil.TempDir("", "prerequisites")
+	Assert(t).IsNil(err, "could not create fake proc root")
+
+	files := map[string]string{
+		"sys/kernel/osrelease":   "3.10.0-514.el7.x86_64\n",
+		"sys/net/core/somaxconn": "1024\n",
+		"sys/net/ipv4/tcp_rmem":  "4096\t87380\t6291456\n",
+		"mounts":                 "/dev/sda1 / ext4 rw 0 0\n/dev/sdb1 /data\\040disk xfs rw 0 0\n",
+	}
+	for name, contents := range files {
+		path := filepath.Join(procRoot, name)
+		Assert(t).IsNil(os.MkdirAll(filepath.Dir(path), 0755), "could not create fake proc dir")
+		Assert(t).IsNil(ioutil.WriteFile(path, []byte(contents), 0644), "could not write fake proc file")
+	}
+	return procRoot
+}
+
+func TestHostPrerequisiteCheckerMet(t *testing.T) {
+	procRoot := fakeProc(t)
+	defer os.RemoveAll(procRoot)
+
+	checker := hostPrerequisiteChecker{
+		procRoot:         procRoot,
+		packageInstalled: func(string) (bool, error) { return true, nil },
+	}
+	unmet, err := checker.Check(manifest.PrerequisitesStanza{
+		KernelVersion: "3.10",
+		Packages:      []string{"nginx"},
+		Sysctls: map[string]string{
+			"net.core.somaxconn": "1024",
+			"net.ipv4.tcp_rmem":  "4096 87380 6291456",
+		},
+		Mounts: []string{"/data disk/"},
+	})
+	Assert(t).IsNil(err, "unexpected error checking prerequisites")
+	Assert(t).AreEqual(len(unmet), 0, "expected every prerequisite to be met")
+}
+
+func TestHostPrerequisiteCheckerUnmet(t *testing.T) {
+	procRoot := fakeProc(t)
+	defer os.RemoveAll(procRoot)
+
+	checker := hostPrerequisiteChecker{
+		procRoot:         procRoot,
+		packageInstalled: func(string) (bool, error) { return false, nil },
+	}
+	unmet, err := checker.Check(manifest.PrerequisitesStanza{
+		KernelVersion: "4.4",
+		Packages:      []string{"nginx"},
+		Sysctls: map[string]string{
+			"net.core.somaxconn": "4096",
+			"vm.does_not_exist":  "1",
+		},
+		Mounts: []string{"/scratch"},
+	})
+	Assert(t).IsNil(err, "unexpected error checking prerequisites")
+
+	expected := []podstatus.UnmetPrerequisite{
+		{Kind: "kernel_version", Name: "kernel_version", Expected: ">= 4.4", Actual: "3.10.0-514.el7.x86_64"},
+		{Kind: "package", Name: "nginx", Expected: "installed"},
+		{Kind: "sysctl", Name: "net.core.somaxconn", Expected: "4096", Actual: "1024"},
+		{Kind: "sysctl", Name: "vm.does_not_exist", Expected: "1", Actual: ""},
+		{Kind: "mount", Name: "/scratch", Expected: "mounted"},
+	}
+	Assert(t).AreEqual(len(unmet), len(expected), "unexpected number of unmet prerequisites")
+	for i := range expected {
+		Assert(t).AreEqual(unmet[i], expected[i], "unexpected unmet prerequisite")
+	}
+}
+
+type fakePrerequisiteChecker struct {
+	unmet []podstatus.UnmetPrerequisite
+}
+
+func (f fakePrerequisiteChecker) Check(manifest.PrerequisitesStanza) ([]podstatus.UnmetPrerequisite, error) {
+	return f.unmet, nil
+}
+
+type fakePrerequisiteStatusStore struct {
+	statuses map[types.NodeName]prerequisitestatus.Status
+}
+
+func (f *fakePrerequisiteStatusStore) Get(node types.NodeName) (prerequisitestatus.Status, *api.QueryMeta, error) {
+	status, ok := f.statuses[node]
+	if !ok {
+		return prerequisitestatus.Status{}, nil, statusstore.NoStatusError{}
+	}
+	return status, nil, nil
+}
+
+func (f *fakePrerequisiteStatusStore) Set(node types.NodeName, status prerequisitestatus.Status) error {
+	f.statuses[node] = status
+	return nil
+}
+
+func TestPreparerWillNotInstallWithUnmetPrerequisites(t *testing.T) {
+	testPod := &TestPod{launchSuccess: true}
+	builder := testManifest(t).GetBuilder()
+	builder.SetPrerequisites(manifest.PrerequisitesStanza{Packages: []string{"nginx"}})
+	newManifest := builder.GetManifest()
+	newPair := ManifestPair{
+		ID:     newManifest.ID(),
+		Intent: newManifest,
+	}
+
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	statuses := &fakePrerequisiteStatusStore{statuses: map[types.NodeName]prerequisitestatus.Status{}}
+	p.prerequisiteStatusStore = statuses
+	p.prerequisiteChecker = fakePrerequisiteChecker{
+		unmet: []podstatus.UnmetPrerequisite{{Kind: "package", Name: "nginx", Expected: "installed"}},
+	}
+
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsFalse(success, "should have failed so that the prerequisites are checked again")
+	Assert(t).IsFalse(testPod.installed, "should not have installed a pod with unmet prerequisites")
+	failure, ok := statuses.statuses[p.node].Pods[newPair.ID]
+	Assert(t).IsTrue(ok, "should have recorded the unmet prerequisites for the node")
+	Assert(t).AreEqual(failure.Unmet[0].Name, "nginx", "recorded the wrong prerequisite")
+
+	p.prerequisiteChecker = fakePrerequisiteChecker{}
+	success = p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsTrue(success, "should have launched once the prerequisites are met")
+	Assert(t).IsTrue(testPod.installed, "should have installed the pod once the prerequisites are met")
+	_, ok = statuses.statuses[p.node].Pods[newPair.ID]
+	Assert(t).IsFalse(ok, "should have cleared the unmet prerequisites once the pod launched")
+}
@@ -0,0 +1,53 @@
+package preparer
+
+import (
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+)
+
+// canReload returns whether the change from the reality manifest to the intent
+// manifest in pair can be applied by reloading the pod's config instead of
+// restarting it. This is the case when the pod declares reloadable config and
+// nothing but its config changed.
+func canReload(pair ManifestPair, logger logging.Logger) bool {
+	if pair.Reality == nil || !pair.Intent.GetReloadableConfig() {
+		return false
+	}
+
+	onlyConfig, err := manifest.OnlyConfigChanged(pair.Reality, pair.Intent)
+	if err != nil {
+		logger.WithError(err).Warnln("Could not compare manifests, will restart the pod")
+		return false
+	}
+	if !onlyConfig {
+		return false
+	}
+
+	// docker launchables aren't run by runit, so there is nothing to signal
+	for _, stanza := range pair.Intent.GetLaunchableStanzas() {
+		if stanza.LaunchableType == "docker" {
+			return false
+		}
+	}
+	return true
+}
+
+// reloadPod writes the new config of a pod whose intent only differs from
+// reality in its config, and signals its services to re-read it. No hooks are
+// run since the pod is neither installed nor launched.
+func (p *Preparer) reloadPod(pair ManifestPair, pod Pod, logger logging.Logger) bool {
+	logger.NoFields().Infoln("Rewriting config and signaling services to reload it")
+	ok, err := pod.Reload(pair.Reality, pair.Intent)
+	if err != nil {
+		logger.WithError(err).Errorln("Config reload failed")
+		return false
+	}
+	if !ok {
+		// the reload is retried, which signals every service again
+		logger.NoFields().Warnln("One or more services could not be signaled to reload config")
+		return false
+	}
+
+	p.writeReality(pair, logger)
+	return true
+}
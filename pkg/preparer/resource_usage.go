@@ -0,0 +1,368 @@
+package preparer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rcrowley/go-metrics"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	p2metrics "github.com/square/p2/pkg/metrics"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/store/consul/statusstore/resourcestatus"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/param"
+)
+
+// ResourceUsageIntervalSec is how often the preparer samples the resource usage of
+// installed pods. Sampling is disabled if it is 0
+var ResourceUsageIntervalSec = param.Int("resource_usage_interval_sec", 30)
+
+// The kernel reports CPU time in clock ticks, which are 1/100 of a second on every
+// platform p2 runs on
+const clockTicksPerSecond = 100
+
+// The usage of each pod is also published as gauges named
+// pod_resource_usage.<pod unique name>.<resource>
+var resourceUsageMetrics = []string{"processes", "cpu_millicores", "rss_bytes", "open_fds"}
+
+type ResourceUsageStore interface {
+	Set(node types.NodeName, status resourcestatus.Status) error
+}
+
+// podServices are the runit service directories of an installed pod
+type podServices struct {
+	uniqueName  string
+	id          types.PodID
+	uniqueKey   types.PodUniqueKey
+	serviceDirs []string
+}
+
+// procStat is what is read from /proc/<pid>/stat
+type procStat struct {
+	ppid     int
+	cpuTicks uint64
+	rssPages int64
+}
+
+type cpuSample struct {
+	cpuSeconds float64
+	at         time.Time
+}
+
+// ResourceUsageReporter periodically samples the CPU time, resident memory and open
+// file descriptors of the processes of every installed pod, and publishes them to the
+// status store and as metrics. A pod's processes are those supervised by its runit
+// services and all of their descendants.
+type ResourceUsageReporter struct {
+	node     types.NodeName
+	store    ResourceUsageStore
+	interval time.Duration
+	logger   logging.Logger
+
+	// Lists the service directories of installed pods, overridden in tests
+	listPods func() ([]podServices, error)
+
+	// Where procfs is mounted, overridden in tests
+	procRoot string
+
+	// The previous CPU sample of each pod, used to compute CPU rates
+	lastCPU map[string]cpuSample
+}
+
+func NewResourceUsageReporter(
+	node types.NodeName,
+	podRoot string,
+	podFactory pods.Factory,
+	store ResourceUsageStore,
+	logger logging.Logger,
+) *ResourceUsageReporter {
+	r := &ResourceUsageReporter{
+		node:     node,
+		store:    store,
+		interval: time.Duration(*ResourceUsageIntervalSec) * time.Second,
+		logger:   logger,
+		procRoot: "/proc",
+		lastCPU:  make(map[string]cpuSample),
+	}
+	r.listPods = func() ([]podServices, error) {
+		return r.installedPodServices(podRoot, podFactory)
+	}
+	return r
+}
+
+// Run samples resource usage until quit is closed
+func (r *ResourceUsageReporter) Run(quit <-chan struct{}) {
+	if r.interval <= 0 {
+		r.logger.NoFields().Infoln("Resource usage sampling is disabled")
+		return
+	}
+	for {
+		select {
+		case <-quit:
+			return
+		case <-time.After(r.interval):
+			r.report()
+		}
+	}
+}
+
+func (r *ResourceUsageReporter) report() {
+	usage, err := r.sample(time.Now())
+	if err != nil {
+		r.logger.WithError(err).Errorln("Could not sample pod resource usage")
+		return
+	}
+
+	r.updateGauges(usage.Pods)
+
+	err = r.store.Set(r.node, usage)
+	if err != nil {
+		r.logger.WithError(err).Errorln("Could not publish pod resource usage")
+	}
+}
+
+func (r *ResourceUsageReporter) sample(now time.Time) (resourcestatus.Status, error) {
+	podList, err := r.listPods()
+	if err != nil {
+		return resourcestatus.Status{}, err
+	}
+
+	stats, err := r.readProcStats()
+	if err != nil {
+		return resourcestatus.Status{}, err
+	}
+	children := make(map[int][]int)
+	for pid, stat := range stats {
+		children[stat.ppid] = append(children[stat.ppid], pid)
+	}
+
+	status := resourcestatus.Status{
+		Pods:      make(map[string]resourcestatus.PodUsage),
+		SampledAt: now,
+	}
+	lastCPU := make(map[string]cpuSample)
+	for _, pod := range podList {
+		usage := resourcestatus.PodUsage{
+			PodID:        pod.id,
+			PodUniqueKey: pod.uniqueKey,
+		}
+
+		var ticks uint64
+		for _, pid := range r.podPIDs(pod.serviceDirs, children) {
+			stat, ok := stats[pid]
+			if !ok {
+				continue
+			}
+			usage.Processes++
+			ticks += stat.cpuTicks
+			usage.RSSBytes += stat.rssPages * int64(os.Getpagesize())
+			usage.OpenFDs += r.openFDs(pid)
+		}
+		usage.CPUSeconds = float64(ticks) / clockTicksPerSecond
+
+		if last, ok := r.lastCPU[pod.uniqueName]; ok && now.After(last.at) && usage.CPUSeconds >= last.cpuSeconds {
+			usage.CPUCores = (usage.CPUSeconds - last.cpuSeconds) / now.Sub(last.at).Seconds()
+		}
+		lastCPU[pod.uniqueName] = cpuSample{cpuSeconds: usage.CPUSeconds, at: now}
+
+		status.Pods[pod.uniqueName] = usage
+	}
+	r.lastCPU = lastCPU
+
+	return status, nil
+}
+
+// updateGauges publishes the usage of each pod, and removes the gauges of pods that
+// are no longer installed
+func (r *ResourceUsageReporter) updateGauges(usage map[string]resourcestatus.PodUsage) {
+	for uniqueName, podUsage := range usage {
+		values := map[string]int64{
+			"processes":      int64(podUsage.Processes),
+			"cpu_millicores": int64(podUsage.CPUCores * 1000),
+			"rss_bytes":      podUsage.RSSBytes,
+			"open_fds":       int64(podUsage.OpenFDs),
+		}
+		for _, resource := range resourceUsageMetrics {
+			metrics.GetOrRegisterGauge(resourceUsageMetric(uniqueName, resource), p2metrics.Registry).Update(values[resource])
+		}
+	}
+
+	var stale []string
+	p2metrics.Registry.Each(func(name string, _ interface{}) {
+		if !strings.HasPrefix(name, "pod_resource_usage.") {
+			return
+		}
+		uniqueName := strings.TrimPrefix(name, "pod_resource_usage.")
+		if i := strings.LastIndex(uniqueName, "."); i >= 0 {
+			uniqueName = uniqueName[:i]
+		}
+		if _, ok := usage[uniqueName]; !ok {
+			stale = append(stale, name)
+		}
+	})
+	for _, name := range stale {
+		p2metrics.Registry.Unregister(name)
+	}
+}
+
+func resourceUsageMetric(uniqueName string, resource string) string {
+	return fmt.Sprintf("pod_resource_usage.%s.%s", uniqueName, resource)
+}
+
+// podPIDs returns the processes supervised by the given runit services and all of
+// their descendants
+func (r *ResourceUsageReporter) podPIDs(serviceDirs []string, children map[int][]int) []int {
+	var pids []int
+	for _, serviceDir := range serviceDirs {
+		contents, err := ioutil.ReadFile(filepath.Join(serviceDir, "supervise", "pid"))
+		if err != nil {
+			// the service isn't running
+			continue
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(contents)))
+		if err != nil || pid <= 0 {
+			continue
+		}
+
+		queue := []int{pid}
+		for len(queue) > 0 {
+			pid, queue = queue[0], queue[1:]
+			pids = append(pids, pid)
+			queue = append(queue, children[pid]...)
+		}
+	}
+	return pids
+}
+
+func (r *ResourceUsageReporter) readProcStats() (map[int]procStat, error) {
+	entries, err := ioutil.ReadDir(r.procRoot)
+	if err != nil {
+		return nil, util.Errorf("could not list processes: %s", err)
+	}
+
+	stats := make(map[int]procStat)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		contents, err := ioutil.ReadFile(filepath.Join(r.procRoot, entry.Name(), "stat"))
+		if err != nil {
+			// the process exited
+			continue
+		}
+		stat, err := parseProcStat(string(contents))
+		if err != nil {
+			return nil, util.Errorf("could not parse stat of process %d: %s", pid, err)
+		}
+		stats[pid] = stat
+	}
+	return stats, nil
+}
+
+// parseProcStat parses the fields of /proc/<pid>/stat that are sampled, see proc(5).
+// The command name is parenthesized and may itself contain spaces and parentheses, so
+// fields are counted from the last ')'.
+func parseProcStat(contents string) (procStat, error) {
+	end := strings.LastIndex(contents, ")")
+	if end < 0 {
+		return procStat{}, util.Errorf("no command name in %q", contents)
+	}
+	// fields[0] is the state, the 3rd field of the file
+	fields := strings.Fields(contents[end+1:])
+	if len(fields) < 22 {
+		return procStat{}, util.Errorf("too few fields in %q", contents)
+	}
+
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return procStat{}, err
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return procStat{}, err
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return procStat{}, err
+	}
+	rss, err := strconv.ParseInt(fields[21], 10, 64)
+	if err != nil {
+		return procStat{}, err
+	}
+	return procStat{ppid: ppid, cpuTicks: utime + stime, rssPages: rss}, nil
+}
+
+func (r *ResourceUsageReporter) openFDs(pid int) int {
+	fds, err := ioutil.ReadDir(filepath.Join(r.procRoot, strconv.Itoa(pid), "fd"))
+	if err != nil {
+		return 0
+	}
+	return len(fds)
+}
+
+// installedPodServices lists the runit service directories of every pod with a
+// current manifest under podRoot
+func (r *ResourceUsageReporter) installedPodServices(podRoot string, podFactory pods.Factory) ([]podServices, error) {
+	manifestPaths, err := filepath.Glob(filepath.Join(podRoot, "*", "current_manifest.yaml"))
+	if err != nil {
+		return nil, util.Errorf("could not list installed pods: %s", err)
+	}
+
+	var installed []podServices
+	for _, manifestPath := range manifestPaths {
+		home := filepath.Base(filepath.Dir(manifestPath))
+		logger := r.logger.SubLogger(logrus.Fields{"pod_home": home})
+
+		podManifest, err := manifest.FromPath(manifestPath)
+		if err != nil {
+			logger.WithError(err).Warnln("Could not read manifest, not sampling its resource usage")
+			continue
+		}
+
+		var pod *pods.Pod
+		var uniqueKey types.PodUniqueKey
+		if podUUID := types.HomeToPodUUID(home); podUUID != nil {
+			uniqueKey = types.PodUniqueKey(podUUID.String())
+			pod, err = podFactory.NewUUIDPod(podManifest.ID(), uniqueKey)
+			if err != nil {
+				logger.WithError(err).Warnln("Could not build pod, not sampling its resource usage")
+				continue
+			}
+		} else {
+			pod = podFactory.NewLegacyPod(podManifest.ID())
+		}
+
+		launchables, err := pod.Launchables(podManifest)
+		if err != nil {
+			logger.WithError(err).Warnln("Could not list launchables, not sampling their resource usage")
+			continue
+		}
+		services := podServices{
+			uniqueName: home,
+			id:         podManifest.ID(),
+			uniqueKey:  uniqueKey,
+		}
+		for _, launchable := range launchables {
+			executables, err := launchable.Executables(pod.ServiceBuilder)
+			if err != nil {
+				// e.g. the launchable isn't installed yet
+				continue
+			}
+			for _, executable := range executables {
+				services.serviceDirs = append(services.serviceDirs, executable.Service.Path)
+			}
+		}
+		installed = append(installed, services)
+	}
+	return installed, nil
+}
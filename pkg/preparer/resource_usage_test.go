@@ -0,0 +1,168 @@
+package preparer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+
+	"github.com/square/p2/pkg/logging"
+	p2metrics "github.com/square/p2/pkg/metrics"
+	"github.com/square/p2/pkg/store/consul/statusstore/resourcestatus"
+	"github.com/square/p2/pkg/types"
+)
+
+type fakeResourceUsageStore struct {
+	status resourcestatus.Status
+}
+
+func (f *fakeResourceUsageStore) Set(node types.NodeName, status resourcestatus.Status) error {
+	f.status = status
+	return nil
+}
+
+// fakeProcess writes /proc/<pid>/stat with the given parent, CPU ticks (split between
+// user and system time) and RSS pages, and numFDs entries in /proc/<pid>/fd
+func fakeProcess(t *testing.T, procRoot string, pid int, ppid int, ticks int, rssPages int, numFDs int) {
+	dir := filepath.Join(procRoot, strconv.Itoa(pid))
+	if err := os.MkdirAll(filepath.Join(dir, "fd"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	fields := []string{strconv.Itoa(pid), "(some (odd) cmd)", "S", strconv.Itoa(ppid)}
+	for i := 4; i < 13; i++ {
+		fields = append(fields, "0")
+	}
+	fields = append(fields, strconv.Itoa(ticks/2), strconv.Itoa(ticks-ticks/2))
+	for i := 15; i < 23; i++ {
+		fields = append(fields, "0")
+	}
+	fields = append(fields, strconv.Itoa(rssPages), "0", "0")
+	stat := strings.Join(fields, " ") + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < numFDs; i++ {
+		if err := ioutil.WriteFile(filepath.Join(dir, "fd", strconv.Itoa(i)), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func fakeService(t *testing.T, root string, name string, pid int) string {
+	dir := filepath.Join(root, name)
+	if err := os.MkdirAll(filepath.Join(dir, "supervise"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "supervise", "pid"), []byte(strconv.Itoa(pid)+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestParseProcStat(t *testing.T) {
+	stat, err := parseProcStat("42 (a) b) S 1 42 42 0 -1 4194560 100 0 0 0 30 12 0 0 20 0 1 0 100 1000 250 18446744073709551615")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := procStat{ppid: 1, cpuTicks: 42, rssPages: 250}
+	if stat != expected {
+		t.Errorf("expected %+v, got %+v", expected, stat)
+	}
+
+	if _, err := parseProcStat("42 (truncated"); err == nil {
+		t.Error("expected an error parsing a stat without a command name")
+	}
+}
+
+func TestResourceUsageSample(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "resource_usage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	procRoot := filepath.Join(tempDir, "proc")
+	serviceRoot := filepath.Join(tempDir, "service")
+
+	// web runs under runit with a child and grandchild, worker isn't running
+	fakeProcess(t, procRoot, 100, 1, 200, 10, 3)
+	fakeProcess(t, procRoot, 101, 100, 100, 5, 2)
+	fakeProcess(t, procRoot, 102, 101, 100, 5, 1)
+	// unrelated process
+	fakeProcess(t, procRoot, 200, 1, 1000, 1000, 100)
+
+	webService := fakeService(t, serviceRoot, "web__app__launch", 100)
+	workerService := filepath.Join(serviceRoot, "worker__app__launch")
+
+	store := &fakeResourceUsageStore{}
+	reporter := &ResourceUsageReporter{
+		node:     "node1",
+		store:    store,
+		logger:   logging.TestLogger(),
+		procRoot: procRoot,
+		lastCPU:  make(map[string]cpuSample),
+		listPods: func() ([]podServices, error) {
+			return []podServices{
+				{uniqueName: "web", id: "web", serviceDirs: []string{webService}},
+				{uniqueName: "worker", id: "worker", serviceDirs: []string{workerService}},
+			}, nil
+		},
+	}
+
+	now := time.Now()
+	status, err := reporter.sample(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	web := status.Pods["web"]
+	expected := resourcestatus.PodUsage{
+		PodID:      "web",
+		Processes:  3,
+		CPUSeconds: 4,
+		RSSBytes:   20 * int64(os.Getpagesize()),
+		OpenFDs:    6,
+	}
+	if web != expected {
+		t.Errorf("expected web usage %+v, got %+v", expected, web)
+	}
+	if worker := status.Pods["worker"]; worker.Processes != 0 || worker.PodID != "worker" {
+		t.Errorf("expected worker to be reported without processes, got %+v", worker)
+	}
+
+	// the CPU rate is computed from consecutive samples
+	fakeProcess(t, procRoot, 100, 1, 400, 10, 3)
+	status, err = reporter.sample(now.Add(4 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cores := status.Pods["web"].CPUCores; cores != 0.5 {
+		t.Errorf("expected web to use 0.5 cores, got %f", cores)
+	}
+}
+
+func TestResourceUsageGauges(t *testing.T) {
+	reporter := &ResourceUsageReporter{}
+	reporter.updateGauges(map[string]resourcestatus.PodUsage{
+		"gauge-pod": {Processes: 2, CPUCores: 1.5, RSSBytes: 1024, OpenFDs: 7},
+	})
+
+	gauge, ok := p2metrics.Registry.Get(resourceUsageMetric("gauge-pod", "cpu_millicores")).(metrics.Gauge)
+	if !ok {
+		t.Fatal("expected a cpu gauge to be registered")
+	}
+	if gauge.Value() != 1500 {
+		t.Errorf("expected 1500 millicores, got %d", gauge.Value())
+	}
+
+	// gauges of pods that are gone are removed
+	reporter.updateGauges(map[string]resourcestatus.PodUsage{})
+	for _, resource := range resourceUsageMetrics {
+		if p2metrics.Registry.Get(resourceUsageMetric("gauge-pod", resource)) != nil {
+			t.Errorf("expected the %s gauge to be removed", resource)
+		}
+	}
+}
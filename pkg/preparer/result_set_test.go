@@ -10,6 +10,7 @@ import (
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/podstore"
+	"github.com/square/p2/pkg/store/consul/statusstore"
 	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
 	"github.com/square/p2/pkg/store/consul/statusstore/statusstoretest"
 	"github.com/square/p2/pkg/types"
@@ -28,7 +29,7 @@ func podWithID(id string) manifest.Manifest {
 func testResultSetPreparer() *Preparer {
 	fakeStatusStore := statusstoretest.NewFake()
 	return &Preparer{
-		podStatusStore: podstatus.NewConsul(fakeStatusStore, consul.PreparerPodStatusNamespace),
+		podStatusStore: podstatus.NewConsul(fakeStatusStore, statusstore.PreparerPodStatusNamespace),
 		podStore:       podstore.NewConsul(consulutil.NewFakeClient().KV()),
 	}
 }
@@ -22,10 +22,12 @@ import (
 	"gopkg.in/yaml.v2"
 
 	"github.com/square/p2/pkg/artifact"
+	"github.com/square/p2/pkg/artifact/peercache"
 	"github.com/square/p2/pkg/auth"
 	"github.com/square/p2/pkg/constants"
 	"github.com/square/p2/pkg/docker"
 	"github.com/square/p2/pkg/hooks"
+	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
@@ -33,11 +35,23 @@ import (
 	"github.com/square/p2/pkg/pods"
 	"github.com/square/p2/pkg/preparer/podprocess"
 	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/srv"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/podstore"
+	"github.com/square/p2/pkg/store/consul/rcstore"
 	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/deploystatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/fingerprintstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/hookstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/intentstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/nodestatus"
 	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/prefetchstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/prerequisitestatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/processstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/resourcestatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/restartstatus"
 	"github.com/square/p2/pkg/store/consul/transaction"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/uri"
@@ -71,29 +85,90 @@ type PodStatusStore interface {
 	MutateStatus(ctx context.Context, key types.PodUniqueKey, mutator func(podstatus.PodStatus) (podstatus.PodStatus, error)) error
 }
 
+type NodeStatusStore interface {
+	MutateStatus(ctx context.Context, node types.NodeName, mutator func(nodestatus.Status) (nodestatus.Status, error)) error
+}
+
 type Preparer struct {
-	node                   types.NodeName
-	store                  Store
-	podStatusStore         PodStatusStore
-	podStore               podstore.Store
-	client                 consulutil.ConsulClient
-	hooks                  Hooks
-	Logger                 logging.Logger
-	podFactory             pods.Factory
-	podRoot                string
-	authPolicy             auth.Policy
-	maxLaunchableDiskUsage size.ByteCount
-	finishExec             []string
-	logExec                []string
-	logBridgeBlacklist     []string
-	artifactVerifier       auth.ArtifactVerifier
-	artifactRegistry       artifact.Registry
-	fetcher                uri.Fetcher // cached (potentially nil) uri.Fetcher configured based on the preparer's manifest
+	node                    types.NodeName
+	store                   Store
+	podStatusStore          PodStatusStore
+	nodeStatusStore         NodeStatusStore
+	prefetchStatusStore     PrefetchStatusStore
+	deployStatusStore       DeployStatusStore
+	deployStatusLock        sync.Mutex
+	acknowledged            map[types.PodID]string // intent SHA last acknowledged per pod
+	fingerprintStatusStore  FingerprintStatusStore
+	fingerprintStatusLock   sync.Mutex
+	hookStatusStore         HookStatusStore
+	hookStatusLock          sync.Mutex
+	intentStatusStore       IntentStatusStore
+	intentStatusLock        sync.Mutex
+	prerequisiteStatusStore PrerequisiteStatusStore
+	prerequisiteStatusLock  sync.Mutex
+	restartStatusStore      RestartStatusStore
+	restartStatusLock       sync.Mutex
+	podWorkers              map[types.PodID]podWorker // see registerPodWorker
+	podWorkersLock          sync.Mutex
+	podStore                podstore.Store
+	client                  consulutil.ConsulClient
+	hooks                   Hooks
+	Logger                  logging.Logger
+	podFactory              pods.Factory
+	podRoot                 string
+	authPolicy              auth.Policy
+	maxLaunchableDiskUsage  size.ByteCount
+	finishExec              []string
+	logExec                 []string
+	logBridgeBlacklist      []string
+	artifactVerifier        auth.ArtifactVerifier
+	artifactRegistry        artifact.Registry
+	fetcher                 uri.Fetcher // cached (potentially nil) uri.Fetcher configured based on the preparer's manifest
+	shutdownGracePeriod     time.Duration
+
+	// Serializes this process's writes of the node status, see
+	// writeNodeStatus
+	nodeStatusLock sync.Mutex
+
+	// Bounds the number of pods being updated on this node at once. Nil
+	// means there is no limit
+	updateSlots *updateSlots
+
+	// Consulted before enacting intent changes, if configured
+	intentValidator IntentValidator
+
+	// Verifies the host prerequisites declared by manifests before they are
+	// installed
+	prerequisiteChecker PrerequisiteChecker
+
+	// Describes the environment of this host, recorded whenever a pod is
+	// written to reality. Nil means nothing is recorded
+	fingerprinter Fingerprinter
 
 	// Exported so it can be checked for nil (it only runs if configured)
 	// and quit channel conditially created
 	PodProcessReporter *podprocess.Reporter
 
+	// Serves downloaded artifacts to other nodes, if configured. Exported
+	// so that it can be run by the caller
+	ArtifactCache *peercache.Cache
+
+	// Tracks whether Consul is reachable. Exported so that it can be run
+	// and reported on by the status server
+	ConsulLiveness *ConsulLiveness
+
+	// Samples and publishes the resource usage of installed pods. Exported so
+	// that it can be run
+	ResourceUsageReporter *ResourceUsageReporter
+
+	// Compares the node's clock with a reference clock, if configured.
+	// Exported so that it can be run
+	ClockSkew *ClockSkew
+
+	// Restarts pods whose health stays critical, if configured. Exported so
+	// that it can be given the health monitor's results
+	Supervisor *Supervisor
+
 	// The pod manifest to use for hooks
 	hooksManifest manifest.Manifest
 
@@ -103,8 +178,20 @@ type Preparer struct {
 	// The directory that will actually be executed by the HookDir
 	hooksExecDir string
 
+	// Builds the pods of hook pods scheduled to this node, see
+	// resolveHookPair
+	hookPodFactory pods.HookFactory
+
 	// base64 encoding of docker authConfig needed for ImagePull
 	containerRegistryAuthStr string
+
+	// Records internal state for debug bundles. May be nil
+	debug *debugState
+
+	// Read to warm up artifacts after the node joins. Nil unless
+	// configured, see PreparerConfig.WarmUpArtifacts
+	warmUpRCs  RCLister
+	nodeLabels NodeLabelReader
 }
 
 type store interface {
@@ -179,6 +266,99 @@ type PreparerConfig struct {
 	// clients, e.g. consul client vs artifact downloader
 	HTTPTimeout time.Duration `yaml:"http_timeout"`
 
+	// ShutdownGracePeriod bounds how long "p2-preparer --shutdown" will wait
+	// for pods to halt before giving up on them and returning, so that it
+	// doesn't hold up a host shutdown indefinitely. Zero means wait for
+	// every pod regardless of how long it takes.
+	ShutdownGracePeriod time.Duration `yaml:"shutdown_grace_period,omitempty"`
+
+	// MaxConcurrentPodUpdates is the maximum number of pods that the
+	// preparer will halt and relaunch at the same time, so that unrelated
+	// deploys of pods that share this node don't restart all of them at
+	// once. Zero means no limit. The preparer itself is exempt.
+	MaxConcurrentPodUpdates int `yaml:"max_concurrent_pod_updates,omitempty"`
+
+	// IntentValidatorURL, if set, is an HTTP endpoint that will be asked to
+	// approve each new or changed intent manifest before it is enacted. See
+	// NewHTTPIntentValidator() for the protocol.
+	IntentValidatorURL string `yaml:"intent_validator_url,omitempty"`
+
+	// NodeHealthPort, if set, is a TCP port on which the health monitor
+	// serves a summary of the health of every pod on the node at
+	// /_node_health. It responds with a 503 if any pod isn't passing. A
+	// page describing every pod for operators is served at /.
+	NodeHealthPort int `yaml:"node_health_port,omitempty"`
+
+	// NodeStatusLogURL, if set, links each pod on the HTML status page
+	// that is served at / on NodeHealthPort to its logs. Occurrences of
+	// "{node}" and "{pod}" are replaced with the node name and pod ID.
+	NodeStatusLogURL string `yaml:"node_status_log_url,omitempty"`
+
+	// PublishNodeHealth makes the health monitor publish the health of the
+	// node, aggregated from the health of its pods, to the node's node
+	// health status. Replication controllers and p2-replicate don't give
+	// new pods to nodes whose published health is critical.
+	PublishNodeHealth bool `yaml:"publish_node_health,omitempty"`
+
+	// SRVPublisher, if set, makes the health monitor publish SRV records
+	// for the ports of each healthy pod on the node. See the srv package.
+	SRVPublisher *srv.Config `yaml:"srv_publisher,omitempty"`
+
+	// HealthCheckInterval and HealthCheckTTL are the defaults for how often
+	// the health monitor checks each pod and how long its results are valid
+	// for, for pods whose manifests don't set status.interval and
+	// status.ttl. A zero interval means every second and a zero TTL means
+	// results are valid until the health monitor's session expires.
+	HealthCheckInterval time.Duration `yaml:"health_check_interval,omitempty"`
+	HealthCheckTTL      time.Duration `yaml:"health_check_ttl,omitempty"`
+
+	// HealthWriter is who the health monitor writes the node's health
+	// results as, "preparer" (the default) or "health-daemon". A health
+	// monitor running as the health daemon, e.g. outside of the preparer,
+	// takes over writing the results from the preparer's while both run.
+	// See consul.HealthWriter.
+	HealthWriter string `yaml:"health_writer,omitempty"`
+
+	// ArtifactPeerCache, if set, makes the preparer fetch launchable
+	// artifacts from other nodes that have already downloaded them before
+	// trying the origin, and serve the artifacts it downloads to other
+	// nodes. See the peercache package.
+	ArtifactPeerCache *peercache.Config `yaml:"artifact_peer_cache,omitempty"`
+
+	// WarmUpArtifacts makes the preparer prefetch the launchables of every
+	// replication controller whose node selector matches the node, once
+	// after the node joins, so that scaling up onto new nodes doesn't wait
+	// for downloads. Whether it has happened is recorded in the node's
+	// prefetch status.
+	WarmUpArtifacts bool `yaml:"warm_up_artifacts,omitempty"`
+
+	// ArtifactBandwidth caps the rate at which launchable artifacts are
+	// downloaded, from the origin or from peers, so that deploys don't
+	// saturate network links shared with production traffic. Note that
+	// HTTPTimeout still bounds each download, so the caps must leave room
+	// for the largest artifact to arrive in time.
+	ArtifactBandwidth uri.BandwidthLimits `yaml:"artifact_bandwidth,omitempty"`
+
+	// FingerprintPackages lists the system packages whose installed
+	// versions are recorded, along with the OS, kernel and p2 versions,
+	// each time a pod is written to reality. See the fingerprintstatus
+	// package.
+	FingerprintPackages []string `yaml:"fingerprint_packages,omitempty"`
+
+	// ClockReference is the clock the node's clock is compared with, an NTP
+	// server as ntp://host[:port] or an HTTP server whose Date header is
+	// read, such as a Consul server. While the node's clock is skewed, the
+	// node's status has the clock_skewed condition and its health results
+	// are marked as written with a skewed clock. See NewClockReference.
+	ClockReference string `yaml:"clock_reference,omitempty"`
+
+	// Supervisor, if set, makes the preparer restart the launchables of
+	// pods whose health has been critical for longer than a configured
+	// duration, backing off between restarts and giving up on a pod after
+	// too many. Restarts are recorded per node in the restart status. See
+	// SupervisorConfig.
+	Supervisor *SupervisorConfig `yaml:"supervisor,omitempty"`
+
 	// Use a single Store so that all requests go through the same HTTP client.
 	consulClientMux sync.Mutex
 	consulClient    consulutil.ConsulClient
@@ -210,9 +390,10 @@ type UserAuth struct {
 // "type: none"     - no artifact verification is done
 // "type: build"    - checks that builds have a corresponding signature
 // "type: manifest" - checks that builds have corresponding digest manifest and
-//  						      manifest signature files.
-// "type: either"   - checks that one of "build" or "manifest" strategies pass.
 //
+//	manifest signature files.
+//
+// "type: either"   - checks that one of "build" or "manifest" strategies pass.
 type ManifestVerification struct {
 	Type           string
 	KeyringPath    string   `yaml:"keyring,omitempty"`
@@ -433,7 +614,14 @@ func New(preparerConfig *PreparerConfig, logger logging.Logger) (*Preparer, erro
 	}
 
 	statusStore := statusstore.NewConsul(client)
-	podStatusStore := podstatus.NewConsul(statusStore, consul.PreparerPodStatusNamespace)
+	podStatusStore := podstatus.NewConsul(statusStore, statusstore.PreparerPodStatusNamespace)
+	nodeStatusStore := nodestatus.NewConsul(statusStore, statusstore.PreparerPodStatusNamespace)
+	prefetchStatusStore := prefetchstatus.NewConsul(statusStore, statusstore.PrefetchStatusNamespace)
+	deployStatusStore := deploystatus.NewConsul(statusStore, statusstore.DeployTimingStatusNamespace)
+	fingerprintStatusStore := fingerprintstatus.NewConsul(statusStore, statusstore.FingerprintStatusNamespace)
+	hookStatusStore := hookstatus.NewConsul(statusStore, statusstore.HookStatusNamespace)
+	resourceUsageStore := resourcestatus.NewConsul(statusStore, statusstore.ResourceUsageStatusNamespace)
+	processStatusStore := processstatus.NewConsul(statusStore, statusstore.ProcessExitStatusNamespace)
 	podStore := podstore.NewConsul(client.KV())
 
 	store := consul.NewConsulStore(client)
@@ -489,7 +677,14 @@ func New(preparerConfig *PreparerConfig, logger logging.Logger) (*Preparer, erro
 			"component": "PodProcessReporter",
 		})
 
-		podProcessReporter, err = podprocess.New(preparerConfig.PodProcessReporterConfig, podProcessReporterLogger, podStatusStore, client)
+		podProcessReporter, err = podprocess.New(
+			preparerConfig.PodProcessReporterConfig,
+			podProcessReporterLogger,
+			preparerConfig.NodeName,
+			podStatusStore,
+			processStatusStore,
+			client,
+		)
 		if err != nil {
 			return nil, err
 		}
@@ -508,6 +703,7 @@ func New(preparerConfig *PreparerConfig, logger logging.Logger) (*Preparer, erro
 
 	var hooksManifest manifest.Manifest
 	var hooksPod *pods.Pod
+	hooksPodFactory := pods.NewHookFactory(filepath.Join(preparerConfig.PodRoot, "hooks"), preparerConfig.NodeName, fetcher)
 	var auditLogger hooks.AuditLogger
 	auditLogger = hooks.NewFileAuditLogger(&logger)
 	if preparerConfig.HooksManifest != NoHooksSentinelValue {
@@ -519,7 +715,6 @@ func New(preparerConfig *PreparerConfig, logger logging.Logger) (*Preparer, erro
 		if err != nil {
 			return nil, util.Errorf("Could not parse configured hooks manifest: %s", err)
 		}
-		hooksPodFactory := pods.NewHookFactory(filepath.Join(preparerConfig.PodRoot, "hooks"), preparerConfig.NodeName, fetcher)
 		hooksPod = hooksPodFactory.NewHookPod(hooksManifest.ID())
 		hooksSqlite, ok := hooksManifest.GetConfig()["sqlite_path"]
 		if ok {
@@ -549,7 +744,35 @@ func New(preparerConfig *PreparerConfig, logger logging.Logger) (*Preparer, erro
 		osVersionDetector = osversion.NewDetector(preparerConfig.OSVersionFile)
 	}
 
-	podFactory := pods.NewFactory(preparerConfig.PodRoot, preparerConfig.NodeName, fetcher, preparerConfig.RequireFile, readOnlyPolicy)
+	// artifacts are downloaded with their own client so that bandwidth
+	// caps don't slow down anything else
+	artifactClient := *httpClient
+	artifactClient.Transport = uri.NewThrottledTransport(httpClient.Transport, preparerConfig.ArtifactBandwidth)
+	var artifactFetcher uri.Fetcher = uri.BasicFetcher{
+		Client: &artifactClient,
+	}
+	var artifactCache *peercache.Cache
+	if preparerConfig.ArtifactPeerCache != nil {
+		// anything can be served by a peer, so only the verifier stands
+		// between a compromised node and every other node's pods
+		if t, _ := preparerConfig.ArtifactAuth["type"].(string); t == "" || t == auth.VerifyNone {
+			return nil, util.Errorf("artifact_peer_cache requires artifact_auth to verify artifacts")
+		}
+		artifactCache, err = peercache.New(
+			*preparerConfig.ArtifactPeerCache,
+			preparerConfig.NodeName,
+			client.KV(),
+			artifactFetcher,
+			&artifactClient,
+			logger.SubLogger(logrus.Fields{"component": "artifact_peer_cache"}),
+		)
+		if err != nil {
+			return nil, err
+		}
+		artifactFetcher = artifactCache
+	}
+
+	podFactory := pods.NewFactory(preparerConfig.PodRoot, preparerConfig.NodeName, artifactFetcher, preparerConfig.RequireFile, readOnlyPolicy)
 	podFactory.SetOSVersionDetector(osVersionDetector)
 
 	// TODO: we might want to customize our docker client
@@ -567,11 +790,45 @@ func New(preparerConfig *PreparerConfig, logger logging.Logger) (*Preparer, erro
 	}
 
 	podFactory.SetDockerClient(*dockerClient)
-	return &Preparer{
+
+	var slots *updateSlots
+	if preparerConfig.MaxConcurrentPodUpdates > 0 {
+		newSession := func(name string) (consul.Session, chan error, error) {
+			return consul.NewSession(client, name, nil)
+		}
+		slots = newUpdateSlots(preparerConfig.NodeName, preparerConfig.MaxConcurrentPodUpdates, newSession, logger)
+	}
+
+	var intentValidator IntentValidator
+	if preparerConfig.IntentValidatorURL != "" {
+		intentValidator = NewHTTPIntentValidator(preparerConfig.IntentValidatorURL, httpClient)
+	}
+
+	debug := newDebugState()
+	logger.Logger.Hooks.Add(debug)
+
+	var warmUpRCs RCLister
+	var nodeLabels NodeLabelReader
+	if preparerConfig.WarmUpArtifacts {
+		applicator := labels.NewConsulApplicator(client, 0, 0)
+		warmUpRCs = rcstore.NewConsul(client, applicator, 0)
+		nodeLabels = applicator
+	}
+
+	hookContext := hooks.NewContext(preparerConfig.HooksDirectory, preparerConfig.PodRoot, &logger, auditLogger)
+	p := &Preparer{
 		node:                     preparerConfig.NodeName,
 		store:                    store,
-		hooks:                    hooks.NewContext(preparerConfig.HooksDirectory, preparerConfig.PodRoot, &logger, auditLogger),
+		hooks:                    hookContext,
 		podStatusStore:           podStatusStore,
+		nodeStatusStore:          nodeStatusStore,
+		prefetchStatusStore:      prefetchStatusStore,
+		deployStatusStore:        deployStatusStore,
+		fingerprintStatusStore:   fingerprintStatusStore,
+		hookStatusStore:          hookStatusStore,
+		intentStatusStore:        intentstatus.NewConsul(statusStore, statusstore.IntentRejectionStatusNamespace),
+		prerequisiteStatusStore:  prerequisitestatus.NewConsul(statusStore, statusstore.PrerequisiteStatusNamespace),
+		restartStatusStore:       restartstatus.NewConsul(statusStore, statusstore.RestartStatusNamespace),
 		podStore:                 podStore,
 		podRoot:                  preparerConfig.PodRoot,
 		client:                   client,
@@ -586,11 +843,44 @@ func New(preparerConfig *PreparerConfig, logger logging.Logger) (*Preparer, erro
 		artifactRegistry:         artifactRegistry,
 		containerRegistryAuthStr: containerRegistryAuthStr,
 		PodProcessReporter:       podProcessReporter,
+		ArtifactCache:            artifactCache,
+		ConsulLiveness:           NewConsulLiveness(client.KV(), logger.SubLogger(logrus.Fields{"component": "consul_liveness"})),
 		hooksManifest:            hooksManifest,
 		hooksPod:                 hooksPod,
 		hooksExecDir:             preparerConfig.HooksDirectory,
+		hookPodFactory:           hooksPodFactory,
 		fetcher:                  fetcher,
-	}, nil
+		shutdownGracePeriod:      preparerConfig.ShutdownGracePeriod,
+		updateSlots:              slots,
+		intentValidator:          intentValidator,
+		prerequisiteChecker:      NewHostPrerequisiteChecker(),
+		fingerprinter:            NewHostFingerprinter(osVersionDetector, preparerConfig.FingerprintPackages),
+		debug:                    debug,
+		warmUpRCs:                warmUpRCs,
+		nodeLabels:               nodeLabels,
+		ResourceUsageReporter: NewResourceUsageReporter(
+			preparerConfig.NodeName,
+			preparerConfig.PodRoot,
+			podFactory,
+			resourceUsageStore,
+			logger.SubLogger(logrus.Fields{"component": "resource_usage"}),
+		),
+	}
+	hookContext.SetResultRecorder(p)
+	if preparerConfig.ClockReference != "" {
+		reference, err := NewClockReference(preparerConfig.ClockReference, httpClient)
+		if err != nil {
+			return nil, err
+		}
+		p.ClockSkew = NewClockSkew(reference, p.publishClockSkew, logger.SubLogger(logrus.Fields{"component": "clock_skew"}))
+	}
+	if preparerConfig.Supervisor != nil {
+		p.Supervisor, err = NewSupervisor(*preparerConfig.Supervisor, p.restartPod, p.recordRestart, logger.SubLogger(logrus.Fields{"component": "supervisor"}))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
 }
 
 func getDeployerAuth(preparerConfig *PreparerConfig) (auth.Policy, error) {
@@ -793,28 +1083,34 @@ func (p *Preparer) InstallHooks() error {
 	})
 
 	p.Logger.Infoln("Installing hook manifest")
-	registry := p.artifactRegistryFor(p.hooksManifest)
-	err := p.hooksPod.Install(p.hooksManifest, p.artifactVerifier, registry, "")
+	return p.installHookPod(p.hooksPod, p.hooksManifest, sub)
+}
+
+// installHookPod installs a hook pod and writes the executor scripts of its
+// launchables to the hooks directory
+func (p *Preparer) installHookPod(pod *pods.Pod, manifest manifest.Manifest, logger logging.Logger) error {
+	registry := p.artifactRegistryFor(manifest)
+	err := pod.Install(manifest, p.artifactVerifier, registry, "")
 	if err != nil {
-		sub.WithError(err).Errorln("Could not install hook")
+		logger.WithError(err).Errorln("Could not install hook")
 		return err
 	}
 
-	_, err = p.hooksPod.WriteCurrentManifest(p.hooksManifest)
+	_, err = pod.WriteCurrentManifest(manifest)
 	if err != nil {
-		sub.WithError(err).Errorln("Could not write current manifest")
+		logger.WithError(err).Errorln("Could not write current manifest")
 		return err
 	}
 
 	// Now that the pod is installed, link it up to the exec dir.
-	err = hooks.InstallHookScripts(p.hooksExecDir, p.hooksPod, p.hooksManifest, sub)
+	err = hooks.InstallHookScripts(p.hooksExecDir, pod, manifest, logger)
 	if err != nil {
-		sub.WithError(err).Errorln("Could not write hook link")
+		logger.WithError(err).Errorln("Could not write hook link")
 		return err
 	}
-	sub.NoFields().Infoln("Updated hook")
+	logger.NoFields().Infoln("Updated hook")
 
-	p.hooksPod.Prune(p.maxLaunchableDiskUsage, p.hooksManifest)
+	pod.Prune(p.maxLaunchableDiskUsage, manifest)
 
 	return nil
 }
@@ -0,0 +1,252 @@
+package preparer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/constants"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/statusstore/nodestatus"
+	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// MarkNodeRunning records that the preparer on this node is up. It should be
+// called on startup so that a node which was previously shut down with
+// Shutdown() is no longer reported as shutting down.
+func (p *Preparer) MarkNodeRunning() error {
+	return p.setNodeState(nodestatus.NodeRunning)
+}
+
+// Shutdown is meant to be invoked when the host is going down (e.g. from the
+// ExecStop of a systemd unit ordered before network and consul shutdown). It
+// marks the node as shutting down in the status store so that rollout tooling
+// doesn't treat the pods' disappearance as a failure, and then halts every pod
+// in the node's reality tree, including the preparer itself.
+//
+// The intent and reality trees are left untouched: pods are expected to come
+// back when the host does. If the preparer was configured with a shutdown
+// grace period, pods that are still halting when it elapses are reported in
+// the returned error and the preparer pod is halted without waiting for them.
+func (p *Preparer) Shutdown() error {
+	err := p.setNodeState(nodestatus.NodeShuttingDown)
+	if err != nil {
+		// Still stop the pods, the host is going down regardless
+		p.Logger.WithError(err).Errorln("Could not mark node as shutting down")
+	}
+
+	reality, _, err := p.store.ListPods(consul.REALITY_TREE, p.node)
+	if err != nil {
+		return util.Errorf("could not list pods in reality for %s: %s", p.node, err)
+	}
+
+	return p.haltAll(reality, p.podForResult, p.shutdownGracePeriod)
+}
+
+func (p *Preparer) setNodeState(state nodestatus.NodeState) error {
+	return p.writeNodeStatus(func(status *nodestatus.Status) {
+		status.State = state
+		status.StateChanged = time.Now()
+	})
+}
+
+// setNodeCondition records that a condition holds for the node, or that it no
+// longer does if condition is nil
+func (p *Preparer) setNodeCondition(conditionType nodestatus.ConditionType, condition *nodestatus.Condition) error {
+	return p.writeNodeStatus(func(status *nodestatus.Status) {
+		if condition == nil {
+			delete(status.Conditions, conditionType)
+			return
+		}
+		if status.Conditions == nil {
+			status.Conditions = make(map[nodestatus.ConditionType]nodestatus.Condition)
+		}
+		status.Conditions[conditionType] = *condition
+	})
+}
+
+// writeNodeStatus applies mutate to the node's stored status and writes it
+// back. Both the running preparer and a `p2-preparer --shutdown` process write
+// the node's status, so the write is checked against the index that was read
+// and retried if the status changed in between.
+func (p *Preparer) writeNodeStatus(mutate func(status *nodestatus.Status)) error {
+	if p.nodeStatusStore == nil {
+		return nil
+	}
+	p.nodeStatusLock.Lock()
+	defer p.nodeStatusLock.Unlock()
+
+	for attempt := 0; attempt < nodeStatusWriteAttempts; attempt++ {
+		ok, err := p.tryWriteNodeStatus(mutate)
+		if ok || err != nil {
+			return err
+		}
+	}
+	return util.Errorf("node status for %s kept changing while it was being written", p.node)
+}
+
+const nodeStatusWriteAttempts = 5
+
+// tryWriteNodeStatus returns false if the node's status changed between being
+// read and written
+func (p *Preparer) tryWriteNodeStatus(mutate func(status *nodestatus.Status)) (bool, error) {
+	ctx, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
+	err := p.nodeStatusStore.MutateStatus(ctx, p.node, func(status nodestatus.Status) (nodestatus.Status, error) {
+		mutate(&status)
+		return status, nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	ok, _, err := transaction.Commit(ctx, p.client.KV())
+	if err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+func (p *Preparer) podForResult(result consul.ManifestResult) (Pod, error) {
+	if result.PodUniqueKey == "" {
+		return p.podFactory.NewLegacyPod(result.Manifest.ID()), nil
+	}
+	return p.podFactory.NewUUIDPod(result.Manifest.ID(), result.PodUniqueKey)
+}
+
+// haltAll halts the pods in parallel, because Halt() waits on each launchable's
+// lifecycle scripts and stop timeout. The preparer pod is halted last since
+// stopping it may terminate the calling process.
+//
+// Halts can't be interrupted, so if the grace period expires first the pods
+// still halting are reported as failed and the preparer pod is halted anyway.
+func (p *Preparer) haltAll(
+	results []consul.ManifestResult,
+	podFor func(consul.ManifestResult) (Pod, error),
+	gracePeriod time.Duration,
+) error {
+	var preparerResults []consul.ManifestResult
+	var haltWG sync.WaitGroup
+
+	// failed and halting are shared with the halt goroutines
+	var mu sync.Mutex
+	var failed []string
+	halting := make(map[int]types.PodID)
+	for i, result := range results {
+		if result.Manifest.ID() == constants.PreparerPodID {
+			preparerResults = append(preparerResults, result)
+			continue
+		}
+
+		logger := p.Logger.SubLogger(logrus.Fields{
+			"pod":            result.Manifest.ID(),
+			"pod_unique_key": result.PodUniqueKey,
+		})
+		pod, err := podFor(result)
+		if err != nil {
+			logger.WithError(err).Errorln("Could not initialize pod for shutdown")
+			mu.Lock()
+			failed = append(failed, result.Manifest.ID().String())
+			mu.Unlock()
+			continue
+		}
+
+		mu.Lock()
+		halting[i] = result.Manifest.ID()
+		mu.Unlock()
+		haltWG.Add(1)
+		go func(i int, result consul.ManifestResult, pod Pod, logger logging.Logger) {
+			defer haltWG.Done()
+			success := p.haltForShutdown(result, pod, logger)
+			mu.Lock()
+			defer mu.Unlock()
+			if _, ok := halting[i]; !ok {
+				// The grace period expired and this pod was
+				// already reported as still halting
+				return
+			}
+			delete(halting, i)
+			if !success {
+				failed = append(failed, result.Manifest.ID().String())
+			}
+		}(i, result, pod, logger)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		haltWG.Wait()
+		close(done)
+	}()
+
+	var timeout <-chan time.Time
+	if gracePeriod > 0 {
+		timeout = time.After(gracePeriod)
+	}
+	var stillHalting []string
+	select {
+	case <-done:
+	case <-timeout:
+		mu.Lock()
+		for i, podID := range halting {
+			stillHalting = append(stillHalting, podID.String())
+			delete(halting, i)
+		}
+		mu.Unlock()
+		p.Logger.WithFields(logrus.Fields{
+			"grace_period":  gracePeriod,
+			"still_halting": stillHalting,
+		}).Warnln("Shutdown grace period expired before all pods halted")
+	}
+
+	for _, result := range preparerResults {
+		logger := p.Logger.SubLogger(logrus.Fields{"pod": result.Manifest.ID()})
+		pod, err := podFor(result)
+		if err != nil {
+			logger.WithError(err).Errorln("Could not initialize pod for shutdown")
+			mu.Lock()
+			failed = append(failed, result.Manifest.ID().String())
+			mu.Unlock()
+			continue
+		}
+		if !p.haltForShutdown(result, pod, logger) {
+			mu.Lock()
+			failed = append(failed, result.Manifest.ID().String())
+			mu.Unlock()
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	switch {
+	case len(stillHalting) > 0 && len(failed) > 0:
+		return util.Errorf("the following pods were still halting when the %s shutdown grace period expired: %v, and the following pods did not halt cleanly: %v", gracePeriod, stillHalting, failed)
+	case len(stillHalting) > 0:
+		return util.Errorf("the following pods were still halting when the %s shutdown grace period expired: %v", gracePeriod, stillHalting)
+	case len(failed) > 0:
+		return util.Errorf("the following pods did not halt cleanly: %v", failed)
+	}
+	return nil
+}
+
+func (p *Preparer) haltForShutdown(result consul.ManifestResult, pod Pod, logger logging.Logger) bool {
+	// The host is going down, so launchables don't get to opt out of being
+	// stopped. Each launchable's restart_timeout still bounds how long it has
+	// to exit gracefully.
+	force := true
+	logger.NoFields().Infoln("Halting pod for node shutdown")
+	success, err := pod.Halt(result.Manifest, force)
+	if err != nil {
+		logger.WithError(err).Errorln("Pod halt failed")
+		return false
+	}
+	if !success {
+		logger.NoFields().Warnln("One or more launchables did not halt successfully")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,161 @@
+package preparer
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/square/p2/pkg/constants"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/consulutil/consulutiltest"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/nodestatus"
+)
+
+func TestHaltAllForceHaltsEveryPod(t *testing.T) {
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+
+	builder := manifest.NewBuilder()
+	builder.SetID(constants.PreparerPodID)
+	preparerManifest := builder.GetManifest()
+	results := []consul.ManifestResult{
+		{Manifest: testManifest(t)},
+		{Manifest: preparerManifest},
+	}
+
+	testPods := make(map[string]*TestPod)
+	podFor := func(result consul.ManifestResult) (Pod, error) {
+		pod := &TestPod{haltSuccess: true}
+		testPods[result.Manifest.ID().String()] = pod
+		return pod, nil
+	}
+
+	err := p.haltAll(results, podFor, 0)
+	Assert(t).IsNil(err, "should not have erred halting pods")
+	Assert(t).AreEqual(len(testPods), 2, "expected both pods to be halted")
+	for id, pod := range testPods {
+		Assert(t).IsTrue(pod.halted, "should have halted "+id)
+		Assert(t).IsTrue(pod.forceHalted, "should have force halted "+id)
+	}
+}
+
+func TestHaltAllReportsFailedHalts(t *testing.T) {
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+
+	results := []consul.ManifestResult{{Manifest: testManifest(t)}}
+	podFor := func(consul.ManifestResult) (Pod, error) {
+		return &TestPod{haltSuccess: false}, nil
+	}
+
+	err := p.haltAll(results, podFor, 0)
+	Assert(t).IsNotNil(err, "should have erred when a pod failed to halt")
+}
+
+func TestHaltAllRespectsGracePeriod(t *testing.T) {
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+
+	results := []consul.ManifestResult{{Manifest: testManifest(t)}}
+	block := make(chan struct{})
+	defer close(block)
+	podFor := func(consul.ManifestResult) (Pod, error) {
+		return &blockingHaltPod{TestPod: &TestPod{haltSuccess: true}, block: block}, nil
+	}
+
+	err := p.haltAll(results, podFor, 10*time.Millisecond)
+	Assert(t).IsNotNil(err, "should have erred when the grace period expired")
+}
+
+func TestHaltAllHaltsPreparerAfterGracePeriod(t *testing.T) {
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+
+	builder := manifest.NewBuilder()
+	builder.SetID(constants.PreparerPodID)
+	results := []consul.ManifestResult{
+		{Manifest: testManifest(t)},
+		{Manifest: builder.GetManifest()},
+	}
+	block := make(chan struct{})
+	defer close(block)
+	preparerPod := &TestPod{haltSuccess: true}
+	podFor := func(result consul.ManifestResult) (Pod, error) {
+		if result.Manifest.ID() == constants.PreparerPodID {
+			return preparerPod, nil
+		}
+		return &blockingHaltPod{TestPod: &TestPod{haltSuccess: true}, block: block}, nil
+	}
+
+	err := p.haltAll(results, podFor, 10*time.Millisecond)
+	Assert(t).IsNotNil(err, "should have erred when the grace period expired")
+	Assert(t).IsTrue(strings.Contains(err.Error(), testManifest(t).ID().String()), "error should name the pod that was still halting: "+err.Error())
+	Assert(t).IsTrue(preparerPod.halted, "should have halted the preparer pod after the grace period")
+}
+
+func TestShutdownMarksNodeShuttingDown(t *testing.T) {
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+
+	p.client = consulutiltest.NewConsul()
+	nodeStatusStore := nodestatus.NewConsul(statusstore.NewConsul(p.client), statusstore.PreparerPodStatusNamespace)
+	p.nodeStatusStore = nodeStatusStore
+
+	err := p.MarkNodeRunning()
+	Assert(t).IsNil(err, "should not have erred marking node running")
+	status, _, err := nodeStatusStore.Get(p.node)
+	Assert(t).IsNil(err, "should have been able to read node status")
+	Assert(t).AreEqual(status.State, nodestatus.NodeRunning, "node should have been marked running")
+
+	err = p.Shutdown()
+	Assert(t).IsNil(err, "should not have erred shutting down with no pods")
+	status, _, err = nodeStatusStore.Get(p.node)
+	Assert(t).IsNil(err, "should have been able to read node status")
+	Assert(t).IsTrue(status.IsShuttingDown(), "node should have been marked as shutting down")
+}
+
+func TestShutdownKeepsStoredConditions(t *testing.T) {
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+
+	p.client = consulutiltest.NewConsul()
+	nodeStatusStore := nodestatus.NewConsul(statusstore.NewConsul(p.client), statusstore.PreparerPodStatusNamespace)
+	p.nodeStatusStore = nodeStatusStore
+
+	// Written by the running preparer, which a --shutdown process doesn't
+	// share memory with
+	err := nodeStatusStore.Set(p.node, nodestatus.Status{
+		State: nodestatus.NodeRunning,
+		Conditions: map[nodestatus.ConditionType]nodestatus.Condition{
+			nodestatus.ClockSkewed: {Since: time.Now()},
+		},
+	})
+	Assert(t).IsNil(err, "should not have erred writing node status")
+
+	err = p.Shutdown()
+	Assert(t).IsNil(err, "should not have erred shutting down with no pods")
+	status, _, err := nodeStatusStore.Get(p.node)
+	Assert(t).IsNil(err, "should have been able to read node status")
+	Assert(t).IsTrue(status.IsShuttingDown(), "node should have been marked as shutting down")
+	Assert(t).IsTrue(status.HasCondition(nodestatus.ClockSkewed), "shutting down should have kept the clock_skewed condition")
+}
+
+type blockingHaltPod struct {
+	*TestPod
+	block <-chan struct{}
+}
+
+func (b *blockingHaltPod) Halt(manifest manifest.Manifest, force bool) (bool, error) {
+	<-b.block
+	return b.TestPod.Halt(manifest, force)
+}
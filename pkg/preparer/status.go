@@ -5,8 +5,10 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/square/p2/pkg/logging"
+	p2metrics "github.com/square/p2/pkg/metrics"
 )
 
 // StatusServer exposes a unix socket server that can be queried for the health
@@ -17,12 +19,42 @@ type StatusServer struct {
 	server   *http.Server
 	logger   *logging.Logger
 	Exit     chan error
+
+	// If set, the status reports when Consul is unreachable
+	consulLiveness *ConsulLiveness
+
+	// Included in debug bundles along with goroutine stacks
+	debugSections []DebugSection
+
+	// Served in addition to the preparer's own endpoints, keyed by pattern
+	handlers map[string]http.Handler
 }
 
 func (s *StatusServer) Close() error {
 	return s.listener.Close()
 }
 
+// SetConsulLiveness makes the status server report whether the preparer is
+// degraded because Consul is unreachable. It must be called before Serve().
+func (s *StatusServer) SetConsulLiveness(liveness *ConsulLiveness) {
+	s.consulLiveness = liveness
+}
+
+// AddDebugSection includes the output of snapshot in debug bundles served at
+// /_debug/bundle, as <name>.json. It must be called before Serve().
+func (s *StatusServer) AddDebugSection(name string, snapshot func() (interface{}, error)) {
+	s.debugSections = append(s.debugSections, DebugSection{Name: name, Snapshot: snapshot})
+}
+
+// AddHandler serves handler at pattern, for endpoints of components that the
+// preparer package doesn't know about. It must be called before Serve().
+func (s *StatusServer) AddHandler(pattern string, handler http.Handler) {
+	if s.handlers == nil {
+		s.handlers = make(map[string]http.Handler)
+	}
+	s.handlers[pattern] = handler
+}
+
 var NoServerConfigured = fmt.Errorf("No status server was configured")
 
 func NewStatusServer(statusPort int, statusSocket string, logger *logging.Logger) (*StatusServer, error) {
@@ -58,8 +90,32 @@ func (s *StatusServer) Serve() {
 	defer s.Close()
 	mux := http.NewServeMux()
 	mux.HandleFunc("/_status", func(w http.ResponseWriter, r *http.Request) {
+		if degraded, since, err := s.consulLiveness.Degraded(); degraded {
+			// Still a 200: the preparer is running and will recover on its own,
+			// so supervisors shouldn't restart it
+			fmt.Fprintf(w, "p2-preparer DEGRADED: consul unreachable since %s: %s", since.Format(time.RFC3339), err)
+			return
+		}
 		fmt.Fprintf(w, "p2-preparer OK")
 	})
+	// Includes the resource usage of every pod, see ResourceUsageReporter
+	mux.HandleFunc("/_metrics", func(w http.ResponseWriter, r *http.Request) {
+		p2metrics.ExpHandler.ServeHTTP(w, r)
+	})
+
+	// A gzipped tarball of internal state for support escalations, see
+	// WriteDebugBundle
+	mux.HandleFunc("/_debug/bundle", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/gzip")
+		err := WriteDebugBundle(w, s.debugSections)
+		if err != nil {
+			s.logger.WithError(err).Warnln("Could not write debug bundle")
+		}
+	})
+
+	for pattern, handler := range s.handlers {
+		mux.Handle(pattern, handler)
+	}
 
 	s.server.Handler = mux
 	err := s.server.Serve(s.listener)
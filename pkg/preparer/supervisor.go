@@ -0,0 +1,375 @@
+package preparer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/constants"
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/restartstatus"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	defaultSupervisorInitialBackoff = time.Minute
+	defaultSupervisorMaxBackoff     = 30 * time.Minute
+	defaultSupervisorMaxRestarts    = 5
+)
+
+// SupervisorConfig configures the preparer's supervisor mode, in which it
+// restarts the launchables of pods whose health stays critical
+type SupervisorConfig struct {
+	// CriticalFor is how long a pod's liveness must have been critical
+	// before the pod is restarted
+	CriticalFor time.Duration `yaml:"critical_for"`
+
+	// InitialBackoff is how long after its first restart a pod may be
+	// restarted again at the earliest. The backoff doubles with every
+	// restart, up to MaxBackoff. They default to 1m and 30m.
+	InitialBackoff time.Duration `yaml:"initial_backoff,omitempty"`
+	MaxBackoff     time.Duration `yaml:"max_backoff,omitempty"`
+
+	// MaxRestarts is how many times a pod is restarted without becoming
+	// healthy before the supervisor gives up on it, until it is healthy
+	// again. Defaults to 5.
+	MaxRestarts int `yaml:"max_restarts,omitempty"`
+}
+
+type RestartStatusStore interface {
+	Get(node types.NodeName) (restartstatus.Status, *api.QueryMeta, error)
+	Set(node types.NodeName, status restartstatus.Status) error
+}
+
+// Supervisor restarts pods whose liveness has been critical for longer than
+// SupervisorConfig.CriticalFor. It is given the health results of the node's
+// pods through Observe, after their grace periods and blackouts are applied,
+// so pods that are starting up or in a blackout are left alone. The preparer
+// itself is never restarted.
+type Supervisor struct {
+	config  SupervisorConfig
+	restart func(podID types.PodID, logger logging.Logger) error
+	record  func(podID types.PodID, mutate func(*restartstatus.PodRestarts))
+	logger  logging.Logger
+	now     func() time.Time
+
+	mu   sync.Mutex
+	pods map[types.PodID]*supervisedPod
+}
+
+// supervisedPod is a pod that is critical or has been restarted since it was
+// last passing
+type supervisedPod struct {
+	criticalSince time.Time
+	restarts      int
+	nextRestart   time.Time // the earliest the pod may be restarted again
+	restarting    bool
+	gaveUp        bool
+}
+
+func NewSupervisor(
+	config SupervisorConfig,
+	restart func(podID types.PodID, logger logging.Logger) error,
+	record func(podID types.PodID, mutate func(*restartstatus.PodRestarts)),
+	logger logging.Logger,
+) (*Supervisor, error) {
+	if config.CriticalFor <= 0 {
+		return nil, util.Errorf("the supervisor requires a positive critical_for")
+	}
+	if config.InitialBackoff < 0 || config.MaxBackoff < 0 || config.MaxRestarts < 0 {
+		return nil, util.Errorf("the supervisor's backoffs and max_restarts can't be negative")
+	}
+	if config.InitialBackoff == 0 {
+		config.InitialBackoff = defaultSupervisorInitialBackoff
+	}
+	if config.MaxBackoff == 0 {
+		config.MaxBackoff = defaultSupervisorMaxBackoff
+	}
+	if config.MaxRestarts == 0 {
+		config.MaxRestarts = defaultSupervisorMaxRestarts
+	}
+	return &Supervisor{
+		config:  config,
+		restart: restart,
+		record:  record,
+		logger:  logger,
+		now:     time.Now,
+		pods:    make(map[types.PodID]*supervisedPod),
+	}, nil
+}
+
+// Observe is called with every health result of the node's pods. Restarts
+// happen in the background, so it doesn't block.
+func (s *Supervisor) Observe(res health.Result) {
+	if res.ID == constants.PreparerPodID {
+		return
+	}
+	status := res.LivenessStatus()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pod := s.pods[res.ID]
+	logger := s.logger.SubLogger(logrus.Fields{"pod": res.ID})
+
+	if res.Suppressed || status != health.Critical {
+		if pod == nil {
+			return
+		}
+		if status == health.Passing && !res.Suppressed && !pod.restarting {
+			logger.WithField("restarts", pod.restarts).Infoln("Supervised pod is healthy again")
+			if pod.gaveUp {
+				go s.record(res.ID, func(restarts *restartstatus.PodRestarts) {
+					restarts.GaveUp = false
+				})
+			}
+			delete(s.pods, res.ID)
+			return
+		}
+		pod.criticalSince = time.Time{}
+		return
+	}
+
+	now := s.now()
+	if pod == nil {
+		pod = &supervisedPod{}
+		s.pods[res.ID] = pod
+	}
+	if pod.criticalSince.IsZero() {
+		pod.criticalSince = now
+	}
+	if pod.restarting || pod.gaveUp || now.Sub(pod.criticalSince) < s.config.CriticalFor || now.Before(pod.nextRestart) {
+		return
+	}
+
+	if pod.restarts >= s.config.MaxRestarts {
+		pod.gaveUp = true
+		logger.WithField("restarts", pod.restarts).Errorln("Pod is still critical after the maximum number of restarts, no longer restarting it")
+		go s.record(res.ID, func(restarts *restartstatus.PodRestarts) {
+			restarts.GaveUp = true
+		})
+		return
+	}
+
+	pod.restarts++
+	pod.nextRestart = now.Add(s.backoff(pod.restarts))
+	pod.restarting = true
+	go s.restartPod(res.ID, pod.criticalSince, logger.SubLogger(logrus.Fields{"restart": pod.restarts}))
+}
+
+// backoff returns how long after the given restart the pod may be restarted
+// again
+func (s *Supervisor) backoff(restarts int) time.Duration {
+	backoff := s.config.InitialBackoff
+	for i := 1; i < restarts && backoff < s.config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > s.config.MaxBackoff {
+		backoff = s.config.MaxBackoff
+	}
+	return backoff
+}
+
+func (s *Supervisor) restartPod(podID types.PodID, criticalSince time.Time, logger logging.Logger) {
+	logger.WithField("critical_since", criticalSince).Warnln("Restarting pod whose health has been critical for too long")
+	err := s.restart(podID, logger)
+	if _, skipped := err.(restartSkippedError); skipped {
+		logger.WithError(err).Infoln("Pod restart skipped, will try again after the backoff")
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if pod, ok := s.pods[podID]; ok {
+			// a skipped restart doesn't count towards MaxRestarts
+			pod.restarts--
+			pod.restarting = false
+		}
+		return
+	}
+	restart := restartstatus.Restart{
+		Time:          s.now(),
+		CriticalSince: criticalSince,
+	}
+	if err != nil {
+		logger.WithError(err).Errorln("Could not restart pod")
+		restart.Error = err.Error()
+	}
+	s.record(podID, func(restarts *restartstatus.PodRestarts) {
+		restarts.Restarts = restartstatus.RecordRestart(restarts.Restarts, restart)
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pod, ok := s.pods[podID]; ok {
+		// the pod has to be critical for CriticalFor again to be restarted
+		pod.restarting = false
+		pod.criticalSince = time.Time{}
+	}
+}
+
+// restartSkippedError is returned by a restart that wasn't attempted because
+// the pod is being updated
+type restartSkippedError struct {
+	podID  types.PodID
+	reason string
+}
+
+func (e restartSkippedError) Error() string {
+	return fmt.Sprintf("not restarting %s, %s", e.podID, e.reason)
+}
+
+// restartRequest asks the worker of a legacy pod to restart it
+type restartRequest struct {
+	podID  types.PodID
+	logger logging.Logger
+	result chan error
+}
+
+// podWorker is how restarts reach the goroutine that handles a legacy pod's
+// manifests, see handlePods
+type podWorker struct {
+	restarts chan restartRequest
+	// closed once the worker has quit
+	done chan struct{}
+}
+
+// registerPodWorker returns the channel that restarts of the worker's pod are
+// sent to, or nil if the worker's pod can't be restarted
+func (p *Preparer) registerPodWorker(workerID podWorkerID) chan restartRequest {
+	if workerID.podUniqueKey != "" {
+		return nil
+	}
+	worker := podWorker{
+		restarts: make(chan restartRequest),
+		done:     make(chan struct{}),
+	}
+	p.podWorkersLock.Lock()
+	defer p.podWorkersLock.Unlock()
+	if p.podWorkers == nil {
+		p.podWorkers = make(map[types.PodID]podWorker)
+	}
+	p.podWorkers[workerID.podID] = worker
+	return worker.restarts
+}
+
+// unregisterPodWorkers is called once every worker has quit
+func (p *Preparer) unregisterPodWorkers() {
+	p.podWorkersLock.Lock()
+	defer p.podWorkersLock.Unlock()
+	for podID, worker := range p.podWorkers {
+		close(worker.done)
+		delete(p.podWorkers, podID)
+	}
+}
+
+// restartPod has the worker of a legacy pod restart it, so that restarts
+// never overlap with the pod being installed or removed
+func (p *Preparer) restartPod(podID types.PodID, logger logging.Logger) error {
+	p.podWorkersLock.Lock()
+	worker, ok := p.podWorkers[podID]
+	p.podWorkersLock.Unlock()
+	if !ok {
+		return util.Errorf("%s is not handled by this preparer", podID)
+	}
+
+	req := restartRequest{
+		podID:  podID,
+		logger: logger,
+		result: make(chan error, 1),
+	}
+	select {
+	case worker.restarts <- req:
+	case <-worker.done:
+		return util.Errorf("the preparer is no longer handling %s", podID)
+	}
+	return <-req.result
+}
+
+// restartInstalledPod halts and relaunches the launchables of a legacy pod as
+// described by its reality manifest, the way p2-restart does. It is only
+// called by the pod's worker while it has no update of the pod to handle, and
+// does nothing if the pod's intent differs from its reality, since the
+// pod is then about to be updated.
+func (p *Preparer) restartInstalledPod(podID types.PodID, logger logging.Logger) error {
+	man, _, err := p.store.Pod(consul.REALITY_TREE, p.node, podID)
+	if err != nil {
+		return util.Errorf("could not read the reality manifest of %s: %s", podID, err)
+	}
+	intent, _, err := p.store.Pod(consul.INTENT_TREE, p.node, podID)
+	if err != nil {
+		return util.Errorf("could not read the intent manifest of %s: %s", podID, err)
+	}
+	realitySHA, err := man.SHA()
+	if err != nil {
+		return err
+	}
+	intentSHA, err := intent.SHA()
+	if err != nil {
+		return err
+	}
+	if intentSHA != realitySHA {
+		return restartSkippedError{podID: podID, reason: "its intent differs from its reality so it is about to be updated"}
+	}
+
+	if p.updateSlots != nil {
+		release, err := p.updateSlots.acquire(podID)
+		if err != nil {
+			return util.Errorf("could not acquire node update slot: %s", err)
+		}
+		defer release()
+	}
+
+	pod := p.podFactory.NewLegacyPod(podID)
+	p.configurePod(pod)
+
+	// let the pod manifest decide which launchables to actually stop
+	ok, err := pod.Halt(man, false)
+	if err != nil {
+		return util.Errorf("could not halt pod: %s", err)
+	} else if !ok {
+		logger.NoFields().Warnln("One or more launchables did not halt successfully")
+	}
+
+	ok, err = pod.Launch(man)
+	if err != nil {
+		return util.Errorf("could not launch pod: %s", err)
+	} else if !ok {
+		return util.Errorf("one or more launchables did not launch successfully")
+	}
+	return nil
+}
+
+// recordRestart applies mutate to the recorded restarts of a pod. Failures are
+// logged but otherwise ignored.
+func (p *Preparer) recordRestart(podID types.PodID, mutate func(*restartstatus.PodRestarts)) {
+	if p.restartStatusStore == nil {
+		return
+	}
+	logger := p.Logger.SubLogger(logrus.Fields{"pod": podID})
+
+	// restarts of every pod share this node's status
+	p.restartStatusLock.Lock()
+	defer p.restartStatusLock.Unlock()
+	status, _, err := p.restartStatusStore.Get(p.node)
+	switch {
+	case statusstore.IsNoStatus(err):
+	case err != nil:
+		logger.WithError(err).Warnln("Could not read pod restarts")
+		return
+	}
+	if status.Pods == nil {
+		status.Pods = make(map[types.PodID]restartstatus.PodRestarts)
+	}
+	restarts := status.Pods[podID]
+	mutate(&restarts)
+	status.Pods[podID] = restarts
+
+	err = p.restartStatusStore.Set(p.node, status)
+	if err != nil {
+		logger.WithError(err).Warnln("Could not write pod restarts")
+	}
+}
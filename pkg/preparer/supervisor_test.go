@@ -0,0 +1,280 @@
+package preparer
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/statusstore/restartstatus"
+	"github.com/square/p2/pkg/types"
+)
+
+type supervisorFixture struct {
+	supervisor *Supervisor
+	now        time.Time
+	restarts   chan types.PodID
+	restartErr error
+
+	mu       sync.Mutex
+	recorded map[types.PodID]restartstatus.PodRestarts
+}
+
+func newSupervisorFixture(t *testing.T, config SupervisorConfig) *supervisorFixture {
+	f := &supervisorFixture{
+		now:      time.Now(),
+		restarts: make(chan types.PodID, 10),
+		recorded: make(map[types.PodID]restartstatus.PodRestarts),
+	}
+	restart := func(podID types.PodID, logger logging.Logger) error {
+		f.restarts <- podID
+		return f.restartErr
+	}
+	record := func(podID types.PodID, mutate func(*restartstatus.PodRestarts)) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		restarts := f.recorded[podID]
+		mutate(&restarts)
+		f.recorded[podID] = restarts
+	}
+	supervisor, err := NewSupervisor(config, restart, record, logging.TestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	supervisor.now = func() time.Time { return f.now }
+	f.supervisor = supervisor
+	return f
+}
+
+// observe advances the clock by elapsed and gives the supervisor a result of web
+func (f *supervisorFixture) observe(elapsed time.Duration, res health.Result) {
+	f.now = f.now.Add(elapsed)
+	res.ID = "web"
+	f.supervisor.Observe(res)
+}
+
+// expectRestart waits for a restart of web to be done or, if restarted is
+// false, checks that none was started
+func (f *supervisorFixture) expectRestart(t *testing.T, restarted bool) {
+	if !restarted {
+		select {
+		case <-f.restarts:
+			t.Fatal("expected web not to be restarted")
+		default:
+		}
+		return
+	}
+	select {
+	case <-f.restarts:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for web to be restarted")
+	}
+	// wait for the restart to be recorded and finished
+	for i := 0; i < 500; i++ {
+		f.supervisor.mu.Lock()
+		pod := f.supervisor.pods["web"]
+		restarting := pod != nil && pod.restarting
+		f.supervisor.mu.Unlock()
+		if !restarting {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timed out waiting for the restart of web to finish")
+}
+
+func (f *supervisorFixture) podRestarts() restartstatus.PodRestarts {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.recorded["web"]
+}
+
+func TestSupervisorRestartsPodsCriticalForTooLong(t *testing.T) {
+	f := newSupervisorFixture(t, SupervisorConfig{
+		CriticalFor:    time.Minute,
+		InitialBackoff: 2 * time.Minute,
+		MaxRestarts:    2,
+	})
+	critical := health.Result{Status: health.Critical}
+
+	f.observe(0, critical)
+	f.observe(30*time.Second, critical)
+	f.expectRestart(t, false)
+	f.observe(30*time.Second, critical)
+	f.expectRestart(t, true)
+	if restarts := f.podRestarts().Restarts; len(restarts) != 1 || restarts[0].Error != "" {
+		t.Fatalf("expected a successful restart to be recorded, got %+v", restarts)
+	}
+
+	// it has to be critical for a minute again, and the backoff has to pass
+	f.observe(0, critical)
+	f.observe(time.Minute, critical)
+	f.expectRestart(t, false)
+	f.observe(time.Minute, critical)
+	f.expectRestart(t, true)
+
+	// the circuit breaker trips after 2 restarts
+	f.observe(0, critical)
+	f.observe(time.Hour, critical)
+	f.expectRestart(t, false)
+	f.observe(time.Hour, critical)
+	f.expectRestart(t, false)
+	for i := 0; i < 500 && !f.podRestarts().GaveUp; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if restarts := f.podRestarts(); !restarts.GaveUp || len(restarts.Restarts) != 2 {
+		t.Fatalf("expected the supervisor to give up after 2 restarts, got %+v", restarts)
+	}
+
+	// passing resets the pod
+	f.observe(time.Minute, health.Result{Status: health.Passing})
+	for i := 0; i < 500 && f.podRestarts().GaveUp; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if f.podRestarts().GaveUp {
+		t.Error("expected the supervisor to stop giving up on web once it's healthy")
+	}
+	f.observe(0, critical)
+	f.observe(time.Minute, critical)
+	f.expectRestart(t, true)
+}
+
+func TestSupervisorIgnoresResultsThatArentCritical(t *testing.T) {
+	f := newSupervisorFixture(t, SupervisorConfig{CriticalFor: time.Minute})
+
+	// a blip of another status restarts the clock
+	f.observe(0, health.Result{Status: health.Critical})
+	f.observe(50*time.Second, health.Result{Status: health.Unknown})
+	f.observe(0, health.Result{Status: health.Critical})
+	f.observe(50*time.Second, health.Result{Status: health.Critical})
+	f.expectRestart(t, false)
+
+	// suppressed results are expected downtime
+	f.observe(time.Hour, health.Result{Status: health.Critical, Suppressed: true})
+	f.expectRestart(t, false)
+
+	// pods that are alive but not ready aren't restarted
+	f.observe(0, health.Result{Status: health.Critical, Readiness: health.Critical, Liveness: health.Passing})
+	f.observe(time.Hour, health.Result{Status: health.Critical, Readiness: health.Critical, Liveness: health.Passing})
+	f.expectRestart(t, false)
+
+	// neither is the preparer
+	f.supervisor.Observe(health.Result{ID: "p2-preparer", Status: health.Critical})
+	f.now = f.now.Add(time.Hour)
+	f.supervisor.Observe(health.Result{ID: "p2-preparer", Status: health.Critical})
+	f.expectRestart(t, false)
+}
+
+func TestSupervisorRecordsFailedRestarts(t *testing.T) {
+	f := newSupervisorFixture(t, SupervisorConfig{CriticalFor: time.Minute})
+	f.restartErr = errors.New("could not launch pod")
+
+	f.observe(0, health.Result{Status: health.Critical})
+	f.observe(time.Minute, health.Result{Status: health.Critical})
+	f.expectRestart(t, true)
+	if restarts := f.podRestarts().Restarts; len(restarts) != 1 || restarts[0].Error != "could not launch pod" {
+		t.Errorf("expected the failed restart to be recorded, got %+v", restarts)
+	}
+}
+
+func TestSupervisorBackoff(t *testing.T) {
+	supervisor, err := NewSupervisor(SupervisorConfig{CriticalFor: time.Minute, InitialBackoff: time.Minute, MaxBackoff: 5 * time.Minute}, nil, nil, logging.TestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for restarts, expected := range map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 3: 4 * time.Minute, 4: 5 * time.Minute, 20: 5 * time.Minute} {
+		if backoff := supervisor.backoff(restarts); backoff != expected {
+			t.Errorf("expected a backoff of %s after %d restarts, got %s", expected, restarts, backoff)
+		}
+	}
+
+	_, err = NewSupervisor(SupervisorConfig{}, nil, nil, logging.TestLogger())
+	if err == nil {
+		t.Error("expected a supervisor without critical_for to be invalid")
+	}
+}
+
+func TestSupervisorDoesNotCountSkippedRestarts(t *testing.T) {
+	f := newSupervisorFixture(t, SupervisorConfig{CriticalFor: time.Minute, InitialBackoff: time.Minute, MaxRestarts: 1})
+	f.restartErr = restartSkippedError{podID: "web", reason: "an update of it is in progress"}
+
+	f.observe(0, health.Result{Status: health.Critical})
+	for i := 0; i < 3; i++ {
+		f.observe(time.Minute, health.Result{Status: health.Critical})
+		f.expectRestart(t, true)
+	}
+	if restarts := f.podRestarts(); len(restarts.Restarts) != 0 || restarts.GaveUp {
+		t.Errorf("expected skipped restarts not to be recorded or to make the supervisor give up, got %+v", restarts)
+	}
+}
+
+func TestRestartPodGoesThroughWorker(t *testing.T) {
+	p := &Preparer{}
+	if err := p.restartPod("web", logging.TestLogger()); err == nil {
+		t.Error("expected restarting a pod without a worker to fail")
+	}
+	if restarts := p.registerPodWorker(podWorkerID{podID: "web", podUniqueKey: "abc"}); restarts != nil {
+		t.Error("expected uuid pods not to be restartable")
+	}
+
+	restarts := p.registerPodWorker(podWorkerID{podID: "web"})
+	go func() {
+		req := <-restarts
+		req.result <- restartSkippedError{podID: req.podID, reason: "an update of it is in progress"}
+	}()
+	err := p.restartPod("web", logging.TestLogger())
+	if _, ok := err.(restartSkippedError); !ok {
+		t.Errorf("expected the worker's result, got %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- p.restartPod("web", logging.TestLogger())
+	}()
+	p.podWorkersLock.Lock()
+	worker := p.podWorkers["web"]
+	p.podWorkersLock.Unlock()
+	close(worker.done)
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("expected restarting a pod whose worker quit to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("restartPod blocked on a worker that quit")
+	}
+}
+
+type intentAndRealityStore struct {
+	FakeStore
+	intent, reality manifest.Manifest
+}
+
+func (s *intentAndRealityStore) Pod(prefix consul.PodPrefix, _ types.NodeName, _ types.PodID) (manifest.Manifest, time.Duration, error) {
+	if prefix == consul.INTENT_TREE {
+		return s.intent, 0, nil
+	}
+	return s.reality, 0, nil
+}
+
+func TestRestartInstalledPodSkipsPodsAboutToBeUpdated(t *testing.T) {
+	builder := manifest.NewBuilder()
+	builder.SetID("web")
+	reality := builder.GetManifest()
+	builder = reality.GetBuilder()
+	err := builder.SetConfig(map[interface{}]interface{}{"version": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	intent := builder.GetManifest()
+
+	p := &Preparer{node: "hostname", store: &intentAndRealityStore{intent: intent, reality: reality}}
+	err = p.restartInstalledPod("web", logging.TestLogger())
+	if _, ok := err.(restartSkippedError); !ok {
+		t.Errorf("expected a pod whose intent differs from its reality not to be restarted, got %v", err)
+	}
+}
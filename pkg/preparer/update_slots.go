@@ -0,0 +1,135 @@
+package preparer
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+var errNoUpdateSlot = util.Errorf("all update slots for this node are in use")
+
+// updateSlots bounds the number of pods that may be halted and relaunched on a
+// node at the same time. This keeps independent deploys of different pod IDs
+// that happen to share a node from restarting everything on it at once.
+//
+// Each slot is a consul lock under consul.NodeUpdateLockPath(), so the pods
+// that are currently converging are visible to operators and tooling. All
+// slots are locked using a single session that is held for the life of the
+// preparer, and since consul lets a session re-acquire a lock it already
+// holds, slots in use by this process are also tracked locally.
+type updateSlots struct {
+	node       types.NodeName
+	limit      int
+	newSession func(name string) (consul.Session, chan error, error)
+	logger     logging.Logger
+
+	mu           sync.Mutex
+	session      consul.Session
+	renewalErrCh chan error
+	held         map[int]consul.Unlocker
+}
+
+func newUpdateSlots(
+	node types.NodeName,
+	limit int,
+	newSession func(name string) (consul.Session, chan error, error),
+	logger logging.Logger,
+) *updateSlots {
+	return &updateSlots{
+		node:       node,
+		limit:      limit,
+		newSession: newSession,
+		logger:     logger,
+		held:       make(map[int]consul.Unlocker),
+	}
+}
+
+// acquire claims a free update slot on behalf of podID. It returns
+// errNoUpdateSlot without blocking if every slot is in use, in which case the
+// caller is expected to retry later. The returned function releases the slot.
+func (u *updateSlots) acquire(podID types.PodID) (func(), error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	err := u.ensureSession()
+	if err != nil {
+		return nil, err
+	}
+
+	for slot := 0; slot < u.limit; slot++ {
+		if _, ok := u.held[slot]; ok {
+			continue
+		}
+
+		unlocker, err := u.session.Lock(consul.NodeUpdateLockPath(u.node, slot))
+		switch {
+		case consul.IsAlreadyLocked(err):
+			continue
+		case err != nil:
+			return nil, err
+		}
+
+		u.held[slot] = unlocker
+		session := u.session
+		return func() { u.release(session, slot, podID) }, nil
+	}
+
+	return nil, errNoUpdateSlot
+}
+
+func (u *updateSlots) release(session consul.Session, slot int, podID types.PodID) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if session != u.session {
+		// The session was lost while the update was in progress, taking
+		// the lock with it
+		return
+	}
+
+	unlocker, ok := u.held[slot]
+	if !ok {
+		return
+	}
+	delete(u.held, slot)
+
+	err := unlocker.Unlock()
+	if err != nil {
+		u.logger.WithErrorAndFields(err, logrus.Fields{
+			"pod":  podID,
+			"slot": slot,
+		}).Errorln("Could not release node update slot")
+	}
+}
+
+// ensureSession must be called with u.mu held
+func (u *updateSlots) ensureSession() error {
+	if u.session != nil {
+		select {
+		case err, ok := <-u.renewalErrCh:
+			if ok && err != nil {
+				u.logger.WithError(err).Warnln("Lost session for node update slots, creating a new one")
+			}
+			// locks are released with the session because they are
+			// created with the delete behavior
+			u.session = nil
+			u.held = make(map[int]consul.Unlocker)
+		default:
+			return nil
+		}
+	}
+
+	session, renewalErrCh, err := u.newSession(fmt.Sprintf("p2-preparer update slots for %s", u.node))
+	if err != nil {
+		return util.Errorf("could not create session for node update slots: %s", err)
+	}
+	u.session = session
+	u.renewalErrCh = renewalErrCh
+	return nil
+}
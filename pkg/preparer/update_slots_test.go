@@ -0,0 +1,58 @@
+package preparer
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/consultest"
+)
+
+func newTestUpdateSlots(limit int) *updateSlots {
+	newSession := func(string) (consul.Session, chan error, error) {
+		return consultest.NewSession(), make(chan error), nil
+	}
+	return newUpdateSlots("node1", limit, newSession, logging.DefaultLogger)
+}
+
+func TestUpdateSlotsLimitConcurrentUpdates(t *testing.T) {
+	slots := newTestUpdateSlots(2)
+
+	releaseA, err := slots.acquire("a")
+	if err != nil {
+		t.Fatalf("unexpected error acquiring first slot: %s", err)
+	}
+	_, err = slots.acquire("b")
+	if err != nil {
+		t.Fatalf("unexpected error acquiring second slot: %s", err)
+	}
+
+	_, err = slots.acquire("c")
+	if err != errNoUpdateSlot {
+		t.Fatalf("expected errNoUpdateSlot when all slots are in use, got %v", err)
+	}
+
+	releaseA()
+	_, err = slots.acquire("c")
+	if err != nil {
+		t.Fatalf("expected to acquire a slot after one was released, got %s", err)
+	}
+}
+
+func TestUpdateSlotsRecoverFromLostSession(t *testing.T) {
+	slots := newTestUpdateSlots(1)
+
+	_, err := slots.acquire("a")
+	if err != nil {
+		t.Fatalf("unexpected error acquiring slot: %s", err)
+	}
+
+	// Simulate a renewal failure, which destroys the session and the
+	// locks it held
+	close(slots.renewalErrCh)
+
+	_, err = slots.acquire("b")
+	if err != nil {
+		t.Fatalf("expected to acquire a slot with a new session, got %s", err)
+	}
+}
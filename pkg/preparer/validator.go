@@ -0,0 +1,126 @@
+package preparer
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/store/consul/statusstore/intentstatus"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// Caps how much of a validator's response body is read as a rejection reason
+const maxRejectionReasonBytes = 4096
+
+// IntentValidator is consulted before the preparer enacts a new or changed
+// intent manifest. It may reject the change, e.g. because of a policy or
+// capacity check, in which case the pod is left as it is.
+type IntentValidator interface {
+	// Validate returns an IntentRejectedError if the change should not be
+	// enacted. Any other error means that no decision could be made and
+	// validation should be retried.
+	Validate(node types.NodeName, pair ManifestPair) error
+}
+
+// IntentRejectedError is returned by an IntentValidator that rejected an
+// intent change.
+type IntentRejectedError struct {
+	Reason string
+}
+
+func (e IntentRejectedError) Error() string {
+	return "intent change was rejected: " + e.Reason
+}
+
+func IsIntentRejected(err error) bool {
+	_, ok := err.(IntentRejectedError)
+	return ok
+}
+
+// IntentStatusStore records the intents rejected for the legacy pods on a node
+type IntentStatusStore interface {
+	Get(node types.NodeName) (intentstatus.Status, *api.QueryMeta, error)
+	Set(node types.NodeName, status intentstatus.Status) error
+}
+
+// The body POSTed to an HTTP intent validator
+type intentValidationRequest struct {
+	Node         types.NodeName     `json:"node"`
+	PodID        types.PodID        `json:"pod_id"`
+	PodUniqueKey types.PodUniqueKey `json:"pod_unique_key,omitempty"`
+
+	// The manifest that would be enacted
+	Intent string `json:"intent"`
+	// The manifest that is currently running, if any
+	Reality string `json:"reality,omitempty"`
+}
+
+type httpIntentValidator struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPIntentValidator returns an IntentValidator that POSTs a JSON
+// description of each intent change to url. The validator may run on the
+// node itself or remotely. A 2xx response accepts the change, a 4xx response
+// rejects it with the response body as the reason, and anything else is
+// treated as a failure to validate.
+func NewHTTPIntentValidator(url string, client *http.Client) IntentValidator {
+	return httpIntentValidator{
+		url:    url,
+		client: client,
+	}
+}
+
+func (v httpIntentValidator) Validate(node types.NodeName, pair ManifestPair) error {
+	req := intentValidationRequest{
+		Node:         node,
+		PodID:        pair.ID,
+		PodUniqueKey: pair.PodUniqueKey,
+	}
+
+	intentBytes, err := pair.Intent.Marshal()
+	if err != nil {
+		return util.Errorf("could not marshal intent manifest: %s", err)
+	}
+	req.Intent = string(intentBytes)
+
+	if pair.Reality != nil {
+		realityBytes, err := pair.Reality.Marshal()
+		if err != nil {
+			return util.Errorf("could not marshal reality manifest: %s", err)
+		}
+		req.Reality = string(realityBytes)
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return util.Errorf("could not marshal intent validation request: %s", err)
+	}
+
+	resp, err := v.client.Post(v.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return util.Errorf("could not reach intent validator at %s: %s", v.url, err)
+	}
+	defer resp.Body.Close()
+
+	reason, err := ioutil.ReadAll(&io.LimitedReader{R: resp.Body, N: maxRejectionReasonBytes})
+	if err != nil {
+		return util.Errorf("could not read response from intent validator: %s", err)
+	}
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return IntentRejectedError{Reason: strings.TrimSpace(string(reason))}
+	default:
+		return util.Errorf("intent validator at %s responded with %s", v.url, resp.Status)
+	}
+}
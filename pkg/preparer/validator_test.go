@@ -0,0 +1,164 @@
+package preparer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/hashicorp/consul/api"
+	"github.com/square/p2/pkg/constants"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/intentstatus"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+func TestHTTPIntentValidator(t *testing.T) {
+	var received intentValidationRequest
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := json.NewDecoder(r.Body).Decode(&received)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("not enough capacity\n"))
+	}))
+	defer server.Close()
+
+	manifest := testManifest(t)
+	pair := ManifestPair{ID: manifest.ID(), Intent: manifest}
+	validator := NewHTTPIntentValidator(server.URL, http.DefaultClient)
+
+	err := validator.Validate("node1", pair)
+	Assert(t).IsNil(err, "should have accepted the change on a 200")
+	Assert(t).AreEqual(received.Node, types.NodeName("node1"), "did not send node name")
+	Assert(t).AreEqual(received.PodID, manifest.ID(), "did not send pod ID")
+	Assert(t).AreNotEqual(received.Intent, "", "did not send intent manifest")
+	Assert(t).AreEqual(received.Reality, "", "should not have sent a reality manifest")
+
+	status = http.StatusForbidden
+	err = validator.Validate("node1", pair)
+	Assert(t).IsTrue(IsIntentRejected(err), "should have rejected the change on a 403")
+	Assert(t).AreEqual(err.(IntentRejectedError).Reason, "not enough capacity", "unexpected rejection reason")
+
+	status = http.StatusServiceUnavailable
+	err = validator.Validate("node1", pair)
+	Assert(t).IsNotNil(err, "should have erred on a 503")
+	Assert(t).IsFalse(IsIntentRejected(err), "a 503 should not be a rejection")
+}
+
+type fakeIntentValidator struct {
+	err error
+}
+
+func (f fakeIntentValidator) Validate(types.NodeName, ManifestPair) error {
+	return f.err
+}
+
+func TestPreparerWillNotLaunchRejectedIntent(t *testing.T) {
+	testPod := &TestPod{launchSuccess: true}
+	newManifest := testManifest(t)
+	newPair := ManifestPair{
+		ID:     newManifest.ID(),
+		Intent: newManifest,
+	}
+
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	p.intentValidator = fakeIntentValidator{err: IntentRejectedError{Reason: "policy violation"}}
+
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsTrue(success, "a rejected change should not be retried")
+	Assert(t).IsFalse(testPod.installed, "should not have installed a rejected pod")
+	Assert(t).IsFalse(testPod.launched, "should not have launched a rejected pod")
+}
+
+func TestPreparerRetriesWhenValidatorUnavailable(t *testing.T) {
+	testPod := &TestPod{launchSuccess: true}
+	newManifest := testManifest(t)
+	newPair := ManifestPair{
+		ID:     newManifest.ID(),
+		Intent: newManifest,
+	}
+
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	p.intentValidator = fakeIntentValidator{err: util.Errorf("connection refused")}
+
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsFalse(success, "should have failed so that validation is retried")
+	Assert(t).IsFalse(testPod.launched, "should not have launched an unvalidated pod")
+}
+
+func TestPreparerDoesNotValidateItself(t *testing.T) {
+	builder := manifest.NewBuilder()
+	builder.SetID(constants.PreparerPodID)
+	preparerManifest := builder.GetManifest()
+	newPair := ManifestPair{
+		ID:     preparerManifest.ID(),
+		Intent: preparerManifest,
+	}
+	testPod := &TestPod{launchSuccess: true}
+
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	p.intentValidator = fakeIntentValidator{err: IntentRejectedError{Reason: "policy violation"}}
+
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsTrue(success, "the preparer should be able to update itself")
+	Assert(t).IsTrue(testPod.launched, "the preparer should have been launched despite the validator")
+}
+
+type fakeIntentStatusStore struct {
+	statuses map[types.NodeName]intentstatus.Status
+}
+
+func (f *fakeIntentStatusStore) Get(node types.NodeName) (intentstatus.Status, *api.QueryMeta, error) {
+	status, ok := f.statuses[node]
+	if !ok {
+		return intentstatus.Status{}, nil, statusstore.NoStatusError{}
+	}
+	return status, nil, nil
+}
+
+func (f *fakeIntentStatusStore) Set(node types.NodeName, status intentstatus.Status) error {
+	f.statuses[node] = status
+	return nil
+}
+
+func TestPreparerRecordsIntentRejectionsOfLegacyPods(t *testing.T) {
+	testPod := &TestPod{launchSuccess: true}
+	newManifest := testManifest(t)
+	newPair := ManifestPair{
+		ID:     newManifest.ID(),
+		Intent: newManifest,
+	}
+
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	statuses := &fakeIntentStatusStore{statuses: map[types.NodeName]intentstatus.Status{}}
+	p.intentStatusStore = statuses
+	p.intentValidator = fakeIntentValidator{err: IntentRejectedError{Reason: "policy violation"}}
+
+	p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	rejection, ok := statuses.statuses[p.node].Pods[newPair.ID]
+	Assert(t).IsTrue(ok, "should have recorded the rejection for the node")
+	Assert(t).AreEqual(rejection.Reason, "policy violation", "unexpected rejection reason")
+
+	p.intentValidator = fakeIntentValidator{}
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsTrue(success, "should have launched the accepted pod")
+	_, ok = statuses.statuses[p.node].Pods[newPair.ID]
+	Assert(t).IsFalse(ok, "should have cleared the rejection once the pod launched")
+}
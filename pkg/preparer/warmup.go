@@ -0,0 +1,79 @@
+package preparer
+
+import (
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/rc/fields"
+)
+
+// RCLister lists every replication controller, to find the ones a newly
+// joined node is eligible for
+type RCLister interface {
+	List() ([]fields.RC, error)
+}
+
+// NodeLabelReader reads the labels of this node
+type NodeLabelReader interface {
+	GetLabels(labelType labels.Type, id string) (labels.Labeled, error)
+}
+
+// warmUpArtifacts prefetches the launchables of every replication controller
+// whose node selector matches this node, so that whichever of them is
+// scheduled here first doesn't have to wait for downloads. Failures to
+// prefetch a manifest are only logged, since the node may never be
+// scheduled it. Returns false if the node's labels or the replication
+// controllers couldn't be read, in which case warming up should be retried
+// later.
+func (p *Preparer) warmUpArtifacts(quit <-chan struct{}) bool {
+	labeled, err := p.nodeLabels.GetLabels(labels.NODE, p.node.String())
+	if err != nil {
+		p.Logger.WithError(err).Errorln("Could not read node labels to warm up artifacts")
+		return false
+	}
+	rcs, err := p.warmUpRCs.List()
+	if err != nil {
+		p.Logger.WithError(err).Errorln("Could not list replication controllers to warm up artifacts")
+		return false
+	}
+
+	manifests := warmUpManifests(rcs, labeled)
+	p.Logger.WithField("pods", len(manifests)).Infoln("Warming up artifacts of replication controllers this node is eligible for")
+	for _, man := range manifests {
+		select {
+		case <-quit:
+			return false
+		default:
+		}
+		logger := p.Logger.SubLogger(logrus.Fields{"pod": man.ID()})
+		result := p.prefetch(man, p.podFactory.NewLegacyPod(man.ID()), logger)
+		if result.Error != "" {
+			logger.WithField("error", result.Error).Warnln("Could not warm up artifacts")
+		}
+	}
+	return true
+}
+
+// warmUpManifests returns the manifests of the enabled replication
+// controllers with replicas whose node selector matches the node, without
+// duplicates
+func warmUpManifests(rcs []fields.RC, node labels.Labeled) []manifest.Manifest {
+	var manifests []manifest.Manifest
+	seen := make(map[string]bool)
+	for _, rc := range rcs {
+		if rc.Disabled || rc.ReplicasDesired == 0 || rc.Manifest == nil {
+			continue
+		}
+		if rc.NodeSelector == nil || !rc.NodeSelector.Matches(node.Labels) {
+			continue
+		}
+		sha, err := rc.Manifest.SHA()
+		if err != nil || seen[sha] {
+			continue
+		}
+		seen[sha] = true
+		manifests = append(manifests, rc.Manifest)
+	}
+	return manifests
+}
@@ -0,0 +1,36 @@
+package preparer
+
+import (
+	"testing"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/rc/fields"
+)
+
+func TestWarmUpManifests(t *testing.T) {
+	man := testManifest(t)
+	builder := man.GetBuilder()
+	builder.SetID("other")
+	other := builder.GetManifest()
+
+	node := labels.Labeled{
+		ID:        "hostname",
+		LabelType: labels.NODE,
+		Labels:    klabels.Set{"pool": "web"},
+	}
+	web := klabels.SelectorFromSet(klabels.Set{"pool": "web"})
+	rcs := []fields.RC{
+		{ID: "matches", Manifest: man, NodeSelector: web, ReplicasDesired: 2},
+		{ID: "duplicate", Manifest: man, NodeSelector: web, ReplicasDesired: 1},
+		{ID: "other-pool", Manifest: other, NodeSelector: klabels.SelectorFromSet(klabels.Set{"pool": "db"}), ReplicasDesired: 2},
+		{ID: "disabled", Manifest: other, NodeSelector: web, ReplicasDesired: 2, Disabled: true},
+		{ID: "no-replicas", Manifest: other, NodeSelector: web},
+	}
+
+	manifests := warmUpManifests(rcs, node)
+	if len(manifests) != 1 || manifests[0].ID() != man.ID() {
+		t.Errorf("Expected only the manifest of the enabled, matching replication controllers once, got %v", manifests)
+	}
+}
@@ -0,0 +1,129 @@
+package rc
+
+import (
+	"reflect"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/scheduler"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/rcstatus"
+	"github.com/square/p2/pkg/types"
+)
+
+// reportDryRun computes the changes meetDesires would make and records them
+// in the RC's status without making any of them. This makes it possible to
+// see the effect of e.g. a node selector or label change across a whole
+// cluster before letting the RCs act on it.
+func (rc *replicationController) reportDryRun(rcFields fields.RC, current types.PodLocations, eligible []types.NodeName) error {
+	plan, err := rc.planDesires(rcFields, current, eligible)
+	if err != nil {
+		return err
+	}
+
+	if plan.HasChanges() {
+		rc.logger.WithFields(logrus.Fields{
+			"schedule":   plan.Schedule,
+			"unschedule": plan.Unschedule,
+			"update":     plan.Update,
+			"ineligible": plan.Ineligible,
+			"shortfall":  plan.Shortfall,
+		}).Infoln("Dry run: RC would change its pods")
+	} else {
+		rc.logger.NoFields().Infoln("Dry run: RC would take no action")
+	}
+
+	status, _, err := rc.rcStatusStore.Get(rc.rcID)
+	if err != nil && !statusstore.IsNoStatus(err) {
+		return err
+	}
+	if status.DryRun != nil && reflect.DeepEqual(*status.DryRun, plan) {
+		return nil
+	}
+
+	status.DryRun = &plan
+	return rc.rcStatusStore.Set(rc.rcID, status)
+}
+
+// planDesires mirrors the decisions made by meetDesires, addPods, removePods,
+// checkForIneligible and ensureConsistency, including skipping cordoned and
+// critical nodes when scheduling. Where meetDesires picks arbitrarily among ineligible
+// nodes to unschedule, the plan picks them in sorted order.
+func (rc *replicationController) planDesires(rcFields fields.RC, current types.PodLocations, eligible []types.NodeName) (rcstatus.DryRun, error) {
+	var plan rcstatus.DryRun
+	if rcFields.Disabled {
+		return plan, nil
+	}
+
+	rc.nodeTransferMu.Lock()
+	oldNodeInNodeTransfer := rc.nodeTransfer.oldNode
+	newNodeInNodeTransfer := rc.nodeTransfer.newNode
+	rc.nodeTransferMu.Unlock()
+
+	currentNodes := current.Nodes()
+	currentSet := types.NewNodeSet(currentNodes...)
+	eligibleSet := types.NewNodeSet(eligible...)
+
+	switch {
+	case rcFields.ReplicasDesired > len(currentNodes):
+		cordoned, err := scheduler.CordonedNodes(rc.podApplicator)
+		if err != nil {
+			return rcstatus.DryRun{}, err
+		}
+		possible := eligibleSet.Difference(currentSet).Difference(cordoned)
+		possible = possible.Difference(rc.criticalNodes(possible.ListNodes()))
+		if newNodeInNodeTransfer != "" {
+			possible = possible.Difference(types.NewNodeSet(newNodeInNodeTransfer))
+		}
+		possibleSorted := possible.ListNodes()
+		toSchedule := rcFields.ReplicasDesired - len(currentNodes)
+		if toSchedule > len(possibleSorted) {
+			plan.Shortfall = toSchedule - len(possibleSorted)
+			toSchedule = len(possibleSorted)
+		}
+		if toSchedule > 0 {
+			plan.Schedule = possibleSorted[:toSchedule]
+		}
+	case len(currentNodes) > rcFields.ReplicasDesired:
+		ineligible := currentSet.Difference(eligibleSet)
+		rest := currentSet.Difference(ineligible)
+		candidates := append(ineligible.ListNodes(), rest.ListNodes()...)
+		toUnschedule := len(currentNodes) - rcFields.ReplicasDesired
+		for _, node := range candidates[:toUnschedule] {
+			// removePods exempts nodes that are part of a node transfer
+			// without unscheduling another one in their place
+			if node == oldNodeInNodeTransfer || node == newNodeInNodeTransfer {
+				continue
+			}
+			plan.Unschedule = append(plan.Unschedule, node)
+		}
+	}
+
+	remaining := currentSet.Difference(types.NewNodeSet(plan.Unschedule...))
+	for _, node := range remaining.Difference(eligibleSet).ListNodes() {
+		plan.Ineligible = append(plan.Ineligible, node)
+	}
+
+	manifestSHA, err := rcFields.Manifest.SHA()
+	if err != nil {
+		return rcstatus.DryRun{}, err
+	}
+	for _, node := range remaining.Intersection(eligibleSet).ListNodes() {
+		intent, _, err := rc.consulStore.Pod(consul.INTENT_TREE, node, rcFields.Manifest.ID())
+		if err != nil && err != pods.NoCurrentManifest {
+			return rcstatus.DryRun{}, err
+		}
+		if intent != nil {
+			intentSHA, err := intent.SHA()
+			if err == nil && intentSHA == manifestSHA {
+				continue
+			}
+		}
+		plan.Update = append(plan.Update, node)
+	}
+
+	return plan, nil
+}
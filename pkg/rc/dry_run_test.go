@@ -0,0 +1,133 @@
+// +build !race
+
+package rc
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestDryRunSchedulesNothing(t *testing.T) {
+	rcStore, consulStore, applicator, rc, _, _, rcStatusStore, closeFn := setup(t)
+	defer closeFn()
+	rc.dryRun = true
+
+	for _, node := range []string{"node1", "node2"} {
+		err := applicator.SetLabel(labels.NODE, node, "nodeQuality", "good")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rcFields, err := rcStore.Get(rc.rcID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rcFields.ReplicasDesired = 3
+
+	err = rc.meetDesires(rcFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scheduled := scheduledPods(t, applicator); len(scheduled) != 0 {
+		t.Fatalf("expected no pods to be labeled in dry-run mode, but %d were", len(scheduled))
+	}
+	manifests, _, err := consulStore.AllPods(consul.INTENT_TREE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifests) != 0 {
+		t.Fatalf("expected no manifests to be scheduled in dry-run mode, but %d were", len(manifests))
+	}
+
+	status, _, err := rcStatusStore.Get(rc.rcID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.DryRun == nil {
+		t.Fatal("expected the dry run to be recorded in the RC's status")
+	}
+	if expected := []types.NodeName{"node1", "node2"}; !reflect.DeepEqual(status.DryRun.Schedule, expected) {
+		t.Errorf("expected the dry run to schedule %s, got %s", expected, status.DryRun.Schedule)
+	}
+	if status.DryRun.Shortfall != 1 {
+		t.Errorf("expected a shortfall of 1 replica, got %d", status.DryRun.Shortfall)
+	}
+}
+
+func TestDryRunReportsSelectorChanges(t *testing.T) {
+	rcStore, _, applicator, rc, _, _, rcStatusStore, closeFn := setup(t)
+	defer closeFn()
+
+	for _, node := range []string{"node1", "node2"} {
+		err := applicator.SetLabel(labels.NODE, node, "nodeQuality", "good")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rcFields, err := rcStore.Get(rc.rcID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rcFields.ReplicasDesired = 2
+	err = rc.meetDesires(rcFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// now relabel node1 and shrink the RC in dry-run mode, the ineligible
+	// node should be the one unscheduled
+	rc.dryRun = true
+	err = applicator.SetLabel(labels.NODE, "node1", "nodeQuality", "bad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rcFields.ReplicasDesired = 1
+	err = rc.meetDesires(rcFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if current, err := rc.CurrentPods(); err != nil {
+		t.Fatal(err)
+	} else if len(current) != 2 {
+		t.Fatalf("expected the RC to still be on 2 nodes in dry-run mode, but it was on %d", len(current))
+	}
+
+	status, _, err := rcStatusStore.Get(rc.rcID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.DryRun == nil {
+		t.Fatal("expected the dry run to be recorded in the RC's status")
+	}
+	if expected := []types.NodeName{"node1"}; !reflect.DeepEqual(status.DryRun.Unschedule, expected) {
+		t.Errorf("expected the dry run to unschedule %s, got %s", expected, status.DryRun.Unschedule)
+	}
+	if len(status.DryRun.Schedule) != 0 || len(status.DryRun.Update) != 0 || len(status.DryRun.Ineligible) != 0 {
+		t.Errorf("expected the dry run to make no other changes, got %+v", status.DryRun)
+	}
+
+	// with the original replica count, node1 would remain but be ineligible
+	rcFields.ReplicasDesired = 2
+	err = rc.meetDesires(rcFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, _, err = rcStatusStore.Get(rc.rcID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []types.NodeName{"node1"}; !reflect.DeepEqual(status.DryRun.Ineligible, expected) {
+		t.Errorf("expected the dry run to report %s as ineligible, got %s", expected, status.DryRun.Ineligible)
+	}
+	if len(status.DryRun.Unschedule) != 0 {
+		t.Errorf("expected the dry run to unschedule nothing, got %s", status.DryRun.Unschedule)
+	}
+}
@@ -103,6 +103,10 @@ type Farm struct {
 	rcWatchPauseTime time.Duration
 
 	artifactRegistry artifact.Registry
+
+	// When dryRun is set, the farm's RCs only record the scheduling changes
+	// they would make in their status instead of making them
+	dryRun bool
 }
 
 type childRC struct {
@@ -129,6 +133,7 @@ func NewFarm(
 	alerter alerting.Alerter,
 	rcWatchPauseTime time.Duration,
 	artifactRegistry artifact.Registry,
+	dryRun bool,
 ) *Farm {
 	if alerter == nil {
 		alerter = alerting.NewNop()
@@ -153,6 +158,7 @@ func NewFarm(
 		rcSelector:       rcSelector,
 		rcWatchPauseTime: rcWatchPauseTime,
 		artifactRegistry: artifactRegistry,
+		dryRun:           dryRun,
 	}
 }
 
@@ -282,6 +288,7 @@ START_LOOP:
 					rcf.alerter,
 					rcf.healthChecker,
 					rcf.artifactRegistry,
+					rcf.dryRun,
 				)
 				childQuit := make(chan struct{})
 				rcf.children[rcKey.ID] = childRC{
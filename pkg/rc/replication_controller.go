@@ -29,6 +29,8 @@ import (
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/rcstore"
 	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/nodehealthstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/nodestatus"
 	"github.com/square/p2/pkg/store/consul/statusstore/rcstatus"
 	"github.com/square/p2/pkg/store/consul/transaction"
 	"github.com/square/p2/pkg/types"
@@ -141,6 +143,8 @@ type replicationController struct {
 	podApplicator Labeler
 	alerter       alerting.Alerter
 	healthChecker checker.HealthChecker
+	nodeHealth    scheduler.NodeHealthReader
+	nodeStatus    nodestatus.Reader
 
 	nodeTransfer nodeTransfer
 
@@ -149,6 +153,10 @@ type replicationController struct {
 	nodeTransferMu sync.Mutex
 
 	artifactRegistry artifact.Registry
+
+	// When dryRun is set the RC never schedules or unschedules anything,
+	// it only records the changes it would have made in its status
+	dryRun bool
 }
 
 type ReplicationControllerWatcher interface {
@@ -170,12 +178,13 @@ func New(
 	alerter alerting.Alerter,
 	healthChecker checker.HealthChecker,
 	artifactRegistry artifact.Registry,
+	dryRun bool,
 ) ReplicationController {
 	if alerter == nil {
 		alerter = alerting.NewNop()
 	}
 
-	return &replicationController{
+	rc := &replicationController{
 		rcID: rcID,
 
 		logger:           logger,
@@ -191,7 +200,13 @@ func New(
 		alerter:          alerter,
 		healthChecker:    healthChecker,
 		artifactRegistry: artifactRegistry,
+		dryRun:           dryRun,
+	}
+	if consulClient != nil {
+		rc.nodeHealth = nodehealthstatus.NewConsul(statusstore.NewConsul(consulClient), statusstore.NodeHealthStatusNamespace)
+		rc.nodeStatus = nodestatus.NewConsul(statusstore.NewConsul(consulClient), statusstore.PreparerPodStatusNamespace)
 	}
+	return rc
 }
 
 func (rc *replicationController) WatchDesires(quit <-chan struct{}) <-chan error {
@@ -296,6 +311,10 @@ func (rc *replicationController) meetDesires(rcFields fields.RC) error {
 
 	rc.logger.NoFields().Infof("Currently on nodes %s", current)
 
+	if rc.dryRun {
+		return rc.reportDryRun(rcFields, current, eligible)
+	}
+
 	nodesChanged := false
 	switch {
 	case rcFields.ReplicasDesired > len(current):
@@ -360,6 +379,15 @@ func (rc *replicationController) addPods(rcFields fields.RC, current types.PodLo
 	// So it may be the case that we need to make the Scheduler interface smarter and use it here.
 	possible := types.NewNodeSet(eligible...).Difference(types.NewNodeSet(currentNodes...))
 
+	// Cordoned nodes keep the pods they have but don't get new ones
+	cordoned, err := scheduler.CordonedNodes(rc.podApplicator)
+	if err != nil {
+		return err
+	}
+	possible = possible.Difference(cordoned)
+	// and so do nodes whose published health is critical
+	possible = possible.Difference(rc.criticalNodes(possible.ListNodes()))
+
 	// Users want deterministic ordering of nodes being populated to a new
 	// RC. Move nodes in sorted order by hostname to achieve this
 	possibleSorted := possible.ListNodes()
@@ -844,6 +872,15 @@ func (rc *replicationController) updateAllocations(rcFields fields.RC, ineligibl
 			return "", "", util.Errorf(errMsg)
 		}
 		newNode = newNodes[0]
+
+		cordoned, err := scheduler.CordonedNodes(rc.podApplicator)
+		if err != nil {
+			return "", "", err
+		}
+		if cordoned.Has(newNode.String()) {
+			rc.logger.Errorf("allocated node %s to replace %s is cordoned", newNode, oldNode)
+			return "", "", util.Errorf("allocated node %s is cordoned", newNode)
+		}
 	}
 
 	logger := rc.logger.SubLogger(logrus.Fields{
@@ -1022,10 +1059,18 @@ func (rc *replicationController) watchHealth(rcFields fields.RC, logger logging.
 				logger.Errorln("Node transfer health checker sent nil error")
 			}
 		case currentHealth := <-resultCh:
-			if currentHealth.Status == health.Passing {
+			if currentHealth.ReadinessStatus() == health.Passing {
 				logger.Infof("New transfer node %s health now passing", rc.nodeTransfer.newNode)
 				return true, ""
 			}
+			// the pod will never become healthy on a node that is
+			// being taken out of service
+			shuttingDown, err := nodestatus.ShuttingDown(rc.nodeStatus, rc.nodeTransfer.newNode)
+			if err != nil {
+				logger.WithError(err).Warnln("Could not read whether the new transfer node is shutting down")
+			} else if shuttingDown {
+				return false, audit.RollbackReason(fmt.Sprintf("new transfer node %s is shutting down", rc.nodeTransfer.newNode))
+			}
 		case <-rc.nodeTransfer.quit:
 			return false, rc.nodeTransfer.rollbackReason
 		case <-time.After(5 * time.Minute):
@@ -1167,9 +1212,32 @@ func (rc *replicationController) createRollbackTransferRecord(
 	return nil
 }
 
+// criticalNodes returns those of nodes whose published health is critical.
+// Node health only steers new pods away from sick nodes, so if it can't be
+// read the RC carries on as if every node were healthy.
+func (rc *replicationController) criticalNodes(nodes []types.NodeName) types.NodeSet {
+	if rc.nodeHealth == nil || len(nodes) == 0 {
+		return types.NewNodeSet()
+	}
+	critical, err := scheduler.CriticalNodes(rc.nodeHealth, nodes, scheduler.DefaultNodeHealthMaxAge)
+	if err != nil {
+		rc.logger.WithError(err).Warnln("Could not read the health of nodes, not avoiding critical nodes")
+		return types.NewNodeSet()
+	}
+	if critical.Len() > 0 {
+		rc.logger.Infof("Not scheduling on critical nodes %s", critical)
+	}
+	return critical
+}
+
 func (rc *replicationController) checkEligibleForUnused(podID types.PodID, eligible []types.NodeName, current []types.NodeName) (types.NodeName, error) {
-	toCheck := types.NewNodeSet(eligible...).Difference(types.NewNodeSet(current...)).ListNodes()
-	for _, node := range toCheck {
+	cordoned, err := scheduler.CordonedNodes(rc.podApplicator)
+	if err != nil {
+		return "", err
+	}
+	toCheck := types.NewNodeSet(eligible...).Difference(types.NewNodeSet(current...)).Difference(cordoned)
+	toCheck = toCheck.Difference(rc.criticalNodes(toCheck.ListNodes()))
+	for _, node := range toCheck.ListNodes() {
 		_, _, err := rc.consulStore.Pod(consul.INTENT_TREE, node, podID)
 		switch {
 		case err == pods.NoCurrentManifest:
@@ -28,7 +28,10 @@ import (
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/rcstore"
 	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/nodehealthstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/nodestatus"
 	"github.com/square/p2/pkg/store/consul/statusstore/rcstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/statusstoretest"
 	"github.com/square/p2/pkg/store/consul/transaction"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
@@ -131,7 +134,7 @@ func setup(t *testing.T) (
 	consulStore = consul.NewConsulStore(fixture.Client)
 
 	statusStore := statusstore.NewConsul(fixture.Client)
-	rcStatusStore = rcstatus.NewConsul(statusStore, consul.RCStatusNamespace)
+	rcStatusStore = rcstatus.NewConsul(statusStore, statusstore.RCStatusNamespace)
 
 	manifestBuilder := manifest.NewBuilder()
 	manifestBuilder.SetID("testPod")
@@ -165,6 +168,7 @@ func setup(t *testing.T) (
 		alerter,
 		healthChecker,
 		artifactRegistry,
+		false,
 	).(*replicationController)
 
 	return
@@ -1209,6 +1213,41 @@ func TestTransferNodeHappyPath(t *testing.T) {
 	}
 }
 
+func TestTransferRolledBackWhenNewNodeIsShuttingDown(t *testing.T) {
+	rcStore, _, applicator, rc, alerter, _, _, closeFn := setup(t)
+	defer closeFn()
+
+	rcFields, err := rcStore.Get(rc.rcID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rcFields.AllocationStrategy = fields.DynamicStrategy
+
+	healthMap := map[types.NodeName]health.Result{
+		newTransferNode: health.Result{Status: health.Critical},
+	}
+	rc.healthChecker = fake_checker.NewSingleService("", healthMap)
+	nodeStatus := nodestatus.NewConsul(statusstoretest.NewFake(), statusstore.PreparerPodStatusNamespace)
+	err = nodeStatus.Set(newTransferNode, nodestatus.Status{State: nodestatus.NodeShuttingDown})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.nodeStatus = nodeStatus
+
+	rcFields, err = testIneligibleNodesCommon(applicator, rc, rcFields, alerter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testRolledBackTransfer(rc, rcFields, t)
+	rc.nodeTransferMu.Lock()
+	defer rc.nodeTransferMu.Unlock()
+	if rc.nodeTransfer.newNode != "" {
+		t.Fatalf("Expected the transfer to %s to be rolled back rather than waiting for its health", rc.nodeTransfer.newNode)
+	}
+}
+
 type failOnDeleteCASKeyTxner struct {
 	badKey string
 	inner  transaction.Txner
@@ -1398,6 +1437,82 @@ func TestAddPodsDisabled(t *testing.T) {
 	}
 }
 
+func TestAddPodsSkipsCordonedNodes(t *testing.T) {
+	_, _, applicator, rc, _, _, _, closeFn := setup(t)
+	defer closeFn()
+
+	err := applicator.SetLabel(labels.NODE, "node1", types.CordonedLabel, "true")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rcFields := fields.RC{
+		ID:              rc.rcID,
+		ReplicasDesired: 2,
+		Manifest:        testManifest(),
+	}
+	eligible := []types.NodeName{"node1", "node2", "node3"}
+
+	err = rc.addPods(rcFields, make(types.PodLocations, 0), eligible)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	currentPods, err := rc.CurrentPods()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := types.NewNodeSet(currentPods.Nodes()...)
+	if !nodes.Equal(types.NewNodeSet("node2", "node3")) {
+		t.Fatalf("expected pods to be scheduled on node2 and node3 only, found %s", currentPods.Nodes())
+	}
+
+	// a pod already on a cordoned node is not an ineligible one
+	current := types.PodLocations{{Node: "node1", PodID: testManifest().ID()}}
+	if ineligible := rc.checkForIneligible(current, eligible); len(ineligible) != 0 {
+		t.Errorf("expected the pod on the cordoned node to be kept, but %s was ineligible", ineligible)
+	}
+}
+
+func TestAddPodsSkipsCriticalNodes(t *testing.T) {
+	_, _, _, rc, _, _, _, closeFn := setup(t)
+	defer closeFn()
+
+	nodeHealthStore := nodehealthstatus.NewConsul(statusstore.NewConsul(rc.consulClient), statusstore.NodeHealthStatusNamespace)
+	for node, status := range map[types.NodeName]nodehealthstatus.Status{
+		"node1": {State: nodehealthstatus.Critical, Updated: time.Now()},
+		// a critical node that stopped publishing its health isn't avoided
+		"node2": {State: nodehealthstatus.Critical, Updated: time.Now().Add(-2 * scheduler.DefaultNodeHealthMaxAge)},
+		"node3": {State: nodehealthstatus.Degraded, Updated: time.Now()},
+	} {
+		err := nodeHealthStore.Set(node, status)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rcFields := fields.RC{
+		ID:              rc.rcID,
+		ReplicasDesired: 3,
+		Manifest:        testManifest(),
+	}
+	eligible := []types.NodeName{"node1", "node2", "node3", "node4"}
+
+	err := rc.addPods(rcFields, make(types.PodLocations, 0), eligible)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	currentPods, err := rc.CurrentPods()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := types.NewNodeSet(currentPods.Nodes()...)
+	if !nodes.Equal(types.NewNodeSet("node2", "node3", "node4")) {
+		t.Fatalf("expected pods to be scheduled on every node but node1, found %s", currentPods.Nodes())
+	}
+}
+
 func TestRemovePods(t *testing.T) {
 	_, _, _, rc, _, _, _, closeFn := setup(t)
 	defer closeFn()
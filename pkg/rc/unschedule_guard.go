@@ -0,0 +1,103 @@
+package rc
+
+import (
+	"fmt"
+
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// UnscheduleLimits bounds how many of a replication controller's pods a
+// single operation, such as lowering its replica count or changing its node
+// selector, may unschedule without being confirmed. This protects against
+// typos and selector bugs that would take down most of a service at once.
+type UnscheduleLimits struct {
+	// MaxPercent is the largest percentage of the current pods that can
+	// be unscheduled, or 0 for no limit
+	MaxPercent int
+
+	// MaxPods is the largest number of pods that can be unscheduled, or
+	// 0 for no limit
+	MaxPods int
+}
+
+var DefaultUnscheduleLimits = UnscheduleLimits{
+	MaxPercent: 50,
+	MaxPods:    10,
+}
+
+// MassUnscheduleError is returned by UnscheduleLimits.Check when an operation
+// exceeds the limits and was not confirmed
+type MassUnscheduleError struct {
+	PodID   types.PodID
+	Removed int
+	Current int
+	Limits  UnscheduleLimits
+}
+
+func (e MassUnscheduleError) Error() string {
+	return fmt.Sprintf(
+		"this would unschedule %d of the %d pods of %s, more than the limit of %d%% or %d pods. Confirm by passing the pod ID %s",
+		e.Removed,
+		e.Current,
+		e.PodID,
+		e.Limits.MaxPercent,
+		e.Limits.MaxPods,
+		e.PodID,
+	)
+}
+
+func IsMassUnschedule(err error) bool {
+	_, ok := err.(MassUnscheduleError)
+	return ok
+}
+
+// Exceeded returns whether unscheduling removed of current pods goes past the
+// limits
+func (l UnscheduleLimits) Exceeded(current int, removed int) bool {
+	if removed <= 0 {
+		return false
+	}
+	if l.MaxPods > 0 && removed > l.MaxPods {
+		return true
+	}
+	return l.MaxPercent > 0 && removed*100 > l.MaxPercent*current
+}
+
+// Check returns a MassUnscheduleError if unscheduling removed of the current
+// pods of podID exceeds the limits, unless the caller confirmed the operation
+// by typing out the pod ID as confirmedPodID. A confirmation of any other pod
+// is an error even when the limits are not exceeded, since the caller is
+// likely operating on the wrong replication controller.
+func (l UnscheduleLimits) Check(podID types.PodID, current int, removed int, confirmedPodID types.PodID) error {
+	if confirmedPodID != "" && confirmedPodID != podID {
+		return util.Errorf("the confirmed pod ID %s does not match the pod ID %s of the replication controller", confirmedPodID, podID)
+	}
+	if confirmedPodID == podID || !l.Exceeded(current, removed) {
+		return nil
+	}
+	return MassUnscheduleError{
+		PodID:   podID,
+		Removed: removed,
+		Current: current,
+		Limits:  l,
+	}
+}
+
+// UnscheduledBySelector returns how many of the current pods are on nodes
+// other than the eligible ones, which a replication controller with a new
+// node selector would unschedule
+func UnscheduledBySelector(current types.PodLocations, eligible []types.NodeName) int {
+	eligibleSet := make(map[types.NodeName]bool, len(eligible))
+	for _, node := range eligible {
+		eligibleSet[node] = true
+	}
+
+	removed := 0
+	for _, pod := range current {
+		if !eligibleSet[pod.Node] {
+			removed++
+		}
+	}
+	return removed
+}
@@ -0,0 +1,69 @@
+package rc
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/types"
+)
+
+func TestUnscheduleLimitsCheck(t *testing.T) {
+	limits := UnscheduleLimits{MaxPercent: 50, MaxPods: 10}
+
+	for _, tc := range []struct {
+		name      string
+		current   int
+		removed   int
+		confirmed types.PodID
+		allowed   bool
+	}{
+		{name: "nothing removed", current: 4, removed: 0, allowed: true},
+		{name: "within both limits", current: 20, removed: 10, allowed: true},
+		{name: "over the percentage", current: 4, removed: 3, allowed: false},
+		{name: "over the pod count", current: 100, removed: 11, allowed: false},
+		{name: "every pod", current: 1, removed: 1, allowed: false},
+		{name: "confirmed", current: 100, removed: 100, confirmed: "web", allowed: true},
+		{name: "confirmed the wrong pod", current: 100, removed: 100, confirmed: "api", allowed: false},
+		{name: "confirmed the wrong pod within limits", current: 20, removed: 1, confirmed: "api", allowed: false},
+	} {
+		err := limits.Check("web", tc.current, tc.removed, tc.confirmed)
+		if tc.allowed && err != nil {
+			t.Errorf("%s: expected the operation to be allowed, got %s", tc.name, err)
+		}
+		if !tc.allowed && err == nil {
+			t.Errorf("%s: expected the operation to be refused", tc.name)
+		}
+	}
+
+	err := limits.Check("web", 4, 3, "")
+	if !IsMassUnschedule(err) {
+		t.Errorf("expected a MassUnscheduleError, got %v", err)
+	}
+	err = limits.Check("web", 4, 1, "api")
+	if err == nil || IsMassUnschedule(err) {
+		t.Errorf("expected a mismatched confirmation to be a different error, got %v", err)
+	}
+}
+
+func TestUnscheduleLimitsDisabled(t *testing.T) {
+	if (UnscheduleLimits{}).Exceeded(10, 10) {
+		t.Error("expected zero limits to allow unscheduling every pod")
+	}
+	if (UnscheduleLimits{MaxPods: 5}).Exceeded(5, 5) {
+		t.Error("expected no percentage limit when MaxPercent is 0")
+	}
+	if !(UnscheduleLimits{MaxPercent: 50}).Exceeded(10, 6) {
+		t.Error("expected the percentage limit to apply when MaxPods is 0")
+	}
+}
+
+func TestUnscheduledBySelector(t *testing.T) {
+	current := types.PodLocations{
+		{Node: "node1", PodID: "web"},
+		{Node: "node2", PodID: "web"},
+		{Node: "node3", PodID: "web"},
+	}
+	removed := UnscheduledBySelector(current, []types.NodeName{"node2", "node4"})
+	if removed != 2 {
+		t.Errorf("expected 2 pods to be unscheduled, got %d", removed)
+	}
+}
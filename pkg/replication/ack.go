@@ -0,0 +1,69 @@
+package replication
+
+import (
+	"time"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/types"
+)
+
+func (r *replication) SetAckStore(store DeployStatusStore) {
+	r.ackStore = store
+}
+
+// verifyIntent reads back the intent that was just written for node with a
+// consistent read, so that a write that didn't land, or that another deploy
+// overwrote right away, fails the node rather than being waited on until it
+// times out
+func (r *replication) verifyIntent(node types.NodeName, targetSHA string) error {
+	man, _, err := r.store.ConsistentPod(consul.INTENT_TREE, node, r.GetManifest().ID())
+	if err != nil {
+		return errors.Errorf("could not read back the intent written for %s: %w", node, err)
+	}
+	sha, err := man.SHA()
+	if err != nil {
+		return errors.Errorf("could not compute the SHA of the intent of %s: %w", node, err)
+	}
+	if sha != targetSHA {
+		return errors.Errorf("intent of %s on %s is %s rather than the %s that was just written", r.GetManifest().ID(), node, sha, targetSHA)
+	}
+	return nil
+}
+
+// acknowledged returns whether the preparer on node has acknowledged the
+// intent with targetSHA
+func (r *replication) acknowledged(node types.NodeName, targetSHA string, nodeLogger logging.Logger) bool {
+	status, _, err := r.ackStore.Get(node)
+	if statusstore.IsNoStatus(err) {
+		return false
+	}
+	if err != nil {
+		nodeLogger.WithError(err).Warnln("Could not read the preparer's acknowledgment")
+		return false
+	}
+	ack, ok := status.Acks[r.GetManifest().ID()]
+	return ok && ack.SHA == targetSHA
+}
+
+// ackWatch tracks when the preparer on a node acknowledged a new intent, if
+// the caller asked for acknowledgments
+type ackWatch struct {
+	written time.Time
+	latency time.Duration
+	acked   bool
+}
+
+// poll checks for the acknowledgment until it is seen
+func (a *ackWatch) poll(r *replication, node types.NodeName, targetSHA string, nodeLogger logging.Logger) {
+	if a.acked || r.ackStore == nil {
+		return
+	}
+	if r.acknowledged(node, targetSHA, nodeLogger) {
+		a.acked = true
+		a.latency = time.Since(a.written)
+		nodeLogger.WithField("latency", a.latency).Infoln("Preparer acknowledged the new intent")
+	}
+}
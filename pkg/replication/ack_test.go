@@ -0,0 +1,75 @@
+package replication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/deploystatus"
+	"github.com/square/p2/pkg/types"
+)
+
+// fakeAckStore acknowledges whatever is in the intent of each node, as if a
+// preparer were running there
+type fakeAckStore struct {
+	store *fakeStore
+}
+
+func (f fakeAckStore) Get(node types.NodeName) (deploystatus.Status, *api.QueryMeta, error) {
+	man, _, err := f.store.Pod(consul.INTENT_TREE, node, testPodId)
+	if err != nil {
+		return deploystatus.Status{}, nil, statusstore.NoStatusError{}
+	}
+	sha, _ := man.SHA()
+	return deploystatus.Status{Acks: map[types.PodID]deploystatus.Ack{
+		testPodId: {SHA: sha, At: time.Now()},
+	}}, nil, nil
+}
+
+func TestEnactRecordsAcknowledgments(t *testing.T) {
+	defer fastPolling()()
+	store := newFakeStore(t, scenarioNodes)
+	repl, errsCh := startFakeReplication(t, store, newFakeHealthChecker(scenarioNodes, health.Passing), 10*time.Second)
+	repl.SetAckStore(fakeAckStore{store: store})
+
+	enactWithin(t, repl, 10*time.Second)
+	<-errsCh
+
+	timings := repl.(*replication).NodeTimings()
+	if len(timings) != len(scenarioNodes) {
+		t.Fatalf("Expected timings for every node, got %+v", timings)
+	}
+	for _, timing := range timings {
+		if _, ok := timing.Phases[PhaseAcknowledge]; !ok {
+			t.Errorf("Expected the acknowledgment latency of %s to be recorded, got %+v", timing.Node, timing.Phases)
+		}
+	}
+}
+
+func TestVerifyIntent(t *testing.T) {
+	store := newFakeStore(t, scenarioNodes)
+	r := &replication{store: store, manifest: basicManifest()}
+	sha, _ := basicManifest().SHA()
+
+	if err := r.verifyIntent("node1", sha); err == nil {
+		t.Errorf("Expected verification to fail when the intent is missing")
+	}
+
+	store.setPod(t, consul.INTENT_TREE, "node1", basicManifest())
+	if err := r.verifyIntent("node1", sha); err != nil {
+		t.Errorf("Expected the intent to be verified, got %s", err)
+	}
+
+	// another deploy overwrote the intent
+	builder := basicManifest().GetBuilder()
+	builder.SetStatusPort(12345)
+	other := builder.GetManifest()
+	store.setPod(t, consul.INTENT_TREE, "node1", other)
+	if err := r.verifyIntent("node1", sha); err == nil {
+		t.Errorf("Expected verification to fail when the intent was overwritten")
+	}
+}
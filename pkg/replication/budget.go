@@ -0,0 +1,186 @@
+package replication
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util/param"
+)
+
+var deployBudgetPollMillis = param.Int("deploy_budget_poll_millis", 1000)
+
+// deployBudget claims slots of the fleet-wide deploy budget (see
+// consul.DeployBudgetKey) for the nodes a replication is updating. Each slot
+// is a consul lock under consul.DeployBudgetLockPath(), locked with a session
+// that lives as long as the replication, so the slots of a replication that
+// dies are freed when its session expires.
+type deployBudget struct {
+	store  Store
+	name   string
+	logger logging.Logger
+
+	mu           sync.Mutex
+	session      consul.Session
+	renewalErrCh chan error
+	held         map[int]consul.Unlocker
+}
+
+func newDeployBudget(store Store, name string, logger logging.Logger) *deployBudget {
+	return &deployBudget{
+		store:  store,
+		name:   name,
+		logger: logger,
+		held:   make(map[int]consul.Unlocker),
+	}
+}
+
+// tryAcquire claims a free slot without blocking. ok is false if every slot
+// is in use. The returned function releases the slot.
+func (b *deployBudget) tryAcquire(node types.NodeName) (release func(), ok bool, err error) {
+	limit, err := b.store.DeployBudget()
+	if err != nil {
+		return nil, false, err
+	}
+	if limit == 0 {
+		return func() {}, true, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	err = b.ensureSession()
+	if err != nil {
+		return nil, false, err
+	}
+
+	for slot := 0; slot < limit; slot++ {
+		if _, ok := b.held[slot]; ok {
+			continue
+		}
+
+		unlocker, err := b.session.Lock(consul.DeployBudgetLockPath(slot))
+		switch {
+		case consul.IsAlreadyLocked(err):
+			continue
+		case err != nil:
+			return nil, false, err
+		}
+
+		b.held[slot] = unlocker
+		session := b.session
+		return func() { b.release(session, slot, node) }, true, nil
+	}
+	return nil, false, nil
+}
+
+func (b *deployBudget) release(session consul.Session, slot int, node types.NodeName) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if session != b.session {
+		// the session was lost, taking the lock with it
+		return
+	}
+	unlocker, ok := b.held[slot]
+	if !ok {
+		return
+	}
+	delete(b.held, slot)
+
+	err := unlocker.Unlock()
+	if err != nil {
+		b.logger.WithErrorAndFields(err, logrus.Fields{
+			"node": node,
+			"slot": slot,
+		}).Errorln("Could not release deploy budget slot")
+	}
+}
+
+// ensureSession must be called with b.mu held
+func (b *deployBudget) ensureSession() error {
+	if b.session != nil {
+		select {
+		case err, ok := <-b.renewalErrCh:
+			if ok && err != nil {
+				b.logger.WithError(err).Warnln("Lost session for deploy budget, creating a new one")
+			}
+			b.session = nil
+			b.held = make(map[int]consul.Unlocker)
+		default:
+			return nil
+		}
+	}
+
+	session, renewalErrCh, err := b.store.NewSession(b.name, nil)
+	if err != nil {
+		return errors.Errorf("could not create session for deploy budget: %w", err)
+	}
+	b.session = session
+	b.renewalErrCh = renewalErrCh
+	return nil
+}
+
+// close frees every slot still held by destroying the session
+func (b *deployBudget) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.session != nil {
+		_ = b.session.Destroy()
+		b.session = nil
+		b.held = make(map[int]consul.Unlocker)
+	}
+}
+
+// waitForDeployBudget blocks until a slot of the fleet-wide deploy budget is
+// free for node, and returns the function that releases it. Replications
+// created without a budget don't wait.
+func (r *replication) waitForDeployBudget(
+	ctx context.Context,
+	node types.NodeName,
+	nodeLogger logging.Logger,
+) (func(), error) {
+	if r.budget == nil {
+		return func() {}, nil
+	}
+
+	waiting := false
+	for {
+		release, ok, err := r.budget.tryAcquire(node)
+		switch {
+		case err != nil:
+			nodeLogger.WithError(err).Errorln("Could not claim a deploy budget slot, retrying")
+		case ok:
+			if waiting {
+				nodeLogger.NoFields().Infoln("Claimed a deploy budget slot")
+			}
+			return release, nil
+		case !waiting:
+			nodeLogger.NoFields().Infoln("Fleet-wide deploy budget is exhausted, waiting for a slot")
+			waiting = true
+		}
+
+		select {
+		case <-r.quitCh:
+			r.logger.Infoln("Caught quit signal while waiting for deploy budget")
+			return nil, errQuit
+		case <-ctx.Done():
+			r.logger.Infoln("Caught timeout signal while waiting for deploy budget")
+			return nil, errTimeout
+		case <-r.replicationCancelledCh:
+			r.logger.Infoln("Caught cancellation signal while waiting for deploy budget")
+			return nil, errCancelled
+		case <-time.After(time.Duration(*deployBudgetPollMillis) * time.Millisecond):
+		}
+	}
+}
+
+func deployBudgetSessionName(podID types.PodID) string {
+	return fmt.Sprintf("deploy budget for replication of %s", podID)
+}
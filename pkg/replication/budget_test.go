@@ -0,0 +1,58 @@
+package replication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+)
+
+func TestDeployBudgetBoundsUpdatesAcrossReplications(t *testing.T) {
+	f := consulutil.NewFixture(t)
+	defer f.Stop()
+	store := consul.NewConsulStore(f.Client)
+
+	first := newDeployBudget(store, "first", basicLogger())
+	defer first.close()
+	second := newDeployBudget(store, "second", basicLogger())
+	defer second.close()
+
+	// without a budget, every update may proceed
+	_, ok, err := first.tryAcquire("node1")
+	if err != nil || !ok {
+		t.Fatalf("Expected no limit without a budget, got %t, %v", ok, err)
+	}
+
+	err = store.SetDeployBudget(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseFirst, ok, err := first.tryAcquire("node1")
+	if err != nil || !ok {
+		t.Fatalf("Expected to claim a slot, got %t, %v", ok, err)
+	}
+	_, ok, err = second.tryAcquire("node2")
+	if err != nil || !ok {
+		t.Fatalf("Expected to claim the second slot, got %t, %v", ok, err)
+	}
+	_, ok, err = second.tryAcquire("node3")
+	if err != nil || ok {
+		t.Fatalf("Expected the budget to be exhausted, got %t, %v", ok, err)
+	}
+
+	releaseFirst()
+	_, ok, err = second.tryAcquire("node3")
+	if err != nil || !ok {
+		t.Fatalf("Expected a released slot to be claimable, got %t, %v", ok, err)
+	}
+
+	// closing a budget frees the slots it still holds
+	second.close()
+	// consul holds released locks for the lock delay
+	time.Sleep(10 * time.Millisecond)
+	_, ok, err = first.tryAcquire("node4")
+	if err != nil || !ok {
+		t.Fatalf("Expected the closed budget's slots to be freed, got %t, %v", ok, err)
+	}
+}
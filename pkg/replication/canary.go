@@ -0,0 +1,104 @@
+package replication
+
+import (
+	"time"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/types"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func (r *replication) SetCanary(count int, wait time.Duration) {
+	r.mu.Lock()
+	r.canaryCount = count
+	r.canaryWait = wait
+	r.mu.Unlock()
+}
+
+// enactCanary updates the first canaryCount of the given nodes and waits for
+// them to stay healthy for canaryWait. It returns the nodes that are left to
+// update, or an error if any canary could not be updated or stopped being
+// healthy, in which case no other node should be updated.
+func (r *replication) enactCanary(nodes []types.NodeName, aggregateHealth *podHealth) ([]types.NodeName, error) {
+	r.mu.RLock()
+	count, wait := r.canaryCount, r.canaryWait
+	r.mu.RUnlock()
+	if count >= len(nodes) {
+		r.logger.Infof("Canary count %d covers all %d nodes, updating them without a canary phase", count, len(nodes))
+		return nodes, nil
+	}
+
+	canaries, rest := nodes[:count], nodes[count:]
+	canaryLogger := r.logger.WithFields(logrus.Fields{
+		"canaries": canaries,
+		"wait":     wait,
+	})
+	canaryLogger.Infoln("Updating canary nodes")
+
+	failed := r.updateNodes(r.queueNodes(canaries), aggregateHealth)
+	if err := r.checkStopped(); err != nil {
+		return nil, err
+	}
+	if len(failed) > 0 {
+		failedSet := make(map[types.NodeName]bool)
+		for _, node := range failed {
+			failedSet[node] = true
+		}
+		return nil, errors.Errorf("canary nodes could not be updated, no other nodes were touched: %s", joinNodes(failedSet))
+	}
+
+	canaryLogger.Infoln("Canary nodes are healthy, waiting for them to stay healthy")
+	err := r.soakCanaries(canaries, wait, aggregateHealth)
+	if err != nil {
+		return nil, err
+	}
+	canaryLogger.Infof("Canary nodes stayed healthy, updating the remaining %d nodes", len(rest))
+	return rest, nil
+}
+
+// soakCanaries checks the health of the canaries until wait has elapsed,
+// returning an error as soon as any of them is seen below the threshold.
+func (r *replication) soakCanaries(canaries []types.NodeName, wait time.Duration, aggregateHealth *podHealth) error {
+	deadline := time.After(wait)
+	for {
+		select {
+		case <-r.quitCh:
+			return errQuit
+		case <-r.replicationCancelledCh:
+			return errCancelled
+		case <-deadline:
+			return nil
+		case <-time.After(time.Duration(*ensureHealthyPeriodMillis) * time.Millisecond):
+			for _, node := range canaries {
+				// A missing result is zero, which is treated like "critical"
+				res, _ := aggregateHealth.GetHealth(node)
+				if health.Compare(res.GatingStatus(), r.healthThreshold()) < 0 {
+					if r.shuttingDown(node) {
+						r.logger.WithField("node", node).Infoln("Canary node is shutting down, not counting its health")
+						continue
+					}
+					err := errors.Errorf("canary node %s became unhealthy (%q) while waiting, no other nodes were touched", node, res.Status)
+					r.nodeFailed(node)
+					r.recordNode(node, err)
+					r.reportProgress(node, NodeFailed, err)
+					return err
+				}
+			}
+		}
+	}
+}
+
+// checkStopped returns errQuit or errCancelled if the replication has been
+// stopped by either means, and nil otherwise
+func (r *replication) checkStopped() error {
+	select {
+	case <-r.quitCh:
+		return errQuit
+	case <-r.replicationCancelledCh:
+		return errCancelled
+	default:
+		return nil
+	}
+}
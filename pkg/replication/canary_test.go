@@ -0,0 +1,86 @@
+// +build !race
+
+package replication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestEnactCanaryUpdatesEveryNodeOnceHealthy(t *testing.T) {
+	errCh := make(chan error)
+	r, fixture := newTestReplication(t, errCh)
+	defer fixture.Stop()
+	r.errCh = errCh
+	go proccessErrors(errCh, t)
+	r.timeout = NoTimeout
+	r.SetCanary(1, 1500*time.Millisecond)
+
+	r.Enact()
+
+	intent, _, err := consul.NewConsulStore(fixture.Client).AllPods(consul.INTENT_TREE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(intent) != 2 {
+		t.Errorf("expected both nodes to be updated after the canary stayed healthy, but %d were", len(intent))
+	}
+}
+
+func TestEnactCanaryHaltsWhenCanaryBecomesUnhealthy(t *testing.T) {
+	errCh := make(chan error)
+	r, fixture := newTestReplication(t, errCh)
+	defer fixture.Stop()
+	healthChecker, resultsCh := channelHealthChecker(r.nodes, t)
+	r.health = healthChecker
+	r.errCh = errCh
+	r.timeout = NoTimeout
+	r.SetCanary(1, time.Minute)
+
+	results := func(status health.HealthState) map[types.NodeName]health.Result {
+		res := make(map[types.NodeName]health.Result)
+		for _, node := range r.nodes {
+			res[node] = health.Result{ID: testPodId, Status: status}
+		}
+		return res
+	}
+
+	enactDone := make(chan struct{})
+	go func() {
+		defer close(enactDone)
+		r.Enact()
+	}()
+	resultsCh <- results(health.Passing)
+
+	deadline := time.After(60 * time.Second)
+	for r.CompletedCount() < 1 {
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for the canary to be updated")
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	resultsCh <- results(health.Critical)
+
+	select {
+	case err := <-errCh:
+		if !IsFatalError(err) {
+			t.Errorf("expected an unhealthy canary to be a fatal error, got %s", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the replication to halt when the canary became unhealthy")
+	}
+	<-enactDone
+
+	intent, _, err := consul.NewConsulStore(fixture.Client).AllPods(consul.INTENT_TREE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(intent) != 1 {
+		t.Errorf("expected only the canary to be updated, but %d nodes were", len(intent))
+	}
+}
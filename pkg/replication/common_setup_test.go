@@ -132,6 +132,10 @@ func (h channelBasedHealthChecker) WatchHealth(
 	panic("not implemented")
 }
 
+func (h channelBasedHealthChecker) History(node types.NodeName, serviceID string, n int) ([]health.HistoryEntry, error) {
+	panic("not implemented")
+}
+
 // returns an implementation of checker.HealthChecker that will provide
 // results based on what is passed on the returned  chanel
 func channelHealthChecker(nodes []types.NodeName, t *testing.T) (checker.HealthChecker, chan map[types.NodeName]health.Result) {
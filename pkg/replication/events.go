@@ -0,0 +1,68 @@
+package replication
+
+import (
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/replicationstatus"
+	"github.com/square/p2/pkg/types"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// EventStore keeps the log of the phases that nodes went through during the
+// replications of each pod, e.g. a replicationstatus.ConsulStore
+type EventStore interface {
+	Get(podID types.PodID) (replicationstatus.Status, *api.QueryMeta, error)
+	Set(podID types.PodID, status replicationstatus.Status) error
+}
+
+func (r *replication) SetEventStore(store EventStore) {
+	r.eventMu.Lock()
+	r.eventStore = store
+	r.eventMu.Unlock()
+}
+
+// recordEvent appends the phase that the node entered to the pod's event log,
+// if the caller asked for one. The log is only an audit trail, so failing to
+// write it is logged rather than failing the replication.
+func (r *replication) recordEvent(node types.NodeName, phase NodePhase, at time.Time, err error) {
+	r.eventMu.Lock()
+	defer r.eventMu.Unlock()
+	if r.eventStore == nil {
+		return
+	}
+
+	podID := r.manifest.ID()
+	if r.events == nil {
+		status, _, getErr := r.eventStore.Get(podID)
+		if getErr != nil && !statusstore.IsNoStatus(getErr) {
+			r.logger.WithError(getErr).Errorf("Could not read the replication events of %s, %s of %s was not recorded", podID, phase, node)
+			return
+		}
+		r.events = &status
+	}
+
+	event := replicationstatus.Event{
+		Node:  node,
+		Phase: string(phase),
+		Time:  at,
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	if man, manErr := r.manifestFor(node); manErr == nil {
+		event.SHA, _ = man.SHA()
+	}
+	r.recordMu.Lock()
+	if r.record != nil {
+		event.ReplicationID = r.record.ID
+	}
+	r.recordMu.Unlock()
+
+	r.events.Append(event)
+	setErr := r.eventStore.Set(podID, *r.events)
+	if setErr != nil {
+		r.logger.WithError(setErr).Errorf("Could not record %s of %s in the replication events of %s", phase, node, podID)
+	}
+}
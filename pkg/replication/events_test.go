@@ -0,0 +1,67 @@
+package replication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/store/consul/statusstore/replicationstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/statusstoretest"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestEnactRecordsEvents(t *testing.T) {
+	defer fastPolling()()
+	store := newFakeStore(t, scenarioNodes)
+	store.stall("node2")
+	repl, errsCh := startFakeReplication(t, store, newFakeHealthChecker(scenarioNodes, health.Passing), 50*time.Millisecond)
+
+	podID := basicManifest().ID()
+	eventStore := replicationstatus.NewConsul(statusstoretest.NewFake(), "replication_events")
+	earlier := replicationstatus.Event{ReplicationID: "earlier", Node: "node1", Phase: string(NodeHealthy)}
+	err := eventStore.Set(podID, replicationstatus.Status{Events: []replicationstatus.Event{earlier}})
+	if err != nil {
+		t.Fatalf("unexpected error setting replication events: %s", err)
+	}
+	repl.SetEventStore(eventStore)
+	phasesCh := collectPhases(repl.ProgressUpdates())
+
+	enactWithin(t, repl, 10*time.Second)
+	phases := <-phasesCh
+	<-errsCh
+
+	status, _, err := eventStore.Get(podID)
+	if err != nil {
+		t.Fatalf("unexpected error getting replication events: %s", err)
+	}
+	if len(status.Events) == 0 || status.Events[0].ReplicationID != "earlier" {
+		t.Fatalf("expected the events of the earlier replication to be kept first, got %+v", status.Events)
+	}
+
+	recorded := make(map[types.NodeName][]NodePhase)
+	sha, _ := basicManifest().SHA()
+	for _, event := range status.Events[1:] {
+		recorded[event.Node] = append(recorded[event.Node], NodePhase(event.Phase))
+		if event.SHA != sha {
+			t.Errorf("expected events to record the manifest SHA %s, got %s", sha, event.SHA)
+		}
+		if event.Phase == string(NodeFailed) && event.Error == "" {
+			t.Errorf("expected the failure of %s to record why it failed", event.Node)
+		}
+	}
+	for _, node := range scenarioNodes {
+		if len(recorded[node]) != len(phases[node]) {
+			t.Errorf("expected %s to have events %v, got %v", node, phases[node], recorded[node])
+			continue
+		}
+		for i := range phases[node] {
+			if recorded[node][i] != phases[node][i] {
+				t.Errorf("expected %s to have events %v, got %v", node, phases[node], recorded[node])
+				break
+			}
+		}
+	}
+	if lastPhase(recorded["node2"]) != NodeFailed {
+		t.Errorf("expected the last event of node2 to be a failure, got %v", recorded["node2"])
+	}
+}
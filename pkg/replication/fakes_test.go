@@ -0,0 +1,472 @@
+package replication
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/pborman/uuid"
+
+	"github.com/square/p2/pkg/constants"
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// fakeStore is an in-memory Store that is also the transaction.Txner its
+// transactions are committed with. Committing an intent also writes it to
+// reality, the way the node's preparer would install it, unless the node's
+// preparer is stalled. Locks are shared between all of its sessions, so
+// replications using the same fakeStore contend for them.
+type fakeStore struct {
+	mu      sync.Mutex
+	kv      map[string][]byte
+	stalled map[types.NodeName]bool
+	failing map[types.NodeName]error
+	locks   map[string]*fakeStoreSession
+	records map[string]consul.ReplicationRecord
+	paused  *consul.ReplicationPause
+}
+
+var _ Store = &fakeStore{}
+var _ transaction.Txner = &fakeStore{}
+
+// newFakeStore returns a fakeStore with a preparer on each of the nodes
+func newFakeStore(t *testing.T, nodes []types.NodeName) *fakeStore {
+	s := &fakeStore{
+		kv:      make(map[string][]byte),
+		stalled: make(map[types.NodeName]bool),
+		failing: make(map[types.NodeName]error),
+		locks:   make(map[string]*fakeStoreSession),
+		records: make(map[string]consul.ReplicationRecord),
+	}
+	preparer := manifest.NewBuilder()
+	preparer.SetID(constants.PreparerPodID)
+	for _, node := range nodes {
+		s.setPod(t, consul.REALITY_TREE, node, preparer.GetManifest())
+	}
+	return s
+}
+
+func (s *fakeStore) setPod(t *testing.T, podPrefix consul.PodPrefix, node types.NodeName, man manifest.Manifest) {
+	key, err := consul.PodPath(podPrefix, node, man.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifestBytes, err := man.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	s.kv[key] = manifestBytes
+	s.mu.Unlock()
+}
+
+// stall stops the preparer of the node from installing what it is given
+func (s *fakeStore) stall(node types.NodeName) {
+	s.mu.Lock()
+	s.stalled[node] = true
+	s.mu.Unlock()
+}
+
+// unstall lets the preparer of the node install what it is given next
+func (s *fakeStore) unstall(node types.NodeName) {
+	s.mu.Lock()
+	delete(s.stalled, node)
+	s.mu.Unlock()
+}
+
+// failIntentWrites makes every write of the node's intent fail with err
+func (s *fakeStore) failIntentWrites(node types.NodeName, err error) {
+	s.mu.Lock()
+	s.failing[node] = err
+	s.mu.Unlock()
+}
+
+// podSHA returns the SHA of the pod's manifest on the node, or "" if there
+// is none
+func (s *fakeStore) podSHA(t *testing.T, podPrefix consul.PodPrefix, node types.NodeName, podID types.PodID) string {
+	man, _, err := s.Pod(podPrefix, node, podID)
+	if err == pods.NoCurrentManifest {
+		return ""
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	sha, err := man.SHA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sha
+}
+
+func (s *fakeStore) Txn(ops api.KVTxnOps, _ *api.QueryOptions) (bool, *api.KVTxnResponse, *api.QueryMeta, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, op := range ops {
+		keys := []string{op.Key}
+		parts := strings.SplitN(op.Key, "/", 3)
+		if len(parts) == 3 && parts[0] == consul.INTENT_TREE.String() && !s.stalled[types.NodeName(parts[1])] {
+			keys = append(keys, strings.Join([]string{consul.REALITY_TREE.String(), parts[1], parts[2]}, "/"))
+		}
+		for _, key := range keys {
+			switch op.Verb {
+			case string(api.KVSet):
+				s.kv[key] = op.Value
+			case string(api.KVDelete):
+				delete(s.kv, key)
+			default:
+				return false, nil, nil, util.Errorf("%s is not supported by fakeStore", op.Verb)
+			}
+		}
+	}
+	return true, &api.KVTxnResponse{}, &api.QueryMeta{}, nil
+}
+
+func (s *fakeStore) SetPodTxn(ctx context.Context, podPrefix consul.PodPrefix, node types.NodeName, man manifest.Manifest) error {
+	s.mu.Lock()
+	err := s.failing[node]
+	s.mu.Unlock()
+	if err != nil && podPrefix == consul.INTENT_TREE {
+		return err
+	}
+
+	key, err := consul.PodPath(podPrefix, node, man.ID())
+	if err != nil {
+		return err
+	}
+	manifestBytes, err := man.Marshal()
+	if err != nil {
+		return err
+	}
+	return transaction.Add(ctx, api.KVTxnOp{
+		Verb:  string(api.KVSet),
+		Key:   key,
+		Value: manifestBytes,
+	})
+}
+
+func (s *fakeStore) DeletePodTxn(ctx context.Context, podPrefix consul.PodPrefix, node types.NodeName, podID types.PodID) error {
+	key, err := consul.PodPath(podPrefix, node, podID)
+	if err != nil {
+		return err
+	}
+	return transaction.Add(ctx, api.KVTxnOp{
+		Verb: string(api.KVDelete),
+		Key:  key,
+	})
+}
+
+func (s *fakeStore) ConsistentPod(podPrefix consul.PodPrefix, node types.NodeName, podID types.PodID) (manifest.Manifest, time.Duration, error) {
+	return s.Pod(podPrefix, node, podID)
+}
+
+func (s *fakeStore) Pod(podPrefix consul.PodPrefix, node types.NodeName, podID types.PodID) (manifest.Manifest, time.Duration, error) {
+	key, err := consul.PodPath(podPrefix, node, podID)
+	if err != nil {
+		return nil, 0, err
+	}
+	s.mu.Lock()
+	manifestBytes, ok := s.kv[key]
+	s.mu.Unlock()
+	if !ok {
+		return nil, 0, pods.NoCurrentManifest
+	}
+	man, err := manifest.FromBytes(manifestBytes)
+	return man, 0, err
+}
+
+func (s *fakeStore) NewSession(name string, _ <-chan time.Time) (consul.Session, chan error, error) {
+	session := &fakeStoreSession{
+		store:        s,
+		id:           uuid.New(),
+		name:         name,
+		renewalErrCh: make(chan error, 1),
+	}
+	return session, session.renewalErrCh, nil
+}
+
+func (s *fakeStore) LockHolder(key string) (string, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	holder, ok := s.locks[key]
+	if !ok {
+		return "", "", nil
+	}
+	return holder.name, holder.id, nil
+}
+
+// DestroyLockHolder releases the session's locks and reports that the
+// session was lost to its holder, as its next renewal would
+func (s *fakeStore) DestroyLockHolder(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, holder := range s.locks {
+		if holder.id != id {
+			continue
+		}
+		delete(s.locks, key)
+		select {
+		case holder.renewalErrCh <- util.Errorf("session %s was destroyed", id):
+		default:
+		}
+	}
+	return nil
+}
+
+func (s *fakeStore) DeployBudget() (int, error) {
+	return 0, nil
+}
+
+func (s *fakeStore) ReplicationPause(types.PodID) (*consul.ReplicationPause, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused, nil
+}
+
+func (s *fakeStore) PauseReplication(_ types.PodID, pausedBy string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = &consul.ReplicationPause{PausedBy: pausedBy, Time: time.Now()}
+	return nil
+}
+
+func (s *fakeStore) ResumeReplication(types.PodID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = nil
+	return nil
+}
+
+func (s *fakeStore) PutReplicationRecord(record consul.ReplicationRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[record.ID] = record
+	return nil
+}
+
+func (s *fakeStore) DeleteReplicationRecord(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, id)
+	return nil
+}
+
+func (s *fakeStore) record(id string) (consul.ReplicationRecord, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[id]
+	return record, ok
+}
+
+// fakeStoreSession is a session of a fakeStore. Only Lock() is supported.
+type fakeStoreSession struct {
+	store        *fakeStore
+	id           string
+	name         string
+	renewalErrCh chan error
+}
+
+var _ consul.Session = &fakeStoreSession{}
+
+func (f *fakeStoreSession) Lock(key string) (consul.Unlocker, error) {
+	f.store.mu.Lock()
+	defer f.store.mu.Unlock()
+	if holder, ok := f.store.locks[key]; ok && holder != f {
+		return nil, consul.AlreadyLockedError{Key: key}
+	}
+	f.store.locks[key] = f
+	return fakeStoreUnlocker{session: f, key: key}, nil
+}
+
+func (f *fakeStoreSession) LockTxn(context.Context, string) (consul.TxnUnlocker, error) {
+	return nil, util.Errorf("LockTxn is not supported by fakeStoreSession")
+}
+
+func (f *fakeStoreSession) UnlockTxn(context.Context, string, []byte) error {
+	return util.Errorf("UnlockTxn is not supported by fakeStoreSession")
+}
+
+func (f *fakeStoreSession) LockIfKeyNotExistsTxn(context.Context, string, []byte) (consul.TxnUnlocker, error) {
+	return nil, util.Errorf("LockIfKeyNotExistsTxn is not supported by fakeStoreSession")
+}
+
+func (f *fakeStoreSession) Renew() error {
+	return nil
+}
+
+func (f *fakeStoreSession) Destroy() error {
+	f.store.mu.Lock()
+	defer f.store.mu.Unlock()
+	for key, holder := range f.store.locks {
+		if holder == f {
+			delete(f.store.locks, key)
+		}
+	}
+	return nil
+}
+
+func (f *fakeStoreSession) Session() string {
+	return f.id
+}
+
+type fakeStoreUnlocker struct {
+	session *fakeStoreSession
+	key     string
+}
+
+func (u fakeStoreUnlocker) Unlock() error {
+	u.session.store.mu.Lock()
+	defer u.session.store.mu.Unlock()
+	if u.session.store.locks[u.key] == u.session {
+		delete(u.session.store.locks, u.key)
+	}
+	return nil
+}
+
+func (u fakeStoreUnlocker) Key() string {
+	return u.key
+}
+
+// fakeHealthChecker reports whatever health the test last set for each node.
+// Nodes without a result are reported as missing, which replications treat
+// as critical.
+type fakeHealthChecker struct {
+	mu      sync.Mutex
+	results map[types.NodeName]health.Result
+}
+
+func newFakeHealthChecker(nodes []types.NodeName, status health.HealthState) *fakeHealthChecker {
+	h := &fakeHealthChecker{results: make(map[types.NodeName]health.Result)}
+	for _, node := range nodes {
+		h.setHealth(node, status)
+	}
+	return h
+}
+
+func (h *fakeHealthChecker) setHealth(node types.NodeName, status health.HealthState) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.results[node] = health.Result{ID: testPodId, Node: node, Status: status}
+}
+
+func (h *fakeHealthChecker) Service(string) (map[types.NodeName]health.Result, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	results := make(map[types.NodeName]health.Result, len(h.results))
+	for node, res := range h.results {
+		results[node] = res
+	}
+	return results, nil
+}
+
+func (h *fakeHealthChecker) WatchService(
+	ctx context.Context,
+	serviceID string,
+	resultCh chan<- map[types.NodeName]health.Result,
+	errCh chan<- error,
+	watchDelay time.Duration,
+) {
+	for {
+		results, _ := h.Service(serviceID)
+		select {
+		case <-ctx.Done():
+			return
+		case resultCh <- results:
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func (h *fakeHealthChecker) WatchPodOnNode(types.NodeName, types.PodID, <-chan struct{}) (chan health.Result, chan error) {
+	panic("not implemented")
+}
+
+func (h *fakeHealthChecker) WatchHealth(chan []*health.Result, chan<- error, <-chan struct{}, time.Duration) {
+	panic("not implemented")
+}
+
+func (h *fakeHealthChecker) History(types.NodeName, string, int) ([]health.HistoryEntry, error) {
+	panic("not implemented")
+}
+
+// fakeReplicator returns a replicator of basicManifest() to the given nodes
+// that only uses the given fakes
+func fakeReplicator(t *testing.T, nodes []types.NodeName, active int, store *fakeStore, healthChecker *fakeHealthChecker, timeout time.Duration) Replicator {
+	replicator, err := NewReplicator(
+		basicManifest(),
+		logging.TestLogger(),
+		nodes,
+		active,
+		store,
+		store,
+		labels.NewFakeApplicator(),
+		healthChecker,
+		health.Passing,
+		testLockMessage,
+		timeout,
+		0,
+	)
+	if err != nil {
+		t.Fatalf("Unable to initialize replicator: %s", err)
+	}
+	return replicator
+}
+
+// fastPolling makes replications check reality and health every few
+// milliseconds. The returned function restores the previous intervals.
+func fastPolling() func() {
+	oldReality, oldHealthy := *ensureRealityPeriodMillis, *ensureHealthyPeriodMillis
+	*ensureRealityPeriodMillis = 5
+	*ensureHealthyPeriodMillis = 5
+	return func() {
+		*ensureRealityPeriodMillis = oldReality
+		*ensureHealthyPeriodMillis = oldHealthy
+	}
+}
+
+// collectPhases reads the progress updates until the channel is closed and
+// returns the phases each node went through
+func collectPhases(progress <-chan NodeProgress) <-chan map[types.NodeName][]NodePhase {
+	phasesCh := make(chan map[types.NodeName][]NodePhase, 1)
+	go func() {
+		phases := make(map[types.NodeName][]NodePhase)
+		for update := range progress {
+			phases[update.Node] = append(phases[update.Node], update.Phase)
+		}
+		phasesCh <- phases
+	}()
+	return phasesCh
+}
+
+// collectErrors reads the replication's errors until the channel is closed
+func collectErrors(errCh <-chan error) <-chan []error {
+	errsCh := make(chan []error, 1)
+	go func() {
+		var errs []error
+		for err := range errCh {
+			errs = append(errs, err)
+		}
+		errsCh <- errs
+	}()
+	return errsCh
+}
+
+func lastPhase(phases []NodePhase) NodePhase {
+	if len(phases) == 0 {
+		return ""
+	}
+	return phases[len(phases)-1]
+}
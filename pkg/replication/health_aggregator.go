@@ -2,6 +2,7 @@ package replication
 
 import (
 	"context"
+	"reflect"
 	"sync"
 	"time"
 
@@ -15,8 +16,11 @@ type podHealth struct {
 	checker checker.HealthChecker
 	quit    chan struct{}
 
-	cond      *sync.Cond // guards curHealth
+	cond      *sync.Cond // guards curHealth and updated
 	curHealth map[types.NodeName]health.Result
+
+	// Closed, and replaced, whenever curHealth changes
+	updated chan struct{}
 }
 
 func AggregateHealth(id types.PodID, checker checker.HealthChecker, watchDelay time.Duration) *podHealth {
@@ -25,6 +29,7 @@ func AggregateHealth(id types.PodID, checker checker.HealthChecker, watchDelay t
 		checker: checker,
 		cond:    sync.NewCond(&sync.Mutex{}),
 		quit:    make(chan struct{}),
+		updated: make(chan struct{}),
 	}
 	go p.beginWatch(watchDelay)
 
@@ -74,7 +79,11 @@ func (p *podHealth) beginWatch(watchDelay time.Duration) {
 			}
 			p.cond.L.Lock()
 			p.cond.Broadcast()
-			p.curHealth = res
+			if p.curHealth == nil || !reflect.DeepEqual(p.curHealth, res) {
+				p.curHealth = res
+				close(p.updated)
+				p.updated = make(chan struct{})
+			}
 			p.cond.L.Unlock()
 		}
 	}
@@ -87,13 +96,41 @@ func (p *podHealth) GetHealth(host types.NodeName) (health.Result, bool) {
 	return h, ok
 }
 
+// healthAndUpdates is GetHealth, along with a channel that is closed the next
+// time the health of any node changes
+func (p *podHealth) healthAndUpdates(host types.NodeName) (health.Result, bool, <-chan struct{}) {
+	p.cond.L.Lock()
+	defer p.cond.L.Unlock()
+	h, ok := p.curHealth[host]
+	return h, ok, p.updated
+}
+
+// updates returns a channel that is closed the next time the health of any
+// node changes
+func (p *podHealth) updates() <-chan struct{} {
+	p.cond.L.Lock()
+	defer p.cond.L.Unlock()
+	return p.updated
+}
+
+// snapshot returns a copy of the latest health of every node
+func (p *podHealth) snapshot() map[types.NodeName]health.Result {
+	p.cond.L.Lock()
+	defer p.cond.L.Unlock()
+	results := make(map[types.NodeName]health.Result, len(p.curHealth))
+	for host, res := range p.curHealth {
+		results[host] = res
+	}
+	return results
+}
+
 func (p *podHealth) numOfHealth(status health.HealthState, hosts []types.NodeName) int {
 	p.cond.L.Lock()
 	defer p.cond.L.Unlock()
 	count := 0
 	for _, host := range hosts {
 		h, ok := p.curHealth[host]
-		if ok && h.Status == status {
+		if ok && h.ReadinessStatus() == status {
 			count++
 		}
 	}
@@ -0,0 +1,39 @@
+package replication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestAggregateHealthSignalsChanges(t *testing.T) {
+	healthChecker, resultsCh := channelHealthChecker(nil, t)
+	passing := map[types.NodeName]health.Result{"node1": {ID: testPodId, Status: health.Passing}}
+	go func() { resultsCh <- passing }()
+	aggregateHealth := AggregateHealth(testPodId, healthChecker, 0)
+	defer aggregateHealth.Stop()
+
+	res, ok, updated := aggregateHealth.healthAndUpdates("node1")
+	if !ok || res.Status != health.Passing {
+		t.Fatalf("expected node1 to be passing, got %+v", res)
+	}
+
+	// the checker keeps sending the same results, which aren't a change
+	select {
+	case <-updated:
+		t.Fatal("expected unchanged results not to be signalled")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	resultsCh <- map[types.NodeName]health.Result{"node1": {ID: testPodId, Status: health.Critical}}
+	select {
+	case <-updated:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the change of node1's health to be signalled")
+	}
+	if res, _ := aggregateHealth.GetHealth("node1"); res.Status != health.Critical {
+		t.Errorf("expected node1 to be critical, got %+v", res)
+	}
+}
@@ -0,0 +1,161 @@
+package replication
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/types"
+)
+
+// MinHealthy is how many of the hosts of a pod must stay healthy while it is
+// replicated, counting every host the health checker knows the pod to be on
+// as well as the hosts being replicated to. Hosts being updated count as
+// unhealthy until they become healthy again. The zero value has no minimum.
+type MinHealthy struct {
+	// A number of hosts
+	Count int
+	// A percentage of the hosts, rounded up
+	Percent int
+}
+
+// ParseMinHealthy parses a number of hosts, e.g. "8", or a percentage of
+// them, e.g. "90%"
+func ParseMinHealthy(s string) (MinHealthy, error) {
+	if strings.HasSuffix(s, "%") {
+		percent, err := strconv.Atoi(strings.TrimSuffix(s, "%"))
+		if err != nil || percent < 0 || percent > 100 {
+			return MinHealthy{}, errors.Errorf("%q is not a percentage between 0%% and 100%%", s)
+		}
+		return MinHealthy{Percent: percent}, nil
+	}
+	count, err := strconv.Atoi(s)
+	if err != nil || count < 0 {
+		return MinHealthy{}, errors.Errorf("%q is not a number of hosts or a percentage", s)
+	}
+	return MinHealthy{Count: count}, nil
+}
+
+// of returns the number of the given total hosts that must stay healthy
+func (m MinHealthy) of(total int) int {
+	if m.Percent > 0 {
+		return (total*m.Percent + 99) / 100
+	}
+	return m.Count
+}
+
+func (m MinHealthy) String() string {
+	if m.Percent > 0 {
+		return strconv.Itoa(m.Percent) + "%"
+	}
+	return strconv.Itoa(m.Count)
+}
+
+func (r *replication) SetMinHealthy(min MinHealthy) {
+	r.mu.Lock()
+	r.minHealthy = min
+	r.mu.Unlock()
+}
+
+// waitForMinHealthy blocks until the node can be taken down without leaving
+// fewer healthy hosts than the replication's minimum. The returned function
+// must be called once the node is healthy again, or its update is abandoned.
+func (r *replication) waitForMinHealthy(
+	ctx context.Context,
+	node types.NodeName,
+	aggregateHealth *podHealth,
+	nodeLogger logging.Logger,
+) (func(), error) {
+	r.mu.RLock()
+	min := r.minHealthy
+	r.mu.RUnlock()
+	if min == (MinHealthy{}) {
+		return func() {}, nil
+	}
+
+	waiting := false
+	for {
+		updated := aggregateHealth.updates()
+		ok, healthy, total := r.claimUnhealthy(node, min, aggregateHealth)
+		if ok {
+			if waiting {
+				nodeLogger.NoFields().Infoln("Enough hosts are healthy to update this node")
+			}
+			return func() { r.releaseUnhealthy(node) }, nil
+		}
+		if !waiting {
+			nodeLogger.WithFields(logrus.Fields{
+				"healthy":     healthy,
+				"total":       total,
+				"min_healthy": min.String(),
+			}).Infoln("Updating this node would leave too few healthy hosts, waiting")
+			waiting = true
+		}
+
+		select {
+		case <-r.quitCh:
+			return nil, errQuit
+		case <-ctx.Done():
+			return nil, errTimeout
+		case <-r.replicationCancelledCh:
+			return nil, errCancelled
+		case <-updated:
+		// other nodes finishing their updates isn't signalled, so this
+		// still has to check periodically
+		case <-time.After(time.Duration(*ensureHealthyPeriodMillis) * time.Millisecond):
+		}
+	}
+}
+
+// claimUnhealthy marks the node as being updated if that leaves enough
+// healthy hosts, and returns whether it did along with the number of healthy
+// hosts and the total it was judged against. Updating a node that is already
+// unhealthy doesn't make things worse, so it is always allowed.
+func (r *replication) claimUnhealthy(node types.NodeName, min MinHealthy, aggregateHealth *podHealth) (bool, int, int) {
+	r.minHealthyMu.Lock()
+	defer r.minHealthyMu.Unlock()
+
+	results := aggregateHealth.snapshot()
+	hosts := make(map[types.NodeName]bool)
+	for host := range results {
+		hosts[host] = true
+	}
+	for _, host := range r.nodes {
+		hosts[host] = true
+	}
+
+	healthy := 0
+	for host := range hosts {
+		// A missing result is zero, which is treated like "critical"
+		if !r.updating[host] && health.Compare(results[host].GatingStatus(), r.healthThreshold()) >= 0 {
+			healthy++
+		} else if r.shuttingDown(host) {
+			// hosts being taken out of service are expected to lose
+			// the pod, and aren't counted at all
+			delete(hosts, host)
+		}
+	}
+
+	nodeHealthy := !r.updating[node] && health.Compare(results[node].GatingStatus(), r.healthThreshold()) >= 0
+	if nodeHealthy && healthy-1 < min.of(len(hosts)) {
+		return false, healthy, len(hosts)
+	}
+
+	if r.updating == nil {
+		r.updating = make(map[types.NodeName]bool)
+	}
+	r.updating[node] = true
+	return true, healthy, len(hosts)
+}
+
+func (r *replication) releaseUnhealthy(node types.NodeName) {
+	r.minHealthyMu.Lock()
+	defer r.minHealthyMu.Unlock()
+	delete(r.updating, node)
+}
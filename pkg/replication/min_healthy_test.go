@@ -0,0 +1,76 @@
+package replication
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestParseMinHealthy(t *testing.T) {
+	for s, expected := range map[string]MinHealthy{
+		"8":    {Count: 8},
+		"0":    {},
+		"90%":  {Percent: 90},
+		"100%": {Percent: 100},
+	} {
+		min, err := ParseMinHealthy(s)
+		if err != nil {
+			t.Errorf("unexpected error parsing %q: %s", s, err)
+			continue
+		}
+		if min != expected {
+			t.Errorf("expected %q to parse as %+v, got %+v", s, expected, min)
+		}
+	}
+
+	for _, s := range []string{"", "-1", "101%", "ten", "10.5%"} {
+		if _, err := ParseMinHealthy(s); err == nil {
+			t.Errorf("expected %q not to parse", s)
+		}
+	}
+}
+
+func TestMinHealthyOf(t *testing.T) {
+	if n := (MinHealthy{Percent: 90}).of(15); n != 14 {
+		t.Errorf("expected 90%% of 15 hosts to round up to 14, got %d", n)
+	}
+	if n := (MinHealthy{Count: 3}).of(15); n != 3 {
+		t.Errorf("expected a count of 3 to be 3 hosts, got %d", n)
+	}
+}
+
+func TestClaimUnhealthy(t *testing.T) {
+	aggregateHealth := &podHealth{
+		cond: sync.NewCond(&sync.Mutex{}),
+		curHealth: map[types.NodeName]health.Result{
+			"a":     {Status: health.Passing},
+			"b":     {Status: health.Passing},
+			"c":     {Status: health.Critical},
+			"other": {Status: health.Passing},
+		},
+	}
+	r := &replication{nodes: []types.NodeName{"a", "b", "c", "d"}}
+	// 5 hosts, of which "c" and "d" (which has no result) are unhealthy
+	min := MinHealthy{Count: 2}
+
+	ok, healthy, total := r.claimUnhealthy("a", min, aggregateHealth)
+	if !ok || healthy != 3 || total != 5 {
+		t.Fatalf("expected a to be claimed with 3 of 5 hosts healthy, got %t with %d of %d", ok, healthy, total)
+	}
+	ok, _, _ = r.claimUnhealthy("b", min, aggregateHealth)
+	if ok {
+		t.Error("expected b not to be claimed while a is being updated, which would leave one healthy host")
+	}
+	ok, _, _ = r.claimUnhealthy("c", min, aggregateHealth)
+	if !ok {
+		t.Error("expected c to be claimed because it is already unhealthy")
+	}
+
+	r.releaseUnhealthy("a")
+	ok, _, _ = r.claimUnhealthy("b", min, aggregateHealth)
+	if !ok {
+		t.Error("expected b to be claimed once a is done")
+	}
+}
@@ -0,0 +1,97 @@
+package replication
+
+import (
+	"fmt"
+
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/webhook"
+)
+
+// replicationOrchestrator identifies replications in webhook events
+const replicationOrchestrator = "replication"
+
+func (r *replication) SetNotifier(notifier webhook.Notifier) {
+	r.notifyMu.Lock()
+	r.notifier = notifier
+	r.notifyMu.Unlock()
+}
+
+// notify sends a lifecycle event of the replication to the notifier, if the
+// caller set one. Events are identified by the replication's record ID if it
+// has a record, and by the manifest's SHA otherwise.
+func (r *replication) notify(eventType webhook.EventType, message string, details map[string]interface{}) {
+	r.notifyMu.Lock()
+	notifier := r.notifier
+	r.notifyMu.Unlock()
+	if notifier == nil {
+		return
+	}
+
+	man := r.GetManifest()
+	deploymentID, err := man.SHA()
+	if err != nil {
+		r.logger.WithError(err).Warnln("Could not compute manifest SHA for webhook event")
+	}
+	r.recordMu.Lock()
+	if r.record != nil {
+		deploymentID = r.record.ID
+	}
+	r.recordMu.Unlock()
+
+	notifier.Notify(webhook.Event{
+		Type:         eventType,
+		Orchestrator: replicationOrchestrator,
+		DeploymentID: deploymentID,
+		PodID:        man.ID().String(),
+		Message:      message,
+		Details:      details,
+	})
+}
+
+// notifyPaused sends a paused event the first time the replication is seen to
+// be paused, and notifyResumed lets the next pause send one again. Every
+// update goroutine checks for the pause on its own.
+func (r *replication) notifyPaused(pause *consul.ReplicationPause) {
+	r.notifyMu.Lock()
+	notified := r.pauseNotified
+	r.pauseNotified = true
+	r.notifyMu.Unlock()
+	if notified {
+		return
+	}
+	r.notify(webhook.EventPaused, fmt.Sprintf("Replication of %s was paused by %s", r.GetManifest().ID(), pause.PausedBy), map[string]interface{}{
+		"paused_by": pause.PausedBy,
+		"paused_at": pause.Time,
+	})
+}
+
+func (r *replication) notifyResumed() {
+	r.notifyMu.Lock()
+	r.pauseNotified = false
+	r.notifyMu.Unlock()
+}
+
+// notifyFailed sends the event for a replication that stopped because a node
+// failed, which is a rollback under the RollbackOnFailure policy
+func (r *replication) notifyFailed(err error) {
+	if r.rollsBack() {
+		r.notify(webhook.EventRolledBack, fmt.Sprintf("Replication of %s was rolled back: %s", r.GetManifest().ID(), err), nil)
+		return
+	}
+	r.notify(webhook.EventAborted, fmt.Sprintf("Replication of %s was aborted: %s", r.GetManifest().ID(), err), nil)
+}
+
+// notifyFinished sends the event for a replication that updated every node it
+// could, which still succeeds if some nodes failed when the rollback policy
+// lets it carry on past them
+func (r *replication) notifyFinished(failed []types.NodeName) {
+	podID := r.GetManifest().ID()
+	if len(failed) == 0 {
+		r.notify(webhook.EventSucceeded, fmt.Sprintf("Replication of %s completed", podID), nil)
+		return
+	}
+	r.notify(webhook.EventSucceeded, fmt.Sprintf("Replication of %s completed, %d nodes failed", podID, len(failed)), map[string]interface{}{
+		"failed": failed,
+	})
+}
@@ -0,0 +1,107 @@
+package replication
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/webhook"
+)
+
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events []webhook.Event
+}
+
+func (r *recordingNotifier) Notify(event webhook.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recordingNotifier) types() []webhook.EventType {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var types []webhook.EventType
+	for _, event := range r.events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func TestEnactNotifiesSuccess(t *testing.T) {
+	defer fastPolling()()
+	store := newFakeStore(t, scenarioNodes)
+	repl, errsCh := startFakeReplication(t, store, newFakeHealthChecker(scenarioNodes, health.Passing), 10*time.Second)
+	record, err := NewRecord(basicManifest(), scenarioNodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repl.SetRecord(record)
+	notifier := &recordingNotifier{}
+	repl.SetNotifier(notifier)
+
+	enactWithin(t, repl, 10*time.Second)
+	<-errsCh
+
+	expected := []webhook.EventType{webhook.EventStarted, webhook.EventSucceeded}
+	if types := notifier.types(); !reflect.DeepEqual(types, expected) {
+		t.Fatalf("expected events %v, got %v", expected, types)
+	}
+	for _, event := range notifier.events {
+		if event.DeploymentID != record.ID || event.PodID != testPodId || event.Orchestrator != replicationOrchestrator {
+			t.Errorf("expected events to identify the replication by its record, got %+v", event)
+		}
+	}
+}
+
+func TestEnactNotifiesRollback(t *testing.T) {
+	defer fastPolling()()
+	store := newFakeStore(t, scenarioNodes)
+	store.stall("node3")
+	repl, errsCh := startFakeReplication(t, store, newFakeHealthChecker(scenarioNodes, health.Passing), 200*time.Millisecond)
+	repl.SetRollbackPolicy(RollbackOnFailure)
+	notifier := &recordingNotifier{}
+	repl.SetNotifier(notifier)
+
+	enactWithin(t, repl, 10*time.Second)
+	<-errsCh
+
+	expected := []webhook.EventType{webhook.EventStarted, webhook.EventRolledBack}
+	if types := notifier.types(); !reflect.DeepEqual(types, expected) {
+		t.Errorf("expected events %v, got %v", expected, types)
+	}
+}
+
+func TestEnactNotifiesPause(t *testing.T) {
+	defer fastPolling()()
+	oldPoll := *pausePollMillis
+	*pausePollMillis = 5
+	defer func() { *pausePollMillis = oldPoll }()
+
+	store := newFakeStore(t, scenarioNodes)
+	err := store.PauseReplication(testPodId, "tester")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repl, errsCh := startFakeReplication(t, store, newFakeHealthChecker(scenarioNodes, health.Passing), 10*time.Second)
+	notifier := &recordingNotifier{}
+	repl.SetNotifier(notifier)
+
+	go func() {
+		// resume once the pause was sent
+		for len(notifier.types()) < 2 {
+			time.Sleep(5 * time.Millisecond)
+		}
+		_ = store.ResumeReplication(testPodId)
+	}()
+	enactWithin(t, repl, 10*time.Second)
+	<-errsCh
+
+	expected := []webhook.EventType{webhook.EventStarted, webhook.EventPaused, webhook.EventSucceeded}
+	if types := notifier.types(); !reflect.DeepEqual(types, expected) {
+		t.Errorf("expected events %v, got %v", expected, types)
+	}
+}
@@ -0,0 +1,131 @@
+package replication
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/types"
+)
+
+// OrderStrategy is how the nodes of a replication are ordered before they
+// are updated
+type OrderStrategy string
+
+const (
+	// Nodes are updated from least to most healthy, so that unhealthy
+	// nodes are fixed first. This is the default.
+	OrderHealth OrderStrategy = "health"
+	// Nodes are updated in alphabetical order of their names
+	OrderAlphabetical OrderStrategy = "alphabetical"
+	// Nodes are updated one availability zone at a time, in alphabetical
+	// order of the zones' names. Nodes without an availability zone label
+	// are updated last.
+	OrderZone OrderStrategy = "zone"
+	// Nodes are updated in a random order determined by Order.Seed
+	OrderShuffle OrderStrategy = "shuffle"
+)
+
+// Order is the order the nodes of a replication are updated in. Ties are
+// broken by node name, so that a replication of the same nodes always
+// updates them in the same order given the same health and labels. The zero
+// value orders nodes by health.
+type Order struct {
+	Strategy OrderStrategy
+	// The seed of the random order of OrderShuffle
+	Seed int64
+}
+
+// ParseOrder parses one of "health", "alphabetical", "zone" or
+// "shuffle:<seed>"
+func ParseOrder(s string) (Order, error) {
+	strategy, seed := s, ""
+	if i := strings.Index(s, ":"); i >= 0 {
+		strategy, seed = s[:i], s[i+1:]
+	}
+
+	switch OrderStrategy(strategy) {
+	case OrderHealth, OrderAlphabetical, OrderZone:
+		if seed != "" {
+			return Order{}, errors.Errorf("%q does not take a seed", strategy)
+		}
+		return Order{Strategy: OrderStrategy(strategy)}, nil
+	case OrderShuffle:
+		n, err := strconv.ParseInt(seed, 10, 64)
+		if err != nil {
+			return Order{}, errors.Errorf("%q needs an integer seed, e.g. shuffle:42", s)
+		}
+		return Order{Strategy: OrderShuffle, Seed: n}, nil
+	default:
+		return Order{}, errors.Errorf("%q is not one of health, alphabetical, zone or shuffle:<seed>", s)
+	}
+}
+
+func (o Order) String() string {
+	switch o.Strategy {
+	case "":
+		return string(OrderHealth)
+	case OrderShuffle:
+		return string(OrderShuffle) + ":" + strconv.FormatInt(o.Seed, 10)
+	default:
+		return string(o.Strategy)
+	}
+}
+
+func (r *replication) SetOrder(order Order) {
+	r.mu.Lock()
+	r.order = order
+	r.mu.Unlock()
+}
+
+// orderNodes returns a copy of the nodes in the given order. The health
+// results are only used to order by health, and the labeler is only used to
+// order by availability zone.
+func orderNodes(
+	nodes []types.NodeName,
+	order Order,
+	healthResults map[types.NodeName]health.Result,
+	labeler Labeler,
+) ([]types.NodeName, error) {
+	ordered := make([]types.NodeName, len(nodes))
+	copy(ordered, nodes)
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i] < ordered[j] })
+
+	switch order.Strategy {
+	case "", OrderHealth:
+		sort.Stable(health.SortOrder{
+			Nodes:  ordered,
+			Health: healthResults,
+		})
+	case OrderAlphabetical:
+	case OrderZone:
+		zones := make(map[types.NodeName]string, len(ordered))
+		for _, node := range ordered {
+			nodeLabels, err := labeler.GetLabels(labels.NODE, node.String())
+			if err != nil {
+				return nil, errors.Errorf("could not get the labels of %s: %w", node, err)
+			}
+			zones[node] = nodeLabels.Labels[types.AvailabilityZoneLabel]
+		}
+		sort.SliceStable(ordered, func(i, j int) bool {
+			iZone, jZone := zones[ordered[i]], zones[ordered[j]]
+			if iZone == "" || jZone == "" {
+				return jZone == "" && iZone != ""
+			}
+			return iZone < jZone
+		})
+	case OrderShuffle:
+		sorted := ordered
+		ordered = make([]types.NodeName, len(sorted))
+		for i, j := range rand.New(rand.NewSource(order.Seed)).Perm(len(sorted)) {
+			ordered[i] = sorted[j]
+		}
+	default:
+		return nil, errors.Errorf("unknown order %q", order.Strategy)
+	}
+	return ordered, nil
+}
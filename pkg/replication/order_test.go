@@ -0,0 +1,92 @@
+package replication
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestParseOrder(t *testing.T) {
+	for s, expected := range map[string]Order{
+		"health":       {Strategy: OrderHealth},
+		"alphabetical": {Strategy: OrderAlphabetical},
+		"zone":         {Strategy: OrderZone},
+		"shuffle:42":   {Strategy: OrderShuffle, Seed: 42},
+	} {
+		order, err := ParseOrder(s)
+		if err != nil {
+			t.Errorf("unexpected error parsing %q: %s", s, err)
+			continue
+		}
+		if order != expected {
+			t.Errorf("expected %q to parse as %+v, got %+v", s, expected, order)
+		}
+		if order.String() != s {
+			t.Errorf("expected %+v to print as %q, got %q", order, s, order.String())
+		}
+	}
+
+	for _, s := range []string{"", "random", "shuffle", "shuffle:x", "zone:1"} {
+		if _, err := ParseOrder(s); err == nil {
+			t.Errorf("expected %q not to parse", s)
+		}
+	}
+}
+
+func TestOrderNodes(t *testing.T) {
+	nodes := []types.NodeName{"d", "b", "e", "a", "c"}
+	healthResults := map[types.NodeName]health.Result{
+		"a": {Status: health.Passing},
+		"b": {Status: health.Passing},
+		"c": {Status: health.Critical},
+		"d": {Status: health.Warning},
+	}
+	labeler := labels.NewFakeApplicator()
+	for node, zone := range map[string]string{"a": "us-west-2b", "c": "us-west-2a", "d": "us-west-2b"} {
+		err := labeler.SetLabel(labels.NODE, node, types.AvailabilityZoneLabel, zone)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, c := range []struct {
+		order    Order
+		expected []types.NodeName
+	}{
+		{Order{}, []types.NodeName{"c", "e", "d", "a", "b"}},
+		{Order{Strategy: OrderHealth}, []types.NodeName{"c", "e", "d", "a", "b"}},
+		{Order{Strategy: OrderAlphabetical}, []types.NodeName{"a", "b", "c", "d", "e"}},
+		{Order{Strategy: OrderZone}, []types.NodeName{"c", "a", "d", "b", "e"}},
+	} {
+		ordered, err := orderNodes(nodes, c.order, healthResults, labeler)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(ordered, c.expected) {
+			t.Errorf("expected %s order %s, got %s", c.order, c.expected, ordered)
+		}
+	}
+
+	shuffled, err := orderNodes(nodes, Order{Strategy: OrderShuffle, Seed: 7}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shuffled) != len(nodes) {
+		t.Fatalf("expected the shuffled order to have %d nodes, got %s", len(nodes), shuffled)
+	}
+	reversed := []types.NodeName{"e", "d", "c", "b", "a"}
+	again, err := orderNodes(reversed, Order{Strategy: OrderShuffle, Seed: 7}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(shuffled, again) {
+		t.Errorf("expected the same seed to give the same order whatever the order of the nodes, got %s and %s", shuffled, again)
+	}
+
+	if !reflect.DeepEqual(nodes, []types.NodeName{"d", "b", "e", "a", "c"}) {
+		t.Errorf("expected the given nodes not to be reordered, got %s", nodes)
+	}
+}
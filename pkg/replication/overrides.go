@@ -0,0 +1,101 @@
+package replication
+
+import (
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+)
+
+// NodeOverride is how a single node's copy of the replicated manifest differs
+// from it, for pods whose nodes each need some config of their own, such as a
+// shard ID or whether the node seeds a cluster. Config is merged into the
+// manifest's config: maps are merged key by key, and any other value
+// replaces the manifest's value at the same path. Env is added to the
+// environment of every launchable, replacing variables of the same names.
+type NodeOverride struct {
+	Config map[interface{}]interface{} `yaml:"config,omitempty"`
+	Env    map[string]string           `yaml:"env,omitempty"`
+}
+
+// NodeOverrides are the overrides of each node that has any, keyed by the
+// node's name. The nodes without any are given the manifest as it is.
+type NodeOverrides map[types.NodeName]NodeOverride
+
+// LoadNodeOverrides reads the node overrides in a YAML file, such as
+//
+//	cassandra1.example.com:
+//	  config:
+//	    seed: true
+//	    shard_id: 1
+//	cassandra2.example.com:
+//	  config:
+//	    shard_id: 2
+//	  env:
+//	    HEAP_SIZE: 8g
+func LoadNodeOverrides(path string) (NodeOverrides, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Errorf("could not read node overrides: %w", err)
+	}
+	var overrides NodeOverrides
+	if err = yaml.Unmarshal(data, &overrides); err != nil {
+		return nil, errors.Errorf("could not parse node overrides in %s: %w", path, err)
+	}
+	return overrides, nil
+}
+
+// Apply returns the manifest that node is given: man with the node's override
+// merged in, or man itself if the node has none. The override changes the
+// manifest, so signed manifests can't be overridden.
+func (o NodeOverrides) Apply(man manifest.Manifest, node types.NodeName) (manifest.Manifest, error) {
+	override, ok := o[node]
+	if !ok || (len(override.Config) == 0 && len(override.Env) == 0) {
+		return man, nil
+	}
+	if _, signature := man.SignatureData(); signature != nil {
+		return nil, errors.Codef(errors.CodeInvalid, "%s has overrides, which would invalidate the signature of the manifest of %s", node, man.ID())
+	}
+
+	builder := man.GetBuilder()
+	if len(override.Config) > 0 {
+		err := builder.SetConfig(mergeConfig(man.GetConfig(), override.Config))
+		if err != nil {
+			return nil, errors.Codef(errors.CodeInvalid, "invalid config override of %s: %w", node, err)
+		}
+	}
+	if len(override.Env) > 0 {
+		stanzas := make(map[launch.LaunchableID]launch.LaunchableStanza)
+		for id, stanza := range man.GetLaunchableStanzas() {
+			env := make(map[string]string, len(stanza.Env)+len(override.Env))
+			for name, value := range stanza.Env {
+				env[name] = value
+			}
+			for name, value := range override.Env {
+				env[name] = value
+			}
+			stanza.Env = env
+			stanzas[id] = stanza
+		}
+		builder.SetLaunchables(stanzas)
+	}
+	return builder.GetManifest(), nil
+}
+
+// mergeConfig merges override into config, which it modifies, and returns it
+func mergeConfig(config map[interface{}]interface{}, override map[interface{}]interface{}) map[interface{}]interface{} {
+	for key, value := range override {
+		overrideMap, isMap := value.(map[interface{}]interface{})
+		configMap, wasMap := config[key].(map[interface{}]interface{})
+		if isMap && wasMap {
+			config[key] = mergeConfig(configMap, overrideMap)
+		} else {
+			config[key] = value
+		}
+	}
+	return config
+}
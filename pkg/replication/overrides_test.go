@@ -0,0 +1,161 @@
+package replication
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+)
+
+func TestLoadNodeOverrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overrides")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "overrides.yaml")
+	err = ioutil.WriteFile(path, []byte(`
+node1:
+  config:
+    seed: true
+    shard_id: 1
+node2:
+  env:
+    HEAP_SIZE: 8g
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	overrides, err := LoadNodeOverrides(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if overrides["node1"].Config["shard_id"] != 1 || overrides["node1"].Config["seed"] != true {
+		t.Errorf("expected node1 to be shard 1 and a seed, got %v", overrides["node1"])
+	}
+	if overrides["node2"].Env["HEAP_SIZE"] != "8g" {
+		t.Errorf("expected node2 to have a heap size, got %v", overrides["node2"])
+	}
+}
+
+func TestNodeOverridesApply(t *testing.T) {
+	builder := manifest.NewBuilder()
+	builder.SetID("cassandra")
+	err := builder.SetConfig(map[interface{}]interface{}{
+		"cluster": "main",
+		"storage": map[interface{}]interface{}{"path": "/data", "compaction": "leveled"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"app": {LaunchableType: "hoist", Env: map[string]string{"HEAP_SIZE": "4g", "LOG": "info"}},
+	})
+	man := builder.GetManifest()
+	sha, _ := man.SHA()
+
+	overrides := NodeOverrides{
+		"node1": {
+			Config: map[interface{}]interface{}{
+				"shard_id": 1,
+				"storage":  map[interface{}]interface{}{"path": "/data1"},
+			},
+			Env: map[string]string{"HEAP_SIZE": "8g"},
+		},
+	}
+	node1, err := overrides.Apply(man, "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := node1.GetConfig()
+	storage := config["storage"].(map[interface{}]interface{})
+	if config["shard_id"] != 1 || config["cluster"] != "main" || storage["path"] != "/data1" || storage["compaction"] != "leveled" {
+		t.Errorf("expected the override to be merged into the config, got %v", config)
+	}
+	env := node1.GetLaunchableStanzas()["app"].Env
+	if env["HEAP_SIZE"] != "8g" || env["LOG"] != "info" {
+		t.Errorf("expected the override to be merged into the env, got %v", env)
+	}
+
+	if unchanged, _ := man.SHA(); unchanged != sha || man.GetLaunchableStanzas()["app"].Env["HEAP_SIZE"] != "4g" {
+		t.Error("expected the replicated manifest not to be modified")
+	}
+	node2, err := overrides.Apply(man, "node2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node2 != man {
+		t.Error("expected a node without overrides to be given the manifest as it is")
+	}
+}
+
+func TestReplicationAppliesNodeOverrides(t *testing.T) {
+	defer fastPolling()()
+	store := newFakeStore(t, scenarioNodes)
+	repl, errsCh := startFakeReplication(t, store, newFakeHealthChecker(scenarioNodes, health.Passing), NoTimeout)
+	overrides := NodeOverrides{
+		"node1": {Config: map[interface{}]interface{}{"seed": true}},
+	}
+	repl.SetNodeOverrides(overrides)
+
+	enactWithin(t, repl, 10*time.Second)
+	if errs := <-errsCh; len(errs) != 0 {
+		t.Errorf("unexpected replication errors: %s", errs)
+	}
+
+	seed, err := overrides.Apply(basicManifest(), "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seedSHA, _ := seed.SHA()
+	sha, _ := basicManifest().SHA()
+	for _, node := range scenarioNodes {
+		expected := sha
+		if node == "node1" {
+			expected = seedSHA
+		}
+		for _, tree := range []consul.PodPrefix{consul.INTENT_TREE, consul.REALITY_TREE} {
+			if actual := store.podSHA(t, tree, node, testPodId); actual != expected {
+				t.Errorf("expected %s of %s to be %s, got %s", tree, node, expected, actual)
+			}
+		}
+	}
+
+}
+
+func TestReplicationSkipsNodesRunningTheirOverrides(t *testing.T) {
+	defer fastPolling()()
+	overrides := NodeOverrides{
+		"node1": {Config: map[interface{}]interface{}{"seed": true}},
+	}
+	seed, err := overrides.Apply(basicManifest(), "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := newFakeStore(t, scenarioNodes)
+	store.setPod(t, consul.REALITY_TREE, "node1", seed)
+	store.setPod(t, consul.REALITY_TREE, "node2", seed)
+
+	repl, errsCh := startFakeReplication(t, store, newFakeHealthChecker(scenarioNodes, health.Passing), NoTimeout)
+	repl.SetNodeOverrides(overrides)
+	phasesCh := collectPhases(repl.ProgressUpdates())
+	enactWithin(t, repl, 10*time.Second)
+	if errs := <-errsCh; len(errs) != 0 {
+		t.Errorf("unexpected replication errors: %s", errs)
+	}
+
+	phases := <-phasesCh
+	if lastPhase(phases["node1"]) != NodeSkipped {
+		t.Errorf("expected node1 to be skipped because it runs its overridden manifest, got %v", phases["node1"])
+	}
+	if lastPhase(phases["node2"]) != NodeHealthy {
+		t.Errorf("expected node2 to be updated because it has no overrides, got %v", phases["node2"])
+	}
+}
@@ -0,0 +1,59 @@
+package replication
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/util/param"
+)
+
+var pausePollMillis = param.Int("replication_pause_poll_millis", 1000)
+
+// Pause stops the replications of the replicator's pod, in this process or
+// any other, from starting to update any more nodes until Resume() is called.
+// Nodes that are already being updated carry on.
+func (r replicator) Pause() error {
+	return r.store.PauseReplication(r.manifest.ID(), r.lockMessage)
+}
+
+// Resume lets paused replications of the replicator's pod carry on
+func (r replicator) Resume() error {
+	return r.store.ResumeReplication(r.manifest.ID())
+}
+
+// waitWhilePaused blocks for as long as the replication's pod is paused. The
+// pause can't be confirmed to be lifted while it can't be read, so the
+// replication also waits then.
+func (r *replication) waitWhilePaused() error {
+	podID := r.GetManifest().ID()
+	paused := false
+	for {
+		pause, err := r.store.ReplicationPause(podID)
+		switch {
+		case err != nil:
+			r.logger.WithError(err).Errorln("Could not check whether the replication is paused, retrying")
+		case pause == nil:
+			if paused {
+				r.logger.NoFields().Infoln("Replication was resumed")
+				r.notifyResumed()
+			}
+			return nil
+		case !paused:
+			r.logger.WithFields(logrus.Fields{
+				"paused_by": pause.PausedBy,
+				"paused_at": pause.Time,
+			}).Infoln("Replication is paused, waiting for it to be resumed")
+			r.notifyPaused(pause)
+			paused = true
+		}
+
+		select {
+		case <-r.quitCh:
+			return errQuit
+		case <-r.replicationCancelledCh:
+			return errCancelled
+		case <-time.After(time.Duration(*pausePollMillis) * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// +build !race
+
+package replication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul"
+)
+
+func TestEnactWaitsWhilePaused(t *testing.T) {
+	errCh := make(chan error)
+	r, fixture := newTestReplication(t, errCh)
+	defer fixture.Stop()
+	r.errCh = errCh
+	go proccessErrors(errCh, t)
+	r.timeout = NoTimeout
+
+	oldPoll := *pausePollMillis
+	*pausePollMillis = 100
+	defer func() { *pausePollMillis = oldPoll }()
+
+	podStore := consul.NewConsulStore(fixture.Client)
+	err := podStore.PauseReplication(r.manifest.ID(), "tester")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pause, err := podStore.ReplicationPause(r.manifest.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pause == nil || pause.PausedBy != "tester" {
+		t.Fatalf("expected the replication to be paused by tester, got %+v", pause)
+	}
+
+	enactDone := make(chan struct{})
+	go func() {
+		defer close(enactDone)
+		r.Enact()
+	}()
+
+	select {
+	case <-enactDone:
+		t.Fatal("expected a paused replication not to finish")
+	case <-time.After(time.Second):
+	}
+	intent, _, err := podStore.AllPods(consul.INTENT_TREE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(intent) != 0 {
+		t.Fatalf("expected a paused replication not to schedule any nodes, but %d were", len(intent))
+	}
+
+	err = podStore.ResumeReplication(r.manifest.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-enactDone:
+	case <-time.After(time.Minute):
+		t.Fatal("timed out waiting for the resumed replication to finish")
+	}
+
+	intent, _, err = podStore.AllPods(consul.INTENT_TREE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(intent) != len(r.nodes) {
+		t.Errorf("expected the resumed replication to schedule %d nodes, but %d were", len(r.nodes), len(intent))
+	}
+}
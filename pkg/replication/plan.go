@@ -0,0 +1,103 @@
+package replication
+
+import (
+	"time"
+
+	"github.com/square/p2/pkg/constants"
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+)
+
+// PlanStore reads the intent and reality of nodes
+type PlanStore interface {
+	Pod(podPrefix consul.PodPrefix, nodename types.NodeName, podId types.PodID) (manifest.Manifest, time.Duration, error)
+}
+
+// PlanAction is what a replication would do to a node
+type PlanAction string
+
+const (
+	// The node's intent would be written with the manifest
+	PlanUpdate PlanAction = "update"
+	// The node already runs the manifest, so it would be skipped
+	PlanSkip PlanAction = "skip"
+	// The node has no preparer, so the replication would refuse to start
+	PlanNoPreparer PlanAction = "no preparer"
+	// The node's state could not be read, see NodePlan.Err
+	PlanUnknown PlanAction = "unknown"
+)
+
+// NodePlan describes what replicating a manifest would do to a node
+type NodePlan struct {
+	Node   types.NodeName
+	Action PlanAction
+
+	// The SHA of the manifest the node would be given, which differs from
+	// the replicated manifest's if the node has overrides
+	TargetSHA string
+
+	// The SHAs of the node's current intent and reality manifests for the
+	// pod, empty if it has none
+	IntentSHA  string
+	RealitySHA string
+
+	Err error
+}
+
+// Plan works out what a replication of the manifest to the given nodes would
+// do to each of them, without writing anything. Like a replication, it skips
+// nodes whose reality already matches the manifest they would be given, with
+// their overrides merged in.
+func Plan(man manifest.Manifest, nodes []types.NodeName, overrides NodeOverrides, store PlanStore) ([]NodePlan, error) {
+	plans := make([]NodePlan, 0, len(nodes))
+	for _, node := range nodes {
+		target, err := overrides.Apply(man, node)
+		if err != nil {
+			return nil, err
+		}
+		plan := NodePlan{Node: node}
+		plan.TargetSHA, err = target.SHA()
+		if err != nil {
+			return nil, errors.Errorf("could not compute manifest SHA: %w", err)
+		}
+		plan.IntentSHA, plan.Err = podSHA(store, consul.INTENT_TREE, node, man.ID())
+		if plan.Err == nil {
+			plan.RealitySHA, plan.Err = podSHA(store, consul.REALITY_TREE, node, man.ID())
+		}
+		if plan.Err == nil {
+			_, _, plan.Err = store.Pod(consul.REALITY_TREE, node, constants.PreparerPodID)
+			if plan.Err == pods.NoCurrentManifest {
+				plan.Err = nil
+				plan.Action = PlanNoPreparer
+			}
+		}
+
+		switch {
+		case plan.Err != nil:
+			plan.Action = PlanUnknown
+		case plan.Action != "":
+		case plan.RealitySHA == plan.TargetSHA:
+			plan.Action = PlanSkip
+		default:
+			plan.Action = PlanUpdate
+		}
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
+
+// podSHA returns the SHA of the pod's manifest in the given tree of the node,
+// or "" if there is none
+func podSHA(store PlanStore, podPrefix consul.PodPrefix, node types.NodeName, podID types.PodID) (string, error) {
+	man, _, err := store.Pod(podPrefix, node, podID)
+	switch {
+	case err == pods.NoCurrentManifest:
+		return "", nil
+	case err != nil:
+		return "", err
+	}
+	return man.SHA()
+}
@@ -0,0 +1,83 @@
+package replication
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/constants"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+)
+
+type fakePlanStore struct {
+	manifests map[string]manifest.Manifest
+	errs      map[types.NodeName]error
+}
+
+func (s fakePlanStore) set(podPrefix consul.PodPrefix, node types.NodeName, man manifest.Manifest) {
+	s.manifests[string(podPrefix)+"/"+node.String()+"/"+man.ID().String()] = man
+}
+
+func (s fakePlanStore) Pod(podPrefix consul.PodPrefix, node types.NodeName, podID types.PodID) (manifest.Manifest, time.Duration, error) {
+	if err := s.errs[node]; err != nil {
+		return nil, 0, err
+	}
+	man, ok := s.manifests[string(podPrefix)+"/"+node.String()+"/"+podID.String()]
+	if !ok {
+		return nil, 0, pods.NoCurrentManifest
+	}
+	return man, 0, nil
+}
+
+func TestPlan(t *testing.T) {
+	man := basicManifest()
+	builder := man.GetBuilder()
+	builder.SetStatusPort(9999)
+	old := builder.GetManifest()
+	preparerBuilder := manifest.NewBuilder()
+	preparerBuilder.SetID(constants.PreparerPodID)
+	preparer := preparerBuilder.GetManifest()
+
+	store := fakePlanStore{
+		manifests: make(map[string]manifest.Manifest),
+		errs:      map[types.NodeName]error{"broken": errors.New("consul is down")},
+	}
+	for _, node := range []types.NodeName{"current", "outdated", "fresh"} {
+		store.set(consul.REALITY_TREE, node, preparer)
+	}
+	store.set(consul.INTENT_TREE, "current", man)
+	store.set(consul.REALITY_TREE, "current", man)
+	store.set(consul.INTENT_TREE, "outdated", old)
+	store.set(consul.REALITY_TREE, "outdated", old)
+
+	plans, err := Plan(man, []types.NodeName{"current", "outdated", "fresh", "bare", "broken"}, nil, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sha, _ := man.SHA()
+	oldSHA, _ := old.SHA()
+	expected := []NodePlan{
+		{Node: "current", Action: PlanSkip, TargetSHA: sha, IntentSHA: sha, RealitySHA: sha},
+		{Node: "outdated", Action: PlanUpdate, TargetSHA: sha, IntentSHA: oldSHA, RealitySHA: oldSHA},
+		{Node: "fresh", Action: PlanUpdate, TargetSHA: sha},
+		{Node: "bare", Action: PlanNoPreparer, TargetSHA: sha},
+		{Node: "broken", Action: PlanUnknown, TargetSHA: sha},
+	}
+	if len(plans) != len(expected) {
+		t.Fatalf("expected %d plans, got %d", len(expected), len(plans))
+	}
+	for i, plan := range plans {
+		err := plan.Err
+		plan.Err = nil
+		if plan != expected[i] {
+			t.Errorf("expected plan %+v, got %+v", expected[i], plan)
+		}
+		if (err != nil) != (plan.Action == PlanUnknown) {
+			t.Errorf("expected only unknown plans to have an error, %s had %v", plan.Node, err)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package replication
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/prefetchstatus"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util/param"
+)
+
+var prefetchPollPeriodMillis = param.Int("prefetch_poll_millis", 2000)
+
+// PrefetchStore writes and withdraws prefetch requests
+type PrefetchStore interface {
+	SetPod(podPrefix consul.PodPrefix, nodename types.NodeName, manifest manifest.Manifest) (time.Duration, error)
+	DeletePod(podPrefix consul.PodPrefix, nodename types.NodeName, podId types.PodID) (time.Duration, error)
+}
+
+// PrefetchStatusStore reads the outcome of prefetch requests as reported by
+// the preparer on each node
+type PrefetchStatusStore interface {
+	Get(node types.NodeName) (prefetchstatus.Status, *api.QueryMeta, error)
+}
+
+// Prefetch asks the preparer on each node to download, verify and install the
+// launchables of man without launching them, and waits until every node has
+// done so. Running it before a replication means that a node which can't get
+// the artifacts fails the deploy before any pod has been restarted, and that
+// the restart itself doesn't wait on downloads.
+//
+// An error is returned if any node fails to prefetch or if ctx is done before
+// every node has reported back. Either way, the prefetch requests are
+// withdrawn before returning.
+func Prefetch(
+	ctx context.Context,
+	man manifest.Manifest,
+	nodes []types.NodeName,
+	store PrefetchStore,
+	statuses PrefetchStatusStore,
+	logger logging.Logger,
+) error {
+	sha, err := man.SHA()
+	if err != nil {
+		return errors.Errorf("could not compute manifest SHA: %w", err)
+	}
+	logger = logger.SubLogger(logrus.Fields{"sha": sha})
+
+	defer func() {
+		for _, node := range nodes {
+			_, err := store.DeletePod(consul.PREFETCH_TREE, node, man.ID())
+			if err != nil {
+				logger.WithErrorAndFields(err, logrus.Fields{"node": node}).Warnln("Could not withdraw prefetch request")
+			}
+		}
+	}()
+	for _, node := range nodes {
+		_, err = store.SetPod(consul.PREFETCH_TREE, node, man)
+		if err != nil {
+			return errors.Errorf("could not request prefetch on %s: %w", node, err)
+		}
+	}
+	logger.Infof("Waiting for %d nodes to prefetch launchables", len(nodes))
+
+	pending := make(map[types.NodeName]bool)
+	for _, node := range nodes {
+		pending[node] = true
+	}
+	failures := make(map[types.NodeName]string)
+	for len(pending) > 0 {
+		select {
+		case <-ctx.Done():
+			return errors.Errorf("timed out waiting for %d nodes to prefetch launchables: %s", len(pending), joinNodes(pending))
+		case <-time.After(time.Duration(*prefetchPollPeriodMillis) * time.Millisecond):
+		}
+
+		for node := range pending {
+			status, _, err := statuses.Get(node)
+			if statusstore.IsNoStatus(err) {
+				continue
+			}
+			if err != nil {
+				logger.WithErrorAndFields(err, logrus.Fields{"node": node}).Warnln("Could not read prefetch status")
+				continue
+			}
+			result := status.Pods[man.ID()]
+			switch {
+			case result.Succeeded(sha):
+				logger.WithField("node", node).Infoln("Node prefetched launchables")
+				delete(pending, node)
+			case result.Failed(sha):
+				logger.WithFields(logrus.Fields{"node": node, "error": result.Error}).Errorln("Node could not prefetch launchables")
+				failures[node] = result.Error
+				delete(pending, node)
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		var messages []string
+		for node, message := range failures {
+			messages = append(messages, node.String()+": "+message)
+		}
+		sort.Strings(messages)
+		return errors.Errorf("%d nodes could not prefetch launchables: %s", len(failures), strings.Join(messages, "; "))
+	}
+	logger.Infof("All %d nodes prefetched launchables", len(nodes))
+	return nil
+}
+
+func joinNodes(nodes map[types.NodeName]bool) string {
+	var names []string
+	for node := range nodes {
+		names = append(names, node.String())
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,98 @@
+package replication
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/prefetchstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/statusstoretest"
+	"github.com/square/p2/pkg/types"
+)
+
+func setPrefetchResult(t *testing.T, statuses prefetchstatus.ConsulStore, node types.NodeName, result prefetchstatus.Result) {
+	err := statuses.Set(node, prefetchstatus.Status{Pods: map[types.PodID]prefetchstatus.Result{testPodId: result}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertPrefetchRequestsWithdrawn(t *testing.T, f consulutil.Fixture) {
+	keys, _, err := f.Client.KV().Keys(consul.PREFETCH_TREE.String()+"/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("Expected the prefetch requests to be withdrawn, found %s", keys)
+	}
+}
+
+func TestPrefetchWaitsForEveryNode(t *testing.T) {
+	*prefetchPollPeriodMillis = 10
+	f := consulutil.NewFixture(t)
+	defer f.Stop()
+	store := consul.NewConsulStore(f.Client)
+	statuses := prefetchstatus.NewConsul(statusstoretest.NewFake(), statusstore.PrefetchStatusNamespace)
+	man := basicManifest()
+	sha, _ := man.SHA()
+
+	setPrefetchResult(t, statuses, "node1", prefetchstatus.Result{SHA: sha})
+	go func() {
+		// the second node takes a while
+		time.Sleep(50 * time.Millisecond)
+		setPrefetchResult(t, statuses, "node2", prefetchstatus.Result{SHA: sha})
+	}()
+
+	err := Prefetch(context.Background(), man, testNodes, store, statuses, basicLogger())
+	if err != nil {
+		t.Fatalf("Unexpected error prefetching: %s", err)
+	}
+	assertPrefetchRequestsWithdrawn(t, f)
+}
+
+func TestPrefetchReportsFailures(t *testing.T) {
+	*prefetchPollPeriodMillis = 10
+	f := consulutil.NewFixture(t)
+	defer f.Stop()
+	store := consul.NewConsulStore(f.Client)
+	statuses := prefetchstatus.NewConsul(statusstoretest.NewFake(), statusstore.PrefetchStatusNamespace)
+	man := basicManifest()
+	sha, _ := man.SHA()
+
+	setPrefetchResult(t, statuses, "node1", prefetchstatus.Result{SHA: sha})
+	// a result for an older manifest must not count
+	setPrefetchResult(t, statuses, "node2", prefetchstatus.Result{SHA: "older"})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		setPrefetchResult(t, statuses, "node2", prefetchstatus.Result{SHA: sha, Error: "artifact not found"})
+	}()
+
+	err := Prefetch(context.Background(), man, testNodes, store, statuses, basicLogger())
+	if err == nil || !strings.Contains(err.Error(), "node2: artifact not found") {
+		t.Errorf("Expected node2's failure to be reported, got %v", err)
+	}
+	assertPrefetchRequestsWithdrawn(t, f)
+}
+
+func TestPrefetchTimesOut(t *testing.T) {
+	*prefetchPollPeriodMillis = 10
+	f := consulutil.NewFixture(t)
+	defer f.Stop()
+	store := consul.NewConsulStore(f.Client)
+	statuses := prefetchstatus.NewConsul(statusstoretest.NewFake(), statusstore.PrefetchStatusNamespace)
+	man := basicManifest()
+	sha, _ := man.SHA()
+	setPrefetchResult(t, statuses, "node1", prefetchstatus.Result{SHA: sha})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := Prefetch(ctx, man, testNodes, store, statuses, basicLogger())
+	if err == nil || !strings.Contains(err.Error(), "node2") || strings.Contains(err.Error(), "node1") {
+		t.Errorf("Expected a timeout naming only node2, got %v", err)
+	}
+	assertPrefetchRequestsWithdrawn(t, f)
+}
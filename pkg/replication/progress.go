@@ -0,0 +1,81 @@
+package replication
+
+import (
+	"time"
+
+	"github.com/square/p2/pkg/types"
+)
+
+// NodePhase is how far along the update of a single node is
+type NodePhase string
+
+const (
+	// The node was picked up to be updated, and may be waiting on the
+	// deploy budget
+	NodeScheduled NodePhase = "scheduled"
+	// The node's intent was written and the replication is waiting for it
+	// to install the pod and become healthy
+	NodeInstalling NodePhase = "installing"
+	// The node already had the manifest, so it wasn't touched
+	NodeSkipped NodePhase = "skipped"
+	// The node is running the manifest and is healthy
+	NodeHealthy NodePhase = "healthy"
+	// The node could not be updated, see NodeProgress.Err
+	NodeFailed NodePhase = "failed"
+	// The node timed out or hit an error, see NodeProgress.Err, and is
+	// about to be updated again
+	NodeRetrying NodePhase = "retrying"
+)
+
+// NodeProgress reports that a node entered a phase
+type NodeProgress struct {
+	Node  types.NodeName
+	Phase NodePhase
+	Time  time.Time
+	// Why the node failed, only set for NodeFailed and NodeRetrying
+	Err error
+}
+
+// Done returns whether the node has reached a phase it won't leave
+func (p NodeProgress) Done() bool {
+	return p.Phase == NodeSkipped || p.Phase == NodeHealthy || p.Phase == NodeFailed
+}
+
+func (r *replication) ProgressUpdates() <-chan NodeProgress {
+	r.progressMu.Lock()
+	defer r.progressMu.Unlock()
+	if r.progressCh == nil {
+		r.progressCh = make(chan NodeProgress)
+	}
+	return r.progressCh
+}
+
+// reportProgress records an update in the event log and passes it to the
+// caller of ProgressUpdates(), if they asked for either. It blocks until the
+// update is read or the replication quits.
+func (r *replication) reportProgress(node types.NodeName, phase NodePhase, err error) {
+	now := time.Now()
+	r.recordEvent(node, phase, now, err)
+
+	r.progressMu.Lock()
+	defer r.progressMu.Unlock()
+	if r.progressCh == nil || r.progressClosed {
+		return
+	}
+
+	select {
+	case r.progressCh <- NodeProgress{Node: node, Phase: phase, Time: now, Err: err}:
+	case <-r.quitCh:
+	}
+}
+
+// closeProgress closes the channel returned by ProgressUpdates(), after which
+// no more updates are reported
+func (r *replication) closeProgress() {
+	r.progressMu.Lock()
+	defer r.progressMu.Unlock()
+	if r.progressCh != nil && !r.progressClosed {
+		close(r.progressCh)
+	}
+	r.progressClosed = true
+}
@@ -0,0 +1,49 @@
+// +build !race
+
+package replication
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/types"
+)
+
+func TestEnactReportsProgress(t *testing.T) {
+	errCh := make(chan error)
+	r, fixture := newTestReplication(t, errCh)
+	defer fixture.Stop()
+	r.errCh = errCh
+	go proccessErrors(errCh, t)
+	r.timeout = NoTimeout
+
+	progress := r.ProgressUpdates()
+	phases := make(map[types.NodeName][]NodePhase)
+	progressDone := make(chan struct{})
+	go func() {
+		defer close(progressDone)
+		for update := range progress {
+			phases[update.Node] = append(phases[update.Node], update.Phase)
+		}
+	}()
+
+	r.Enact()
+	<-progressDone
+
+	if len(phases) != len(r.nodes) {
+		t.Fatalf("expected progress for %d nodes, got %d", len(r.nodes), len(phases))
+	}
+	expected := []NodePhase{NodeScheduled, NodeInstalling, NodeHealthy}
+	for _, node := range r.nodes {
+		got := phases[node]
+		if len(got) != len(expected) {
+			t.Errorf("expected %s to go through %v, got %v", node, expected, got)
+			continue
+		}
+		for i := range expected {
+			if got[i] != expected[i] {
+				t.Errorf("expected %s to go through %v, got %v", node, expected, got)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package replication
+
+import (
+	"time"
+
+	"github.com/pborman/uuid"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+)
+
+// NewRecord returns the record of a new replication of the manifest to the
+// given nodes, under a new random ID
+func NewRecord(man manifest.Manifest, nodes []types.NodeName) (consul.ReplicationRecord, error) {
+	sha, err := man.SHA()
+	if err != nil {
+		return consul.ReplicationRecord{}, errors.Errorf("could not compute manifest SHA: %w", err)
+	}
+	return consul.ReplicationRecord{
+		ID:          uuid.New(),
+		PodID:       man.ID(),
+		ManifestSHA: sha,
+		Nodes:       nodes,
+		Started:     time.Now(),
+	}, nil
+}
+
+// CheckResumable returns an error if the record isn't of a replication of the
+// given manifest, in which case resuming it would mix two deploys
+func CheckResumable(record consul.ReplicationRecord, man manifest.Manifest) error {
+	if record.PodID != man.ID() {
+		return errors.Errorf("replication %s is of pod %s, not %s", record.ID, record.PodID, man.ID())
+	}
+	sha, err := man.SHA()
+	if err != nil {
+		return errors.Errorf("could not compute manifest SHA: %w", err)
+	}
+	if record.ManifestSHA != sha {
+		return errors.Errorf("replication %s is of manifest %s, not %s", record.ID, record.ManifestSHA, sha)
+	}
+	return nil
+}
+
+func (r *replication) SetRecord(record consul.ReplicationRecord) {
+	r.recordMu.Lock()
+	defer r.recordMu.Unlock()
+	r.record = &record
+}
+
+// saveRecord writes the replication's record, if it has one. The record only
+// helps to resume the replication, so failing to write it doesn't stop the
+// replication.
+func (r *replication) saveRecord() {
+	r.recordMu.Lock()
+	defer r.recordMu.Unlock()
+	r.saveRecordLocked()
+}
+
+func (r *replication) saveRecordLocked() {
+	if r.record == nil {
+		return
+	}
+	r.record.Updated = time.Now()
+	err := r.store.PutReplicationRecord(*r.record)
+	if err != nil {
+		r.logger.WithError(err).Errorf("Could not save the record of replication %s", r.record.ID)
+	}
+}
+
+// recordNode records that a node was completed, or failed if err is non-nil
+func (r *replication) recordNode(node types.NodeName, err error) {
+	r.recordMu.Lock()
+	defer r.recordMu.Unlock()
+	if r.record == nil {
+		return
+	}
+
+	r.removeCompletedLocked(node)
+	delete(r.record.Failed, node)
+	if err == nil {
+		r.record.Completed = append(r.record.Completed, node)
+	} else {
+		if r.record.Failed == nil {
+			r.record.Failed = make(map[types.NodeName]string)
+		}
+		r.record.Failed[node] = err.Error()
+	}
+	r.saveRecordLocked()
+}
+
+// recordRolledBack records that a node was given back the manifest it had
+// before, so it has to be updated again if the replication is resumed
+func (r *replication) recordRolledBack(node types.NodeName) {
+	r.recordMu.Lock()
+	defer r.recordMu.Unlock()
+	if r.record == nil {
+		return
+	}
+	r.removeCompletedLocked(node)
+	r.saveRecordLocked()
+}
+
+// resolveRecordNodes adds the nodes that were newly resolved to the record
+// and removes the ones that no longer were before they were updated, so that
+// resuming the replication updates the nodes it would have
+func (r *replication) resolveRecordNodes(added []types.NodeName, dropped []types.NodeName) {
+	if len(added) == 0 && len(dropped) == 0 {
+		return
+	}
+	r.recordMu.Lock()
+	defer r.recordMu.Unlock()
+	if r.record == nil {
+		return
+	}
+
+	droppedSet := types.NewNodeSet(dropped...)
+	var nodes []types.NodeName
+	for _, node := range r.record.Nodes {
+		if !droppedSet.Has(node.String()) {
+			nodes = append(nodes, node)
+		}
+	}
+	r.record.Nodes = append(nodes, added...)
+	r.saveRecordLocked()
+}
+
+func (r *replication) removeCompletedLocked(node types.NodeName) {
+	var completed []types.NodeName
+	for _, n := range r.record.Completed {
+		if n != node {
+			completed = append(completed, n)
+		}
+	}
+	r.record.Completed = completed
+}
+
+// finishRecord removes the replication's record once every node was
+// completed, because there is nothing left to resume. Otherwise the record is
+// left for the replication to be resumed.
+func (r *replication) finishRecord() {
+	r.recordMu.Lock()
+	defer r.recordMu.Unlock()
+	if r.record == nil || len(r.record.Remaining()) > 0 {
+		return
+	}
+	err := r.store.DeleteReplicationRecord(r.record.ID)
+	if err != nil {
+		r.logger.WithError(err).Errorf("Could not delete the record of completed replication %s", r.record.ID)
+	}
+}
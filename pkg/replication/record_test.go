@@ -0,0 +1,123 @@
+// +build !race
+
+package replication
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+)
+
+type recordingStore struct {
+	Store
+
+	mu      sync.Mutex
+	records []consul.ReplicationRecord
+}
+
+func (s *recordingStore) PutReplicationRecord(record consul.ReplicationRecord) error {
+	s.mu.Lock()
+	s.records = append(s.records, record)
+	s.mu.Unlock()
+	return s.Store.PutReplicationRecord(record)
+}
+
+func TestEnactKeepsRecord(t *testing.T) {
+	errCh := make(chan error)
+	r, fixture := newTestReplication(t, errCh)
+	defer fixture.Stop()
+	r.errCh = errCh
+	go proccessErrors(errCh, t)
+	r.timeout = NoTimeout
+
+	store := &recordingStore{Store: r.store}
+	r.store = store
+	record, err := NewRecord(r.manifest, r.nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetRecord(record)
+
+	r.Enact()
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.records) != len(r.nodes)+1 {
+		t.Fatalf("expected the record to be saved when starting and once per node, got %d saves", len(store.records))
+	}
+	if len(store.records[0].Completed) != 0 {
+		t.Errorf("expected no nodes to be completed at first, got %v", store.records[0].Completed)
+	}
+	last := store.records[len(store.records)-1]
+	if len(last.Completed) != len(r.nodes) || len(last.Remaining()) != 0 {
+		t.Errorf("expected every node to be completed, got %v", last.Completed)
+	}
+
+	saved, err := consul.NewConsulStore(fixture.Client).ReplicationRecord(record.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved != nil {
+		t.Errorf("expected the record of a completed replication to be removed, got %+v", saved)
+	}
+}
+
+func TestRecordNodeFailureAndRollback(t *testing.T) {
+	r := &replication{}
+	r.record = &consul.ReplicationRecord{Nodes: []types.NodeName{"a", "b", "c"}}
+	r.store = nopRecordStore{}
+
+	r.recordNode("a", nil)
+	r.recordNode("b", errTimeout)
+	if remaining := r.record.Remaining(); len(remaining) != 2 || remaining[0] != "b" || remaining[1] != "c" {
+		t.Errorf("expected b and c to remain, got %v", remaining)
+	}
+	if r.record.Failed["b"] != errTimeout.Error() {
+		t.Errorf("expected b to be recorded as failed, got %v", r.record.Failed)
+	}
+
+	r.recordNode("b", nil)
+	if _, ok := r.record.Failed["b"]; ok {
+		t.Error("expected a node that was completed after failing not to be recorded as failed")
+	}
+	r.recordRolledBack("a")
+	if remaining := r.record.Remaining(); len(remaining) != 2 || remaining[0] != "a" || remaining[1] != "c" {
+		t.Errorf("expected a rolled back node to remain, got %v", remaining)
+	}
+}
+
+func TestCheckResumable(t *testing.T) {
+	builder := manifest.NewBuilder()
+	builder.SetID("foo")
+	man := builder.GetManifest()
+	record, err := NewRecord(man, []types.NodeName{"a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckResumable(record, man); err != nil {
+		t.Errorf("expected a record of the manifest to be resumable, got %s", err)
+	}
+
+	builder.SetStatusPort(8080)
+	if err := CheckResumable(record, builder.GetManifest()); err == nil {
+		t.Error("expected a record of a different manifest not to be resumable")
+	}
+
+	builder = manifest.NewBuilder()
+	builder.SetID("bar")
+	if err := CheckResumable(record, builder.GetManifest()); err == nil {
+		t.Error("expected a record of a different pod not to be resumable")
+	}
+}
+
+// nopRecordStore discards replication records
+type nopRecordStore struct {
+	Store
+}
+
+func (nopRecordStore) PutReplicationRecord(consul.ReplicationRecord) error {
+	return nil
+}
@@ -2,13 +2,14 @@ package replication
 
 import (
 	"context"
+	"fmt"
 	"path"
-	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/square/p2/pkg/errors"
 	"github.com/square/p2/pkg/health"
 	"github.com/square/p2/pkg/health/checker"
 	"github.com/square/p2/pkg/labels"
@@ -17,10 +18,12 @@ import (
 	"github.com/square/p2/pkg/pods"
 	"github.com/square/p2/pkg/rc"
 	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/statusstore/nodestatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/replicationstatus"
 	"github.com/square/p2/pkg/store/consul/transaction"
 	"github.com/square/p2/pkg/types"
-	"github.com/square/p2/pkg/util"
 	"github.com/square/p2/pkg/util/param"
+	"github.com/square/p2/pkg/webhook"
 
 	"github.com/Sirupsen/logrus"
 )
@@ -80,6 +83,82 @@ type Replication interface {
 
 	// SetTimeout() is used to change the timeout used for the replication while it is in progress
 	SetTimeout(timeout time.Duration)
+
+	// NodeTimings() returns how long each node that has become healthy took
+	// to do so, measured from when its intent was written
+	NodeTimings() []NodeTiming
+
+	// SetCanary() makes Enact() update the first count nodes on their own
+	// and require them to stay healthy for the given wait before any other
+	// node is updated. It must be called before Enact()
+	SetCanary(count int, wait time.Duration)
+
+	// SetRollbackPolicy() determines what happens to the nodes that were
+	// already updated when a node fails. It must be called before Enact()
+	SetRollbackPolicy(policy RollbackPolicy)
+
+	// ProgressUpdates() returns a channel that is passed each phase that
+	// every node enters, and closed when Enact() returns. It must be called
+	// before Enact(), after which the channel must be read until it is
+	// closed because the replication waits for each update to be read
+	ProgressUpdates() <-chan NodeProgress
+
+	// SetRecord() makes Enact() keep the given record of which nodes were
+	// completed up to date in consul, so that the replication can be
+	// resumed if it is interrupted. The record is removed once every node
+	// is completed. It must be called before Enact()
+	SetRecord(record consul.ReplicationRecord)
+
+	// SetMinHealthy() makes each node wait to be updated until updating it
+	// would leave at least the given number of the pod's hosts healthy. It
+	// must be called before Enact()
+	SetMinHealthy(min MinHealthy)
+
+	// SetOrder() determines the order the nodes are updated in, which is
+	// from least to most healthy by default. It must be called before
+	// Enact()
+	SetOrder(order Order)
+
+	// SetRetries() makes a node that times out or hits an error be
+	// updated again, up to count more times, before it counts as failed
+	// and the rollback policy applies. It must be called before Enact()
+	SetRetries(count int)
+
+	// SetEventStore() makes Enact() record each phase that every node
+	// enters in the given store, under the pod's ID, so that the rollout
+	// can be audited after it finishes. It must be called before Enact()
+	SetEventStore(store EventStore)
+
+	// SetAckStore() makes Enact() watch, while each node is being updated,
+	// for the preparer on the node to acknowledge the new intent in its
+	// deploy status, and record how long that took as PhaseAcknowledge. It
+	// must be called before Enact()
+	SetAckStore(store DeployStatusStore)
+
+	// SetNodeResolver() makes Enact() call resolve every interval while
+	// nodes are waiting to be updated, and once more when none are left.
+	// Nodes it returns that the replication didn't have are checked like
+	// the replication's own nodes were and then updated, and the waiting
+	// nodes it no longer returns are skipped. It must be called before
+	// Enact()
+	SetNodeResolver(resolve NodeResolver, interval time.Duration)
+
+	// SetNodeOverrides() makes each node that has overrides be given the
+	// manifest with its override merged in, rather than the manifest as it
+	// is. It must be called before Enact()
+	SetNodeOverrides(overrides NodeOverrides)
+
+	// SetNodeStatusStore() makes Enact() read the state the preparers
+	// record for their nodes from the given store. Nodes that are shutting
+	// down aren't waited on to become healthy, and don't count against the
+	// minimum number of healthy hosts or fail the canaries. It must be
+	// called before Enact()
+	SetNodeStatusStore(store nodestatus.Reader)
+
+	// SetNotifier() makes Enact() send the replication's lifecycle events
+	// to the given notifier: when it starts, is paused, is aborted or
+	// rolled back, and completes. It must be called before Enact()
+	SetNotifier(notifier webhook.Notifier)
 }
 
 type Store interface {
@@ -90,9 +169,17 @@ type Store interface {
 		manifest manifest.Manifest,
 	) error
 	Pod(podPrefix consul.PodPrefix, nodename types.NodeName, podId types.PodID) (manifest.Manifest, time.Duration, error)
+	ConsistentPod(podPrefix consul.PodPrefix, nodename types.NodeName, podId types.PodID) (manifest.Manifest, time.Duration, error)
 	NewSession(name string, renewalCh <-chan time.Time) (consul.Session, chan error, error)
 	LockHolder(key string) (string, string, error)
 	DestroyLockHolder(id string) error
+	DeployBudget() (int, error)
+	DeletePodTxn(ctx context.Context, podPrefix consul.PodPrefix, nodename types.NodeName, podId types.PodID) error
+	ReplicationPause(podID types.PodID) (*consul.ReplicationPause, error)
+	PauseReplication(podID types.PodID, pausedBy string) error
+	ResumeReplication(podID types.PodID) error
+	PutReplicationRecord(record consul.ReplicationRecord) error
+	DeleteReplicationRecord(id string) error
 }
 
 // A replication contains the information required to do a single replication (deploy).
@@ -139,6 +226,88 @@ type replication struct {
 	timedOutReplications      []types.NodeName
 	timedOutReplicationsMutex sync.Mutex
 
+	// Bounds the number of nodes being updated across every replication
+	// in the fleet. May be nil, in which case there is no bound.
+	budget *deployBudget
+
+	// The number of nodes to update as canaries before the rest, and how
+	// long they must stay healthy afterwards. Not used when nodeQueue is set
+	canaryCount int
+	canaryWait  time.Duration
+
+	// What to do with the nodes that were updated when a node fails.
+	// failedCh is closed when the first node fails under the
+	// RollbackOnFailure policy, and nil otherwise
+	rollbackPolicy RollbackPolicy
+	failedCh       chan struct{}
+	// The intent each node had before it was updated, and the nodes that
+	// failed, guarded by rollbackMu
+	previousIntent map[types.NodeName]manifest.Manifest
+	failedNodes    []types.NodeName
+	rollbackMu     sync.Mutex
+
+	// Records how long each node took to update
+	nodeTimings      []NodeTiming
+	nodeTimingsMutex sync.Mutex
+
+	// Passed the phases of each node if the caller asked for them, guarded
+	// by progressMu
+	progressCh     chan NodeProgress
+	progressClosed bool
+	progressMu     sync.Mutex
+
+	// The record of which nodes were completed, if the caller asked for
+	// one, guarded by recordMu
+	record   *consul.ReplicationRecord
+	recordMu sync.Mutex
+
+	// How many of the pod's hosts must stay healthy, and the nodes that
+	// are counted as unhealthy because they are being updated, guarded by
+	// minHealthyMu
+	minHealthy   MinHealthy
+	updating     map[types.NodeName]bool
+	minHealthyMu sync.Mutex
+
+	// The order the nodes are updated in
+	order Order
+
+	// The changes to the manifest that each node is given, if any
+	overrides NodeOverrides
+
+	// How many more times a node that failed is updated before it counts
+	// as failed
+	retries int
+
+	// Resolves the nodes to update again every resolveInterval, if the
+	// caller asked for it. New nodes pass the same checks as the nodes the
+	// replication started with
+	resolver          NodeResolver
+	resolveInterval   time.Duration
+	ignoreControllers bool
+	checkPreparers    bool
+
+	// Where the phases of each node are recorded if the caller asked for
+	// it, and the pod's events that were loaded from it, guarded by
+	// eventMu
+	eventStore EventStore
+	events     *replicationstatus.Status
+	eventMu    sync.Mutex
+
+	// Where the preparers acknowledge new intents, if the caller asked to
+	// watch for that
+	ackStore DeployStatusStore
+
+	// Where the preparers record whether their nodes are shutting down. May
+	// be nil, in which case no node is
+	nodeStatusStore nodestatus.Reader
+
+	// Receives the replication's lifecycle events if the caller set it,
+	// along with whether the current pause was already sent, guarded by
+	// notifyMu
+	notifier      webhook.Notifier
+	pauseNotified bool
+	notifyMu      sync.Mutex
+
 	// Used to tune the reactiveness of the replication to health changes
 	// to trade off with QPS and bandwidth. 1 second is the lower bound for
 	// this value.
@@ -202,6 +371,7 @@ func newReplication(
 		concurrentRealityRequests: concurrentRealityRequests,
 		timeout:                   timeout,
 		nodeQueue:                 nodeQueue,
+		budget:                    newDeployBudget(store, deployBudgetSessionName(manifest.ID()), logger),
 	}
 }
 
@@ -236,25 +406,25 @@ func (r *replication) lock(session consul.Session, lockPath string, overrideLock
 	if _, ok := err.(consul.AlreadyLockedError); ok {
 		holder, id, err := r.store.LockHolder(lockPath)
 		if err != nil {
-			return nil, util.Errorf("Lock already held for %q, could not determine holder due to error: %s", lockPath, err)
+			return nil, errors.Errorf("Lock already held for %q, could not determine holder due to error: %w", lockPath, err)
 		} else if holder == "" {
 			// we failed to acquire this lock, but there is no outstanding
 			// holder
 			// this indicates that the previous holder had a LockDelay,
 			// which prevents other parties from acquiring the lock for a
 			// limited time
-			return nil, util.Errorf("Lock for %q is blocked due to delay by previous holder", lockPath)
+			return nil, errors.Errorf("Lock for %q is blocked due to delay by previous holder", lockPath)
 		} else if overrideLock {
 			err = r.store.DestroyLockHolder(id)
 			if err != nil {
-				return nil, util.Errorf("Unable to destroy the current lock holder (%s) for %q: %s", holder, lockPath, err)
+				return nil, errors.Errorf("Unable to destroy the current lock holder (%s) for %q: %w", holder, lockPath, err)
 			}
 
 			// try acquiring the lock again, but this time don't destroy holders so we don't try forever
 			return r.lock(session, lockPath, false)
 
 		} else {
-			return nil, util.Errorf("Lock for %q already held by lock %q", lockPath, holder)
+			return nil, errors.Errorf("Lock for %q already held by lock %q", lockPath, holder)
 		}
 	}
 
@@ -265,8 +435,12 @@ func (r *replication) lock(session consul.Session, lockPath string, overrideLock
 // would modify that are already managed by a controller. If there is such a pod, the
 // change should go through its controller, not here.
 func (r *replication) checkForManaged() error {
+	return r.checkForManagedNodes(r.nodes)
+}
+
+func (r *replication) checkForManagedNodes(nodes []types.NodeName) error {
 	var badNodes []string
-	for _, node := range r.nodes {
+	for _, node := range nodes {
 		podID := path.Join(node.String(), string(r.GetManifest().ID()))
 		labels, err := r.labeler.GetLabels(labels.POD, podID)
 		if err != nil {
@@ -277,7 +451,7 @@ func (r *replication) checkForManaged() error {
 		}
 	}
 	if len(badNodes) > 0 {
-		return util.Errorf(
+		return errors.Errorf(
 			"cannot replicate to nodes already manged by a controller: %s",
 			strings.Join(badNodes, ", "),
 		)
@@ -290,13 +464,16 @@ func (r *replication) checkForManaged() error {
 // updateOne need to be scoped to the node that they came from
 func (r *replication) Enact() {
 	defer close(r.replicationDoneCh)
+	defer r.closeProgress()
 	r.enactedChMu.Lock()
 	r.enactedCh = make(chan struct{})
 	r.enactedChMu.Unlock()
 	defer close(r.enactedCh)
+	r.saveRecord()
+	defer r.finishRecord()
 
-	// Sort nodes from least healthy to most healthy to maximize overall
-	// cluster health
+	// Unless another order was asked for, nodes are sorted from least
+	// healthy to most healthy to maximize overall cluster health
 	healthResults, err := r.health.Service(string(r.GetManifest().ID()))
 	if err != nil {
 		err = replicationError{
@@ -310,46 +487,139 @@ func (r *replication) Enact() {
 		return
 	}
 
-	// Sort nodes by health from worst to best to maximize overall
-	// cluster health
-	order := health.SortOrder{
-		Nodes:  r.nodes,
-		Health: healthResults,
+	r.mu.RLock()
+	order := r.order
+	r.mu.RUnlock()
+	nodes, err := orderNodes(r.nodes, order, healthResults, r.labeler)
+	if err != nil {
+		select {
+		case r.errCh <- replicationError{err: err, isFatal: true}:
+		case <-r.quitCh:
+		}
+		return
+	}
+
+	aggregateHealth := AggregateHealth(r.GetManifest().ID(), r.health, r.healthWatchDelay)
+	defer aggregateHealth.Stop()
+
+	r.notify(webhook.EventStarted, fmt.Sprintf("Replication of %s to %d nodes started", r.GetManifest().ID(), len(nodes)), map[string]interface{}{
+		"nodes": nodes,
+	})
+
+	if r.nodeQueue == nil && r.canaryCount > 0 {
+		nodes, err = r.enactCanary(nodes, aggregateHealth)
+		switch err {
+		case nil:
+		case errCancelled, errQuit:
+			r.notify(webhook.EventAborted, fmt.Sprintf("Replication of %s was canceled", r.GetManifest().ID()), nil)
+			return
+		default:
+			if rollbackErr := r.rollbackIfFailed(); rollbackErr != nil {
+				err = errors.Errorf("%s: %s", err, rollbackErr)
+			}
+			r.notifyFailed(err)
+			select {
+			case r.errCh <- replicationError{err: err, isFatal: true}:
+			case <-r.quitCh:
+			}
+			return
+		}
 	}
-	sort.Sort(order)
 
 	nodeQueue := r.nodeQueue
 	if nodeQueue == nil {
-		nodeChan := make(chan types.NodeName)
-		nodeQueue = nodeChan
+		nodeQueue = r.queueNodes(nodes)
+	}
+	failed := r.updateNodes(nodeQueue, aggregateHealth)
 
-		// this goroutine populates the node queue with respect to the rate limiter
-		go func() {
-			defer close(nodeChan)
-			for _, node := range r.nodes {
-				if r.rateLimiter != nil {
-					select {
-					case <-r.replicationCancelledCh:
-						return
-					case <-r.quitCh:
-						return
-					case <-r.rateLimiter.C:
-					}
+	if err := r.rollbackIfFailed(); err != nil {
+		r.notifyFailed(err)
+		select {
+		case r.errCh <- replicationError{err: err, isFatal: true}:
+		case <-r.quitCh:
+		}
+		return
+	}
+	if r.checkStopped() != nil {
+		r.notify(webhook.EventAborted, fmt.Sprintf("Replication of %s was canceled", r.GetManifest().ID()), nil)
+		return
+	}
+	r.notifyFinished(failed)
+}
+
+// queueNodes returns a channel that is passed each of the given nodes with
+// respect to the rate limiter, and closed once they all have been or a node
+// failed under the RollbackOnFailure policy. If the caller set a node
+// resolver, the nodes still waiting to be queued are resolved again
+// periodically and once more before the channel is closed.
+func (r *replication) queueNodes(nodes []types.NodeName) <-chan types.NodeName {
+	nodeChan := make(chan types.NodeName)
+	r.mu.RLock()
+	failedCh := r.failedCh
+	resolver := r.resolver
+	resolveInterval := r.resolveInterval
+	r.mu.RUnlock()
+
+	// this goroutine populates the node queue with respect to the rate limiter
+	go func() {
+		defer close(nodeChan)
+		var resolveCh <-chan time.Time
+		if resolver != nil {
+			ticker := time.NewTicker(resolveInterval)
+			defer ticker.Stop()
+			resolveCh = ticker.C
+		}
+
+		pending := nodes
+		// every node of the replication counts as queued, including
+		// the canaries that were updated before the queue started
+		queued := types.NewNodeSet(r.nodes...)
+		for {
+			if len(pending) == 0 {
+				if resolver == nil {
+					return
 				}
+				// take a last look for new nodes before finishing
+				pending = r.resolveNodes(pending, queued)
+				if len(pending) == 0 {
+					return
+				}
+			}
+			node := pending[0]
+
+			if r.rateLimiter != nil {
 				select {
 				case <-r.replicationCancelledCh:
 					return
 				case <-r.quitCh:
 					return
-				case nodeChan <- node:
+				case <-failedCh:
+					return
+				case <-r.rateLimiter.C:
 				}
 			}
-		}()
-	}
+			select {
+			case <-r.replicationCancelledCh:
+				return
+			case <-r.quitCh:
+				return
+			case <-failedCh:
+				return
+			case <-resolveCh:
+				pending = r.resolveNodes(pending, queued)
+			case nodeChan <- node:
+				pending = pending[1:]
+			}
+		}
+	}()
+	return nodeChan
+}
 
-	aggregateHealth := AggregateHealth(r.GetManifest().ID(), r.health, r.healthWatchDelay)
-	defer aggregateHealth.Stop()
-	// this loop multiplexes the node queue across some goroutines
+// updateNodes multiplexes the node queue across r.active goroutines and
+// returns the nodes that could not be updated once the queue is exhausted
+func (r *replication) updateNodes(nodeQueue <-chan types.NodeName, aggregateHealth *podHealth) []types.NodeName {
+	var failed []types.NodeName
+	var failedMu sync.Mutex
 
 	var updatePool sync.WaitGroup
 	for i := 0; i < r.active; i++ {
@@ -358,24 +628,30 @@ func (r *replication) Enact() {
 			// nodeQueue is managed below to throttle these goroutines
 			defer updatePool.Done()
 			for node := range nodeQueue {
-				exitCh := make(chan struct{})
-				ctx, cancel := context.WithCancel(context.Background())
-				r.mu.Lock()
-				if r.timeout != NoTimeout {
-					ctx, cancel = context.WithTimeout(ctx, r.timeout)
+				if err := r.waitWhilePaused(); err != nil {
+					// the replication was stopped, so the queue is
+					// about to be closed
+					continue
 				}
-				r.mu.Unlock()
-				ctx, _ = transaction.New(ctx)
-
-				go func(ctx context.Context, cancel context.CancelFunc) {
-					defer cancel()
+				r.reportProgress(node, NodeScheduled, nil)
+				exitCh := make(chan struct{})
+				go func(node types.NodeName) {
 					defer close(exitCh)
-					err := r.updateOne(ctx, node, aggregateHealth)
+					err := r.updateWithRetries(node, aggregateHealth)
 					if err == nil {
+						r.recordNode(node, nil)
 						r.logger.Infof("The host '%v' successfully replicated the pod '%v'", node, r.GetManifest().ID())
 						return
 					}
 
+					failedMu.Lock()
+					failed = append(failed, node)
+					failedMu.Unlock()
+					r.reportProgress(node, NodeFailed, err)
+					if err != errCancelled && err != errQuit {
+						r.nodeFailed(node)
+						r.recordNode(node, err)
+					}
 					switch err {
 					case errTimeout:
 						r.timedOutReplicationsMutex.Lock()
@@ -387,10 +663,12 @@ func (r *replication) Enact() {
 					default:
 						r.logger.Errorf("An unexpected error has occurred: %v", err)
 					}
-				}(ctx, cancel)
+				}(node)
 
+				// updateOne gives up once its timeout passes, so this
+				// also bounds the wait by the timeout of each attempt
 				select {
-				case <-ctx.Done():
+				case <-exitCh:
 				case <-r.quitCh:
 					return
 				}
@@ -399,6 +677,10 @@ func (r *replication) Enact() {
 	}
 
 	updatePool.Wait()
+
+	failedMu.Lock()
+	defer failedMu.Unlock()
+	return failed
 }
 
 // Cancels all goroutines (e.g. replication and lock renewal)
@@ -430,6 +712,22 @@ func (r *replication) SetManifest(man manifest.Manifest) {
 	r.manifest = man
 }
 
+func (r *replication) SetNodeOverrides(overrides NodeOverrides) {
+	r.mu.Lock()
+	r.overrides = overrides
+	r.mu.Unlock()
+}
+
+// manifestFor returns the manifest that node is given, which is the
+// replication's manifest with the node's override merged in
+func (r *replication) manifestFor(node types.NodeName) (manifest.Manifest, error) {
+	r.mu.RLock()
+	man := r.manifest
+	overrides := r.overrides
+	r.mu.RUnlock()
+	return overrides.Apply(man, node)
+}
+
 func (r *replication) SetTimeout(timeout time.Duration) {
 	r.mu.Lock()
 	r.timeout = timeout
@@ -466,6 +764,9 @@ func (r *replication) handleReplicationEnd(session consul.Session, renewalErrCh
 		if session != nil {
 			_ = session.Destroy()
 		}
+		if r.budget != nil {
+			r.budget.close()
+		}
 	}()
 
 	select {
@@ -491,7 +792,7 @@ func (r *replication) handleReplicationEnd(session consul.Session, renewalErrCh
 	}
 }
 
-func (r *replication) shouldScheduleForNode(node types.NodeName, logger logging.Logger) bool {
+func (r *replication) shouldScheduleForNode(node types.NodeName, target manifest.Manifest, logger logging.Logger) bool {
 	nodeReality, err := r.queryReality(node)
 	switch {
 	case err == pods.NoCurrentManifest:
@@ -508,7 +809,7 @@ func (r *replication) shouldScheduleForNode(node types.NodeName, logger logging.
 			logger.WithError(err).Errorln("Unable to compute manifest SHA for this node. Attempting to schedule anyway")
 			return true
 		}
-		replicationRealitySHA, err := r.GetManifest().SHA()
+		replicationRealitySHA, err := target.SHA()
 		if err != nil {
 			logger.WithError(err).Errorln("Unable to compute manifest SHA for this daemon set. Attempting to schedule anyway")
 			return true
@@ -528,20 +829,43 @@ func (r *replication) updateOne(
 	node types.NodeName,
 	aggregateHealth *podHealth,
 ) error {
-	manifest := r.GetManifest()
-
 	nodeLogger := r.logger.SubLogger(logrus.Fields{"node": node})
 
-	if !r.shouldScheduleForNode(node, nodeLogger) {
+	manifest, err := r.manifestFor(node)
+	if err != nil {
+		nodeLogger.WithError(err).Errorln("Could not apply the node's overrides to the manifest")
+		return err
+	}
+
+	if !r.shouldScheduleForNode(node, manifest, nodeLogger) {
+		r.reportProgress(node, NodeSkipped, nil)
 		return nil
 	}
 
 	// only add if we actually intend to schedule it
 	defer atomic.AddInt32(&r.completedCount, 1)
 
+	releaseUnhealthy, err := r.waitForMinHealthy(ctx, node, aggregateHealth, nodeLogger)
+	if err != nil {
+		return err
+	}
+	defer releaseUnhealthy()
+
+	releaseBudget, err := r.waitForDeployBudget(ctx, node, nodeLogger)
+	if err != nil {
+		return err
+	}
+	defer releaseBudget()
+
+	err = r.recordPreviousIntent(node)
+	if err != nil {
+		return err
+	}
+
 	targetSHA, _ := manifest.SHA()
 	nodeLogger.WithField("sha", targetSHA).Infoln("Updating node")
-	err := r.store.SetPodTxn(
+	start := time.Now()
+	err = r.store.SetPodTxn(
 		ctx,
 		consul.INTENT_TREE,
 		node,
@@ -574,16 +898,40 @@ func (r *replication) updateOne(
 
 	if !ok {
 		// this means we got a transaction conflict of some sort
-		err = util.Errorf("got transaction conflict writing intent store for %s: %s", node, transaction.TxnErrorsToString(resp.Errors))
+		err = errors.Codef(errors.CodeConflict, "got transaction conflict writing intent store for %s: %s", node, transaction.TxnErrorsToString(resp.Errors))
 		nodeLogger.WithError(err).Errorln("Could not write intent store")
 		return err
 	}
+	err = r.verifyIntent(node, targetSHA)
+	if err != nil {
+		nodeLogger.WithError(err).Errorln("Intent write did not land")
+		return err
+	}
+	r.reportProgress(node, NodeInstalling, nil)
 
-	err = r.ensureInReality(ctx, node, nodeLogger, targetSHA)
+	ack := &ackWatch{written: start}
+	err = r.ensureInReality(ctx, node, nodeLogger, targetSHA, ack)
 	if err != nil {
 		return err
 	}
-	return r.ensureHealthy(ctx, node, nodeLogger, aggregateHealth)
+	inReality := time.Now()
+	err = r.ensureHealthy(ctx, node, nodeLogger, aggregateHealth)
+	if err != nil {
+		return err
+	}
+	timing := NodeTiming{
+		Node: node,
+		Phases: map[Phase]time.Duration{
+			PhaseFirstHealthy: time.Since(inReality),
+			PhaseTotal:        time.Since(start),
+		},
+	}
+	if ack.acked {
+		timing.Phases[PhaseAcknowledge] = ack.latency
+	}
+	r.recordNodeTiming(timing)
+	r.reportProgress(node, NodeHealthy, nil)
+	return nil
 }
 
 func (r *replication) queryReality(node types.NodeName) (manifest.Manifest, error) {
@@ -596,7 +944,7 @@ func (r *replication) queryReality(node types.NodeName) (manifest.Manifest, erro
 		case <-time.After(5 * time.Second):
 			r.logger.Infof("Waiting on concurrentRealityRequests for pod: %s/%s", node.String(), r.GetManifest().ID())
 		case <-time.After(1 * time.Minute):
-			err := util.Errorf("Timed out while waiting for reality query rate limit")
+			err := errors.Codef(errors.CodeTimeout, "Timed out while waiting for reality query rate limit")
 			r.logger.Error(err)
 			return nil, err
 		}
@@ -608,6 +956,7 @@ func (r *replication) ensureInReality(
 	node types.NodeName,
 	nodeLogger logging.Logger,
 	targetSHA string,
+	ack *ackWatch,
 ) error {
 	for {
 		select {
@@ -621,6 +970,7 @@ func (r *replication) ensureInReality(
 			r.logger.Infoln("Caught cancellation signal during ensureInReality")
 			return errCancelled
 		case <-time.After(time.Duration(*ensureRealityPeriodMillis) * time.Millisecond):
+			ack.poll(r, node, targetSHA, nodeLogger)
 			man, err := r.queryReality(node)
 			if err == pods.NoCurrentManifest {
 				// if the pod key doesn't exist yet, that's okay just wait longer
@@ -647,7 +997,33 @@ func (r *replication) ensureHealthy(
 	nodeLogger logging.Logger,
 	aggregateHealth *podHealth,
 ) error {
+	// The health of the node is checked again whenever the pod's health
+	// changes, which aggregateHealth is told of by a blocking query
 	for {
+		res, ok, updated := aggregateHealth.healthAndUpdates(node)
+		if !ok {
+			nodeLogger.WithFields(logrus.Fields{
+				"node": node,
+			}).Errorln("Could not get health, waiting for it")
+			// Zero res should be treated like "critical"
+		}
+		id := res.ID
+		status := res.ReadinessStatus()
+		// is this status less than the threshold?
+		if health.Compare(status, r.healthThreshold()) >= 0 {
+			r.logger.WithField("node", node).Infoln("Node is current and healthy")
+			return nil
+		}
+		if r.shuttingDown(node) {
+			nodeLogger.NoFields().Infoln("Node is shutting down, not waiting for it to become healthy")
+			return nil
+		}
+		if res.Reason == health.ReasonShuttingDown {
+			nodeLogger.WithField("check", id).Infoln("Node's health monitor has shut down, waiting for it to check the pod again")
+		} else {
+			nodeLogger.WithFields(logrus.Fields{"check": id, "health": status}).Infoln("Node is not healthy")
+		}
+
 		select {
 		case <-r.quitCh:
 			r.logger.Infoln("Caught quit signal during ensureHealthy")
@@ -658,32 +1034,20 @@ func (r *replication) ensureHealthy(
 		case <-r.replicationCancelledCh:
 			r.logger.Infoln("Caught cancellation signal during ensureHealthy")
 			return errCancelled
-		case <-time.After(time.Duration(*ensureHealthyPeriodMillis) * time.Millisecond):
-			res, ok := aggregateHealth.GetHealth(node)
-			if !ok {
-				nodeLogger.WithFields(logrus.Fields{
-					"node": node,
-				}).Errorln("Could not get health, retrying")
-				// Zero res should be treated like "critical"
-			}
-			id := res.ID
-			status := res.Status
-			// treat an empty threshold as "passing"
-			threshold := health.Passing
-			if r.threshold != "" {
-				threshold = r.threshold
-			}
-			// is this status less than the threshold?
-			if health.Compare(status, threshold) < 0 {
-				nodeLogger.WithFields(logrus.Fields{"check": id, "health": status}).Infoln("Node is not healthy")
-			} else {
-				r.logger.WithField("node", node).Infoln("Node is current and healthy")
-				return nil
-			}
+		case <-updated:
 		}
 	}
 }
 
+// healthThreshold returns the minimum health state a node must report to be
+// treated as healthy. An empty threshold is treated as "passing"
+func (r *replication) healthThreshold() health.HealthState {
+	if r.threshold != "" {
+		return r.threshold
+	}
+	return health.Passing
+}
+
 func (r *replication) CompletedCount() int32 {
 	return atomic.LoadInt32(&r.completedCount)
 }
@@ -1,10 +1,10 @@
 package replication
 
 import (
-	"errors"
 	"time"
 
 	"github.com/square/p2/pkg/constants"
+	"github.com/square/p2/pkg/errors"
 	"github.com/square/p2/pkg/health"
 	"github.com/square/p2/pkg/health/checker"
 	"github.com/square/p2/pkg/logging"
@@ -12,7 +12,6 @@ import (
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/transaction"
 	"github.com/square/p2/pkg/types"
-	"github.com/square/p2/pkg/util"
 )
 
 const (
@@ -49,6 +48,13 @@ type Replicator interface {
 		rateLimitInterval time.Duration,
 		podLabels map[string]string,
 	) (Replication, chan error, error)
+
+	// Pause() stops every replication of the pod from starting to update
+	// any more nodes until Resume() is called. The pause is kept in consul,
+	// so it applies to replications in other processes too, and a later
+	// invocation can resume the rollout.
+	Pause() error
+	Resume() error
 }
 
 // Replicator creates replications
@@ -85,7 +91,7 @@ func NewReplicator(
 	healthWatchDelay time.Duration,
 ) (Replicator, error) {
 	if active < 1 {
-		return replicator{}, util.Errorf("Active must be >= 1, was %d", active)
+		return replicator{}, errors.Errorf("Active must be >= 1, was %d", active)
 	}
 	if active > 50 {
 		logger.Infof("Number of concurrent updates (%v) is greater than 50, reducing to 50", active)
@@ -198,6 +204,9 @@ func (r replicator) initializeReplicationWithCheck(
 		nodeQueue,
 	)
 
+	replication.ignoreControllers = ignoreControllers
+	replication.checkPreparers = checkPreparers
+
 	var session consul.Session
 	var renewalErrCh chan error
 	if !skipLocking {
@@ -224,7 +233,7 @@ func (r replicator) checkPreparers() error {
 	for _, host := range r.nodes {
 		_, _, err := r.store.Pod(consul.REALITY_TREE, host, constants.PreparerPodID)
 		if err != nil {
-			return util.Errorf("Could not verify %v state on %q: %v", constants.PreparerPodID, host, err)
+			return errors.Errorf("Could not verify %v state on %q: %w", constants.PreparerPodID, host, err)
 		}
 	}
 	return nil
@@ -0,0 +1,118 @@
+package replication
+
+import (
+	"time"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/constants"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+)
+
+// NodeResolver returns the nodes that a replication should update, such as
+// the nodes that match a label selector
+type NodeResolver func() ([]types.NodeName, error)
+
+type NodeMatcher interface {
+	GetMatches(selector klabels.Selector, labelType labels.Type) ([]labels.Labeled, error)
+}
+
+// SelectorResolver returns a NodeResolver of the nodes that match the
+// selector, in alphabetical order
+func SelectorResolver(matcher NodeMatcher, selector klabels.Selector) NodeResolver {
+	return func() ([]types.NodeName, error) {
+		matches, err := matcher.GetMatches(selector, labels.NODE)
+		if err != nil {
+			return nil, err
+		}
+		nodes := types.NewNodeSet()
+		for _, match := range matches {
+			nodes.InsertNode(types.NodeName(match.ID))
+		}
+		return nodes.ListNodes(), nil
+	}
+}
+
+func (r *replication) SetNodeResolver(resolve NodeResolver, interval time.Duration) {
+	r.mu.Lock()
+	r.resolver = resolve
+	r.resolveInterval = interval
+	r.mu.Unlock()
+}
+
+// resolveNodes resolves the replication's nodes again. It returns the
+// pending nodes that are still resolved, followed by the resolved nodes that
+// were never queued, which are added to queued. If the nodes can't be
+// resolved, the pending nodes are returned unchanged.
+func (r *replication) resolveNodes(pending []types.NodeName, queued types.NodeSet) []types.NodeName {
+	r.mu.RLock()
+	resolve := r.resolver
+	order := r.order
+	r.mu.RUnlock()
+
+	resolved, err := resolve()
+	if err != nil {
+		r.logger.WithError(err).Errorln("Could not resolve the nodes of the replication again, carrying on with the nodes it had")
+		return pending
+	}
+	resolvedSet := types.NewNodeSet(resolved...)
+
+	var kept, dropped []types.NodeName
+	for _, node := range pending {
+		if resolvedSet.Has(node.String()) {
+			kept = append(kept, node)
+		} else {
+			dropped = append(dropped, node)
+		}
+	}
+	if len(dropped) > 0 {
+		r.logger.WithField("nodes", dropped).Infof("Skipping %d nodes that are no longer selected", len(dropped))
+	}
+
+	added := r.admitNodes(resolvedSet.Difference(queued).ListNodes())
+	if len(added) > 0 {
+		healthResults, err := r.health.Service(string(r.GetManifest().ID()))
+		if err != nil {
+			r.logger.WithError(err).Warnln("Could not get the health of the new nodes, updating them in alphabetical order")
+			order = Order{Strategy: OrderAlphabetical}
+		}
+		ordered, err := orderNodes(added, order, healthResults, r.labeler)
+		if err == nil {
+			added = ordered
+		}
+		r.logger.WithField("nodes", added).Infof("Adding %d newly selected nodes", len(added))
+		for _, node := range added {
+			queued.InsertNode(node)
+		}
+	}
+
+	r.resolveRecordNodes(added, dropped)
+	return append(kept, added...)
+}
+
+// admitNodes returns the nodes that pass the checks that the replication's
+// original nodes passed when it was initialized: that the preparer is
+// running, and that no controller manages the pod there
+func (r *replication) admitNodes(nodes []types.NodeName) []types.NodeName {
+	var admitted []types.NodeName
+	for _, node := range nodes {
+		if r.checkPreparers {
+			_, _, err := r.store.Pod(consul.REALITY_TREE, node, constants.PreparerPodID)
+			if err != nil {
+				r.logger.WithError(err).WithField("node", node).Warnf("Not adding the node because %s state could not be verified", constants.PreparerPodID)
+				continue
+			}
+		}
+		if !r.ignoreControllers {
+			err := r.checkForManagedNodes([]types.NodeName{node})
+			if err != nil {
+				r.logger.WithError(err).WithField("node", node).Warnln("Not adding the node")
+				continue
+			}
+		}
+		admitted = append(admitted, node)
+	}
+	return admitted
+}
@@ -0,0 +1,71 @@
+package replication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestNodeResolverAddsNodes(t *testing.T) {
+	defer fastPolling()()
+	// node4 has no preparer, so it must not be added
+	store := newFakeStore(t, []types.NodeName{"node1", "node2", "node3"})
+	replicator := fakeReplicator(t, []types.NodeName{"node1"}, 1, store, newFakeHealthChecker(scenarioNodes, health.Passing), NoTimeout)
+	repl, errCh, err := replicator.InitializeReplication(false, false, 0, 0, nil)
+	if err != nil {
+		t.Fatalf("Unable to initialize replication: %s", err)
+	}
+	errsCh := collectErrors(errCh)
+	record, err := NewRecord(basicManifest(), []types.NodeName{"node1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repl.SetRecord(record)
+	repl.SetOrder(Order{Strategy: OrderAlphabetical})
+	repl.SetNodeResolver(func() ([]types.NodeName, error) {
+		return []types.NodeName{"node1", "node3", "node4"}, nil
+	}, time.Hour)
+	phasesCh := collectPhases(repl.ProgressUpdates())
+
+	enactWithin(t, repl, 10*time.Second)
+	phases := <-phasesCh
+	if errs := <-errsCh; len(errs) != 0 {
+		t.Errorf("unexpected replication errors: %s", errs)
+	}
+
+	for _, node := range []types.NodeName{"node1", "node3"} {
+		if lastPhase(phases[node]) != NodeHealthy {
+			t.Errorf("expected %s to be updated, got %v", node, phases[node])
+		}
+	}
+	for _, node := range []types.NodeName{"node2", "node4"} {
+		if len(phases[node]) != 0 {
+			t.Errorf("expected %s not to be updated, got %v", node, phases[node])
+		}
+	}
+	if _, ok := store.record(record.ID); ok {
+		t.Error("expected the record to be removed once the resolved nodes were completed")
+	}
+}
+
+func TestResolveNodesSkipsDroppedNodes(t *testing.T) {
+	store := newFakeStore(t, scenarioNodes)
+	repl, _ := startFakeReplication(t, store, newFakeHealthChecker(scenarioNodes, health.Passing), NoTimeout)
+	defer repl.Cancel()
+	repl.SetNodeResolver(func() ([]types.NodeName, error) {
+		return []types.NodeName{"node4", "node1", "node3"}, nil
+	}, time.Hour)
+
+	queued := types.NewNodeSet("node1", "node2", "node3")
+	pending := repl.(*replication).resolveNodes([]types.NodeName{"node2", "node3"}, queued)
+
+	expected := []types.NodeName{"node3", "node4"}
+	if len(pending) != len(expected) || pending[0] != expected[0] || pending[1] != expected[1] {
+		t.Errorf("expected the pending nodes to be %s, got %s", expected, pending)
+	}
+	if !queued.Has("node4") {
+		t.Error("expected the added node to count as queued")
+	}
+}
@@ -0,0 +1,67 @@
+package replication
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
+)
+
+func (r *replication) SetRetries(count int) {
+	r.mu.Lock()
+	r.retries = count
+	r.mu.Unlock()
+}
+
+// updateWithRetries updates the node, updating it again up to the
+// replication's number of retries if it times out or hits an error. Each
+// attempt gets the full per-node timeout. Nodes aren't retried once the
+// replication is stopped, nor when the error says retrying can't help.
+func (r *replication) updateWithRetries(node types.NodeName, aggregateHealth *podHealth) error {
+	r.mu.RLock()
+	retries := r.retries
+	r.mu.RUnlock()
+
+	for attempt := 0; ; attempt++ {
+		err := r.updateAttempt(node, aggregateHealth)
+		if err == nil || err == errCancelled || err == errQuit || attempt >= retries {
+			return err
+		}
+		if !errors.Retryable(err) {
+			r.logger.WithError(err).WithField("node", node).Errorln("Not retrying node, the error can't be fixed by retrying")
+			return err
+		}
+		if r.checkStopped() != nil {
+			return err
+		}
+
+		// updateOne counts the node as completed whenever it gives
+		// up on it, but it isn't done until its last attempt
+		atomic.AddInt32(&r.completedCount, -1)
+		r.logger.WithError(err).WithField("node", node).Warnf("Retrying node (retry %d of %d)", attempt+1, retries)
+		r.reportProgress(node, NodeRetrying, err)
+	}
+}
+
+// updateAttempt makes a single attempt at updating the node, which gives up
+// once the replication's per-node timeout passes
+func (r *replication) updateAttempt(node types.NodeName, aggregateHealth *podHealth) error {
+	r.mu.RLock()
+	timeout := r.timeout
+	r.mu.RUnlock()
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout == NoTimeout {
+		ctx, cancel = context.WithCancel(context.Background())
+	} else {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	}
+	defer cancel()
+	ctx, cancelTxn := transaction.New(ctx)
+	defer cancelTxn()
+
+	return r.updateOne(ctx, node, aggregateHealth)
+}
@@ -0,0 +1,133 @@
+package replication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestRetryRecoversNode(t *testing.T) {
+	defer fastPolling()()
+	store := newFakeStore(t, scenarioNodes)
+	store.stall("node2")
+	repl, errsCh := startFakeReplication(t, store, newFakeHealthChecker(scenarioNodes, health.Passing), 100*time.Millisecond)
+	repl.SetRetries(1)
+	progress := repl.ProgressUpdates()
+
+	enactDone := make(chan struct{})
+	go func() {
+		defer close(enactDone)
+		repl.Enact()
+	}()
+
+	var node2Phases []NodePhase
+	for update := range progress {
+		if update.Node != "node2" {
+			continue
+		}
+		node2Phases = append(node2Phases, update.Phase)
+		if update.Phase == NodeInstalling {
+			// the intent was already written while the preparer
+			// was stalled, so only a retry can get it installed
+			store.unstall("node2")
+		}
+		if update.Phase == NodeRetrying && update.Err != errTimeout {
+			t.Errorf("expected node2 to be retried because it timed out, got %v", update.Err)
+		}
+	}
+	<-enactDone
+	if errs := <-errsCh; len(errs) != 0 {
+		t.Errorf("unexpected replication errors: %s", errs)
+	}
+
+	expected := []NodePhase{NodeScheduled, NodeInstalling, NodeRetrying, NodeInstalling, NodeHealthy}
+	if len(node2Phases) != len(expected) {
+		t.Fatalf("expected node2 to go through %v, got %v", expected, node2Phases)
+	}
+	for i := range expected {
+		if node2Phases[i] != expected[i] {
+			t.Fatalf("expected node2 to go through %v, got %v", expected, node2Phases)
+		}
+	}
+	if count := repl.CompletedCount(); count != int32(len(scenarioNodes)) {
+		t.Errorf("expected a retried node to be completed once, got %d completed nodes", count)
+	}
+}
+
+func TestRetriesExhaustedAbort(t *testing.T) {
+	defer fastPolling()()
+	store := newFakeStore(t, scenarioNodes)
+	store.stall("node2")
+	repl, errsCh := startFakeReplication(t, store, newFakeHealthChecker(scenarioNodes, health.Passing), 50*time.Millisecond)
+	repl.SetRetries(2)
+	repl.SetRollbackPolicy(AbortOnFailure)
+	phasesCh := collectPhases(repl.ProgressUpdates())
+
+	enactWithin(t, repl, 10*time.Second)
+	phases := <-phasesCh
+	if errs := <-errsCh; len(errs) != 1 {
+		t.Errorf("expected the abort to be reported as one replication error, got %s", errs)
+	}
+
+	retries := 0
+	for _, phase := range phases["node2"] {
+		if phase == NodeRetrying {
+			retries++
+		}
+	}
+	if retries != 2 || lastPhase(phases["node2"]) != NodeFailed {
+		t.Errorf("expected node2 to be retried twice and then fail, it went through %v", phases["node2"])
+	}
+
+	target, _ := basicManifest().SHA()
+	if sha := store.podSHA(t, consul.REALITY_TREE, "node1", testPodId); sha != target {
+		t.Errorf("expected node1 to keep the manifest after the abort, got %q", sha)
+	}
+	for _, node := range scenarioNodes[2:] {
+		if sha := store.podSHA(t, consul.INTENT_TREE, node, testPodId); sha != "" {
+			t.Errorf("expected %s not to be updated after node2 failed, got %q", node, sha)
+		}
+	}
+}
+
+func TestRetriesSkipErrorsRetryingCantFix(t *testing.T) {
+	defer fastPolling()()
+	store := newFakeStore(t, scenarioNodes)
+	store.failIntentWrites("node2", errors.Codef(errors.CodeInvalid, "the manifest can't be given to node2"))
+	store.failIntentWrites("node3", errors.Codef(errors.CodeUnavailable, "consul is down"))
+	repl, errsCh := startFakeReplication(t, store, newFakeHealthChecker(scenarioNodes, health.Passing), time.Second)
+	repl.SetRetries(2)
+	phasesCh := collectPhases(repl.ProgressUpdates())
+
+	enactWithin(t, repl, 10*time.Second)
+	phases := <-phasesCh
+	<-errsCh
+
+	retries := func(node types.NodeName) int {
+		count := 0
+		for _, phase := range phases[node] {
+			if phase == NodeRetrying {
+				count++
+			}
+		}
+		return count
+	}
+	if retries("node2") != 0 || lastPhase(phases["node2"]) != NodeFailed {
+		t.Errorf("expected node2 to fail without being retried, it went through %v", phases["node2"])
+	}
+	if retries("node3") != 2 || lastPhase(phases["node3"]) != NodeFailed {
+		t.Errorf("expected node3 to be retried twice and then fail, it went through %v", phases["node3"])
+	}
+	for _, node := range []types.NodeName{"node1", "node4"} {
+		if lastPhase(phases[node]) != NodeHealthy {
+			t.Errorf("expected %s to be updated, it went through %v", node, phases[node])
+		}
+	}
+	if count := repl.CompletedCount(); count != int32(len(scenarioNodes)) {
+		t.Errorf("expected every node to be completed once, got %d completed nodes", count)
+	}
+}
@@ -0,0 +1,180 @@
+package replication
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
+)
+
+// RollbackPolicy determines what a replication does with the nodes it already
+// updated, and the nodes left to update, when a node fails to become healthy.
+// A node only fails once its retries (see SetRetries()) are exhausted.
+type RollbackPolicy string
+
+const (
+	// The replication carries on with the remaining nodes and leaves the
+	// failed ones alone. This is the default.
+	NoRollback RollbackPolicy = "none"
+
+	// No further nodes are updated, and the nodes that were already
+	// updated are left as they are.
+	AbortOnFailure RollbackPolicy = "abort"
+
+	// No further nodes are updated, and every node the replication wrote
+	// intent for gets its previous intent manifest back. Nodes that had no
+	// intent for the pod have it removed. Only nodes that time out or hit
+	// an error count as failed, so this is most useful with a timeout.
+	RollbackOnFailure RollbackPolicy = "on_failure"
+)
+
+func (r *replication) SetRollbackPolicy(policy RollbackPolicy) {
+	r.mu.Lock()
+	r.rollbackPolicy = policy
+	if policy != NoRollback && r.failedCh == nil {
+		r.failedCh = make(chan struct{})
+	}
+	r.mu.Unlock()
+}
+
+func (r *replication) rollsBack() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rollbackPolicy == RollbackOnFailure
+}
+
+// stopsOnFailure returns whether no further nodes are updated once a node
+// fails
+func (r *replication) stopsOnFailure() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rollbackPolicy == RollbackOnFailure || r.rollbackPolicy == AbortOnFailure
+}
+
+// recordPreviousIntent remembers the intent manifest a node had for the pod
+// before the replication overwrites it, so that it can be rolled back
+func (r *replication) recordPreviousIntent(node types.NodeName) error {
+	if !r.rollsBack() {
+		return nil
+	}
+
+	r.rollbackMu.Lock()
+	_, ok := r.previousIntent[node]
+	r.rollbackMu.Unlock()
+	if ok {
+		// the manifest was changed while the replication was in
+		// progress, so the node was already written to
+		return nil
+	}
+
+	previous, _, err := r.store.Pod(consul.INTENT_TREE, node, r.GetManifest().ID())
+	if err == pods.NoCurrentManifest {
+		previous = nil
+	} else if err != nil {
+		return errors.Errorf("could not read intent of %s to be able to roll it back: %w", node, err)
+	}
+
+	r.rollbackMu.Lock()
+	if r.previousIntent == nil {
+		r.previousIntent = make(map[types.NodeName]manifest.Manifest)
+	}
+	r.previousIntent[node] = previous
+	r.rollbackMu.Unlock()
+	return nil
+}
+
+// nodeFailed records that a node could not be updated. Under the
+// RollbackOnFailure and AbortOnFailure policies this stops any further nodes
+// from being updated.
+func (r *replication) nodeFailed(node types.NodeName) {
+	r.rollbackMu.Lock()
+	defer r.rollbackMu.Unlock()
+	r.failedNodes = append(r.failedNodes, node)
+	if len(r.failedNodes) == 1 && r.stopsOnFailure() {
+		close(r.failedCh)
+	}
+}
+
+// rollbackIfFailed rolls back every node the replication wrote intent for if
+// the RollbackOnFailure policy is in effect and a node failed. It returns
+// an error describing the failure and the rollback, or nil if there was
+// nothing to roll back. Under the AbortOnFailure policy, it only returns an
+// error describing the failure.
+func (r *replication) rollbackIfFailed() error {
+	if !r.stopsOnFailure() {
+		return nil
+	}
+
+	r.rollbackMu.Lock()
+	failed := r.failedNodes
+	if len(failed) > 0 && !r.rollsBack() {
+		r.rollbackMu.Unlock()
+		failedSet := make(map[types.NodeName]bool)
+		for _, node := range failed {
+			failedSet[node] = true
+		}
+		return errors.Errorf("%s failed to become healthy, no further nodes were updated", joinNodes(failedSet))
+	}
+	previousIntent := make(map[types.NodeName]manifest.Manifest, len(r.previousIntent))
+	for node, previous := range r.previousIntent {
+		previousIntent[node] = previous
+	}
+	r.rollbackMu.Unlock()
+	if len(failed) == 0 {
+		return nil
+	}
+
+	failedSet := make(map[types.NodeName]bool)
+	for _, node := range failed {
+		failedSet[node] = true
+	}
+	r.logger.WithField("failed", joinNodes(failedSet)).Warnf("Rolling back %d nodes", len(previousIntent))
+
+	notRolledBack := make(map[types.NodeName]bool)
+	for node, previous := range previousIntent {
+		err := r.rollbackNode(node, previous)
+		if err != nil {
+			r.logger.WithError(err).WithField("node", node).Errorln("Could not roll back node")
+			notRolledBack[node] = true
+			continue
+		}
+		r.recordRolledBack(node)
+	}
+
+	msg := fmt.Sprintf("%s failed to become healthy, rolled back %d nodes", joinNodes(failedSet), len(previousIntent)-len(notRolledBack))
+	if len(notRolledBack) > 0 {
+		msg += fmt.Sprintf(", could not roll back %s", joinNodes(notRolledBack))
+	}
+	return errors.Errorf("%s", msg)
+}
+
+// rollbackNode restores the given intent manifest of a node, or removes the
+// pod from its intent if previous is nil
+func (r *replication) rollbackNode(node types.NodeName, previous manifest.Manifest) error {
+	ctx, cancel := transaction.New(context.Background())
+	defer cancel()
+
+	var err error
+	if previous == nil {
+		err = r.store.DeletePodTxn(ctx, consul.INTENT_TREE, node, r.GetManifest().ID())
+	} else {
+		err = r.store.SetPodTxn(ctx, consul.INTENT_TREE, node, previous)
+	}
+	if err != nil {
+		return err
+	}
+
+	ok, resp, err := transaction.CommitWithRetries(ctx, r.txner)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.Errorf("got transaction conflict writing intent store for %s: %s", node, transaction.TxnErrorsToString(resp.Errors))
+	}
+	return nil
+}
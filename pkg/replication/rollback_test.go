@@ -0,0 +1,75 @@
+// +build !race
+
+package replication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestEnactRollsBackOnFailure(t *testing.T) {
+	errCh := make(chan error)
+	r, fixture := newTestReplication(t, errCh)
+	defer fixture.Stop()
+	r.errCh = errCh
+	r.timeout = 5 * time.Second
+	healthChecker, resultsCh := channelHealthChecker(r.nodes, t)
+	r.health = healthChecker
+	r.SetRollbackPolicy(RollbackOnFailure)
+
+	podStore := consul.NewConsulStore(fixture.Client)
+	builder := manifest.NewBuilder()
+	builder.SetID(r.GetManifest().ID())
+	builder.SetRunAsUser("previous")
+	previous := builder.GetManifest()
+	withPrevious, withoutPrevious := r.nodes[0], r.nodes[1]
+	_, err := podStore.SetPod(consul.INTENT_TREE, withPrevious, previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	critical := make(map[types.NodeName]health.Result)
+	for _, node := range r.nodes {
+		critical[node] = health.Result{ID: testPodId, Status: health.Critical}
+	}
+	go func() {
+		resultsCh <- critical
+	}()
+
+	enactDone := make(chan struct{})
+	go func() {
+		defer close(enactDone)
+		r.Enact()
+	}()
+
+	select {
+	case err := <-errCh:
+		if !IsFatalError(err) {
+			t.Errorf("expected a rolled back replication to be a fatal error, got %s", err)
+		}
+	case <-time.After(time.Minute):
+		t.Fatal("expected the replication to fail and roll back")
+	}
+	<-enactDone
+
+	intent, _, err := podStore.Pod(consul.INTENT_TREE, withPrevious, previous.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	previousSHA, _ := previous.SHA()
+	intentSHA, _ := intent.SHA()
+	if intentSHA != previousSHA {
+		t.Errorf("expected %s to get its previous manifest back", withPrevious)
+	}
+
+	_, _, err = podStore.Pod(consul.INTENT_TREE, withoutPrevious, previous.ID())
+	if err != pods.NoCurrentManifest {
+		t.Errorf("expected the pod to be removed from the intent of %s, got %v", withoutPrevious, err)
+	}
+}
@@ -0,0 +1,323 @@
+package replication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+)
+
+var scenarioNodes = []types.NodeName{"node1", "node2", "node3", "node4"}
+
+// startFakeReplication initializes a replication of basicManifest() to the
+// nodes that updates them one at a time in alphabetical order
+func startFakeReplication(t *testing.T, store *fakeStore, healthChecker *fakeHealthChecker, timeout time.Duration) (Replication, <-chan []error) {
+	replicator := fakeReplicator(t, scenarioNodes, 1, store, healthChecker, timeout)
+	repl, errCh, err := replicator.InitializeReplication(false, false, 0, 0, nil)
+	if err != nil {
+		t.Fatalf("Unable to initialize replication: %s", err)
+	}
+	repl.SetOrder(Order{Strategy: OrderAlphabetical})
+	return repl, collectErrors(errCh)
+}
+
+func enactWithin(t *testing.T, repl Replication, wait time.Duration) {
+	enactDone := make(chan struct{})
+	go func() {
+		defer close(enactDone)
+		repl.Enact()
+	}()
+	select {
+	case <-enactDone:
+	case <-time.After(wait):
+		t.Fatalf("replication did not finish within %s", wait)
+	}
+}
+
+func TestScenarioNodeFailsMidRoll(t *testing.T) {
+	defer fastPolling()()
+	store := newFakeStore(t, scenarioNodes)
+	store.stall("node2")
+	repl, errsCh := startFakeReplication(t, store, newFakeHealthChecker(scenarioNodes, health.Passing), 200*time.Millisecond)
+
+	record, err := NewRecord(basicManifest(), scenarioNodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repl.SetRecord(record)
+	phasesCh := collectPhases(repl.ProgressUpdates())
+	enactWithin(t, repl, 10*time.Second)
+	phases := <-phasesCh
+	if errs := <-errsCh; len(errs) != 0 {
+		t.Errorf("expected a node failure not to be a replication error without a rollback policy, got %s", errs)
+	}
+
+	target, _ := basicManifest().SHA()
+	for _, node := range scenarioNodes {
+		if node == "node2" {
+			if lastPhase(phases[node]) != NodeFailed {
+				t.Errorf("expected node2 to fail, it went through %v", phases[node])
+			}
+			continue
+		}
+		if lastPhase(phases[node]) != NodeHealthy {
+			t.Errorf("expected %s to become healthy after node2 failed, it went through %v", node, phases[node])
+		}
+		if sha := store.podSHA(t, consul.REALITY_TREE, node, testPodId); sha != target {
+			t.Errorf("expected %s to be running the manifest, got %q", node, sha)
+		}
+	}
+
+	kept, ok := store.record(record.ID)
+	if !ok {
+		t.Fatal("expected the record to be kept because node2 was not completed")
+	}
+	if remaining := kept.Remaining(); len(remaining) != 1 || remaining[0] != "node2" {
+		t.Errorf("expected only node2 to remain, got %s", remaining)
+	}
+	if _, ok := kept.Failed["node2"]; !ok {
+		t.Errorf("expected the record to have the failure of node2, got %v", kept.Failed)
+	}
+}
+
+func TestScenarioNodeFailsMidRollWithRollback(t *testing.T) {
+	defer fastPolling()()
+	store := newFakeStore(t, scenarioNodes)
+	store.stall("node3")
+	repl, errsCh := startFakeReplication(t, store, newFakeHealthChecker(scenarioNodes, health.Passing), 200*time.Millisecond)
+	repl.SetRollbackPolicy(RollbackOnFailure)
+
+	enactWithin(t, repl, 10*time.Second)
+	if errs := <-errsCh; len(errs) != 1 {
+		t.Errorf("expected the rollback to be reported as one replication error, got %s", errs)
+	}
+
+	for _, node := range scenarioNodes {
+		if sha := store.podSHA(t, consul.INTENT_TREE, node, testPodId); sha != "" {
+			t.Errorf("expected the intent of %s to be rolled back to nothing, got %q", node, sha)
+		}
+	}
+	if sha := store.podSHA(t, consul.REALITY_TREE, "node4", testPodId); sha != "" {
+		t.Errorf("expected node4 not to be updated after node3 failed, got %q", sha)
+	}
+}
+
+func TestScenarioHealthFlapping(t *testing.T) {
+	defer fastPolling()()
+	store := newFakeStore(t, scenarioNodes)
+	healthChecker := newFakeHealthChecker(scenarioNodes, health.Passing)
+	healthChecker.setHealth("node1", health.Critical)
+	repl, errsCh := startFakeReplication(t, store, healthChecker, NoTimeout)
+	repl.SetCanary(1, 5*time.Second)
+
+	// node1 is the canary, which must first become healthy and then
+	// stay healthy through the soak
+	stopFlapping := make(chan struct{})
+	defer close(stopFlapping)
+	go func() {
+		status := health.Critical
+		for {
+			select {
+			case <-stopFlapping:
+				return
+			case <-time.After(50 * time.Millisecond):
+			}
+			if status == health.Critical {
+				status = health.Passing
+			} else {
+				status = health.Critical
+			}
+			healthChecker.setHealth("node1", status)
+		}
+	}()
+
+	enactWithin(t, repl, 10*time.Second)
+	if errs := <-errsCh; len(errs) != 1 {
+		t.Errorf("expected the flapping canary to be reported as one replication error, got %s", errs)
+	}
+	target, _ := basicManifest().SHA()
+	if sha := store.podSHA(t, consul.INTENT_TREE, "node1", testPodId); sha != target {
+		t.Errorf("expected the canary to be updated, got %q", sha)
+	}
+	for _, node := range scenarioNodes[1:] {
+		if sha := store.podSHA(t, consul.INTENT_TREE, node, testPodId); sha != "" {
+			t.Errorf("expected %s not to be updated after the canary flapped, got %q", node, sha)
+		}
+	}
+}
+
+func TestScenarioWaitsForUnhealthyNode(t *testing.T) {
+	defer fastPolling()()
+	store := newFakeStore(t, scenarioNodes)
+	healthChecker := newFakeHealthChecker(scenarioNodes, health.Passing)
+	healthChecker.setHealth("node1", health.Critical)
+	repl, errsCh := startFakeReplication(t, store, healthChecker, NoTimeout)
+
+	enactDone := make(chan struct{})
+	go func() {
+		defer close(enactDone)
+		repl.Enact()
+	}()
+	select {
+	case <-enactDone:
+		t.Fatal("expected the replication to wait for node1 to become healthy")
+	case <-time.After(500 * time.Millisecond):
+	}
+	if sha := store.podSHA(t, consul.INTENT_TREE, "node2", testPodId); sha != "" {
+		t.Errorf("expected node2 not to be updated while node1 is unhealthy, got %q", sha)
+	}
+
+	healthChecker.setHealth("node1", health.Passing)
+	select {
+	case <-enactDone:
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the replication to finish once node1 became healthy")
+	}
+	if errs := <-errsCh; len(errs) != 0 {
+		t.Errorf("unexpected replication errors: %s", errs)
+	}
+}
+
+func TestScenarioLockContention(t *testing.T) {
+	store := newFakeStore(t, scenarioNodes)
+	healthChecker := newFakeHealthChecker(scenarioNodes, health.Passing)
+	first, firstErrCh, err := fakeReplicator(t, scenarioNodes, 1, store, healthChecker, NoTimeout).
+		InitializeReplication(false, false, 0, 0, nil)
+	if err != nil {
+		t.Fatalf("Unable to initialize replication: %s", err)
+	}
+	firstErrs := collectErrors(firstErrCh)
+
+	_, _, err = fakeReplicator(t, scenarioNodes, 1, store, healthChecker, NoTimeout).
+		InitializeReplication(false, false, 0, 0, nil)
+	if err == nil {
+		t.Fatal("expected a second replication of the pod not to get the lock")
+	}
+
+	second, secondErrCh, err := fakeReplicator(t, scenarioNodes, 1, store, healthChecker, NoTimeout).
+		InitializeReplication(true, false, 0, 0, nil)
+	if err != nil {
+		t.Fatalf("expected a replication that overrides the lock to take it: %s", err)
+	}
+	secondErrs := collectErrors(secondErrCh)
+
+	select {
+	case errs := <-firstErrs:
+		if len(errs) != 1 {
+			t.Errorf("expected the replication that lost its lock to report one error, got %s", errs)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the replication that lost its lock to stop")
+	}
+	if first.InProgress() {
+		t.Error("expected the replication that lost its lock not to be in progress")
+	}
+
+	second.Cancel()
+	if errs := <-secondErrs; len(errs) != 0 {
+		t.Errorf("unexpected errors from the replication that took the lock: %s", errs)
+	}
+	holder, _, err := store.LockHolder(consul.ReplicationLockPath(testPodId))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if holder != "" {
+		t.Errorf("expected the lock to be released once the replication was cancelled, held by %q", holder)
+	}
+}
+
+func TestScenarioCancelMidRoll(t *testing.T) {
+	defer fastPolling()()
+	store := newFakeStore(t, scenarioNodes)
+	store.stall("node1")
+	repl, errsCh := startFakeReplication(t, store, newFakeHealthChecker(scenarioNodes, health.Passing), NoTimeout)
+	record, err := NewRecord(basicManifest(), scenarioNodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repl.SetRecord(record)
+	progress := repl.ProgressUpdates()
+
+	enactDone := make(chan struct{})
+	go func() {
+		defer close(enactDone)
+		repl.Enact()
+	}()
+
+	var phases []NodePhase
+	for update := range progress {
+		if update.Node != "node1" {
+			t.Errorf("expected only node1 to be updated, got %s %s", update.Node, update.Phase)
+			continue
+		}
+		phases = append(phases, update.Phase)
+		if update.Phase == NodeInstalling {
+			repl.Cancel()
+		}
+	}
+	select {
+	case <-enactDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Enact to return promptly once cancelled")
+	}
+	if errs := <-errsCh; len(errs) != 0 {
+		t.Errorf("expected cancellation not to be a replication error, got %s", errs)
+	}
+
+	if lastPhase(phases) != NodeFailed {
+		t.Errorf("expected node1 to be abandoned once cancelled, it went through %v", phases)
+	}
+	for _, node := range scenarioNodes[1:] {
+		if sha := store.podSHA(t, consul.INTENT_TREE, node, testPodId); sha != "" {
+			t.Errorf("expected %s not to be updated after cancellation, got %q", node, sha)
+		}
+	}
+	kept, ok := store.record(record.ID)
+	if !ok {
+		t.Fatal("expected the record to be kept so that the replication can be resumed")
+	}
+	if len(kept.Remaining()) != len(scenarioNodes) {
+		t.Errorf("expected every node to remain, got %s", kept.Remaining())
+	}
+	if len(kept.Failed) != 0 {
+		t.Errorf("expected a cancelled node not to be recorded as failed, got %v", kept.Failed)
+	}
+}
+
+func TestScenarioClosedNodeQueue(t *testing.T) {
+	defer fastPolling()()
+	store := newFakeStore(t, scenarioNodes)
+	nodeQueue := make(chan types.NodeName)
+	repl, errCh, err := fakeReplicator(t, nil, 1, store, newFakeHealthChecker(scenarioNodes, health.Passing), NoTimeout).
+		InitializeDaemonSetReplication(nodeQueue, 0, 0, nil)
+	if err != nil {
+		t.Fatalf("Unable to initialize replication: %s", err)
+	}
+	errsCh := collectErrors(errCh)
+
+	enactDone := make(chan struct{})
+	go func() {
+		defer close(enactDone)
+		repl.Enact()
+	}()
+	nodeQueue <- "node1"
+	close(nodeQueue)
+	select {
+	case <-enactDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Enact to return once the node queue was closed")
+	}
+	if errs := <-errsCh; len(errs) != 0 {
+		t.Errorf("unexpected replication errors: %s", errs)
+	}
+
+	target, _ := basicManifest().SHA()
+	if sha := store.podSHA(t, consul.REALITY_TREE, "node1", testPodId); sha != target {
+		t.Errorf("expected node1 to be updated, got %q", sha)
+	}
+	if sha := store.podSHA(t, consul.INTENT_TREE, "node2", testPodId); sha != "" {
+		t.Errorf("expected only queued nodes to be updated, got %q on node2", sha)
+	}
+}
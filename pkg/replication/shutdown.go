@@ -0,0 +1,26 @@
+package replication
+
+import (
+	"github.com/square/p2/pkg/store/consul/statusstore/nodestatus"
+	"github.com/square/p2/pkg/types"
+)
+
+func (r *replication) SetNodeStatusStore(store nodestatus.Reader) {
+	r.nodeStatusStore = store
+}
+
+// shuttingDown returns whether the node is being taken out of service, in
+// which case its pods are expected to disappear and it is neither waited on
+// nor counted against the pod's health. A node whose status can't be read is
+// assumed to be in service.
+func (r *replication) shuttingDown(node types.NodeName) bool {
+	if r.nodeStatusStore == nil {
+		return false
+	}
+	shuttingDown, err := nodestatus.ShuttingDown(r.nodeStatusStore, node)
+	if err != nil {
+		r.logger.WithError(err).WithField("node", node).Warnln("Could not read whether the node is shutting down")
+		return false
+	}
+	return shuttingDown
+}
@@ -0,0 +1,75 @@
+package replication
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul/statusstore/nodestatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/statusstoretest"
+	"github.com/square/p2/pkg/types"
+)
+
+func shuttingDownStore(t *testing.T, nodes ...types.NodeName) nodestatus.ConsulStore {
+	store := nodestatus.NewConsul(statusstoretest.NewFake(), "preparer")
+	for _, node := range nodes {
+		err := store.Set(node, nodestatus.Status{State: nodestatus.NodeShuttingDown})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func TestEnsureHealthyDoesNotWaitForNodesShuttingDown(t *testing.T) {
+	aggregateHealth := &podHealth{
+		cond: sync.NewCond(&sync.Mutex{}),
+		curHealth: map[types.NodeName]health.Result{
+			"a": {Status: health.Critical, Reason: health.ReasonShuttingDown},
+			"b": {Status: health.Critical},
+		},
+		updated: make(chan struct{}),
+	}
+	r := &replication{
+		logger:          logging.TestLogger(),
+		nodeStatusStore: shuttingDownStore(t, "a"),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := r.ensureHealthy(ctx, "a", r.logger, aggregateHealth)
+	if err != nil {
+		t.Errorf("expected a node that is shutting down not to be waited on, got %s", err)
+	}
+	err = r.ensureHealthy(ctx, "b", r.logger, aggregateHealth)
+	if err != errTimeout {
+		t.Errorf("expected an unhealthy node that is in service to be waited on until it timed out, got %v", err)
+	}
+}
+
+func TestClaimUnhealthyIgnoresNodesShuttingDown(t *testing.T) {
+	aggregateHealth := &podHealth{
+		cond: sync.NewCond(&sync.Mutex{}),
+		curHealth: map[types.NodeName]health.Result{
+			"a": {Status: health.Passing},
+			"b": {Status: health.Passing},
+			"c": {Status: health.Passing},
+			"d": {Status: health.Critical},
+		},
+	}
+	r := &replication{
+		nodes:           []types.NodeName{"a", "b", "c", "d", "e"},
+		logger:          logging.TestLogger(),
+		nodeStatusStore: shuttingDownStore(t, "d", "e"),
+	}
+
+	// 3 of 5 hosts are healthy, which would be too few to take one down,
+	// but the 2 that are shutting down don't count
+	ok, healthy, total := r.claimUnhealthy("a", MinHealthy{Percent: 60}, aggregateHealth)
+	if !ok || healthy != 3 || total != 3 {
+		t.Errorf("expected a to be claimed with 3 of 3 hosts healthy, got %t with %d of %d", ok, healthy, total)
+	}
+}
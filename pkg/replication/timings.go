@@ -0,0 +1,146 @@
+package replication
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/deploystatus"
+	"github.com/square/p2/pkg/types"
+)
+
+// Phase names one part of the time it takes to update a node
+type Phase string
+
+const (
+	// Measured by the replication, from when the intent is written to
+	// when the preparer on the node acknowledges it. See SetAckStore()
+	PhaseAcknowledge Phase = "acknowledge"
+
+	// Phases measured by the preparer on the node
+	PhaseFetch   Phase = "fetch"
+	PhaseVerify  Phase = "verify"
+	PhaseInstall Phase = "install"
+	PhaseRestart Phase = "restart"
+
+	// Phases measured by the replication. First healthy runs from when the
+	// node reports the new manifest in reality to when it passes health
+	// checks, total from when the intent is written to when the node is
+	// healthy.
+	PhaseFirstHealthy Phase = "first_healthy"
+	PhaseTotal        Phase = "total"
+)
+
+// Phases lists every phase in the order that they happen
+var Phases = []Phase{PhaseAcknowledge, PhaseFetch, PhaseVerify, PhaseInstall, PhaseRestart, PhaseFirstHealthy, PhaseTotal}
+
+// NodeTiming holds how long each phase of updating a node took. Phases that
+// weren't measured are missing from the map.
+type NodeTiming struct {
+	Node   types.NodeName
+	Phases map[Phase]time.Duration
+}
+
+// PhaseSummary aggregates the durations of one phase over a set of nodes
+type PhaseSummary struct {
+	Phase Phase
+	// The number of nodes that the phase was measured on
+	Nodes   int
+	P50     time.Duration
+	P95     time.Duration
+	Max     time.Duration
+	Slowest types.NodeName
+}
+
+// DeployStatusStore reads the deploy timings recorded by the preparer on each
+// node
+type DeployStatusStore interface {
+	Get(node types.NodeName) (deploystatus.Status, *api.QueryMeta, error)
+}
+
+func (r *replication) recordNodeTiming(timing NodeTiming) {
+	r.nodeTimingsMutex.Lock()
+	defer r.nodeTimingsMutex.Unlock()
+	r.nodeTimings = append(r.nodeTimings, timing)
+}
+
+func (r *replication) NodeTimings() []NodeTiming {
+	r.nodeTimingsMutex.Lock()
+	defer r.nodeTimingsMutex.Unlock()
+	timings := make([]NodeTiming, len(r.nodeTimings))
+	copy(timings, r.nodeTimings)
+	return timings
+}
+
+// AddPreparerTimings adds the phases that the preparer on each node recorded
+// for man to timings. Nodes whose recorded timings are for another manifest,
+// e.g. because the node already had man and didn't need to deploy it, are
+// left as they are.
+func AddPreparerTimings(timings []NodeTiming, man manifest.Manifest, statuses DeployStatusStore, logger logging.Logger) {
+	sha, _ := man.SHA()
+	for _, timing := range timings {
+		status, _, err := statuses.Get(timing.Node)
+		if statusstore.IsNoStatus(err) {
+			continue
+		}
+		if err != nil {
+			logger.WithErrorAndFields(err, logrus.Fields{"node": timing.Node}).Warnln("Could not read deploy timings")
+			continue
+		}
+		deploy, ok := status.Pods[man.ID()]
+		if !ok || deploy.SHA != sha {
+			continue
+		}
+		timing.Phases[PhaseFetch] = deploy.Fetch
+		timing.Phases[PhaseVerify] = deploy.Verify
+		timing.Phases[PhaseInstall] = deploy.Install
+		timing.Phases[PhaseRestart] = deploy.Restart
+	}
+}
+
+// SummarizeTimings computes the median, 95th percentile and maximum of each
+// phase over the nodes it was measured on. Phases that weren't measured on
+// any node are left out.
+func SummarizeTimings(timings []NodeTiming) []PhaseSummary {
+	var summaries []PhaseSummary
+	for _, phase := range Phases {
+		var measured []NodeTiming
+		for _, timing := range timings {
+			if _, ok := timing.Phases[phase]; ok {
+				measured = append(measured, timing)
+			}
+		}
+		if len(measured) == 0 {
+			continue
+		}
+		sort.Slice(measured, func(i, j int) bool {
+			return measured[i].Phases[phase] < measured[j].Phases[phase]
+		})
+
+		slowest := measured[len(measured)-1]
+		summaries = append(summaries, PhaseSummary{
+			Phase:   phase,
+			Nodes:   len(measured),
+			P50:     percentile(measured, phase, 50),
+			P95:     percentile(measured, phase, 95),
+			Max:     slowest.Phases[phase],
+			Slowest: slowest.Node,
+		})
+	}
+	return summaries
+}
+
+// percentile uses the nearest rank method, sorted must be in increasing order
+// of phase
+func percentile(sorted []NodeTiming, phase Phase, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1].Phases[phase]
+}
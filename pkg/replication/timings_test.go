@@ -0,0 +1,78 @@
+package replication
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/deploystatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/statusstoretest"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestSummarizeTimings(t *testing.T) {
+	var timings []NodeTiming
+	for i := 1; i <= 20; i++ {
+		timings = append(timings, NodeTiming{
+			Node:   types.NodeName(fmt.Sprintf("node%d", i)),
+			Phases: map[Phase]time.Duration{PhaseTotal: time.Duration(i) * time.Second},
+		})
+	}
+	// only one node has been measured by its preparer
+	timings[3].Phases[PhaseFetch] = time.Minute
+
+	summaries := SummarizeTimings(timings)
+	if len(summaries) != 2 {
+		t.Fatalf("Expected summaries of the two measured phases, got %+v", summaries)
+	}
+
+	fetch := summaries[0]
+	if fetch.Phase != PhaseFetch || fetch.Nodes != 1 || fetch.P50 != time.Minute || fetch.Slowest != "node4" {
+		t.Errorf("Unexpected fetch summary %+v", fetch)
+	}
+
+	total := summaries[1]
+	if total.Phase != PhaseTotal || total.Nodes != 20 {
+		t.Fatalf("Unexpected total summary %+v", total)
+	}
+	if total.P50 != 10*time.Second || total.P95 != 19*time.Second || total.Max != 20*time.Second || total.Slowest != "node20" {
+		t.Errorf("Unexpected total percentiles %+v", total)
+	}
+}
+
+func TestAddPreparerTimings(t *testing.T) {
+	statuses := deploystatus.NewConsul(statusstoretest.NewFake(), statusstore.DeployTimingStatusNamespace)
+	man := basicManifest()
+	sha, _ := man.SHA()
+
+	err := statuses.Set("node1", deploystatus.Status{Pods: map[types.PodID]deploystatus.Deploy{
+		testPodId: {SHA: sha, Fetch: time.Second, Restart: 2 * time.Second},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// node2 last deployed an older manifest
+	err = statuses.Set("node2", deploystatus.Status{Pods: map[types.PodID]deploystatus.Deploy{
+		testPodId: {SHA: "older", Fetch: time.Second},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timings := []NodeTiming{
+		{Node: "node1", Phases: map[Phase]time.Duration{PhaseTotal: time.Minute}},
+		{Node: "node2", Phases: map[Phase]time.Duration{PhaseTotal: time.Minute}},
+		{Node: "node3", Phases: map[Phase]time.Duration{PhaseTotal: time.Minute}},
+	}
+	AddPreparerTimings(timings, man, statuses, basicLogger())
+
+	if timings[0].Phases[PhaseFetch] != time.Second || timings[0].Phases[PhaseRestart] != 2*time.Second {
+		t.Errorf("Expected node1's preparer timings to be added, got %+v", timings[0].Phases)
+	}
+	for _, timing := range timings[1:] {
+		if len(timing.Phases) != 1 {
+			t.Errorf("Expected no preparer timings for %s, got %+v", timing.Node, timing.Phases)
+		}
+	}
+}
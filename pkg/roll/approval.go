@@ -0,0 +1,71 @@
+package roll
+
+import (
+	"bytes"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+
+	rcf "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/roll/fields"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/util"
+)
+
+// ProtectedLabel marks pods protected by the two-person rule: a rolling update
+// to an RC whose pod labels set it to "true" only updates its first batch of
+// nodes, the canary, until someone other than the requester of the update
+// approves it. The approval is a signature by a key in the approvers' keyring
+// of the orchestrator running the update, recorded with p2-rctl
+// approve-rolling-update.
+const ProtectedLabel = "protected"
+
+// isProtected returns whether the pods of rc are protected
+func isProtected(rc rcf.RC) bool {
+	return rc.PodLabels.Get(ProtectedLabel) == "true"
+}
+
+// checkApproval returns the identity of the approver of the update, or an
+// error if approval doesn't carry a valid signature by a key in keyring or
+// was signed by the requester of the update.
+func checkApproval(keyring openpgp.KeyRing, u fields.Update, approval *consul.RollApproval) (string, error) {
+	if approval == nil {
+		return "", util.Errorf("the update has not been approved")
+	}
+	if keyring == nil {
+		return "", util.Errorf("no approvers' keyring is configured, approvals can't be checked")
+	}
+
+	signer, err := openpgp.CheckDetachedSignature(
+		keyring,
+		bytes.NewReader(consul.RollApprovalMessage(u.ID().String())),
+		bytes.NewReader(approval.Signature),
+	)
+	if err != nil {
+		return "", util.Errorf("invalid approval signature: %s", err)
+	}
+
+	var approver string
+	for _, identity := range signer.Identities {
+		if approver == "" {
+			approver = identity.Name
+			if identity.UserId != nil && identity.UserId.Email != "" {
+				approver = identity.UserId.Email
+			}
+		}
+		if u.Requester != "" && isUser(identity, u.Requester) {
+			return "", util.Errorf("the update was approved by its requester %s", u.Requester)
+		}
+	}
+	return approver, nil
+}
+
+// isUser returns whether identity belongs to the user with the given name,
+// i.e. whether it is the local part of the identity's email address
+func isUser(identity *openpgp.Identity, user string) bool {
+	if identity.UserId == nil {
+		return false
+	}
+	email := identity.UserId.Email
+	return email == user || strings.SplitN(email, "@", 2)[0] == user
+}
@@ -0,0 +1,94 @@
+// +build !race
+
+package roll
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/store/consul"
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+func newApprover(t *testing.T, name, email string) *openpgp.Entity {
+	entity, err := openpgp.NewEntity(name, "", email, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entity
+}
+
+func signApproval(t *testing.T, signer *openpgp.Entity, rollID string) *consul.RollApproval {
+	var signature bytes.Buffer
+	err := openpgp.DetachSign(&signature, signer, bytes.NewReader(consul.RollApprovalMessage(rollID)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &consul.RollApproval{Signature: signature.Bytes()}
+}
+
+func TestCheckApproval(t *testing.T) {
+	alice := newApprover(t, "Alice", "alice@example.com")
+	bob := newApprover(t, "Bob", "bob@example.com")
+	mallory := newApprover(t, "Mallory", "mallory@example.com")
+	keyring := openpgp.EntityList{alice, bob}
+
+	upd, _, _, _, f := updateWithHealth(t, 1, 0, nil, nil, nil, nil, rc_fields.StaticStrategy)
+	defer f()
+	upd.Requester = "alice"
+	id := upd.ID().String()
+
+	approver, err := checkApproval(keyring, upd.Update, signApproval(t, bob, id))
+	if err != nil || approver != "bob@example.com" {
+		t.Errorf("Expected bob's approval to be accepted, got %q, %v", approver, err)
+	}
+
+	_, err = checkApproval(keyring, upd.Update, signApproval(t, alice, id))
+	if err == nil {
+		t.Error("Expected the requester's own approval to be refused")
+	}
+	_, err = checkApproval(keyring, upd.Update, signApproval(t, mallory, id))
+	if err == nil {
+		t.Error("Expected an approval by a key outside the keyring to be refused")
+	}
+	_, err = checkApproval(keyring, upd.Update, signApproval(t, bob, "some-other-update"))
+	if err == nil {
+		t.Error("Expected an approval of a different update to be refused")
+	}
+	_, err = checkApproval(nil, upd.Update, signApproval(t, bob, id))
+	if err == nil {
+		t.Error("Expected approvals to be refused without a keyring")
+	}
+}
+
+func TestProtectedUpdateWaitsForApproval(t *testing.T) {
+	bob := newApprover(t, "Bob", "bob@example.com")
+	upd, _, _, _, f := updateWithHealth(t, 1, 0, nil, nil, nil, nil, rc_fields.StaticStrategy)
+	defer f()
+	upd.approverKeyring = openpgp.EntityList{bob}
+
+	if isProtected(rc_fields.RC{}) {
+		t.Error("Expected an RC without pod labels not to be protected")
+	}
+	upd.protected = isProtected(rc_fields.RC{PodLabels: klabels.Set{ProtectedLabel: "true"}})
+	if !upd.protected {
+		t.Fatal("Expected an RC whose pods are labeled protected to be protected")
+	}
+
+	if upd.approved() {
+		t.Error("Expected a protected update without approval not to be approved")
+	}
+	store := upd.consuls.(interface {
+		SetRollApproval(rollID string, approval consul.RollApproval) error
+	})
+	err := store.SetRollApproval(upd.ID().String(), *signApproval(t, bob, upd.ID().String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !upd.approved() {
+		t.Error("Expected the update to be approved once bob signed off")
+	}
+}
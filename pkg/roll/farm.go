@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/square/p2/pkg/alerting"
@@ -25,13 +26,18 @@ import (
 	"github.com/square/p2/pkg/store/consul/transaction"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/webhook"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/hashicorp/consul/api"
 	"github.com/rcrowley/go-metrics"
+	"golang.org/x/crypto/openpgp"
 	klabels "k8s.io/kubernetes/pkg/labels"
 )
 
+// rollFarmOrchestrator identifies rolling updates in webhook events
+const rollFarmOrchestrator = "roll_farm"
+
 type Factory interface {
 	New(roll_fields.Update, logging.Logger, consul.Session) Update
 }
@@ -58,6 +64,14 @@ type UpdateFactory struct {
 
 	ShouldCreateAuditLogRecords bool
 	AuditLogStore               auditlogstore.ConsulStore
+
+	// Notifier sends the lifecycle events of updates to webhooks. May be
+	// nil
+	Notifier webhook.Notifier
+
+	// ApproverKeyring holds the keys of the operators who may approve
+	// updates of protected pods. May be nil
+	ApproverKeyring openpgp.KeyRing
 }
 
 type labeler interface {
@@ -121,6 +135,8 @@ func (f UpdateFactory) New(u roll_fields.Update, l logging.Logger, session consu
 		f.scheduler,
 		f.ShouldCreateAuditLogRecords,
 		f.AuditLogStore,
+		f.Notifier,
+		f.ApproverKeyring,
 	)
 }
 
@@ -167,6 +183,10 @@ type childRU struct {
 	ru       Update
 	unlocker consul.Unlocker
 	cancel   context.CancelFunc
+
+	// deleted is set to 1 when the child is released because its RU was
+	// deleted from under it. Accessed atomically.
+	deleted *int32
 }
 
 func (c childRU) Cancel() {
@@ -180,6 +200,10 @@ type FarmConfig struct {
 	// log records when deleting a rolling update, which occurs after completing
 	// the RU
 	ShouldCreateAuditLogRecords bool
+
+	// Notifier sends an "aborted" event to webhooks when a rolling update
+	// is deleted before it completed. If nil, no events are sent
+	Notifier webhook.Notifier
 }
 
 func NewFarm(
@@ -319,10 +343,12 @@ START_LOOP:
 
 				newChild := rlf.factory.New(rlField, rlLogger, rlf.session)
 				childCtx, cancel := context.WithCancel(context.Background())
+				deleted := new(int32)
 				rlf.children[rlField.ID()] = childRU{
 					ru:       newChild,
 					unlocker: unlocker,
 					cancel:   cancel,
+					deleted:  deleted,
 				}
 				foundChildren[rlField.ID()] = struct{}{}
 
@@ -347,6 +373,7 @@ START_LOOP:
 				}
 
 				newRC := rlField.NewRC
+				podID := rcField.Manifest.ID()
 				go func(id roll_fields.ID) {
 					defer func() {
 						endTime := time.Now()
@@ -378,8 +405,11 @@ START_LOOP:
 							}
 						}
 					}()
-					newChild.Run(childCtx)
-					// We don't know or care if Run() succeeded. If it succeeded, we should release the child since the RU
+					succeeded := newChild.Run(childCtx)
+					if !succeeded && atomic.LoadInt32(deleted) == 1 {
+						rlf.notifyAborted(id, podID)
+					}
+					// We don't otherwise care if Run() succeeded. If it succeeded, we should release the child since the RU
 					// no longer exists. If it failed (was canceled) we want to give another farm a chance to handle it
 					// and we're probably shutting down anyway
 					rlf.childMu.Lock()
@@ -402,11 +432,26 @@ func (rlf *Farm) releaseDeletedChildren(foundChildren map[roll_fields.ID]struct{
 	rlf.logger.NoFields().Debugln("Pruning updates that have disappeared")
 	for id := range rlf.children {
 		if _, ok := foundChildren[id]; !ok {
+			atomic.StoreInt32(rlf.children[id].deleted, 1)
 			rlf.releaseChild(id)
 		}
 	}
 }
 
+func (rlf *Farm) notifyAborted(id roll_fields.ID, podID types.PodID) {
+	if rlf.config.Notifier == nil {
+		return
+	}
+
+	rlf.config.Notifier.Notify(webhook.Event{
+		Type:         webhook.EventAborted,
+		Orchestrator: rollFarmOrchestrator,
+		DeploymentID: id.String(),
+		PodID:        podID.String(),
+		Message:      fmt.Sprintf("Rolling update %s was deleted before it completed", id),
+	})
+}
+
 // test if the farm should work on the given replication controller ID
 func (rlf *Farm) shouldWorkOn(rcID fields.ID) (bool, error) {
 	if rlf.rcSelector.Empty() {
@@ -52,6 +52,11 @@ type Update struct {
 	// unhealthy after being healthy for a short duration. Naive implementations like
 	// p2-replicate do not handle such after-the-fact unhealthiness. Default is 0.
 	RollDelay time.Duration
+
+	// Requester is the name of the user who requested the update, if
+	// known. Updates of protected pods must be approved by someone else,
+	// see roll.ProtectedLabel.
+	Requester string `json:",omitempty"`
 }
 
 // Implementation detail: a rolling updates ID matches that of it's NewRC. We may
@@ -307,6 +307,8 @@ func TestLockRCs(t *testing.T) {
 		nil,
 		false,
 		auditlogstore.ConsulStore{},
+		nil,
+		nil,
 	).(*update)
 	lockCtx, lockCancel := transaction.New(context.Background())
 	defer lockCancel()
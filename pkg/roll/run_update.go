@@ -21,13 +21,16 @@ import (
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/rcstore"
 	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/nodestatus"
 	"github.com/square/p2/pkg/store/consul/statusstore/rcstatus"
 	"github.com/square/p2/pkg/store/consul/transaction"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/webhook"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/hashicorp/consul/api"
+	"golang.org/x/crypto/openpgp"
 )
 
 type Store interface {
@@ -35,6 +38,7 @@ type Store interface {
 	Pod(podPrefix consul.PodPrefix, nodename types.NodeName, podId types.PodID) (manifest.Manifest, time.Duration, error)
 	DeletePod(podPrefix consul.PodPrefix, nodename types.NodeName, podId types.PodID) (time.Duration, error)
 	NewUnmanagedSession(session, name string) consul.Session
+	RollApproval(rollID string) (*consul.RollApproval, error)
 }
 
 type ReplicationControllerLocker interface {
@@ -116,6 +120,23 @@ type update struct {
 	// to signify that the rolling update was successful
 	shouldCreateAuditLogRecords bool
 	auditLogStore               auditlogstore.ConsulStore
+
+	// notifier sends the update's lifecycle events to webhooks. May be nil
+	notifier webhook.Notifier
+
+	// nodeStatusStore is where the preparers record whether their nodes
+	// are shutting down. May be nil, in which case no node is
+	nodeStatusStore nodestatus.Reader
+
+	// approverKeyring holds the keys of the operators who may approve
+	// updates of protected pods, see ProtectedLabel. May be nil, in which
+	// case updates of protected pods never get past their canary.
+	approverKeyring openpgp.KeyRing
+
+	// protected is set if the new RC is protected, approver once the
+	// update has been approved
+	protected bool
+	approver  string
 }
 
 type RCStatusStore interface {
@@ -125,7 +146,9 @@ type RCStatusStore interface {
 // Create a new Update. The consul.Store, rcstore.Store, labels.Applicator and
 // scheduler.Scheduler arguments should be the same as those of the RCs themselves. The
 // session must be valid for the lifetime of the Update; maintaining this is the
-// responsibility of the caller.
+// responsibility of the caller. The notifier may be nil if no webhooks are
+// configured, and the approver keyring may be nil if nobody may approve updates
+// of protected pods.
 func NewUpdate(
 	f fields.Update,
 	consuls Store,
@@ -145,12 +168,14 @@ func NewUpdate(
 	scheduler RCScheduler,
 	shouldCreateAuditLogRecords bool,
 	auditLogStore auditlogstore.ConsulStore,
+	notifier webhook.Notifier,
+	approverKeyring openpgp.KeyRing,
 ) Update {
 	logger = logger.SubLogger(logrus.Fields{
 		"desired_replicas": f.DesiredReplicas,
 		"minimum_replicas": f.MinimumReplicas,
 	})
-	return &update{
+	u := &update{
 		Update:                      f,
 		consuls:                     consuls,
 		rcLocker:                    rcLocker,
@@ -168,7 +193,13 @@ func NewUpdate(
 		scheduler:                   scheduler,
 		auditLogStore:               auditLogStore,
 		shouldCreateAuditLogRecords: shouldCreateAuditLogRecords,
+		notifier:                    notifier,
+		approverKeyring:             approverKeyring,
+	}
+	if consulClient != nil {
+		u.nodeStatusStore = nodestatus.NewConsul(statusstore.NewConsul(consulClient), statusstore.PreparerPodStatusNamespace)
 	}
+	return u
 }
 
 type Update interface {
@@ -276,6 +307,14 @@ func (u *update) Run(ctx context.Context) (ret bool) {
 		// leave ret set however it was before this function was called
 		return
 	}
+	// deferred before performCleanup() so that it runs after it, once ret
+	// is final
+	var podID types.PodID
+	defer func() {
+		if ret {
+			u.notify(webhook.EventSucceeded, podID, fmt.Sprintf("Rolling update to %s completed", u.NewRC), nil)
+		}
+	}()
 	defer performCleanup()
 
 	// Pass ctx as the "unlock RCs" transaction. That way when the caller of Run() commits
@@ -335,6 +374,13 @@ func (u *update) Run(ctx context.Context) (ret bool) {
 		return
 	}
 
+	u.protected = isProtected(newFields)
+	podID = newFields.Manifest.ID()
+	u.notify(webhook.EventStarted, podID, fmt.Sprintf("Rolling update from %s to %s started", u.OldRC, u.NewRC), map[string]interface{}{
+		"desired_replicas": u.DesiredReplicas,
+		"minimum_replicas": u.MinimumReplicas,
+	})
+
 	statusStanza := newFields.Manifest.GetStatusStanza()
 	hChecks := make(chan map[types.NodeName]health.Result)
 	hErrs := make(chan error)
@@ -540,6 +586,14 @@ func (u *update) cleanupOldRC(ctx context.Context) bool {
 
 // returns true if roll succeeded, false if asked to quit.
 func (u *update) rollLoop(ctx context.Context, podID types.PodID, hChecks <-chan map[types.NodeName]health.Result, hErrs <-chan error, useHealthService bool, manifestStatus manifest.StatusStanza) bool {
+	// batchInFlight is set once replicas have been transferred, until the
+	// new RC's nodes are all healthy. paused is set when the update
+	// blocks without a batch in flight, i.e. because too few nodes are
+	// healthy, until it makes progress again. Both only serve to send
+	// webhooks once per transition.
+	batchInFlight := false
+	paused := false
+
 	for {
 		// Select on just the quit channel before entering the select with both quit and hChecks. This protects against a situation where
 		// hChecks and quit are both ready, and hChecks might be chosen due to the random choice semantics of select {}. If multiple
@@ -572,6 +626,11 @@ func (u *update) rollLoop(ctx context.Context, podID types.PodID, hChecks <-chan
 				break
 			}
 
+			if batchInFlight && newNodes.Healthy >= newNodes.Desired {
+				batchInFlight = false
+				u.notify(webhook.EventBatchCompleted, podID, fmt.Sprintf("%d of %d nodes of %s are healthy", newNodes.Healthy, u.DesiredReplicas, u.NewRC), nodeCountDetails(oldNodes, newNodes))
+			}
+
 			if nextAction := u.shouldStop(oldNodes, newNodes); nextAction == ruShouldTerminate {
 				u.logger.WithFields(logrus.Fields{
 					"old": oldNodes.ToString(),
@@ -587,6 +646,15 @@ func (u *update) rollLoop(ctx context.Context, podID types.PodID, hChecks <-chan
 			}
 
 			nextRemove, nextAdd := rollAlgorithm(u.rollAlgorithmParams(oldNodes, newNodes))
+			if (nextRemove > 0 || nextAdd > 0) && newNodes.Desired > 0 && !u.approved() {
+				// the canary has been scheduled, the rest of the
+				// update waits for approval
+				if !batchInFlight && !paused {
+					paused = true
+					u.notify(webhook.EventPaused, podID, fmt.Sprintf("Rolling update to %s of a protected pod is waiting for approval", u.NewRC), nodeCountDetails(oldNodes, newNodes))
+				}
+				break
+			}
 			if nextRemove > 0 || nextAdd > 0 {
 				// apply the delay only if we've already added to the new RC, since there's
 				// no value in sitting around doing nothing before anything has happened.
@@ -654,16 +722,44 @@ func (u *update) rollLoop(ctx context.Context, podID types.PodID, hChecks <-chan
 					break
 				}
 				cancel()
+				batchInFlight = true
+				paused = false
 			} else {
 				u.logger.WithFields(logrus.Fields{
 					"old": oldNodes.ToString(),
 					"new": newNodes.ToString(),
 				}).Debugln("Blocking for more healthy nodes")
+				if !batchInFlight && !paused {
+					paused = true
+					u.notify(webhook.EventPaused, podID, fmt.Sprintf("Rolling update to %s is waiting for more healthy nodes", u.NewRC), nodeCountDetails(oldNodes, newNodes))
+				}
 			}
 		}
 	}
 }
 
+// approved returns whether the update may go past its canary, i.e. whether
+// the new RC isn't protected or the update has been approved.
+func (u *update) approved() bool {
+	if !u.protected || u.approver != "" {
+		return true
+	}
+
+	approval, err := u.consuls.RollApproval(u.ID().String())
+	if err != nil {
+		u.logger.WithError(err).Errorln("Could not read approval of update")
+		return false
+	}
+	approver, err := checkApproval(u.approverKeyring, u.Update, approval)
+	if err != nil {
+		u.logger.WithError(err).Infoln("Protected update is waiting for approval before going past its canary")
+		return false
+	}
+	u.logger.WithField("approver", approver).Infoln("Protected update has been approved")
+	u.approver = approver
+	return true
+}
+
 func (u *update) shouldStop(oldNodes, newNodes rcNodeCounts) ruStep {
 	if newNodes.Desired < u.DesiredReplicas {
 		// Not enough nodes scheduled on the new side, so deploy should continue.
@@ -856,6 +952,9 @@ type rcNodeCounts struct {
 	Healthy    int // the number of real nodes that are healthy
 	Unhealthy  int // the number of real nodes that are unhealthy
 	Unknown    int // the number of real nodes that are of unknown health
+	// the number of real nodes that aren't healthy because they are being
+	// taken out of service, which are counted as neither unhealthy nor unknown
+	ShuttingDown int
 }
 
 func (r rcNodeCounts) ToString() string {
@@ -933,21 +1032,33 @@ func (u *update) countHealthy(id rcf.ID, checks map[types.NodeName]health.Result
 			// don't check health if the update isn't even done there yet
 			continue
 		}
-		if hres, ok := checks[node]; ok {
-			if hres.Status == health.Passing {
-				ret.Healthy++
-			} else if hres.Status == health.Unknown {
-				ret.Unknown++
-			} else {
-				ret.Unhealthy++
-			}
-		} else {
+		hres, ok := checks[node]
+		switch {
+		case ok && hres.GatingStatus() == health.Passing:
+			ret.Healthy++
+		case u.shuttingDown(node):
+			ret.ShuttingDown++
+		case !ok || hres.ReadinessStatus() == health.Unknown:
 			ret.Unknown++
+		default:
+			ret.Unhealthy++
 		}
 	}
 	return ret, err
 }
 
+// shuttingDown returns whether the node is being taken out of service, in
+// which case the pod is expected to disappear from it. A node whose status
+// can't be read is assumed to be in service.
+func (u *update) shuttingDown(node types.NodeName) bool {
+	shuttingDown, err := nodestatus.ShuttingDown(u.nodeStatusStore, node)
+	if err != nil {
+		u.logger.WithError(err).WithField("node", node).Warnln("Could not read whether the node is shutting down")
+		return false
+	}
+	return shuttingDown
+}
+
 func (u *update) currentNodeIDs() ([]types.NodeName, error) {
 	oldPods, err := rc.CurrentPods(u.OldRC, u.labeler)
 	if err != nil {
@@ -1019,6 +1130,36 @@ func (u *update) rollAlgorithmParams(oldHealth, newHealth rcNodeCounts) (oldHeal
 	return
 }
 
+// notify sends a lifecycle event of the update to the configured webhooks
+func (u *update) notify(eventType webhook.EventType, podID types.PodID, message string, details map[string]interface{}) {
+	if u.notifier == nil {
+		return
+	}
+
+	if details == nil {
+		details = make(map[string]interface{})
+	}
+	details["old_rc"] = u.OldRC.String()
+	details["new_rc"] = u.NewRC.String()
+	u.notifier.Notify(webhook.Event{
+		Type:         eventType,
+		Orchestrator: rollFarmOrchestrator,
+		DeploymentID: u.ID().String(),
+		PodID:        podID.String(),
+		Message:      message,
+		Details:      details,
+	})
+}
+
+func nodeCountDetails(oldNodes, newNodes rcNodeCounts) map[string]interface{} {
+	return map[string]interface{}{
+		"old_desired": oldNodes.Desired,
+		"old_healthy": oldNodes.Healthy,
+		"new_desired": newNodes.Desired,
+		"new_healthy": newNodes.Healthy,
+	}
+}
+
 func (u *update) mustAlert(ctx context.Context, description string, incidentKey string, err error) {
 	f := func() error {
 		return u.alerter.Alert(alerting.AlertInfo{
@@ -28,7 +28,9 @@ import (
 	"github.com/square/p2/pkg/store/consul/rcstore"
 	"github.com/square/p2/pkg/store/consul/rollstore"
 	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/nodestatus"
 	"github.com/square/p2/pkg/store/consul/statusstore/rcstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/statusstoretest"
 	"github.com/square/p2/pkg/store/consul/transaction"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
@@ -612,6 +614,26 @@ func TestCountHealthAllImplicitUnknown(t *testing.T) {
 	Assert(t).AreEqual(counts, expected, "incorrect health counts")
 }
 
+func TestCountHealthShuttingDown(t *testing.T) {
+	upd, checks, f := updateWithUniformHealth(t, 3, health.Critical)
+	defer f()
+	nodeStatusStore := nodestatus.NewConsul(statusstoretest.NewFake(), statusstore.PreparerPodStatusNamespace)
+	err := nodeStatusStore.Set("node0", nodestatus.Status{State: nodestatus.NodeShuttingDown})
+	Assert(t).IsNil(err, "expected no error marking node0 as shutting down")
+	upd.nodeStatusStore = nodeStatusStore
+
+	counts, err := upd.countHealthy(upd.OldRC, checks)
+	Assert(t).IsNil(err, "expected no error counting health")
+	expected := rcNodeCounts{
+		Desired:      3,
+		Current:      3,
+		Real:         3,
+		Unhealthy:    2,
+		ShuttingDown: 1,
+	}
+	Assert(t).AreEqual(counts, expected, "incorrect health counts")
+}
+
 func TestCountHealthNonReal(t *testing.T) {
 	upd, _, _, _, f := updateWithHealth(t, 3, 0, map[types.NodeName]bool{"node1": true, "node2": true, "node3": false}, nil, nil, nil, rc_fields.StaticStrategy)
 	defer f()
@@ -1387,7 +1409,7 @@ func TestEnableAccountsForNodeTransfers(t *testing.T) {
 
 	applicator := labels.NewConsulApplicator(fixture.Client, 0, 0)
 	rcStore := rcstore.NewConsul(fixture.Client, applicator, 0)
-	rcStatusStore := rcstatus.NewConsul(statusstore.NewConsul(fixture.Client), consul.RCStatusNamespace)
+	rcStatusStore := rcstatus.NewConsul(statusstore.NewConsul(fixture.Client), statusstore.RCStatusNamespace)
 
 	newRC, err := rcStore.Create(testManifest(), klabels.Everything(), "some_az", "some_cn", nil, nil, "dynamic_strategy")
 	if err != nil {
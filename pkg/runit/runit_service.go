@@ -21,6 +21,7 @@ type SV interface {
 	Stat(service *Service) (*StatResult, error)
 	Restart(service *Service, timeout time.Duration) (string, error)
 	Once(service *Service) (string, error)
+	Signal(service *Service, signal Signal) (string, error)
 }
 
 type sv struct {
@@ -146,6 +147,15 @@ func (sv *sv) Once(service *Service) (string, error) {
 	return sv.execCmd(service, "once")
 }
 
+// Signal sends a signal to the service's process
+func (sv *sv) Signal(service *Service, signal Signal) (string, error) {
+	verb, ok := svSignalVerbs[signal]
+	if !ok {
+		return "", util.Errorf("sv cannot send signal %q", signal)
+	}
+	return sv.execCmd(service, verb)
+}
+
 func outToStatResult(out string) (*StatResult, error) {
 	matches := statOutput.FindStringSubmatch(out)
 	if matches == nil || len(matches) < 8 {
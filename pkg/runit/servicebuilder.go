@@ -186,7 +186,7 @@ func (s *ServiceBuilder) write(path string, templates map[string]ServiceTemplate
 		return err
 	}
 
-	return ioutil.WriteFile(path, text, 0644)
+	return util.WriteFileAtomic(path, text, util.DefaultAtomicWriteOptions)
 }
 
 // convert the servicebuilder yaml file into a runit service directory
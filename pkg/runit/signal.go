@@ -0,0 +1,69 @@
+package runit
+
+import (
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// Signal is a signal that sv can send to a service, named without the "SIG"
+// prefix, e.g. "HUP"
+type Signal string
+
+const (
+	SignalHUP  Signal = "HUP"
+	SignalTERM Signal = "TERM"
+)
+
+// the sv commands that send each signal
+var svSignalVerbs = map[Signal]string{
+	"HUP":  "hup",
+	"ALRM": "alarm",
+	"INT":  "interrupt",
+	"QUIT": "quit",
+	"USR1": "1",
+	"USR2": "2",
+	"TERM": "term",
+	"KILL": "kill",
+	"CONT": "cont",
+	"STOP": "pause",
+}
+
+// ParseSignal parses a signal name such as "SIGUSR2" or "usr2"
+func ParseSignal(name string) (Signal, error) {
+	signal := Signal(strings.TrimPrefix(strings.ToUpper(name), "SIG"))
+	if _, ok := svSignalVerbs[signal]; !ok {
+		return "", util.Errorf("unsupported signal %q", name)
+	}
+	return signal, nil
+}
+
+// StopWithSignal asks a service to stop by sending it signal instead of the
+// TERM runit would send, for processes that shut down gracefully on another
+// signal. The service is first told not to restart once its process exits. If
+// the process is still running after timeout, the service is stopped as usual.
+func StopWithSignal(sv SV, service *Service, signal Signal, timeout time.Duration) (string, error) {
+	if signal == SignalTERM {
+		return sv.Stop(service, timeout)
+	}
+
+	out, err := sv.Once(service)
+	if err != nil {
+		return out, err
+	}
+	out, err = sv.Signal(service, signal)
+	if err != nil {
+		return out, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		stat, err := sv.Stat(service)
+		if err != nil || stat == nil || stat.ChildStatus == STATUS_DOWN {
+			break
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return sv.Stop(service, timeout)
+}
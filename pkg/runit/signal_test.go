@@ -0,0 +1,52 @@
+package runit
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+)
+
+func TestParseSignal(t *testing.T) {
+	for _, name := range []string{"SIGUSR2", "USR2", "usr2", "sigusr2"} {
+		signal, err := ParseSignal(name)
+		Assert(t).IsNil(err, fmt.Sprintf("should have parsed %q", name))
+		Assert(t).AreEqual(signal, Signal("USR2"), fmt.Sprintf("did not parse %q", name))
+	}
+
+	_, err := ParseSignal("SIGWINCH")
+	Assert(t).IsNotNil(err, "should not have parsed a signal sv cannot send")
+}
+
+func TestRunitServicesCanBeSignaled(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "runit_service")
+	Assert(t).IsNil(err, "test setup should have created a tmpdir")
+	defer os.RemoveAll(tmpdir)
+	os.MkdirAll(filepath.Join(tmpdir, "supervise"), 0644)
+
+	sv := FakeSV()
+	service := &Service{tmpdir, "foo"}
+	out, err := sv.Signal(service, "USR2")
+	Assert(t).IsNil(err, "There should not have been an error signaling the service")
+	Assert(t).AreEqual(out, fmt.Sprintf("2 %s\n", service.Path), "Did not signal service with correct arguments")
+}
+
+func TestStopWithSignal(t *testing.T) {
+	sv := NewRecordingSV().(*RecordingSV)
+	_, err := StopWithSignal(sv, &Service{}, "QUIT", time.Second)
+	Assert(t).IsNil(err, "should not have erred stopping the service")
+	Assert(t).AreEqual(
+		fmt.Sprint(sv.Commands),
+		fmt.Sprint([]string{"once", "quit", "stat", "stop"}),
+		"should have kept the service down, sent the signal, then stopped it",
+	)
+
+	sv = NewRecordingSV().(*RecordingSV)
+	_, err = StopWithSignal(sv, &Service{}, SignalTERM, time.Second)
+	Assert(t).IsNil(err, "should not have erred stopping the service")
+	Assert(t).AreEqual(fmt.Sprint(sv.Commands), fmt.Sprint([]string{"stop"}), "TERM should stop the service as usual")
+}
@@ -0,0 +1,39 @@
+package scheduler
+
+import (
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/types"
+)
+
+// CordonedSelector selects the nodes that are cordoned. Unlike a drain, a
+// cordon only stops new pods from being scheduled on a node.
+func CordonedSelector() klabels.Selector {
+	return klabels.Everything().Add(types.CordonedLabel, klabels.EqualsOperator, []string{"true"})
+}
+
+// CordonedNodes returns the nodes that are cordoned
+func CordonedNodes(labeler NodeLabeler) (types.NodeSet, error) {
+	matches, err := labeler.GetMatches(CordonedSelector(), labels.NODE)
+	if err != nil {
+		return types.NodeSet{}, err
+	}
+
+	cordoned := types.NewNodeSet()
+	for _, match := range matches {
+		cordoned.InsertNode(types.NodeName(match.ID))
+	}
+	return cordoned, nil
+}
+
+// Uncordoned returns the nodes that are not cordoned, in the same order
+func Uncordoned(nodes []types.NodeName, cordoned types.NodeSet) []types.NodeName {
+	result := make([]types.NodeName, 0, len(nodes))
+	for _, node := range nodes {
+		if !cordoned.Has(node.String()) {
+			result = append(result, node)
+		}
+	}
+	return result
+}
@@ -0,0 +1,40 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/statusstore/nodehealthstatus"
+	"github.com/square/p2/pkg/types"
+)
+
+// DefaultNodeHealthMaxAge is how old a node's published health may be before
+// it is ignored. Nodes publish their health at least once a minute, so an
+// older record belongs to a node whose health monitor isn't running.
+const DefaultNodeHealthMaxAge = 5 * time.Minute
+
+// NodeHealthReader reads the health that nodes publish, see
+// watch.NodeHealth.PublishStatus
+type NodeHealthReader interface {
+	List() (map[types.NodeName]nodehealthstatus.Status, error)
+}
+
+// CriticalNodes returns those of nodes whose published health is critical.
+// Like cordoned nodes, they should keep the pods they have but not get new
+// ones. Nodes that haven't published their health, or whose health is older
+// than maxAge, aren't critical. The published health of every node is read
+// at once, rather than a request being made per node.
+func CriticalNodes(reader NodeHealthReader, nodes []types.NodeName, maxAge time.Duration) (types.NodeSet, error) {
+	critical := types.NewNodeSet()
+	statuses, err := reader.List()
+	if err != nil {
+		return types.NodeSet{}, err
+	}
+	now := time.Now()
+	for _, node := range nodes {
+		status, ok := statuses[node]
+		if ok && status.State == nodehealthstatus.Critical && !status.Stale(now, maxAge) {
+			critical.InsertNode(node)
+		}
+	}
+	return critical, nil
+}
@@ -0,0 +1,71 @@
+package srv
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/util"
+)
+
+// Services registered by the consul publisher have IDs with this prefix, so
+// that services registered with the agent by anything else are left alone
+const consulServiceIDPrefix = "p2-srv:"
+
+type consulPublisher struct {
+	agent consulutil.ConsulAgentClient
+}
+
+// NewConsulPublisher returns a publisher that registers each record as a
+// service with the local consul agent, named after the pod and tagged with the
+// port name. Consul's DNS interface then answers SRV queries for
+// _<pod id>._<port name>.service.consul (or <pod id>.service.consul for all of
+// a pod's ports).
+func NewConsulPublisher(agent consulutil.ConsulAgentClient) Publisher {
+	return consulPublisher{agent: agent}
+}
+
+func (c consulPublisher) Publish(records []Record) error {
+	desired := make(map[string]*api.AgentServiceRegistration)
+	for _, record := range records {
+		id := fmt.Sprintf("%s%s:%s", consulServiceIDPrefix, record.PodID, record.PortName)
+		desired[id] = &api.AgentServiceRegistration{
+			ID:   id,
+			Name: record.PodID.String(),
+			Tags: []string{record.PortName},
+			Port: record.Port,
+		}
+	}
+
+	services, err := c.agent.Services()
+	if err != nil {
+		return util.Errorf("could not list consul agent services: %s", err)
+	}
+	for id, service := range services {
+		if !strings.HasPrefix(id, consulServiceIDPrefix) {
+			continue
+		}
+		registration, ok := desired[id]
+		if ok && service.Port == registration.Port {
+			// already registered
+			delete(desired, id)
+			continue
+		}
+		if !ok {
+			err = c.agent.ServiceDeregister(id)
+			if err != nil {
+				return util.Errorf("could not deregister consul agent service %s: %s", id, err)
+			}
+		}
+	}
+
+	for id, registration := range desired {
+		err = c.agent.ServiceRegister(registration)
+		if err != nil {
+			return util.Errorf("could not register consul agent service %s: %s", id, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package srv
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+
+	"github.com/square/p2/pkg/util"
+)
+
+type execPublisher struct {
+	command []string
+}
+
+// NewExecPublisher returns a publisher that runs an external DNS provider
+// plugin. The plugin is passed the JSON encoded list of records on stdin and
+// must replace all records it previously published for the node with them.
+// It should exit non-zero if the records could not be published, in which
+// case they will be published again later.
+func NewExecPublisher(command []string) Publisher {
+	return execPublisher{command: command}
+}
+
+func (e execPublisher) Publish(records []Record) error {
+	if records == nil {
+		// so that the plugin is passed a list rather than null
+		records = []Record{}
+	}
+	input, err := json.Marshal(records)
+	if err != nil {
+		return util.Errorf("could not marshal SRV records: %s", err)
+	}
+
+	cmd := exec.Command(e.command[0], e.command[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return util.Errorf("SRV publisher plugin %s failed: %s: %s", e.command[0], err, output)
+	}
+	return nil
+}
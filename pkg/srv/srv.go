@@ -0,0 +1,94 @@
+// Package srv publishes SRV records for the ports of the pods running on a
+// node, for clients that discover services via DNS.
+package srv
+
+import (
+	"sort"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// The name under which a pod's status port is published if the manifest
+// doesn't declare a port with that name itself
+const StatusPortName = "status"
+
+const (
+	ConsulPublisherType = "consul"
+	ExecPublisherType   = "exec"
+)
+
+// Record is an SRV record for one of a pod's ports on a node
+type Record struct {
+	PodID    types.PodID    `json:"pod_id"`
+	Node     types.NodeName `json:"node"`
+	PortName string         `json:"port_name"`
+	Port     int            `json:"port"`
+}
+
+// Publisher publishes the SRV records of the healthy pods on a node. Every
+// call to Publish replaces all records previously published for the node.
+type Publisher interface {
+	Publish(records []Record) error
+}
+
+// Config selects and configures the publisher used by the health monitor
+type Config struct {
+	// Either "consul", to register each port as a service with the local
+	// consul agent, or "exec", to run an external DNS provider plugin
+	Type string `yaml:"type"`
+
+	// For the exec publisher, the plugin command. See NewExecPublisher
+	Exec []string `yaml:"exec,omitempty"`
+}
+
+func (c Config) Publisher(client consulutil.ConsulClient) (Publisher, error) {
+	switch c.Type {
+	case ConsulPublisherType:
+		return NewConsulPublisher(client.Agent()), nil
+	case ExecPublisherType:
+		if len(c.Exec) == 0 {
+			return nil, util.Errorf("the %s SRV publisher requires a command", ExecPublisherType)
+		}
+		return NewExecPublisher(c.Exec), nil
+	default:
+		return nil, util.Errorf("unknown SRV publisher type %q, must be %q or %q", c.Type, ConsulPublisherType, ExecPublisherType)
+	}
+}
+
+// RecordsForManifest returns the records of a pod running on a node: one for
+// each port the manifest declares, and one for its status port, sorted by
+// port name
+func RecordsForManifest(man manifest.Manifest, node types.NodeName) []Record {
+	ports := make(map[string]int)
+	if statusPort := man.GetStatusPort(); statusPort != 0 {
+		ports[StatusPortName] = statusPort
+	}
+	for name, port := range man.GetPorts() {
+		ports[name] = port
+	}
+
+	var records []Record
+	for name, port := range ports {
+		records = append(records, Record{
+			PodID:    man.ID(),
+			Node:     node,
+			PortName: name,
+			Port:     port,
+		})
+	}
+	SortRecords(records)
+	return records
+}
+
+// SortRecords sorts records by pod ID and then port name
+func SortRecords(records []Record) {
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].PodID != records[j].PodID {
+			return records[i].PodID < records[j].PodID
+		}
+		return records[i].PortName < records[j].PortName
+	})
+}
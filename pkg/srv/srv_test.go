@@ -0,0 +1,118 @@
+package srv
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/manifest"
+)
+
+func TestRecordsForManifest(t *testing.T) {
+	builder := manifest.NewBuilder()
+	builder.SetID("web")
+	builder.SetStatusPort(8000)
+	builder.SetPorts(map[string]int{"http": 8080, "admin": 9090})
+
+	records := RecordsForManifest(builder.GetManifest(), "node1")
+	expected := []Record{
+		{PodID: "web", Node: "node1", PortName: "admin", Port: 9090},
+		{PodID: "web", Node: "node1", PortName: "http", Port: 8080},
+		{PodID: "web", Node: "node1", PortName: "status", Port: 8000},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("expected records %+v, got %+v", expected, records)
+	}
+
+	// a declared "status" port takes precedence over the status port
+	builder.SetPorts(map[string]int{"status": 8001})
+	records = RecordsForManifest(builder.GetManifest(), "node1")
+	if len(records) != 1 || records[0].Port != 8001 {
+		t.Errorf("expected only the declared status port to be published, got %+v", records)
+	}
+}
+
+type fakeAgent struct {
+	services     map[string]*api.AgentService
+	registered   []string
+	deregistered []string
+}
+
+func (f *fakeAgent) Services() (map[string]*api.AgentService, error) {
+	return f.services, nil
+}
+
+func (f *fakeAgent) ServiceRegister(service *api.AgentServiceRegistration) error {
+	f.registered = append(f.registered, service.ID)
+	f.services[service.ID] = &api.AgentService{ID: service.ID, Service: service.Name, Tags: service.Tags, Port: service.Port}
+	return nil
+}
+
+func (f *fakeAgent) ServiceDeregister(serviceID string) error {
+	f.deregistered = append(f.deregistered, serviceID)
+	delete(f.services, serviceID)
+	return nil
+}
+
+func TestConsulPublisher(t *testing.T) {
+	agent := &fakeAgent{services: map[string]*api.AgentService{
+		"consul":                  {ID: "consul", Service: "consul", Port: 8300},
+		"p2-srv:web:http":         {ID: "p2-srv:web:http", Service: "web", Tags: []string{"http"}, Port: 8080},
+		"p2-srv:removed_pod:http": {ID: "p2-srv:removed_pod:http", Service: "removed_pod", Tags: []string{"http"}, Port: 8080},
+	}}
+	publisher := NewConsulPublisher(agent)
+
+	err := publisher.Publish([]Record{
+		{PodID: "web", Node: "node1", PortName: "http", Port: 8080},
+		{PodID: "web", Node: "node1", PortName: "status", Port: 8000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(agent.registered, []string{"p2-srv:web:status"}) {
+		t.Errorf("expected only the new record to be registered, registered %v", agent.registered)
+	}
+	if !reflect.DeepEqual(agent.deregistered, []string{"p2-srv:removed_pod:http"}) {
+		t.Errorf("expected only the stale record to be deregistered, deregistered %v", agent.deregistered)
+	}
+	if _, ok := agent.services["consul"]; !ok {
+		t.Error("services not registered by p2 should be left alone")
+	}
+}
+
+func TestExecPublisher(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "srv_exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	out := filepath.Join(tempDir, "records.json")
+
+	records := []Record{{PodID: "web", Node: "node1", PortName: "http", Port: 8080}}
+	err = NewExecPublisher([]string{"sh", "-c", "cat > " + out}).Publish(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var published []Record
+	if err = json.Unmarshal(contents, &published); err != nil {
+		t.Fatalf("plugin was not passed JSON records: %s", err)
+	}
+	if !reflect.DeepEqual(published, records) {
+		t.Errorf("expected plugin to be passed %+v, got %+v", records, published)
+	}
+
+	if err = NewExecPublisher([]string{"false"}).Publish(records); err == nil {
+		t.Error("expected an error when the plugin fails")
+	}
+}
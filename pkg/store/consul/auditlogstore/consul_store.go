@@ -8,8 +8,9 @@ import (
 	"time"
 
 	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/errors"
 	"github.com/square/p2/pkg/store/consul/transaction"
-	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/version"
 
 	"github.com/hashicorp/consul/api"
 	"github.com/pborman/uuid"
@@ -42,14 +43,16 @@ func (ConsulStore) Create(
 	eventType audit.EventType,
 	eventDetails json.RawMessage,
 ) error {
+	build := version.Current()
 	auditLog := audit.AuditLog{
 		EventType:    eventType,
 		EventDetails: &eventDetails,
 		Timestamp:    time.Now(),
+		Build:        &build,
 	}
 	auditLogBytes, err := json.Marshal(auditLog)
 	if err != nil {
-		return util.Errorf("could not create audit log record: %s", err)
+		return errors.Errorf("could not create audit log record: %w", err)
 	}
 
 	return transaction.Add(ctx, api.KVTxnOp{
@@ -63,7 +66,7 @@ func (ConsulStore) Delete(
 	id audit.ID,
 ) error {
 	if uuid.Parse(id.String()) == nil {
-		return util.Errorf("%s is not a valid audit log ID", id)
+		return errors.Errorf("%s is not a valid audit log ID", id)
 	}
 
 	return transaction.Add(ctx, api.KVTxnOp{
@@ -75,7 +78,7 @@ func (ConsulStore) Delete(
 func (c ConsulStore) List() (map[audit.ID]audit.AuditLog, error) {
 	pairs, _, err := c.consulKV.List(auditLogTree+"/", nil)
 	if err != nil {
-		return nil, util.Errorf("could not list audit log records: %s", err)
+		return nil, errors.Errorf("could not list audit log records: %w", err)
 	}
 
 	ret := make(map[audit.ID]audit.AuditLog)
@@ -87,7 +90,7 @@ func (c ConsulStore) List() (map[audit.ID]audit.AuditLog, error) {
 
 		al, err := auditLogFromPair(pair)
 		if err != nil {
-			return nil, util.Errorf("could not convert value of audit log %s to audit log struct: %s", pair.Key, err)
+			return nil, errors.Errorf("could not convert value of audit log %s to audit log struct: %w", pair.Key, err)
 		}
 		ret[id] = al
 	}
@@ -112,15 +115,15 @@ func computeKey(id audit.ID) string {
 func idFromKey(key string) (audit.ID, error) {
 	parts := strings.Split(key, "/")
 	if len(parts) != 2 {
-		return "", util.Errorf("%s did not match expected key format", key)
+		return "", errors.Errorf("%s did not match expected key format", key)
 	}
 
 	if parts[0] != auditLogTree {
-		return "", util.Errorf("%s did not match expected key format", key)
+		return "", errors.Errorf("%s did not match expected key format", key)
 	}
 
 	if uuid.Parse(parts[1]) == nil {
-		return "", util.Errorf("%s from audit log key %s did not parse as a UUID", parts[1], key)
+		return "", errors.Errorf("%s from audit log key %s did not parse as a UUID", parts[1], key)
 	}
 
 	return audit.ID(parts[1]), nil
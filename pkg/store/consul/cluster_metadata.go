@@ -0,0 +1,102 @@
+package consul
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+)
+
+// ClusterMetadataKey holds a ClusterMetadata record describing the p2 cluster
+// the Consul datacenter belongs to. It is written once by p2-init and read by
+// command line tools to check that they are talking to the cluster their
+// operator intended.
+const ClusterMetadataKey = "cluster_metadata"
+
+// ClusterMetadata describes a p2 cluster.
+type ClusterMetadata struct {
+	// The name of the cluster, e.g. "production-east"
+	Name string `json:"name"`
+
+	// The versions of the schemas of the records p2 keeps in Consul, by
+	// record type. See SchemaVersions.
+	SchemaVersions map[string]int `json:"schema_versions"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SchemaVersions returns the versions of the versioned records in Consul that
+// this version of p2 reads and writes, by record type.
+func SchemaVersions() map[string]int {
+	return map[string]int{
+		"health": WatchResultVersion,
+	}
+}
+
+// NewerSchemas returns the record types for which the cluster uses a newer
+// schema than this version of p2 understands.
+func (m ClusterMetadata) NewerSchemas() []string {
+	known := SchemaVersions()
+	var newer []string
+	for record, version := range m.SchemaVersions {
+		if known, ok := known[record]; ok && version > known {
+			newer = append(newer, record)
+		}
+	}
+	return newer
+}
+
+// ClusterMetadata returns the cluster's metadata, or nil if the cluster has
+// not been initialized with p2-init.
+func (c consulStore) ClusterMetadata() (*ClusterMetadata, error) {
+	kvp, _, err := c.client.KV().Get(ClusterMetadataKey, nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("get", ClusterMetadataKey, err)
+	}
+	if kvp == nil {
+		return nil, nil
+	}
+
+	var metadata ClusterMetadata
+	err = json.Unmarshal(kvp.Value, &metadata)
+	if err != nil {
+		return nil, errors.Errorf("could not parse cluster metadata at %s: %w", ClusterMetadataKey, err)
+	}
+	return &metadata, nil
+}
+
+// InitClusterMetadata records the name of the cluster along with the schema
+// versions of this version of p2. It fails if the cluster has already been
+// initialized, since a cluster's name must not change under the tools that
+// check it.
+func (c consulStore) InitClusterMetadata(name string) (ClusterMetadata, error) {
+	if name == "" {
+		return ClusterMetadata{}, errors.Codef(errors.CodeInvalid, "cluster name must not be empty")
+	}
+	metadata := ClusterMetadata{
+		Name:           name,
+		SchemaVersions: SchemaVersions(),
+		CreatedAt:      time.Now().UTC(),
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return ClusterMetadata{}, errors.Errorf("could not marshal cluster metadata: %w", err)
+	}
+
+	// a ModifyIndex of 0 only writes the key if it doesn't exist yet
+	success, _, err := c.client.KV().CAS(&api.KVPair{
+		Key:         ClusterMetadataKey,
+		Value:       data,
+		ModifyIndex: 0,
+	}, nil)
+	if err != nil {
+		return ClusterMetadata{}, consulutil.NewKVError("cas", ClusterMetadataKey, err)
+	}
+	if !success {
+		return ClusterMetadata{}, errors.Errorf("the cluster has already been initialized")
+	}
+	return metadata, nil
+}
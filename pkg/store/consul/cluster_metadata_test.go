@@ -0,0 +1,48 @@
+// +build !race
+
+package consul
+
+import (
+	"testing"
+)
+
+func TestClusterMetadata(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	metadata, err := f.Store.ClusterMetadata()
+	if err != nil || metadata != nil {
+		t.Fatalf("Expected no metadata for an uninitialized cluster, got %+v, %v", metadata, err)
+	}
+
+	written, err := f.Store.InitClusterMetadata("staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata, err = f.Store.ClusterMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata == nil || metadata.Name != "staging" || !metadata.CreatedAt.Equal(written.CreatedAt) {
+		t.Errorf("Expected the written metadata to be read back, got %+v", metadata)
+	}
+	if metadata.SchemaVersions["health"] != WatchResultVersion {
+		t.Errorf("Expected the health schema version to be recorded, got %v", metadata.SchemaVersions)
+	}
+
+	_, err = f.Store.InitClusterMetadata("production")
+	if err == nil {
+		t.Error("Expected a cluster to be initialized only once")
+	}
+}
+
+func TestNewerSchemas(t *testing.T) {
+	metadata := ClusterMetadata{SchemaVersions: map[string]int{
+		"health":  WatchResultVersion + 1,
+		"unknown": 7,
+	}}
+	newer := metadata.NewerSchemas()
+	if len(newer) != 1 || newer[0] != "health" {
+		t.Errorf("Expected only the health schema to be newer, got %s", newer)
+	}
+}
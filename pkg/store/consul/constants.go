@@ -2,9 +2,10 @@ package consul
 
 import (
 	"path"
+	"strconv"
 
+	"github.com/square/p2/pkg/errors"
 	"github.com/square/p2/pkg/types"
-	"github.com/square/p2/pkg/util"
 )
 
 // PodPrefix represents the top level of a subtree whose leaves are expected to
@@ -18,6 +19,19 @@ const (
 	REALITY_TREE PodPrefix = "reality"
 	HOOK_TREE    PodPrefix = "hooks"
 	LOCK_TREE              = "lock"
+
+	// Manifests whose launchables the preparer should download and install
+	// ahead of a deploy, without launching them. See the prefetchstatus
+	// package for how the preparer reports back.
+	PREFETCH_TREE PodPrefix = "prefetch"
+
+	// The last few manifests the preparer deployed for each pod on each
+	// node, keyed by their SHA. See ManifestHistoryPath.
+	MANIFEST_HISTORY_TREE = "manifest_history"
+
+	// Who last wrote each pod's intent on each node, for detecting
+	// conflicting deploys. See IntentWritePath.
+	INTENT_WRITES_TREE = "intent_writes"
 )
 
 func nodePath(podPrefix PodPrefix, nodeName types.NodeName) (string, error) {
@@ -29,7 +43,7 @@ func nodePath(podPrefix PodPrefix, nodeName types.NodeName) (string, error) {
 		nodeName = ""
 	} else {
 		if nodeName == "" {
-			return "", util.Errorf("nodeName not specified when computing host path")
+			return "", errors.Errorf("nodeName not specified when computing host path")
 		}
 	}
 
@@ -43,12 +57,36 @@ func PodPath(podPrefix PodPrefix, nodeName types.NodeName, podId types.PodID) (s
 	}
 
 	if podId == "" {
-		return "", util.Errorf("pod id not specified when computing pod path")
+		return "", errors.Errorf("pod id not specified when computing pod path")
 	}
 
 	return path.Join(nodePath, string(podId)), nil
 }
 
+// Returns the consul path under which the manifests deployed for a pod on a
+// node are kept, e.g. manifest_history/some_host/some_pod
+func ManifestHistoryPath(nodeName types.NodeName, podID types.PodID) (string, error) {
+	if nodeName == "" {
+		return "", errors.Errorf("nodeName not specified when computing manifest history path")
+	}
+	if podID == "" {
+		return "", errors.Errorf("pod id not specified when computing manifest history path")
+	}
+	return path.Join(MANIFEST_HISTORY_TREE, nodeName.String(), podID.String()), nil
+}
+
+// Returns the consul path at which the last write of a pod's intent on a node
+// is recorded, e.g. intent_writes/some_host/some_pod
+func IntentWritePath(nodeName types.NodeName, podID types.PodID) (string, error) {
+	if nodeName == "" {
+		return "", errors.Errorf("nodeName not specified when computing intent write path")
+	}
+	if podID == "" {
+		return "", errors.Errorf("pod id not specified when computing intent write path")
+	}
+	return path.Join(INTENT_WRITES_TREE, nodeName.String(), podID.String()), nil
+}
+
 // Returns the consul path to use when intending to lock a pod, e.g.
 // lock/intent/some_host/some_pod
 func PodLockPath(podPrefix PodPrefix, nodeName types.NodeName, podId types.PodID) (string, error) {
@@ -65,3 +103,27 @@ func PodLockPath(podPrefix PodPrefix, nodeName types.NodeName, podId types.PodID
 func ReplicationLockPath(podId types.PodID) string {
 	return path.Join(LOCK_TREE, "replication", podId.String())
 }
+
+// Returns the consul path of one of the slots that bound how many pods may be
+// updated on a node at the same time, e.g. lock/node_update/some_host/0
+func NodeUpdateLockPath(nodeName types.NodeName, slot int) string {
+	return path.Join(LOCK_TREE, "node_update", nodeName.String(), strconv.Itoa(slot))
+}
+
+// Returns the consul path of one of the slots of the fleet-wide deploy budget,
+// e.g. lock/deploy_budget/0. See DeployBudgetKey.
+func DeployBudgetLockPath(slot int) string {
+	return path.Join(LOCK_TREE, "deploy_budget", strconv.Itoa(slot))
+}
+
+// Returns the consul path under which the processes writing health results for a node
+// register themselves, e.g. lock/health_writer/some_host
+func HealthWriterLockPrefix(nodeName types.NodeName) string {
+	return path.Join(LOCK_TREE, "health_writer", nodeName.String())
+}
+
+// Returns the consul path at which a health writer registers itself, e.g.
+// lock/health_writer/some_host/preparer
+func HealthWriterLockPath(nodeName types.NodeName, writer string) string {
+	return path.Join(HealthWriterLockPrefix(nodeName), writer)
+}
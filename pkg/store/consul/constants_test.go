@@ -76,3 +76,27 @@ func TestPodPathErrorNoHostname(t *testing.T) {
 		t.Errorf("should have errored retrieving pod path with empty nodeName")
 	}
 }
+
+func TestNodeUpdateLockPath(t *testing.T) {
+	lockPath := NodeUpdateLockPath(testHostname, 2)
+
+	expected := fmt.Sprintf("%s/node_update/%s/2", LOCK_TREE, testHostname)
+	if lockPath != expected {
+		t.Errorf("Unexpected value for lockPath, wanted '%s' got '%s'",
+			expected,
+			lockPath,
+		)
+	}
+}
+
+func TestDeployBudgetLockPath(t *testing.T) {
+	lockPath := DeployBudgetLockPath(3)
+
+	expected := fmt.Sprintf("%s/deploy_budget/3", LOCK_TREE)
+	if lockPath != expected {
+		t.Errorf("Unexpected value for lockPath, wanted '%s' got '%s'",
+			expected,
+			lockPath,
+		)
+	}
+}
@@ -5,8 +5,8 @@ import (
 	"sync"
 
 	"github.com/pborman/uuid"
+	"github.com/square/p2/pkg/errors"
 	"github.com/square/p2/pkg/store/consul"
-	"github.com/square/p2/pkg/util"
 )
 
 // This cannot currently be used to test sessions competing for the same locks
@@ -50,7 +50,7 @@ func (u *fakeUnlocker) Unlock() error {
 	u.session.mu.Lock()
 	defer u.session.mu.Unlock()
 	if u.session.destroyed {
-		return util.Errorf("Fake session destroyed, cannot unlock")
+		return errors.Errorf("Fake session destroyed, cannot unlock")
 	}
 
 	u.session.locks[u.key] = false
@@ -67,7 +67,7 @@ func (f *fakeSession) Lock(key string) (consul.Unlocker, error) {
 	defer f.mu.Unlock()
 
 	if f.destroyed {
-		return nil, util.Errorf("Fake session destroyed, cannot lock")
+		return nil, errors.Errorf("Fake session destroyed, cannot lock")
 	}
 
 	if f.locks[key] {
@@ -85,14 +85,14 @@ func (f *fakeSession) Lock(key string) (consul.Unlocker, error) {
 }
 
 func (f *fakeSession) LockTxn(context.Context, string) (consul.TxnUnlocker, error) {
-	return nil, util.Errorf("LockTxn not implemented in fakeSession. Use a real consul store with a real sesion via consulutil.NewFixture() if this functionality is desired")
+	return nil, errors.Errorf("LockTxn not implemented in fakeSession. Use a real consul store with a real sesion via consulutil.NewFixture() if this functionality is desired")
 }
 func (f *fakeSession) UnlockTxn(context.Context, string, []byte) error {
-	return util.Errorf("UnlockTxn not implemented in fakeSession. Use a real consul store with a real session via consulutil.NewFixture() if this functionality is desired")
+	return errors.Errorf("UnlockTxn not implemented in fakeSession. Use a real consul store with a real session via consulutil.NewFixture() if this functionality is desired")
 }
 
 func (f *fakeSession) LockIfKeyNotExistsTxn(context.Context, string, []byte) (consul.TxnUnlocker, error) {
-	return nil, util.Errorf("LockIfKeyNotExistsTxn not implemented in fakeSession. Use a real consul store with a real sesion via consulutil.NewFixture() if this functionality is desired")
+	return nil, errors.Errorf("LockIfKeyNotExistsTxn not implemented in fakeSession. Use a real consul store with a real sesion via consulutil.NewFixture() if this functionality is desired")
 }
 
 // Not currently implemented
@@ -166,6 +166,10 @@ func (*FakePodStore) WatchPods(podPrefix consul.PodPrefix, nodename types.NodeNa
 	panic("not implemented")
 }
 
+func (*FakePodStore) WatchPodChanges(podPrefix consul.PodPrefix, nodename types.NodeName, quitChan <-chan struct{}, errChan chan<- error, changesChan chan<- consul.PodChanges) {
+	panic("not implemented")
+}
+
 func (*FakePodStore) WatchAllPods(podPrefix consul.PodPrefix, quitChan <-chan struct{}, errChan chan<- error, podChan chan<- []consul.ManifestResult, pauseTime time.Duration) {
 	panic("not implemented")
 }
@@ -188,6 +192,6 @@ func (*FakePodStore) NewUnmanagedSession(session string, name string) consul.Ses
 	panic("not implemented")
 }
 
-func (*FakePodStore) NewHealthManager(node types.NodeName, logger logging.Logger) consul.HealthManager {
+func (*FakePodStore) NewHealthManager(node types.NodeName, writer consul.HealthWriter, logger logging.Logger) consul.HealthManager {
 	panic("not implemented")
 }
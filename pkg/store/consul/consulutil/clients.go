@@ -8,6 +8,7 @@ import (
 type ConsulClient interface {
 	KV() ConsulKVClient
 	Session() ConsulSessionClient
+	Agent() ConsulAgentClient
 }
 
 // Interface representing the functionality of the api.KV struct returned by
@@ -40,6 +41,14 @@ type ConsulSessionClient interface {
 	RenewPeriodic(initialTTL string, id string, q *api.WriteOptions, doneCh chan struct{}) error
 }
 
+// Specifies the functionality provided by the *api.Agent struct for managing
+// the services registered with the local consul agent
+type ConsulAgentClient interface {
+	Services() (map[string]*api.AgentService, error)
+	ServiceRegister(service *api.AgentServiceRegistration) error
+	ServiceDeregister(serviceID string) error
+}
+
 // Sadly, *api.Client does not implement the ConsulClient interface because the
 // return types of KV() and Session() don't match exactly, e.g. KV() returns an
 // *api.KV not a ConsulKVCLient, even though *api.KV implements ConsulKVClient.
@@ -62,3 +71,7 @@ func (c consulClientWrapper) KV() ConsulKVClient {
 func (c consulClientWrapper) Session() ConsulSessionClient {
 	return c.rawClient.Session()
 }
+
+func (c consulClientWrapper) Agent() ConsulAgentClient {
+	return c.rawClient.Agent()
+}
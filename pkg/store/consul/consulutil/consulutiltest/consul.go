@@ -0,0 +1,289 @@
+// Package consulutiltest provides an in-memory fake of consul's KV store and
+// sessions for testing code that talks to consul through a
+// consulutil.ConsulClient. Unlike consulutil.FakeKV, it keeps the indexes
+// that consul assigns to writes, answers blocking queries, ties locks to
+// sessions, and applies transactions atomically, so that watches and
+// check-and-set loops behave as they would against a real consul server.
+//
+// Everything is deterministic: writes are numbered by a single index, session
+// IDs are assigned in sequence, and results are sorted by key. Sessions never
+// expire on their own; destroy a session to simulate its expiry.
+package consulutiltest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+)
+
+const (
+	// How long a blocking query waits for a change when it doesn't ask
+	// for a wait time, and the longest it can ask for, as in consul
+	defaultWaitTime = 5 * time.Minute
+	maxWaitTime     = 10 * time.Minute
+)
+
+// Consul is a fake consul server. Its KV() and Session() clients share its
+// state, so keys locked through one are released by destroying the session
+// through the other, as in consul.
+type Consul struct {
+	mu sync.Mutex
+
+	// The index of the last write, which every write increments
+	index uint64
+	kv    kvState
+
+	sessions     map[string]*api.SessionEntry
+	sessionCount int
+
+	// closed and replaced on every write to wake blocked queries
+	changed chan struct{}
+}
+
+var _ consulutil.ConsulClient = &Consul{}
+
+// NewConsul returns a fake consul server with no keys or sessions
+func NewConsul() *Consul {
+	return &Consul{
+		index: 1,
+		kv: kvState{
+			entries:    make(map[string]*api.KVPair),
+			tombstones: make(map[string]uint64),
+		},
+		sessions: make(map[string]*api.SessionEntry),
+		changed:  make(chan struct{}),
+	}
+}
+
+func (c *Consul) KV() consulutil.ConsulKVClient {
+	return kv{c}
+}
+
+func (c *Consul) Session() consulutil.ConsulSessionClient {
+	return session{c}
+}
+
+func (c *Consul) Agent() consulutil.ConsulAgentClient {
+	panic("not implemented")
+}
+
+// LastIndex returns the index of the last write
+func (c *Consul) LastIndex() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.index
+}
+
+// commitLocked makes the changes of a write at the next index visible and
+// wakes any blocked queries
+func (c *Consul) commitLocked(kv kvState) {
+	c.kv = kv
+	c.index++
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// queryMetaLocked returns the metadata of a query of the given key, or of
+// the keys with the given prefix
+func (c *Consul) queryMetaLocked(key string, isPrefix bool) *api.QueryMeta {
+	return &api.QueryMeta{
+		LastIndex:   c.kv.index(key, isPrefix, c.index),
+		KnownLeader: true,
+	}
+}
+
+// wait blocks a query that has a WaitIndex until the index of the key (or of
+// the keys with the prefix) passes it, or the query's wait time elapses. A
+// query without a WaitIndex returns immediately.
+func (c *Consul) wait(key string, isPrefix bool, q *api.QueryOptions) {
+	if q == nil || q.WaitIndex == 0 {
+		return
+	}
+	waitTime := q.WaitTime
+	if waitTime <= 0 {
+		waitTime = defaultWaitTime
+	} else if waitTime > maxWaitTime {
+		waitTime = maxWaitTime
+	}
+
+	timer := time.NewTimer(waitTime)
+	defer timer.Stop()
+	for {
+		c.mu.Lock()
+		index := c.kv.index(key, isPrefix, c.index)
+		changed := c.changed
+		c.mu.Unlock()
+		if index > q.WaitIndex {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return
+		}
+	}
+}
+
+// kvState is the contents of the KV store. Entries are never modified in
+// place, so a copy of the maps can be changed by a transaction and thrown
+// away if it fails.
+type kvState struct {
+	entries map[string]*api.KVPair
+	// the index each deleted key was deleted at, so that blocking queries
+	// of a deleted key or of its prefix see the deletion
+	tombstones map[string]uint64
+}
+
+func (s kvState) copy() kvState {
+	cp := kvState{
+		entries:    make(map[string]*api.KVPair, len(s.entries)),
+		tombstones: make(map[string]uint64, len(s.tombstones)),
+	}
+	for key, entry := range s.entries {
+		cp.entries[key] = entry
+	}
+	for key, index := range s.tombstones {
+		cp.tombstones[key] = index
+	}
+	return cp
+}
+
+// index returns the index a query of the key or prefix reports: the last
+// index that any matching key was written or deleted at. If no key ever
+// matched, it is the index of the store as a whole.
+func (s kvState) index(key string, isPrefix bool, storeIndex uint64) uint64 {
+	matches := func(k string) bool {
+		if isPrefix {
+			return strings.HasPrefix(k, key)
+		}
+		return k == key
+	}
+
+	var index uint64
+	for k, entry := range s.entries {
+		if matches(k) && entry.ModifyIndex > index {
+			index = entry.ModifyIndex
+		}
+	}
+	for k, deleted := range s.tombstones {
+		if matches(k) && deleted > index {
+			index = deleted
+		}
+	}
+	if index == 0 {
+		return storeIndex
+	}
+	return index
+}
+
+// list returns copies of the entries with the prefix, sorted by key
+func (s kvState) list(prefix string) api.KVPairs {
+	pairs := api.KVPairs{}
+	for key, entry := range s.entries {
+		if strings.HasPrefix(key, prefix) {
+			pairs = append(pairs, copyPair(entry))
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+	return pairs
+}
+
+// set writes the value and flags of p at the index, keeping the lock of an
+// existing key
+func (s kvState) set(p *api.KVPair, index uint64) *api.KVPair {
+	entry := &api.KVPair{
+		Key:         p.Key,
+		Flags:       p.Flags,
+		Value:       append([]byte(nil), p.Value...),
+		CreateIndex: index,
+		ModifyIndex: index,
+	}
+	if existing, ok := s.entries[p.Key]; ok {
+		entry.CreateIndex = existing.CreateIndex
+		entry.LockIndex = existing.LockIndex
+		entry.Session = existing.Session
+	}
+	s.entries[p.Key] = entry
+	delete(s.tombstones, p.Key)
+	return entry
+}
+
+// casError returns why a check-and-set of the key at casIndex fails, or ""
+// if it doesn't. An index of 0 only matches a key that doesn't exist.
+func (s kvState) casError(key string, casIndex uint64) string {
+	existing, ok := s.entries[key]
+	switch {
+	case casIndex == 0 && ok:
+		return fmt.Sprintf("failed to set key %q, index is stale", key)
+	case casIndex != 0 && !ok:
+		return fmt.Sprintf("failed to set key %q, index is stale", key)
+	case ok && existing.ModifyIndex != casIndex:
+		return casMismatch(key, existing.ModifyIndex, casIndex)
+	default:
+		return ""
+	}
+}
+
+func (s kvState) delete(key string, index uint64) bool {
+	if _, ok := s.entries[key]; !ok {
+		return false
+	}
+	delete(s.entries, key)
+	s.tombstones[key] = index
+	return true
+}
+
+func (s kvState) deleteTree(prefix string, index uint64) bool {
+	deleted := false
+	for key := range s.entries {
+		if strings.HasPrefix(key, prefix) {
+			deleted = s.delete(key, index) || deleted
+		}
+	}
+	return deleted
+}
+
+// lock acquires the key for the session, writing the value and flags of p.
+// It returns why the lock could not be acquired, or "" if it was.
+func (s kvState) lock(p *api.KVPair, index uint64, sessions map[string]*api.SessionEntry) (*api.KVPair, string) {
+	if _, ok := sessions[p.Session]; !ok {
+		return nil, fmt.Sprintf("failed to lock key %q, invalid session %q", p.Key, p.Session)
+	}
+	existing, ok := s.entries[p.Key]
+	if ok && existing.Session != "" && existing.Session != p.Session {
+		return nil, fmt.Sprintf("failed to lock key %q, lock is already held", p.Key)
+	}
+
+	entry := s.set(p, index)
+	if !ok || existing.Session != p.Session {
+		entry.LockIndex++
+	}
+	entry.Session = p.Session
+	return entry, ""
+}
+
+// unlock releases the session's lock of the key, writing the value and
+// flags of p. It returns why the lock could not be released, or "" if it
+// was.
+func (s kvState) unlock(p *api.KVPair, index uint64) (*api.KVPair, string) {
+	existing, ok := s.entries[p.Key]
+	if !ok || existing.Session == "" || existing.Session != p.Session {
+		return nil, fmt.Sprintf("failed to unlock key %q, lock isn't held, or is held by another session", p.Key)
+	}
+	entry := s.set(p, index)
+	entry.Session = ""
+	return entry, ""
+}
+
+func copyPair(p *api.KVPair) *api.KVPair {
+	cp := *p
+	cp.Value = append([]byte(nil), p.Value...)
+	return &cp
+}
@@ -0,0 +1,332 @@
+package consulutiltest
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/store/consul/transaction"
+)
+
+func put(t *testing.T, kv consulutil.ConsulKVClient, key string, value string) {
+	_, err := kv.Put(&api.KVPair{Key: key, Value: []byte(value)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func get(t *testing.T, kv consulutil.ConsulKVClient, key string) *api.KVPair {
+	pair, _, err := kv.Get(key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pair
+}
+
+func TestIndexes(t *testing.T) {
+	kv := NewConsul().KV()
+	put(t, kv, "a/1", "one")
+	put(t, kv, "b/1", "one")
+	put(t, kv, "a/1", "two")
+
+	pair := get(t, kv, "a/1")
+	if string(pair.Value) != "two" {
+		t.Errorf("expected the last value written, got %q", pair.Value)
+	}
+	if pair.CreateIndex >= pair.ModifyIndex {
+		t.Errorf("expected the key to be modified after it was created, got create index %d and modify index %d", pair.CreateIndex, pair.ModifyIndex)
+	}
+
+	_, meta, err := kv.List("b/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.LastIndex != get(t, kv, "b/1").ModifyIndex {
+		t.Errorf("expected the index of a prefix to be the last write under it, got %d", meta.LastIndex)
+	}
+
+	_, err = kv.Delete("b/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, deletedMeta, err := kv.List("b/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deletedMeta.LastIndex <= meta.LastIndex {
+		t.Errorf("expected deleting a key to advance the index of its prefix past %d, got %d", meta.LastIndex, deletedMeta.LastIndex)
+	}
+}
+
+func TestBlockingQuery(t *testing.T) {
+	kv := NewConsul().KV()
+	put(t, kv, "watched/1", "one")
+	_, meta, err := kv.List("watched/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type listResult struct {
+		pairs api.KVPairs
+		meta  *api.QueryMeta
+	}
+	resultCh := make(chan listResult)
+	go func() {
+		pairs, meta, _ := kv.List("watched/", &api.QueryOptions{WaitIndex: meta.LastIndex})
+		resultCh <- listResult{pairs, meta}
+	}()
+
+	put(t, kv, "other/1", "one")
+	select {
+	case <-resultCh:
+		t.Fatal("expected a write to another prefix not to answer the blocking query")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	put(t, kv, "watched/2", "two")
+	select {
+	case res := <-resultCh:
+		if len(res.pairs) != 2 {
+			t.Errorf("expected the blocking query to return both keys, got %d", len(res.pairs))
+		}
+		if res.meta.LastIndex <= meta.LastIndex {
+			t.Errorf("expected the index to advance past %d, got %d", meta.LastIndex, res.meta.LastIndex)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a write to the prefix to answer the blocking query")
+	}
+
+	start := time.Now()
+	_, timedOut, err := kv.Get("watched/1", &api.QueryOptions{
+		WaitIndex: get(t, kv, "watched/1").ModifyIndex,
+		WaitTime:  20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Error("expected the blocking query to wait for its wait time")
+	}
+	if timedOut.LastIndex != get(t, kv, "watched/1").ModifyIndex {
+		t.Errorf("expected a query that timed out to return the same index, got %d", timedOut.LastIndex)
+	}
+}
+
+func TestCAS(t *testing.T) {
+	kv := NewConsul().KV()
+	ok, _, err := kv.CAS(&api.KVPair{Key: "key", Value: []byte("one")}, nil)
+	if err != nil || !ok {
+		t.Fatalf("expected a CAS with index 0 to create the key, got %t, %v", ok, err)
+	}
+	ok, _, err = kv.CAS(&api.KVPair{Key: "key", Value: []byte("two")}, nil)
+	if err != nil || ok {
+		t.Fatalf("expected a CAS with index 0 not to overwrite the key, got %t, %v", ok, err)
+	}
+
+	pair := get(t, kv, "key")
+	stale := pair.ModifyIndex
+	pair.Value = []byte("two")
+	ok, _, err = kv.CAS(pair, nil)
+	if err != nil || !ok {
+		t.Fatalf("expected a CAS with the current index to succeed, got %t, %v", ok, err)
+	}
+	ok, _, err = kv.CAS(&api.KVPair{Key: "key", Value: []byte("three"), ModifyIndex: stale}, nil)
+	if err != nil || ok {
+		t.Fatalf("expected a CAS with a stale index to fail, got %t, %v", ok, err)
+	}
+	if string(get(t, kv, "key").Value) != "two" {
+		t.Errorf("expected a failed CAS not to change the key")
+	}
+
+	ok, _, err = kv.DeleteCAS(&api.KVPair{Key: "key", ModifyIndex: stale}, nil)
+	if err != nil || ok {
+		t.Fatalf("expected a delete with a stale index to fail, got %t, %v", ok, err)
+	}
+	ok, _, err = kv.DeleteCAS(get(t, kv, "key"), nil)
+	if err != nil || !ok {
+		t.Fatalf("expected a delete with the current index to succeed, got %t, %v", ok, err)
+	}
+	if get(t, kv, "key") != nil {
+		t.Error("expected the key to be deleted")
+	}
+}
+
+func TestKeys(t *testing.T) {
+	kv := NewConsul().KV()
+	for _, key := range []string{"pods/b/2", "pods/a/1", "pods/a/2", "pods/c", "other/a"} {
+		put(t, kv, key, "")
+	}
+
+	keys, _, err := kv.Keys("pods/", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"pods/a/", "pods/b/", "pods/c"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected keys %s, got %s", expected, keys)
+	}
+
+	keys, _, err = kv.Keys("pods/a", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"pods/a/1", "pods/a/2"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected keys %s, got %s", expected, keys)
+	}
+}
+
+func TestSessionLocks(t *testing.T) {
+	c := NewConsul()
+	kv := c.KV()
+	first, _, err := c.Session().Create(&api.SessionEntry{Name: "first"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := c.Session().Create(&api.SessionEntry{Name: "second", Behavior: api.SessionBehaviorDelete}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, _, err := kv.Acquire(&api.KVPair{Key: "lock/a", Session: first}, nil)
+	if err != nil || !ok {
+		t.Fatalf("expected the first session to acquire the lock, got %t, %v", ok, err)
+	}
+	ok, _, err = kv.Acquire(&api.KVPair{Key: "lock/a", Session: second}, nil)
+	if err != nil || ok {
+		t.Fatalf("expected the second session not to acquire a held lock, got %t, %v", ok, err)
+	}
+	_, _, err = kv.Acquire(&api.KVPair{Key: "lock/a", Session: "missing"}, nil)
+	if err == nil {
+		t.Fatal("expected acquiring a lock with a session that doesn't exist to be an error")
+	}
+
+	put(t, kv, "lock/a", "written")
+	if pair := get(t, kv, "lock/a"); pair.Session != first || pair.LockIndex != 1 {
+		t.Errorf("expected a put to keep the lock, got session %q and lock index %d", pair.Session, pair.LockIndex)
+	}
+
+	_, err = c.Session().Destroy(first, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pair := get(t, kv, "lock/a"); pair == nil || pair.Session != "" {
+		t.Errorf("expected destroying a session to release its locks and keep the keys, got %+v", pair)
+	}
+
+	ok, _, err = kv.Acquire(&api.KVPair{Key: "lock/a", Session: second}, nil)
+	if err != nil || !ok {
+		t.Fatalf("expected the second session to acquire the released lock, got %t, %v", ok, err)
+	}
+	if pair := get(t, kv, "lock/a"); pair.LockIndex != 2 {
+		t.Errorf("expected the lock index to count acquisitions, got %d", pair.LockIndex)
+	}
+	ok, _, err = kv.Release(&api.KVPair{Key: "lock/a", Session: first}, nil)
+	if err != nil || ok {
+		t.Fatalf("expected a session that doesn't hold the lock not to release it, got %t, %v", ok, err)
+	}
+	_, err = c.Session().Destroy(second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pair := get(t, kv, "lock/a"); pair != nil {
+		t.Errorf("expected destroying a session with the delete behavior to delete its keys, got %+v", pair)
+	}
+}
+
+func TestTxn(t *testing.T) {
+	kv := NewConsul().KV()
+	put(t, kv, "existing", "one")
+	index := get(t, kv, "existing").ModifyIndex
+
+	ok, resp, _, err := kv.Txn(api.KVTxnOps{
+		{Verb: string(api.KVSet), Key: "new", Value: []byte("new")},
+		{Verb: api.KVCAS, Key: "existing", Value: []byte("two"), Index: index + 100},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok || len(resp.Errors) != 1 || resp.Errors[0].OpIndex != 1 {
+		t.Fatalf("expected the transaction to be rolled back because of its second operation, got %t, %+v", ok, resp.Errors)
+	}
+	if get(t, kv, "new") != nil {
+		t.Error("expected a rolled back transaction not to write any key")
+	}
+
+	ok, resp, _, err = kv.Txn(api.KVTxnOps{
+		{Verb: string(api.KVSet), Key: "new", Value: []byte("new")},
+		{Verb: api.KVCAS, Key: "existing", Value: []byte("two"), Index: index},
+		{Verb: api.KVGet, Key: "existing"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatalf("expected the transaction to be applied, got %+v", resp.Errors)
+	}
+	if len(resp.Results) != 3 || string(resp.Results[2].Value) != "two" {
+		t.Errorf("expected the get to see the transaction's own write, got %+v", resp.Results)
+	}
+	if get(t, kv, "new").ModifyIndex != get(t, kv, "existing").ModifyIndex {
+		t.Error("expected every key written by a transaction to have the same modify index")
+	}
+}
+
+func TestConsumers(t *testing.T) {
+	c := NewConsul()
+
+	// Sessions and locks, as used by replications and controllers
+	first, _, err := consul.NewSession(c, "first", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Destroy()
+	second, _, err := consul.NewSession(c, "second", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Destroy()
+
+	_, err = first.Lock("lock/pod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = second.Lock("lock/pod")
+	if !consul.IsAlreadyLocked(err) {
+		t.Errorf("expected the second session to find the lock held, got %v", err)
+	}
+
+	ctx, cancel := transaction.New(context.Background())
+	defer cancel()
+	err = transaction.Add(ctx, api.KVTxnOp{Verb: string(api.KVSet), Key: "intent/node/pod", Value: []byte("manifest")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = transaction.MustCommit(ctx, c.KV())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Watches, which use blocking queries
+	done := make(chan struct{})
+	defer close(done)
+	pairsCh := make(chan api.KVPairs)
+	go consulutil.WatchPrefix("intent/", c.KV(), pairsCh, done, make(chan error), 0, 0)
+	if pairs := <-pairsCh; len(pairs) != 1 {
+		t.Fatalf("expected the watch to start with the committed key, got %d keys", len(pairs))
+	}
+	put(t, c.KV(), "intent/node/other", "manifest")
+	select {
+	case pairs := <-pairsCh:
+		if len(pairs) != 2 {
+			t.Errorf("expected the watch to see the new key, got %d keys", len(pairs))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the watch to see the new key")
+	}
+}
@@ -0,0 +1,289 @@
+package consulutiltest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+)
+
+// Per https://www.consul.io/api/txn.html
+const maxTxnOps = 64
+
+// kv is the KV client of a fake consul server
+type kv struct {
+	c *Consul
+}
+
+var _ consulutil.ConsulKVClient = kv{}
+
+func (k kv) Get(key string, q *api.QueryOptions) (*api.KVPair, *api.QueryMeta, error) {
+	k.c.wait(key, false, q)
+	k.c.mu.Lock()
+	defer k.c.mu.Unlock()
+	var pair *api.KVPair
+	if entry, ok := k.c.kv.entries[key]; ok {
+		pair = copyPair(entry)
+	}
+	return pair, k.c.queryMetaLocked(key, false), nil
+}
+
+func (k kv) List(prefix string, q *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error) {
+	k.c.wait(prefix, true, q)
+	k.c.mu.Lock()
+	defer k.c.mu.Unlock()
+	return k.c.kv.list(prefix), k.c.queryMetaLocked(prefix, true), nil
+}
+
+// Keys returns the keys with the prefix, sorted. If separator is not empty,
+// keys are cut after the first separator that follows the prefix, so that
+// only one level of a hierarchy is returned.
+func (k kv) Keys(prefix, separator string, q *api.QueryOptions) ([]string, *api.QueryMeta, error) {
+	k.c.wait(prefix, true, q)
+	k.c.mu.Lock()
+	defer k.c.mu.Unlock()
+
+	seen := make(map[string]bool)
+	keys := []string{}
+	for key := range k.c.kv.entries {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if separator != "" {
+			if i := strings.Index(key[len(prefix):], separator); i >= 0 {
+				key = key[:len(prefix)+i+len(separator)]
+			}
+		}
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, k.c.queryMetaLocked(prefix, true), nil
+}
+
+// write applies a change to a copy of the store's contents, and commits the
+// copy if the change reports that it modified it
+func (k kv) write(change func(s kvState, index uint64) bool) {
+	k.c.mu.Lock()
+	defer k.c.mu.Unlock()
+	s := k.c.kv.copy()
+	if change(s, k.c.index+1) {
+		k.c.commitLocked(s)
+	}
+}
+
+// Put sets the value and flags of the key. The lock on the key, if any, is
+// kept.
+func (k kv) Put(p *api.KVPair, w *api.WriteOptions) (*api.WriteMeta, error) {
+	k.write(func(s kvState, index uint64) bool {
+		s.set(p, index)
+		return true
+	})
+	return &api.WriteMeta{}, nil
+}
+
+// CAS sets the key only if its ModifyIndex is p.ModifyIndex, or if it
+// doesn't exist when p.ModifyIndex is 0
+func (k kv) CAS(p *api.KVPair, w *api.WriteOptions) (bool, *api.WriteMeta, error) {
+	ok := false
+	k.write(func(s kvState, index uint64) bool {
+		if s.casError(p.Key, p.ModifyIndex) != "" {
+			return false
+		}
+		s.set(p, index)
+		ok = true
+		return true
+	})
+	return ok, &api.WriteMeta{}, nil
+}
+
+func (k kv) Delete(key string, w *api.WriteOptions) (*api.WriteMeta, error) {
+	k.write(func(s kvState, index uint64) bool {
+		return s.delete(key, index)
+	})
+	return &api.WriteMeta{}, nil
+}
+
+// DeleteCAS deletes the key only if its ModifyIndex is p.ModifyIndex. It
+// succeeds if the key doesn't exist.
+func (k kv) DeleteCAS(p *api.KVPair, w *api.WriteOptions) (bool, *api.WriteMeta, error) {
+	ok := false
+	k.write(func(s kvState, index uint64) bool {
+		existing, exists := s.entries[p.Key]
+		if !exists {
+			ok = true
+			return false
+		}
+		if existing.ModifyIndex != p.ModifyIndex {
+			return false
+		}
+		ok = true
+		return s.delete(p.Key, index)
+	})
+	return ok, &api.WriteMeta{}, nil
+}
+
+func (k kv) DeleteTree(prefix string, w *api.WriteOptions) (*api.WriteMeta, error) {
+	k.write(func(s kvState, index uint64) bool {
+		return s.deleteTree(prefix, index)
+	})
+	return &api.WriteMeta{}, nil
+}
+
+// Acquire locks the key for p.Session and sets its value and flags. It
+// returns false if another session holds the lock, and an error if the
+// session doesn't exist.
+func (k kv) Acquire(p *api.KVPair, w *api.WriteOptions) (bool, *api.WriteMeta, error) {
+	var err error
+	ok := false
+	k.write(func(s kvState, index uint64) bool {
+		if _, exists := k.c.sessions[p.Session]; !exists {
+			err = errors.Errorf("invalid session %q", p.Session)
+			return false
+		}
+		_, reason := s.lock(p, index, k.c.sessions)
+		ok = reason == ""
+		return ok
+	})
+	if err != nil {
+		return false, nil, err
+	}
+	return ok, &api.WriteMeta{}, nil
+}
+
+// Release unlocks the key if p.Session holds its lock, and sets its value
+// and flags
+func (k kv) Release(p *api.KVPair, w *api.WriteOptions) (bool, *api.WriteMeta, error) {
+	ok := false
+	k.write(func(s kvState, index uint64) bool {
+		_, reason := s.unlock(p, index)
+		ok = reason == ""
+		return ok
+	})
+	return ok, &api.WriteMeta{}, nil
+}
+
+// Txn applies every operation or none of them. All of the keys a
+// transaction writes get the same ModifyIndex. If any operation fails, the
+// response lists why.
+func (k kv) Txn(ops api.KVTxnOps, q *api.QueryOptions) (bool, *api.KVTxnResponse, *api.QueryMeta, error) {
+	if len(ops) > maxTxnOps {
+		return false, nil, nil, errors.Errorf("transactions cannot have more than %d operations, got %d", maxTxnOps, len(ops))
+	}
+
+	k.c.mu.Lock()
+	defer k.c.mu.Unlock()
+	s := k.c.kv.copy()
+	index := k.c.index + 1
+	resp := &api.KVTxnResponse{}
+	modified := false
+	for i, op := range ops {
+		results, reason, wrote, err := k.applyLocked(s, index, op)
+		if err != nil {
+			return false, nil, nil, err
+		}
+		if reason != "" {
+			resp.Errors = append(resp.Errors, &api.TxnError{OpIndex: i, What: reason})
+			continue
+		}
+		resp.Results = append(resp.Results, results...)
+		modified = modified || wrote
+	}
+
+	meta := &api.QueryMeta{LastIndex: k.c.index, KnownLeader: true}
+	if len(resp.Errors) > 0 {
+		resp.Results = nil
+		return false, resp, meta, nil
+	}
+	if modified {
+		k.c.commitLocked(s)
+		meta.LastIndex = k.c.index
+	}
+	return true, resp, meta, nil
+}
+
+// applyLocked applies a single transaction operation to s. It returns the
+// operation's results, why it failed if it did, and whether it changed s.
+// An error means that the operation is not valid at all.
+func (k kv) applyLocked(s kvState, index uint64, op *api.KVTxnOp) (api.KVPairs, string, bool, error) {
+	p := &api.KVPair{Key: op.Key, Value: op.Value, Flags: op.Flags, ModifyIndex: op.Index, Session: op.Session}
+	switch op.Verb {
+	case string(api.KVSet):
+		return api.KVPairs{withoutValue(s.set(p, index))}, "", true, nil
+	case api.KVCAS:
+		if reason := s.casError(op.Key, op.Index); reason != "" {
+			return nil, reason, false, nil
+		}
+		return api.KVPairs{withoutValue(s.set(p, index))}, "", true, nil
+	case api.KVDelete:
+		return nil, "", s.delete(op.Key, index), nil
+	case api.KVDeleteCAS:
+		existing, ok := s.entries[op.Key]
+		if ok && existing.ModifyIndex != op.Index {
+			return nil, casMismatch(op.Key, existing.ModifyIndex, op.Index), false, nil
+		}
+		return nil, "", s.delete(op.Key, index), nil
+	case api.KVDeleteTree:
+		return nil, "", s.deleteTree(op.Key, index), nil
+	case api.KVLock:
+		entry, reason := s.lock(p, index, k.c.sessions)
+		if reason != "" {
+			return nil, reason, false, nil
+		}
+		return api.KVPairs{withoutValue(entry)}, "", true, nil
+	case api.KVUnlock:
+		entry, reason := s.unlock(p, index)
+		if reason != "" {
+			return nil, reason, false, nil
+		}
+		return api.KVPairs{withoutValue(entry)}, "", true, nil
+	case api.KVGet:
+		entry, ok := s.entries[op.Key]
+		if !ok {
+			return nil, keyNotFound(op.Key), false, nil
+		}
+		return api.KVPairs{copyPair(entry)}, "", false, nil
+	case api.KVGetTree:
+		return s.list(op.Key), "", false, nil
+	case api.KVCheckIndex:
+		entry, ok := s.entries[op.Key]
+		if !ok {
+			return nil, keyNotFound(op.Key), false, nil
+		}
+		if entry.ModifyIndex != op.Index {
+			return nil, casMismatch(op.Key, entry.ModifyIndex, op.Index), false, nil
+		}
+		return api.KVPairs{withoutValue(entry)}, "", false, nil
+	case api.KVCheckSession:
+		entry, ok := s.entries[op.Key]
+		if !ok {
+			return nil, keyNotFound(op.Key), false, nil
+		}
+		if entry.Session != op.Session {
+			return nil, fmt.Sprintf("failed session check for key %q, current session %q != %q", op.Key, entry.Session, op.Session), false, nil
+		}
+		return api.KVPairs{withoutValue(entry)}, "", false, nil
+	default:
+		return nil, "", false, errors.Errorf("unknown transaction verb %q", op.Verb)
+	}
+}
+
+func withoutValue(p *api.KVPair) *api.KVPair {
+	cp := *p
+	cp.Value = nil
+	return &cp
+}
+
+func keyNotFound(key string) string {
+	return fmt.Sprintf("key %q doesn't exist", key)
+}
+
+func casMismatch(key string, current uint64, expected uint64) string {
+	return fmt.Sprintf("current modify index %d for key %q doesn't match %d", current, key, expected)
+}
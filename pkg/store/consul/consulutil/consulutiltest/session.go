@@ -0,0 +1,132 @@
+package consulutiltest
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+)
+
+// session is the session client of a fake consul server
+type session struct {
+	c *Consul
+}
+
+var _ consulutil.ConsulSessionClient = session{}
+
+// Create creates a session. Its ID is assigned in sequence, and its behavior
+// defaults to releasing its locks when it is destroyed.
+func (s session) Create(se *api.SessionEntry, q *api.WriteOptions) (string, *api.WriteMeta, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+	s.c.sessionCount++
+	entry := &api.SessionEntry{}
+	if se != nil {
+		*entry = *se
+	}
+	entry.ID = fmt.Sprintf("00000000-0000-0000-0000-%012d", s.c.sessionCount)
+	entry.CreateIndex = s.c.index
+	if entry.Behavior == "" {
+		entry.Behavior = api.SessionBehaviorRelease
+	}
+	s.c.sessions[entry.ID] = entry
+	return entry.ID, &api.WriteMeta{}, nil
+}
+
+func (s session) CreateNoChecks(se *api.SessionEntry, q *api.WriteOptions) (string, *api.WriteMeta, error) {
+	return s.Create(se, q)
+}
+
+// Destroy destroys the session. Its locks are released, or the keys it
+// locked are deleted if its behavior is "delete".
+func (s session) Destroy(id string, q *api.WriteOptions) (*api.WriteMeta, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+	entry, ok := s.c.sessions[id]
+	if !ok {
+		return &api.WriteMeta{}, nil
+	}
+	delete(s.c.sessions, id)
+
+	kv := s.c.kv.copy()
+	index := s.c.index + 1
+	modified := false
+	for key, pair := range kv.entries {
+		if pair.Session != id {
+			continue
+		}
+		modified = true
+		if entry.Behavior == api.SessionBehaviorDelete {
+			kv.delete(key, index)
+			continue
+		}
+		released := *pair
+		released.Session = ""
+		released.ModifyIndex = index
+		kv.entries[key] = &released
+	}
+	if modified {
+		s.c.commitLocked(kv)
+	}
+	return &api.WriteMeta{}, nil
+}
+
+// Info returns the session, or nil if it doesn't exist
+func (s session) Info(id string, q *api.QueryOptions) (*api.SessionEntry, *api.QueryMeta, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+	meta := &api.QueryMeta{LastIndex: s.c.index, KnownLeader: true}
+	entry, ok := s.c.sessions[id]
+	if !ok {
+		return nil, meta, nil
+	}
+	cp := *entry
+	return &cp, meta, nil
+}
+
+// List returns every session in the order they were created
+func (s session) List(q *api.QueryOptions) ([]*api.SessionEntry, *api.QueryMeta, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+	entries := []*api.SessionEntry{}
+	for _, entry := range s.c.sessions {
+		cp := *entry
+		entries = append(entries, &cp)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries, &api.QueryMeta{LastIndex: s.c.index, KnownLeader: true}, nil
+}
+
+// Renew returns the session, or nil if it doesn't exist. Sessions don't
+// expire, so renewing them does nothing else.
+func (s session) Renew(id string, q *api.WriteOptions) (*api.SessionEntry, *api.WriteMeta, error) {
+	entry, _, err := s.Info(id, nil)
+	return entry, &api.WriteMeta{}, err
+}
+
+// RenewPeriodic renews the session every half of its TTL until doneCh is
+// closed, when it destroys the session. Like the consul client, it returns
+// api.ErrSessionExpired as soon as a renewal finds that the session no
+// longer exists.
+func (s session) RenewPeriodic(initialTTL string, id string, q *api.WriteOptions, doneCh chan struct{}) error {
+	ttl, err := time.ParseDuration(initialTTL)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-time.After(ttl / 2):
+			entry, _, _ := s.Renew(id, q)
+			if entry == nil {
+				return api.ErrSessionExpired
+			}
+		case <-doneCh:
+			_, _ = s.Destroy(id, q)
+			return nil
+		}
+	}
+}
@@ -5,12 +5,14 @@ import (
 	"strings"
 	"sync"
 
-	"github.com/square/p2/pkg/util"
-
 	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/errors"
 )
 
-// Provides a fake implementation of *api.KV{} which is useful in tests
+// Provides a fake implementation of *api.KV{} which is useful in tests. See
+// the consulutiltest package for a fake that also models indexes, blocking
+// queries, sessions and transactions.
 type FakeKV struct {
 	Entries map[string]*api.KVPair
 	mu      sync.Mutex
@@ -24,6 +26,7 @@ var _ ConsulClient = &FakeConsulClient{}
 
 func (c FakeConsulClient) KV() ConsulKVClient           { return c.KV_ }
 func (c FakeConsulClient) Session() ConsulSessionClient { panic("not implemented") }
+func (c FakeConsulClient) Agent() ConsulAgentClient     { panic("not implemented") }
 
 func NewFakeClient() *FakeConsulClient {
 	return &FakeConsulClient{
@@ -75,7 +78,7 @@ func (f *FakeKV) CAS(p *api.KVPair, q *api.WriteOptions) (bool, *api.WriteMeta,
 	defer f.mu.Unlock()
 	if keyPair, ok := f.Entries[p.Key]; ok {
 		if keyPair.ModifyIndex != p.ModifyIndex {
-			return false, nil, util.Errorf("CAS error for %s", p.Key)
+			return false, nil, errors.Errorf("CAS error for %s", p.Key)
 		}
 	}
 
@@ -108,7 +111,7 @@ func (f *FakeKV) Acquire(pair *api.KVPair, q *api.WriteOptions) (bool, *api.Writ
 	f.mu.Lock()
 	defer f.mu.Unlock()
 	if _, ok := f.Entries[pair.Key]; ok {
-		return false, nil, util.Errorf("Key %s is already locked", pair.Key)
+		return false, nil, errors.Errorf("Key %s is already locked", pair.Key)
 	}
 
 	f.Entries[pair.Key] = pair
@@ -120,7 +123,7 @@ func (f *FakeKV) DeleteCAS(pair *api.KVPair, opts *api.WriteOptions) (bool, *api
 	defer f.mu.Unlock()
 	_, ok := f.Entries[pair.Key]
 	if !ok {
-		return false, nil, util.Errorf("Key '%s' does not exist", pair.Key)
+		return false, nil, errors.Errorf("Key '%s' does not exist", pair.Key)
 	}
 
 	delete(f.Entries, pair.Key)
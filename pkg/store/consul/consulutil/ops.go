@@ -2,12 +2,13 @@ package consulutil
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"path/filepath"
 	"runtime"
 
 	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/errors"
 )
 
 // KVError encapsulates a consul error
@@ -40,6 +41,17 @@ func (err KVError) Function() string {
 	return err.function
 }
 
+// Unwrap returns the error returned by consul
+func (err KVError) Unwrap() error {
+	return err.KVError
+}
+
+// ErrCode categorizes consul failures as unavailable, see the errors
+// package
+func (err KVError) ErrCode() errors.Code {
+	return errors.CodeUnavailable
+}
+
 // NewKVError constructs a new KVError to wrap errors from Consul.
 func NewKVError(op string, key string, err error) KVError {
 	var function string
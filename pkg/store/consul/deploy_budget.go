@@ -0,0 +1,55 @@
+package consul
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+)
+
+// DeployBudgetKey holds the number of nodes, fleet-wide, that may be in the
+// middle of an update at the same time, summed over every rollout of every
+// pod. It protects infrastructure that all deploys share, such as the
+// artifact store and load balancer reconfiguration, from being overwhelmed
+// when many rollouts run at once. Rollouts claim one of the slots under
+// DeployBudgetLockPath() for each node they update.
+//
+// The budget is a plain decimal integer. It is unlimited when the key is
+// missing or zero.
+const DeployBudgetKey = "deploy_budget"
+
+// DeployBudget returns the fleet-wide deploy budget, or 0 if there is none
+func (c consulStore) DeployBudget() (int, error) {
+	kvp, _, err := c.client.KV().Get(DeployBudgetKey, nil)
+	if err != nil {
+		return 0, consulutil.NewKVError("get", DeployBudgetKey, err)
+	}
+	if kvp == nil {
+		return 0, nil
+	}
+
+	budget, err := strconv.Atoi(strings.TrimSpace(string(kvp.Value)))
+	if err != nil || budget < 0 {
+		return 0, errors.Codef(errors.CodeInvalid, "invalid deploy budget %q at %s", kvp.Value, DeployBudgetKey)
+	}
+	return budget, nil
+}
+
+// SetDeployBudget sets the fleet-wide deploy budget. A budget of 0 removes
+// the limit.
+func (c consulStore) SetDeployBudget(budget int) error {
+	if budget < 0 {
+		return errors.Errorf("deploy budget must not be negative, got %d", budget)
+	}
+	_, err := c.client.KV().Put(&api.KVPair{
+		Key:   DeployBudgetKey,
+		Value: []byte(strconv.Itoa(budget)),
+	}, nil)
+	if err != nil {
+		return consulutil.NewKVError("put", DeployBudgetKey, err)
+	}
+	return nil
+}
@@ -7,9 +7,9 @@ import (
 
 	"github.com/square/p2/pkg/audit"
 	"github.com/square/p2/pkg/ds/fields"
+	"github.com/square/p2/pkg/errors"
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/types"
-	"github.com/square/p2/pkg/util"
 
 	klabels "k8s.io/kubernetes/pkg/labels"
 )
@@ -54,7 +54,7 @@ func (a AuditingStore) Create(
 
 	err = a.auditLogStore.Create(ctx, audit.DSCreatedEvent, details)
 	if err != nil {
-		return fields.DaemonSet{}, util.Errorf("could not create audit log record for daemon set creation: %s", err)
+		return fields.DaemonSet{}, errors.Errorf("could not create audit log record for daemon set creation: %w", err)
 	}
 
 	return ds, nil
@@ -76,7 +76,7 @@ func (a AuditingStore) Disable(
 	}
 	err = a.auditLogStore.Create(ctx, audit.DSDisabledEvent, details)
 	if err != nil {
-		return fields.DaemonSet{}, util.Errorf("could not create audit log record for daemon set disable: %s", err)
+		return fields.DaemonSet{}, errors.Errorf("could not create audit log record for daemon set disable: %w", err)
 	}
 
 	return ds, nil
@@ -98,7 +98,7 @@ func (a AuditingStore) Enable(
 	}
 	err = a.auditLogStore.Create(ctx, audit.DSEnabledEvent, details)
 	if err != nil {
-		return fields.DaemonSet{}, util.Errorf("could not create audit log record for daemon set enable: %s", err)
+		return fields.DaemonSet{}, errors.Errorf("could not create audit log record for daemon set enable: %w", err)
 	}
 
 	return ds, nil
@@ -126,7 +126,7 @@ func (a AuditingStore) UpdateManifest(
 	}
 	err = a.auditLogStore.Create(ctx, audit.DSManifestUpdatedEvent, details)
 	if err != nil {
-		return fields.DaemonSet{}, util.Errorf("could not create audit log record for daemon set manifest update: %s", err)
+		return fields.DaemonSet{}, errors.Errorf("could not create audit log record for daemon set manifest update: %w", err)
 	}
 
 	return ds, nil
@@ -154,7 +154,7 @@ func (a AuditingStore) UpdateNodeSelector(
 	}
 	err = a.auditLogStore.Create(ctx, audit.DSNodeSelectorUpdatedEvent, details)
 	if err != nil {
-		return fields.DaemonSet{}, util.Errorf("could not create audit log record for daemon set node selector update: %s", err)
+		return fields.DaemonSet{}, errors.Errorf("could not create audit log record for daemon set node selector update: %w", err)
 	}
 
 	return ds, nil
@@ -173,7 +173,7 @@ func (a AuditingStore) Delete(
 		// Here we make a different decision because the user might expect an audit
 		// log record to be created if there was no error, so instead we forbid
 		// deleting a daemon set that does not exist
-		return util.Errorf("couldn't delete daemon set: could not fetch daemon set for auditing purposes: %s", err)
+		return errors.Errorf("couldn't delete daemon set: could not fetch daemon set for auditing purposes: %w", err)
 	}
 
 	err = a.innerStore.DeleteTxn(ctx, id)
@@ -187,7 +187,7 @@ func (a AuditingStore) Delete(
 	}
 	err = a.auditLogStore.Create(ctx, audit.DSDeletedEvent, details)
 	if err != nil {
-		return util.Errorf("could not create audit log record for daemon set deletion: %s", err)
+		return errors.Errorf("could not create audit log record for daemon set deletion: %w", err)
 	}
 
 	return nil
@@ -215,7 +215,7 @@ func (a AuditingStore) UpdateMinHealth(
 	}
 	err = a.auditLogStore.Create(ctx, audit.DSModifiedEvent, details)
 	if err != nil {
-		return fields.DaemonSet{}, util.Errorf("could not create audit log record for daemon set min health update: %s", err)
+		return fields.DaemonSet{}, errors.Errorf("could not create audit log record for daemon set min health update: %w", err)
 	}
 
 	return ds, nil
@@ -243,7 +243,7 @@ func (a AuditingStore) UpdateTimeout(
 	}
 	err = a.auditLogStore.Create(ctx, audit.DSModifiedEvent, details)
 	if err != nil {
-		return fields.DaemonSet{}, util.Errorf("could not create audit log record for daemon set timeout update: %s", err)
+		return fields.DaemonSet{}, errors.Errorf("could not create audit log record for daemon set timeout update: %w", err)
 	}
 
 	return ds, nil
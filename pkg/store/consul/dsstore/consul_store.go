@@ -3,7 +3,6 @@ package dsstore
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"path"
 	"time"
@@ -13,13 +12,13 @@ import (
 	klabels "k8s.io/kubernetes/pkg/labels"
 
 	"github.com/square/p2/pkg/ds/fields"
+	"github.com/square/p2/pkg/errors"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/transaction"
 	"github.com/square/p2/pkg/types"
-	"github.com/square/p2/pkg/util"
 )
 
 const dsTree string = "daemon_sets"
@@ -69,12 +68,12 @@ func (s *ConsulStore) Create(
 	timeout time.Duration,
 ) (fields.DaemonSet, error) {
 	if err := checkManifestPodID(podID, manifest); err != nil {
-		return fields.DaemonSet{}, util.Errorf("Error verifying manifest pod id: %v", err)
+		return fields.DaemonSet{}, errors.Errorf("Error verifying manifest pod id: %w", err)
 	}
 
 	ds, err := s.innerCreate(ctx, manifest, minHealth, name, nodeSelector, podID, timeout)
 	if err != nil {
-		return fields.DaemonSet{}, util.Errorf("Error creating daemon set: %v", err)
+		return fields.DaemonSet{}, errors.Errorf("Error creating daemon set: %w", err)
 	}
 	return ds, nil
 }
@@ -92,7 +91,7 @@ func (s *ConsulStore) innerCreate(
 	id := fields.ID(uuid.New())
 	dsPath, err := s.dsPath(id)
 	if err != nil {
-		return fields.DaemonSet{}, util.Errorf("Error getting daemon set path: %v", err)
+		return fields.DaemonSet{}, errors.Errorf("Error getting daemon set path: %w", err)
 	}
 	ds := fields.DaemonSet{
 		ID:           id,
@@ -107,7 +106,7 @@ func (s *ConsulStore) innerCreate(
 	// Marshals ds into []bytes using overloaded MarshalJSON
 	rawDS, err := json.Marshal(ds)
 	if err != nil {
-		return fields.DaemonSet{}, util.Errorf("Could not marshal DS as json: %s", err)
+		return fields.DaemonSet{}, errors.Errorf("Could not marshal DS as json: %w", err)
 	}
 
 	err = transaction.Add(ctx, api.KVTxnOp{
@@ -126,7 +125,7 @@ func (s *ConsulStore) innerCreate(
 func (s *ConsulStore) Delete(id fields.ID) error {
 	dsPath, err := s.dsPath(id)
 	if err != nil {
-		return util.Errorf("Error getting daemon set path: %v", err)
+		return errors.Errorf("Error getting daemon set path: %w", err)
 	}
 
 	_, err = s.kv.Delete(dsPath, nil)
@@ -143,7 +142,7 @@ func (s *ConsulStore) Delete(id fields.ID) error {
 func (s *ConsulStore) DeleteTxn(ctx context.Context, id fields.ID) error {
 	dsPath, err := s.dsPath(id)
 	if err != nil {
-		return util.Errorf("Error getting daemon set path: %v", err)
+		return errors.Errorf("Error getting daemon set path: %w", err)
 	}
 
 	err = transaction.Add(ctx, api.KVTxnOp{
@@ -162,7 +161,7 @@ func (s *ConsulStore) Get(id fields.ID) (fields.DaemonSet, *api.QueryMeta, error
 	var metadata *api.QueryMeta
 	dsPath, err := s.dsPath(id)
 	if err != nil {
-		return fields.DaemonSet{}, metadata, util.Errorf("Error getting daemon set path: %v", err)
+		return fields.DaemonSet{}, metadata, errors.Errorf("Error getting daemon set path: %w", err)
 	}
 
 	kvp, metadata, err := s.kv.Get(dsPath, nil)
@@ -180,7 +179,7 @@ func (s *ConsulStore) Get(id fields.ID) (fields.DaemonSet, *api.QueryMeta, error
 
 	ds, err := kvpToDS(kvp)
 	if err != nil {
-		return fields.DaemonSet{}, metadata, util.Errorf("Error translating kvp to daemon set: %v", err)
+		return fields.DaemonSet{}, metadata, errors.Errorf("Error translating kvp to daemon set: %w", err)
 	}
 	return ds, metadata, nil
 }
@@ -208,30 +207,30 @@ func (s *ConsulStore) MutateDS(
 			return fields.DaemonSet{}, err
 		}
 
-		return fields.DaemonSet{}, util.Errorf("Error getting daemon set: %v", err)
+		return fields.DaemonSet{}, errors.Errorf("Error getting daemon set: %w", err)
 	}
 
 	ds, err = mutator(ds)
 	if err != nil {
-		return fields.DaemonSet{}, util.Errorf("Error mutating daemon set: %v", err)
+		return fields.DaemonSet{}, errors.Errorf("Error mutating daemon set: %w", err)
 	}
 	if ds.ID != id {
 		// If the user wants a new uuid, they should delete it and create it
 		return fields.DaemonSet{},
-			util.Errorf("Explicitly changing daemon set ID is not permitted: Wanted '%s' got '%s'", id, ds.ID)
+			errors.Errorf("Explicitly changing daemon set ID is not permitted: Wanted '%s' got '%s'", id, ds.ID)
 	}
 	if err := checkManifestPodID(ds.PodID, ds.Manifest); err != nil {
-		return fields.DaemonSet{}, util.Errorf("Error verifying manifest pod id: %v", err)
+		return fields.DaemonSet{}, errors.Errorf("Error verifying manifest pod id: %w", err)
 	}
 
 	rawDS, err := json.Marshal(ds)
 	if err != nil {
-		return fields.DaemonSet{}, util.Errorf("Could not marshal DS as json: %s", err)
+		return fields.DaemonSet{}, errors.Errorf("Could not marshal DS as json: %w", err)
 	}
 
 	dsPath, err := s.dsPath(id)
 	if err != nil {
-		return fields.DaemonSet{}, util.Errorf("Error getting daemon set path: %v", err)
+		return fields.DaemonSet{}, errors.Errorf("Error getting daemon set path: %w", err)
 	}
 
 	success, _, err := s.kv.CAS(&api.KVPair{
@@ -265,30 +264,30 @@ func (s *ConsulStore) MutateDSTxn(
 			return fields.DaemonSet{}, err
 		}
 
-		return fields.DaemonSet{}, util.Errorf("Error getting daemon set: %v", err)
+		return fields.DaemonSet{}, errors.Errorf("Error getting daemon set: %w", err)
 	}
 
 	ds, err = mutator(ds)
 	if err != nil {
-		return fields.DaemonSet{}, util.Errorf("Error mutating daemon set: %v", err)
+		return fields.DaemonSet{}, errors.Errorf("Error mutating daemon set: %w", err)
 	}
 	if ds.ID != id {
 		// If the user wants a new uuid, they should delete it and create it
 		return fields.DaemonSet{},
-			util.Errorf("Explicitly changing daemon set ID is not permitted: Wanted '%s' got '%s'", id, ds.ID)
+			errors.Errorf("Explicitly changing daemon set ID is not permitted: Wanted '%s' got '%s'", id, ds.ID)
 	}
 	if err := checkManifestPodID(ds.PodID, ds.Manifest); err != nil {
-		return fields.DaemonSet{}, util.Errorf("Error verifying manifest pod id: %v", err)
+		return fields.DaemonSet{}, errors.Errorf("Error verifying manifest pod id: %w", err)
 	}
 
 	rawDS, err := json.Marshal(ds)
 	if err != nil {
-		return fields.DaemonSet{}, util.Errorf("Could not marshal DS as json: %s", err)
+		return fields.DaemonSet{}, errors.Errorf("Could not marshal DS as json: %w", err)
 	}
 
 	dsPath, err := s.dsPath(id)
 	if err != nil {
-		return fields.DaemonSet{}, util.Errorf("Error getting daemon set path: %v", err)
+		return fields.DaemonSet{}, errors.Errorf("Error getting daemon set path: %w", err)
 	}
 
 	err = transaction.Add(ctx, api.KVTxnOp{
@@ -390,7 +389,7 @@ func (s *ConsulStore) Watch(quitCh <-chan struct{}) <-chan WatchedDaemonSets {
 			case <-quitCh:
 				return
 			case err := <-errCh:
-				outgoingDSs.Err = util.Errorf("WatchDiff returned error: %v, recovered", err)
+				outgoingDSs.Err = errors.Errorf("WatchDiff returned error: %w, recovered", err)
 				select {
 				case <-quitCh:
 					return
@@ -406,19 +405,19 @@ func (s *ConsulStore) Watch(quitCh <-chan struct{}) <-chan WatchedDaemonSets {
 
 			createdDSs, err := kvpsToDSs(kvps.Created)
 			if err != nil {
-				outgoingDSs.Err = util.Errorf("Watch create error: %s; ", err)
+				outgoingDSs.Err = errors.Errorf("Watch create error: %w; ", err)
 			}
 			sameDSs, err := kvpsToDSs(kvps.Same)
 			if err != nil {
-				outgoingDSs.Err = util.Errorf("%sWatch same error: %s; ", outgoingDSs.Err, err)
+				outgoingDSs.Err = errors.Errorf("%sWatch same error: %w; ", outgoingDSs.Err, err)
 			}
 			updatedDSs, err := kvpsToDSs(kvps.Updated)
 			if err != nil {
-				outgoingDSs.Err = util.Errorf("%sWatch update error: %s; ", outgoingDSs.Err, err)
+				outgoingDSs.Err = errors.Errorf("%sWatch update error: %w; ", outgoingDSs.Err, err)
 			}
 			deletedDSs, err := kvpsToDSs(kvps.Deleted)
 			if err != nil {
-				outgoingDSs.Err = util.Errorf("%sWatch delete error: %s; ", outgoingDSs.Err, err)
+				outgoingDSs.Err = errors.Errorf("%sWatch delete error: %w; ", outgoingDSs.Err, err)
 			}
 
 			if outgoingDSs.Err != nil {
@@ -519,20 +518,20 @@ func (s *ConsulStore) WatchAll(quitCh <-chan struct{}, pauseTime time.Duration)
 
 func checkManifestPodID(dsPodID types.PodID, manifest manifest.Manifest) error {
 	if dsPodID == "" {
-		return util.Errorf("Daemon set must have a pod id")
+		return errors.Errorf("Daemon set must have a pod id")
 	}
 	if manifest.ID() == "" {
-		return util.Errorf("Daemon set manifest must have a pod id")
+		return errors.Errorf("Daemon set manifest must have a pod id")
 	}
 	if dsPodID != manifest.ID() {
-		return util.Errorf("Daemon set pod id must match manifest pod id. Wanted '%s', got '%s'", dsPodID, manifest.ID())
+		return errors.Errorf("Daemon set pod id must match manifest pod id. Wanted '%s', got '%s'", dsPodID, manifest.ID())
 	}
 	return nil
 }
 
 func (s *ConsulStore) dsPath(dsID fields.ID) (string, error) {
 	if dsID == "" {
-		return "", util.Errorf("Path requested for empty DS id")
+		return "", errors.Codef(errors.CodeInvalid, "Path requested for empty DS id")
 	}
 	return path.Join(dsTree, dsID.String()), nil
 }
@@ -582,10 +581,10 @@ func kvpToDS(kvp *api.KVPair) (fields.DaemonSet, error) {
 	// Unmarshals kvp.Value into ds using overloaded UnmarshalJSON
 	err := json.Unmarshal(kvp.Value, &ds)
 	if err != nil {
-		return ds, util.Errorf("Could not unmarshal DS ('%s') as json: %s", string(kvp.Value), err)
+		return ds, errors.Errorf("Could not unmarshal DS ('%s') as json: %w", string(kvp.Value), err)
 	}
 	if ds.Manifest == nil {
-		return ds, util.Errorf("%s: DS has no manifest", kvp.Key)
+		return ds, errors.Errorf("%s: DS has no manifest", kvp.Key)
 	}
 
 	return ds, nil
@@ -596,7 +595,7 @@ func kvpsToDSs(l api.KVPairs) ([]fields.DaemonSet, error) {
 	for _, kvp := range l {
 		ds, err := kvpToDS(kvp)
 		if err != nil {
-			return nil, util.Errorf("Error translating kvp to daemon set: %v", err)
+			return nil, errors.Errorf("Error translating kvp to daemon set: %w", err)
 		}
 		ret = append(ret, ds)
 	}
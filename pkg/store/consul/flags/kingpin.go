@@ -3,10 +3,13 @@
 package flags
 
 import (
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
+	"os"
+	"sort"
 	"strings"
 	"time"
 
@@ -27,6 +30,7 @@ func ParseWithConsulOptions() (string, consul.Options, labels.ApplicatorWithoutW
 	caFile := kingpin.Flag("tls-ca-file", "File containing the x509 PEM-encoded CA ").ExistingFile()
 	keyFile := kingpin.Flag("tls-key-file", "File containing the x509 PEM-encoded private key").ExistingFile()
 	certFile := kingpin.Flag("tls-cert-file", "File containing the x509 PEM-encoded public key certificate").ExistingFile()
+	cluster := kingpin.Flag("cluster", "The name of the cluster this command is meant for, as recorded by p2-init. If set, the command refuses to run against any other cluster.").Envar("P2_CLUSTER").String()
 
 	cmd := kingpin.Parse()
 
@@ -65,8 +69,12 @@ func ParseWithConsulOptions() (string, consul.Options, labels.ApplicatorWithoutW
 		WaitTime: *wait,
 	}
 
+	err := checkClusterMetadata(consul.NewConsulStore(consul.NewConsulClient(consulOpts)), *cluster)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
 	var applicator labels.ApplicatorWithoutWatches
-	var err error
 	if *httpApplicatorURL != nil {
 		applicator, err = labels.NewHTTPApplicator(httpClient, *httpApplicatorURL)
 		if err != nil {
@@ -78,3 +86,36 @@ func ParseWithConsulOptions() (string, consul.Options, labels.ApplicatorWithoutW
 	}
 	return cmd, consulOpts, applicator
 }
+
+// checkClusterMetadata returns an error if cluster is set and the Consul the
+// tool is pointed at doesn't belong to a cluster of that name, so that a
+// command meant for one cluster is never run against another.
+//
+// It also warns when the cluster's records use schemas that are newer than
+// this tool understands, since it might misread or clobber them. Clusters that
+// haven't been initialized with p2-init are only checked if cluster is set.
+func checkClusterMetadata(store interface {
+	ClusterMetadata() (*consul.ClusterMetadata, error)
+}, cluster string) error {
+	metadata, err := store.ClusterMetadata()
+	switch {
+	case err != nil && cluster != "":
+		return fmt.Errorf("Refusing to run: could not read cluster metadata to check that this is cluster %s: %s", cluster, err)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Warning: could not read cluster metadata: %s\n", err)
+		return nil
+	case metadata == nil && cluster != "":
+		return fmt.Errorf("Refusing to run: expected cluster %s but the cluster has not been initialized with p2-init", cluster)
+	case metadata == nil:
+		return nil
+	case cluster != "" && metadata.Name != cluster:
+		return fmt.Errorf("Refusing to run: expected cluster %s but connected to cluster %s", cluster, metadata.Name)
+	}
+
+	newer := metadata.NewerSchemas()
+	if len(newer) > 0 {
+		sort.Strings(newer)
+		fmt.Fprintf(os.Stderr, "Warning: cluster %s uses newer versions of the %s schemas than this version of p2 understands\n", metadata.Name, strings.Join(newer, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package flags
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/store/consul"
+)
+
+type fakeMetadataStore struct {
+	metadata *consul.ClusterMetadata
+}
+
+func (f fakeMetadataStore) ClusterMetadata() (*consul.ClusterMetadata, error) {
+	return f.metadata, nil
+}
+
+func TestCheckClusterMetadata(t *testing.T) {
+	staging := fakeMetadataStore{&consul.ClusterMetadata{Name: "staging"}}
+	uninitialized := fakeMetadataStore{}
+
+	if err := checkClusterMetadata(staging, "staging"); err != nil {
+		t.Errorf("Expected the matching cluster to be accepted, got %s", err)
+	}
+	if err := checkClusterMetadata(staging, ""); err != nil {
+		t.Errorf("Expected any cluster to be accepted without --cluster, got %s", err)
+	}
+	if err := checkClusterMetadata(staging, "production"); err == nil {
+		t.Error("Expected a different cluster to be refused")
+	}
+	if err := checkClusterMetadata(uninitialized, "production"); err == nil {
+		t.Error("Expected an uninitialized cluster to be refused when --cluster is set")
+	}
+	if err := checkClusterMetadata(uninitialized, ""); err != nil {
+		t.Errorf("Expected an uninitialized cluster to be accepted without --cluster, got %s", err)
+	}
+}
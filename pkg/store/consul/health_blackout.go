@@ -0,0 +1,91 @@
+package consul
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+)
+
+// HealthBlackoutTree holds the health blackout windows of each pod, keyed by
+// pod ID, as a JSON list of health.BlackoutWindow. The health monitor marks
+// critical results checked during a window as suppressed.
+const HealthBlackoutTree = "health_blackouts"
+
+// HealthBlackouts returns the blackout windows of the given pod
+func (c consulStore) HealthBlackouts(podID types.PodID) ([]health.BlackoutWindow, error) {
+	key := path.Join(HealthBlackoutTree, podID.String())
+	kvp, _, err := c.client.KV().Get(key, nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("get", key, err)
+	}
+	if kvp == nil {
+		return nil, nil
+	}
+	return parseHealthBlackouts(kvp)
+}
+
+// AllHealthBlackouts returns the blackout windows of every pod that has any
+func (c consulStore) AllHealthBlackouts() (map[types.PodID][]health.BlackoutWindow, error) {
+	kvps, _, err := c.client.KV().List(HealthBlackoutTree+"/", nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("list", HealthBlackoutTree+"/", err)
+	}
+
+	blackouts := make(map[types.PodID][]health.BlackoutWindow, len(kvps))
+	for _, kvp := range kvps {
+		windows, err := parseHealthBlackouts(kvp)
+		if err != nil {
+			return nil, err
+		}
+		podID := types.PodID(strings.TrimPrefix(kvp.Key, HealthBlackoutTree+"/"))
+		blackouts[podID] = windows
+	}
+	return blackouts, nil
+}
+
+// SetHealthBlackouts replaces the blackout windows of the given pod. Setting
+// no windows removes them.
+func (c consulStore) SetHealthBlackouts(podID types.PodID, windows []health.BlackoutWindow) error {
+	if podID == "" {
+		return errors.Errorf("pod ID must not be empty")
+	}
+	key := path.Join(HealthBlackoutTree, podID.String())
+	if len(windows) == 0 {
+		_, err := c.client.KV().Delete(key, nil)
+		if err != nil {
+			return consulutil.NewKVError("delete", key, err)
+		}
+		return nil
+	}
+
+	for _, window := range windows {
+		if err := window.Validate(); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(windows)
+	if err != nil {
+		return errors.Errorf("could not marshal health blackouts: %w", err)
+	}
+	_, err = c.client.KV().Put(&api.KVPair{Key: key, Value: data}, nil)
+	if err != nil {
+		return consulutil.NewKVError("put", key, err)
+	}
+	return nil
+}
+
+func parseHealthBlackouts(kvp *api.KVPair) ([]health.BlackoutWindow, error) {
+	var windows []health.BlackoutWindow
+	err := json.Unmarshal(kvp.Value, &windows)
+	if err != nil {
+		return nil, errors.Errorf("could not parse health blackouts at %s: %w", kvp.Key, err)
+	}
+	return windows, nil
+}
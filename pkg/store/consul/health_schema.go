@@ -0,0 +1,97 @@
+package consul
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/types"
+)
+
+// WatchResultVersion is the version of the schema of the health results
+// written to the health tree.
+//
+// Within a version, fields are only ever added, never removed or given a new
+// meaning, and readers ignore fields they don't know. That way a result
+// written by a newer p2 can be read by an older one that understands the same
+// version, and the other way around. A change that can't be made that way
+// needs a new version. Readers refuse results with a version newer than they
+// understand rather than misread them.
+//
+// Results written before the schema was versioned have no version and are
+// migrated when read, see migrateWatchResult.
+const WatchResultVersion = 1
+
+// UnsupportedWatchResultVersionError is returned when reading a health result
+// that was written with a newer schema than this version of p2 understands.
+type UnsupportedWatchResultVersionError struct {
+	Version int
+}
+
+func (e UnsupportedWatchResultVersionError) Error() string {
+	return fmt.Sprintf("health result has schema version %d, only versions up to %d are understood", e.Version, WatchResultVersion)
+}
+
+// MarshalWatchResult serializes res with the current schema version, after
+// checking that it names a service and a node.
+func MarshalWatchResult(res WatchResult) ([]byte, error) {
+	res.Version = WatchResultVersion
+	err := validateWatchResult(res)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(res)
+}
+
+// UnmarshalWatchResult parses a health result written by MarshalWatchResult,
+// or by a version of p2 from before the schema was versioned.
+func UnmarshalWatchResult(data []byte) (WatchResult, error) {
+	var res WatchResult
+	err := json.Unmarshal(data, &res)
+	if err != nil {
+		return WatchResult{}, errors.Errorf("could not parse health result: %w", err)
+	}
+
+	switch {
+	case res.Version > WatchResultVersion:
+		return WatchResult{}, UnsupportedWatchResultVersionError{Version: res.Version}
+	case res.Version < 0:
+		return WatchResult{}, errors.Errorf("health result has invalid schema version %d", res.Version)
+	case res.Version == 0:
+		// unversioned results were never checked when written, so
+		// they are taken as they are
+		return migrateWatchResult(res), nil
+	}
+
+	err = validateWatchResult(res)
+	if err != nil {
+		return WatchResult{}, err
+	}
+	return res, nil
+}
+
+// migrateWatchResult brings a result from before the schema was versioned up
+// to version 1. Those results could be written with a status in upper case,
+// and without a pod ID for services whose ID is the pod ID.
+func migrateWatchResult(res WatchResult) WatchResult {
+	res.Status = strings.ToLower(res.Status)
+	if res.Id == "" {
+		res.Id = types.PodID(res.Service)
+	}
+	res.Version = 1
+	return res
+}
+
+// validateWatchResult checks that a result names what it is the health of.
+// The status isn't checked, readers treat statuses they don't recognize as
+// unknown, see health.ToHealthState.
+func validateWatchResult(res WatchResult) error {
+	if res.Service == "" {
+		return errors.Errorf("health result for node %q has no service", res.Node)
+	}
+	if res.Node == "" {
+		return errors.Errorf("health result for service %q has no node", res.Service)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package consul
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/health"
+)
+
+func TestWatchResultRoundTrip(t *testing.T) {
+	res := WatchResult{
+		Id:      "pod",
+		Node:    "node1",
+		Service: "pod",
+		Status:  string(health.Critical),
+		Reason:  health.ReasonTimeout,
+	}
+	data, err := MarshalWatchResult(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := UnmarshalWatchResult(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Version != WatchResultVersion || !read.ValueEquiv(res) {
+		t.Errorf("Expected %+v to survive serialization, got %+v", res, read)
+	}
+
+	_, err = MarshalWatchResult(WatchResult{Node: "node1", Status: string(health.Passing)})
+	if err == nil {
+		t.Error("Expected a result without a service to be refused")
+	}
+	_, err = MarshalWatchResult(WatchResult{Service: "pod", Status: string(health.Passing)})
+	if err == nil {
+		t.Error("Expected a result without a node to be refused")
+	}
+}
+
+func TestUnmarshalWatchResultMigratesUnversionedResults(t *testing.T) {
+	read, err := UnmarshalWatchResult([]byte(`{"Node":"node1","Service":"pod","Status":"PASSING"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Version != 1 || read.Id != "pod" || read.Status != string(health.Passing) {
+		t.Errorf("Expected the result to be migrated, got %+v", read)
+	}
+}
+
+func TestUnmarshalWatchResultVersions(t *testing.T) {
+	// fields added within a version are ignored by readers that don't know them
+	_, err := UnmarshalWatchResult([]byte(`{"Node":"node1","Service":"pod","Status":"passing","Version":1,"NewField":3}`))
+	if err != nil {
+		t.Errorf("Expected unknown fields to be ignored, got %s", err)
+	}
+
+	_, err = UnmarshalWatchResult([]byte(`{"Node":"node1","Service":"pod","Status":"passing","Version":2}`))
+	if _, ok := err.(UnsupportedWatchResultVersionError); !ok {
+		t.Errorf("Expected a newer version to be refused, got %v", err)
+	}
+
+	_, err = UnmarshalWatchResult([]byte(`{"Node":"node1","Status":"passing","Version":1}`))
+	if err == nil {
+		t.Error("Expected a result without a service to be refused")
+	}
+}
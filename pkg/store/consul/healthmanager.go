@@ -1,10 +1,11 @@
 package consul
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -42,6 +43,11 @@ var (
 	// health status to "unknown" with an error message, and further updates will be
 	// throttled until enough tokens have been accumulated.
 	HealthResumeLimit = param.Int64("health_resume_limit", 4)
+
+	// HealthHistorySize is how many of a service's recent statuses are kept
+	// in its health results, so that it can be told when the service
+	// became unhealthy. 0 keeps none
+	HealthHistorySize = param.Int("health_history_size", 10)
 )
 
 // consulHealthManager maintains a Consul session for all the local node's health checks,
@@ -51,31 +57,47 @@ type consulHealthManager struct {
 	done       chan<- struct{}              // Close this to stop reporting health
 	client     consulutil.ConsulClient      // Connection to the Consul agent
 	node       types.NodeName
+	writer     HealthWriter   // Identifies this manager among the node's health writers
 	logger     logging.Logger // Logger for health events
 	wg         sync.WaitGroup
 
+	// Tracks the goroutines of updaters, which exit once their updater is
+	// closed and its health status has been removed
+	updaters sync.WaitGroup
+
 	// retryTime is the amount of time to sleep between failed health writes
 	retryTime time.Duration
+
+	// Health results are written and removed through kv, which is the
+	// client's KV() unless writes are batched
+	kv ConsulKVClient
 }
 
 // NewHealthManager implements the Store interface. It creates a new HealthManager that
 // uses the Consul Key-Value store to hold app health statues.
 func (c consulStore) newSessionHealthManager(
 	node types.NodeName,
+	writer HealthWriter,
 	logger logging.Logger,
 	retryTime time.Duration,
+	kv ConsulKVClient,
 ) HealthManager {
 	done := make(chan struct{})
 
 	if retryTime == 0 {
 		retryTime = time.Duration(*HealthRetryTimeSec) * time.Second
 	}
+	if kv == nil {
+		kv = c.client.KV()
+	}
 	m := &consulHealthManager{
 		done:      done,
 		client:    c.client,
 		node:      node,
+		writer:    writer,
 		logger:    logger,
 		retryTime: retryTime,
+		kv:        kv,
 	}
 
 	// Create a stream of sessions
@@ -99,8 +121,16 @@ func (c consulStore) newSessionHealthManager(
 		)
 	}()
 
+	// Only hand out sessions while this manager is the authoritative writer
+	authorizedChan := make(chan string)
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.fenceSessions(sessionChan, authorizedChan)
+	}()
+
 	// Hook the session stream into a publisher
-	m.sessionPub = stream.NewStringValuePublisher(sessionChan, "")
+	m.sessionPub = stream.NewStringValuePublisher(authorizedChan, "")
 
 	return m
 }
@@ -112,6 +142,26 @@ func (m *consulHealthManager) Close() {
 	m.wg.Wait()
 }
 
+// Shutdown waits for closed updaters to finish their writes before closing the
+// manager. Implements the HealthManager interface.
+func (m *consulHealthManager) Shutdown(ctx context.Context) error {
+	updatersDone := make(chan struct{})
+	go func() {
+		m.updaters.Wait()
+		close(updatersDone)
+	}()
+
+	var err error
+	select {
+	case <-updatersDone:
+	case <-ctx.Done():
+		err = ctx.Err()
+		m.logger.WithError(err).Warnln("Gave up waiting for health updates to be written")
+	}
+	m.Close()
+	return err
+}
+
 // consulHealthUpdater holds the state needed for the update process to track the current
 // service health and which health it has published.
 type consulHealthUpdater struct {
@@ -133,8 +183,11 @@ func (m *consulHealthManager) NewUpdater(pod types.PodID, service string) Health
 	}
 	// Don't increment m.wg for this goroutine: the returned HealthUpdater is closed
 	// separately from the HealthManager, and we don't want closing the HealthManager to
-	// be dependent on its updaters being closed first.
+	// be dependent on its updaters being closed first. Shutdown() waits on them
+	// separately instead.
+	m.updaters.Add(1)
 	go func() {
+		defer m.updaters.Done()
 		sub := m.sessionPub.Subscribe()
 		defer sub.Unsubscribe()
 
@@ -146,7 +199,7 @@ func (m *consulHealthManager) NewUpdater(pod types.PodID, service string) Health
 		throttledCheckStream := throttleChecks(checksStream, *HealthMaxBucketSize, subLogger)
 
 		m.processHealthUpdater(
-			m.client.KV(),
+			m.kv,
 			throttledCheckStream,
 			sub.Chan(),
 			subLogger,
@@ -285,8 +338,12 @@ func (m *consulHealthManager) processHealthUpdater(
 ) {
 	var localHealth *WatchResult  // Health last reported by checker
 	var remoteHealth *WatchResult // Health last written to Consul
+	var remoteWritten time.Time   // When remoteHealth was written
 	var session string            // Current session
 
+	// Recent statuses reported by the checker, oldest first
+	var history []health.HistoryEntry
+
 	var write <-chan writeResult // Future result of an in-flight write
 
 	logger.NoFields().Debug("starting update loop")
@@ -297,10 +354,10 @@ func (m *consulHealthManager) processHealthUpdater(
 			// The local health checker sent a new result
 			if ok {
 				localHealth = &h
+				history = appendHistory(history, h, time.Now())
 			} else {
 				logger.NoFields().Debug("check stream closed")
 				checksStream = nil
-				localHealth = nil
 			}
 		case s, ok := <-sessionsStream:
 			// The active Consul session changed
@@ -319,17 +376,24 @@ func (m *consulHealthManager) processHealthUpdater(
 			write = nil
 			if result.OK {
 				remoteHealth = result.Health
+				remoteWritten = time.Now()
 			}
 		}
 
+		// Once the checker is gone, its last result is written before the health is
+		// removed, so that watchers see it, unless there is no session to write it with
+		if checksStream == nil && localHealth != nil && (session == "" || healthEquiv(localHealth, remoteHealth)) {
+			localHealth = nil
+		}
+
 		// Exit
-		if checksStream == nil && remoteHealth == nil && write == nil {
+		if checksStream == nil && localHealth == nil && remoteHealth == nil && write == nil {
 			logger.NoFields().Debug("exiting update loop")
 			return
 		}
 
 		// Send update to Consul
-		if !healthEquiv(localHealth, remoteHealth) && session != "" && write == nil {
+		if (!healthEquiv(localHealth, remoteHealth) || needsRefresh(remoteHealth, remoteWritten)) && session != "" && write == nil {
 			writeLogger := logger.SubLogger(logrus.Fields{
 				"session": session,
 			})
@@ -346,7 +410,12 @@ func (m *consulHealthManager) processHealthUpdater(
 				})
 			} else {
 				logger.NoFields().Debug("writing remote health")
-				kv, err := healthToKV(*localHealth, session)
+				wr := *localHealth
+				wr.Writer = m.writer.Name
+				if len(history) > 0 {
+					wr.History = &health.History{Entries: history}
+				}
+				kv, err := healthToKV(wr, session)
 				if err != nil {
 					// Practically, this should never happen.
 					logger.WithErrorAndFields(err, logrus.Fields{
@@ -355,32 +424,56 @@ func (m *consulHealthManager) processHealthUpdater(
 					localHealth = nil
 					continue
 				}
-				if remoteHealth == nil {
-					go m.sendHealthUpdate(writeLogger, w, localHealth, func() error {
-						ok, _, err := client.Acquire(kv, nil)
-						if err != nil {
-							return consulutil.NewKVError("acquire", kv.Key, err)
-						}
-						if !ok {
-							return fmt.Errorf("write denied")
-						}
-						return nil
-					})
-				} else {
-					go m.sendHealthUpdate(writeLogger, w, localHealth, func() error {
-						_, err := client.Put(kv, nil)
-						if err != nil {
-							return consulutil.NewKVError("put", kv.Key, err)
-						}
-						return nil
-					})
-				}
+				// Always write with Acquire() rather than Put() so that results can't be
+				// written once the session is gone, e.g. because another health writer
+				// has become authoritative.
+				go m.sendHealthUpdate(writeLogger, w, localHealth, func() error {
+					ok, _, err := client.Acquire(kv, nil)
+					if err != nil {
+						return consulutil.NewKVError("acquire", kv.Key, err)
+					}
+					if !ok {
+						return fmt.Errorf("write denied")
+					}
+					return nil
+				})
 			}
 			write = w
 		}
 	}
 }
 
+// Helper to processHealthUpdater(). Results with a TTL expire even if they
+// don't change, so they are rewritten once half of it has passed.
+func needsRefresh(remote *WatchResult, written time.Time) bool {
+	if remote == nil || remote.Check == nil || remote.Check.TTL <= 0 {
+		return false
+	}
+	return time.Since(written) > remote.Check.TTL/2
+}
+
+// Helper to processHealthUpdater(). Records the time of a change of status,
+// keeping the HealthHistorySize most recent ones.
+func appendHistory(history []health.HistoryEntry, wr WatchResult, now time.Time) []health.HistoryEntry {
+	if *HealthHistorySize <= 0 {
+		return nil
+	}
+	status := health.HealthState(wr.Status)
+	if len(history) > 0 && history[len(history)-1].Status == status {
+		return history
+	}
+	history = append(history, health.HistoryEntry{
+		Time:   now,
+		Status: status,
+		Reason: wr.Reason,
+	})
+	if len(history) > *HealthHistorySize {
+		// copy rather than reslice, so the oldest entries can be collected
+		history = append([]health.HistoryEntry(nil), history[len(history)-*HealthHistorySize:]...)
+	}
+	return history
+}
+
 // Helper to processHealthUpdater()
 func healthEquiv(x *WatchResult, y *WatchResult) bool {
 	return x == nil && y == nil ||
@@ -393,16 +486,38 @@ func toThrottled(wr *WatchResult) *WatchResult {
 		Id:      wr.Id,
 		Service: wr.Service,
 		Status:  string(health.Unknown),
+		Check:   wr.Check,
 	}
 }
 
+// localClockSkewed is 1 while the local clock is known to be skewed, see
+// SetLocalClockSkewed
+var localClockSkewed int32
+
+// SetLocalClockSkewed records whether the local clock is known to be skewed.
+// While it is, the health results written by HealthManagers are marked
+// SkewedClock, so that readers don't judge their freshness by timestamps taken
+// from it.
+func SetLocalClockSkewed(skewed bool) {
+	var value int32
+	if skewed {
+		value = 1
+	}
+	atomic.StoreInt32(&localClockSkewed, value)
+}
+
 // Helper to processHealthUpdater()
 func healthToKV(wr WatchResult, session string) (*api.KVPair, error) {
 	now := time.Now()
 	wr.Time = now
-	// This health check only expires when the key is removed
-	wr.Expires = now.Add(100 * 365 * 24 * time.Hour)
-	data, err := json.Marshal(wr)
+	wr.SkewedClock = atomic.LoadInt32(&localClockSkewed) == 1
+	if wr.Check != nil && wr.Check.TTL > 0 {
+		wr.Expires = now.Add(wr.Check.TTL)
+	} else {
+		// This health check only expires when the key is removed
+		wr.Expires = now.Add(100 * 365 * 24 * time.Hour)
+	}
+	data, err := MarshalWatchResult(wr)
 	if err != nil {
 		return nil, err
 	}
@@ -33,7 +33,7 @@ func TestHealthBasic(t *testing.T) {
 	defer f.Close()
 
 	waiter := f.NewKeyWaiter(hKey)
-	manager := f.Store.NewHealthManager("node", logging.TestLogger())
+	manager := f.Store.NewHealthManager("node", PreparerHealthWriter, logging.TestLogger())
 	defer manager.Close()
 	updater := manager.NewUpdater("svc", "svc")
 
@@ -67,7 +67,7 @@ func TestHealthUpdate(t *testing.T) {
 	f := NewConsulTestFixture(t)
 	defer f.Close()
 
-	manager := f.Store.NewHealthManager("node", logging.TestLogger())
+	manager := f.Store.NewHealthManager("node", PreparerHealthWriter, logging.TestLogger())
 	defer manager.Close()
 	updater := manager.NewUpdater("svc", "svc")
 	defer updater.Close()
@@ -484,3 +484,153 @@ func TestHealthUpdatesTolerantToConsulFailures(t *testing.T) {
 		}
 	}
 }
+
+func TestHealthToKVExpiry(t *testing.T) {
+	wr := WatchResult{
+		Id:      "foo",
+		Node:    "node",
+		Service: "foo",
+		Status:  string(health.Passing),
+		Check:   &health.CheckConfig{TTL: time.Minute},
+	}
+	kv, err := healthToKV(wr, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written WatchResult
+	if err = json.Unmarshal(kv.Value, &written); err != nil {
+		t.Fatal(err)
+	}
+	if expiry := written.Expires.Sub(written.Time); expiry != time.Minute {
+		t.Errorf("expected result to expire after its TTL, got %s", expiry)
+	}
+
+	wr.Check = nil
+	kv, err = healthToKV(wr, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(kv.Value, &written); err != nil {
+		t.Fatal(err)
+	}
+	if written.Expires.Sub(written.Time) < 365*24*time.Hour {
+		t.Errorf("expected result without a TTL not to expire, expires at %s", written.Expires)
+	}
+}
+
+func TestHealthToKVSkewedClock(t *testing.T) {
+	SetLocalClockSkewed(true)
+	defer SetLocalClockSkewed(false)
+
+	wr := WatchResult{
+		Id:      "foo",
+		Node:    "node",
+		Service: "foo",
+		Status:  string(health.Passing),
+		Check:   &health.CheckConfig{TTL: time.Minute},
+	}
+	kv, err := healthToKV(wr, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written WatchResult
+	if err = json.Unmarshal(kv.Value, &written); err != nil {
+		t.Fatal(err)
+	}
+	if !written.SkewedClock {
+		t.Fatal("expected result written with a skewed clock to be marked")
+	}
+
+	// as if the writer's clock were an hour behind
+	written.Time = written.Time.Add(-time.Hour)
+	written.Expires = written.Expires.Add(-time.Hour)
+	if written.IsStale() {
+		t.Error("result written with a skewed clock shouldn't be stale")
+	}
+	written.SkewedClock = false
+	if !written.IsStale() {
+		t.Error("expected expired result to be stale")
+	}
+}
+
+func TestNeedsRefresh(t *testing.T) {
+	withTTL := &WatchResult{Check: &health.CheckConfig{TTL: time.Minute}}
+	if needsRefresh(withTTL, time.Now()) {
+		t.Error("fresh result shouldn't need to be rewritten")
+	}
+	if !needsRefresh(withTTL, time.Now().Add(-31*time.Second)) {
+		t.Error("result past half its TTL should be rewritten")
+	}
+	if needsRefresh(&WatchResult{}, time.Now().Add(-time.Hour)) {
+		t.Error("result without a TTL shouldn't need to be rewritten")
+	}
+	if needsRefresh(nil, time.Now().Add(-time.Hour)) {
+		t.Error("missing result shouldn't need to be rewritten")
+	}
+}
+
+func TestAppendHistory(t *testing.T) {
+	size := *HealthHistorySize
+	defer func() { *HealthHistorySize = size }()
+	*HealthHistorySize = 2
+
+	start := time.Now()
+	var history []health.HistoryEntry
+	history = appendHistory(history, WatchResult{Status: string(health.Passing)}, start)
+	history = appendHistory(history, WatchResult{Status: string(health.Passing)}, start.Add(time.Second))
+	if len(history) != 1 || !history[0].Time.Equal(start) {
+		t.Fatalf("expected an unchanged status to keep the time it changed, got %+v", history)
+	}
+
+	history = appendHistory(history, WatchResult{Status: string(health.Critical), Reason: health.ReasonTimeout}, start.Add(2*time.Second))
+	history = appendHistory(history, WatchResult{Status: string(health.Passing)}, start.Add(3*time.Second))
+	if len(history) != 2 {
+		t.Fatalf("expected the history to be bounded to 2 entries, got %+v", history)
+	}
+	if history[0].Status != health.Critical || history[0].Reason != health.ReasonTimeout || !history[0].Time.Equal(start.Add(2*time.Second)) {
+		t.Errorf("expected the oldest kept entry to be when the service became critical, got %+v", history[0])
+	}
+	if history[1].Status != health.Passing {
+		t.Errorf("expected the newest entry to be the current status, got %+v", history[1])
+	}
+
+	*HealthHistorySize = 0
+	if history = appendHistory(history, WatchResult{Status: string(health.Critical)}, start); history != nil {
+		t.Errorf("expected no history to be kept, got %+v", history)
+	}
+}
+
+func TestHealthHistoryIsWritten(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	manager := f.Store.NewHealthManager("node", PreparerHealthWriter, logging.TestLogger())
+	defer manager.Close()
+	updater := manager.NewUpdater("svc", "svc")
+	defer updater.Close()
+	waiter := f.NewKeyWaiter(hKey)
+
+	if err := updater.PutHealth(h1); err != nil {
+		t.Fatal("error writing health: ", err)
+	}
+	waiter.WaitForChange()
+	if err := updater.PutHealth(h2); err != nil {
+		t.Fatal("error writing health: ", err)
+	}
+	waiter.WaitForChange()
+
+	written, err := f.Store.GetHealth("svc", "node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written.History == nil || len(written.History.Entries) != 2 {
+		t.Fatalf("expected both statuses in the history, got %+v", written.History)
+	}
+	entries := written.History.Entries
+	if entries[0].Status != health.HealthState(h1.Status) || entries[1].Status != health.HealthState(h2.Status) {
+		t.Errorf("expected the history to be in order, got %+v", entries)
+	}
+	if entries[1].Time.Before(entries[0].Time) {
+		t.Errorf("expected the history to be in order, got %+v", entries)
+	}
+}
@@ -0,0 +1,170 @@
+package consul
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+)
+
+// HealthWriter identifies a process that writes health results for a node. More than one
+// may be running on a node at a time, e.g. while health checking is being moved out of
+// the preparer. Each registers itself in Consul with its health session, and only the
+// live writer with the highest priority is authoritative: the others don't write any
+// health results until it goes away.
+type HealthWriter struct {
+	Name     string `json:"name"`
+	Priority int    `json:"priority"`
+}
+
+var (
+	// PreparerHealthWriter is the health checker embedded in the preparer
+	PreparerHealthWriter = HealthWriter{Name: "preparer", Priority: 0}
+
+	// HealthDaemonHealthWriter is a standalone health checker, which takes
+	// precedence over the preparer when both are running
+	HealthDaemonHealthWriter = HealthWriter{Name: "health-daemon", Priority: 10}
+)
+
+// HealthWriterNamed returns the known health writer with the given name, or
+// PreparerHealthWriter if the name is empty
+func HealthWriterNamed(name string) (HealthWriter, error) {
+	switch name {
+	case "", PreparerHealthWriter.Name:
+		return PreparerHealthWriter, nil
+	case HealthDaemonHealthWriter.Name:
+		return HealthDaemonHealthWriter, nil
+	default:
+		return HealthWriter{}, errors.Errorf("unknown health writer %q, expected %q or %q", name, PreparerHealthWriter.Name, HealthDaemonHealthWriter.Name)
+	}
+}
+
+// authoritativeHealthWriter returns the session of the writer that should be writing
+// health results out of the registrations under HealthWriterLockPrefix(). Registrations
+// that aren't held by a session are ignored, and ties in priority are broken by name so
+// that every writer agrees on the result.
+func authoritativeHealthWriter(pairs api.KVPairs) (HealthWriter, string, bool) {
+	var best HealthWriter
+	var bestSession string
+	found := false
+	for _, pair := range pairs {
+		if pair.Session == "" {
+			continue
+		}
+		var writer HealthWriter
+		if err := json.Unmarshal(pair.Value, &writer); err != nil {
+			continue
+		}
+		if !found ||
+			writer.Priority > best.Priority ||
+			writer.Priority == best.Priority && writer.Name < best.Name {
+			best = writer
+			bestSession = pair.Session
+			found = true
+		}
+	}
+	return best, bestSession, found
+}
+
+// fenceSessions passes sessions from the session manager on to the health updaters, but
+// only while this manager is the authoritative writer for its node. Otherwise the
+// updaters see no session, and so write nothing. Health results are always written with
+// an Acquire() under the session, so a writer whose session is gone can't overwrite the
+// results of the one that replaced it.
+func (m *consulHealthManager) fenceSessions(sessions <-chan string, out chan<- string) {
+	defer close(out)
+	consulutil.WithSession(nil, sessions, func(done <-chan struct{}, session string) {
+		m.authorize(done, session, out)
+	})
+}
+
+// authorize registers this manager as a health writer with the session, then watches
+// the registrations of every writer for the node. While this manager is authoritative,
+// the session is sent on "out".
+func (m *consulHealthManager) authorize(done <-chan struct{}, session string, out chan<- string) {
+	logger := m.logger.SubLogger(logrus.Fields{
+		"session": session,
+		"writer":  m.writer.Name,
+	})
+
+	value, err := json.Marshal(m.writer)
+	if err != nil {
+		// Practically, this should never happen.
+		logger.WithError(err).Errorln("could not serialize health writer")
+		return
+	}
+	registration := &api.KVPair{
+		Key:     HealthWriterLockPath(m.node, m.writer.Name),
+		Value:   value,
+		Session: session,
+	}
+	for {
+		ok, _, err := m.client.KV().Acquire(registration, nil)
+		if err == nil && !ok {
+			// e.g. a previous instance of this writer whose session hasn't expired yet
+			err = errors.Errorf("%s is held by another session", registration.Key)
+		}
+		if err == nil {
+			break
+		}
+		logger.WithError(err).Errorln("could not register as a health writer")
+		select {
+		case <-done:
+			return
+		case <-time.After(m.retryTime):
+		}
+	}
+
+	watchDone := make(chan struct{})
+	defer close(watchDone)
+	pairsCh := make(chan api.KVPairs)
+	errCh := make(chan error)
+	go consulutil.WatchPrefix(
+		HealthWriterLockPrefix(m.node)+"/",
+		m.client.KV(),
+		pairsCh,
+		watchDone,
+		errCh,
+		0,
+		0,
+	)
+
+	authoritative := false
+	defer func() {
+		if authoritative {
+			out <- ""
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		case err := <-errCh:
+			logger.WithError(err).Errorln("could not watch health writers")
+		case pairs := <-pairsCh:
+			writer, writerSession, ok := authoritativeHealthWriter(pairs)
+			switch {
+			case ok && writerSession == session && !authoritative:
+				logger.NoFields().Infoln("now the authoritative health writer")
+				authoritative = true
+				out <- session
+			case !authoritative && ok:
+				logger.WithField("authoritative_writer", writer.Name).Infoln("standing by for the authoritative health writer")
+			case authoritative && writerSession != session:
+				logger.WithField("authoritative_writer", writer.Name).Warnln("no longer the authoritative health writer")
+				// Destroying the session removes every health result written with it, which
+				// frees the keys for the new authoritative writer. The session manager will
+				// create a new session, with which this writer registers again as a standby.
+				_, err := m.client.Session().Destroy(session, nil)
+				if err != nil {
+					logger.WithError(err).Errorln("could not destroy health session")
+				}
+				return
+			}
+		}
+	}
+}
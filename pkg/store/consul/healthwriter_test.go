@@ -0,0 +1,170 @@
+// +build !race
+
+package consul
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/logging"
+)
+
+func writerPair(t *testing.T, writer HealthWriter, session string) *api.KVPair {
+	value, err := json.Marshal(writer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &api.KVPair{
+		Key:     HealthWriterLockPath("node", writer.Name),
+		Value:   value,
+		Session: session,
+	}
+}
+
+func TestAuthoritativeHealthWriter(t *testing.T) {
+	if _, _, ok := authoritativeHealthWriter(nil); ok {
+		t.Error("expected no authoritative writer without registrations")
+	}
+
+	pairs := api.KVPairs{
+		writerPair(t, PreparerHealthWriter, "preparer-session"),
+		writerPair(t, HealthDaemonHealthWriter, "daemon-session"),
+	}
+	writer, session, ok := authoritativeHealthWriter(pairs)
+	if !ok || writer != HealthDaemonHealthWriter || session != "daemon-session" {
+		t.Errorf("expected the health daemon to be authoritative, got %+v with session %q", writer, session)
+	}
+
+	// a registration whose session is gone doesn't count
+	pairs[1].Session = ""
+	writer, session, ok = authoritativeHealthWriter(pairs)
+	if !ok || writer != PreparerHealthWriter || session != "preparer-session" {
+		t.Errorf("expected the preparer to be authoritative, got %+v with session %q", writer, session)
+	}
+
+	// ties are broken by name
+	pairs = api.KVPairs{
+		writerPair(t, HealthWriter{Name: "b", Priority: 1}, "b-session"),
+		writerPair(t, HealthWriter{Name: "a", Priority: 1}, "a-session"),
+	}
+	writer, _, _ = authoritativeHealthWriter(pairs)
+	if writer.Name != "a" {
+		t.Errorf("expected ties to be broken by name, got %+v", writer)
+	}
+}
+
+// When a writer with a higher priority starts, the health results of the old writer are
+// replaced by its own.
+func TestHealthWriterTakeover(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	waitForWriter := func(writer string) {
+		timeout := time.After(10 * time.Second)
+		for {
+			r, err := f.Store.GetHealth("svc", "node")
+			if err == nil && r.Writer == writer && r.ValueEquiv(h1) {
+				return
+			}
+			select {
+			case <-timeout:
+				t.Fatalf("health was never written by %s, last value %#v error %v", writer, r, err)
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}
+
+	preparer := f.Store.newSessionHealthManager("node", PreparerHealthWriter, logging.TestLogger(), 100*time.Millisecond, nil)
+	defer preparer.Close()
+	preparerUpdater := preparer.NewUpdater("svc", "svc")
+	defer preparerUpdater.Close()
+	if err := preparerUpdater.PutHealth(h1); err != nil {
+		t.Fatal(err)
+	}
+	waitForWriter(PreparerHealthWriter.Name)
+
+	daemon := f.Store.newSessionHealthManager("node", HealthDaemonHealthWriter, logging.TestLogger(), 100*time.Millisecond, nil)
+	defer daemon.Close()
+	daemonUpdater := daemon.NewUpdater("svc", "svc")
+	defer daemonUpdater.Close()
+	if err := daemonUpdater.PutHealth(h1); err != nil {
+		t.Fatal(err)
+	}
+	waitForWriter(HealthDaemonHealthWriter.Name)
+
+	// The preparer keeps checking but must not take the key back
+	if err := preparerUpdater.PutHealth(h2); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	waitForWriter(HealthDaemonHealthWriter.Name)
+}
+
+func TestHealthWriterNamed(t *testing.T) {
+	for name, expected := range map[string]HealthWriter{
+		"":              PreparerHealthWriter,
+		"preparer":      PreparerHealthWriter,
+		"health-daemon": HealthDaemonHealthWriter,
+	} {
+		writer, err := HealthWriterNamed(name)
+		if err != nil || writer != expected {
+			t.Errorf("expected %q to name %+v, got %+v, %v", name, expected, writer, err)
+		}
+	}
+	if _, err := HealthWriterNamed("nobody"); err == nil {
+		t.Error("expected an unknown writer to be rejected")
+	}
+}
+
+// When the preparer starts while a writer with a higher priority is running, it stands
+// by until that writer goes away.
+func TestHealthWriterStandby(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	waitForWriter := func(writer string, res WatchResult) {
+		timeout := time.After(10 * time.Second)
+		for {
+			r, err := f.Store.GetHealth("svc", "node")
+			if err == nil && r.Writer == writer && r.ValueEquiv(res) {
+				return
+			}
+			select {
+			case <-timeout:
+				t.Fatalf("health was never written by %s, last value %#v error %v", writer, r, err)
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}
+
+	daemonWriter, err := HealthWriterNamed("health-daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	daemon := f.Store.newSessionHealthManager("node", daemonWriter, logging.TestLogger(), 100*time.Millisecond, nil)
+	daemonUpdater := daemon.NewUpdater("svc", "svc")
+	if err := daemonUpdater.PutHealth(h1); err != nil {
+		t.Fatal(err)
+	}
+	waitForWriter(HealthDaemonHealthWriter.Name, h1)
+
+	preparer := f.Store.newSessionHealthManager("node", PreparerHealthWriter, logging.TestLogger(), 100*time.Millisecond, nil)
+	defer preparer.Close()
+	preparerUpdater := preparer.NewUpdater("svc", "svc")
+	defer preparerUpdater.Close()
+	if err := preparerUpdater.PutHealth(h2); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	waitForWriter(HealthDaemonHealthWriter.Name, h1)
+
+	daemonUpdater.Close()
+	daemon.Close()
+	if err := preparerUpdater.PutHealth(h2); err != nil {
+		t.Fatal(err)
+	}
+	waitForWriter(PreparerHealthWriter.Name, h2)
+}
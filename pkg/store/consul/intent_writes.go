@@ -0,0 +1,266 @@
+package consul
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util/param"
+)
+
+// IntentConflictWindowSec is how long after a writer sets a pod's intent on a
+// node that a different writer setting it to a different manifest counts as
+// a conflicting deploy rather than a newer one
+var IntentConflictWindowSec = param.Int("intent_conflict_window_sec", 60)
+
+// IntentWrite records a write of a pod's intent on a node by SetPodChecked()
+type IntentWrite struct {
+	SHA    string `json:"sha"`
+	Writer string `json:"writer"`
+	// The consul session of the writer, if it had one
+	Session   string    `json:"session,omitempty"`
+	WrittenAt time.Time `json:"written_at"`
+
+	// The most recent write that was refused because it conflicted with
+	// this one, if any
+	Conflict *IntentWrite `json:"conflict,omitempty"`
+}
+
+// conflictsWith returns whether attempt is a different writer racing this
+// write with a different manifest
+func (w IntentWrite) conflictsWith(attempt IntentWrite) bool {
+	window := time.Duration(*IntentConflictWindowSec) * time.Second
+	return w.SHA != attempt.SHA &&
+		w.Writer != attempt.Writer &&
+		attempt.WrittenAt.Sub(w.WrittenAt) < window
+}
+
+// ConflictingDeployError is returned by SetPodChecked() when a write of a
+// pod's intent races the write of a different manifest by another writer
+type ConflictingDeployError struct {
+	Node  types.NodeName
+	PodID types.PodID
+
+	// The write that is in effect, and the one that was refused
+	Existing  IntentWrite
+	Attempted IntentWrite
+}
+
+func (e ConflictingDeployError) Error() string {
+	return fmt.Sprintf(
+		"conflicting deploys of %s on %s: %s wrote %s at %s, refusing to overwrite it with %s from %s",
+		e.PodID,
+		e.Node,
+		e.Existing.Writer,
+		e.Existing.SHA,
+		e.Existing.WrittenAt.Format(time.RFC3339),
+		e.Attempted.SHA,
+		e.Attempted.Writer,
+	)
+}
+
+// IsConflictingDeploy returns whether err is a ConflictingDeployError
+func IsConflictingDeploy(err error) bool {
+	_, ok := err.(ConflictingDeployError)
+	return ok
+}
+
+// SetPodChecked writes a pod manifest into the intent tree like SetPod(), but
+// refuses to do so if a different writer set the pod's intent on the node to
+// a different manifest within the last IntentConflictWindowSec. The refused
+// write is recorded as a conflict of the one in effect, see IntentWrite(), and
+// a ConflictingDeployError is returned. A write that races another
+// SetPodChecked() between reading and writing the intent is refused the same
+// way.
+//
+// force skips the check, e.g. for an operator resolving a conflict, but the
+// write is still recorded.
+func (c consulStore) SetPodChecked(
+	nodename types.NodeName,
+	man manifest.Manifest,
+	writer string,
+	session string,
+	force bool,
+) error {
+	if writer == "" {
+		return errors.Errorf("writer not specified when setting the intent of %s", man.ID())
+	}
+	key, err := PodPath(INTENT_TREE, nodename, man.ID())
+	if err != nil {
+		return err
+	}
+	recordKey, err := IntentWritePath(nodename, man.ID())
+	if err != nil {
+		return err
+	}
+	sha, err := man.SHA()
+	if err != nil {
+		return errors.Errorf("could not compute manifest SHA: %w", err)
+	}
+	manifestBytes, err := marshalManifest(man)
+	if err != nil {
+		return errors.Errorf("could not marshal manifest: %w", err)
+	}
+
+	intentPair, _, err := c.client.KV().Get(key, nil)
+	if err != nil {
+		return consulutil.NewKVError("get", key, err)
+	}
+	last, recordIndex, err := c.intentWrite(recordKey)
+	if err != nil {
+		return err
+	}
+
+	attempt := IntentWrite{
+		SHA:       sha,
+		Writer:    writer,
+		Session:   session,
+		WrittenAt: time.Now().UTC(),
+	}
+	var intentIndex uint64
+	if intentPair != nil {
+		intentIndex = intentPair.ModifyIndex
+	}
+
+	// The record only describes the intent if nothing else rewrote or
+	// deleted the intent since
+	if last != nil && intentPair != nil && !force {
+		intentSHA := ""
+		if intent, err := DecodeManifest(intentPair.Value); err == nil {
+			intentSHA, _ = intent.SHA()
+		}
+		if intentSHA == last.SHA && last.conflictsWith(attempt) {
+			return c.refuseIntentWrite(nodename, man.ID(), recordKey, recordIndex, *last, attempt)
+		}
+	}
+
+	recordBytes, err := json.Marshal(attempt)
+	if err != nil {
+		return errors.Errorf("could not marshal intent write: %w", err)
+	}
+	ok, resp, _, err := c.client.KV().Txn(api.KVTxnOps{
+		{Verb: api.KVCAS, Key: key, Value: manifestBytes, Index: intentIndex},
+		{Verb: api.KVCAS, Key: recordKey, Value: recordBytes, Index: recordIndex},
+	}, nil)
+	if err != nil {
+		return consulutil.NewKVError("txn", key, err)
+	}
+	if ok {
+		return nil
+	}
+	if force {
+		return errors.Codef(errors.CodeConflict, "intent of %s on %s changed while it was being written: %s", man.ID(), nodename, transaction.TxnErrorsToString(resp.Errors))
+	}
+
+	// Another writer got there first
+	last, recordIndex, err = c.intentWrite(recordKey)
+	if err != nil {
+		return err
+	}
+	if last != nil && last.SHA == attempt.SHA {
+		// it was written with the same manifest, which is fine
+		return nil
+	}
+	if last == nil {
+		return errors.Codef(errors.CodeConflict, "intent of %s on %s changed while it was being written: %s", man.ID(), nodename, transaction.TxnErrorsToString(resp.Errors))
+	}
+	return c.refuseIntentWrite(nodename, man.ID(), recordKey, recordIndex, *last, attempt)
+}
+
+// IntentWrite returns the last write of a pod's intent on a node by
+// SetPodChecked(), or nil if there was none
+func (c consulStore) IntentWrite(nodename types.NodeName, podID types.PodID) (*IntentWrite, error) {
+	recordKey, err := IntentWritePath(nodename, podID)
+	if err != nil {
+		return nil, err
+	}
+	last, _, err := c.intentWrite(recordKey)
+	return last, err
+}
+
+// IntentConflicts returns the last write of each pod's intent that has a
+// conflict recorded, by pod and node. If nodename is empty, every node is
+// included. Records that can't be parsed are skipped.
+func (c consulStore) IntentConflicts(nodename types.NodeName) (map[types.PodID]map[types.NodeName]IntentWrite, error) {
+	prefix := INTENT_WRITES_TREE + "/"
+	if nodename != "" {
+		prefix = path.Join(INTENT_WRITES_TREE, nodename.String()) + "/"
+	}
+	pairs, _, err := c.client.KV().List(prefix, nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("list", prefix, err)
+	}
+
+	conflicts := make(map[types.PodID]map[types.NodeName]IntentWrite)
+	for _, pair := range pairs {
+		var write IntentWrite
+		err := json.Unmarshal(pair.Value, &write)
+		if err != nil || write.Conflict == nil {
+			continue
+		}
+		// keys are intent_writes/<node>/<pod>
+		podID := types.PodID(path.Base(pair.Key))
+		node := types.NodeName(path.Base(path.Dir(pair.Key)))
+		if conflicts[podID] == nil {
+			conflicts[podID] = make(map[types.NodeName]IntentWrite)
+		}
+		conflicts[podID][node] = write
+	}
+	return conflicts, nil
+}
+
+func (c consulStore) intentWrite(recordKey string) (*IntentWrite, uint64, error) {
+	pair, _, err := c.client.KV().Get(recordKey, nil)
+	if err != nil {
+		return nil, 0, consulutil.NewKVError("get", recordKey, err)
+	}
+	if pair == nil {
+		return nil, 0, nil
+	}
+	var write IntentWrite
+	err = json.Unmarshal(pair.Value, &write)
+	if err != nil {
+		return nil, 0, errors.Errorf("could not parse intent write at %s: %w", recordKey, err)
+	}
+	return &write, pair.ModifyIndex, nil
+}
+
+// refuseIntentWrite records attempt as a conflict of the write in effect and
+// returns the error describing it. The conflict is recorded on a best effort
+// basis: if the record changed again in the meantime, the newer record is
+// kept.
+func (c consulStore) refuseIntentWrite(
+	nodename types.NodeName,
+	podID types.PodID,
+	recordKey string,
+	recordIndex uint64,
+	last IntentWrite,
+	attempt IntentWrite,
+) error {
+	conflictErr := ConflictingDeployError{
+		Node:      nodename,
+		PodID:     podID,
+		Existing:  last,
+		Attempted: attempt,
+	}
+
+	last.Conflict = &attempt
+	recordBytes, err := json.Marshal(last)
+	if err != nil {
+		return conflictErr
+	}
+	_, _, _ = c.client.KV().CAS(&api.KVPair{
+		Key:         recordKey,
+		Value:       recordBytes,
+		ModifyIndex: recordIndex,
+	}, nil)
+	return conflictErr
+}
@@ -0,0 +1,119 @@
+// +build !race
+
+package consul
+
+import (
+	"testing"
+)
+
+func TestSetPodCheckedRefusesConflictingDeploys(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	first := manifestWithPort(1)
+	firstSHA, _ := first.SHA()
+	err := f.Store.SetPodChecked("node1", first, "alice", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the same writer may replace its own deploy
+	second := manifestWithPort(2)
+	secondSHA, _ := second.SHA()
+	err = f.Store.SetPodChecked("node1", second, "alice", "", false)
+	if err != nil {
+		t.Fatalf("Expected alice to be able to replace her own deploy, got %s", err)
+	}
+
+	// another writer may not
+	err = f.Store.SetPodChecked("node1", first, "bob", "", false)
+	conflict, ok := err.(ConflictingDeployError)
+	if !ok {
+		t.Fatalf("Expected a ConflictingDeployError, got %v", err)
+	}
+	if conflict.Existing.Writer != "alice" || conflict.Existing.SHA != secondSHA || conflict.Attempted.SHA != firstSHA {
+		t.Errorf("Unexpected conflict %+v", conflict)
+	}
+
+	intent, _, err := f.Store.Pod(INTENT_TREE, "node1", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sha, _ := intent.SHA(); sha != secondSHA {
+		t.Errorf("Expected the intent to be left as alice wrote it")
+	}
+
+	write, err := f.Store.IntentWrite("node1", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if write == nil || write.Conflict == nil || write.Conflict.Writer != "bob" || write.Conflict.SHA != firstSHA {
+		t.Fatalf("Expected bob's deploy to be recorded as a conflict, got %+v", write)
+	}
+
+	conflicts, err := f.Store.IntentConflicts("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := conflicts["web"]["node1"]; !ok || len(conflicts) != 1 {
+		t.Errorf("Expected a conflict for web on node1, got %+v", conflicts)
+	}
+
+	// forcing the write resolves the conflict
+	err = f.Store.SetPodChecked("node1", first, "bob", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write, err = f.Store.IntentWrite("node1", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if write.Writer != "bob" || write.SHA != firstSHA || write.Conflict != nil {
+		t.Errorf("Expected bob's forced deploy to be recorded, got %+v", write)
+	}
+	conflicts, err = f.Store.IntentConflicts("node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 0 {
+		t.Errorf("Expected no conflicts after the forced deploy, got %+v", conflicts)
+	}
+}
+
+func TestSetPodCheckedAllowsDeploysOutsideTheWindow(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	window := *IntentConflictWindowSec
+	defer func() { *IntentConflictWindowSec = window }()
+	*IntentConflictWindowSec = 0
+
+	err := f.Store.SetPodChecked("node1", manifestWithPort(1), "alice", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Store.SetPodChecked("node1", manifestWithPort(2), "bob", "", false)
+	if err != nil {
+		t.Fatalf("Expected a deploy after the conflict window to succeed, got %s", err)
+	}
+}
+
+func TestSetPodCheckedIgnoresRecordsOfReplacedIntent(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	err := f.Store.SetPodChecked("node1", manifestWithPort(1), "alice", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// written without a check, so alice's record no longer describes the
+	// intent
+	_, err = f.Store.SetPod(INTENT_TREE, "node1", manifestWithPort(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Store.SetPodChecked("node1", manifestWithPort(3), "bob", "", false)
+	if err != nil {
+		t.Fatalf("Expected the write to succeed, got %s", err)
+	}
+}
@@ -3,15 +3,17 @@
 package consul
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"strings"
 	"time"
 
 	"github.com/hashicorp/consul/api"
 
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/health"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/pods"
@@ -21,17 +23,10 @@ import (
 	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
 	"github.com/square/p2/pkg/store/consul/transaction"
 	"github.com/square/p2/pkg/types"
-	"github.com/square/p2/pkg/util"
 )
 
-// Healthcheck TTL
-const (
-	TTL = 60 * time.Second
-
-	// Don't change this, it affects where status keys are read and written from
-	PreparerPodStatusNamespace statusstore.Namespace = "preparer"
-	RCStatusNamespace          statusstore.Namespace = "replication_controller"
-)
+// Healthcheck TTL, for results that don't have one of their own
+const TTL = 60 * time.Second
 
 type ManifestResult struct {
 	Manifest    manifest.Manifest
@@ -50,6 +45,12 @@ type HealthManager interface {
 
 	// Close removes all published health statuses and releases all manager resources.
 	Close()
+
+	// Shutdown waits until the updaters that have been closed have written
+	// their last health statuses and removed them, or until ctx is done,
+	// then closes the manager like Close. ctx's error is returned if it
+	// ended the wait.
+	Shutdown(ctx context.Context) error
 }
 
 // HealthUpdater allows an app's health to be updated.
@@ -59,7 +60,8 @@ type HealthUpdater interface {
 	PutHealth(health WatchResult) error
 
 	// Close removes a service's health check and releases all updater resources. Call this
-	// when no more health statuses will be published.
+	// when no more health statuses will be published. The last status that was put is
+	// written before the health check is removed, if it hasn't been already.
 	Close()
 }
 
@@ -70,21 +72,77 @@ type WatchResult struct {
 	Status  string
 	Time    time.Time
 	Expires time.Time `json:"Expires,omitempty"`
+
+	// The configuration of the check that produced this result
+	Check *health.CheckConfig `json:"Check,omitempty"`
+
+	// The name of the HealthWriter that wrote this result
+	Writer string `json:"Writer,omitempty"`
+
+	// Why the check failed, see health.Reason
+	Reason health.Reason `json:"Reason,omitempty"`
+
+	// The result of checking each address, for checks of several addresses
+	Addresses *health.AddressResults `json:"Addresses,omitempty"`
+
+	// The result of each named check, for pods with named checks
+	Checks *health.CheckResults `json:"Checks,omitempty"`
+
+	// Whether the result was checked during a blackout window, see
+	// health.Result.Suppressed
+	Suppressed bool `json:"Suppressed,omitempty"`
+
+	// The service's readiness and liveness if they differ from Status, see
+	// health.Result.Readiness
+	Readiness string `json:"Readiness,omitempty"`
+	Liveness  string `json:"Liveness,omitempty"`
+
+	// The service's recent statuses on the node, oldest first and ending
+	// with the current one, up to HealthHistorySize of them. Only results
+	// written by a HealthManager have a history. It's a pointer so that
+	// results stay comparable
+	History *health.History `json:"History,omitempty"`
+
+	// Whether the writer's clock was known to be skewed when the result was
+	// written, so Time and Expires can't be trusted. Only results written by
+	// a HealthManager are marked: they are removed when the writer's session
+	// expires, which Consul times by its own clock
+	SkewedClock bool `json:"SkewedClock,omitempty"`
+
+	// The version of the schema the result was written with, see
+	// WatchResultVersion. Zero for results written before the schema was
+	// versioned.
+	Version int `json:"Version,omitempty"`
 }
 
 // ValueEquiv returns true if the value of the WatchResult--everything except the
-// timestamps--is equivalent to another WatchResult.
+// timestamps, writer and history--is equivalent to another WatchResult.
 func (r WatchResult) ValueEquiv(s WatchResult) bool {
 	return r.Id == s.Id &&
 		r.Node == s.Node &&
 		r.Service == s.Service &&
-		r.Status == s.Status
+		r.Status == s.Status &&
+		r.Reason == s.Reason &&
+		r.Suppressed == s.Suppressed &&
+		r.Readiness == s.Readiness &&
+		r.Liveness == s.Liveness &&
+		reflect.DeepEqual(r.Addresses, s.Addresses) &&
+		reflect.DeepEqual(r.Checks, s.Checks) &&
+		r.Check.Equal(s.Check)
 }
 
 // IsStale returns true when the result is stale according to the local clock.
+// Results written with a skewed clock are never stale: they are fresh for as
+// long as they exist, since they go away with the session they were written
+// with.
 func (r WatchResult) IsStale() bool {
+	if r.SkewedClock {
+		return false
+	}
 	expires := r.Expires
-	if expires.IsZero() {
+	if expires.IsZero() && r.Check != nil && r.Check.TTL > 0 {
+		expires = r.Time.Add(r.Check.TTL)
+	} else if expires.IsZero() {
 		expires = r.Time.Add(TTL)
 	}
 	return time.Now().After(expires)
@@ -110,7 +168,7 @@ type consulStore struct {
 
 func NewConsulStore(client consulutil.ConsulClient) *consulStore {
 	statusStore := statusstore.NewConsul(client)
-	podStatusStore := podstatus.NewConsul(statusStore, PreparerPodStatusNamespace)
+	podStatusStore := podstatus.NewConsul(statusStore, statusstore.PreparerPodStatusNamespace)
 	podStore := podstore.NewConsul(client.KV())
 	return &consulStore{
 		client:         client,
@@ -125,7 +183,10 @@ func (c consulStore) PutHealth(res WatchResult) (time.Time, time.Duration, error
 	now := time.Now()
 	res.Time = now
 	res.Expires = now.Add(TTL)
-	data, err := json.Marshal(res)
+	if res.Check != nil && res.Check.TTL > 0 {
+		res.Expires = now.Add(res.Check.TTL)
+	}
+	data, err := MarshalWatchResult(res)
 	if err != nil {
 		return time.Time{}, 0, err
 	}
@@ -146,7 +207,6 @@ func (c consulStore) PutHealth(res WatchResult) (time.Time, time.Duration, error
 }
 
 func (c consulStore) GetHealth(service string, node types.NodeName) (WatchResult, error) {
-	healthRes := &WatchResult{}
 	key := HealthPath(service, node)
 	res, _, err := c.client.KV().Get(key, nil)
 	if err != nil {
@@ -154,14 +214,14 @@ func (c consulStore) GetHealth(service string, node types.NodeName) (WatchResult
 	} else if res == nil {
 		return WatchResult{}, nil
 	}
-	err = json.Unmarshal(res.Value, healthRes)
+	healthRes, err := UnmarshalWatchResult(res.Value)
 	if err != nil {
 		return WatchResult{}, consulutil.NewKVError("get", key, err)
 	}
 	if healthRes.IsStale() {
-		return *healthRes, consulutil.NewKVError("get", key, fmt.Errorf("stale health entry"))
+		return healthRes, consulutil.NewKVError("get", key, fmt.Errorf("stale health entry"))
 	}
-	return *healthRes, nil
+	return healthRes, nil
 }
 
 func (c consulStore) GetServiceHealth(service string) (map[string]WatchResult, error) {
@@ -174,13 +234,12 @@ func (c consulStore) GetServiceHealth(service string) (map[string]WatchResult, e
 		return healthRes, nil
 	}
 	for _, kvp := range res {
-		watch := &WatchResult{}
-		err = json.Unmarshal(kvp.Value, watch)
+		watch, err := UnmarshalWatchResult(kvp.Value)
 		if err != nil {
 			return healthRes, consulutil.NewKVError("get", key, err)
 		}
 		// maps key to result (eg /health/hello/nodename)
-		healthRes[kvp.Key] = *watch
+		healthRes[kvp.Key] = watch
 	}
 
 	return healthRes, nil
@@ -188,8 +247,7 @@ func (c consulStore) GetServiceHealth(service string) (map[string]WatchResult, e
 
 // SetPod writes a pod manifest into the consul key-value store.
 func (c consulStore) SetPod(podPrefix PodPrefix, nodename types.NodeName, manifest manifest.Manifest) (time.Duration, error) {
-	buf := bytes.Buffer{}
-	err := manifest.Write(&buf)
+	manifestBytes, err := marshalManifest(manifest)
 	if err != nil {
 		return 0, err
 	}
@@ -200,7 +258,7 @@ func (c consulStore) SetPod(podPrefix PodPrefix, nodename types.NodeName, manife
 	}
 	keyPair := &api.KVPair{
 		Key:   key,
-		Value: buf.Bytes(),
+		Value: manifestBytes,
 	}
 
 	writeMeta, err := c.client.KV().Put(keyPair, nil)
@@ -215,7 +273,7 @@ func (c consulStore) SetPod(podPrefix PodPrefix, nodename types.NodeName, manife
 }
 
 func (c consulStore) SetPodTxn(ctx context.Context, podPrefix PodPrefix, nodename types.NodeName, manifest manifest.Manifest) error {
-	manifestBytes, err := manifest.Marshal()
+	manifestBytes, err := marshalManifest(manifest)
 	if err != nil {
 		return err
 	}
@@ -272,30 +330,30 @@ func (c consulStore) MutatePod(
 	for _, node := range nodes {
 		path, err := PodPath(INTENT_TREE, node, podID)
 		if err != nil {
-			return util.Errorf("can't make path for %s: %s", node, err)
+			return errors.Errorf("can't make path for %s: %w", node, err)
 		}
 
 		kvp, queryMeta, err := c.client.KV().Get(path, nil)
 		if err != nil {
-			return util.Errorf("can't get %s: %s", path, err)
+			return errors.Errorf("can't get %s: %w", path, err)
 		}
 		if kvp == nil {
 			continue
 		}
 
-		manifest, err := manifest.FromBytes(kvp.Value)
+		manifest, err := DecodeManifest(kvp.Value)
 		if err != nil {
-			return util.Errorf("%s isn't a manifest: %s\n%s", path, err, string(kvp.Value))
+			return errors.Errorf("%s isn't a manifest: %s\n%s", path, err, string(kvp.Value))
 		}
 
 		mutated, err := mutate(manifest)
 		if err != nil {
-			return util.Errorf("Can't mutate %s: %s\n%s", path, err, string(kvp.Value))
+			return errors.Errorf("Can't mutate %s: %s\n%s", path, err, string(kvp.Value))
 		}
 
-		bytes, err := mutated.Marshal()
+		bytes, err := marshalManifest(mutated)
 		if err != nil {
-			return util.Errorf("can't marshal mutated %s: %s\n%s", path, err, string(kvp.Value))
+			return errors.Errorf("can't marshal mutated %s: %s\n%s", path, err, string(kvp.Value))
 		}
 
 		err = transaction.Add(ctx, api.KVTxnOp{
@@ -305,7 +363,7 @@ func (c consulStore) MutatePod(
 			Index: queryMeta.LastIndex,
 		})
 		if err != nil {
-			return util.Errorf("can't add mutated %s to transaction: %s", path, err)
+			return errors.Errorf("can't add mutated %s to transaction: %w", path, err)
 		}
 	}
 
@@ -328,10 +386,30 @@ func (c consulStore) Pod(podPrefix PodPrefix, nodename types.NodeName, podId typ
 	if kvPair == nil {
 		return nil, writeMeta.RequestTime, pods.NoCurrentManifest
 	}
-	manifest, err := manifest.FromBytes(kvPair.Value)
+	manifest, err := DecodeManifest(kvPair.Value)
 	return manifest, writeMeta.RequestTime, err
 }
 
+// ConsistentPod is like Pod, but the read is consistent: it sees every write
+// that was committed before it started, at the cost of going through the
+// consul leader.
+func (c consulStore) ConsistentPod(podPrefix PodPrefix, nodename types.NodeName, podId types.PodID) (manifest.Manifest, time.Duration, error) {
+	key, err := PodPath(podPrefix, nodename, podId)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	kvPair, queryMeta, err := c.client.KV().Get(key, &api.QueryOptions{RequireConsistent: true})
+	if err != nil {
+		return nil, 0, consulutil.NewKVError("get", key, err)
+	}
+	if kvPair == nil {
+		return nil, queryMeta.RequestTime, pods.NoCurrentManifest
+	}
+	manifest, err := DecodeManifest(kvPair.Value)
+	return manifest, queryMeta.RequestTime, err
+}
+
 // ListPods reads all the pod manifests from the key-value store for a
 // specified host under a given tree. In the event of an error, the nil slice
 // is returned.
@@ -404,7 +482,7 @@ func (c consulStore) WatchPod(
 				select {
 				case <-quitChan:
 					return
-				case errChan <- util.Errorf("Could not parse pod manifest at %s: %s. Content follows: \n%s", pair.Key, err, pair.Value):
+				case errChan <- errors.Errorf("Could not parse pod manifest at %s: %s. Content follows: \n%s", pair.Key, err, pair.Value):
 					continue
 				}
 			}
@@ -453,7 +531,7 @@ func (c consulStore) WatchPods(
 				select {
 				case <-quitChan:
 					return
-				case errChan <- util.Errorf("Could not parse pod manifest at %s: %s. Content follows: \n%s", pair.Key, err, pair.Value):
+				case errChan <- errors.Errorf("Could not parse pod manifest at %s: %s. Content follows: \n%s", pair.Key, err, pair.Value):
 				}
 			} else {
 				manifests = append(manifests, manifestResult)
@@ -487,7 +565,7 @@ func (c consulStore) WatchAllPods(
 				select {
 				case <-quitChan:
 					return
-				case errChan <- util.Errorf("Could not parse pod manifest at %s: %s. Content follows: \n%s", pair.Key, err, pair.Value):
+				case errChan <- errors.Errorf("Could not parse pod manifest at %s: %s. Content follows: \n%s", pair.Key, err, pair.Value):
 				}
 			} else {
 				manifests = append(manifests, manifestResult)
@@ -508,8 +586,15 @@ func HealthPath(service string, node types.NodeName) string {
 	return fmt.Sprintf("%s/%s/%s", "health", service, node)
 }
 
-func (c consulStore) NewHealthManager(node types.NodeName, logger logging.Logger) HealthManager {
-	return c.newSessionHealthManager(node, logger, 0)
+func (c consulStore) NewHealthManager(node types.NodeName, writer HealthWriter, logger logging.Logger) HealthManager {
+	return c.newSessionHealthManager(node, writer, logger, 0, nil)
+}
+
+// NewBatchedHealthManager is like NewHealthManager, but health results are
+// written and removed through kv, e.g. to batch the writes of every pod on
+// the node into a few transactions
+func (c consulStore) NewBatchedHealthManager(node types.NodeName, writer HealthWriter, kv ConsulKVClient, logger logging.Logger) HealthManager {
+	return c.newSessionHealthManager(node, writer, logger, 0, kv)
 }
 
 // Now both pod manifests and indexes may be present in the /intent and
@@ -522,7 +607,7 @@ func (c consulStore) manifestAndNodeFromIndex(pair *api.KVPair) (manifest.Manife
 	var podIndex podstore.PodIndex
 	err := json.Unmarshal(pair.Value, &podIndex)
 	if err != nil {
-		return nil, "", util.Errorf("Could not parse '%s' as pod index", pair.Key)
+		return nil, "", errors.Errorf("Could not parse '%s' as pod index", pair.Key)
 	}
 
 	switch {
@@ -554,7 +639,7 @@ func (c consulStore) manifestAndNodeFromIndex(pair *api.KVPair) (manifest.Manife
 		}
 		return manifest, node, nil
 	default:
-		return nil, "", util.Errorf("Cannot determine key prefix for %s, expected %s or %s", pair.Key, INTENT_TREE, REALITY_TREE)
+		return nil, "", errors.Errorf("Cannot determine key prefix for %s, expected %s or %s", pair.Key, INTENT_TREE, REALITY_TREE)
 	}
 }
 
@@ -574,7 +659,7 @@ func (c consulStore) manifestResultFromPair(pair *api.KVPair) (ManifestResult, e
 		var podIndex podstore.PodIndex
 		err := json.Unmarshal(pair.Value, &podIndex)
 		if err != nil {
-			return ManifestResult{}, util.Errorf("Could not parse '%s' as pod index", pair.Key)
+			return ManifestResult{}, errors.Errorf("Could not parse '%s' as pod index", pair.Key)
 		}
 
 		podManifest, node, err = c.manifestAndNodeFromIndex(pair)
@@ -582,7 +667,7 @@ func (c consulStore) manifestResultFromPair(pair *api.KVPair) (ManifestResult, e
 			return ManifestResult{}, err
 		}
 	} else {
-		podManifest, err = manifest.FromBytes(pair.Value)
+		podManifest, err = DecodeManifest(pair.Value)
 		if err != nil {
 			return ManifestResult{}, err
 		}
@@ -607,7 +692,7 @@ func extractNodeFromKey(key string) (types.NodeName, error) {
 	keyParts := strings.Split(key, "/")
 
 	if len(keyParts) == 0 {
-		return "", util.Errorf("Malformed key '%s'", key)
+		return "", errors.Errorf("Malformed key '%s'", key)
 	}
 
 	if keyParts[0] == "hooks" {
@@ -617,7 +702,7 @@ func extractNodeFromKey(key string) (types.NodeName, error) {
 
 	// A key should look like intent/<node>/<pod_id> OR intent/<node>/<uuid> for example
 	if len(keyParts) != 3 {
-		return "", util.Errorf("Malformed key '%s'", key)
+		return "", errors.Errorf("Malformed key '%s'", key)
 	}
 
 	return types.NodeName(keyParts[1]), nil
@@ -632,7 +717,7 @@ func extractNodeFromKey(key string) (types.NodeName, error) {
 func PodUniqueKeyFromConsulPath(consulPath string) (types.PodUniqueKey, error) {
 	keyParts := strings.Split(consulPath, "/")
 	if len(keyParts) == 0 {
-		return "", util.Errorf("Malformed key '%s'", consulPath)
+		return "", errors.Errorf("Malformed key '%s'", consulPath)
 	}
 
 	if keyParts[0] == "hooks" {
@@ -640,12 +725,17 @@ func PodUniqueKeyFromConsulPath(consulPath string) (types.PodUniqueKey, error) {
 	}
 
 	if len(keyParts) != 3 {
-		return "", util.Errorf("Malformed key '%s'", consulPath)
+		return "", errors.Errorf("Malformed key '%s'", consulPath)
+	}
+
+	// prefetch requests are always legacy manifests
+	if keyParts[0] == "prefetch" {
+		return "", nil
 	}
 
 	// Unforunately we can't use consul.INTENT_TREE and consul.REALITY_TREE here because of an import cycle
 	if keyParts[0] != "intent" && keyParts[0] != "reality" {
-		return "", util.Errorf("Unrecognized key tree '%s' (must be intent or reality)", keyParts[0])
+		return "", errors.Errorf("Unrecognized key tree '%s' (must be intent or reality)", keyParts[0])
 	}
 
 	// Parse() returns nil if the input string does not match the uuid spec
@@ -655,7 +745,7 @@ func PodUniqueKeyFromConsulPath(consulPath string) (types.PodUniqueKey, error) {
 		// this is okay, it's just a legacy pod
 		podUniqueKey = ""
 	case err != nil:
-		return "", util.Errorf("Could not test whether %s is a valid pod unique key: %s", keyParts[2], err)
+		return "", errors.Errorf("Could not test whether %s is a valid pod unique key: %w", keyParts[2], err)
 	}
 
 	return podUniqueKey, nil
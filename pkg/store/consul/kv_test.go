@@ -216,7 +216,7 @@ func TestAllPods(t *testing.T) {
 
 	// we can't use store.podStatusStore here because we use functions for
 	// test purposes that are not on the PodStatusStore interface
-	podStatusStore := podstatus.NewConsul(statusstore.NewConsul(fakeConsulClient), PreparerPodStatusNamespace)
+	podStatusStore := podstatus.NewConsul(statusstore.NewConsul(fakeConsulClient), statusstore.PreparerPodStatusNamespace)
 	store := NewConsulStore(fakeConsulClient)
 
 	// Add a new uuid pod (i.e. we expect an index rather than a manifest to be written to /intent)
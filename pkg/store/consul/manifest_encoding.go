@@ -0,0 +1,152 @@
+package consul
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/util/param"
+)
+
+// How pod manifests are serialized in the intent and reality trees. Every
+// store reads all of the encodings, but older ones only read "yaml", so
+// switching to another encoding must wait until every reader of the trees,
+// including all the preparers, has been upgraded.
+var ManifestEncodingParam = param.String("manifest_encoding", string(ManifestEncodingYAML))
+
+type ManifestEncoding string
+
+const (
+	// Manifests are written as they were given: as the original YAML
+	// document, or the clearsigned document if they were signed
+	ManifestEncodingYAML ManifestEncoding = "yaml"
+
+	// Manifests are written in canonical form, the YAML their SHA is
+	// computed from, so that formatting differences between equivalent
+	// manifests don't show up as changes to the key. Signed manifests also
+	// keep their original clearsigned document, so their signatures can
+	// still be verified
+	ManifestEncodingCanonical ManifestEncoding = "canonical"
+
+	// Like ManifestEncodingCanonical, but gzip compressed
+	ManifestEncodingCanonicalGzip ManifestEncoding = "canonical+gzip"
+)
+
+// The encodings other than YAML start with a header naming them, which is a
+// YAML directive that no manifest starts with.
+var (
+	canonicalManifestHeader     = []byte("%p2-manifest canonical\n")
+	canonicalGzipManifestHeader = []byte("%p2-manifest canonical+gzip\n")
+)
+
+// canonicalManifest is how canonically encoded manifests are stored
+type canonicalManifest struct {
+	Manifest string `json:"manifest"`
+
+	// The original clearsigned document of a signed manifest
+	Signed string `json:"signed,omitempty"`
+}
+
+// EncodeManifest serializes a manifest for the intent or reality tree
+func EncodeManifest(man manifest.Manifest, encoding ManifestEncoding) ([]byte, error) {
+	switch encoding {
+	case ManifestEncodingYAML:
+		return man.Marshal()
+	case ManifestEncodingCanonical, ManifestEncodingCanonicalGzip:
+	default:
+		return nil, errors.Errorf("unknown manifest encoding %q", encoding)
+	}
+
+	// the builder drops the original document and signature
+	canonical, err := man.GetBuilder().GetManifest().Marshal()
+	if err != nil {
+		return nil, errors.Errorf("could not marshal canonical manifest: %w", err)
+	}
+	stored := canonicalManifest{Manifest: string(canonical)}
+	if _, signature := man.SignatureData(); signature != nil {
+		signed, err := man.Marshal()
+		if err != nil {
+			return nil, errors.Errorf("could not marshal signed manifest: %w", err)
+		}
+		stored.Signed = string(signed)
+	}
+	body, err := json.Marshal(stored)
+	if err != nil {
+		return nil, errors.Errorf("could not marshal canonical manifest: %w", err)
+	}
+
+	if encoding == ManifestEncodingCanonical {
+		return append(append([]byte{}, canonicalManifestHeader...), body...), nil
+	}
+	buf := bytes.NewBuffer(append([]byte{}, canonicalGzipManifestHeader...))
+	gz := gzip.NewWriter(buf)
+	if _, err = gz.Write(body); err != nil {
+		return nil, errors.Errorf("could not compress manifest: %w", err)
+	}
+	if err = gz.Close(); err != nil {
+		return nil, errors.Errorf("could not compress manifest: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeManifest parses a manifest read from the intent or reality tree,
+// whichever encoding it was written with
+func DecodeManifest(data []byte) (manifest.Manifest, error) {
+	switch {
+	case bytes.HasPrefix(data, canonicalGzipManifestHeader):
+		gz, err := gzip.NewReader(bytes.NewReader(data[len(canonicalGzipManifestHeader):]))
+		if err != nil {
+			return nil, errors.Errorf("could not decompress manifest: %w", err)
+		}
+		body, err := ioutil.ReadAll(gz)
+		if err != nil {
+			return nil, errors.Errorf("could not decompress manifest: %w", err)
+		}
+		return decodeCanonicalManifest(body)
+	case bytes.HasPrefix(data, canonicalManifestHeader):
+		return decodeCanonicalManifest(data[len(canonicalManifestHeader):])
+	default:
+		return manifest.FromBytes(data)
+	}
+}
+
+func decodeCanonicalManifest(body []byte) (manifest.Manifest, error) {
+	var stored canonicalManifest
+	if err := json.Unmarshal(body, &stored); err != nil {
+		return nil, errors.Errorf("could not unmarshal canonical manifest: %w", err)
+	}
+	canonical, err := manifest.FromBytes([]byte(stored.Manifest))
+	if err != nil {
+		return nil, err
+	}
+	if stored.Signed == "" {
+		return canonical, nil
+	}
+
+	// the signed document is what the signature covers, so it's what's
+	// returned, as long as it's the manifest that was written
+	signed, err := manifest.FromBytes([]byte(stored.Signed))
+	if err != nil {
+		return nil, err
+	}
+	canonicalSHA, err := canonical.SHA()
+	if err != nil {
+		return nil, err
+	}
+	signedSHA, err := signed.SHA()
+	if err != nil {
+		return nil, err
+	}
+	if canonicalSHA != signedSHA {
+		return nil, errors.Errorf("signed manifest %s doesn't match its canonical form %s", signedSHA, canonicalSHA)
+	}
+	return signed, nil
+}
+
+// marshalManifest serializes a manifest with the configured encoding
+func marshalManifest(man manifest.Manifest) ([]byte, error) {
+	return EncodeManifest(man, ManifestEncoding(*ManifestEncodingParam))
+}
@@ -0,0 +1,153 @@
+// +build !race
+
+package consul
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+
+	"github.com/square/p2/pkg/manifest"
+)
+
+var manifestEncodings = []ManifestEncoding{
+	ManifestEncodingYAML,
+	ManifestEncodingCanonical,
+	ManifestEncodingCanonicalGzip,
+}
+
+func signedManifest(t *testing.T, source string) (manifest.Manifest, *openpgp.Entity) {
+	signer, err := openpgp.NewEntity("p2", "", "p2@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w, err := clearsign.Encode(&buf, signer.PrivateKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte(source))
+	w.Close()
+
+	man, err := manifest.FromBytes(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return man, signer
+}
+
+func TestManifestEncodingsRoundTrip(t *testing.T) {
+	man := manifestWithPort(8080)
+	sha, _ := man.SHA()
+	for _, encoding := range manifestEncodings {
+		data, err := EncodeManifest(man, encoding)
+		if err != nil {
+			t.Fatalf("%s: %s", encoding, err)
+		}
+		decoded, err := DecodeManifest(data)
+		if err != nil {
+			t.Fatalf("%s: %s", encoding, err)
+		}
+		if decodedSHA, _ := decoded.SHA(); decodedSHA != sha {
+			t.Errorf("%s: expected the decoded manifest to be the one encoded", encoding)
+		}
+	}
+
+	if _, err := EncodeManifest(man, "xml"); err == nil {
+		t.Errorf("Expected an unknown encoding to be an error")
+	}
+}
+
+func TestCanonicalManifestEncodingIsStable(t *testing.T) {
+	first, err := manifest.FromBytes([]byte("id: web\nstatus_port: 8080\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := manifest.FromBytes([]byte("# the web pod\nstatus_port:   8080\nid: web\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, encoding := range []ManifestEncoding{ManifestEncodingCanonical, ManifestEncodingCanonicalGzip} {
+		firstData, err := EncodeManifest(first, encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		secondData, err := EncodeManifest(second, encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(firstData, secondData) {
+			t.Errorf("%s: expected equivalent manifests to be encoded the same way", encoding)
+		}
+	}
+}
+
+func TestCanonicalManifestEncodingKeepsSignature(t *testing.T) {
+	man, signer := signedManifest(t, "id: web\nstatus_port: 8080\n")
+	keyring := openpgp.EntityList{signer}
+
+	for _, encoding := range manifestEncodings {
+		data, err := EncodeManifest(man, encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := DecodeManifest(data)
+		if err != nil {
+			t.Fatalf("%s: %s", encoding, err)
+		}
+		plaintext, signature := decoded.SignatureData()
+		if signature == nil {
+			t.Fatalf("%s: expected the decoded manifest to be signed", encoding)
+		}
+		_, err = openpgp.CheckDetachedSignature(keyring, bytes.NewReader(plaintext), bytes.NewReader(signature))
+		if err != nil {
+			t.Errorf("%s: expected the signature to verify, got %s", encoding, err)
+		}
+	}
+
+	// the signed document must be the manifest that was written
+	data, err := EncodeManifest(man, ManifestEncodingCanonical)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(string(data), "status_port: 8080", "status_port: 9090", 1)
+	if _, err = DecodeManifest([]byte(tampered)); err == nil {
+		t.Errorf("Expected a canonical form that doesn't match the signed manifest to be an error")
+	}
+}
+
+func TestPodsReadWhateverTheirEncoding(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	saved := *ManifestEncodingParam
+	defer func() { *ManifestEncodingParam = saved }()
+
+	for i, encoding := range manifestEncodings {
+		*ManifestEncodingParam = string(encoding)
+		man := manifestWithPort(i + 1)
+		_, err := f.Store.SetPod(INTENT_TREE, "node1", man)
+		if err != nil {
+			t.Fatalf("%s: %s", encoding, err)
+		}
+
+		pod, _, err := f.Store.Pod(INTENT_TREE, "node1", man.ID())
+		if err != nil {
+			t.Fatalf("%s: %s", encoding, err)
+		}
+		if pod.GetStatusPort() != i+1 {
+			t.Errorf("%s: expected to read the manifest that was written", encoding)
+		}
+		results, _, err := f.Store.ListPods(INTENT_TREE, "node1")
+		if err != nil {
+			t.Fatalf("%s: %s", encoding, err)
+		}
+		if len(results) != 1 || results[0].Manifest.GetStatusPort() != i+1 {
+			t.Errorf("%s: expected to list the manifest that was written", encoding)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package consul
+
+import (
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+)
+
+// ManifestHistoryEntry is a manifest that was deployed for a pod on a node
+type ManifestHistoryEntry struct {
+	SHA        string
+	DeployedAt time.Time
+	Manifest   manifest.Manifest
+}
+
+type rawManifestHistoryEntry struct {
+	DeployedAt time.Time `json:"deployed_at"`
+	Manifest   string    `json:"manifest"`
+}
+
+// RecordManifest adds man to the history of the manifests deployed for its
+// pod on node, and drops all but the keep most recently deployed ones.
+// Entries are keyed by the manifest's SHA, so deploying a manifest again only
+// updates when it was deployed.
+func (c consulStore) RecordManifest(node types.NodeName, man manifest.Manifest, keep int) error {
+	if keep < 1 {
+		return errors.Errorf("must keep at least one manifest, got %d", keep)
+	}
+	prefix, err := ManifestHistoryPath(node, man.ID())
+	if err != nil {
+		return err
+	}
+	sha, err := man.SHA()
+	if err != nil {
+		return errors.Errorf("could not compute manifest SHA: %w", err)
+	}
+	manifestBytes, err := man.Marshal()
+	if err != nil {
+		return errors.Errorf("could not marshal manifest: %w", err)
+	}
+	data, err := json.Marshal(rawManifestHistoryEntry{
+		DeployedAt: time.Now().UTC(),
+		Manifest:   string(manifestBytes),
+	})
+	if err != nil {
+		return errors.Errorf("could not marshal manifest history entry: %w", err)
+	}
+
+	key := path.Join(prefix, sha)
+	_, err = c.client.KV().Put(&api.KVPair{Key: key, Value: data}, nil)
+	if err != nil {
+		return consulutil.NewKVError("put", key, err)
+	}
+
+	history, err := c.ManifestHistory(node, man.ID())
+	if err != nil {
+		return err
+	}
+	if len(history) <= keep {
+		return nil
+	}
+	for _, entry := range history[keep:] {
+		key := path.Join(prefix, entry.SHA)
+		_, err = c.client.KV().Delete(key, nil)
+		if err != nil {
+			return consulutil.NewKVError("delete", key, err)
+		}
+	}
+	return nil
+}
+
+// ManifestHistory returns the manifests recently deployed for a pod on node,
+// most recently deployed first. Entries that can't be parsed are skipped.
+func (c consulStore) ManifestHistory(node types.NodeName, podID types.PodID) ([]ManifestHistoryEntry, error) {
+	prefix, err := ManifestHistoryPath(node, podID)
+	if err != nil {
+		return nil, err
+	}
+	pairs, _, err := c.client.KV().List(prefix+"/", nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("list", prefix, err)
+	}
+
+	var history []ManifestHistoryEntry
+	for _, pair := range pairs {
+		var raw rawManifestHistoryEntry
+		err := json.Unmarshal(pair.Value, &raw)
+		if err != nil {
+			continue
+		}
+		man, err := manifest.FromBytes([]byte(raw.Manifest))
+		if err != nil {
+			continue
+		}
+		history = append(history, ManifestHistoryEntry{
+			SHA:        path.Base(pair.Key),
+			DeployedAt: raw.DeployedAt,
+			Manifest:   man,
+		})
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].DeployedAt.After(history[j].DeployedAt)
+	})
+	return history, nil
+}
+
+// RollbackTarget finds the entry of history to roll back to. to is either
+// "previous", for the manifest deployed before the current one, or the SHA of
+// a manifest in the history. Abbreviated SHAs are accepted if they are
+// unambiguous.
+func RollbackTarget(history []ManifestHistoryEntry, to string) (ManifestHistoryEntry, error) {
+	if to == "previous" {
+		if len(history) < 2 {
+			return ManifestHistoryEntry{}, errors.Errorf("no manifest was deployed before the current one")
+		}
+		return history[1], nil
+	}
+
+	var matches []ManifestHistoryEntry
+	for _, entry := range history {
+		if strings.HasPrefix(entry.SHA, to) {
+			matches = append(matches, entry)
+		}
+	}
+	switch {
+	case to == "" || len(matches) == 0:
+		return ManifestHistoryEntry{}, errors.Errorf("no manifest with SHA %q in the history", to)
+	case len(matches) > 1:
+		return ManifestHistoryEntry{}, errors.Errorf("SHA %q matches %d manifests in the history", to, len(matches))
+	}
+	return matches[0], nil
+}
@@ -0,0 +1,84 @@
+// +build !race
+
+package consul
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/manifest"
+)
+
+func manifestWithPort(port int) manifest.Manifest {
+	builder := testManifest("web").GetBuilder()
+	builder.SetStatusPort(port)
+	return builder.GetManifest()
+}
+
+func TestManifestHistoryKeepsRecentManifests(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	var shas []string
+	for _, port := range []int{1, 2, 3} {
+		man := manifestWithPort(port)
+		sha, _ := man.SHA()
+		shas = append(shas, sha)
+		err := f.Store.RecordManifest("node1", man, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// entries are ordered by the time they were recorded
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	history, err := f.Store.ManifestHistory("node1", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].SHA != shas[2] || history[1].SHA != shas[1] {
+		t.Fatalf("Expected the two most recent manifests, newest first, got %+v", history)
+	}
+	if history[1].Manifest.GetStatusPort() != 2 {
+		t.Errorf("Expected the manifest to be kept intact, got status port %d", history[1].Manifest.GetStatusPort())
+	}
+
+	// deploying a manifest again makes it the most recent one
+	err = f.Store.RecordManifest("node1", manifestWithPort(2), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err = f.Store.ManifestHistory("node1", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].SHA != shas[1] || history[1].SHA != shas[2] {
+		t.Errorf("Expected the redeployed manifest to be the most recent, got %+v", history)
+	}
+}
+
+func TestRollbackTarget(t *testing.T) {
+	history := []ManifestHistoryEntry{
+		{SHA: "abc123"},
+		{SHA: "abd456"},
+		{SHA: "def789"},
+	}
+
+	target, err := RollbackTarget(history, "previous")
+	if err != nil || target.SHA != "abd456" {
+		t.Errorf("Expected the previous manifest to be abd456, got %+v, %v", target, err)
+	}
+	target, err = RollbackTarget(history, "def")
+	if err != nil || target.SHA != "def789" {
+		t.Errorf("Expected an abbreviated SHA to be found, got %+v, %v", target, err)
+	}
+	if _, err = RollbackTarget(history, "ab"); err == nil {
+		t.Error("Expected an ambiguous SHA to be refused")
+	}
+	if _, err = RollbackTarget(history, "fff"); err == nil {
+		t.Error("Expected an unknown SHA to be refused")
+	}
+	if _, err = RollbackTarget(history[:1], "previous"); err == nil {
+		t.Error("Expected no previous manifest with a single entry")
+	}
+}
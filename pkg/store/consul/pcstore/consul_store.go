@@ -2,7 +2,6 @@ package pcstore
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"path"
 	"time"
@@ -14,6 +13,7 @@ import (
 	klabels "k8s.io/kubernetes/pkg/labels"
 	"k8s.io/kubernetes/pkg/util/sets"
 
+	"github.com/square/p2/pkg/errors"
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/pc/fields"
@@ -21,7 +21,6 @@ import (
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/types"
-	"github.com/square/p2/pkg/util"
 )
 
 const podClusterTree string = "pod_clusters"
@@ -136,7 +135,7 @@ func (s *ConsulStore) Create(
 
 	existing, err := s.FindWhereLabeled(podID, availabilityZone, clusterName)
 	if err != nil {
-		return fields.PodCluster{}, util.Errorf("Couldn't determine if pod cluster exists already: %v", err)
+		return fields.PodCluster{}, errors.Errorf("Couldn't determine if pod cluster exists already: %w", err)
 	}
 	if len(existing) > 0 {
 		return existing[0], PodClusterAlreadyExists
@@ -160,7 +159,7 @@ func (s *ConsulStore) Create(
 	jsonPC, err := json.Marshal(pc)
 	if err != nil {
 		// Probably the annotations don't marshal to JSON
-		return fields.PodCluster{}, util.Errorf("Unable to marshal pod cluster as JSON: %s", err)
+		return fields.PodCluster{}, errors.Errorf("Unable to marshal pod cluster as JSON: %w", err)
 	}
 
 	// the chance of the UUID already existing is vanishingly small, but
@@ -176,7 +175,7 @@ func (s *ConsulStore) Create(
 	}
 
 	if !success {
-		return fields.PodCluster{}, util.Errorf("Could not set pod cluster at path '%s'", key)
+		return fields.PodCluster{}, errors.Errorf("Could not set pod cluster at path '%s'", key)
 	}
 
 	err = s.setLabelsForPC(pc)
@@ -184,7 +183,7 @@ func (s *ConsulStore) Create(
 		// TODO: what if this delete fails?
 		deleteErr := s.Delete(pc.ID)
 		if deleteErr != nil {
-			err = util.Errorf("%s\n%s", err, deleteErr)
+			err = errors.Errorf("%s\n%s", err, deleteErr)
 		}
 		return fields.PodCluster{}, err
 	}
@@ -277,7 +276,7 @@ func (s *ConsulStore) MutatePC(
 	jsonPC, err := json.Marshal(pc)
 	if err != nil {
 		// Probably the annotations don't marshal to JSON
-		return fields.PodCluster{}, util.Errorf("Unable to marshal pod cluster as JSON: %s", err)
+		return fields.PodCluster{}, errors.Errorf("Unable to marshal pod cluster as JSON: %w", err)
 	}
 
 	// the chance of the UUID already existing is vanishingly small, but
@@ -294,7 +293,7 @@ func (s *ConsulStore) MutatePC(
 	}
 
 	if !success {
-		return fields.PodCluster{}, util.Errorf("Could not set pod cluster at path '%s'", pcp)
+		return fields.PodCluster{}, errors.Errorf("Could not set pod cluster at path '%s'", pcp)
 	}
 
 	return pc, nil
@@ -302,7 +301,7 @@ func (s *ConsulStore) MutatePC(
 
 func pcPath(pcID fields.ID) (string, error) {
 	if pcID == "" {
-		return "", util.Errorf("Path requested for empty pod cluster ID")
+		return "", errors.Codef(errors.CodeInvalid, "Path requested for empty pod cluster ID")
 	}
 
 	return path.Join(podClusterTree, pcID.String()), nil
@@ -775,7 +774,7 @@ func kvpToPC(pair *api.KVPair) (fields.PodCluster, error) {
 	pc := fields.PodCluster{}
 	err := json.Unmarshal(pair.Value, &pc)
 	if err != nil {
-		return pc, util.Errorf("Could not unmarshal pod cluster ('%s') as json: %s", string(pair.Value), err)
+		return pc, errors.Errorf("Could not unmarshal pod cluster ('%s') as json: %w", string(pair.Value), err)
 	}
 
 	return pc, nil
@@ -0,0 +1,120 @@
+package consul
+
+import (
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+)
+
+// PodChanges attributes the difference between two reads of a pod tree to
+// the keys that changed
+type PodChanges struct {
+	Created []ManifestResult
+	Updated []ManifestResult
+	// Deleted holds the last manifest seen at each deleted key
+	Deleted []ManifestResult
+
+	// Current holds every pod in the tree, after the changes
+	Current []ManifestResult
+}
+
+// Empty returns whether nothing changed
+func (c PodChanges) Empty() bool {
+	return len(c.Created) == 0 && len(c.Updated) == 0 && len(c.Deleted) == 0
+}
+
+// WatchPodChanges is like WatchPods, but also reports which pods were
+// created, updated or deleted since the last read. Keys are compared by their
+// modify index, so a key that is rewritten with the same manifest counts as
+// updated but the manifests themselves are never compared. The first read
+// reports every pod as created.
+//
+// If nodename is empty the entire tree is watched. As with WatchPods, a
+// PodChanges is emitted every time the watch returns, even if it is Empty().
+//
+// For pods with a uuid, only the index in the tree is watched. Changes to the
+// pod itself in the pod store are not reported.
+func (c consulStore) WatchPodChanges(
+	podPrefix PodPrefix,
+	nodename types.NodeName,
+	quitChan <-chan struct{},
+	errChan chan<- error,
+	changesChan chan<- PodChanges,
+) {
+	defer close(changesChan)
+
+	keyPrefix := podPrefix.String() + "/"
+	if nodename != "" || podPrefix == HOOK_TREE {
+		var err error
+		keyPrefix, err = nodePath(podPrefix, nodename)
+		if err != nil {
+			select {
+			case <-quitChan:
+			case errChan <- err:
+			}
+			return
+		}
+	}
+
+	type seenPod struct {
+		modifyIndex uint64
+		result      ManifestResult
+	}
+	seen := make(map[string]seenPod)
+
+	kvPairsChan := make(chan api.KVPairs)
+	go consulutil.WatchPrefix(keyPrefix, c.client.KV(), kvPairsChan, quitChan, errChan, 0, 1*time.Minute)
+	for kvPairs := range kvPairsChan {
+		var changes PodChanges
+		current := make(map[string]seenPod, len(kvPairs))
+		for _, pair := range kvPairs {
+			previous, ok := seen[pair.Key]
+			if ok && previous.modifyIndex == pair.ModifyIndex {
+				current[pair.Key] = previous
+				changes.Current = append(changes.Current, previous.result)
+				continue
+			}
+
+			result, err := c.manifestResultFromPair(pair)
+			if err != nil {
+				select {
+				case <-quitChan:
+					return
+				case errChan <- errors.Errorf("Could not parse pod manifest at %s: %s. Content follows: \n%s", pair.Key, err, pair.Value):
+				}
+				// a pod whose manifest can no longer be read hasn't
+				// been deleted, keep reporting what was last read
+				if ok {
+					current[pair.Key] = previous
+					changes.Current = append(changes.Current, previous.result)
+				}
+				continue
+			}
+
+			current[pair.Key] = seenPod{modifyIndex: pair.ModifyIndex, result: result}
+			changes.Current = append(changes.Current, result)
+			if ok {
+				changes.Updated = append(changes.Updated, result)
+			} else {
+				changes.Created = append(changes.Created, result)
+			}
+		}
+
+		for key, previous := range seen {
+			if _, ok := current[key]; !ok {
+				changes.Deleted = append(changes.Deleted, previous.result)
+			}
+		}
+		seen = current
+
+		select {
+		case <-quitChan:
+			return
+		case changesChan <- changes:
+		}
+	}
+}
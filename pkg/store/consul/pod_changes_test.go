@@ -0,0 +1,82 @@
+// +build !race
+
+package consul
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/types"
+)
+
+func nextPodChanges(t *testing.T, changesChan <-chan PodChanges, errChan <-chan error) PodChanges {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case changes := <-changesChan:
+			if !changes.Empty() {
+				return changes
+			}
+		case err := <-errChan:
+			t.Fatalf("Unexpected error watching pod changes: %s", err)
+		case <-timeout:
+			t.Fatal("Timed out waiting for pod changes")
+		}
+	}
+}
+
+func podIDs(results []ManifestResult) map[types.PodID]types.NodeName {
+	ids := make(map[types.PodID]types.NodeName)
+	for _, result := range results {
+		ids[result.Manifest.ID()] = result.PodLocation.Node
+	}
+	return ids
+}
+
+func TestWatchPodChangesAttributesChangesToKeys(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	for node, podID := range map[types.NodeName]types.PodID{"node1": "first_pod", "node2": "second_pod"} {
+		_, err := f.Store.SetPod(INTENT_TREE, node, testManifest(podID))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	quit := make(chan struct{})
+	defer close(quit)
+	errChan := make(chan error)
+	changesChan := make(chan PodChanges)
+	go f.Store.WatchPodChanges(INTENT_TREE, "", quit, errChan, changesChan)
+
+	changes := nextPodChanges(t, changesChan, errChan)
+	if created := podIDs(changes.Created); len(created) != 2 || created["first_pod"] != "node1" || created["second_pod"] != "node2" {
+		t.Errorf("Expected both pods to be created on the first read, got %+v", created)
+	}
+	if len(changes.Current) != 2 {
+		t.Errorf("Expected both pods to be current, got %d", len(changes.Current))
+	}
+
+	// rewriting a key counts as an update even if the manifest is the same
+	_, err := f.Store.SetPod(INTENT_TREE, "node1", testManifest("first_pod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes = nextPodChanges(t, changesChan, errChan)
+	if updated := podIDs(changes.Updated); len(updated) != 1 || len(changes.Created) != 0 || len(changes.Deleted) != 0 || updated["first_pod"] != "node1" {
+		t.Errorf("Expected only first_pod to be updated, got %+v", changes)
+	}
+
+	_, err = f.Store.DeletePod(INTENT_TREE, "node2", "second_pod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes = nextPodChanges(t, changesChan, errChan)
+	if deleted := podIDs(changes.Deleted); len(deleted) != 1 || len(changes.Updated) != 0 || deleted["second_pod"] != "node2" {
+		t.Errorf("Expected only second_pod to be deleted, got %+v", changes)
+	}
+	if current := podIDs(changes.Current); len(current) != 1 || current["first_pod"] != "node1" {
+		t.Errorf("Expected only first_pod to remain, got %+v", current)
+	}
+}
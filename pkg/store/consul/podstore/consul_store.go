@@ -7,11 +7,11 @@ import (
 	"path"
 	"sync"
 
+	"github.com/square/p2/pkg/errors"
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/transaction"
 	"github.com/square/p2/pkg/types"
-	"github.com/square/p2/pkg/util"
 
 	"github.com/hashicorp/consul/api"
 )
@@ -160,7 +160,7 @@ func (c *consulStore) Schedule(manifest manifest.Manifest, node types.NodeName)
 
 	indexBytes, err := json.Marshal(index)
 	if err != nil {
-		return "", util.Errorf("Could not marshal index as json: %s", err)
+		return "", errors.Errorf("Could not marshal index as json: %w", err)
 	}
 
 	indexPair := &api.KVPair{
@@ -177,7 +177,7 @@ func (c *consulStore) Schedule(manifest manifest.Manifest, node types.NodeName)
 
 func (c *consulStore) Unschedule(podKey types.PodUniqueKey) error {
 	if podKey == "" {
-		return util.Errorf("Pod store can only delete pods with uuid keys")
+		return errors.Errorf("Pod store can only delete pods with uuid keys")
 	}
 
 	// Read the pod so we know which node the secondary index will have
@@ -220,7 +220,7 @@ func (c *consulStore) Unschedule(podKey types.PodUniqueKey) error {
 // launched on the given node.
 func (c *consulStore) WriteRealityIndex(ctx context.Context, podKey types.PodUniqueKey, node types.NodeName) error {
 	if podKey == "" {
-		return util.Errorf("Pod store can only write index for pods with uuid keys")
+		return errors.Errorf("Pod store can only write index for pods with uuid keys")
 	}
 
 	realityIndexPath := computeRealityIndexPath(podKey, node)
@@ -232,7 +232,7 @@ func (c *consulStore) WriteRealityIndex(ctx context.Context, podKey types.PodUni
 
 	indexBytes, err := json.Marshal(index)
 	if err != nil {
-		return util.Errorf("Could not marshal index as json: %s", err)
+		return errors.Errorf("Could not marshal index as json: %w", err)
 	}
 
 	return transaction.Add(ctx, api.KVTxnOp{
@@ -290,7 +290,7 @@ func IsNoPod(err error) bool {
 
 func (c *consulStore) ReadPod(podKey types.PodUniqueKey) (Pod, error) {
 	if podKey == "" {
-		return Pod{}, util.Errorf("Pod store can only read pods with uuid keys")
+		return Pod{}, errors.Errorf("Pod store can only read pods with uuid keys")
 	}
 
 	if pod, ok := c.fetchFromCache(podKey); ok {
@@ -311,7 +311,7 @@ func (c *consulStore) ReadPod(podKey types.PodUniqueKey) (Pod, error) {
 	var pod Pod
 	err = json.Unmarshal(pair.Value, &pod)
 	if err != nil {
-		return Pod{}, util.Errorf("Could not unmarshal pod '%s' as json: %s", podKey, err)
+		return Pod{}, errors.Errorf("Could not unmarshal pod '%s' as json: %w", podKey, err)
 	}
 
 	c.addToCache(podKey, pod)
@@ -1,9 +1,9 @@
 package podstoretest
 
 import (
+	"github.com/square/p2/pkg/errors"
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/types"
-	"github.com/square/p2/pkg/util"
 )
 
 // FailingPodStore partially implements the pkg/store/consul/podstore.Store
@@ -18,9 +18,9 @@ func NewFailingPodStore() FailingPodStore {
 }
 
 func (FailingPodStore) Schedule(manifest.Manifest, types.NodeName) (types.PodUniqueKey, error) {
-	return "", util.Errorf("failing pod store failed to schedule pod")
+	return "", errors.Errorf("failing pod store failed to schedule pod")
 }
 
 func (FailingPodStore) Unschedule(types.PodUniqueKey) error {
-	return util.Errorf("failing pod store failed to unschedule pod")
+	return errors.Errorf("failing pod store failed to unschedule pod")
 }
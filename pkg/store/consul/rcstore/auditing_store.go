@@ -0,0 +1,215 @@
+package rcstore
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/manifest"
+	pc_fields "github.com/square/p2/pkg/pc/fields"
+	"github.com/square/p2/pkg/rc/fields"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+type AuditLogStore interface {
+	Create(ctx context.Context, eventType audit.EventType, eventDetails json.RawMessage) error
+}
+
+func NewAuditingStore(innerStore *ConsulStore, auditLogStore AuditLogStore) AuditingStore {
+	return AuditingStore{
+		innerStore:    innerStore,
+		auditLogStore: auditLogStore,
+	}
+}
+
+// AuditingStore is a wrapper around a ConsulStore that will produce audit logs
+// for every mutation of a replication controller. Each audit log record holds
+// the replication controller before and after the mutation, the user who
+// requested it and the interface it was requested through. The mutation and
+// its audit log record are added to the transaction in ctx, which the caller
+// must commit.
+type AuditingStore struct {
+	innerStore    *ConsulStore
+	auditLogStore AuditLogStore
+}
+
+func (a AuditingStore) Create(
+	ctx context.Context,
+	manifest manifest.Manifest,
+	nodeSelector klabels.Selector,
+	availabilityZone pc_fields.AvailabilityZone,
+	clusterName pc_fields.ClusterName,
+	podLabels klabels.Set,
+	additionalLabels klabels.Set,
+	allocationStrategy fields.Strategy,
+	user string,
+	source audit.Source,
+) (fields.RC, error) {
+	rc, err := a.innerStore.CreateTxn(ctx, manifest, nodeSelector, availabilityZone, clusterName, podLabels, additionalLabels, allocationStrategy)
+	if err != nil {
+		return fields.RC{}, err
+	}
+
+	details, err := audit.NewRCMutationDetails(rc.ID, nil, &rc, user, source)
+	if err != nil {
+		return fields.RC{}, err
+	}
+
+	err = a.auditLogStore.Create(ctx, audit.RCCreatedEvent, details)
+	if err != nil {
+		return fields.RC{}, errors.Errorf("could not create audit log record for replication controller creation: %w", err)
+	}
+
+	return rc, nil
+}
+
+func (a AuditingStore) Delete(
+	ctx context.Context,
+	id fields.ID,
+	force bool,
+	user string,
+	source audit.Source,
+) error {
+	mutator := func(rc fields.RC) (fields.RC, error) {
+		if !force && rc.ReplicasDesired != 0 {
+			return rc, errors.Errorf("cannot delete RC %s because its replica count is nonzero, was %d", id, rc.ReplicasDesired)
+		}
+		return fields.RC{}, nil
+	}
+
+	_, err := a.mutateTxn(ctx, id, mutator, audit.RCDeletedEvent, user, source)
+	return err
+}
+
+func (a AuditingStore) SetDesiredReplicas(
+	ctx context.Context,
+	id fields.ID,
+	n int,
+	user string,
+	source audit.Source,
+) (fields.RC, error) {
+	mutator := func(rc fields.RC) (fields.RC, error) {
+		rc.ReplicasDesired = n
+		return rc, nil
+	}
+
+	return a.mutateTxn(ctx, id, mutator, audit.RCReplicasUpdatedEvent, user, source)
+}
+
+func (a AuditingStore) UpdateNodeSelector(
+	ctx context.Context,
+	id fields.ID,
+	nodeSelector klabels.Selector,
+	user string,
+	source audit.Source,
+) (fields.RC, error) {
+	mutator := func(rc fields.RC) (fields.RC, error) {
+		rc.NodeSelector = nodeSelector
+		return rc, nil
+	}
+
+	return a.mutateTxn(ctx, id, mutator, audit.RCNodeSelectorUpdatedEvent, user, source)
+}
+
+func (a AuditingStore) UpdateManifest(
+	ctx context.Context,
+	id fields.ID,
+	man manifest.Manifest,
+	user string,
+	source audit.Source,
+) (fields.RC, error) {
+	mutator := func(rc fields.RC) (fields.RC, error) {
+		rc.Manifest = man
+		return rc, nil
+	}
+
+	return a.mutateTxn(ctx, id, mutator, audit.RCManifestUpdatedEvent, user, source)
+}
+
+func (a AuditingStore) UpdateStrategy(
+	ctx context.Context,
+	id fields.ID,
+	strategy fields.Strategy,
+	user string,
+	source audit.Source,
+) (fields.RC, error) {
+	if strategy != fields.DynamicStrategy && strategy != fields.StaticStrategy {
+		return fields.RC{}, errors.Errorf("Ineligible strategy - %s - passed.", strategy)
+	}
+
+	mutator := func(rc fields.RC) (fields.RC, error) {
+		rc.AllocationStrategy = strategy
+		return rc, nil
+	}
+
+	return a.mutateTxn(ctx, id, mutator, audit.RCStrategyUpdatedEvent, user, source)
+}
+
+func (a AuditingStore) Enable(
+	ctx context.Context,
+	id fields.ID,
+	user string,
+	source audit.Source,
+) (fields.RC, error) {
+	mutator := func(rc fields.RC) (fields.RC, error) {
+		rc.Disabled = false
+		return rc, nil
+	}
+
+	return a.mutateTxn(ctx, id, mutator, audit.RCEnabledEvent, user, source)
+}
+
+func (a AuditingStore) Disable(
+	ctx context.Context,
+	id fields.ID,
+	user string,
+	source audit.Source,
+) (fields.RC, error) {
+	mutator := func(rc fields.RC) (fields.RC, error) {
+		rc.Disabled = true
+		return rc, nil
+	}
+
+	return a.mutateTxn(ctx, id, mutator, audit.RCDisabledEvent, user, source)
+}
+
+// mutateTxn adds the mutation to ctx along with an audit log record of the
+// given type holding the replication controller before and after it
+func (a AuditingStore) mutateTxn(
+	ctx context.Context,
+	id fields.ID,
+	mutator func(fields.RC) (fields.RC, error),
+	eventType audit.EventType,
+	user string,
+	source audit.Source,
+) (fields.RC, error) {
+	var oldRC, newRC fields.RC
+	err := a.innerStore.mutateRCTxn(ctx, id, func(rc fields.RC) (fields.RC, error) {
+		oldRC = rc
+		var err error
+		newRC, err = mutator(rc)
+		return newRC, err
+	})
+	if err != nil {
+		return fields.RC{}, err
+	}
+
+	// mutators return an RC without an ID to signify deletion
+	newRCPtr := &newRC
+	if newRC.ID == "" {
+		newRCPtr = nil
+	}
+	details, err := audit.NewRCMutationDetails(id, &oldRC, newRCPtr, user, source)
+	if err != nil {
+		return fields.RC{}, err
+	}
+
+	err = a.auditLogStore.Create(ctx, eventType, details)
+	if err != nil {
+		return fields.RC{}, errors.Errorf("could not create audit log record for replication controller mutation: %w", err)
+	}
+
+	return newRC, nil
+}
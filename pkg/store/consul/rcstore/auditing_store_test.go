@@ -0,0 +1,162 @@
+// +build !race
+
+package rcstore
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/store/consul/auditlogstore"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/store/consul/transaction"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+func TestSetDesiredReplicasWithAudit(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+
+	applicator := labels.NewConsulApplicator(fixture.Client, 0, 0)
+	store := NewConsul(fixture.Client, applicator, 0)
+	auditLogStore := auditlogstore.NewConsulStore(fixture.Client.KV())
+	auditingStore := NewAuditingStore(store, auditLogStore)
+
+	rc, err := store.Create(testManifest(), klabels.Everything(), "some_az", "some_cn", nil, nil, "some_strategy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := transaction.New(context.Background())
+	defer cancel()
+	_, err = auditingStore.SetDesiredReplicas(ctx, rc.ID, 3, "some_user", audit.SourceCLI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// confirm nothing changed before the transaction was committed
+	rc, err = store.Get(rc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc.ReplicasDesired != 0 {
+		t.Errorf("replica count should not have changed before the transaction was committed, but was %d", rc.ReplicasDesired)
+	}
+	alMap, err := auditLogStore.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alMap) != 0 {
+		t.Errorf("expected 0 audit logs before committing transaction but there were %d", len(alMap))
+	}
+
+	err = transaction.MustCommit(ctx, fixture.Client.KV())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err = store.Get(rc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc.ReplicasDesired != 3 {
+		t.Errorf("expected replica count to be 3 after committing the transaction but was %d", rc.ReplicasDesired)
+	}
+
+	alMap, err = auditLogStore.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alMap) != 1 {
+		t.Fatalf("expected 1 audit log after committing transaction but there were %d", len(alMap))
+	}
+
+	for _, v := range alMap {
+		if v.EventType != audit.RCReplicasUpdatedEvent {
+			t.Errorf("expected audit log record with type %q but was %q", audit.RCReplicasUpdatedEvent, v.EventType)
+		}
+
+		var details audit.RCMutationDetails
+		err = json.Unmarshal([]byte(*v.EventDetails), &details)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if details.User != "some_user" {
+			t.Errorf("expected user name on audit record to be %q but was %q", "some_user", details.User)
+		}
+		if details.Source != audit.SourceCLI {
+			t.Errorf("expected source on audit record to be %q but was %q", audit.SourceCLI, details.Source)
+		}
+		if details.ReplicationControllerID != rc.ID {
+			t.Errorf("expected audit log record to be for RC %s but was for %s", rc.ID, details.ReplicationControllerID)
+		}
+
+		changes := details.Changes()
+		if len(changes) != 1 || changes[0].Old != "0" || changes[0].New != "3" {
+			t.Errorf("expected the audit log record to show the replica count going from 0 to 3, got %+v", changes)
+		}
+	}
+}
+
+func TestDeleteWithAudit(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+
+	applicator := labels.NewConsulApplicator(fixture.Client, 0, 0)
+	store := NewConsul(fixture.Client, applicator, 0)
+	auditLogStore := auditlogstore.NewConsulStore(fixture.Client.KV())
+	auditingStore := NewAuditingStore(store, auditLogStore)
+
+	rc, err := store.Create(testManifest(), klabels.Everything(), "some_az", "some_cn", nil, nil, "some_strategy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := transaction.New(context.Background())
+	defer cancel()
+	err = auditingStore.Delete(ctx, rc.ID, false, "some_user", audit.SourceAPI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = transaction.MustCommit(ctx, fixture.Client.KV())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.Get(rc.ID)
+	if err != NoReplicationController {
+		t.Errorf("expected the RC to be deleted, but fetching it returned %v", err)
+	}
+
+	alMap, err := auditLogStore.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alMap) != 1 {
+		t.Fatalf("expected 1 audit log after committing transaction but there were %d", len(alMap))
+	}
+
+	for _, v := range alMap {
+		if v.EventType != audit.RCDeletedEvent {
+			t.Errorf("expected audit log record with type %q but was %q", audit.RCDeletedEvent, v.EventType)
+		}
+
+		var details audit.RCMutationDetails
+		err = json.Unmarshal([]byte(*v.EventDetails), &details)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if details.Old == nil || details.Old.ID != rc.ID {
+			t.Errorf("expected the audit log record to hold the deleted RC, got %+v", details.Old)
+		}
+		if details.New != nil {
+			t.Errorf("expected no new RC on a deletion audit log record, got %+v", details.New)
+		}
+	}
+}
@@ -3,7 +3,6 @@ package rcstore
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"path"
 	"strings"
@@ -14,6 +13,7 @@ import (
 	"github.com/pborman/uuid"
 	klabels "k8s.io/kubernetes/pkg/labels"
 
+	"github.com/square/p2/pkg/errors"
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/manifest"
 	pc_fields "github.com/square/p2/pkg/pc/fields"
@@ -22,7 +22,6 @@ import (
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/transaction"
 	"github.com/square/p2/pkg/types"
-	"github.com/square/p2/pkg/util"
 )
 
 const (
@@ -198,7 +197,7 @@ func (s *ConsulStore) innerCreate(manifest manifest.Manifest, nodeSelector klabe
 
 	jsonRC, err := json.Marshal(rc)
 	if err != nil {
-		return fields.RC{}, util.Errorf("Could not marshal RC as json: %s", err)
+		return fields.RC{}, errors.Errorf("Could not marshal RC as json: %w", err)
 	}
 	success, _, err := s.kv.CAS(&api.KVPair{
 		Key:   rcp,
@@ -238,7 +237,7 @@ func (s *ConsulStore) innerCreateTxn(ctx context.Context, manifest manifest.Mani
 
 	jsonRC, err := json.Marshal(rc)
 	if err != nil {
-		return fields.RC{}, util.Errorf("Could not marshal RC as json: %s", err)
+		return fields.RC{}, errors.Errorf("Could not marshal RC as json: %w", err)
 	}
 
 	err = transaction.Add(ctx, api.KVTxnOp{
@@ -511,7 +510,7 @@ func (s *ConsulStore) publishLatestRCKeysWithLockInfo(inCh <-chan []fields.ID, q
 				lockPairs, _, err := s.kv.List(s.rcLockRoot(), nil)
 				if err != nil {
 					select {
-					case errCh <- consulutil.NewKVError("list", s.rcLockRoot(), util.Errorf("Unable to retrieve rc lock info, reporting them all as not locked: %s", err)):
+					case errCh <- consulutil.NewKVError("list", s.rcLockRoot(), errors.Errorf("Unable to retrieve rc lock info, reporting them all as not locked: %w", err)):
 					case <-quit:
 						return
 					}
@@ -531,7 +530,7 @@ func (s *ConsulStore) publishLatestRCKeysWithLockInfo(inCh <-chan []fields.ID, q
 
 					if _, ok := rcMap[rcID]; !ok {
 						select {
-						case errCh <- util.Errorf("Found lock for rc '%s' but that RC wasn't found", rcID):
+						case errCh <- errors.Errorf("Found lock for rc '%s' but that RC wasn't found", rcID):
 						case <-quit:
 							return
 						}
@@ -573,10 +572,10 @@ func kvpToRC(kvp *api.KVPair) (fields.RC, error) {
 	rc := fields.RC{}
 	err := json.Unmarshal(kvp.Value, &rc)
 	if err != nil {
-		return rc, util.Errorf("Could not unmarshal RC ('%s') as json: %s", string(kvp.Value), err)
+		return rc, errors.Errorf("Could not unmarshal RC ('%s') as json: %w", string(kvp.Value), err)
 	}
 	if rc.Manifest == nil {
-		return rc, util.Errorf("%s: RC has no manifest", kvp.Key)
+		return rc, errors.Errorf("%s: RC has no manifest", kvp.Key)
 	}
 
 	return rc, nil
@@ -683,7 +682,7 @@ func (s *ConsulStore) DeleteTxn(ctx context.Context, id fields.ID, force bool) e
 		}
 
 		if rc.ReplicasDesired != 0 {
-			return rc, util.Errorf("cannot delete RC %s because its replica count is nonzero, was %d", id, rc.ReplicasDesired)
+			return rc, errors.Errorf("cannot delete RC %s because its replica count is nonzero, was %d", id, rc.ReplicasDesired)
 		}
 
 		return fields.RC{}, nil
@@ -701,7 +700,7 @@ func (s *ConsulStore) UpdateManifest(id fields.ID, man manifest.Manifest) error
 
 func (s *ConsulStore) UpdateStrategy(id fields.ID, strategy fields.Strategy) error {
 	if strategy != fields.DynamicStrategy && strategy != fields.StaticStrategy {
-		return util.Errorf("Ineligible strategy - %s - passed.", strategy)
+		return errors.Errorf("Ineligible strategy - %s - passed.", strategy)
 	}
 
 	strategyUpdater := func(rc fields.RC) (fields.RC, error) {
@@ -761,7 +760,7 @@ func (s *ConsulStore) mutatePair(id fields.ID, mutator func(fields.RC) (fields.R
 
 	b, err := json.Marshal(newRC)
 	if err != nil {
-		return nil, util.Errorf("Could not marshal RC as JSON: %s", err)
+		return nil, errors.Errorf("Could not marshal RC as JSON: %w", err)
 	}
 	newKVP.Value = b
 	return newKVP, nil
@@ -902,7 +901,7 @@ func (s *ConsulStore) rcLockRoot() string {
 
 func (s *ConsulStore) rcPath(rcID fields.ID) (string, error) {
 	if rcID == "" {
-		return "", util.Errorf("Path requested for empty RC id")
+		return "", errors.Codef(errors.CodeInvalid, "Path requested for empty RC id")
 	}
 
 	return path.Join(rcTree, string(rcID)), nil
@@ -1054,50 +1053,50 @@ type TransferReplicaCountsRequest struct {
 // dying between updates and violating replica count invariants
 func (s *ConsulStore) TransferReplicaCounts(ctx context.Context, req TransferReplicaCountsRequest) error {
 	if req.ToRCID == "" {
-		return util.Errorf("couldn't transfer replica counts: ToRCID was empty")
+		return errors.Codef(errors.CodeInvalid, "couldn't transfer replica counts: ToRCID was empty")
 	}
 	if req.FromRCID == "" {
-		return util.Errorf("couldn't transfer replica counts: FromRCID was empty")
+		return errors.Codef(errors.CodeInvalid, "couldn't transfer replica counts: FromRCID was empty")
 	}
 	if req.ReplicasToAdd == nil {
-		return util.Errorf("couldn't transfer replica counts: ReplicasToAdd was nil")
+		return errors.Codef(errors.CodeInvalid, "couldn't transfer replica counts: ReplicasToAdd was nil")
 	}
 	if req.ReplicasToRemove == nil {
-		return util.Errorf("couldn't transfer replica counts: ReplicasToRemove was nil")
+		return errors.Codef(errors.CodeInvalid, "couldn't transfer replica counts: ReplicasToRemove was nil")
 	}
 	if req.StartingToReplicas == nil {
-		return util.Errorf("couldn't transfer replica counts: StartingToReplicas was nil")
+		return errors.Codef(errors.CodeInvalid, "couldn't transfer replica counts: StartingToReplicas was nil")
 	}
 	if req.StartingFromReplicas == nil {
-		return util.Errorf("couldn't transfer replica counts: StartingFromReplicas was nil")
+		return errors.Codef(errors.CodeInvalid, "couldn't transfer replica counts: StartingFromReplicas was nil")
 	}
 
 	toRCPath, err := s.rcPath(req.ToRCID)
 	if err != nil {
-		return util.Errorf("couldn't transfer replica counts: %s", err)
+		return errors.Errorf("couldn't transfer replica counts: %w", err)
 	}
 
 	fromRCPath, err := s.rcPath(req.FromRCID)
 	if err != nil {
-		return util.Errorf("couldn't transfer replica counts: %s", err)
+		return errors.Errorf("couldn't transfer replica counts: %w", err)
 	}
 
 	toRC, toRCIndex, err := s.getWithIndex(req.ToRCID)
 	if err != nil {
-		return util.Errorf("couldn't transfer replica counts: %s", err)
+		return errors.Errorf("couldn't transfer replica counts: %w", err)
 	}
 
 	if toRC.ReplicasDesired != *req.StartingToReplicas {
-		return util.Errorf("couldn't transfer replica counts: RC %s had %d replicas but the request expected it to have %d", req.ToRCID, toRC.ReplicasDesired, *req.StartingToReplicas)
+		return errors.Codef(errors.CodeConflict, "couldn't transfer replica counts: RC %s had %d replicas but the request expected it to have %d", req.ToRCID, toRC.ReplicasDesired, *req.StartingToReplicas)
 	}
 
 	fromRC, fromRCIndex, err := s.getWithIndex(req.FromRCID)
 	if err != nil {
-		return util.Errorf("couldn't transfer replica counts: %s", err)
+		return errors.Errorf("couldn't transfer replica counts: %w", err)
 	}
 
 	if fromRC.ReplicasDesired != *req.StartingFromReplicas {
-		return util.Errorf("couldn't transfer replica counts: RC %s had %d replicas but the request expected it to have %d", req.FromRCID, fromRC.ReplicasDesired, *req.StartingFromReplicas)
+		return errors.Codef(errors.CodeConflict, "couldn't transfer replica counts: RC %s had %d replicas but the request expected it to have %d", req.FromRCID, fromRC.ReplicasDesired, *req.StartingFromReplicas)
 	}
 
 	toRC.ReplicasDesired = toRC.ReplicasDesired + *req.ReplicasToAdd
@@ -1105,12 +1104,12 @@ func (s *ConsulStore) TransferReplicaCounts(ctx context.Context, req TransferRep
 
 	toRCBytes, err := json.Marshal(toRC)
 	if err != nil {
-		return util.Errorf("couldn't transfer replica counts: %s", err)
+		return errors.Errorf("couldn't transfer replica counts: %w", err)
 	}
 
 	fromRCBytes, err := json.Marshal(fromRC)
 	if err != nil {
-		return util.Errorf("couldn't transfer replica counts: %s", err)
+		return errors.Errorf("couldn't transfer replica counts: %w", err)
 	}
 
 	err = transaction.Add(ctx, api.KVTxnOp{
@@ -1182,7 +1181,7 @@ func keysToRCIDs(keys []string) ([]fields.ID, error) {
 		rcIDStr := strings.TrimPrefix(key, rcTree+"/")
 		rcID, err := fields.ToRCID(rcIDStr)
 		if err != nil {
-			return nil, util.Errorf("couldn't convert key to uuid: %s", err)
+			return nil, errors.Errorf("couldn't convert key to uuid: %w", err)
 		}
 
 		out[i] = rcID
@@ -1212,15 +1211,15 @@ func (s *ConsulStore) lockTypeFromKey(key string) (fields.ID, LockType, error) {
 	keyParts := strings.Split(key, "/")
 	// Sanity check key structure e.g. /lock/replication_controllers/abcd-1234
 	if len(keyParts) < 3 || len(keyParts) > 4 {
-		return "", UnknownLockType, util.Errorf("Key '%s' does not resemble an RC lock", key)
+		return "", UnknownLockType, errors.Errorf("Key '%s' does not resemble an RC lock", key)
 	}
 
 	if keyParts[0] != consul.LOCK_TREE {
-		return "", UnknownLockType, util.Errorf("Key '%s' does not resemble an RC lock", key)
+		return "", UnknownLockType, errors.Errorf("Key '%s' does not resemble an RC lock", key)
 	}
 
 	if keyParts[1] != rcTree {
-		return "", UnknownLockType, util.Errorf("Key '%s' does not resemble an RC lock", key)
+		return "", UnknownLockType, errors.Errorf("Key '%s' does not resemble an RC lock", key)
 	}
 
 	rcID := keyParts[2]
@@ -9,11 +9,11 @@ import (
 
 	"k8s.io/kubernetes/pkg/labels"
 
+	"github.com/square/p2/pkg/errors"
 	"github.com/square/p2/pkg/manifest"
 	pc_fields "github.com/square/p2/pkg/pc/fields"
 	"github.com/square/p2/pkg/rc/fields"
 	"github.com/square/p2/pkg/store/consul"
-	"github.com/square/p2/pkg/util"
 )
 
 type fakeStore struct {
@@ -121,7 +121,7 @@ func (s *fakeStore) Disable(id fields.ID) error {
 	defer s.mu.Unlock()
 	entry, ok := s.rcs[id]
 	if !ok {
-		return util.Errorf("Nonexistent RC")
+		return errors.Errorf("Nonexistent RC")
 	}
 
 	entry.Disabled = true
@@ -132,7 +132,7 @@ func (s *fakeStore) Disable(id fields.ID) error {
 }
 
 func (s *fakeStore) DisableTxn(ctx context.Context, id fields.ID) error {
-	return util.Errorf("DisableTxn isn't implemented in fake RC store. use a real store if this functionality is needed")
+	return errors.Errorf("DisableTxn isn't implemented in fake RC store. use a real store if this functionality is needed")
 }
 
 func (s *fakeStore) Enable(id fields.ID) error {
@@ -140,7 +140,7 @@ func (s *fakeStore) Enable(id fields.ID) error {
 	defer s.mu.Unlock()
 	entry, ok := s.rcs[id]
 	if !ok {
-		return util.Errorf("Nonexistent RC")
+		return errors.Errorf("Nonexistent RC")
 	}
 
 	entry.Disabled = false
@@ -151,7 +151,7 @@ func (s *fakeStore) Enable(id fields.ID) error {
 }
 
 func (s *fakeStore) EnableTxn(ctx context.Context, id fields.ID) error {
-	return util.Errorf("EnableTxn isn't implemented in fake RC store. use a real store if this functionality is needed")
+	return errors.Errorf("EnableTxn isn't implemented in fake RC store. use a real store if this functionality is needed")
 }
 
 func (s *fakeStore) SetDesiredReplicas(id fields.ID, n int) error {
@@ -159,7 +159,7 @@ func (s *fakeStore) SetDesiredReplicas(id fields.ID, n int) error {
 	defer s.mu.Unlock()
 	entry, ok := s.rcs[id]
 	if !ok {
-		return util.Errorf("Nonexistent RC")
+		return errors.Errorf("Nonexistent RC")
 	}
 
 	entry.ReplicasDesired = n
@@ -174,7 +174,7 @@ func (s *fakeStore) AddDesiredReplicas(id fields.ID, n int) error {
 	defer s.mu.Unlock()
 	entry, ok := s.rcs[id]
 	if !ok {
-		return util.Errorf("Nonexistent RC")
+		return errors.Errorf("Nonexistent RC")
 	}
 
 	entry.ReplicasDesired += n
@@ -192,11 +192,11 @@ func (s *fakeStore) CASDesiredReplicas(id fields.ID, expected int, n int) error
 	defer s.mu.Unlock()
 	entry, ok := s.rcs[id]
 	if !ok {
-		return util.Errorf("Nonexistent RC")
+		return errors.Errorf("Nonexistent RC")
 	}
 
 	if entry.ReplicasDesired != expected {
-		return util.Errorf("pre-empted")
+		return errors.Errorf("pre-empted")
 	}
 
 	entry.ReplicasDesired = n
@@ -211,11 +211,11 @@ func (s *fakeStore) Delete(id fields.ID, force bool) error {
 	defer s.mu.Unlock()
 	entry, ok := s.rcs[id]
 	if !ok {
-		return util.Errorf("Nonexistent RC")
+		return errors.Errorf("Nonexistent RC")
 	}
 
 	if !force && entry.ReplicasDesired != 0 {
-		return util.Errorf("Replicas desired must be 0 to delete.")
+		return errors.Errorf("Replicas desired must be 0 to delete.")
 	}
 
 	for k, channel := range entry.watchers {
@@ -228,18 +228,18 @@ func (s *fakeStore) Delete(id fields.ID, force bool) error {
 }
 
 func (s *fakeStore) DeleteTxn(ctx context.Context, id fields.ID, force bool) error {
-	return util.Errorf("DeleteTxn not implemented in fake RC store. Use a real consul store (e.g. via consulutil) if this functionality is needed")
+	return errors.Errorf("DeleteTxn not implemented in fake RC store. Use a real consul store (e.g. via consulutil) if this functionality is needed")
 }
 
 func (s *fakeStore) Watch(rc *fields.RC, mu *sync.Mutex, quit <-chan struct{}) (<-chan struct{}, <-chan error) {
 	updatesOut := make(chan struct{})
 	entry, ok := s.rcs[rc.ID]
 	if !ok {
-		errors := make(chan error, 1)
-		errors <- util.Errorf("Nonexistent RC")
+		errCh := make(chan error, 1)
+		errCh <- errors.Errorf("Nonexistent RC")
 		close(updatesOut)
-		close(errors)
-		return updatesOut, errors
+		close(errCh)
+		return updatesOut, errCh
 	}
 
 	errors := make(chan error)
@@ -291,12 +291,12 @@ func (s *fakeStore) LockForUpdateCreation(rcID fields.ID, session consul.Session
 
 func (s *fakeStore) UpdateCreationLockPath(rcID fields.ID) (string, error) {
 	if rcID == "" {
-		return "", util.Errorf("empty rcID")
+		return "", errors.Errorf("empty rcID")
 	}
 
 	return fmt.Sprintf("%s/%s", rcID, "update_creation_lock"), nil
 }
 
 func (s *fakeStore) TransferReplicaCounts(ctx context.Context, req TransferReplicaCountsRequest) error {
-	return util.Errorf("TransferReplicaCounts not implemented in fake RC store, use a real consul store if you need this functionality")
+	return errors.Errorf("TransferReplicaCounts not implemented in fake RC store, use a real consul store if you need this functionality")
 }
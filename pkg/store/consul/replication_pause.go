@@ -0,0 +1,78 @@
+package consul
+
+import (
+	"encoding/json"
+	"path"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+)
+
+// ReplicationPauseTree holds the pauses of pkg/replication based deploys,
+// keyed by pod ID. While a pod is paused, replications of it don't start
+// updating any more nodes. A pause outlives the process that set it, so that
+// another invocation can resume the same rollout.
+const ReplicationPauseTree = "replication_pauses"
+
+// A ReplicationPause records who paused the replications of a pod
+type ReplicationPause struct {
+	// Informative only, e.g. the user and host that paused the replication
+	PausedBy string    `json:"paused_by"`
+	Time     time.Time `json:"time"`
+}
+
+// ReplicationPause returns the pause of the replications of the given pod, or
+// nil if they aren't paused.
+func (c consulStore) ReplicationPause(podID types.PodID) (*ReplicationPause, error) {
+	key := path.Join(ReplicationPauseTree, podID.String())
+	kvp, _, err := c.client.KV().Get(key, nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("get", key, err)
+	}
+	if kvp == nil {
+		return nil, nil
+	}
+
+	var pause ReplicationPause
+	err = json.Unmarshal(kvp.Value, &pause)
+	if err != nil {
+		return nil, errors.Errorf("could not parse replication pause at %s: %w", key, err)
+	}
+	return &pause, nil
+}
+
+// PauseReplication pauses the replications of the given pod until
+// ResumeReplication is called for it
+func (c consulStore) PauseReplication(podID types.PodID, pausedBy string) error {
+	if podID == "" {
+		return errors.Errorf("pod ID must not be empty")
+	}
+	key := path.Join(ReplicationPauseTree, podID.String())
+	data, err := json.Marshal(ReplicationPause{PausedBy: pausedBy, Time: time.Now()})
+	if err != nil {
+		return errors.Errorf("could not marshal replication pause: %w", err)
+	}
+	_, err = c.client.KV().Put(&api.KVPair{Key: key, Value: data}, nil)
+	if err != nil {
+		return consulutil.NewKVError("put", key, err)
+	}
+	return nil
+}
+
+// ResumeReplication removes the pause of the replications of the given pod,
+// if any
+func (c consulStore) ResumeReplication(podID types.PodID) error {
+	if podID == "" {
+		return errors.Errorf("pod ID must not be empty")
+	}
+	key := path.Join(ReplicationPauseTree, podID.String())
+	_, err := c.client.KV().Delete(key, nil)
+	if err != nil {
+		return consulutil.NewKVError("delete", key, err)
+	}
+	return nil
+}
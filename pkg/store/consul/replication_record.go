@@ -0,0 +1,105 @@
+package consul
+
+import (
+	"encoding/json"
+	"path"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+)
+
+// ReplicationRecordTree holds the progress of pkg/replication based deploys,
+// keyed by an ID chosen when the deploy starts. A record outlives the process
+// doing the deploy, so that a deploy that was interrupted can be resumed
+// without updating the nodes it already completed.
+const ReplicationRecordTree = "replication_records"
+
+// A ReplicationRecord tracks which nodes a replication has completed
+type ReplicationRecord struct {
+	ID          string           `json:"id"`
+	PodID       types.PodID      `json:"pod_id"`
+	ManifestSHA string           `json:"manifest_sha"`
+	Nodes       []types.NodeName `json:"nodes"`
+
+	// The nodes that are running the manifest and were healthy, or
+	// already had it
+	Completed []types.NodeName `json:"completed"`
+
+	// The nodes that could not be updated, with the reason why
+	Failed map[types.NodeName]string `json:"failed,omitempty"`
+
+	Started time.Time `json:"started"`
+	Updated time.Time `json:"updated"`
+}
+
+// Remaining returns the nodes of the record that weren't completed, in their
+// original order
+func (r ReplicationRecord) Remaining() []types.NodeName {
+	completed := make(map[types.NodeName]bool)
+	for _, node := range r.Completed {
+		completed[node] = true
+	}
+	var remaining []types.NodeName
+	for _, node := range r.Nodes {
+		if !completed[node] {
+			remaining = append(remaining, node)
+		}
+	}
+	return remaining
+}
+
+// ReplicationRecord returns the replication record with the given ID, or nil
+// if there is none
+func (c consulStore) ReplicationRecord(id string) (*ReplicationRecord, error) {
+	key := path.Join(ReplicationRecordTree, id)
+	kvp, _, err := c.client.KV().Get(key, nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("get", key, err)
+	}
+	if kvp == nil {
+		return nil, nil
+	}
+
+	var record ReplicationRecord
+	err = json.Unmarshal(kvp.Value, &record)
+	if err != nil {
+		return nil, errors.Errorf("could not parse replication record at %s: %w", key, err)
+	}
+	return &record, nil
+}
+
+// PutReplicationRecord writes a replication record, replacing any record with
+// the same ID
+func (c consulStore) PutReplicationRecord(record ReplicationRecord) error {
+	if record.ID == "" {
+		return errors.Errorf("replication record ID must not be empty")
+	}
+	key := path.Join(ReplicationRecordTree, record.ID)
+	data, err := json.Marshal(record)
+	if err != nil {
+		return errors.Errorf("could not marshal replication record: %w", err)
+	}
+	_, err = c.client.KV().Put(&api.KVPair{Key: key, Value: data}, nil)
+	if err != nil {
+		return consulutil.NewKVError("put", key, err)
+	}
+	return nil
+}
+
+// DeleteReplicationRecord removes the replication record with the given ID,
+// if any
+func (c consulStore) DeleteReplicationRecord(id string) error {
+	if id == "" {
+		return errors.Errorf("replication record ID must not be empty")
+	}
+	key := path.Join(ReplicationRecordTree, id)
+	_, err := c.client.KV().Delete(key, nil)
+	if err != nil {
+		return consulutil.NewKVError("delete", key, err)
+	}
+	return nil
+}
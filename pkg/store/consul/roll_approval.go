@@ -0,0 +1,75 @@
+package consul
+
+import (
+	"encoding/json"
+	"path"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+)
+
+// RollApprovalTree holds the approvals of rolling updates of protected pods,
+// keyed by the ID of the rolling update.
+const RollApprovalTree = "roll_approvals"
+
+// A RollApproval records that an operator other than the one who requested a
+// rolling update has acknowledged it, allowing it to proceed past its canary.
+type RollApproval struct {
+	// The name of the operator who recorded the approval. It is informative
+	// only, the approver is identified by the key that made the signature.
+	Approver string `json:"approver"`
+
+	// A detached OpenPGP signature of RollApprovalMessage() for the
+	// rolling update
+	Signature []byte `json:"signature"`
+
+	Time time.Time `json:"time"`
+}
+
+// RollApprovalMessage returns the message an approver must sign to approve
+// the rolling update with the given ID.
+func RollApprovalMessage(rollID string) []byte {
+	return []byte("approve rolling update " + rollID)
+}
+
+// RollApproval returns the approval of the rolling update with the given ID,
+// or nil if it hasn't been approved.
+func (c consulStore) RollApproval(rollID string) (*RollApproval, error) {
+	key := path.Join(RollApprovalTree, rollID)
+	kvp, _, err := c.client.KV().Get(key, nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("get", key, err)
+	}
+	if kvp == nil {
+		return nil, nil
+	}
+
+	var approval RollApproval
+	err = json.Unmarshal(kvp.Value, &approval)
+	if err != nil {
+		return nil, errors.Errorf("could not parse roll approval at %s: %w", key, err)
+	}
+	return &approval, nil
+}
+
+// SetRollApproval records the approval of the rolling update with the given
+// ID. The signature is checked by the orchestrator running the update, not
+// here.
+func (c consulStore) SetRollApproval(rollID string, approval RollApproval) error {
+	if rollID == "" {
+		return errors.Codef(errors.CodeInvalid, "rolling update ID must not be empty")
+	}
+	key := path.Join(RollApprovalTree, rollID)
+	data, err := json.Marshal(approval)
+	if err != nil {
+		return errors.Errorf("could not marshal roll approval: %w", err)
+	}
+	_, err = c.client.KV().Put(&api.KVPair{Key: key, Value: data}, nil)
+	if err != nil {
+		return consulutil.NewKVError("put", key, err)
+	}
+	return nil
+}
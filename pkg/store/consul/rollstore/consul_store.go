@@ -3,7 +3,6 @@ package rollstore
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"os"
 	"path"
@@ -13,6 +12,7 @@ import (
 	"github.com/hashicorp/consul/api"
 	klabels "k8s.io/kubernetes/pkg/labels"
 
+	"github.com/square/p2/pkg/errors"
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
@@ -23,7 +23,6 @@ import (
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/rcstore"
 	"github.com/square/p2/pkg/store/consul/transaction"
-	"github.com/square/p2/pkg/util"
 )
 
 const rollTree string = "rolls"
@@ -157,7 +156,7 @@ func (s ConsulStore) List() ([]roll_fields.Update, error) {
 func (s ConsulStore) newRUCreationSession() (consul.Session, error) {
 	hostname, err := os.Hostname()
 	if err != nil {
-		return nil, util.Errorf("Could not determine hostname for RU create lock name: %s", err)
+		return nil, errors.Errorf("Could not determine hostname for RU create lock name: %w", err)
 	}
 
 	lockName := fmt.Sprintf(
@@ -423,7 +422,7 @@ func (s ConsulStore) CreateRollingUpdateFromOneMaybeExistingWithLabelSelector(
 		oldRCID = rc_fields.ID(matches[0].ID)
 	} else {
 		if leaveOld {
-			return roll_fields.Update{}, util.Errorf(
+			return roll_fields.Update{}, errors.Errorf(
 				"Can't create an update with LeaveOld set if there is no old RC (sel=%s)",
 				oldRCSelector.String(),
 			)
@@ -497,7 +496,7 @@ func (s ConsulStore) Delete(ctx context.Context, id roll_fields.ID) error {
 		Key:  key,
 	})
 	if err != nil {
-		return util.Errorf("could not add RU deletion operation to transaction: %s", err)
+		return errors.Errorf("could not add RU deletion operation to transaction: %w", err)
 	}
 
 	err = s.labeler.RemoveAllLabelsTxn(ctx, labels.RU, id.String())
@@ -619,7 +618,7 @@ func publishLatestRolls(inCh <-chan api.KVPairs, quit <-chan struct{}) (<-chan [
 
 func RollPath(id roll_fields.ID) (string, error) {
 	if id == "" {
-		return "", util.Errorf("id not specified when computing roll path")
+		return "", errors.Errorf("id not specified when computing roll path")
 	}
 	return path.Join(rollTree, string(id)), nil
 }
@@ -638,7 +637,7 @@ func kvpToRU(kvp *api.KVPair) (roll_fields.Update, error) {
 	ru := roll_fields.Update{}
 	err := json.Unmarshal(kvp.Value, &ru)
 	if err != nil {
-		return ru, util.Errorf("Unable to unmarshal value as rolling update: %s", err)
+		return ru, errors.Errorf("Unable to unmarshal value as rolling update: %w", err)
 	}
 	return ru, nil
 }
@@ -5,9 +5,9 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/square/p2/pkg/errors"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/transaction"
-	"github.com/square/p2/pkg/util"
 
 	"github.com/hashicorp/consul/api"
 )
@@ -66,7 +66,7 @@ func (c consulStore) LockHolder(key string) (string, string, error) {
 
 	se, _, err := c.client.Session().Info(kvp.Session, nil)
 	if err != nil {
-		return "", "", util.Errorf("Could not get lock information for %q held by id %q", key, kvp.Session)
+		return "", "", errors.Errorf("Could not get lock information for %q held by id %q", key, kvp.Session)
 	}
 	return se.Name, se.ID, nil
 }
@@ -116,7 +116,7 @@ func (s session) LockTxn(
 		Value:   []byte(s.name),
 	})
 	if err != nil {
-		return nil, util.Errorf("could not build key locking transaction: %s", err)
+		return nil, errors.Errorf("could not build key locking transaction: %w", err)
 	}
 
 	return &txnUnlocker{
@@ -273,7 +273,7 @@ func (t *txnUnlocker) UnlockTxn(unlockCtx context.Context) error {
 		Session: t.session,
 	})
 	if err != nil {
-		return util.Errorf("could not build key unlocking transaction: %s", err)
+		return errors.Errorf("could not build key unlocking transaction: %w", err)
 	}
 
 	// delete the lock (which will fail if we're not still holding it
@@ -283,7 +283,7 @@ func (t *txnUnlocker) UnlockTxn(unlockCtx context.Context) error {
 		Key:  t.key,
 	})
 	if err != nil {
-		return util.Errorf("could not build key unlocking transaction: %s", err)
+		return errors.Errorf("could not build key unlocking transaction: %w", err)
 	}
 
 	return nil
@@ -297,7 +297,7 @@ func (t *txnUnlocker) CheckLockedTxn(checkLockedCtx context.Context) error {
 		Session: t.session,
 	})
 	if err != nil {
-		return util.Errorf("could not build lock checking transaction: %s", err)
+		return errors.Errorf("could not build lock checking transaction: %w", err)
 	}
 
 	return nil
@@ -361,7 +361,7 @@ func NewSession(client consulutil.ConsulClient, name string, renewalCh <-chan ti
 	}, nil)
 
 	if err != nil {
-		return session{}, nil, util.Errorf("Could not create session")
+		return session{}, nil, errors.Errorf("Could not create session")
 	}
 
 	if renewalCh == nil {
@@ -393,7 +393,7 @@ func SessionContext(ctx context.Context, client consulutil.ConsulClient, name st
 		TTL:      lockTTL,
 	}, nil)
 	if err != nil {
-		return nil, nil, util.Errorf("could not create session: %s", err)
+		return nil, nil, errors.Errorf("could not create session: %w", err)
 	}
 
 	// adapt the passed context do a quit channel
@@ -430,11 +430,11 @@ func IsAlreadyLocked(err error) bool {
 func (s session) Renew() error {
 	entry, _, err := s.client.Session().Renew(s.session, nil)
 	if err != nil {
-		return util.Errorf("Could not renew lock")
+		return errors.Errorf("Could not renew lock")
 	}
 
 	if entry == nil {
-		return util.Errorf("Could not renew because session was destroyed")
+		return errors.Errorf("Could not renew because session was destroyed")
 	}
 	return nil
 }
@@ -450,7 +450,7 @@ func (s session) Destroy() error {
 	// practice that shouldn't be an issue
 	_, err := s.client.Session().Destroy(s.session, nil)
 	if err != nil {
-		return util.Errorf("Could not destroy lock")
+		return errors.Errorf("Could not destroy lock")
 	}
 	return nil
 }
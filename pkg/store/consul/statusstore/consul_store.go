@@ -6,9 +6,9 @@ import (
 	"path"
 	"strings"
 
+	"github.com/square/p2/pkg/errors"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/transaction"
-	"github.com/square/p2/pkg/util"
 
 	"github.com/hashicorp/consul/api"
 )
@@ -41,6 +41,10 @@ func (n NoStatusError) Error() string {
 	return fmt.Sprintf("No status record found at %s", n.Key)
 }
 
+func (n NoStatusError) ErrCode() errors.Code {
+	return errors.CodeNotFound
+}
+
 func IsNoStatus(err error) bool {
 	_, ok := err.(NoStatusError)
 	return ok
@@ -166,7 +170,7 @@ func (s *consulStore) DeleteStatusTxn(ctx context.Context, t ResourceType, id Re
 		Key:  key,
 	})
 	if err != nil {
-		return util.Errorf("could not add delete operation for %s to transaction: %s", key, err)
+		return errors.Errorf("could not add delete operation for %s to transaction: %w", key, err)
 	}
 
 	return nil
@@ -233,14 +237,14 @@ func (s *consulStore) GetAllStatusForResourceType(t ResourceType) (map[ResourceI
 
 func resourceTypePath(t ResourceType) (string, error) {
 	if t == "" {
-		return "", util.Errorf("Resource type cannot be blank")
+		return "", errors.Errorf("Resource type cannot be blank")
 	}
 	return path.Join(statusTree, t.String()), nil
 }
 
 func resourcePath(t ResourceType, id ResourceID) (string, error) {
 	if id == "" {
-		return "", util.Errorf("resource ID cannot be blank")
+		return "", errors.Errorf("resource ID cannot be blank")
 	}
 
 	typePath, err := resourceTypePath(t)
@@ -253,7 +257,7 @@ func resourcePath(t ResourceType, id ResourceID) (string, error) {
 
 func namespacedResourcePath(t ResourceType, id ResourceID, namespace Namespace) (string, error) {
 	if namespace == "" {
-		return "", util.Errorf("Blank namespace not allowed")
+		return "", errors.Errorf("Blank namespace not allowed")
 	}
 
 	rPath, err := resourcePath(t, id)
@@ -269,12 +273,12 @@ func namespacedResourcePath(t ResourceType, id ResourceID, namespace Namespace)
 func keyParts(key string) (ResourceType, ResourceID, Namespace, error) {
 	parts := strings.Split(key, "/")
 	if len(parts) != 4 {
-		return "", "", "", util.Errorf("Malformed status key: %s", key)
+		return "", "", "", errors.Errorf("Malformed status key: %s", key)
 	}
 
 	// sanity check that we parsed correctly
 	if parts[0] != statusTree {
-		return "", "", "", util.Errorf("Malformed status key (did not start with 'status'): %s", key)
+		return "", "", "", errors.Errorf("Malformed status key (did not start with 'status'): %s", key)
 	}
 
 	return ResourceType(parts[1]), ResourceID(parts[2]), Namespace(parts[3]), nil
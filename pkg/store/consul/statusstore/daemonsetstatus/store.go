@@ -5,8 +5,8 @@ import (
 	"encoding/json"
 
 	dsfields "github.com/square/p2/pkg/ds/fields"
+	"github.com/square/p2/pkg/errors"
 	"github.com/square/p2/pkg/store/consul/statusstore"
-	"github.com/square/p2/pkg/util"
 
 	"github.com/hashicorp/consul/api"
 )
@@ -30,7 +30,7 @@ func NewConsul(statusStore statusstore.Store, namespace statusstore.Namespace) C
 
 func (c ConsulStore) Get(dsID dsfields.ID) (Status, *api.QueryMeta, error) {
 	if dsID == "" {
-		return Status{}, nil, util.Errorf("provided daemon set ID was empty")
+		return Status{}, nil, errors.Codef(errors.CodeInvalid, "provided daemon set ID was empty")
 	}
 
 	status, queryMeta, err := c.statusStore.GetStatus(statusstore.DS, statusstore.ResourceID(dsID), c.namespace)
@@ -69,7 +69,7 @@ func statusToDSStatus(rawStatus statusstore.Status) (Status, error) {
 
 	err := json.Unmarshal(rawStatus.Bytes(), &dsStatus)
 	if err != nil {
-		return Status{}, util.Errorf("Could not unmarshal raw status as daemon set status: %s", err)
+		return Status{}, errors.Errorf("Could not unmarshal raw status as daemon set status: %w", err)
 	}
 
 	return dsStatus, nil
@@ -78,7 +78,7 @@ func statusToDSStatus(rawStatus statusstore.Status) (Status, error) {
 func dsStatusToStatus(dsStatus Status) (statusstore.Status, error) {
 	bytes, err := json.Marshal(dsStatus)
 	if err != nil {
-		return statusstore.Status{}, util.Errorf("Could not marshal pod status as json bytes: %s", err)
+		return statusstore.Status{}, errors.Errorf("Could not marshal pod status as json bytes: %w", err)
 	}
 
 	return statusstore.Status(bytes), nil
@@ -0,0 +1,73 @@
+package deploystatus
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/types"
+)
+
+// Deploy records how long the preparer spent on each phase of the last
+// deploy of a pod
+type Deploy struct {
+	// SHA is the SHA of the deployed manifest
+	SHA string `json:"sha"`
+
+	// Finished is when the new manifest was launched
+	Finished time.Time `json:"finished"`
+
+	// Fetch is the time spent downloading artifacts
+	Fetch time.Duration `json:"fetch"`
+
+	// Verify is the time spent verifying artifacts and the installed pod
+	Verify time.Duration `json:"verify"`
+
+	// Install is the rest of the time spent installing the pod, e.g.
+	// extracting artifacts and running post-install scripts
+	Install time.Duration `json:"install"`
+
+	// Restart is the time spent halting the old manifest and launching
+	// the new one
+	Restart time.Duration `json:"restart"`
+}
+
+// Ack records that the preparer saw a new intent manifest for a pod and
+// started acting on it
+type Ack struct {
+	// SHA is the SHA of the intent manifest
+	SHA string `json:"sha"`
+
+	// At is when the preparer first saw it
+	At time.Time `json:"at"`
+}
+
+// Status holds the last deploy of each legacy pod on a node, by pod ID
+type Status struct {
+	Pods map[types.PodID]Deploy `json:"pods"`
+
+	// The last intent manifest acknowledged for each pod, which is ahead of
+	// Pods while the pod is being deployed
+	Acks map[types.PodID]Ack `json:"acks,omitempty"`
+}
+
+func statusToDeployStatus(rawStatus statusstore.Status) (Status, error) {
+	var deployStatus Status
+
+	err := json.Unmarshal(rawStatus.Bytes(), &deployStatus)
+	if err != nil {
+		return Status{}, errors.Errorf("Could not unmarshal raw status as deploy status: %w", err)
+	}
+
+	return deployStatus, nil
+}
+
+func deployStatusToStatus(deployStatus Status) (statusstore.Status, error) {
+	bytes, err := json.Marshal(deployStatus)
+	if err != nil {
+		return statusstore.Status{}, errors.Errorf("Could not marshal deploy status as json bytes: %w", err)
+	}
+
+	return statusstore.Status(bytes), nil
+}
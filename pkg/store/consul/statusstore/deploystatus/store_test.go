@@ -0,0 +1,41 @@
+package deploystatus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/statusstoretest"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestSetAndGet(t *testing.T) {
+	store := NewConsul(statusstoretest.NewFake(), "deploy_timings")
+
+	_, _, err := store.Get("node1")
+	if !statusstore.IsNoStatus(err) {
+		t.Fatalf("expected a NoStatusError before any status was written, got %v", err)
+	}
+
+	deploy := Deploy{
+		SHA:      "abc",
+		Finished: time.Now().UTC(),
+		Fetch:    3 * time.Second,
+		Verify:   time.Second,
+		Install:  2 * time.Second,
+		Restart:  5 * time.Second,
+	}
+	err = store.Set("node1", Status{Pods: map[types.PodID]Deploy{"web": deploy}})
+	if err != nil {
+		t.Fatalf("unexpected error setting deploy status: %s", err)
+	}
+
+	status, _, err := store.Get("node1")
+	if err != nil {
+		t.Fatalf("unexpected error getting deploy status: %s", err)
+	}
+	got := status.Pods["web"]
+	if got.SHA != deploy.SHA || got.Fetch != deploy.Fetch || got.Restart != deploy.Restart || !got.Finished.Equal(deploy.Finished) {
+		t.Errorf("expected %+v, got %+v", deploy, got)
+	}
+}
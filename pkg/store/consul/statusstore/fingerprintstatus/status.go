@@ -0,0 +1,64 @@
+package fingerprintstatus
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/types"
+)
+
+// Fingerprint describes the environment of a node
+type Fingerprint struct {
+	// OS is the operating system and its version, e.g. "CentOS 7.2"
+	OS string `json:"os,omitempty"`
+
+	// Kernel is the kernel release, e.g. "3.10.0-327.el7.x86_64"
+	Kernel string `json:"kernel,omitempty"`
+
+	// P2Version is the version of the preparer that wrote the entry
+	P2Version string `json:"p2_version,omitempty"`
+
+	// Packages holds the installed version of each package the preparer
+	// is configured to fingerprint. Packages that aren't installed are
+	// left out.
+	Packages map[string]string `json:"packages,omitempty"`
+}
+
+// Entry records the environment a pod's manifest was launched in
+type Entry struct {
+	// SHA is the SHA of the manifest that was written to reality
+	SHA string `json:"sha"`
+
+	// Time is when the manifest was written to reality
+	Time time.Time `json:"time"`
+
+	Fingerprint Fingerprint `json:"fingerprint"`
+}
+
+// Status holds the entry of the last reality write of each pod on a node, by
+// pod ID
+type Status struct {
+	Pods map[types.PodID]Entry `json:"pods"`
+}
+
+func statusToFingerprintStatus(rawStatus statusstore.Status) (Status, error) {
+	var fingerprintStatus Status
+
+	err := json.Unmarshal(rawStatus.Bytes(), &fingerprintStatus)
+	if err != nil {
+		return Status{}, errors.Errorf("Could not unmarshal raw status as fingerprint status: %w", err)
+	}
+
+	return fingerprintStatus, nil
+}
+
+func fingerprintStatusToStatus(fingerprintStatus Status) (statusstore.Status, error) {
+	bytes, err := json.Marshal(fingerprintStatus)
+	if err != nil {
+		return statusstore.Status{}, errors.Errorf("Could not marshal fingerprint status as json bytes: %w", err)
+	}
+
+	return statusstore.Status(bytes), nil
+}
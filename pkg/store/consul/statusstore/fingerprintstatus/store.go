@@ -0,0 +1,56 @@
+package fingerprintstatus
+
+import (
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/types"
+
+	"github.com/hashicorp/consul/api"
+)
+
+type ConsulStore struct {
+	statusStore statusstore.Store
+
+	// The consul implementation statusstore.Store formats keys like
+	// /status/<resource-type>/<resource-id>/<namespace>. The fingerprints
+	// of a node are only written by the preparer on that node.
+	namespace statusstore.Namespace
+}
+
+func NewConsul(statusStore statusstore.Store, namespace statusstore.Namespace) ConsulStore {
+	return ConsulStore{
+		statusStore: statusStore,
+		namespace:   namespace,
+	}
+}
+
+func (c ConsulStore) Get(node types.NodeName) (Status, *api.QueryMeta, error) {
+	if node == "" {
+		return Status{}, nil, errors.Codef(errors.CodeInvalid, "provided node name was empty")
+	}
+
+	rawStatus, queryMeta, err := c.statusStore.GetStatus(statusstore.NODE, statusstore.ResourceID(node), c.namespace)
+	if err != nil {
+		return Status{}, queryMeta, err
+	}
+
+	status, err := statusToFingerprintStatus(rawStatus)
+	if err != nil {
+		return Status{}, queryMeta, err
+	}
+
+	return status, queryMeta, nil
+}
+
+func (c ConsulStore) Set(node types.NodeName, status Status) error {
+	if node == "" {
+		return errors.Codef(errors.CodeInvalid, "provided node name was empty")
+	}
+
+	rawStatus, err := fingerprintStatusToStatus(status)
+	if err != nil {
+		return err
+	}
+
+	return c.statusStore.SetStatus(statusstore.NODE, statusstore.ResourceID(node), c.namespace, rawStatus)
+}
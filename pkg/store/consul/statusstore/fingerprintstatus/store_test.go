@@ -0,0 +1,44 @@
+package fingerprintstatus
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/statusstoretest"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestSetAndGet(t *testing.T) {
+	store := NewConsul(statusstoretest.NewFake(), "fingerprints")
+
+	_, _, err := store.Get("node1")
+	if !statusstore.IsNoStatus(err) {
+		t.Fatalf("expected a NoStatusError before any status was written, got %v", err)
+	}
+
+	entry := Entry{
+		SHA:  "abc",
+		Time: time.Now().UTC(),
+		Fingerprint: Fingerprint{
+			OS:        "CentOS 7.2",
+			Kernel:    "3.10.0-327.el7.x86_64",
+			P2Version: "1.2.3",
+			Packages:  map[string]string{"openssl": "1.0.1e-42.el7"},
+		},
+	}
+	err = store.Set("node1", Status{Pods: map[types.PodID]Entry{"web": entry}})
+	if err != nil {
+		t.Fatalf("unexpected error setting fingerprint status: %s", err)
+	}
+
+	status, _, err := store.Get("node1")
+	if err != nil {
+		t.Fatalf("unexpected error getting fingerprint status: %s", err)
+	}
+	got := status.Pods["web"]
+	if got.SHA != entry.SHA || !got.Time.Equal(entry.Time) || !reflect.DeepEqual(got.Fingerprint, entry.Fingerprint) {
+		t.Errorf("expected %+v, got %+v", entry, got)
+	}
+}
@@ -0,0 +1,37 @@
+package hookstatus
+
+import (
+	"encoding/json"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
+	"github.com/square/p2/pkg/types"
+)
+
+// Status records the hooks run for the legacy pods on a node. Like their
+// process exits, the hook results of legacy pods are grouped per node,
+// while pods with a unique key have them in their own pod status.
+type Status struct {
+	Pods map[types.PodID][]podstatus.HookResult `json:"pods"`
+}
+
+func statusToHookStatus(rawStatus statusstore.Status) (Status, error) {
+	var hookStatus Status
+
+	err := json.Unmarshal(rawStatus.Bytes(), &hookStatus)
+	if err != nil {
+		return Status{}, errors.Errorf("Could not unmarshal raw status as hook status: %w", err)
+	}
+
+	return hookStatus, nil
+}
+
+func hookStatusToStatus(hookStatus Status) (statusstore.Status, error) {
+	bytes, err := json.Marshal(hookStatus)
+	if err != nil {
+		return statusstore.Status{}, errors.Errorf("Could not marshal hook status as json bytes: %w", err)
+	}
+
+	return statusstore.Status(bytes), nil
+}
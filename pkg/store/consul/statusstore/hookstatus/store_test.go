@@ -0,0 +1,42 @@
+package hookstatus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/statusstoretest"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestSetAndGet(t *testing.T) {
+	store := NewConsul(statusstoretest.NewFake(), "hooks")
+
+	_, _, err := store.Get("node1")
+	if !statusstore.IsNoStatus(err) {
+		t.Fatalf("expected a NoStatusError before any status was written, got %v", err)
+	}
+
+	result := podstatus.HookResult{
+		Hook:     "check_disk",
+		Event:    "before_install",
+		Time:     time.Now().UTC(),
+		Duration: time.Second,
+		ExitCode: 1,
+		Output:   "disk full\n",
+	}
+	err = store.Set("node1", Status{Pods: map[types.PodID][]podstatus.HookResult{"web": {result}}})
+	if err != nil {
+		t.Fatalf("unexpected error setting hook status: %s", err)
+	}
+
+	status, _, err := store.Get("node1")
+	if err != nil {
+		t.Fatalf("unexpected error getting hook status: %s", err)
+	}
+	results := status.Pods["web"]
+	if len(results) != 1 || results[0].Output != result.Output || results[0].ExitCode != 1 || !results[0].Time.Equal(result.Time) {
+		t.Errorf("expected %+v, got %+v", result, results)
+	}
+}
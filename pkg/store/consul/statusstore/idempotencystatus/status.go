@@ -0,0 +1,65 @@
+// Package idempotencystatus records the idempotency keys supplied by API
+// clients so that retried requests aren't applied twice. A record claims its
+// key when the request is first received, and stores the result of the
+// request once it has been applied. Records are only honored for a TTL, after
+// which the key may be reused.
+package idempotencystatus
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/types"
+)
+
+// Key is an idempotency key chosen by a client
+type Key string
+
+func (k Key) String() string { return string(k) }
+
+type Status struct {
+	// RequestHash identifies the request the key was first used with, so
+	// that reusing a key for a different request can be rejected
+	RequestHash string `json:"request_hash"`
+
+	// PodUniqueKey is the pod scheduled by the request. It is empty while
+	// the request is still being applied.
+	PodUniqueKey types.PodUniqueKey `json:"pod_unique_key,omitempty"`
+
+	// Created is the time at which the key was claimed
+	Created time.Time `json:"created"`
+}
+
+// Expired returns whether the record is older than ttl and should no longer
+// be honored
+func (s Status) Expired(now time.Time, ttl time.Duration) bool {
+	return now.Sub(s.Created) >= ttl
+}
+
+// InProgress returns whether the request that claimed the key hasn't been
+// applied yet
+func (s Status) InProgress() bool {
+	return s.PodUniqueKey == ""
+}
+
+func statusToIdempotencyStatus(rawStatus statusstore.Status) (Status, error) {
+	var status Status
+
+	err := json.Unmarshal(rawStatus.Bytes(), &status)
+	if err != nil {
+		return Status{}, errors.Errorf("Could not unmarshal raw status as idempotency status: %w", err)
+	}
+
+	return status, nil
+}
+
+func idempotencyStatusToStatus(status Status) (statusstore.Status, error) {
+	bytes, err := json.Marshal(status)
+	if err != nil {
+		return statusstore.Status{}, errors.Errorf("Could not marshal idempotency status as json bytes: %w", err)
+	}
+
+	return statusstore.Status(bytes), nil
+}
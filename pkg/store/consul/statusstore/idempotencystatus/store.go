@@ -0,0 +1,138 @@
+package idempotencystatus
+
+import (
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+
+	"github.com/hashicorp/consul/api"
+	context "golang.org/x/net/context"
+)
+
+// Keys are used as consul key segments so their length and characters are
+// restricted
+const maxKeyLength = 128
+
+type ConsulStore struct {
+	statusStore statusstore.Store
+
+	// The consul implementation statusstore.Store formats keys like
+	// /status/<resource-type>/<resource-id>/<namespace>. The namespace
+	// separates the keys of different API methods.
+	namespace statusstore.Namespace
+}
+
+func NewConsul(statusStore statusstore.Store, namespace statusstore.Namespace) ConsulStore {
+	return ConsulStore{
+		statusStore: statusStore,
+		namespace:   namespace,
+	}
+}
+
+// ValidateKey returns an error if key can't be used as an idempotency key
+func ValidateKey(key Key) error {
+	if key == "" {
+		return errors.Codef(errors.CodeInvalid, "idempotency key was empty")
+	}
+	if len(key) > maxKeyLength {
+		return errors.Errorf("idempotency key is longer than %d characters", maxKeyLength)
+	}
+	if strings.ContainsAny(key.String(), "/ ") {
+		return errors.Errorf("idempotency key %q may not contain slashes or spaces", key)
+	}
+	return nil
+}
+
+func (c ConsulStore) Get(key Key) (Status, *api.QueryMeta, error) {
+	err := ValidateKey(key)
+	if err != nil {
+		return Status{}, nil, err
+	}
+
+	rawStatus, queryMeta, err := c.statusStore.GetStatus(statusstore.IDEMPOTENCY_KEY, statusstore.ResourceID(key), c.namespace)
+	if err != nil {
+		return Status{}, queryMeta, err
+	}
+
+	status, err := statusToIdempotencyStatus(rawStatus)
+	if err != nil {
+		return Status{}, queryMeta, err
+	}
+
+	return status, queryMeta, nil
+}
+
+func (c ConsulStore) Set(key Key, status Status) error {
+	err := ValidateKey(key)
+	if err != nil {
+		return err
+	}
+
+	rawStatus, err := idempotencyStatusToStatus(status)
+	if err != nil {
+		return err
+	}
+
+	return c.statusStore.SetStatus(statusstore.IDEMPOTENCY_KEY, statusstore.ResourceID(key), c.namespace, rawStatus)
+}
+
+// CASTxn adds an operation to the transaction in ctx that writes status
+// if the record's modify index is still modifyIndex. A modifyIndex of 0
+// only writes the record if there isn't one, which is how a key is claimed.
+func (c ConsulStore) CASTxn(ctx context.Context, key Key, modifyIndex uint64, status Status) error {
+	err := ValidateKey(key)
+	if err != nil {
+		return err
+	}
+
+	rawStatus, err := idempotencyStatusToStatus(status)
+	if err != nil {
+		return err
+	}
+
+	return c.statusStore.CASStatus(ctx, statusstore.IDEMPOTENCY_KEY, statusstore.ResourceID(key), c.namespace, rawStatus, modifyIndex)
+}
+
+func (c ConsulStore) Delete(key Key) error {
+	err := ValidateKey(key)
+	if err != nil {
+		return err
+	}
+
+	return c.statusStore.DeleteStatus(statusstore.IDEMPOTENCY_KEY, statusstore.ResourceID(key), c.namespace)
+}
+
+// DeleteExpired deletes every record of the store's namespace that is older
+// than ttl, so that records don't accumulate forever. Expired records are
+// already ignored when read, so this is only housekeeping.
+func (c ConsulStore) DeleteExpired(ttl time.Duration) error {
+	allStatus, err := c.statusStore.GetAllStatusForResourceType(statusstore.IDEMPOTENCY_KEY)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for id, statusByNamespace := range allStatus {
+		rawStatus, ok := statusByNamespace[c.namespace]
+		if !ok {
+			continue
+		}
+
+		status, err := statusToIdempotencyStatus(rawStatus)
+		if err != nil {
+			return err
+		}
+		if !status.Expired(now, ttl) {
+			continue
+		}
+
+		err = c.statusStore.DeleteStatus(statusstore.IDEMPOTENCY_KEY, id, c.namespace)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
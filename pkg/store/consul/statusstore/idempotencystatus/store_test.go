@@ -0,0 +1,98 @@
+package idempotencystatus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/transaction"
+
+	context "golang.org/x/net/context"
+)
+
+func claim(t *testing.T, fixture consulutil.Fixture, store ConsulStore, key Key, modifyIndex uint64) bool {
+	ctx, cancel := transaction.New(context.Background())
+	defer cancel()
+
+	err := store.CASTxn(ctx, key, modifyIndex, Status{RequestHash: "abc", Created: time.Now()})
+	if err != nil {
+		t.Fatalf("Unexpected error adding CAS to transaction: %s", err)
+	}
+	ok, _, err := transaction.Commit(ctx, fixture.Client.KV())
+	if err != nil {
+		t.Fatalf("Unexpected error committing transaction: %s", err)
+	}
+	return ok
+}
+
+func TestClaimOnlyOnce(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+	store := NewConsul(statusstore.NewConsul(fixture.Client), "test")
+
+	if !claim(t, fixture, store, "deploy-1", 0) {
+		t.Fatal("Expected the first claim of a key to succeed")
+	}
+	if claim(t, fixture, store, "deploy-1", 0) {
+		t.Fatal("Expected a second claim of a key to fail")
+	}
+
+	status, _, err := store.Get("deploy-1")
+	if err != nil {
+		t.Fatalf("Unexpected error getting status: %s", err)
+	}
+	if !status.InProgress() {
+		t.Error("Expected a claimed key to be in progress")
+	}
+	if status.RequestHash != "abc" {
+		t.Errorf("Expected request hash %q but got %q", "abc", status.RequestHash)
+	}
+}
+
+func TestDeleteExpired(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+	store := NewConsul(statusstore.NewConsul(fixture.Client), "test")
+	otherStore := NewConsul(statusstore.NewConsul(fixture.Client), "other")
+
+	old := Status{RequestHash: "abc", PodUniqueKey: "some-pod", Created: time.Now().Add(-2 * time.Hour)}
+	err := store.Set("old", old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = otherStore.Set("old", old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Set("new", Status{RequestHash: "abc", PodUniqueKey: "some-pod", Created: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.DeleteExpired(time.Hour)
+	if err != nil {
+		t.Fatalf("Unexpected error deleting expired keys: %s", err)
+	}
+
+	if _, _, err = store.Get("old"); !statusstore.IsNoStatus(err) {
+		t.Errorf("Expected expired key to be deleted, got %v", err)
+	}
+	if _, _, err = store.Get("new"); err != nil {
+		t.Errorf("Expected unexpired key to be kept: %s", err)
+	}
+	if _, _, err = otherStore.Get("old"); err != nil {
+		t.Errorf("Expected keys of other namespaces to be kept: %s", err)
+	}
+}
+
+func TestValidateKey(t *testing.T) {
+	for _, key := range []Key{"", "a/b", "a b", Key(make([]byte, maxKeyLength+1))} {
+		if ValidateKey(key) == nil {
+			t.Errorf("Expected key %q to be invalid", key)
+		}
+	}
+	if err := ValidateKey("deploy-2017-06-01T12:00:00Z"); err != nil {
+		t.Errorf("Unexpected error validating key: %s", err)
+	}
+}
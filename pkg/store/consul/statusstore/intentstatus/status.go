@@ -0,0 +1,37 @@
+package intentstatus
+
+import (
+	"encoding/json"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
+	"github.com/square/p2/pkg/types"
+)
+
+// Status records the latest intent rejected by the intent validator for each
+// legacy pod on a node, until the pod is next launched. Pods with a unique key
+// have it in their own pod status.
+type Status struct {
+	Pods map[types.PodID]podstatus.IntentRejection `json:"pods"`
+}
+
+func statusToIntentStatus(rawStatus statusstore.Status) (Status, error) {
+	var intentStatus Status
+
+	err := json.Unmarshal(rawStatus.Bytes(), &intentStatus)
+	if err != nil {
+		return Status{}, errors.Errorf("Could not unmarshal raw status as intent status: %w", err)
+	}
+
+	return intentStatus, nil
+}
+
+func intentStatusToStatus(intentStatus Status) (statusstore.Status, error) {
+	bytes, err := json.Marshal(intentStatus)
+	if err != nil {
+		return statusstore.Status{}, errors.Errorf("Could not marshal intent status as json bytes: %w", err)
+	}
+
+	return statusstore.Status(bytes), nil
+}
@@ -0,0 +1,39 @@
+package intentstatus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/statusstoretest"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestSetAndGet(t *testing.T) {
+	store := NewConsul(statusstoretest.NewFake(), "intent_rejections")
+
+	_, _, err := store.Get("node1")
+	if !statusstore.IsNoStatus(err) {
+		t.Fatalf("expected a NoStatusError before any status was written, got %v", err)
+	}
+
+	rejection := podstatus.IntentRejection{
+		SHA:    "abc123",
+		Reason: "not enough capacity",
+		Time:   time.Now().UTC(),
+	}
+	err = store.Set("node1", Status{Pods: map[types.PodID]podstatus.IntentRejection{"web": rejection}})
+	if err != nil {
+		t.Fatalf("unexpected error setting intent status: %s", err)
+	}
+
+	status, _, err := store.Get("node1")
+	if err != nil {
+		t.Fatalf("unexpected error getting intent status: %s", err)
+	}
+	got := status.Pods["web"]
+	if got.SHA != rejection.SHA || got.Reason != rejection.Reason || !got.Time.Equal(rejection.Time) {
+		t.Errorf("expected %+v, got %+v", rejection, got)
+	}
+}
@@ -0,0 +1,85 @@
+package statusstore
+
+// The namespaces p2 writes statuses to itself
+const (
+	// Don't change this, it affects where status keys are read and written from
+	PreparerPodStatusNamespace Namespace = "preparer"
+	RCStatusNamespace          Namespace = "replication_controller"
+
+	// Pod resource usage is recorded per node, next to the preparer's node status
+	ResourceUsageStatusNamespace Namespace = "resource_usage"
+
+	// Process exits of legacy pods are recorded per node, since legacy
+	// pods have no pod status of their own
+	ProcessExitStatusNamespace Namespace = "process_exits"
+
+	// How long the last deploy of each legacy pod took, recorded per node
+	DeployTimingStatusNamespace Namespace = "deploy_timings"
+
+	// The output of the hooks run for each legacy pod, recorded per node
+	HookStatusNamespace Namespace = "hooks"
+
+	// The latest intent rejected for each legacy pod, recorded per node
+	IntentRejectionStatusNamespace Namespace = "intent_rejections"
+
+	// The prerequisites a node doesn't meet for each legacy pod that can't
+	// be installed there, recorded per node
+	PrerequisiteStatusNamespace Namespace = "prerequisite_failures"
+
+	// The restarts of each pod by the preparer's supervisor, recorded per
+	// node
+	RestartStatusNamespace Namespace = "restarts"
+
+	// The health of each node, aggregated from the health of its pods by
+	// the health monitor on that node
+	NodeHealthStatusNamespace Namespace = "node_health"
+
+	// The environment of a node when each legacy pod was last written to
+	// reality, recorded per node
+	FingerprintStatusNamespace Namespace = "fingerprints"
+
+	// Results of prefetching launchables ahead of a deploy, recorded per node
+	PrefetchStatusNamespace Namespace = "prefetch"
+
+	// The phases each node went through during the replications of a
+	// pod, recorded per pod
+	ReplicationEventStatusNamespace Namespace = "replication_events"
+
+	// Idempotency keys of SchedulePod calls to the pod store API server
+	SchedulePodIdempotencyNamespace Namespace = "schedule_pod"
+
+	// The daemon set farm's view of each daemon set
+	DaemonSetStatusNamespace Namespace = "daemon_set_farm"
+)
+
+// ReservedNamespaces are the namespaces above. Tools that let operators write
+// statuses of their own, like p2-status, should refuse to write to them
+// unless asked to. A namespace added above belongs here too.
+var ReservedNamespaces = []Namespace{
+	PreparerPodStatusNamespace,
+	RCStatusNamespace,
+	ResourceUsageStatusNamespace,
+	ProcessExitStatusNamespace,
+	DeployTimingStatusNamespace,
+	HookStatusNamespace,
+	IntentRejectionStatusNamespace,
+	PrerequisiteStatusNamespace,
+	RestartStatusNamespace,
+	NodeHealthStatusNamespace,
+	FingerprintStatusNamespace,
+	PrefetchStatusNamespace,
+	ReplicationEventStatusNamespace,
+	SchedulePodIdempotencyNamespace,
+	DaemonSetStatusNamespace,
+}
+
+// IsReserved returns whether p2 writes statuses to namespace itself, see
+// ReservedNamespaces
+func IsReserved(namespace Namespace) bool {
+	for _, reserved := range ReservedNamespaces {
+		if namespace == reserved {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package nodehealthstatus
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/types"
+)
+
+// State summarizes the health of every pod on a node
+type State string
+
+const (
+	// Every pod on the node is passing, or the node has no pods
+	Healthy State = "healthy"
+
+	// Some pods on the node aren't passing
+	Degraded State = "degraded"
+
+	// Enough pods on the node are critical that the node itself is likely
+	// at fault, so it shouldn't be given new pods
+	Critical State = "critical"
+)
+
+// Status is the health of a node as aggregated from the health of its pods by
+// the health monitor on that node. It is written only by the preparer on that
+// node.
+type Status struct {
+	State State `json:"state"`
+
+	// The gating health state of each pod on the node that isn't passing
+	FailingPods map[types.PodID]health.HealthState `json:"failing_pods,omitempty"`
+
+	// The number of pods on the node whose health is known
+	PodCount int `json:"pod_count"`
+
+	// When the status was written. Since a node that goes away stops
+	// updating its status, readers should ignore statuses that are too old,
+	// see Stale.
+	Updated time.Time `json:"updated"`
+}
+
+// Aggregate summarizes the gating health states of a node's pods. The node is
+// critical when at least criticalFraction of its pods are critical, degraded
+// when any pod isn't passing and healthy otherwise.
+func Aggregate(pods map[types.PodID]health.HealthState, criticalFraction float64, now time.Time) Status {
+	status := Status{
+		State:    Healthy,
+		PodCount: len(pods),
+		Updated:  now,
+	}
+	critical := 0
+	for id, state := range pods {
+		if state == health.Passing {
+			continue
+		}
+		if status.FailingPods == nil {
+			status.FailingPods = make(map[types.PodID]health.HealthState)
+		}
+		status.FailingPods[id] = state
+		if state == health.Critical {
+			critical++
+		}
+	}
+	switch {
+	case critical > 0 && float64(critical) >= criticalFraction*float64(len(pods)):
+		status.State = Critical
+	case len(status.FailingPods) > 0:
+		status.State = Degraded
+	}
+	return status
+}
+
+// Stale returns whether s was written longer than maxAge before now
+func (s Status) Stale(now time.Time, maxAge time.Duration) bool {
+	return now.Sub(s.Updated) > maxAge
+}
+
+// Equivalent returns whether s and other describe the same health, ignoring
+// when they were written
+func (s Status) Equivalent(other Status) bool {
+	if s.State != other.State || s.PodCount != other.PodCount || len(s.FailingPods) != len(other.FailingPods) {
+		return false
+	}
+	for id, state := range s.FailingPods {
+		if otherState, ok := other.FailingPods[id]; !ok || otherState != state {
+			return false
+		}
+	}
+	return true
+}
+
+func statusToNodeHealthStatus(rawStatus statusstore.Status) (Status, error) {
+	var nodeHealthStatus Status
+	err := json.Unmarshal(rawStatus.Bytes(), &nodeHealthStatus)
+	if err != nil {
+		return Status{}, errors.Errorf("Could not unmarshal raw status as node health status: %w", err)
+	}
+	return nodeHealthStatus, nil
+}
+
+func nodeHealthStatusToStatus(nodeHealthStatus Status) (statusstore.Status, error) {
+	bytes, err := json.Marshal(nodeHealthStatus)
+	if err != nil {
+		return statusstore.Status{}, errors.Errorf("Could not marshal node health status as json bytes: %w", err)
+	}
+	return statusstore.Status(bytes), nil
+}
@@ -0,0 +1,79 @@
+package nodehealthstatus
+
+import (
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/types"
+
+	"github.com/hashicorp/consul/api"
+)
+
+type ConsulStore struct {
+	statusStore statusstore.Store
+
+	// The consul implementation statusstore.Store formats keys like
+	// /status/<resource-type>/<resource-id>/<namespace>, and node health
+	// is kept under the node_health resource type rather than with the
+	// node's other statuses. The health of a node is only written by the
+	// health monitor on that node.
+	namespace statusstore.Namespace
+}
+
+func NewConsul(statusStore statusstore.Store, namespace statusstore.Namespace) ConsulStore {
+	return ConsulStore{
+		statusStore: statusStore,
+		namespace:   namespace,
+	}
+}
+
+func (c ConsulStore) Get(node types.NodeName) (Status, *api.QueryMeta, error) {
+	if node == "" {
+		return Status{}, nil, errors.Codef(errors.CodeInvalid, "provided node name was empty")
+	}
+
+	rawStatus, queryMeta, err := c.statusStore.GetStatus(statusstore.NODE_HEALTH, statusstore.ResourceID(node), c.namespace)
+	if err != nil {
+		return Status{}, queryMeta, err
+	}
+
+	status, err := statusToNodeHealthStatus(rawStatus)
+	if err != nil {
+		return Status{}, queryMeta, err
+	}
+	return status, queryMeta, nil
+}
+
+func (c ConsulStore) Set(node types.NodeName, status Status) error {
+	if node == "" {
+		return errors.Codef(errors.CodeInvalid, "provided node name was empty")
+	}
+
+	rawStatus, err := nodeHealthStatusToStatus(status)
+	if err != nil {
+		return err
+	}
+	return c.statusStore.SetStatus(statusstore.NODE_HEALTH, statusstore.ResourceID(node), c.namespace, rawStatus)
+}
+
+// List returns the health of every node that has published it in one read of
+// the node_health resource type
+func (c ConsulStore) List() (map[types.NodeName]Status, error) {
+	allStatus, err := c.statusStore.GetAllStatusForResourceType(statusstore.NODE_HEALTH)
+	if err != nil {
+		return nil, errors.Errorf("could not fetch all status for %s resource type: %w", statusstore.NODE_HEALTH, err)
+	}
+
+	ret := make(map[types.NodeName]Status)
+	for id, statusMap := range allStatus {
+		rawStatus, ok := statusMap[c.namespace]
+		if !ok {
+			continue
+		}
+		status, err := statusToNodeHealthStatus(rawStatus)
+		if err != nil {
+			return nil, errors.Errorf("could not read the health of %s: %w", id, err)
+		}
+		ret[types.NodeName(id)] = status
+	}
+	return ret, nil
+}
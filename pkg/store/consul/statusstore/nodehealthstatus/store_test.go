@@ -0,0 +1,125 @@
+package nodehealthstatus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/statusstoretest"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestSetAndGet(t *testing.T) {
+	store := NewConsul(statusstoretest.NewFake(), "node_health")
+	_, _, err := store.Get("node1")
+	if !statusstore.IsNoStatus(err) {
+		t.Fatalf("expected a NoStatusError before any status was written, got %v", err)
+	}
+
+	updated := time.Now().UTC()
+	err = store.Set("node1", Status{
+		State:       Degraded,
+		FailingPods: map[types.PodID]health.HealthState{"web": health.Warning},
+		PodCount:    3,
+		Updated:     updated,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error setting node health status: %s", err)
+	}
+
+	status, _, err := store.Get("node1")
+	if err != nil {
+		t.Fatalf("unexpected error getting node health status: %s", err)
+	}
+	if status.State != Degraded || status.FailingPods["web"] != health.Warning || status.PodCount != 3 || !status.Updated.Equal(updated) {
+		t.Errorf("expected a degraded node with a warning web pod, got %+v", status)
+	}
+}
+
+func TestList(t *testing.T) {
+	statusStore := statusstoretest.NewFake()
+	store := NewConsul(statusStore, "node_health")
+	for node, state := range map[types.NodeName]State{"node1": Healthy, "node2": Critical} {
+		err := store.Set(node, Status{State: state})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the other statuses of nodes aren't listed
+	err := statusStore.SetStatus(statusstore.NODE, "node3", "node_health", statusstore.Status("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err := store.List()
+	if err != nil {
+		t.Fatalf("unexpected error listing node health: %s", err)
+	}
+	if len(statuses) != 2 || statuses["node1"].State != Healthy || statuses["node2"].State != Critical {
+		t.Errorf("expected node1 healthy and node2 critical, got %+v", statuses)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	now := time.Now()
+	type testCase struct {
+		pods     map[types.PodID]health.HealthState
+		expected State
+		failing  int
+	}
+	for name, tc := range map[string]testCase{
+		"no pods": {
+			pods:     nil,
+			expected: Healthy,
+		},
+		"all passing": {
+			pods:     map[types.PodID]health.HealthState{"a": health.Passing, "b": health.Passing},
+			expected: Healthy,
+		},
+		"one warning": {
+			pods:     map[types.PodID]health.HealthState{"a": health.Passing, "b": health.Warning},
+			expected: Degraded,
+			failing:  1,
+		},
+		"critical below the fraction": {
+			pods:     map[types.PodID]health.HealthState{"a": health.Passing, "b": health.Passing, "c": health.Critical},
+			expected: Degraded,
+			failing:  1,
+		},
+		"critical at the fraction": {
+			pods:     map[types.PodID]health.HealthState{"a": health.Passing, "b": health.Critical},
+			expected: Critical,
+			failing:  1,
+		},
+		"unknown doesn't count as critical": {
+			pods:     map[types.PodID]health.HealthState{"a": health.Unknown, "b": health.Unknown},
+			expected: Degraded,
+			failing:  2,
+		},
+	} {
+		status := Aggregate(tc.pods, 0.5, now)
+		if status.State != tc.expected {
+			t.Errorf("%s: expected the node to be %s, was %s", name, tc.expected, status.State)
+		}
+		if len(status.FailingPods) != tc.failing {
+			t.Errorf("%s: expected %d failing pods, got %v", name, tc.failing, status.FailingPods)
+		}
+		if status.PodCount != len(tc.pods) || !status.Updated.Equal(now) {
+			t.Errorf("%s: unexpected pod count or update time in %+v", name, status)
+		}
+	}
+}
+
+func TestEquivalent(t *testing.T) {
+	now := time.Now()
+	pods := map[types.PodID]health.HealthState{"a": health.Passing, "b": health.Critical}
+	status := Aggregate(pods, 0.5, now)
+	if !status.Equivalent(Aggregate(pods, 0.5, now.Add(time.Minute))) {
+		t.Error("expected statuses that differ only in when they were written to be equivalent")
+	}
+	pods["b"] = health.Warning
+	if status.Equivalent(Aggregate(pods, 0.5, now)) {
+		t.Error("expected statuses whose failing pods differ not to be equivalent")
+	}
+}
@@ -0,0 +1,109 @@
+package nodestatus
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/types"
+
+	"github.com/hashicorp/consul/api"
+)
+
+type NodeState string
+
+func (n NodeState) String() string { return string(n) }
+
+const (
+	// NodeRunning signifies that the preparer on the node is up and
+	// processing intent normally
+	NodeRunning NodeState = "running"
+
+	// NodeShuttingDown signifies that the host is being taken out of
+	// service and the preparer has started (or finished) stopping every pod
+	// on it. Pods on a node in this state are expected to disappear, so
+	// rollout tooling should not count them as failures
+	NodeShuttingDown NodeState = "shutting_down"
+)
+
+type ConditionType string
+
+const (
+	// ClockSkewed signifies that the node's clock is further from its
+	// reference clock than the preparer tolerates, so times written by the
+	// node, such as the expiry of its health results, can't be trusted
+	ClockSkewed ConditionType = "clock_skewed"
+)
+
+// Condition is a problem with the node that the preparer has detected. A
+// condition is only present in the status while it holds.
+type Condition struct {
+	// Since is when the condition was detected
+	Since time.Time `json:"since"`
+
+	Message string `json:"message,omitempty"`
+}
+
+// Status encapsulates the preparer's view of the node it is running on.
+type Status struct {
+	State NodeState `json:"state"`
+
+	// StateChanged is the time at which State was last written
+	StateChanged time.Time `json:"state_changed"`
+
+	Conditions map[ConditionType]Condition `json:"conditions,omitempty"`
+}
+
+// HasCondition returns whether the given condition holds for the node.
+func (s Status) HasCondition(condition ConditionType) bool {
+	_, ok := s.Conditions[condition]
+	return ok
+}
+
+// IsShuttingDown is a convenience for callers that only want to know whether
+// a node should be excluded from health gating.
+func (s Status) IsShuttingDown() bool {
+	return s.State == NodeShuttingDown
+}
+
+// Reader reads the status the preparers record for their nodes
+type Reader interface {
+	Get(node types.NodeName) (Status, *api.QueryMeta, error)
+}
+
+// ShuttingDown returns whether the node's preparer has marked it as shutting
+// down. A node without a status, or a nil store, is not shutting down.
+func ShuttingDown(store Reader, node types.NodeName) (bool, error) {
+	if store == nil {
+		return false, nil
+	}
+	status, _, err := store.Get(node)
+	if statusstore.IsNoStatus(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return status.IsShuttingDown(), nil
+}
+
+func statusToNodeStatus(rawStatus statusstore.Status) (Status, error) {
+	var nodeStatus Status
+
+	err := json.Unmarshal(rawStatus.Bytes(), &nodeStatus)
+	if err != nil {
+		return Status{}, errors.Errorf("Could not unmarshal raw status as node status: %w", err)
+	}
+
+	return nodeStatus, nil
+}
+
+func nodeStatusToStatus(nodeStatus Status) (statusstore.Status, error) {
+	bytes, err := json.Marshal(nodeStatus)
+	if err != nil {
+		return statusstore.Status{}, errors.Errorf("Could not marshal node status as json bytes: %w", err)
+	}
+
+	return statusstore.Status(bytes), nil
+}
@@ -0,0 +1,105 @@
+package nodestatus
+
+import (
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/types"
+
+	"github.com/hashicorp/consul/api"
+	context "golang.org/x/net/context"
+)
+
+type ConsulStore struct {
+	statusStore statusstore.Store
+
+	// The consul implementation statusstore.Store formats keys like
+	// /status/<resource-type>/<resource-id>/<namespace>. The namespace
+	// portion is useful if multiple subsystems need to record their
+	// own view of a resource.
+	namespace statusstore.Namespace
+}
+
+func NewConsul(statusStore statusstore.Store, namespace statusstore.Namespace) ConsulStore {
+	return ConsulStore{
+		statusStore: statusStore,
+		namespace:   namespace,
+	}
+}
+
+func (c ConsulStore) Get(node types.NodeName) (Status, *api.QueryMeta, error) {
+	if node == "" {
+		return Status{}, nil, errors.Codef(errors.CodeInvalid, "provided node name was empty")
+	}
+
+	rawStatus, queryMeta, err := c.statusStore.GetStatus(statusstore.NODE, statusstore.ResourceID(node), c.namespace)
+	if err != nil {
+		return Status{}, queryMeta, err
+	}
+
+	status, err := statusToNodeStatus(rawStatus)
+	if err != nil {
+		return Status{}, queryMeta, err
+	}
+
+	return status, queryMeta, nil
+}
+
+func (c ConsulStore) Set(node types.NodeName, status Status) error {
+	if node == "" {
+		return errors.Codef(errors.CodeInvalid, "provided node name was empty")
+	}
+
+	rawStatus, err := nodeStatusToStatus(status)
+	if err != nil {
+		return err
+	}
+
+	return c.statusStore.SetStatus(statusstore.NODE, statusstore.ResourceID(node), c.namespace, rawStatus)
+}
+
+// CAS adds an operation to the transaction within ctx that writes status only
+// if the node's status is still at modifyIndex
+func (c ConsulStore) CAS(ctx context.Context, node types.NodeName, status Status, modifyIndex uint64) error {
+	if node == "" {
+		return errors.Codef(errors.CodeInvalid, "provided node name was empty")
+	}
+
+	rawStatus, err := nodeStatusToStatus(status)
+	if err != nil {
+		return err
+	}
+
+	return c.statusStore.CASStatus(ctx, statusstore.NODE, statusstore.ResourceID(node), c.namespace, rawStatus, modifyIndex)
+}
+
+// MutateStatus reads the node's status, passes it to mutator and adds a CAS
+// of the result to the transaction within ctx, so the write fails if anything
+// else changed the status in between.
+func (c ConsulStore) MutateStatus(ctx context.Context, node types.NodeName, mutator func(Status) (Status, error)) error {
+	var lastIndex uint64
+	status, queryMeta, err := c.Get(node)
+	switch {
+	case statusstore.IsNoStatus(err):
+		// An index of 0 makes sure the key still doesn't exist when we
+		// set it
+		lastIndex = 0
+	case err != nil:
+		return err
+	default:
+		lastIndex = queryMeta.LastIndex
+	}
+
+	newStatus, err := mutator(status)
+	if err != nil {
+		return err
+	}
+	return c.CAS(ctx, node, newStatus, lastIndex)
+}
+
+func (c ConsulStore) Delete(node types.NodeName) error {
+	if node == "" {
+		return errors.Codef(errors.CodeInvalid, "provided node name was empty")
+	}
+
+	return c.statusStore.DeleteStatus(statusstore.NODE, statusstore.ResourceID(node), c.namespace)
+}
@@ -0,0 +1,133 @@
+package nodestatus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/consulutil/consulutiltest"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/statusstoretest"
+	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestSetAndGet(t *testing.T) {
+	store := NewConsul(statusstoretest.NewFake(), "preparer")
+
+	_, _, err := store.Get("node1")
+	if !statusstore.IsNoStatus(err) {
+		t.Fatalf("expected a NoStatusError before any status was written, got %v", err)
+	}
+
+	now := time.Now().UTC()
+	err = store.Set("node1", Status{State: NodeShuttingDown, StateChanged: now})
+	if err != nil {
+		t.Fatalf("unexpected error setting node status: %s", err)
+	}
+
+	status, _, err := store.Get("node1")
+	if err != nil {
+		t.Fatalf("unexpected error getting node status: %s", err)
+	}
+	if !status.IsShuttingDown() {
+		t.Errorf("expected node to be shutting down, was %q", status.State)
+	}
+	if !status.StateChanged.Equal(now) {
+		t.Errorf("expected state change time %s, got %s", now, status.StateChanged)
+	}
+
+	err = store.Delete("node1")
+	if err != nil {
+		t.Fatalf("unexpected error deleting node status: %s", err)
+	}
+	_, _, err = store.Get("node1")
+	if !statusstore.IsNoStatus(err) {
+		t.Fatalf("expected a NoStatusError after deleting status, got %v", err)
+	}
+}
+
+func TestEmptyNodeRejected(t *testing.T) {
+	store := NewConsul(statusstoretest.NewFake(), "preparer")
+
+	if err := store.Set("", Status{State: NodeRunning}); err == nil {
+		t.Error("expected an error setting status for an empty node name")
+	}
+	if _, _, err := store.Get(""); err == nil {
+		t.Error("expected an error getting status for an empty node name")
+	}
+}
+
+func TestShuttingDown(t *testing.T) {
+	store := NewConsul(statusstoretest.NewFake(), "preparer")
+	err := store.Set("running", Status{State: NodeRunning})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Set("stopping", Status{State: NodeShuttingDown})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for node, expected := range map[string]bool{
+		"running":  false,
+		"stopping": true,
+		"unknown":  false,
+	} {
+		shuttingDown, err := ShuttingDown(store, types.NodeName(node))
+		if err != nil {
+			t.Fatalf("unexpected error reading %s: %s", node, err)
+		}
+		if shuttingDown != expected {
+			t.Errorf("expected %s shutting down to be %t", node, expected)
+		}
+	}
+
+	shuttingDown, err := ShuttingDown(nil, "stopping")
+	if err != nil || shuttingDown {
+		t.Errorf("expected no node to be shutting down without a store, got %t, %v", shuttingDown, err)
+	}
+}
+
+func TestMutateStatusFailsIfStatusChanged(t *testing.T) {
+	client := consulutiltest.NewConsul()
+	store := NewConsul(statusstore.NewConsul(client), "preparer")
+	err := store.Set("node1", Status{State: NodeRunning})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
+	err = store.MutateStatus(ctx, "node1", func(status Status) (Status, error) {
+		if status.State != NodeRunning {
+			t.Errorf("expected mutator to be passed the stored state, got %q", status.State)
+		}
+		status.State = NodeShuttingDown
+		return status, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another writer gets in between the read and the commit
+	err = store.Set("node1", Status{State: NodeRunning, Conditions: map[ConditionType]Condition{ClockSkewed: {}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, _, err := transaction.Commit(ctx, client.KV())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("expected the transaction to roll back after the status changed")
+	}
+	status, _, err := store.Get("node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.HasCondition(ClockSkewed) {
+		t.Error("expected the other writer's status to be kept")
+	}
+}
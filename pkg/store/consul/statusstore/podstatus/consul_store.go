@@ -3,11 +3,11 @@ package podstatus
 import (
 	"encoding/json"
 
+	"github.com/square/p2/pkg/errors"
 	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/store/consul/podstore"
 	"github.com/square/p2/pkg/store/consul/statusstore"
 	"github.com/square/p2/pkg/types"
-	"github.com/square/p2/pkg/util"
 
 	"github.com/hashicorp/consul/api"
 	context "golang.org/x/net/context"
@@ -25,7 +25,7 @@ type ConsulStore struct {
 
 // TODO: this pod store is coupled with the PodStatus struct, which represents
 // the book keeping that the preparer does about a pod. In other words it only
-// makes sense if the namespace is consul.PreparerPodStatusNamespace. We should
+// makes sense if the namespace is statusstore.PreparerPodStatusNamespace. We should
 // probably take namespace out of all these APIs and use that constant instead.
 func NewConsul(statusStore statusstore.Store, namespace statusstore.Namespace) ConsulStore {
 	return ConsulStore{
@@ -36,7 +36,7 @@ func NewConsul(statusStore statusstore.Store, namespace statusstore.Namespace) C
 
 func (c ConsulStore) Get(key types.PodUniqueKey) (PodStatus, *api.QueryMeta, error) {
 	if key == "" {
-		return PodStatus{}, nil, util.Errorf("Cannot retrieve status for a pod with an empty uuid")
+		return PodStatus{}, nil, errors.Codef(errors.CodeInvalid, "Cannot retrieve status for a pod with an empty uuid")
 	}
 
 	status, queryMeta, err := c.statusStore.GetStatus(statusstore.POD, statusstore.ResourceID(key), c.namespace)
@@ -54,7 +54,7 @@ func (c ConsulStore) Get(key types.PodUniqueKey) (PodStatus, *api.QueryMeta, err
 
 func (c ConsulStore) WaitForStatus(key types.PodUniqueKey, waitIndex uint64) (PodStatus, *api.QueryMeta, error) {
 	if key == "" {
-		return PodStatus{}, nil, util.Errorf("Cannot retrieve status for a pod with an empty uuid")
+		return PodStatus{}, nil, errors.Codef(errors.CodeInvalid, "Cannot retrieve status for a pod with an empty uuid")
 	}
 
 	status, queryMeta, err := c.statusStore.WatchStatus(statusstore.POD, statusstore.ResourceID(key), c.namespace, waitIndex)
@@ -76,7 +76,7 @@ func (c ConsulStore) GetStatusFromIndex(index podstore.PodIndex) (PodStatus, *ap
 
 func (c ConsulStore) Set(key types.PodUniqueKey, status PodStatus) error {
 	if key == "" {
-		return util.Errorf("Could not set status for pod with empty uuid")
+		return errors.Codef(errors.CodeInvalid, "Could not set status for pod with empty uuid")
 	}
 
 	rawStatus, err := podStatusToStatus(status)
@@ -89,7 +89,7 @@ func (c ConsulStore) Set(key types.PodUniqueKey, status PodStatus) error {
 
 func (c ConsulStore) CAS(ctx context.Context, key types.PodUniqueKey, status PodStatus, modifyIndex uint64) error {
 	if key == "" {
-		return util.Errorf("Could not set status for pod with empty uuid")
+		return errors.Codef(errors.CodeInvalid, "Could not set status for pod with empty uuid")
 	}
 
 	rawStatus, err := podStatusToStatus(status)
@@ -126,24 +126,13 @@ func (c ConsulStore) MutateStatus(ctx context.Context, key types.PodUniqueKey, m
 	return c.CAS(ctx, key, newStatus, lastIndex)
 }
 
-// A helper method for updating the LastExit field of one of the processes in a
-// pod. Searches through p.ProcessStatuses for a process matching the
-// launchable ID and launchableScriptName, and mutates its LastExit if found.
-// If not found, a new process is added.
+// A helper method for recording the exit of one of the processes in a pod.
+// Searches through p.ProcessStatuses for a process matching the launchable ID
+// and entry point, and updates its LastExit (and AbnormalExits if the exit
+// was abnormal) if found. If not found, a new process is added.
 func (c ConsulStore) SetLastExit(ctx context.Context, podUniqueKey types.PodUniqueKey, launchableID launch.LaunchableID, entryPoint string, exitStatus ExitStatus) error {
 	mutator := func(p PodStatus) (PodStatus, error) {
-		for _, processStatus := range p.ProcessStatuses {
-			if processStatus.LaunchableID == launchableID && processStatus.EntryPoint == entryPoint {
-				processStatus.LastExit = &exitStatus
-				return p, nil
-			}
-		}
-
-		p.ProcessStatuses = append(p.ProcessStatuses, ProcessStatus{
-			LaunchableID: launchableID,
-			EntryPoint:   entryPoint,
-			LastExit:     &exitStatus,
-		})
+		p.ProcessStatuses = RecordExit(p.ProcessStatuses, launchableID, entryPoint, exitStatus)
 		return p, nil
 	}
 
@@ -154,7 +143,7 @@ func (c ConsulStore) SetLastExit(ctx context.Context, podUniqueKey types.PodUniq
 func (c ConsulStore) List() (map[types.PodUniqueKey]PodStatus, error) {
 	allStatus, err := c.statusStore.GetAllStatusForResourceType(statusstore.POD)
 	if err != nil {
-		return nil, util.Errorf("could not fetch all status for %s resource type: %s", statusstore.POD, err)
+		return nil, errors.Errorf("could not fetch all status for %s resource type: %w", statusstore.POD, err)
 	}
 
 	ret := make(map[types.PodUniqueKey]PodStatus)
@@ -162,13 +151,13 @@ func (c ConsulStore) List() (map[types.PodUniqueKey]PodStatus, error) {
 		if status, ok := statusMap[c.namespace]; ok {
 			podUniqueKey, err := types.ToPodUniqueKey(id.String())
 			if err != nil {
-				return nil, util.Errorf("got status record with ID %s that could not be converted to pod unique key: %s", id, err)
+				return nil, errors.Errorf("got status record with ID %s that could not be converted to pod unique key: %w", id, err)
 			}
 
 			var podStatus PodStatus
 			err = json.Unmarshal(status.Bytes(), &podStatus)
 			if err != nil {
-				return nil, util.Errorf("could not unmarshal status for %s as JSON (raw status=%q): %s", podUniqueKey, string(status.Bytes()), err)
+				return nil, errors.Errorf("could not unmarshal status for %s as JSON (raw status=%q): %w", podUniqueKey, string(status.Bytes()), err)
 			}
 			ret[podUniqueKey] = podStatus
 		}
@@ -179,7 +168,7 @@ func (c ConsulStore) List() (map[types.PodUniqueKey]PodStatus, error) {
 
 func (c ConsulStore) Delete(podUniqueKey types.PodUniqueKey) error {
 	if podUniqueKey == "" {
-		return util.Errorf("pod unique key cannot be empty")
+		return errors.Codef(errors.CodeInvalid, "pod unique key cannot be empty")
 	}
 
 	return c.statusStore.DeleteStatus(statusstore.POD, statusstore.ResourceID(podUniqueKey.String()), c.namespace)
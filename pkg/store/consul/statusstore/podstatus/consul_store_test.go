@@ -1,11 +1,13 @@
 package podstatus
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/square/p2/pkg/store/consul/statusstore"
 	"github.com/square/p2/pkg/store/consul/statusstore/statusstoretest"
 	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/version"
 )
 
 func TestSetAndGetStatus(t *testing.T) {
@@ -37,9 +39,13 @@ func TestSetAndGetStatus(t *testing.T) {
 		t.Fatalf("Expected one service status entry, but there were %d", len(status.ProcessStatuses))
 	}
 
-	if status.ProcessStatuses[0] != processStatus {
+	if !reflect.DeepEqual(status.ProcessStatuses[0], processStatus) {
 		t.Errorf("Status entry expected to be '%+v', was %+v", processStatus, status.ProcessStatuses[0])
 	}
+
+	if status.Build == nil || status.Build.Version != version.VERSION {
+		t.Errorf("Expected the status to record the build that wrote it, was %+v", status.Build)
+	}
 }
 
 func TestDelete(t *testing.T) {
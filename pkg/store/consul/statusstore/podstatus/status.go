@@ -4,9 +4,11 @@ import (
 	"encoding/json"
 	"time"
 
+	"github.com/square/p2/pkg/errors"
 	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/store/consul/statusstore"
-	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/store/consul/statusstore/fingerprintstatus"
+	"github.com/square/p2/pkg/version"
 )
 
 type PodState string
@@ -29,19 +31,154 @@ const (
 	PodFailed PodState = "failed"
 )
 
-// Encapsulates information relating to the exit of a process.
+// The number of abnormal exits remembered for each process
+const MaxAbnormalExits = 10
+
+// Encapsulates information relating to the exit of a process. ExitCode and
+// ExitStatus are the arguments runit passes to a service's ./finish script:
+// if the process was killed by a signal, ExitCode is -1 and ExitStatus is the
+// signal number.
 type ExitStatus struct {
 	ExitTime   time.Time `json:"time"`
 	ExitCode   int       `json:"exit_code"`
 	ExitStatus int       `json:"exit_status"`
+
+	// Set if the process was killed by the kernel because its launchable's
+	// cgroup ran out of memory
+	OOMKilled bool `json:"oom_killed,omitempty"`
+}
+
+// Abnormal returns whether the process failed or was killed rather than
+// exiting successfully
+func (e ExitStatus) Abnormal() bool {
+	return e.ExitCode != 0 || e.OOMKilled
 }
 
-// Encapsulates information regarding the state of a process. Currently only
-// information about the last exit is exposed.
+// Encapsulates information regarding the state of a process: its last exit,
+// and a history of its recent abnormal exits.
 type ProcessStatus struct {
 	LaunchableID launch.LaunchableID `json:"launchable_id"`
 	EntryPoint   string              `json:"entry_point"`
 	LastExit     *ExitStatus         `json:"last_exit"`
+
+	// The most recent abnormal exits, oldest first. At most
+	// MaxAbnormalExits are kept
+	AbnormalExits []ExitStatus `json:"abnormal_exits,omitempty"`
+}
+
+// RecordExit records an exit of the process matching the launchable ID and
+// entry point in processStatuses, adding the process if it isn't found.
+func RecordExit(processStatuses []ProcessStatus, launchableID launch.LaunchableID, entryPoint string, exitStatus ExitStatus) []ProcessStatus {
+	i := 0
+	for ; i < len(processStatuses); i++ {
+		if processStatuses[i].LaunchableID == launchableID && processStatuses[i].EntryPoint == entryPoint {
+			break
+		}
+	}
+	if i == len(processStatuses) {
+		processStatuses = append(processStatuses, ProcessStatus{
+			LaunchableID: launchableID,
+			EntryPoint:   entryPoint,
+		})
+	}
+
+	processStatus := &processStatuses[i]
+	processStatus.LastExit = &exitStatus
+	if exitStatus.Abnormal() {
+		processStatus.AbnormalExits = append(processStatus.AbnormalExits, exitStatus)
+		if excess := len(processStatus.AbnormalExits) - MaxAbnormalExits; excess > 0 {
+			processStatus.AbnormalExits = processStatus.AbnormalExits[excess:]
+		}
+	}
+	return processStatuses
+}
+
+// The most output of a hook that is kept. Only the end of the output of a
+// hook that prints more is kept, since that is where errors usually are.
+const MaxHookOutputBytes = 4096
+
+// HookResult records a run of a hook for a pod
+type HookResult struct {
+	// The name of the hook's executable
+	Hook string `json:"hook"`
+	// The hook event, e.g. "before_install"
+	Event    string        `json:"event"`
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration"`
+
+	// -1 if the hook didn't exit, e.g. because it timed out or couldn't
+	// be started
+	ExitCode int    `json:"exit_code"`
+	TimedOut bool   `json:"timed_out,omitempty"`
+	Error    string `json:"error,omitempty"`
+
+	// The hook's combined stdout and stderr, at most MaxHookOutputBytes of
+	// it. Not recorded for hooks that time out
+	Output          string `json:"output,omitempty"`
+	OutputTruncated bool   `json:"output_truncated,omitempty"`
+
+	// How many times the hook was run, if its policy allowed it to be
+	// retried. The rest of the result is of the last run
+	Attempts int `json:"attempts,omitempty"`
+
+	// Set if the hook failed and its policy marks the pod as degraded
+	// when it does
+	Degraded bool `json:"degraded,omitempty"`
+}
+
+// Failed returns whether the hook didn't run to a successful exit
+func (r HookResult) Failed() bool {
+	return r.ExitCode != 0 || r.TimedOut || r.Error != ""
+}
+
+// HooksDegraded returns whether any of the results marks the pod as degraded
+func HooksDegraded(results []HookResult) bool {
+	for _, result := range results {
+		if result.Degraded {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordHookResults replaces the results of the event's hooks in hookResults
+// with results, keeping the results of other events
+func RecordHookResults(hookResults []HookResult, event string, results []HookResult) []HookResult {
+	merged := make([]HookResult, 0, len(hookResults)+len(results))
+	for _, result := range hookResults {
+		if result.Event != event {
+			merged = append(merged, result)
+		}
+	}
+	return append(merged, results...)
+}
+
+// IntentRejection records that an intent manifest for a pod was rejected by
+// the preparer's intent validator and therefore was not enacted.
+type IntentRejection struct {
+	// The SHA of the rejected manifest
+	SHA    string    `json:"sha"`
+	Reason string    `json:"reason"`
+	Time   time.Time `json:"time"`
+}
+
+// PrerequisiteFailure records that a pod's intent manifest could not be
+// installed because the host does not meet the prerequisites it declares.
+type PrerequisiteFailure struct {
+	// The SHA of the manifest that could not be installed
+	SHA   string              `json:"sha"`
+	Unmet []UnmetPrerequisite `json:"unmet"`
+	Time  time.Time           `json:"time"`
+}
+
+// UnmetPrerequisite describes a single prerequisite the host does not meet.
+type UnmetPrerequisite struct {
+	// One of "kernel_version", "package", "sysctl" or "mount"
+	Kind string `json:"kind"`
+	// What is required, e.g. the package or sysctl name
+	Name     string `json:"name"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
 }
 
 // Encapsulates the state of all processes running in a pod.
@@ -52,6 +189,23 @@ type PodStatus struct {
 	// String representing the pod manifest for the running pod. Will be
 	// empty if it hasn't yet been launched
 	Manifest string `json:"manifest"`
+
+	// Set if the latest intent for the pod was rejected, cleared when a
+	// manifest is launched
+	IntentRejection *IntentRejection `json:"intent_rejection,omitempty"`
+
+	// Set while the latest intent for the pod can't be installed because the
+	// host doesn't meet its prerequisites, cleared when a manifest is launched
+	PrerequisiteFailure *PrerequisiteFailure `json:"prerequisite_failure,omitempty"`
+
+	// The last run of each hook, for each hook event the pod went through
+	HookResults []HookResult `json:"hook_results,omitempty"`
+
+	// The environment of the host when Manifest was launched
+	Fingerprint *fingerprintstatus.Fingerprint `json:"fingerprint,omitempty"`
+
+	// The build of P2 that last wrote the status
+	Build *version.Info `json:"build,omitempty"`
 }
 
 func statusToPodStatus(rawStatus statusstore.Status) (PodStatus, error) {
@@ -59,16 +213,20 @@ func statusToPodStatus(rawStatus statusstore.Status) (PodStatus, error) {
 
 	err := json.Unmarshal(rawStatus.Bytes(), &podStatus)
 	if err != nil {
-		return PodStatus{}, util.Errorf("Could not unmarshal raw status as pod status: %s", err)
+		return PodStatus{}, errors.Errorf("Could not unmarshal raw status as pod status: %w", err)
 	}
 
 	return podStatus, nil
 }
 
+// podStatusToStatus records the running build in the status, since every
+// write goes through it
 func podStatusToStatus(podStatus PodStatus) (statusstore.Status, error) {
+	build := version.Current()
+	podStatus.Build = &build
 	bytes, err := json.Marshal(podStatus)
 	if err != nil {
-		return statusstore.Status{}, util.Errorf("Could not marshal pod status as json bytes: %s", err)
+		return statusstore.Status{}, errors.Errorf("Could not marshal pod status as json bytes: %w", err)
 	}
 
 	return statusstore.Status(bytes), nil
@@ -0,0 +1,45 @@
+package podstatus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecordExit(t *testing.T) {
+	now := time.Now()
+	clean := ExitStatus{ExitTime: now, ExitCode: 0}
+	killed := ExitStatus{ExitTime: now.Add(time.Second), ExitCode: -1, ExitStatus: 9, OOMKilled: true}
+
+	statuses := RecordExit(nil, "app", "launch", clean)
+	statuses = RecordExit(statuses, "app", "worker", clean)
+	statuses = RecordExit(statuses, "app", "launch", killed)
+
+	if len(statuses) != 2 {
+		t.Fatalf("expected 2 processes, got %d", len(statuses))
+	}
+	launch := statuses[0]
+	if launch.LastExit == nil || *launch.LastExit != killed {
+		t.Errorf("expected the last exit to be updated to %+v, got %+v", killed, launch.LastExit)
+	}
+	if len(launch.AbnormalExits) != 1 || launch.AbnormalExits[0] != killed {
+		t.Errorf("expected the OOM kill to be recorded as an abnormal exit, got %+v", launch.AbnormalExits)
+	}
+	if len(statuses[1].AbnormalExits) != 0 {
+		t.Errorf("expected a clean exit not to be recorded as abnormal, got %+v", statuses[1].AbnormalExits)
+	}
+}
+
+func TestRecordExitKeepsRecentAbnormalExits(t *testing.T) {
+	var statuses []ProcessStatus
+	for i := 0; i < MaxAbnormalExits+3; i++ {
+		statuses = RecordExit(statuses, "app", "launch", ExitStatus{ExitCode: i + 1})
+	}
+
+	exits := statuses[0].AbnormalExits
+	if len(exits) != MaxAbnormalExits {
+		t.Fatalf("expected %d abnormal exits to be kept, got %d", MaxAbnormalExits, len(exits))
+	}
+	if exits[0].ExitCode != 4 || exits[len(exits)-1].ExitCode != MaxAbnormalExits+3 {
+		t.Errorf("expected the oldest exits to be dropped, got %+v", exits)
+	}
+}
@@ -0,0 +1,64 @@
+package prefetchstatus
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/types"
+)
+
+// Result is the outcome of the preparer's attempt to download and install
+// the launchables of a prefetched manifest ahead of a deploy
+type Result struct {
+	// SHA is the SHA of the prefetched manifest
+	SHA string `json:"sha"`
+
+	// Error is empty if the launchables were installed successfully
+	Error string `json:"error,omitempty"`
+
+	Time time.Time `json:"time"`
+}
+
+// Succeeded reports whether the manifest with the given SHA was prefetched
+func (r Result) Succeeded(sha string) bool {
+	return r.SHA == sha && r.Error == ""
+}
+
+// Failed reports whether the manifest with the given SHA could not be
+// prefetched
+func (r Result) Failed(sha string) bool {
+	return r.SHA == sha && r.Error != ""
+}
+
+// Status holds the results of the prefetch requests for a node, by pod ID.
+// It only has entries for pods that currently have a prefetch request.
+type Status struct {
+	Pods map[types.PodID]Result `json:"pods"`
+
+	// WarmedUp is when the preparer prefetched the launchables of the
+	// replication controllers that the node is eligible for, which it does
+	// once after the node joins. Zero if it hasn't
+	WarmedUp time.Time `json:"warmed_up"`
+}
+
+func statusToPrefetchStatus(rawStatus statusstore.Status) (Status, error) {
+	var prefetchStatus Status
+
+	err := json.Unmarshal(rawStatus.Bytes(), &prefetchStatus)
+	if err != nil {
+		return Status{}, errors.Errorf("Could not unmarshal raw status as prefetch status: %w", err)
+	}
+
+	return prefetchStatus, nil
+}
+
+func prefetchStatusToStatus(prefetchStatus Status) (statusstore.Status, error) {
+	bytes, err := json.Marshal(prefetchStatus)
+	if err != nil {
+		return statusstore.Status{}, errors.Errorf("Could not marshal prefetch status as json bytes: %w", err)
+	}
+
+	return statusstore.Status(bytes), nil
+}
@@ -0,0 +1,52 @@
+package prefetchstatus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/statusstoretest"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestSetAndGet(t *testing.T) {
+	store := NewConsul(statusstoretest.NewFake(), "prefetch")
+
+	_, _, err := store.Get("node1")
+	if !statusstore.IsNoStatus(err) {
+		t.Fatalf("expected a NoStatusError before any status was written, got %v", err)
+	}
+
+	err = store.Set("node1", Status{Pods: map[types.PodID]Result{
+		"web":    {SHA: "abc", Time: time.Now()},
+		"worker": {SHA: "def", Error: "could not download artifact", Time: time.Now()},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error setting prefetch status: %s", err)
+	}
+
+	status, _, err := store.Get("node1")
+	if err != nil {
+		t.Fatalf("unexpected error getting prefetch status: %s", err)
+	}
+	if !status.Pods["web"].Succeeded("abc") || status.Pods["web"].Succeeded("def") {
+		t.Errorf("expected web to have been prefetched at abc only, got %+v", status.Pods["web"])
+	}
+	if !status.Pods["worker"].Failed("def") || status.Pods["worker"].Succeeded("def") {
+		t.Errorf("expected worker to have failed to prefetch def, got %+v", status.Pods["worker"])
+	}
+	if status.Pods["missing"].Succeeded("abc") || status.Pods["missing"].Failed("abc") {
+		t.Error("expected a pod without a result to be neither prefetched nor failed")
+	}
+}
+
+func TestEmptyNodeRejected(t *testing.T) {
+	store := NewConsul(statusstoretest.NewFake(), "prefetch")
+
+	if err := store.Set("", Status{}); err == nil {
+		t.Error("expected an error setting status for an empty node name")
+	}
+	if _, _, err := store.Get(""); err == nil {
+		t.Error("expected an error getting status for an empty node name")
+	}
+}
@@ -0,0 +1,37 @@
+package prerequisitestatus
+
+import (
+	"encoding/json"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
+	"github.com/square/p2/pkg/types"
+)
+
+// Status records the prerequisites a node doesn't meet for each legacy pod
+// whose latest intent can't be installed there. Pods with a unique key have
+// them in their own pod status.
+type Status struct {
+	Pods map[types.PodID]podstatus.PrerequisiteFailure `json:"pods"`
+}
+
+func statusToPrerequisiteStatus(rawStatus statusstore.Status) (Status, error) {
+	var prerequisiteStatus Status
+
+	err := json.Unmarshal(rawStatus.Bytes(), &prerequisiteStatus)
+	if err != nil {
+		return Status{}, errors.Errorf("Could not unmarshal raw status as prerequisite status: %w", err)
+	}
+
+	return prerequisiteStatus, nil
+}
+
+func prerequisiteStatusToStatus(prerequisiteStatus Status) (statusstore.Status, error) {
+	bytes, err := json.Marshal(prerequisiteStatus)
+	if err != nil {
+		return statusstore.Status{}, errors.Errorf("Could not marshal prerequisite status as json bytes: %w", err)
+	}
+
+	return statusstore.Status(bytes), nil
+}
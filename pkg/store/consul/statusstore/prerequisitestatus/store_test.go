@@ -0,0 +1,39 @@
+package prerequisitestatus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/statusstoretest"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestSetAndGet(t *testing.T) {
+	store := NewConsul(statusstoretest.NewFake(), "prerequisite_failures")
+
+	_, _, err := store.Get("node1")
+	if !statusstore.IsNoStatus(err) {
+		t.Fatalf("expected a NoStatusError before any status was written, got %v", err)
+	}
+
+	failure := podstatus.PrerequisiteFailure{
+		SHA:   "abc123",
+		Unmet: []podstatus.UnmetPrerequisite{{Kind: "package", Name: "libfoo"}},
+		Time:  time.Now().UTC(),
+	}
+	err = store.Set("node1", Status{Pods: map[types.PodID]podstatus.PrerequisiteFailure{"web": failure}})
+	if err != nil {
+		t.Fatalf("unexpected error setting prerequisite status: %s", err)
+	}
+
+	status, _, err := store.Get("node1")
+	if err != nil {
+		t.Fatalf("unexpected error getting prerequisite status: %s", err)
+	}
+	got := status.Pods["web"]
+	if got.SHA != failure.SHA || len(got.Unmet) != 1 || got.Unmet[0].Name != "libfoo" || !got.Time.Equal(failure.Time) {
+		t.Errorf("expected %+v, got %+v", failure, got)
+	}
+}
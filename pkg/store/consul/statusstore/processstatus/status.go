@@ -0,0 +1,38 @@
+package processstatus
+
+import (
+	"encoding/json"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
+	"github.com/square/p2/pkg/types"
+)
+
+// Status records the exits of the processes of the legacy pods on a node.
+// Pods with a unique key have their own pod status record, but legacy pods
+// are identified only by their pod ID and node so their process exits are
+// grouped per node.
+type Status struct {
+	Pods map[types.PodID][]podstatus.ProcessStatus `json:"pods"`
+}
+
+func statusToProcessStatus(rawStatus statusstore.Status) (Status, error) {
+	var processStatus Status
+
+	err := json.Unmarshal(rawStatus.Bytes(), &processStatus)
+	if err != nil {
+		return Status{}, errors.Errorf("Could not unmarshal raw status as process status: %w", err)
+	}
+
+	return processStatus, nil
+}
+
+func processStatusToStatus(processStatus Status) (statusstore.Status, error) {
+	bytes, err := json.Marshal(processStatus)
+	if err != nil {
+		return statusstore.Status{}, errors.Errorf("Could not marshal process status as json bytes: %w", err)
+	}
+
+	return statusstore.Status(bytes), nil
+}
@@ -0,0 +1,99 @@
+package processstatus
+
+import (
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
+	"github.com/square/p2/pkg/types"
+
+	"github.com/hashicorp/consul/api"
+	context "golang.org/x/net/context"
+)
+
+type ConsulStore struct {
+	statusStore statusstore.Store
+
+	// The consul implementation statusstore.Store formats keys like
+	// /status/<resource-type>/<resource-id>/<namespace>. Process exits are
+	// recorded per node, so the namespace must differ from that of
+	// nodestatus.
+	namespace statusstore.Namespace
+}
+
+func NewConsul(statusStore statusstore.Store, namespace statusstore.Namespace) ConsulStore {
+	return ConsulStore{
+		statusStore: statusStore,
+		namespace:   namespace,
+	}
+}
+
+func (c ConsulStore) Get(node types.NodeName) (Status, *api.QueryMeta, error) {
+	if node == "" {
+		return Status{}, nil, errors.Codef(errors.CodeInvalid, "provided node name was empty")
+	}
+
+	rawStatus, queryMeta, err := c.statusStore.GetStatus(statusstore.NODE, statusstore.ResourceID(node), c.namespace)
+	if err != nil {
+		return Status{}, queryMeta, err
+	}
+
+	status, err := statusToProcessStatus(rawStatus)
+	if err != nil {
+		return Status{}, queryMeta, err
+	}
+
+	return status, queryMeta, nil
+}
+
+func (c ConsulStore) CAS(ctx context.Context, node types.NodeName, status Status, modifyIndex uint64) error {
+	if node == "" {
+		return errors.Codef(errors.CodeInvalid, "provided node name was empty")
+	}
+
+	rawStatus, err := processStatusToStatus(status)
+	if err != nil {
+		return err
+	}
+
+	return c.statusStore.CASStatus(ctx, statusstore.NODE, statusstore.ResourceID(node), c.namespace, rawStatus, modifyIndex)
+}
+
+// Convenience function for only mutating a part of the status structure.
+// The status is retrieved along with its consul ModifyIndex, passed to the
+// mutator function, and then written back with a CAS operation added to the
+// transaction in ctx.
+func (c ConsulStore) MutateStatus(ctx context.Context, node types.NodeName, mutator func(Status) (Status, error)) error {
+	var lastIndex uint64
+	status, queryMeta, err := c.Get(node)
+	switch {
+	case statusstore.IsNoStatus(err):
+		// We just want to make sure the key doesn't exist when we set it, so
+		// use an index of 0
+		lastIndex = 0
+	case err != nil:
+		return err
+	default:
+		lastIndex = queryMeta.LastIndex
+	}
+
+	newStatus, err := mutator(status)
+	if err != nil {
+		return err
+	}
+	return c.CAS(ctx, node, newStatus, lastIndex)
+}
+
+// SetLastExit records the exit of one of the processes of a legacy pod on
+// the node. See podstatus.RecordExit.
+func (c ConsulStore) SetLastExit(ctx context.Context, node types.NodeName, podID types.PodID, launchableID launch.LaunchableID, entryPoint string, exitStatus podstatus.ExitStatus) error {
+	mutator := func(s Status) (Status, error) {
+		if s.Pods == nil {
+			s.Pods = make(map[types.PodID][]podstatus.ProcessStatus)
+		}
+		s.Pods[podID] = podstatus.RecordExit(s.Pods[podID], launchableID, entryPoint, exitStatus)
+		return s, nil
+	}
+
+	return c.MutateStatus(ctx, node, mutator)
+}
@@ -0,0 +1,57 @@
+// +build !race
+
+package processstatus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
+	"github.com/square/p2/pkg/store/consul/transaction"
+)
+
+func TestSetLastExit(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+	store := NewConsul(statusstore.NewConsul(fixture.Client), "process_exits")
+
+	_, _, err := store.Get("node1")
+	if !statusstore.IsNoStatus(err) {
+		t.Fatalf("expected a NoStatusError before any status was written, got %v", err)
+	}
+
+	exits := []podstatus.ExitStatus{
+		{ExitTime: time.Now().UTC(), ExitCode: -1, ExitStatus: 9, OOMKilled: true},
+		{ExitTime: time.Now().UTC(), ExitCode: 0},
+	}
+	for _, exit := range exits {
+		ctx, cancelFunc := transaction.New(context.Background())
+		err = store.SetLastExit(ctx, "node1", "web", "app", "launch", exit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = transaction.MustCommit(ctx, fixture.Client.KV())
+		if err != nil {
+			t.Fatal(err)
+		}
+		cancelFunc()
+	}
+
+	status, _, err := store.Get("node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	processes := status.Pods["web"]
+	if len(processes) != 1 {
+		t.Fatalf("expected one process to be recorded for web, got %+v", processes)
+	}
+	if processes[0].LastExit == nil || processes[0].LastExit.ExitCode != 0 {
+		t.Errorf("expected the last exit to be the clean one, got %+v", processes[0].LastExit)
+	}
+	if len(processes[0].AbnormalExits) != 1 || !processes[0].AbnormalExits[0].OOMKilled {
+		t.Errorf("expected the OOM kill to be kept as an abnormal exit, got %+v", processes[0].AbnormalExits)
+	}
+}
@@ -3,13 +3,16 @@ package rcstatus
 import (
 	"encoding/json"
 
+	"github.com/square/p2/pkg/errors"
 	"github.com/square/p2/pkg/store/consul/statusstore"
 	"github.com/square/p2/pkg/types"
-	"github.com/square/p2/pkg/util"
 )
 
 type Status struct {
 	NodeTransfer *NodeTransfer `json:"node_transfer"`
+
+	// DryRun is only written by RC farms running in dry-run mode
+	DryRun *DryRun `json:"dry_run,omitempty"`
 }
 
 type NodeTransferID string
@@ -24,12 +27,40 @@ type NodeTransfer struct {
 	ID NodeTransferID `json:"id"`
 }
 
+// DryRun records the scheduling changes an RC farm running in dry-run mode
+// would have made the last time it handled the RC
+type DryRun struct {
+	// Schedule lists the nodes the pod would have been scheduled on
+	Schedule []types.NodeName `json:"schedule,omitempty"`
+
+	// Unschedule lists the nodes the pod would have been unscheduled from
+	Unschedule []types.NodeName `json:"unschedule,omitempty"`
+
+	// Update lists the nodes whose intent manifest would have been
+	// replaced with the RC's manifest
+	Update []types.NodeName `json:"update,omitempty"`
+
+	// Ineligible lists the nodes the pod would remain scheduled on that
+	// the RC's node selector no longer matches. Nodes of RCs with the
+	// dynamic allocation strategy would be transferred off these nodes.
+	Ineligible []types.NodeName `json:"ineligible,omitempty"`
+
+	// Shortfall is the number of replicas that could not have been
+	// scheduled because there were not enough eligible nodes
+	Shortfall int `json:"shortfall,omitempty"`
+}
+
+// HasChanges returns whether the RC farm would have changed anything
+func (d DryRun) HasChanges() bool {
+	return len(d.Schedule) > 0 || len(d.Unschedule) > 0 || len(d.Update) > 0 || len(d.Ineligible) > 0 || d.Shortfall > 0
+}
+
 func rawStatusToStatus(rawStatus statusstore.Status) (Status, error) {
 	var status Status
 
 	err := json.Unmarshal(rawStatus.Bytes(), &status)
 	if err != nil {
-		return Status{}, util.Errorf("Could not unmarshal raw status as rc status: %s", err)
+		return Status{}, errors.Errorf("Could not unmarshal raw status as rc status: %w", err)
 	}
 
 	return status, nil
@@ -38,7 +69,7 @@ func rawStatusToStatus(rawStatus statusstore.Status) (Status, error) {
 func statusToRawStatus(status Status) (statusstore.Status, error) {
 	bytes, err := json.Marshal(status)
 	if err != nil {
-		return statusstore.Status{}, util.Errorf("Could not marshal rc status as json bytes: %s", err)
+		return statusstore.Status{}, errors.Errorf("Could not marshal rc status as json bytes: %w", err)
 	}
 
 	return statusstore.Status(bytes), nil
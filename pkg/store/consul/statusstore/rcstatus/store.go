@@ -3,9 +3,9 @@ package rcstatus
 import (
 	"context"
 
+	"github.com/square/p2/pkg/errors"
 	"github.com/square/p2/pkg/rc/fields"
 	"github.com/square/p2/pkg/store/consul/statusstore"
-	"github.com/square/p2/pkg/util"
 
 	"github.com/hashicorp/consul/api"
 )
@@ -29,7 +29,7 @@ func NewConsul(statusStore statusstore.Store, namespace statusstore.Namespace) C
 
 func (c ConsulStore) Get(rcID fields.ID) (Status, *api.QueryMeta, error) {
 	if rcID == "" {
-		return Status{}, nil, util.Errorf("Provided replication controller ID was empty")
+		return Status{}, nil, errors.Codef(errors.CodeInvalid, "Provided replication controller ID was empty")
 	}
 
 	rawStatus, queryMeta, err := c.statusStore.GetStatus(statusstore.RC, statusstore.ResourceID(rcID), c.namespace)
@@ -47,7 +47,7 @@ func (c ConsulStore) Get(rcID fields.ID) (Status, *api.QueryMeta, error) {
 
 func (c ConsulStore) Set(rcID fields.ID, status Status) error {
 	if rcID == "" {
-		return util.Errorf("Provided replication controller ID was empty")
+		return errors.Codef(errors.CodeInvalid, "Provided replication controller ID was empty")
 	}
 
 	rawStatus, err := statusToRawStatus(status)
@@ -60,7 +60,7 @@ func (c ConsulStore) Set(rcID fields.ID, status Status) error {
 
 func (c ConsulStore) CASTxn(ctx context.Context, rcID fields.ID, modifyIndex uint64, status Status) error {
 	if rcID == "" {
-		return util.Errorf("Provided replication controller ID was empty")
+		return errors.Codef(errors.CodeInvalid, "Provided replication controller ID was empty")
 	}
 
 	rawStatus, err := statusToRawStatus(status)
@@ -73,7 +73,7 @@ func (c ConsulStore) CASTxn(ctx context.Context, rcID fields.ID, modifyIndex uin
 
 func (c ConsulStore) Delete(rcID fields.ID) error {
 	if rcID == "" {
-		return util.Errorf("Provided replication controller ID was empty")
+		return errors.Codef(errors.CodeInvalid, "Provided replication controller ID was empty")
 	}
 
 	return c.statusStore.DeleteStatus(statusstore.RC, statusstore.ResourceID(rcID.String()), c.namespace)
@@ -81,7 +81,7 @@ func (c ConsulStore) Delete(rcID fields.ID) error {
 
 func (c ConsulStore) DeleteTxn(ctx context.Context, rcID fields.ID) error {
 	if rcID == "" {
-		return util.Errorf("Provided replication controller ID was empty")
+		return errors.Codef(errors.CodeInvalid, "Provided replication controller ID was empty")
 	}
 
 	return c.statusStore.DeleteStatusTxn(ctx, statusstore.RC, statusstore.ResourceID(rcID.String()), c.namespace)
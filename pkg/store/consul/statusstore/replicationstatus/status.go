@@ -0,0 +1,68 @@
+package replicationstatus
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/types"
+)
+
+// MaxEvents is how many events are kept for each pod. The oldest events are
+// dropped once a pod's replications have recorded more.
+const MaxEvents = 1000
+
+// Event records that a node entered a phase of a replication
+type Event struct {
+	// ReplicationID is the ID of the replication's record, if it kept one
+	ReplicationID string `json:"replication_id,omitempty"`
+
+	// SHA is the SHA of the manifest being replicated
+	SHA string `json:"sha"`
+
+	Node types.NodeName `json:"node"`
+
+	// Phase is one of the phases of the replication package, e.g.
+	// "scheduled" or "healthy"
+	Phase string `json:"phase"`
+
+	Time time.Time `json:"time"`
+
+	// Error is why the node failed or is being retried
+	Error string `json:"error,omitempty"`
+}
+
+// Status holds the events of the replications of a pod, oldest first
+type Status struct {
+	Events []Event `json:"events"`
+}
+
+// Append adds the events to the end of the log, dropping the oldest events
+// if there are more than MaxEvents
+func (s *Status) Append(events ...Event) {
+	s.Events = append(s.Events, events...)
+	if len(s.Events) > MaxEvents {
+		s.Events = append([]Event(nil), s.Events[len(s.Events)-MaxEvents:]...)
+	}
+}
+
+func statusToReplicationStatus(rawStatus statusstore.Status) (Status, error) {
+	var replicationStatus Status
+
+	err := json.Unmarshal(rawStatus.Bytes(), &replicationStatus)
+	if err != nil {
+		return Status{}, errors.Errorf("Could not unmarshal raw status as replication status: %w", err)
+	}
+
+	return replicationStatus, nil
+}
+
+func replicationStatusToStatus(replicationStatus Status) (statusstore.Status, error) {
+	bytes, err := json.Marshal(replicationStatus)
+	if err != nil {
+		return statusstore.Status{}, errors.Errorf("Could not marshal replication status as json bytes: %w", err)
+	}
+
+	return statusstore.Status(bytes), nil
+}
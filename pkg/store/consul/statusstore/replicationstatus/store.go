@@ -0,0 +1,56 @@
+package replicationstatus
+
+import (
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/types"
+
+	"github.com/hashicorp/consul/api"
+)
+
+type ConsulStore struct {
+	statusStore statusstore.Store
+
+	// The consul implementation statusstore.Store formats keys like
+	// /status/<resource-type>/<resource-id>/<namespace>. The events of a
+	// pod are written by whichever replication of it is running.
+	namespace statusstore.Namespace
+}
+
+func NewConsul(statusStore statusstore.Store, namespace statusstore.Namespace) ConsulStore {
+	return ConsulStore{
+		statusStore: statusStore,
+		namespace:   namespace,
+	}
+}
+
+func (c ConsulStore) Get(podID types.PodID) (Status, *api.QueryMeta, error) {
+	if podID == "" {
+		return Status{}, nil, errors.Codef(errors.CodeInvalid, "provided pod ID was empty")
+	}
+
+	rawStatus, queryMeta, err := c.statusStore.GetStatus(statusstore.POD, statusstore.ResourceID(podID), c.namespace)
+	if err != nil {
+		return Status{}, queryMeta, err
+	}
+
+	status, err := statusToReplicationStatus(rawStatus)
+	if err != nil {
+		return Status{}, queryMeta, err
+	}
+
+	return status, queryMeta, nil
+}
+
+func (c ConsulStore) Set(podID types.PodID, status Status) error {
+	if podID == "" {
+		return errors.Codef(errors.CodeInvalid, "provided pod ID was empty")
+	}
+
+	rawStatus, err := replicationStatusToStatus(status)
+	if err != nil {
+		return err
+	}
+
+	return c.statusStore.SetStatus(statusstore.POD, statusstore.ResourceID(podID), c.namespace, rawStatus)
+}
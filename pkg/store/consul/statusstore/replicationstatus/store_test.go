@@ -0,0 +1,58 @@
+package replicationstatus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/statusstoretest"
+)
+
+func TestSetAndGet(t *testing.T) {
+	store := NewConsul(statusstoretest.NewFake(), "replication_events")
+
+	_, _, err := store.Get("web")
+	if !statusstore.IsNoStatus(err) {
+		t.Fatalf("expected a NoStatusError before any status was written, got %v", err)
+	}
+
+	event := Event{
+		ReplicationID: "abc-123",
+		SHA:           "deadbeef",
+		Node:          "node1",
+		Phase:         "failed",
+		Time:          time.Now().UTC(),
+		Error:         "timed out",
+	}
+	err = store.Set("web", Status{Events: []Event{event}})
+	if err != nil {
+		t.Fatalf("unexpected error setting replication status: %s", err)
+	}
+
+	status, _, err := store.Get("web")
+	if err != nil {
+		t.Fatalf("unexpected error getting replication status: %s", err)
+	}
+	if len(status.Events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(status.Events))
+	}
+	got := status.Events[0]
+	if got.ReplicationID != event.ReplicationID || got.Node != event.Node || got.Phase != event.Phase || got.Error != event.Error || !got.Time.Equal(event.Time) {
+		t.Errorf("expected %+v, got %+v", event, got)
+	}
+}
+
+func TestAppendDropsOldestEvents(t *testing.T) {
+	var status Status
+	for i := 0; i < MaxEvents; i++ {
+		status.Append(Event{Phase: "scheduled"})
+	}
+	status.Append(Event{Phase: "healthy"}, Event{Phase: "failed"})
+
+	if len(status.Events) != MaxEvents {
+		t.Fatalf("expected %d events, got %d", MaxEvents, len(status.Events))
+	}
+	if status.Events[MaxEvents-2].Phase != "healthy" || status.Events[MaxEvents-1].Phase != "failed" {
+		t.Errorf("expected the newest events to be last, got %+v", status.Events[MaxEvents-2:])
+	}
+}
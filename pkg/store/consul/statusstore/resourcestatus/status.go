@@ -0,0 +1,60 @@
+package resourcestatus
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/types"
+)
+
+// Status records the resource usage of every pod installed on a node, as
+// sampled by the preparer.
+type Status struct {
+	// Pods maps each pod's unique name (its pod home, e.g. <id> or
+	// <id>-<uuid>) to its usage
+	Pods map[string]PodUsage `json:"pods"`
+
+	SampledAt time.Time `json:"sampled_at"`
+}
+
+// PodUsage is the resource usage of the processes started for a pod's
+// launchables, including their children
+type PodUsage struct {
+	PodID        types.PodID        `json:"pod_id"`
+	PodUniqueKey types.PodUniqueKey `json:"pod_unique_key,omitempty"`
+
+	// Number of processes sampled
+	Processes int `json:"processes"`
+
+	// Total CPU time consumed by the sampled processes
+	CPUSeconds float64 `json:"cpu_seconds"`
+
+	// Average number of CPUs used since the previous sample. Omitted for
+	// the first sample of a pod
+	CPUCores float64 `json:"cpu_cores,omitempty"`
+
+	RSSBytes int64 `json:"rss_bytes"`
+	OpenFDs  int   `json:"open_fds"`
+}
+
+func statusToResourceStatus(rawStatus statusstore.Status) (Status, error) {
+	var resourceStatus Status
+
+	err := json.Unmarshal(rawStatus.Bytes(), &resourceStatus)
+	if err != nil {
+		return Status{}, errors.Errorf("Could not unmarshal raw status as resource status: %w", err)
+	}
+
+	return resourceStatus, nil
+}
+
+func resourceStatusToStatus(resourceStatus Status) (statusstore.Status, error) {
+	bytes, err := json.Marshal(resourceStatus)
+	if err != nil {
+		return statusstore.Status{}, errors.Errorf("Could not marshal resource status as json bytes: %w", err)
+	}
+
+	return statusstore.Status(bytes), nil
+}
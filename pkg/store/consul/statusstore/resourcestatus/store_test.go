@@ -0,0 +1,54 @@
+package resourcestatus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/statusstoretest"
+)
+
+func TestSetAndGet(t *testing.T) {
+	store := NewConsul(statusstoretest.NewFake(), "resource_usage")
+
+	_, _, err := store.Get("node1")
+	if !statusstore.IsNoStatus(err) {
+		t.Fatalf("expected a NoStatusError before any status was written, got %v", err)
+	}
+
+	now := time.Now().UTC()
+	usage := PodUsage{
+		PodID:      "web",
+		Processes:  2,
+		CPUSeconds: 12.5,
+		CPUCores:   0.25,
+		RSSBytes:   1 << 20,
+		OpenFDs:    17,
+	}
+	err = store.Set("node1", Status{Pods: map[string]PodUsage{"web": usage}, SampledAt: now})
+	if err != nil {
+		t.Fatalf("unexpected error setting resource status: %s", err)
+	}
+
+	status, _, err := store.Get("node1")
+	if err != nil {
+		t.Fatalf("unexpected error getting resource status: %s", err)
+	}
+	if status.Pods["web"] != usage {
+		t.Errorf("expected usage %+v, got %+v", usage, status.Pods["web"])
+	}
+	if !status.SampledAt.Equal(now) {
+		t.Errorf("expected sample time %s, got %s", now, status.SampledAt)
+	}
+}
+
+func TestEmptyNodeRejected(t *testing.T) {
+	store := NewConsul(statusstoretest.NewFake(), "resource_usage")
+
+	if err := store.Set("", Status{}); err == nil {
+		t.Error("expected an error setting status for an empty node name")
+	}
+	if _, _, err := store.Get(""); err == nil {
+		t.Error("expected an error getting status for an empty node name")
+	}
+}
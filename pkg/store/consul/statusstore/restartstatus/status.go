@@ -0,0 +1,68 @@
+package restartstatus
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/types"
+)
+
+// The number of restarts kept for each pod, older ones are dropped
+const maxRecordedRestarts = 10
+
+// Status records the restarts of the pods on a node by the preparer's
+// supervisor, which restarts pods whose health stays critical. It is written
+// only by the preparer on that node.
+type Status struct {
+	Pods map[types.PodID]PodRestarts `json:"pods"`
+}
+
+// PodRestarts are the recent restarts of a pod by the supervisor
+type PodRestarts struct {
+	// The most recent restarts, oldest first
+	Restarts []Restart `json:"restarts"`
+
+	// Set when the pod reached the maximum number of restarts, after which
+	// the supervisor leaves it alone until it is healthy again
+	GaveUp bool `json:"gave_up,omitempty"`
+}
+
+// Restart is one restart of a pod by the supervisor
+type Restart struct {
+	Time time.Time `json:"time"`
+
+	// When the pod's health became critical
+	CriticalSince time.Time `json:"critical_since"`
+
+	// Set if the restart failed
+	Error string `json:"error,omitempty"`
+}
+
+// RecordRestart appends restart to restarts, dropping the oldest restarts
+// past the number that is kept
+func RecordRestart(restarts []Restart, restart Restart) []Restart {
+	restarts = append(restarts, restart)
+	if len(restarts) > maxRecordedRestarts {
+		restarts = restarts[len(restarts)-maxRecordedRestarts:]
+	}
+	return restarts
+}
+
+func statusToRestartStatus(rawStatus statusstore.Status) (Status, error) {
+	var restartStatus Status
+	err := json.Unmarshal(rawStatus.Bytes(), &restartStatus)
+	if err != nil {
+		return Status{}, errors.Errorf("Could not unmarshal raw status as restart status: %w", err)
+	}
+	return restartStatus, nil
+}
+
+func restartStatusToStatus(restartStatus Status) (statusstore.Status, error) {
+	bytes, err := json.Marshal(restartStatus)
+	if err != nil {
+		return statusstore.Status{}, errors.Errorf("Could not marshal restart status as json bytes: %w", err)
+	}
+	return statusstore.Status(bytes), nil
+}
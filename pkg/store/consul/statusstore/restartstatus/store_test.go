@@ -0,0 +1,47 @@
+package restartstatus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/statusstoretest"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestSetAndGet(t *testing.T) {
+	store := NewConsul(statusstoretest.NewFake(), "restarts")
+	_, _, err := store.Get("node1")
+	if !statusstore.IsNoStatus(err) {
+		t.Fatalf("expected a NoStatusError before any status was written, got %v", err)
+	}
+
+	restart := Restart{Time: time.Now().UTC(), CriticalSince: time.Now().UTC().Add(-time.Minute)}
+	err = store.Set("node1", Status{Pods: map[types.PodID]PodRestarts{"web": {Restarts: []Restart{restart}, GaveUp: true}}})
+	if err != nil {
+		t.Fatalf("unexpected error setting restart status: %s", err)
+	}
+
+	status, _, err := store.Get("node1")
+	if err != nil {
+		t.Fatalf("unexpected error getting restart status: %s", err)
+	}
+	restarts := status.Pods["web"]
+	if len(restarts.Restarts) != 1 || !restarts.Restarts[0].Time.Equal(restart.Time) || !restarts.GaveUp {
+		t.Errorf("expected a restart at %s after which the supervisor gave up, got %+v", restart.Time, restarts)
+	}
+}
+
+func TestRecordRestart(t *testing.T) {
+	var restarts []Restart
+	start := time.Now()
+	for i := 0; i < maxRecordedRestarts+2; i++ {
+		restarts = RecordRestart(restarts, Restart{Time: start.Add(time.Duration(i) * time.Minute)})
+	}
+	if len(restarts) != maxRecordedRestarts {
+		t.Fatalf("expected %d restarts to be kept, got %d", maxRecordedRestarts, len(restarts))
+	}
+	if !restarts[0].Time.Equal(start.Add(2 * time.Minute)) {
+		t.Errorf("expected the oldest restarts to be dropped, the first is at %s", restarts[0].Time)
+	}
+}
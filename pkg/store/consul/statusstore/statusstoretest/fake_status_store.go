@@ -2,13 +2,12 @@ package statusstoretest
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"sync"
 	"time"
 
+	"github.com/square/p2/pkg/errors"
 	"github.com/square/p2/pkg/store/consul/statusstore"
-	"github.com/square/p2/pkg/util"
 
 	"github.com/hashicorp/consul/api"
 )
@@ -140,7 +139,7 @@ func (s *FakeStatusStore) DeleteStatusTxn(
 	id statusstore.ResourceID,
 	namespace statusstore.Namespace,
 ) error {
-	return util.Errorf("DeleteStatusTxn() is not implemented on FakeStatusStore. Use a real consul-backed status store if you need this")
+	return errors.Errorf("DeleteStatusTxn() is not implemented on FakeStatusStore. Use a real consul-backed status store if you need this")
 }
 
 func (s *FakeStatusStore) GetAllStatusForResource(
@@ -21,6 +21,17 @@ const (
 	POD = ResourceType("pods")
 	DS  = ResourceType("daemon_sets")
 	RC  = ResourceType("replication_controllers")
+
+	NODE = ResourceType("nodes")
+
+	// The health of nodes is kept apart from their other statuses so that
+	// schedulers can list it for every node without also reading each
+	// node's hook output, resource usage and so on
+	NODE_HEALTH = ResourceType("node_health")
+
+	// Idempotency keys supplied by API clients, see the idempotencystatus
+	// package
+	IDEMPOTENCY_KEY = ResourceType("idempotency_keys")
 )
 
 // Unfortunately each ResourceType will carry along with it a different "ID"
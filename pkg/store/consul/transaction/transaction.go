@@ -4,14 +4,13 @@ package transaction
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"sync"
 	"time"
 
-	"github.com/square/p2/pkg/util"
-
 	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/errors"
 )
 
 // contextKeyType is only used as a key into a context's value
@@ -62,7 +61,7 @@ func Add(ctx context.Context, op api.KVTxnOp) error {
 	txn.committedMu.Lock()
 	defer txn.committedMu.Unlock()
 	if txn.committed {
-		return util.Errorf("transaction was already committed")
+		return errors.Errorf("transaction was already committed")
 	}
 
 	if len(*txn.kvOps) == maxAllowedOperations {
@@ -88,7 +87,7 @@ func MustCommit(ctx context.Context, txner Txner) error {
 	}
 
 	if !ok {
-		return util.Errorf("transaction was rolled back: %s", TxnErrorsToString(resp.Errors))
+		return errors.Errorf("transaction was rolled back: %s", TxnErrorsToString(resp.Errors))
 	}
 
 	return nil
@@ -106,7 +105,7 @@ func Commit(ctx context.Context, txner Txner) (bool, *api.KVTxnResponse, error)
 	txn.committedMu.Lock()
 	defer txn.committedMu.Unlock()
 	if txn.committed {
-		return false, nil, util.Errorf("transaction was already run")
+		return false, nil, errors.Errorf("transaction was already run")
 	}
 
 	// make it more convenient for callers to call Commit() even if they're
@@ -124,7 +123,7 @@ func Commit(ctx context.Context, txner Txner) (bool, *api.KVTxnResponse, error)
 
 	ok, resp, _, err := txner.Txn(*txn.kvOps, nil)
 	if err != nil {
-		return false, nil, util.Errorf("transaction failed: %s", err)
+		return false, nil, errors.Errorf("transaction failed: %w", err)
 	}
 
 	// we mark the transaction as completed. Any further Commit() calls
@@ -187,12 +186,12 @@ func CommitWithRetries(ctx context.Context, txner Txner) (bool, *api.KVTxnRespon
 func getTxnFromContext(ctx context.Context) (*tx, error) {
 	txnValue := ctx.Value(contextKey)
 	if txnValue == nil {
-		return nil, util.Errorf("no transaction was opened on the passed Context")
+		return nil, errors.Errorf("no transaction was opened on the passed Context")
 	}
 
 	txn, ok := txnValue.(*tx)
 	if !ok {
-		return nil, util.Errorf("the transaction value on the context had the wrong type!")
+		return nil, errors.Errorf("the transaction value on the context had the wrong type!")
 	}
 
 	return txn, nil
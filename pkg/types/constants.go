@@ -4,4 +4,8 @@ const (
 	AvailabilityZoneLabel = "availability_zone"
 	ClusterNameLabel      = "cluster_name"
 	PodIDLabel            = "pod_id"
+
+	// Nodes with this label set to "true" are cordoned: nothing schedules
+	// new pods on them, but the pods already running there are left alone
+	CordonedLabel = "cordoned"
 )
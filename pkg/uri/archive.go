@@ -0,0 +1,390 @@
+package uri
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// ExtractOptions configure archive extraction
+type ExtractOptions struct {
+	// UID and GID own every extracted entry. If negative, entries are
+	// owned by the extracting user
+	UID int
+	GID int
+}
+
+// CurrentUser extracts archives as owned by the extracting user
+var CurrentUser = ExtractOptions{UID: -1, GID: -1}
+
+// ExtractTarGz extracts a gzipped tarball read from src into the dest
+// directory, which must exist. See ExtractTar.
+func ExtractTarGz(src io.Reader, dest string, opts ExtractOptions) error {
+	gz, err := gzip.NewReader(src)
+	if err != nil {
+		return util.Errorf("could not read gzip stream: %s", err)
+	}
+	defer gz.Close()
+	return ExtractTar(gz, dest, opts)
+}
+
+// ExtractTar extracts a tarball read from src into the dest directory, which
+// must exist. Archives are untrusted: extraction fails if an entry would be
+// written outside of dest, either through its path or through a symlink, or
+// if an entry is a device node or FIFO. Permission bits are preserved, except
+// for setuid, setgid and sticky bits, which are dropped. Ownership recorded
+// in the archive is ignored in favor of opts.
+func ExtractTar(src io.Reader, dest string, opts ExtractOptions) error {
+	x, err := newExtractor(dest, opts)
+	if err != nil {
+		return err
+	}
+
+	reader := tar.NewReader(src)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return util.Errorf("could not read tarball: %s", err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = x.dir(header.Name, header.FileInfo().Mode(), header.ModTime)
+		case tar.TypeReg, tar.TypeRegA:
+			err = x.file(header.Name, header.FileInfo().Mode(), header.ModTime, reader)
+		case tar.TypeSymlink:
+			err = x.symlink(header.Name, header.Linkname)
+		case tar.TypeLink:
+			err = x.hardlink(header.Name, header.Linkname)
+		case tar.TypeXGlobalHeader:
+			continue
+		case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			err = util.Errorf("%s: archives may not contain device nodes or FIFOs", header.Name)
+		default:
+			err = util.Errorf("%s: unsupported tar entry type %q", header.Name, header.Typeflag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return x.finish()
+}
+
+// ExtractZip extracts the zip file at path into the dest directory, which must
+// exist, with the same safeguards as ExtractTar.
+func ExtractZip(path string, dest string, opts ExtractOptions) error {
+	x, err := newExtractor(dest, opts)
+	if err != nil {
+		return err
+	}
+
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return util.Errorf("could not read zip file %s: %s", path, err)
+	}
+	defer reader.Close()
+
+	for _, f := range reader.File {
+		err = extractZipEntry(x, f)
+		if err != nil {
+			return err
+		}
+	}
+	return x.finish()
+}
+
+func extractZipEntry(x *extractor, f *zip.File) error {
+	mode := f.Mode()
+	switch {
+	case mode.IsDir():
+		return x.dir(f.Name, mode, f.ModTime())
+	case mode&os.ModeSymlink != 0:
+		src, err := f.Open()
+		if err != nil {
+			return util.Errorf("%s: %s", f.Name, err)
+		}
+		defer src.Close()
+		// the target of a symlink is stored as its content
+		target := make([]byte, 4096)
+		n, err := io.ReadFull(src, target)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return util.Errorf("%s: could not read symlink target: %s", f.Name, err)
+		}
+		return x.symlink(f.Name, string(target[:n]))
+	case mode.IsRegular():
+		src, err := f.Open()
+		if err != nil {
+			return util.Errorf("%s: %s", f.Name, err)
+		}
+		defer src.Close()
+		return x.file(f.Name, mode, f.ModTime(), src)
+	default:
+		return util.Errorf("%s: archives may not contain device nodes or FIFOs", f.Name)
+	}
+}
+
+type dirTimes struct {
+	path    string
+	mode    os.FileMode
+	modTime time.Time
+}
+
+type extractor struct {
+	// dest with symlinks resolved, so that it can be compared against
+	// resolved entry paths
+	dest string
+	opts ExtractOptions
+
+	// directory permissions and times are applied once extraction is
+	// done, so that read-only directories can still be populated
+	dirs []dirTimes
+}
+
+func newExtractor(dest string, opts ExtractOptions) (*extractor, error) {
+	resolved, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		return nil, util.Errorf("could not resolve extraction directory %s: %s", dest, err)
+	}
+	resolved, err = filepath.Abs(resolved)
+	if err != nil {
+		return nil, err
+	}
+	return &extractor{dest: resolved, opts: opts}, nil
+}
+
+func (x *extractor) within(path string) bool {
+	return path == x.dest || strings.HasPrefix(path, x.dest+string(filepath.Separator))
+}
+
+// target returns where the archive entry called name must be written. The
+// parent directories of the entry are created, and it is an error for them
+// to resolve outside of the extraction directory.
+func (x *extractor) target(name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", util.Errorf("%s: archive entries may not have absolute paths", name)
+	}
+	path := filepath.Join(x.dest, name)
+	if !x.within(path) {
+		return "", util.Errorf("%s: archive entry would be extracted outside of %s", name, x.dest)
+	}
+	if path == x.dest {
+		return path, nil
+	}
+
+	parent := filepath.Dir(path)
+	err := x.mkdirAll(parent)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(parent)
+	if err != nil {
+		return "", util.Errorf("%s: %s", name, err)
+	}
+	if !x.within(resolved) {
+		return "", util.Errorf("%s: archive entry would be extracted outside of %s through a symlink", name, x.dest)
+	}
+	return filepath.Join(resolved, filepath.Base(path)), nil
+}
+
+// mkdirAll creates the missing directories leading to path, which must be
+// within the extraction directory, with the owner from the options
+func (x *extractor) mkdirAll(path string) error {
+	if x.opts.UID >= 0 {
+		return util.MkdirChownAll(path, x.opts.UID, x.opts.GID, 0755)
+	}
+	return os.MkdirAll(path, 0755)
+}
+
+// replace removes any existing entry at path that isn't a directory, so that
+// writes never follow a symlink or clobber a hardlinked file
+func replace(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return nil
+	}
+	return os.Remove(path)
+}
+
+func (x *extractor) chown(path string) error {
+	if x.opts.UID < 0 {
+		return nil
+	}
+	return os.Lchown(path, x.opts.UID, x.opts.GID)
+}
+
+func (x *extractor) dir(name string, mode os.FileMode, modTime time.Time) error {
+	path, err := x.target(name)
+	if err != nil {
+		return err
+	}
+	if path == x.dest {
+		return nil
+	}
+
+	info, err := os.Lstat(path)
+	switch {
+	case os.IsNotExist(err):
+		err = os.Mkdir(path, 0755)
+	case err == nil && !info.IsDir():
+		err = util.Errorf("%s: cannot replace a file with a directory", name)
+	}
+	if err != nil {
+		return err
+	}
+	err = x.chown(path)
+	if err != nil {
+		return err
+	}
+	x.dirs = append(x.dirs, dirTimes{path: path, mode: mode.Perm(), modTime: modTime})
+	return nil
+}
+
+func (x *extractor) file(name string, mode os.FileMode, modTime time.Time, src io.Reader) (err error) {
+	path, err := x.target(name)
+	if err != nil {
+		return err
+	}
+	err = replace(path)
+	if err != nil {
+		return err
+	}
+
+	// O_EXCL guarantees that no symlink planted since replace() is
+	// followed
+	dest, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Return the Close() error unless another error happened first
+		if errC := dest.Close(); err == nil {
+			err = errC
+		}
+	}()
+	_, err = io.Copy(dest, src)
+	if err != nil {
+		return util.Errorf("%s: %s", name, err)
+	}
+	// the umask applies to OpenFile
+	err = dest.Chmod(mode.Perm())
+	if err != nil {
+		return err
+	}
+	err = x.chown(path)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(path, modTime, modTime)
+}
+
+func (x *extractor) symlink(name string, linkname string) error {
+	if filepath.IsAbs(linkname) {
+		return util.Errorf("%s: symlinks may not have absolute targets", name)
+	}
+	path, err := x.target(name)
+	if err != nil {
+		return err
+	}
+	if !x.within(filepath.Join(filepath.Dir(path), linkname)) {
+		return util.Errorf("%s: symlink target %s is outside of %s", name, linkname, x.dest)
+	}
+	// The kernel applies ".." to wherever the preceding components resolve,
+	// so "a/.." leaves dest when a is itself a symlink to ".". Leading ".."
+	// components are fine since the link's directory has been resolved.
+	if climbsAfterDescending(linkname) {
+		return util.Errorf("%s: symlink target %s may only use .. at its start", name, linkname)
+	}
+
+	err = replace(path)
+	if err != nil {
+		return err
+	}
+	err = os.Symlink(linkname, path)
+	if err != nil {
+		return err
+	}
+	return x.chown(path)
+}
+
+// climbsAfterDescending returns whether a symlink target has a ".." component
+// following one that names an entry, which may itself be a symlink
+func climbsAfterDescending(linkname string) bool {
+	descended := false
+	for _, part := range strings.Split(linkname, "/") {
+		switch part {
+		case "", ".":
+		case "..":
+			if descended {
+				return true
+			}
+		default:
+			descended = true
+		}
+	}
+	return false
+}
+
+func (x *extractor) hardlink(name string, linkname string) error {
+	path, err := x.target(name)
+	if err != nil {
+		return err
+	}
+	// hardlink targets are archive paths, not relative to the link
+	oldPath, err := x.target(linkname)
+	if err != nil {
+		return err
+	}
+	if oldPath == path {
+		// some archivers write a file followed by a link to itself
+		return nil
+	}
+	info, err := os.Lstat(oldPath)
+	if err != nil {
+		return util.Errorf("%s: hardlink target %s: %s", name, linkname, err)
+	}
+	if !info.Mode().IsRegular() {
+		return util.Errorf("%s: hardlink target %s is not a regular file", name, linkname)
+	}
+
+	err = replace(path)
+	if err != nil {
+		return err
+	}
+	return os.Link(oldPath, path)
+}
+
+// finish applies directory permissions and times, deepest first so that
+// setting a parent's time isn't undone by changes to its children
+func (x *extractor) finish() error {
+	sort.Slice(x.dirs, func(i, j int) bool {
+		return len(x.dirs[i].path) > len(x.dirs[j].path)
+	})
+	for _, d := range x.dirs {
+		err := os.Chmod(d.path, d.mode)
+		if err != nil {
+			return err
+		}
+		err = os.Chtimes(d.path, d.modTime, d.modTime)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
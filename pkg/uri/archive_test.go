@@ -0,0 +1,192 @@
+package uri
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type entry struct {
+	name     string
+	typeflag byte
+	mode     int64
+	body     string
+	linkname string
+}
+
+func tarball(t *testing.T, entries ...entry) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	w := tar.NewWriter(buf)
+	for _, e := range entries {
+		err := w.WriteHeader(&tar.Header{
+			Name:     e.name,
+			Typeflag: e.typeflag,
+			Mode:     e.mode,
+			Size:     int64(len(e.body)),
+			Linkname: e.linkname,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = w.Write([]byte(e.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func TestExtractTar(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	err := ExtractTar(tarball(t,
+		entry{name: "bin/", typeflag: tar.TypeDir, mode: 0555},
+		entry{name: "bin/launch", typeflag: tar.TypeReg, mode: 04755, body: "#!/bin/sh\n"},
+		entry{name: "current", typeflag: tar.TypeSymlink, linkname: "bin"},
+		entry{name: "bin/start", typeflag: tar.TypeLink, linkname: "bin/launch"},
+	), dir, CurrentUser)
+	if err != nil {
+		t.Fatalf("Unexpected error extracting tarball: %s", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "current", "launch"))
+	if err != nil {
+		t.Fatalf("Expected the file to be reachable through the symlink: %s", err)
+	}
+	if info.Mode() != 0755 {
+		t.Errorf("Expected the setuid bit to be dropped, got mode %s", info.Mode())
+	}
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "bin", "start"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "#!/bin/sh\n" {
+		t.Errorf("Expected the hardlink to have the file's contents, got %q", contents)
+	}
+	info, err = os.Stat(filepath.Join(dir, "bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0555 {
+		t.Errorf("Expected the directory's mode to be applied, got %s", info.Mode())
+	}
+	_ = os.Chmod(filepath.Join(dir, "bin"), 0755)
+}
+
+func TestExtractTarRejectsMaliciousEntries(t *testing.T) {
+	for description, entries := range map[string][]entry{
+		"absolute path": {
+			{name: "/etc/cron.d/evil", typeflag: tar.TypeReg, mode: 0644, body: "evil"},
+		},
+		"parent path": {
+			{name: "../evil", typeflag: tar.TypeReg, mode: 0644, body: "evil"},
+		},
+		"absolute symlink": {
+			{name: "etc", typeflag: tar.TypeSymlink, linkname: "/etc"},
+		},
+		"escaping symlink": {
+			{name: "up", typeflag: tar.TypeSymlink, linkname: "../.."},
+		},
+		"write through symlink": {
+			{name: "a/b/up", typeflag: tar.TypeSymlink, linkname: ".."},
+			{name: "w", typeflag: tar.TypeSymlink, linkname: "a/b/up/../.."},
+			{name: "w/evil", typeflag: tar.TypeReg, mode: 0644, body: "evil"},
+		},
+		"climb through symlink": {
+			{name: "a", typeflag: tar.TypeSymlink, linkname: "."},
+			{name: "b", typeflag: tar.TypeSymlink, linkname: "a/.."},
+		},
+		"escaping hardlink": {
+			{name: "passwd", typeflag: tar.TypeLink, linkname: "../../etc/passwd"},
+		},
+		"device node": {
+			{name: "sda", typeflag: tar.TypeBlock, mode: 0600},
+		},
+		"fifo": {
+			{name: "pipe", typeflag: tar.TypeFifo, mode: 0600},
+		},
+	} {
+		parent, cleanup := tempDir(t)
+		dest := filepath.Join(parent, "a", "dest")
+		err := os.MkdirAll(dest, 0755)
+		if err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+
+		err = ExtractTar(tarball(t, entries...), dest, CurrentUser)
+		if err == nil {
+			t.Errorf("%s: expected an error extracting the tarball", description)
+		}
+		for _, escaped := range []string{filepath.Join(parent, "evil"), filepath.Join(parent, "a", "evil")} {
+			if _, err := os.Lstat(escaped); !os.IsNotExist(err) {
+				t.Errorf("%s: expected nothing to be written outside of the destination, found %s", description, escaped)
+			}
+		}
+		cleanup()
+	}
+}
+
+func TestExtractZip(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	write := func(name string, files map[string]string) string {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		w := zip.NewWriter(f)
+		for name, body := range files {
+			fw, err := w.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = fw.Write([]byte(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = w.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	dest := filepath.Join(dir, "dest")
+	err := os.Mkdir(dest, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ExtractZip(write("good.zip", map[string]string{"lib/app.jar": "jar"}), dest, CurrentUser)
+	if err != nil {
+		t.Fatalf("Unexpected error extracting zip file: %s", err)
+	}
+	contents, err := ioutil.ReadFile(filepath.Join(dest, "lib", "app.jar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "jar" {
+		t.Errorf("Expected %q to be extracted, got %q", "jar", contents)
+	}
+
+	err = ExtractZip(write("evil.zip", map[string]string{"../evil": "evil"}), dest, CurrentUser)
+	if err == nil {
+		t.Error("Expected an error extracting a zip file with a parent path")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "evil")); !os.IsNotExist(err) {
+		t.Error("Expected nothing to be written outside of the destination")
+	}
+}
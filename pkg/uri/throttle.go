@@ -0,0 +1,111 @@
+package uri
+
+import (
+	"io"
+	"net/http"
+
+	"golang.org/x/net/context"
+	"golang.org/x/time/rate"
+)
+
+// The most bytes a throttled read waits for at once. Smaller reads keep the
+// transfer smooth rather than bursty.
+const throttleChunkSize = 32 * 1024
+
+// BandwidthLimits cap the rate at which response bodies are downloaded. Zero
+// means no limit.
+type BandwidthLimits struct {
+	// NodeBytesPerSecond caps all downloads through the transport combined
+	NodeBytesPerSecond int64 `yaml:"node_bytes_per_second,omitempty"`
+
+	// FetchBytesPerSecond caps each download on its own
+	FetchBytesPerSecond int64 `yaml:"fetch_bytes_per_second,omitempty"`
+}
+
+func (l BandwidthLimits) enabled() bool {
+	return l.NodeBytesPerSecond > 0 || l.FetchBytesPerSecond > 0
+}
+
+func newByteLimiter(bytesPerSecond int64) *rate.Limiter {
+	burst := throttleChunkSize
+	if bytesPerSecond < throttleChunkSize {
+		burst = int(bytesPerSecond)
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), burst)
+}
+
+type throttledTransport struct {
+	base     http.RoundTripper
+	node     *rate.Limiter
+	perFetch int64
+}
+
+// NewThrottledTransport returns a RoundTripper that downloads response bodies
+// through base no faster than limits allow. The node limit is shared by every
+// request made through the returned RoundTripper, so all clients that should
+// share a cap must share it. If base is nil, http.DefaultTransport is used.
+// If limits has no limits, base is returned as is.
+func NewThrottledTransport(base http.RoundTripper, limits BandwidthLimits) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if !limits.enabled() {
+		return base
+	}
+	transport := &throttledTransport{
+		base:     base,
+		perFetch: limits.FetchBytesPerSecond,
+	}
+	if limits.NodeBytesPerSecond > 0 {
+		transport.node = newByteLimiter(limits.NodeBytesPerSecond)
+	}
+	return transport
+}
+
+func (t *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body := &throttledBody{
+		body: resp.Body,
+		ctx:  req.Context(),
+	}
+	if t.node != nil {
+		body.limiters = append(body.limiters, t.node)
+	}
+	if t.perFetch > 0 {
+		body.limiters = append(body.limiters, newByteLimiter(t.perFetch))
+	}
+	resp.Body = body
+	return resp, nil
+}
+
+// throttledBody waits on each of its limiters before handing out bytes. Bytes
+// are accounted for before they are read, so a limiter never lets through
+// more than its burst ahead of its rate.
+type throttledBody struct {
+	body     io.ReadCloser
+	ctx      context.Context
+	limiters []*rate.Limiter
+}
+
+func (b *throttledBody) Read(p []byte) (int, error) {
+	n := len(p)
+	for _, limiter := range b.limiters {
+		if limiter.Burst() < n {
+			n = limiter.Burst()
+		}
+	}
+	for _, limiter := range b.limiters {
+		err := limiter.WaitN(b.ctx, n)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return b.body.Read(p[:n])
+}
+
+func (b *throttledBody) Close() error {
+	return b.body.Close()
+}
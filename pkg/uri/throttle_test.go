@@ -0,0 +1,74 @@
+package uri
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func bodyServer(size int) *httptest.Server {
+	body := strings.Repeat("x", size)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+}
+
+// timedGet reports errors with t.Error, since it is also called from other
+// goroutines
+func timedGet(t *testing.T, client *http.Client, url string, size int) time.Duration {
+	start := time.Now()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Error(err)
+		return 0
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(body) != size {
+		t.Errorf("Expected %d bytes, got %d", size, len(body))
+	}
+	return time.Since(start)
+}
+
+func TestThrottledTransportLimitsEachFetch(t *testing.T) {
+	server := bodyServer(15000)
+	defer server.Close()
+
+	client := &http.Client{Transport: NewThrottledTransport(nil, BandwidthLimits{FetchBytesPerSecond: 10000})}
+	// the first 10000 bytes are the limiter's burst, the other 5000 take
+	// half a second
+	if elapsed := timedGet(t, client, server.URL, 15000); elapsed < 400*time.Millisecond {
+		t.Errorf("Expected the download to be throttled, took %s", elapsed)
+	}
+}
+
+func TestThrottledTransportSharesNodeLimit(t *testing.T) {
+	server := bodyServer(7500)
+	defer server.Close()
+
+	client := &http.Client{Transport: NewThrottledTransport(nil, BandwidthLimits{NodeBytesPerSecond: 10000})}
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			timedGet(t, client, server.URL, 7500)
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("Expected concurrent downloads to share the node's limit, took %s", elapsed)
+	}
+
+	if NewThrottledTransport(http.DefaultTransport, BandwidthLimits{}) != http.DefaultTransport {
+		t.Error("Expected a transport without limits to be left alone")
+	}
+}
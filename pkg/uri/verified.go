@@ -0,0 +1,233 @@
+package uri
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	// SHA256SidecarSuffix is appended to a URI to find the sidecar file
+	// holding its digest, in the format written by sha256sum
+	SHA256SidecarSuffix = ".sha256"
+
+	DefaultFetchAttempts = 5
+	DefaultFetchBackoff  = 1 * time.Second
+)
+
+// VerifyOptions configure CopyVerified
+type VerifyOptions struct {
+	// SHA256 is the hex encoded digest the fetched content must have
+	SHA256 string
+
+	// Sidecar reads the expected digest from the URI with
+	// SHA256SidecarSuffix appended. It is ignored if SHA256 is set. If
+	// neither is set, the content is not verified.
+	Sidecar bool
+
+	// Attempts is the number of times the fetch is tried before giving up.
+	// Defaults to DefaultFetchAttempts
+	Attempts int
+
+	// Backoff is the wait before the first retry, doubled for every
+	// following retry. Defaults to DefaultFetchBackoff
+	Backoff time.Duration
+}
+
+// errPermanent wraps errors that retrying cannot fix
+type errPermanent struct {
+	error
+}
+
+// CopyVerified copies the content at srcUri to dstPath and checks it against
+// the expected digest. Failed fetches are retried with backoff. HTTP
+// downloads are resumed from where the previous attempt stopped if the
+// server supports range requests. The content is downloaded next to dstPath
+// and only moved into place once verified, so dstPath never holds partial or
+// corrupt content and nothing is left behind on error.
+func (f BasicFetcher) CopyVerified(srcUri *url.URL, dstPath string, opts VerifyOptions) error {
+	if opts.Attempts <= 0 {
+		opts.Attempts = DefaultFetchAttempts
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultFetchBackoff
+	}
+
+	expected := strings.ToLower(opts.SHA256)
+	if expected == "" && opts.Sidecar {
+		var err error
+		expected, err = f.sidecarDigest(srcUri, opts)
+		if err != nil {
+			return err
+		}
+	}
+	if expected != "" {
+		if decoded, err := hex.DecodeString(expected); err != nil || len(decoded) != sha256.Size {
+			return util.Errorf("%q is not a hex encoded SHA-256 digest", expected)
+		}
+	}
+
+	partialPath := dstPath + ".partial"
+	defer os.Remove(partialPath)
+
+	err := retry(opts, func() error {
+		err := f.resume(srcUri, partialPath)
+		if err != nil {
+			return err
+		}
+
+		if expected == "" {
+			return nil
+		}
+		actual, err := fileDigest(partialPath)
+		if err != nil {
+			return err
+		}
+		if actual != expected {
+			// the partial content can't be trusted, start over
+			_ = os.Remove(partialPath)
+			return util.Errorf("%s has SHA-256 digest %s, expected %s", srcUri, actual, expected)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(partialPath, dstPath)
+}
+
+// resume appends the content at srcUri to the file at path, skipping the bytes
+// already present if srcUri is an HTTP URL whose server supports range
+// requests. Otherwise the file is overwritten.
+func (f BasicFetcher) resume(srcUri *url.URL, path string) error {
+	if srcUri.Scheme != "http" && srcUri.Scheme != "https" {
+		err := f.CopyLocal(srcUri, path)
+		if os.IsNotExist(err) {
+			return errPermanent{err}
+		}
+		return err
+	}
+
+	var offset int64
+	if info, err := os.Stat(path); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequest("GET", srcUri.String(), nil)
+	if err != nil {
+		return errPermanent{err}
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		flags |= os.O_APPEND
+	case resp.StatusCode == http.StatusOK:
+		// the server ignored the range, start over
+		flags |= os.O_TRUNC
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// the partial file is at least as large as the content, so it
+		// must be stale. Start over on the next attempt
+		_ = os.Remove(path)
+		return util.Errorf("%q: HTTP server returned status: %s", srcUri.String(), resp.Status)
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+		return errPermanent{util.Errorf("%q: HTTP server returned status: %s", srcUri.String(), resp.Status)}
+	default:
+		return util.Errorf("%q: HTTP server returned status: %s", srcUri.String(), resp.Status)
+	}
+
+	dest, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return errPermanent{err}
+	}
+	_, err = io.Copy(dest, resp.Body)
+	if errC := dest.Close(); err == nil {
+		err = errC
+	}
+	return err
+}
+
+// sidecarDigest reads the expected digest of srcUri from its sidecar file
+func (f BasicFetcher) sidecarDigest(srcUri *url.URL, opts VerifyOptions) (string, error) {
+	sidecarUri := *srcUri
+	sidecarUri.Path += SHA256SidecarSuffix
+
+	var digest string
+	err := retry(opts, func() error {
+		src, err := f.Open(&sidecarUri)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		// sha256sum writes "<digest>  <filename>"
+		scanner := bufio.NewScanner(io.LimitReader(src, 4096))
+		if !scanner.Scan() {
+			if scanner.Err() != nil {
+				return scanner.Err()
+			}
+			return errPermanent{util.Errorf("digest sidecar %s is empty", sidecarUri.String())}
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			return errPermanent{util.Errorf("digest sidecar %s is empty", sidecarUri.String())}
+		}
+		digest = strings.ToLower(fields[0])
+		return nil
+	})
+	if err != nil {
+		return "", util.Errorf("could not read digest sidecar: %s", err)
+	}
+	return digest, nil
+}
+
+func retry(opts VerifyOptions, f func() error) error {
+	backoff := opts.Backoff
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil {
+			return nil
+		}
+		if permanent, ok := err.(errPermanent); ok {
+			return permanent.error
+		}
+		if attempt >= opts.Attempts {
+			return util.Errorf("giving up after %d attempts: %s", attempt, err)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func fileDigest(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,201 @@
+package uri
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const content = "id: hello\nlaunchables: {}\n"
+
+func digest(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "verified")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func assertNoPartial(t *testing.T, dir string) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), ".partial") {
+			t.Errorf("Expected partial download %s to be removed", f.Name())
+		}
+	}
+}
+
+var fastRetries = VerifyOptions{Attempts: 3, Backoff: time.Millisecond}
+
+func TestCopyVerifiedChecksDigest(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	src := filepath.Join(dir, "manifest.yaml")
+	err := ioutil.WriteFile(src, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(dir, "copied.yaml")
+	fetcher := BasicFetcher{Client: http.DefaultClient}
+
+	opts := fastRetries
+	opts.SHA256 = strings.ToUpper(digest(content))
+	err = fetcher.CopyVerified(&url.URL{Path: src}, dst, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error fetching with the right digest: %s", err)
+	}
+	copied, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(copied) != content {
+		t.Errorf("Expected %q to be copied, got %q", content, copied)
+	}
+
+	mismatched := filepath.Join(dir, "mismatched.yaml")
+	opts.SHA256 = digest("something else")
+	err = fetcher.CopyVerified(&url.URL{Path: src}, mismatched, opts)
+	if err == nil {
+		t.Fatal("Expected an error fetching with the wrong digest")
+	}
+	if _, err := os.Stat(mismatched); !os.IsNotExist(err) {
+		t.Errorf("Expected no file to be written when the digest doesn't match, got %v", err)
+	}
+	assertNoPartial(t, dir)
+
+	opts.SHA256 = "not a digest"
+	err = fetcher.CopyVerified(&url.URL{Path: src}, mismatched, opts)
+	if err == nil {
+		t.Error("Expected an error for a malformed digest")
+	}
+}
+
+func TestCopyVerifiedReadsSidecar(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	src := filepath.Join(dir, "manifest.yaml")
+	err := ioutil.WriteFile(src, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(src+SHA256SidecarSuffix, []byte(digest(content)+"  manifest.yaml\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetcher := BasicFetcher{Client: http.DefaultClient}
+
+	opts := fastRetries
+	opts.Sidecar = true
+	err = fetcher.CopyVerified(&url.URL{Path: src}, filepath.Join(dir, "copied.yaml"), opts)
+	if err != nil {
+		t.Fatalf("Unexpected error fetching with a matching sidecar: %s", err)
+	}
+
+	err = ioutil.WriteFile(src+SHA256SidecarSuffix, []byte(digest("something else")+"  manifest.yaml\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fetcher.CopyVerified(&url.URL{Path: src}, filepath.Join(dir, "mismatched.yaml"), opts)
+	if err == nil {
+		t.Error("Expected an error fetching with a mismatched sidecar")
+	}
+}
+
+// flakyServer serves content but drops the connection halfway through the
+// first response, then honors range requests
+type flakyServer struct {
+	mu       sync.Mutex
+	requests []string
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Header.Get("Range"))
+	first := len(s.requests) == 1
+	s.mu.Unlock()
+
+	if first {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(content[:10]))
+		w.(http.Flusher).Flush()
+		// abort the connection so the client sees a truncated body
+		panic(http.ErrAbortHandler)
+	}
+
+	http.ServeContent(w, r, "manifest.yaml", time.Time{}, strings.NewReader(content))
+}
+
+func TestCopyVerifiedResumesHTTPDownloads(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	handler := &flakyServer{}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	src, err := url.Parse(server.URL + "/manifest.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(dir, "copied.yaml")
+	opts := fastRetries
+	opts.SHA256 = digest(content)
+	err = BasicFetcher{Client: http.DefaultClient}.CopyVerified(src, dst, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error fetching from a flaky server: %s", err)
+	}
+
+	copied, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(copied) != content {
+		t.Errorf("Expected %q to be downloaded, got %q", content, copied)
+	}
+	if len(handler.requests) != 2 || handler.requests[1] != "bytes=10-" {
+		t.Errorf("Expected the second request to resume at byte 10, got ranges %q", handler.requests)
+	}
+	assertNoPartial(t, dir)
+}
+
+func TestCopyVerifiedDoesNotRetryMissingContent(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+	src, err := url.Parse(server.URL + "/manifest.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = BasicFetcher{Client: http.DefaultClient}.CopyVerified(src, filepath.Join(dir, "copied.yaml"), fastRetries)
+	if err == nil {
+		t.Fatal("Expected an error fetching missing content")
+	}
+	if requests != 1 {
+		t.Errorf("Expected a 404 not to be retried, got %d requests", requests)
+	}
+	assertNoPartial(t, dir)
+}
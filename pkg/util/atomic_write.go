@@ -0,0 +1,154 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ChecksumSuffix is appended to the name of a file written with a checksum to
+// get the name of its checksum file, which is in the format written by
+// sha256sum
+const ChecksumSuffix = ".sha256"
+
+// AtomicWriteOptions configure WriteAtomic
+type AtomicWriteOptions struct {
+	// Perm is the mode of the written file. Defaults to 0644
+	Perm os.FileMode
+
+	// UID and GID own the written file. If negative, it is owned by the
+	// writing user
+	UID int
+	GID int
+
+	// Checksum also writes a checksum file for the content, which
+	// VerifyChecksum checks
+	Checksum bool
+}
+
+// DefaultAtomicWriteOptions write a file with mode 0644 owned by the writing
+// user
+var DefaultAtomicWriteOptions = AtomicWriteOptions{Perm: 0644, UID: -1, GID: -1}
+
+// WriteFileAtomic writes data to filename with WriteAtomic
+func WriteFileAtomic(filename string, data []byte, opts AtomicWriteOptions) error {
+	return WriteAtomic(filename, opts, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// WriteAtomic replaces the content of filename with what write writes, such
+// that readers see either the old or the new content in full, even if the
+// process or machine crashes partway through. The content is written to a
+// temporary file in the same directory, which is synced to disk and renamed
+// over filename. The temporary file is removed if anything fails.
+func WriteAtomic(filename string, opts AtomicWriteOptions, write func(io.Writer) error) (err error) {
+	if opts.Perm == 0 {
+		opts.Perm = 0644
+	}
+
+	dir := filepath.Dir(filename)
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(filename)+".tmp")
+	if err != nil {
+		return Errorf("could not create temporary file for %s: %s", filename, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	hash := sha256.New()
+	err = write(io.MultiWriter(tmp, hash))
+	if err != nil {
+		return err
+	}
+	err = tmp.Chmod(opts.Perm)
+	if err != nil {
+		return err
+	}
+	if opts.UID >= 0 {
+		err = tmp.Chown(opts.UID, opts.GID)
+		if err != nil {
+			return err
+		}
+	}
+	err = tmp.Sync()
+	if err != nil {
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	if opts.Checksum {
+		// the checksum file is written first so that a crash between
+		// the two renames leaves a mismatch, which is detected, rather
+		// than a stale checksum that happens to match the old content
+		checksum := fmt.Sprintf("%s  %s\n", hex.EncodeToString(hash.Sum(nil)), filepath.Base(filename))
+		checksumOpts := opts
+		checksumOpts.Checksum = false
+		err = WriteFileAtomic(filename+ChecksumSuffix, []byte(checksum), checksumOpts)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.Rename(tmp.Name(), filename)
+	if err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir makes a rename in dir durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// VerifyChecksum checks the content of filename against the checksum file
+// written alongside it by WriteAtomic. Files without a checksum file pass,
+// since they may predate checksums.
+func VerifyChecksum(filename string) error {
+	checksum, err := ioutil.ReadFile(filename + ChecksumSuffix)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(checksum))
+	if len(fields) == 0 {
+		return Errorf("checksum file for %s is empty", filename)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return err
+	}
+
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if actual != fields[0] {
+		return Errorf("%s has SHA-256 digest %s, but its checksum file expects %s", filename, actual, fields[0])
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package util
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "atomic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	filename := filepath.Join(tmp, "manifest.yaml")
+
+	opts := DefaultAtomicWriteOptions
+	opts.Perm = 0600
+	opts.Checksum = true
+	err = WriteFileAtomic(filename, []byte("id: hello\n"), opts)
+	if err != nil {
+		t.Fatalf("Unexpected error writing file: %s", err)
+	}
+
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "id: hello\n" {
+		t.Errorf("Expected the content to be written, got %q", content)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode() != 0600 {
+		t.Errorf("Expected mode 0600, got %s", info.Mode())
+	}
+	err = VerifyChecksum(filename)
+	if err != nil {
+		t.Errorf("Expected the checksum to match: %s", err)
+	}
+
+	// simulate a write that bypassed WriteAtomic
+	err = ioutil.WriteFile(filename, []byte("id: hel"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if VerifyChecksum(filename) == nil {
+		t.Error("Expected a checksum mismatch for modified content")
+	}
+}
+
+func TestWriteAtomicLeavesOldContentOnError(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "atomic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	filename := filepath.Join(tmp, "config.yaml")
+	err = ioutil.WriteFile(filename, []byte("old"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = WriteAtomic(filename, DefaultAtomicWriteOptions, func(w io.Writer) error {
+		_, _ = w.Write([]byte("partial"))
+		return errors.New("render failed")
+	})
+	if err == nil {
+		t.Fatal("Expected the write's error to be returned")
+	}
+
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "old" {
+		t.Errorf("Expected the old content to be intact, got %q", content)
+	}
+	entries, err := ioutil.ReadDir(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected the temporary file to be removed, found %d files", len(entries))
+	}
+	if VerifyChecksum(filename) != nil {
+		t.Error("Expected a file without a checksum file to pass verification")
+	}
+}
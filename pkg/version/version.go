@@ -1,3 +1,71 @@
 package version
 
-var VERSION string = "0.0.3"
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// VERSION, GitSHA, BuildTime and Builder are injected at build time, e.g.
+//
+//	go build -ldflags "-X github.com/square/p2/pkg/version.GitSHA=$(git rev-parse HEAD)"
+//
+// see the Rakefile's release task
+var (
+	VERSION   string = "0.0.3"
+	GitSHA    string
+	BuildTime string
+	Builder   string
+)
+
+// Info identifies the build of P2 a binary was built from, so that the
+// records a binary writes can be traced back to it
+type Info struct {
+	Version   string `json:"version"`
+	GitSHA    string `json:"git_sha,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	Builder   string `json:"builder,omitempty"`
+}
+
+// Current returns the build of the running binary
+func Current() Info {
+	return Info{
+		Version:   VERSION,
+		GitSHA:    GitSHA,
+		BuildTime: BuildTime,
+		Builder:   Builder,
+	}
+}
+
+// Verbose describes the build on multiple lines, leaving out what wasn't
+// injected at build time
+func (i Info) Verbose() string {
+	s := fmt.Sprintf("version: %s", i.Version)
+	for _, field := range []struct{ name, value string }{
+		{"git sha", i.GitSHA},
+		{"build time", i.BuildTime},
+		{"builder", i.Builder},
+	} {
+		if field.value != "" {
+			s += fmt.Sprintf("\n%s: %s", field.name, field.value)
+		}
+	}
+	return s
+}
+
+// Register adds --version to app, which prints the version and exits. With
+// --verbose it prints the rest of the build's metadata too. It takes the
+// place of kingpin's Application.Version, whose output is fixed.
+func Register(app *kingpin.Application) {
+	verbose := app.Flag("verbose", "With --version, also show the git SHA, time and builder of the build.").Bool()
+	app.Flag("version", "Show application version.").PreAction(func(*kingpin.ParseContext) error {
+		if *verbose {
+			fmt.Println(Current().Verbose())
+		} else {
+			fmt.Println(VERSION)
+		}
+		os.Exit(0)
+		return nil
+	}).Bool()
+}
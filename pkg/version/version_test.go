@@ -0,0 +1,13 @@
+package version
+
+import (
+	"testing"
+)
+
+func TestVerbose(t *testing.T) {
+	info := Info{Version: "1.2.3", GitSHA: "abc123", Builder: "ci"}
+	expected := "version: 1.2.3\ngit sha: abc123\nbuilder: ci"
+	if verbose := info.Verbose(); verbose != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, verbose)
+	}
+}
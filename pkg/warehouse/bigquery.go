@@ -0,0 +1,196 @@
+package warehouse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	defaultBigQueryEndpoint = "https://bigquery.googleapis.com"
+
+	// The metadata server of GCE instances hands out access tokens for the
+	// instance's service account
+	defaultBigQueryTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// BigQueryConfig configures a sink that streams records into a BigQuery table,
+// whose columns are the JSON fields of Record: kind, node, pod_id,
+// pod_unique_key, status, previous_status, reason, tree, change and
+// manifest_sha as STRING and time as TIMESTAMP.
+type BigQueryConfig struct {
+	Project string `yaml:"project"`
+	Dataset string `yaml:"dataset"`
+	Table   string `yaml:"table"`
+
+	// Endpoint is the BigQuery API's base URL. Defaults to
+	// https://bigquery.googleapis.com
+	Endpoint string `yaml:"endpoint,omitempty"`
+
+	// TokenURL is where access tokens are fetched from, in the format of
+	// the GCE metadata server, which is the default
+	TokenURL string `yaml:"token_url,omitempty"`
+}
+
+type bigQuerySink struct {
+	insertURL string
+	tokenURL  string
+	client    *http.Client
+	logger    logging.Logger
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+func NewBigQuerySink(config BigQueryConfig, client *http.Client, logger logging.Logger) (Sink, error) {
+	if config.Project == "" || config.Dataset == "" || config.Table == "" {
+		return nil, util.Errorf("the bigquery sink requires a project, dataset and table")
+	}
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = defaultBigQueryEndpoint
+	}
+	tokenURL := config.TokenURL
+	if tokenURL == "" {
+		tokenURL = defaultBigQueryTokenURL
+	}
+	return &bigQuerySink{
+		insertURL: fmt.Sprintf(
+			"%s/bigquery/v2/projects/%s/datasets/%s/tables/%s/insertAll",
+			endpoint,
+			url.PathEscape(config.Project),
+			url.PathEscape(config.Dataset),
+			url.PathEscape(config.Table),
+		),
+		tokenURL: tokenURL,
+		client:   client,
+		logger:   logger,
+	}, nil
+}
+
+type bigQueryRow struct {
+	// BigQuery drops rows with the same insert ID as a recent row, which
+	// makes retries safe
+	InsertID string `json:"insertId"`
+	JSON     Record `json:"json"`
+}
+
+type bigQueryInsertRequest struct {
+	SkipInvalidRows bool          `json:"skipInvalidRows"`
+	Rows            []bigQueryRow `json:"rows"`
+}
+
+type bigQueryInsertResponse struct {
+	InsertErrors []struct {
+		Index  int `json:"index"`
+		Errors []struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	} `json:"insertErrors"`
+}
+
+func (s *bigQuerySink) Write(records []Record) error {
+	request := bigQueryInsertRequest{
+		// a row that doesn't fit the table will never fit it, so it
+		// mustn't hold back the others
+		SkipInvalidRows: true,
+		Rows:            make([]bigQueryRow, len(records)),
+	}
+	for i, record := range records {
+		request.Rows[i] = bigQueryRow{InsertID: record.ID(), JSON: record}
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return util.Errorf("could not marshal bigquery rows: %s", err)
+	}
+
+	token, err := s.accessToken()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", s.insertURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return util.Errorf("could not insert rows into bigquery: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return util.Errorf("bigquery returned status %d: %s", resp.StatusCode, message)
+	}
+
+	var response bigQueryInsertResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return util.Errorf("could not parse bigquery response: %s", err)
+	}
+	// Rejected rows are not retried, see SkipInvalidRows
+	for _, insertError := range response.InsertErrors {
+		fields := logrus.Fields{"index": insertError.Index}
+		if insertError.Index >= 0 && insertError.Index < len(records) {
+			fields["record"] = records[insertError.Index]
+		}
+		for _, rowError := range insertError.Errors {
+			fields["reason"] = rowError.Reason
+			s.logger.WithFields(fields).Errorf("BigQuery rejected a record: %s", rowError.Message)
+		}
+	}
+	return nil
+}
+
+func (s *bigQuerySink) accessToken() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Now().Before(s.tokenExpiry) {
+		return s.token, nil
+	}
+
+	req, err := http.NewRequest("GET", s.tokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", util.Errorf("could not fetch bigquery access token: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", util.Errorf("could not fetch bigquery access token: status %d", resp.StatusCode)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return "", util.Errorf("could not parse bigquery access token: %s", err)
+	}
+	if token.AccessToken == "" {
+		return "", util.Errorf("no bigquery access token was returned by %s", s.tokenURL)
+	}
+	s.token = token.AccessToken
+	// renew the token a minute early, so it doesn't expire in flight
+	s.tokenExpiry = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return s.token, nil
+}
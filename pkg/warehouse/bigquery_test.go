@@ -0,0 +1,84 @@
+package warehouse
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/square/p2/pkg/logging"
+)
+
+func TestBigQuerySinkInsertsRows(t *testing.T) {
+	tokenRequests := 0
+	var inserted bigQueryInsertRequest
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		tokenRequests++
+		fmt.Fprint(w, `{"access_token": "token", "expires_in": 3600}`)
+	})
+	mux.HandleFunc("/bigquery/v2/projects/project/datasets/p2/tables/events/insertAll", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&inserted); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"insertErrors": [{"index": 1, "errors": [{"reason": "invalid", "message": "no such field"}]}]}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	sink, err := NewBigQuerySink(BigQueryConfig{
+		Project:  "project",
+		Dataset:  "p2",
+		Table:    "events",
+		Endpoint: server.URL,
+		TokenURL: server.URL + "/token",
+	}, http.DefaultClient, logging.TestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := []Record{{Kind: KindHealthTransition, Node: "node1"}, {Kind: KindHealthTransition, Node: "node2"}}
+	for i := 0; i < 2; i++ {
+		// rejected rows aren't retried
+		if err = sink.Write(records); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tokenRequests != 1 {
+		t.Errorf("expected the access token to be reused, it was fetched %d times", tokenRequests)
+	}
+	if len(inserted.Rows) != 2 || inserted.Rows[0].JSON.Node != "node1" || inserted.Rows[0].InsertID != records[0].ID() {
+		t.Errorf("expected each record to be inserted with its ID, got %+v", inserted.Rows)
+	}
+}
+
+func TestBigQuerySinkFailsOnServerErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	sink, err := NewBigQuerySink(BigQueryConfig{
+		Project:  "project",
+		Dataset:  "p2",
+		Table:    "events",
+		Endpoint: server.URL,
+		TokenURL: server.URL + "/token",
+	}, http.DefaultClient, logging.TestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.Write([]Record{{Kind: KindHealthTransition}}); err == nil {
+		t.Error("expected the write to fail when bigquery is unavailable")
+	}
+}
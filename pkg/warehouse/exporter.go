@@ -0,0 +1,255 @@
+package warehouse
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+)
+
+type HealthWatcher interface {
+	WatchHealth(resultCh chan []*health.Result, errCh chan<- error, quitCh <-chan struct{}, jitterWindow time.Duration)
+}
+
+type PodChangeWatcher interface {
+	WatchPodChanges(
+		podPrefix consul.PodPrefix,
+		nodename types.NodeName,
+		quitChan <-chan struct{},
+		errChan chan<- error,
+		changesChan chan<- consul.PodChanges,
+	)
+}
+
+// Exporter watches the health tree and the intent and reality trees of every
+// node, and writes the changes it observes to a Sink. The first read of each
+// tree is only used as the state changes are compared against, so nothing that
+// happened while the exporter wasn't running is exported. Records are buffered
+// and written in batches; if the sink fails they are kept, up to MaxBuffered of
+// them, and written with the next batch.
+type Exporter struct {
+	health HealthWatcher
+	pods   PodChangeWatcher
+	sink   Sink
+	logger logging.Logger
+
+	flushInterval time.Duration
+	batchSize     int
+	maxBuffered   int
+
+	pending []Record
+}
+
+func NewExporter(
+	healthWatcher HealthWatcher,
+	pods PodChangeWatcher,
+	sink Sink,
+	config Config,
+	logger logging.Logger,
+) *Exporter {
+	return &Exporter{
+		health:        healthWatcher,
+		pods:          pods,
+		sink:          sink,
+		logger:        logger,
+		flushInterval: config.FlushInterval,
+		batchSize:     config.BatchSize,
+		maxBuffered:   config.MaxBuffered,
+	}
+}
+
+// Run exports records until quit is closed, then makes a last attempt to write
+// the records that are still buffered
+func (e *Exporter) Run(quit <-chan struct{}) {
+	records := make(chan []Record)
+	go e.watchHealth(records, quit)
+	go e.watchPods(consul.INTENT_TREE, records, quit)
+	go e.watchPods(consul.REALITY_TREE, records, quit)
+
+	ticker := time.NewTicker(e.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-quit:
+			e.flush()
+			return
+		case batch := <-records:
+			e.add(batch)
+			if len(e.pending) >= e.batchSize {
+				e.flush()
+			}
+		case <-ticker.C:
+			e.flush()
+		}
+	}
+}
+
+func (e *Exporter) add(records []Record) {
+	e.pending = append(e.pending, records...)
+	if dropped := len(e.pending) - e.maxBuffered; dropped > 0 {
+		e.logger.WithField("dropped", dropped).Warnln("Too many records are buffered, dropping the oldest")
+		e.pending = append([]Record(nil), e.pending[dropped:]...)
+	}
+}
+
+func (e *Exporter) flush() {
+	for len(e.pending) > 0 {
+		n := e.batchSize
+		if n > len(e.pending) {
+			n = len(e.pending)
+		}
+		err := e.sink.Write(e.pending[:n])
+		if err != nil {
+			e.logger.WithErrorAndFields(err, logrus.Fields{
+				"buffered": len(e.pending),
+			}).Errorln("Could not write records to the warehouse, will retry")
+			return
+		}
+		e.pending = e.pending[n:]
+	}
+	e.pending = nil
+}
+
+func (e *Exporter) watchHealth(records chan<- []Record, quit <-chan struct{}) {
+	// WatchHealth requires a buffered channel
+	resultCh := make(chan []*health.Result, 1)
+	errCh := make(chan error)
+	go e.health.WatchHealth(resultCh, errCh, quit, 0)
+
+	var previous map[healthKey]health.Result
+	for {
+		select {
+		case <-quit:
+			return
+		case err := <-errCh:
+			e.logger.WithError(err).Errorln("Could not watch health")
+		case results := <-resultCh:
+			var transitions []Record
+			previous, transitions = healthTransitions(previous, results, time.Now())
+			if len(transitions) == 0 {
+				continue
+			}
+			select {
+			case <-quit:
+				return
+			case records <- transitions:
+			}
+		}
+	}
+}
+
+type healthKey struct {
+	service string
+	node    types.NodeName
+}
+
+// healthTransitions returns the current health of every service on every node,
+// and the records of how it changed since previous. A nil previous is the
+// first read, which nothing is compared against.
+func healthTransitions(
+	previous map[healthKey]health.Result,
+	results []*health.Result,
+	now time.Time,
+) (map[healthKey]health.Result, []Record) {
+	current := make(map[healthKey]health.Result, len(results))
+	for _, result := range results {
+		current[healthKey{service: result.Service, node: result.Node}] = *result
+	}
+	if previous == nil {
+		return current, nil
+	}
+
+	var records []Record
+	for key, result := range current {
+		last, ok := previous[key]
+		if ok && last.Status == result.Status {
+			continue
+		}
+		records = append(records, Record{
+			Kind:           KindHealthTransition,
+			Time:           now,
+			Node:           result.Node,
+			PodID:          result.ID,
+			Status:         result.Status,
+			PreviousStatus: last.Status,
+			Reason:         result.Reason,
+		})
+	}
+	for key, last := range previous {
+		if _, ok := current[key]; ok || last.Status == health.Unknown {
+			continue
+		}
+		records = append(records, Record{
+			Kind:           KindHealthTransition,
+			Time:           now,
+			Node:           last.Node,
+			PodID:          last.ID,
+			Status:         health.Unknown,
+			PreviousStatus: last.Status,
+		})
+	}
+	return current, records
+}
+
+func (e *Exporter) watchPods(tree consul.PodPrefix, records chan<- []Record, quit <-chan struct{}) {
+	changesCh := make(chan consul.PodChanges)
+	errCh := make(chan error)
+	go e.pods.WatchPodChanges(tree, "", quit, errCh, changesCh)
+
+	first := true
+	for {
+		select {
+		case <-quit:
+			return
+		case err := <-errCh:
+			e.logger.WithErrorAndFields(err, logrus.Fields{"tree": tree}).Errorln("Could not watch pods")
+		case changes, ok := <-changesCh:
+			if !ok {
+				return
+			}
+			if first {
+				// every pod is reported as created by the first read
+				first = false
+				continue
+			}
+			lifecycle := podLifecycleRecords(tree, changes, time.Now())
+			if len(lifecycle) == 0 {
+				continue
+			}
+			select {
+			case <-quit:
+				return
+			case records <- lifecycle:
+			}
+		}
+	}
+}
+
+func podLifecycleRecords(tree consul.PodPrefix, changes consul.PodChanges, now time.Time) []Record {
+	var records []Record
+	add := func(change PodChange, results []consul.ManifestResult) {
+		for _, result := range results {
+			record := Record{
+				Kind:         KindPodLifecycle,
+				Time:         now,
+				Node:         result.PodLocation.Node,
+				PodID:        result.Manifest.ID(),
+				PodUniqueKey: result.PodUniqueKey,
+				Tree:         tree.String(),
+				Change:       change,
+			}
+			if change != PodDeleted {
+				record.ManifestSHA, _ = result.Manifest.SHA()
+			}
+			records = append(records, record)
+		}
+	}
+	add(PodCreated, changes.Created)
+	add(PodUpdated, changes.Updated)
+	add(PodDeleted, changes.Deleted)
+	return records
+}
@@ -0,0 +1,220 @@
+package warehouse
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+type fakeSink struct {
+	mu      sync.Mutex
+	err     error
+	batches [][]Record
+}
+
+func (f *fakeSink) Write(records []Record) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.batches = append(f.batches, append([]Record(nil), records...))
+	return nil
+}
+
+func (f *fakeSink) records() []Record {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var records []Record
+	for _, batch := range f.batches {
+		records = append(records, batch...)
+	}
+	return records
+}
+
+type fakeHealthWatcher struct {
+	results chan []*health.Result
+}
+
+func (f fakeHealthWatcher) WatchHealth(resultCh chan []*health.Result, errCh chan<- error, quitCh <-chan struct{}, jitterWindow time.Duration) {
+	for {
+		select {
+		case <-quitCh:
+			return
+		case results := <-f.results:
+			resultCh <- results
+		}
+	}
+}
+
+type fakePodChangeWatcher struct {
+	changes map[consul.PodPrefix]chan consul.PodChanges
+}
+
+func (f fakePodChangeWatcher) WatchPodChanges(
+	podPrefix consul.PodPrefix,
+	nodename types.NodeName,
+	quitChan <-chan struct{},
+	errChan chan<- error,
+	changesChan chan<- consul.PodChanges,
+) {
+	defer close(changesChan)
+	for {
+		select {
+		case <-quitChan:
+			return
+		case changes := <-f.changes[podPrefix]:
+			changesChan <- changes
+		}
+	}
+}
+
+func healthResult(node types.NodeName, status health.HealthState) *health.Result {
+	return &health.Result{ID: "web", Node: node, Service: "web", Status: status}
+}
+
+func manifestResult(node types.NodeName) consul.ManifestResult {
+	builder := manifest.NewBuilder()
+	builder.SetID("web")
+	return consul.ManifestResult{
+		Manifest:    builder.GetManifest(),
+		PodLocation: types.PodLocation{Node: node, PodID: "web"},
+	}
+}
+
+func TestHealthTransitions(t *testing.T) {
+	now := time.Now()
+	current, records := healthTransitions(nil, []*health.Result{
+		healthResult("node1", health.Passing),
+		healthResult("node2", health.Passing),
+	}, now)
+	if len(records) != 0 {
+		t.Fatalf("expected the first read not to be exported, got %v", records)
+	}
+
+	current, records = healthTransitions(current, []*health.Result{
+		healthResult("node1", health.Passing),
+		healthResult("node2", health.Critical),
+		healthResult("node3", health.Passing),
+	}, now)
+	if len(records) != 2 {
+		t.Fatalf("expected 2 transitions, got %v", records)
+	}
+	transitions := make(map[types.NodeName]Record)
+	for _, record := range records {
+		transitions[record.Node] = record
+	}
+	if record := transitions["node2"]; record.Status != health.Critical || record.PreviousStatus != health.Passing {
+		t.Errorf("expected node2 to go from passing to critical, got %+v", record)
+	}
+	if record := transitions["node3"]; record.Status != health.Passing || record.PreviousStatus != "" {
+		t.Errorf("expected node3 to start passing, got %+v", record)
+	}
+	if transitions["node2"].Kind != KindHealthTransition || transitions["node2"].PodID != "web" {
+		t.Errorf("expected a health transition of web, got %+v", transitions["node2"])
+	}
+
+	_, records = healthTransitions(current, []*health.Result{
+		healthResult("node1", health.Passing),
+		healthResult("node2", health.Critical),
+	}, now)
+	if len(records) != 1 || records[0].Node != "node3" || records[0].Status != health.Unknown {
+		t.Errorf("expected a disappearing result to become unknown, got %v", records)
+	}
+}
+
+func TestPodLifecycleRecords(t *testing.T) {
+	changes := consul.PodChanges{
+		Created: []consul.ManifestResult{manifestResult("node1")},
+		Deleted: []consul.ManifestResult{manifestResult("node2")},
+	}
+	records := podLifecycleRecords(consul.REALITY_TREE, changes, time.Now())
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %v", records)
+	}
+	created, deleted := records[0], records[1]
+	if created.Change != PodCreated || created.Node != "node1" || created.Tree != "reality" || created.ManifestSHA == "" {
+		t.Errorf("expected web to be created on node1, got %+v", created)
+	}
+	if deleted.Change != PodDeleted || deleted.Node != "node2" || deleted.ManifestSHA != "" {
+		t.Errorf("expected web to be deleted from node2, got %+v", deleted)
+	}
+}
+
+func TestExporterRetriesAndBoundsBufferedRecords(t *testing.T) {
+	sink := &fakeSink{err: util.Errorf("unavailable")}
+	exporter := NewExporter(nil, nil, sink, Config{BatchSize: 2, MaxBuffered: 3}, logging.TestLogger())
+
+	exporter.add([]Record{{Node: "node1"}, {Node: "node2"}})
+	exporter.flush()
+	exporter.add([]Record{{Node: "node3"}, {Node: "node4"}})
+	if len(exporter.pending) != 3 || exporter.pending[0].Node != "node2" {
+		t.Fatalf("expected the oldest record to be dropped, got %v", exporter.pending)
+	}
+
+	sink.err = nil
+	exporter.flush()
+	if len(sink.batches) != 2 || len(sink.batches[0]) != 2 || len(sink.batches[1]) != 1 {
+		t.Fatalf("expected the buffered records to be written in batches of 2, got %v", sink.batches)
+	}
+	if len(exporter.pending) != 0 {
+		t.Errorf("expected no records to remain buffered, got %v", exporter.pending)
+	}
+}
+
+func TestExporterRun(t *testing.T) {
+	healthWatcher := fakeHealthWatcher{results: make(chan []*health.Result)}
+	pods := fakePodChangeWatcher{changes: map[consul.PodPrefix]chan consul.PodChanges{
+		consul.INTENT_TREE:  make(chan consul.PodChanges),
+		consul.REALITY_TREE: make(chan consul.PodChanges),
+	}}
+	sink := &fakeSink{}
+	// every record is written as soon as it's observed
+	config := Config{FlushInterval: time.Hour, BatchSize: 1, MaxBuffered: 100}
+	exporter := NewExporter(healthWatcher, pods, sink, config, logging.TestLogger())
+
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		exporter.Run(quit)
+		close(done)
+	}()
+
+	healthWatcher.results <- []*health.Result{healthResult("node1", health.Passing)}
+	healthWatcher.results <- []*health.Result{healthResult("node1", health.Critical)}
+	pods.changes[consul.INTENT_TREE] <- consul.PodChanges{Created: []consul.ManifestResult{manifestResult("node1")}}
+	pods.changes[consul.INTENT_TREE] <- consul.PodChanges{Updated: []consul.ManifestResult{manifestResult("node1")}}
+
+	deadline := time.After(5 * time.Second)
+	for len(sink.records()) < 2 {
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for the records to be exported")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	close(quit)
+	<-done
+
+	records := sink.records()
+	if len(records) != 2 {
+		t.Fatalf("expected a health transition and a pod update, got %v", records)
+	}
+	kinds := map[RecordKind]Record{}
+	for _, record := range records {
+		kinds[record.Kind] = record
+	}
+	if kinds[KindHealthTransition].Status != health.Critical {
+		t.Errorf("expected a transition to critical, got %+v", kinds[KindHealthTransition])
+	}
+	if kinds[KindPodLifecycle].Change != PodUpdated || kinds[KindPodLifecycle].Tree != "intent" {
+		t.Errorf("expected an update in the intent tree, got %+v", kinds[KindPodLifecycle])
+	}
+}
@@ -0,0 +1,232 @@
+package warehouse
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// S3Config configures a sink that writes each batch of records to an S3 bucket
+// as an object of gzipped newline delimited JSON, one Record per line. Objects
+// are named <prefix>dt=<YYYY-MM-DD>/<time>-<id>.json.gz, so that they can be
+// queried as a table partitioned by date, e.g. by Athena or Redshift Spectrum.
+// There is no parquet encoder available to P2, so converting the objects to
+// parquet is left to the warehouse.
+//
+// Credentials are read from the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// optionally AWS_SESSION_TOKEN environment variables.
+type S3Config struct {
+	Bucket string `yaml:"bucket"`
+	Region string `yaml:"region"`
+
+	// Prefix is prepended to the name of every object, e.g. "p2/events/"
+	Prefix string `yaml:"prefix,omitempty"`
+
+	// Endpoint is the S3 API's base URL, which buckets are addressed under
+	// by path. Defaults to https://s3.<region>.amazonaws.com
+	Endpoint string `yaml:"endpoint,omitempty"`
+}
+
+type awsCredentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+type s3Sink struct {
+	config      S3Config
+	endpoint    string
+	credentials awsCredentials
+	client      *http.Client
+}
+
+func NewS3Sink(config S3Config, client *http.Client) (Sink, error) {
+	if config.Bucket == "" || config.Region == "" {
+		return nil, util.Errorf("the s3 sink requires a bucket and region")
+	}
+	credentials := awsCredentials{
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if credentials.accessKeyID == "" || credentials.secretAccessKey == "" {
+		return nil, util.Errorf("the s3 sink requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY to be set")
+	}
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", config.Region)
+	}
+	return &s3Sink{
+		config:      config,
+		endpoint:    strings.TrimSuffix(endpoint, "/"),
+		credentials: credentials,
+		client:      client,
+	}, nil
+}
+
+func (s *s3Sink) Write(records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	encoder := json.NewEncoder(gz)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return util.Errorf("could not marshal record: %s", err)
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return util.Errorf("could not compress records: %s", err)
+	}
+
+	now := time.Now().UTC()
+	key := fmt.Sprintf(
+		"%sdt=%s/%s-%s.json.gz",
+		s.config.Prefix,
+		now.Format("2006-01-02"),
+		now.Format("20060102T150405.000000000Z"),
+		records[0].ID()[:16],
+	)
+	objectURL, err := url.Parse(s.endpoint)
+	if err != nil {
+		return util.Errorf("invalid s3 endpoint %s: %s", s.endpoint, err)
+	}
+	objectURL.Path += "/" + s.config.Bucket + "/" + key
+	objectURL.RawPath = awsURIPath(objectURL.Path)
+
+	req, err := http.NewRequest("PUT", objectURL.String(), bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	payloadHash := sha256.Sum256(body.Bytes())
+	signV4(req, hex.EncodeToString(payloadHash[:]), s.credentials, s.config.Region, "s3", now)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return util.Errorf("could not write %s to s3: %s", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return util.Errorf("s3 returned status %d writing %s: %s", resp.StatusCode, key, message)
+	}
+	return nil
+}
+
+// signV4 signs req with AWS Signature Version 4, as described at
+// https://docs.aws.amazon.com/general/latest/gr/signature-version-4.html. Every
+// header already set on req is signed, along with the host.
+func signV4(req *http.Request, payloadHash string, credentials awsCredentials, region string, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if credentials.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", credentials.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsURIPath(req.URL.Path),
+		awsQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(canonicalHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+credentials.secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s,SignedHeaders=%s,Signature=%s",
+		credentials.accessKeyID,
+		scope,
+		signedHeaders,
+		signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsURIPath encodes each segment of a path the way AWS expects
+func awsURIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = awsURIEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func awsQuery(query url.Values) string {
+	var params []string
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, awsURIEncode(name)+"="+awsURIEncode(value))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// awsURIEncode percent encodes every byte of s but the unreserved characters
+// of RFC 3986
+func awsURIEncode(s string) string {
+	var encoded bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~' {
+			encoded.WriteByte(c)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+	return encoded.String()
+}
@@ -0,0 +1,148 @@
+// Package warehouse exports the health transitions and pod lifecycle events of
+// a P2 cluster to a data warehouse, so that reliability can be analyzed over
+// longer periods than Consul keeps. Consul only holds the current state of the
+// health and pod trees; the Exporter watches them and writes each change it
+// observes to a Sink, such as a BigQuery table or an S3 bucket.
+package warehouse
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	"gopkg.in/yaml.v2"
+)
+
+type RecordKind string
+
+const (
+	// The health status of a service on a node changed
+	KindHealthTransition RecordKind = "health_transition"
+
+	// A pod was created, updated or deleted in the intent or reality tree
+	KindPodLifecycle RecordKind = "pod_lifecycle"
+)
+
+// PodChange is how a pod changed in a pod tree
+type PodChange string
+
+const (
+	PodCreated PodChange = "created"
+	PodUpdated PodChange = "updated"
+	PodDeleted PodChange = "deleted"
+)
+
+// Record is a row of the warehouse. Its JSON field names are the column names
+// expected by the sinks.
+type Record struct {
+	Kind RecordKind `json:"kind"`
+
+	// When the exporter observed the change
+	Time time.Time `json:"time"`
+
+	Node         types.NodeName     `json:"node"`
+	PodID        types.PodID        `json:"pod_id"`
+	PodUniqueKey types.PodUniqueKey `json:"pod_unique_key,omitempty"`
+
+	// Health transitions only. PreviousStatus is empty if the service had
+	// no health result on the node. A service whose result disappears, for
+	// example because the node stopped renewing it, transitions to unknown
+	Status         health.HealthState `json:"status,omitempty"`
+	PreviousStatus health.HealthState `json:"previous_status,omitempty"`
+	Reason         health.Reason      `json:"reason,omitempty"`
+
+	// Pod lifecycle events only. Tree is "intent" or "reality", and
+	// ManifestSHA is empty for deleted pods
+	Tree        string    `json:"tree,omitempty"`
+	Change      PodChange `json:"change,omitempty"`
+	ManifestSHA string    `json:"manifest_sha,omitempty"`
+}
+
+// ID identifies the record, so that sinks can deduplicate records that are
+// written more than once
+func (r Record) ID() string {
+	// Marshaling a struct can't fail
+	data, _ := json.Marshal(r)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Sink stores records in a warehouse
+type Sink interface {
+	// Write stores a batch of records. Batches that fail are written again
+	// later, along with the records that arrived since, so the same record
+	// may be written more than once.
+	Write(records []Record) error
+}
+
+const (
+	defaultFlushInterval = 1 * time.Minute
+	defaultBatchSize     = 500
+	defaultMaxBuffered   = 100000
+)
+
+// Config configures the exporter. Exactly one sink must be configured.
+type Config struct {
+	BigQuery *BigQueryConfig `yaml:"bigquery,omitempty"`
+	S3       *S3Config       `yaml:"s3,omitempty"`
+
+	// FlushInterval is how often buffered records are written to the sink.
+	// Defaults to a minute
+	FlushInterval time.Duration `yaml:"flush_interval,omitempty"`
+
+	// BatchSize is the most records written to the sink at once, and how
+	// many records are buffered before they are written early. Defaults to
+	// 500
+	BatchSize int `yaml:"batch_size,omitempty"`
+
+	// MaxBuffered bounds how many records are kept while the sink is
+	// failing. Past it the oldest records are dropped. Defaults to 100000
+	MaxBuffered int `yaml:"max_buffered,omitempty"`
+}
+
+// LoadConfig reads a YAML exporter config from the given path
+func LoadConfig(path string) (Config, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, util.Errorf("could not read warehouse config: %s", err)
+	}
+
+	var config Config
+	err = yaml.Unmarshal(bytes, &config)
+	if err != nil {
+		return Config{}, util.Errorf("could not parse warehouse config %s: %s", path, err)
+	}
+
+	if (config.BigQuery == nil) == (config.S3 == nil) {
+		return Config{}, util.Errorf("warehouse config %s must configure exactly one of bigquery and s3", path)
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaultFlushInterval
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultBatchSize
+	}
+	if config.MaxBuffered <= 0 {
+		config.MaxBuffered = defaultMaxBuffered
+	}
+	return config, nil
+}
+
+// NewSink returns the sink configured by config
+func NewSink(config Config, client *http.Client, logger logging.Logger) (Sink, error) {
+	if config.BigQuery != nil {
+		return NewBigQuerySink(*config.BigQuery, client, logger)
+	}
+	if config.S3 != nil {
+		return NewS3Sink(*config.S3, client)
+	}
+	return nil, util.Errorf("no warehouse sink is configured")
+}
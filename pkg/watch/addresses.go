@@ -0,0 +1,160 @@
+package watch
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/manifest"
+)
+
+// lookupIP resolves the "ipv4" and "ipv6" status addresses, it is a variable
+// so that tests can replace it
+var lookupIP = net.LookupIP
+
+// addressesCheck checks each of the status checker's addresses and combines
+// the results per its address policy. The result lists the outcome for every
+// address.
+func (sc *StatusChecker) addressesCheck() (health.Result, error) {
+	res := health.Result{
+		ID:      sc.ID,
+		Node:    sc.Node,
+		Service: string(sc.ID),
+		Check:   sc.Config(),
+	}
+
+	addresses, err := sc.resolveAddresses()
+	if err != nil || len(addresses) == 0 {
+		res.Status = health.Critical
+		res.Reason = health.ReasonNoAddresses
+		return res, nil
+	}
+
+	var results health.ResultList
+	res.Addresses = &health.AddressResults{}
+	for _, address := range addresses {
+		addressRes, err := sc.atAddress(address).podCheck()
+		if err != nil {
+			return health.Result{}, err
+		}
+		results = append(results, addressRes)
+		res.Addresses.Results = append(res.Addresses.Results, health.AddressResult{
+			Address: address,
+			Status:  addressRes.Status,
+			Reason:  addressRes.Reason,
+		})
+	}
+
+	var combined *health.Result
+	if sc.AddressPolicy == manifest.AddressPolicyAny {
+		combined = results.MaxValue()
+	} else {
+		combined = results.MinValue()
+	}
+	res.Status = combined.Status
+	res.Reason = combined.Reason
+	return res, nil
+}
+
+// resolveAddresses expands the "ipv4" and "ipv6" entries of the status
+// checker's addresses into the addresses of that family that its host
+// resolves to
+func (sc *StatusChecker) resolveAddresses() ([]string, error) {
+	var addresses []string
+	var ips []net.IP
+	for _, address := range sc.Addresses {
+		if address != manifest.StatusAddressIPv4 && address != manifest.StatusAddressIPv6 {
+			addresses = append(addresses, address)
+			continue
+		}
+
+		if ips == nil {
+			host, err := sc.host()
+			if err != nil {
+				return nil, err
+			}
+			ips, err = lookupIP(host)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, ip := range ips {
+			isIPv4 := ip.To4() != nil
+			if isIPv4 == (address == manifest.StatusAddressIPv4) {
+				addresses = append(addresses, ip.String())
+			}
+		}
+	}
+	return addresses, nil
+}
+
+// host returns the host name that the status check is made to
+func (sc *StatusChecker) host() (string, error) {
+	if sc.GRPC != nil {
+		host, _, err := net.SplitHostPort(sc.GRPC.Target)
+		return host, err
+	}
+	if sc.TCP != nil {
+		host, _, err := net.SplitHostPort(sc.TCP.Target)
+		return host, err
+	}
+	u, err := url.Parse(sc.URI)
+	if err != nil {
+		return "", errors.Errorf("invalid status URI %q: %w", sc.URI, err)
+	}
+	return u.Hostname(), nil
+}
+
+// atAddress returns a copy of the status checker that connects to the given
+// address instead of its host. Requests are otherwise unchanged, so TLS
+// certificates are still verified against the host.
+func (sc *StatusChecker) atAddress(address string) *StatusChecker {
+	check := *sc
+	check.Addresses = nil
+	if sc.GRPC != nil {
+		grpcCheck := *sc.GRPC
+		grpcCheck.Address = address
+		check.GRPC = &grpcCheck
+	} else if sc.TCP != nil {
+		tcpCheck := *sc.TCP
+		tcpCheck.Address = address
+		check.TCP = &tcpCheck
+	} else {
+		check.Client = pinnedClient(sc.Client, address)
+	}
+	return &check
+}
+
+// pinnedClient returns an HTTP client that behaves like base, except that it
+// connects to address whatever the host of the request is. Connections aren't
+// kept alive, so that a client can be made for each check.
+func pinnedClient(base *http.Client, address string) *http.Client {
+	dialTimeout := time.Duration(*HEALTHCHECK_TIMEOUT) * time.Second
+	transport := &http.Transport{
+		Dial: func(network, addr string) (net.Conn, error) {
+			return net.DialTimeout(network, pinAddress(addr, address), dialTimeout)
+		},
+		DisableKeepAlives: true,
+	}
+
+	client := &http.Client{Transport: transport}
+	if base != nil {
+		client.Timeout = base.Timeout
+		if baseTransport, ok := base.Transport.(*http.Transport); ok && baseTransport.TLSClientConfig != nil {
+			transport.TLSClientConfig = baseTransport.TLSClientConfig.Clone()
+		}
+	}
+	return client
+}
+
+// pinAddress replaces the host of a "host:port" with address
+func pinAddress(hostPort string, address string) string {
+	_, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return hostPort
+	}
+	return net.JoinHostPort(address, port)
+}
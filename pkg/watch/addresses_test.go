@@ -0,0 +1,108 @@
+package watch
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/manifest"
+)
+
+func TestAddressesCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if host, _, _ := net.SplitHostPort(r.Host); host != "pod.example.com" {
+			t.Errorf("expected requests to keep the original host, got %s", r.Host)
+		}
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sc := StatusChecker{
+		ID:            "foo",
+		Node:          "node1",
+		URI:           "http://pod.example.com:" + serverURL.Port() + "/_status",
+		Client:        http.DefaultClient,
+		Addresses:     []string{"127.0.0.1"},
+		AddressPolicy: manifest.AddressPolicyAll,
+	}
+	res, err := sc.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != health.Passing {
+		t.Errorf("expected the check of the server's address to pass, got %s (%s)", res.Status, res.Reason)
+	}
+
+	// nothing listens on 127.0.0.2
+	sc.Addresses = []string{"127.0.0.1", "127.0.0.2"}
+	res, err = sc.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != health.Critical || res.Reason != health.ReasonConnectionRefused {
+		t.Errorf("expected the check to fail when one address is down, got %s (%s)", res.Status, res.Reason)
+	}
+	expected := []health.AddressResult{
+		{Address: "127.0.0.1", Status: health.Passing},
+		{Address: "127.0.0.2", Status: health.Critical, Reason: health.ReasonConnectionRefused},
+	}
+	if res.Addresses == nil || !reflect.DeepEqual(res.Addresses.Results, expected) {
+		t.Errorf("expected address results %+v, got %+v", expected, res.Addresses)
+	}
+	if !reflect.DeepEqual(res.Check.Addresses, sc.Addresses) || res.Check.AddressPolicy != manifest.AddressPolicyAll {
+		t.Errorf("expected the check config to include the addresses and policy, got %+v", res.Check)
+	}
+
+	sc.AddressPolicy = manifest.AddressPolicyAny
+	res, err = sc.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != health.Passing {
+		t.Errorf("expected the check to pass when any address is up, got %s (%s)", res.Status, res.Reason)
+	}
+}
+
+func TestResolveAddresses(t *testing.T) {
+	defer func(original func(string) ([]net.IP, error)) { lookupIP = original }(lookupIP)
+	var lookedUp []string
+	lookupIP = func(host string) ([]net.IP, error) {
+		lookedUp = append(lookedUp, host)
+		return []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("fd00::1"), net.ParseIP("10.0.0.2")}, nil
+	}
+
+	sc := StatusChecker{
+		URI:       "https://node1:8443/_status",
+		Addresses: []string{manifest.StatusAddressIPv6, "192.168.0.1", manifest.StatusAddressIPv4},
+	}
+	addresses, err := sc.resolveAddresses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"fd00::1", "192.168.0.1", "10.0.0.1", "10.0.0.2"}
+	if !reflect.DeepEqual(addresses, expected) {
+		t.Errorf("expected addresses %v, got %v", expected, addresses)
+	}
+	if !reflect.DeepEqual(lookedUp, []string{"node1"}) {
+		t.Errorf("expected the node's name to be looked up once, got %v", lookedUp)
+	}
+
+	lookupIP = func(host string) ([]net.IP, error) {
+		return []net.IP{net.ParseIP("10.0.0.1")}, nil
+	}
+	sc.Addresses = []string{manifest.StatusAddressIPv6}
+	res, err := sc.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != health.Critical || res.Reason != health.ReasonNoAddresses {
+		t.Errorf("expected a node without IPv6 addresses to be critical with reason %s, got %s (%s)", health.ReasonNoAddresses, res.Status, res.Reason)
+	}
+}
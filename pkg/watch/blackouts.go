@@ -0,0 +1,71 @@
+package watch
+
+import (
+	"sync"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util/param"
+)
+
+var healthBlackoutPollSeconds = param.Int("health_blackout_poll_seconds", 30)
+
+// BlackoutStore reads the health blackout windows of every pod
+type BlackoutStore interface {
+	AllHealthBlackouts() (map[types.PodID][]health.BlackoutWindow, error)
+}
+
+// HealthBlackouts keeps a copy of the health blackout windows of every pod,
+// refreshed from consul, so that checks don't have to read them each time
+type HealthBlackouts struct {
+	store  BlackoutStore
+	logger *logging.Logger
+
+	mu      sync.RWMutex
+	windows map[types.PodID][]health.BlackoutWindow
+}
+
+func NewHealthBlackouts(store BlackoutStore, logger *logging.Logger) *HealthBlackouts {
+	return &HealthBlackouts{
+		store:   store,
+		logger:  logger,
+		windows: make(map[types.PodID][]health.BlackoutWindow),
+	}
+}
+
+// Run refreshes the blackout windows until quitCh is closed. The last windows
+// that were read are kept while they can't be refreshed.
+func (b *HealthBlackouts) Run(quitCh <-chan struct{}) {
+	for {
+		b.refresh()
+		select {
+		case <-quitCh:
+			return
+		case <-time.After(time.Duration(*healthBlackoutPollSeconds) * time.Second):
+		}
+	}
+}
+
+func (b *HealthBlackouts) refresh() {
+	windows, err := b.store.AllHealthBlackouts()
+	if err != nil {
+		b.logger.WithError(err).Warningln("Could not refresh health blackout windows")
+		return
+	}
+	b.mu.Lock()
+	b.windows = windows
+	b.mu.Unlock()
+}
+
+// suppress marks the result as suppressed if it is critical and its pod is in
+// a blackout window
+func (b *HealthBlackouts) suppress(res *health.Result) {
+	if res.Status != health.Critical {
+		return
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	res.Suppressed = health.InBlackout(b.windows[res.ID], time.Now())
+}
@@ -0,0 +1,43 @@
+package watch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/types"
+)
+
+type fakeBlackoutStore map[types.PodID][]health.BlackoutWindow
+
+func (s fakeBlackoutStore) AllHealthBlackouts() (map[types.PodID][]health.BlackoutWindow, error) {
+	return s, nil
+}
+
+func TestSuppressDuringBlackout(t *testing.T) {
+	logger := logging.TestLogger()
+	now := time.Now()
+	blackouts := NewHealthBlackouts(fakeBlackoutStore{
+		"nightly": {{Start: now.Add(-time.Minute), End: now.Add(time.Hour)}},
+	}, &logger)
+	blackouts.refresh()
+
+	res := health.Result{ID: "nightly", Status: health.Critical}
+	blackouts.suppress(&res)
+	if !res.Suppressed {
+		t.Error("expected a critical result during a blackout window to be suppressed")
+	}
+
+	res = health.Result{ID: "nightly", Status: health.Warning}
+	blackouts.suppress(&res)
+	if res.Suppressed {
+		t.Error("expected only critical results to be suppressed")
+	}
+
+	res = health.Result{ID: "other", Status: health.Critical}
+	blackouts.suppress(&res)
+	if res.Suppressed {
+		t.Error("expected results of pods without blackout windows not to be suppressed")
+	}
+}
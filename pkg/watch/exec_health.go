@@ -0,0 +1,95 @@
+package watch
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/p2exec"
+)
+
+// The exit codes of exec status checks that aren't critical, following the
+// conventions of nagios plugins
+const (
+	execPassingExitCode = 0
+	execWarningExitCode = 1
+)
+
+// ExecCheck checks a pod's health by running a command and mapping its exit
+// code to a health state
+type ExecCheck struct {
+	// The command that the pod's manifest declares, which is what is
+	// published with results
+	Command []string
+
+	// What is actually run, which wraps Command in p2-exec so that it runs
+	// as the pod's user with the pod's environment
+	CommandLine []string
+}
+
+// newExecCheck builds an exec check of a pod that runs command
+func newExecCheck(man manifest.Manifest, command []string, podRoot string) *ExecCheck {
+	home := podHome(man, podRoot)
+	args := p2exec.P2ExecArgs{
+		User:    man.RunAsUser(),
+		EnvDirs: []string{filepath.Join(home, "env")},
+		WorkDir: home,
+		Command: command,
+	}
+	return &ExecCheck{
+		Command:     command,
+		CommandLine: append([]string{p2exec.DefaultP2Exec}, args.CommandLine()...),
+	}
+}
+
+// Check runs the command, killing it if it outlasts the health check timeout.
+// It returns the command's exit code, or an error if the command couldn't be
+// run or timed out.
+func (c *ExecCheck) Check() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*HEALTHCHECK_TIMEOUT)*time.Second)
+	defer cancel()
+
+	err := exec.CommandContext(ctx, c.CommandLine[0], c.CommandLine[1:]...).Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return -1, ctx.Err()
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Exited() {
+			return status.ExitStatus(), nil
+		}
+	}
+	if err != nil {
+		return -1, err
+	}
+	return execPassingExitCode, nil
+}
+
+func (sc *StatusChecker) resultFromExecCheck(exitCode int, err error) (health.Result, error) {
+	res := health.Result{
+		ID:      sc.ID,
+		Node:    sc.Node,
+		Service: string(sc.ID),
+		Check:   sc.Config(),
+	}
+	switch {
+	case err == context.DeadlineExceeded:
+		res.Status = health.Critical
+		res.Reason = health.ReasonTimeout
+	case err != nil:
+		res.Status = health.Critical
+		res.Reason = health.ReasonInvalidCheck
+	case exitCode == execPassingExitCode:
+		res.Status = health.Passing
+	case exitCode == execWarningExitCode:
+		res.Status = health.Warning
+		res.Reason = health.ReasonExitCode
+	default:
+		res.Status = health.Critical
+		res.Reason = health.ReasonExitCode
+	}
+	return res, nil
+}
@@ -0,0 +1,68 @@
+package watch
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/manifest"
+)
+
+func TestExecCheck(t *testing.T) {
+	for _, test := range []struct {
+		script string
+		status health.HealthState
+		reason health.Reason
+	}{
+		{"exit 0", health.Passing, ""},
+		{"exit 1", health.Warning, health.ReasonExitCode},
+		{"exit 2", health.Critical, health.ReasonExitCode},
+		{"kill -9 $$", health.Critical, health.ReasonInvalidCheck},
+	} {
+		sc := StatusChecker{ID: "foo", Exec: &ExecCheck{
+			Command:     []string{"check"},
+			CommandLine: []string{"sh", "-c", test.script},
+		}}
+		res, err := sc.Check()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != test.status || res.Reason != test.reason {
+			t.Errorf("%q: expected %s (%s), got %s (%s)", test.script, test.status, test.reason, res.Status, res.Reason)
+		}
+		if !reflect.DeepEqual(res.Check.Exec, []string{"check"}) || res.Check.URI != "" {
+			t.Errorf("%q: expected the check config to have the declared command, got %+v", test.script, res.Check)
+		}
+	}
+
+	sc := StatusChecker{ID: "foo", Exec: &ExecCheck{CommandLine: []string{"/nonexistent/check"}}}
+	res, err := sc.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != health.Critical || res.Reason != health.ReasonInvalidCheck {
+		t.Errorf("expected a missing command to be critical with reason %s, got %s (%s)", health.ReasonInvalidCheck, res.Status, res.Reason)
+	}
+}
+
+func TestNewExecCheck(t *testing.T) {
+	man, err := manifest.FromBytes([]byte(`
+id: foo
+run_as: bar
+status:
+  exec: [bin/check, --quick]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := newExecCheck(man, man.GetStatusStanza().Exec, "/data/pods")
+	if !reflect.DeepEqual(check.Command, []string{"bin/check", "--quick"}) {
+		t.Errorf("unexpected command %v", check.Command)
+	}
+	expected := "-u bar -e /data/pods/foo/env -w /data/pods/foo -- bin/check --quick"
+	if commandLine := strings.Join(check.CommandLine[1:], " "); commandLine != expected {
+		t.Errorf("expected the check to run %q, got %q", expected, commandLine)
+	}
+}
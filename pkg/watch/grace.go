@@ -0,0 +1,73 @@
+package watch
+
+import (
+	"sync"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+)
+
+// gracePeriod tracks the startup grace period of a pod, during which
+// critical results are reported as unknown. It is shared by the copies of
+// the pod's PodWatch, and restarts whenever a new version of the pod is
+// launched.
+//
+// The health monitor doesn't know when pods were actually launched, so the
+// grace period also starts when the health monitor itself starts. It ends as
+// soon as the pod passes, so this only affects pods that are already
+// failing.
+type gracePeriod struct {
+	period time.Duration
+
+	mu      sync.Mutex
+	sha     string
+	started time.Time
+	ended   bool
+}
+
+func newGracePeriod(period time.Duration, sha string) *gracePeriod {
+	return &gracePeriod{
+		period:  period,
+		sha:     sha,
+		started: time.Now(),
+	}
+}
+
+// relaunched restarts the grace period if sha isn't the version of the pod
+// that it was last started for
+func (g *gracePeriod) relaunched(sha string) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if sha == g.sha {
+		return
+	}
+	g.sha = sha
+	g.started = time.Now()
+	g.ended = false
+}
+
+// apply reports a critical result as unknown if the pod is within its grace
+// period. A passing result ends the grace period.
+func (g *gracePeriod) apply(res *health.Result) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if res.Status == health.Passing {
+		g.ended = true
+		return
+	}
+	if res.Status == health.Critical && !g.ended && time.Since(g.started) < g.period {
+		res.Status = health.Unknown
+		if res.Readiness == health.Critical {
+			res.Readiness = health.Unknown
+		}
+		if res.Liveness == health.Critical {
+			res.Liveness = health.Unknown
+		}
+	}
+}
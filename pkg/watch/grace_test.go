@@ -0,0 +1,60 @@
+package watch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+)
+
+func TestGracePeriod(t *testing.T) {
+	grace := newGracePeriod(time.Minute, "abc")
+
+	res := health.Result{Status: health.Critical, Reason: health.ReasonConnectionRefused}
+	grace.apply(&res)
+	if res.Status != health.Unknown || res.Reason != health.ReasonConnectionRefused {
+		t.Errorf("expected critical result during the grace period to be unknown with its reason, got %s (%s)", res.Status, res.Reason)
+	}
+
+	res = health.Result{Status: health.Warning}
+	grace.apply(&res)
+	if res.Status != health.Warning {
+		t.Errorf("expected warning result to be unchanged, got %s", res.Status)
+	}
+
+	res = health.Result{Status: health.Passing}
+	grace.apply(&res)
+	res = health.Result{Status: health.Critical}
+	grace.apply(&res)
+	if res.Status != health.Critical {
+		t.Errorf("expected passing to end the grace period, got %s", res.Status)
+	}
+
+	grace.relaunched("abc")
+	res = health.Result{Status: health.Critical}
+	grace.apply(&res)
+	if res.Status != health.Critical {
+		t.Errorf("expected the same version not to restart the grace period, got %s", res.Status)
+	}
+
+	grace.relaunched("def")
+	res = health.Result{Status: health.Critical}
+	grace.apply(&res)
+	if res.Status != health.Unknown {
+		t.Errorf("expected a new version to restart the grace period, got %s", res.Status)
+	}
+
+	grace.started = time.Now().Add(-2 * time.Minute)
+	res = health.Result{Status: health.Critical}
+	grace.apply(&res)
+	if res.Status != health.Critical {
+		t.Errorf("expected critical result after the grace period to be critical, got %s", res.Status)
+	}
+
+	var noGrace *gracePeriod
+	res = health.Result{Status: health.Critical}
+	noGrace.apply(&res)
+	if res.Status != health.Critical {
+		t.Errorf("expected pods without a grace period to be critical, got %s", res.Status)
+	}
+}
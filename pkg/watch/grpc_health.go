@@ -0,0 +1,122 @@
+package watch
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+
+	healthcheck_protos "github.com/square/p2/pkg/grpc/healthcheck/protos"
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+)
+
+// GRPCCheck checks a pod's health with the standard grpc.health.v1 health
+// checking protocol
+type GRPCCheck struct {
+	// The "host:port" of the server
+	Target string
+
+	// The service whose health is checked. If empty, the health of the
+	// server as a whole is checked
+	Service string
+
+	// The TLS configuration of the connection, or nil to connect without
+	// TLS
+	TLSConfig *tls.Config
+
+	// If set, the connection is made to this address instead of the host
+	// of Target, which is still what the server's certificate is verified
+	// against
+	Address string
+}
+
+// newGRPCCheck builds the gRPC check of a pod's status stanza. Checks of
+// localhost aren't verified, the same as HTTP checks of localhost.
+func newGRPCCheck(status manifest.StatusStanza, host types.NodeName, port int, tlsConfig *tls.Config) *GRPCCheck {
+	check := &GRPCCheck{
+		Target:  fmt.Sprintf("%s:%d", host, port),
+		Service: status.GRPCService,
+	}
+	if status.Plaintext {
+		return check
+	}
+
+	if tlsConfig != nil {
+		check.TLSConfig = tlsConfig.Clone()
+	} else {
+		check.TLSConfig = &tls.Config{}
+	}
+	check.TLSConfig.InsecureSkipVerify = status.LocalhostOnly
+	check.TLSConfig.ServerName = status.TLSServerName
+	return check
+}
+
+// Check asks the server for the serving status of the service
+func (c *GRPCCheck) Check() (healthcheck_protos.HealthCheckResponse_ServingStatus, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*HEALTHCHECK_TIMEOUT)*time.Second)
+	defer cancel()
+
+	dialOpt := grpc.WithInsecure()
+	if c.TLSConfig != nil {
+		dialOpt = grpc.WithTransportCredentials(credentials.NewTLS(c.TLSConfig))
+	}
+	// Blocking until the connection is up, and giving up on errors that
+	// retrying won't fix, surfaces connection errors that an RPC on a
+	// connection that isn't up would otherwise hide
+	dialOpts := []grpc.DialOption{dialOpt, grpc.WithBlock(), grpc.FailOnNonTempDialError(true)}
+	if c.Address != "" {
+		dialOpts = append(dialOpts, grpc.WithDialer(func(target string, timeout time.Duration) (net.Conn, error) {
+			return net.DialTimeout("tcp", pinAddress(target, c.Address), timeout)
+		}))
+	}
+	conn, err := grpc.DialContext(ctx, c.Target, dialOpts...)
+	if err != nil {
+		return healthcheck_protos.HealthCheckResponse_UNKNOWN, err
+	}
+	defer conn.Close()
+
+	resp, err := healthcheck_protos.NewHealthClient(conn).Check(ctx, &healthcheck_protos.HealthCheckRequest{
+		Service: c.Service,
+	})
+	if err != nil {
+		return healthcheck_protos.HealthCheckResponse_UNKNOWN, err
+	}
+	return resp.GetStatus(), nil
+}
+
+func (sc *StatusChecker) resultFromGRPCCheck(status healthcheck_protos.HealthCheckResponse_ServingStatus, err error) (health.Result, error) {
+	res := health.Result{
+		ID:      sc.ID,
+		Node:    sc.Node,
+		Service: string(sc.ID),
+		Check:   sc.Config(),
+	}
+	switch {
+	case err != nil:
+		res.Status = health.Critical
+		res.Reason = grpcErrorReason(err)
+	case status == healthcheck_protos.HealthCheckResponse_SERVING:
+		res.Status = health.Passing
+	default:
+		res.Status = health.Critical
+		res.Reason = health.ReasonGRPCNotServing
+	}
+	return res, nil
+}
+
+// grpcErrorReason categorizes an error returned by a gRPC health check. The
+// errors of failed connections only describe the underlying error, which is
+// categorized the same way as HTTP request errors.
+func grpcErrorReason(err error) health.Reason {
+	if err == context.DeadlineExceeded || grpc.Code(err) == codes.DeadlineExceeded {
+		return health.ReasonTimeout
+	}
+	return requestErrorReason(err)
+}
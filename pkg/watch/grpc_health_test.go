@@ -0,0 +1,108 @@
+package watch
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	healthcheck_protos "github.com/square/p2/pkg/grpc/healthcheck/protos"
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/manifest"
+)
+
+type fakeHealthServer struct {
+	statuses map[string]healthcheck_protos.HealthCheckResponse_ServingStatus
+}
+
+func (s fakeHealthServer) Check(ctx context.Context, req *healthcheck_protos.HealthCheckRequest) (*healthcheck_protos.HealthCheckResponse, error) {
+	return &healthcheck_protos.HealthCheckResponse{Status: s.statuses[req.GetService()]}, nil
+}
+
+func startHealthServer(t *testing.T, server fakeHealthServer) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcServer := grpc.NewServer()
+	healthcheck_protos.RegisterHealthServer(grpcServer, server)
+	go grpcServer.Serve(listener)
+	return listener.Addr().String(), grpcServer.Stop
+}
+
+func TestGRPCCheck(t *testing.T) {
+	addr, stop := startHealthServer(t, fakeHealthServer{
+		statuses: map[string]healthcheck_protos.HealthCheckResponse_ServingStatus{
+			"":         healthcheck_protos.HealthCheckResponse_SERVING,
+			"payments": healthcheck_protos.HealthCheckResponse_NOT_SERVING,
+		},
+	})
+	defer stop()
+
+	sc := StatusChecker{ID: "foo", GRPC: &GRPCCheck{Target: addr}}
+	res, err := sc.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != health.Passing {
+		t.Errorf("expected a serving server to be passing, got %s (%s)", res.Status, res.Reason)
+	}
+	if res.Check.URI != "grpc://"+addr {
+		t.Errorf("expected the check URI to be grpc://%s, got %s", addr, res.Check.URI)
+	}
+
+	sc.GRPC.Service = "payments"
+	res, err = sc.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != health.Critical || res.Reason != health.ReasonGRPCNotServing {
+		t.Errorf("expected a service that isn't serving to be critical with reason %s, got %s (%s)", health.ReasonGRPCNotServing, res.Status, res.Reason)
+	}
+	if res.Check.GRPCService != "payments" {
+		t.Errorf("expected the check config to include the service, got %q", res.Check.GRPCService)
+	}
+
+	sc.GRPC.TLSConfig = &tls.Config{}
+	res, err = sc.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != health.Critical || res.Reason != health.ReasonTLSError {
+		t.Errorf("expected a TLS check of a plaintext server to be critical with reason %s, got %s (%s)", health.ReasonTLSError, res.Status, res.Reason)
+	}
+
+	sc.GRPC.TLSConfig = nil
+	stop()
+	res, err = sc.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != health.Critical || res.Reason != health.ReasonConnectionRefused {
+		t.Errorf("expected a stopped server to be critical with reason %s, got %s (%s)", health.ReasonConnectionRefused, res.Status, res.Reason)
+	}
+}
+
+func TestNewGRPCCheck(t *testing.T) {
+	check := newGRPCCheck(manifest.StatusStanza{Type: manifest.StatusTypeGRPC, Plaintext: true}, "node1", 8443, nil)
+	if check.Target != "node1:8443" {
+		t.Errorf("expected target node1:8443, got %s", check.Target)
+	}
+	if check.TLSConfig != nil {
+		t.Error("expected a plaintext check to have no TLS config")
+	}
+
+	check = newGRPCCheck(manifest.StatusStanza{
+		Type:          manifest.StatusTypeGRPC,
+		GRPCService:   "payments",
+		TLSServerName: "payments.internal",
+	}, "node1", 8443, nil)
+	if check.Service != "payments" {
+		t.Errorf("expected service payments, got %s", check.Service)
+	}
+	if check.TLSConfig == nil || check.TLSConfig.ServerName != "payments.internal" || check.TLSConfig.InsecureSkipVerify {
+		t.Errorf("expected a verified TLS config for payments.internal, got %+v", check.TLSConfig)
+	}
+}
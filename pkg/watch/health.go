@@ -1,16 +1,37 @@
 package watch
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/Sirupsen/logrus"
+
 	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/health/expr"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/preparer"
+	"github.com/square/p2/pkg/srv"
 	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/nodehealthstatus"
 	"github.com/square/p2/pkg/types"
+	netutil "github.com/square/p2/pkg/util/net"
 	"github.com/square/p2/pkg/util/param"
 )
 
@@ -23,6 +44,14 @@ const HEALTHCHECK_INTERVAL = 1 * time.Second
 // Maximum allowed time for a single check, in seconds
 var HEALTHCHECK_TIMEOUT = param.Int64("healthcheck_timeout", 5)
 
+// Maximum time the health monitor waits, when shutting down, for the final
+// results of pods to be written, in seconds
+var HEALTH_SHUTDOWN_TIMEOUT = param.Int64("health_shutdown_timeout", 10)
+
+// Maximum size of a status response body that will be read in order to
+// evaluate a status expression or body assertions
+const maxStatusBodyBytes = 1 << 20
+
 // Contains method for watching the consul reality store to
 // track services running on a node. A manager method:
 // MonitorPodHealth tracks the reality store and manages
@@ -42,6 +71,47 @@ type PodWatch struct {
 	// on the pod associated with this PodWatch
 	shutdownCh chan bool
 
+	// Closed when the health monitor is shutting down, in which case a
+	// final "shutting down" result is published for the pod before it
+	// stops being checked
+	finalCh chan struct{}
+
+	// Closed once the pod has stopped being checked
+	stoppedCh chan struct{}
+
+	// If non-nil, the latest health result is also recorded here
+	nodeHealth *NodeHealth
+
+	// If non-nil, the pod's SRV records are published while it is healthy
+	srvSync *SRVSync
+
+	// If non-nil, the check and its latest result are recorded here
+	registry *HealthRegistry
+
+	// Receives requests to check the pod's health right away, see
+	// HealthRegistry.CheckNow
+	triggerCh chan chan checkResponse
+
+	// If non-nil, critical results during the pod's blackout windows are
+	// marked as suppressed
+	blackouts *HealthBlackouts
+
+	// If non-nil, critical results shortly after the pod is launched are
+	// reported as unknown
+	grace *gracePeriod
+
+	// If non-nil, keeps the pod's reported health from flapping
+	hysteresis *hysteresis
+
+	// If non-nil, the pod is only passing while its recent checks meet the
+	// SLA of its manifest
+	sla *slaBudget
+
+	// If non-nil, spreads the checks of the node's pods across their
+	// interval. scheduled is the pod's slot.
+	scheduler *checkScheduler
+	scheduled *scheduledCheck
+
 	logger *logging.Logger
 }
 
@@ -52,6 +122,182 @@ type StatusChecker struct {
 	Node   types.NodeName
 	URI    string
 	Client *http.Client
+
+	// If set, requests to URI are made over this unix socket, which the
+	// pod serves its status endpoint on
+	Socket string
+
+	// If set, the response body is decoded as JSON and the pod is only
+	// healthy if this evaluates to true
+	Expression *expr.Expr
+
+	// If set, the response body must match BodyRegex, and the fields of its
+	// JSON body must have the values in BodyJSON, for the pod to be healthy.
+	// See manifest.StatusStanza
+	BodyRegex *regexp.Regexp
+	BodyJSON  map[string]string
+
+	// The method and headers of requests to URI, and the response codes
+	// that are passing. See manifest.StatusStanza
+	Method         string
+	Headers        map[string]string
+	ExpectedStatus []manifest.StatusCodeRange
+
+	// How long a request to URI may take, HEALTHCHECK_TIMEOUT if zero
+	Timeout time.Duration
+
+	// Set if the manifest's status expression or body regex couldn't be
+	// parsed, in which case the pod is reported as critical
+	expressionErr error
+
+	// The status URIs of the pod's named processes, keyed by
+	// "<launchable>/<process>". The pod is only healthy if every one of
+	// them responds successfully
+	ProcessURIs map[string]string
+
+	// If set, the pod is checked with the gRPC health checking protocol
+	// instead of requesting URI
+	GRPC *GRPCCheck
+
+	// If set, the pod is checked by connecting to its status port instead
+	// of requesting URI
+	TCP *TCPCheck
+
+	// If set, the pod is checked by running a command instead of
+	// requesting URI
+	Exec *ExecCheck
+
+	// If set, each of these addresses is checked instead of the host of
+	// URI, GRPC or TCP, and the results are combined per AddressPolicy. See
+	// manifest.StatusStanza
+	Addresses     []string
+	AddressPolicy string
+
+	// The checkers of the pod's named checks, see
+	// manifest.StatusStanza.Checks
+	Checks map[string]*StatusChecker
+
+	// For named checks, manifest.StatusRoleReadiness or
+	// manifest.StatusRoleLiveness if the check only decides one of them
+	Role string
+
+	// How often the pod is checked, HEALTHCHECK_INTERVAL if zero, and how
+	// long its results are valid for, until the health monitor's session
+	// expires if zero
+	Interval time.Duration
+	TTL      time.Duration
+
+	// How the pod's results are smoothed before they're reported, see
+	// hysteresis, gracePeriod and slaBudget. Only published with the
+	// check's configuration, the pod's PodWatch applies them
+	FailureThreshold int
+	SuccessThreshold int
+	GracePeriod      time.Duration
+	SLA              *manifest.SLAStanza
+}
+
+// checkDefaults are the interval and TTL of checks of pods whose manifests
+// don't set their own
+type checkDefaults struct {
+	Interval time.Duration
+	TTL      time.Duration
+}
+
+// interval returns how often the pod is checked
+func (sc *StatusChecker) interval() time.Duration {
+	if sc.Interval > 0 {
+		return sc.Interval
+	}
+	return HEALTHCHECK_INTERVAL
+}
+
+// timeout returns how long a status request may take
+func (sc *StatusChecker) timeout() time.Duration {
+	if sc.Timeout > 0 {
+		return sc.Timeout
+	}
+	return time.Duration(*HEALTHCHECK_TIMEOUT) * time.Second
+}
+
+// method returns the HTTP method of status requests
+func (sc *StatusChecker) method() string {
+	if sc.Method != "" {
+		return sc.Method
+	}
+	if sc.checksBody() {
+		// the expression and body assertions need the response body
+		return "GET"
+	}
+	return "HEAD"
+}
+
+// Config returns the configuration of the check, which is published along
+// with its results
+func (sc *StatusChecker) Config() *health.CheckConfig {
+	config := &health.CheckConfig{
+		URI:      sc.URI,
+		Interval: sc.interval(),
+		Timeout:  sc.timeout(),
+		TTL:      sc.TTL,
+	}
+	if sc.Expression != nil {
+		config.Expression = sc.Expression.String()
+	}
+	if sc.BodyRegex != nil {
+		config.BodyRegex = sc.BodyRegex.String()
+	}
+	config.BodyJSON = sc.BodyJSON
+	config.Role = sc.Role
+	if sc.URI != "" {
+		config.Socket = sc.Socket
+		config.Method = sc.Method
+		config.Headers = sc.Headers
+		var expected []string
+		for _, codes := range sc.ExpectedStatus {
+			expected = append(expected, codes.String())
+		}
+		config.ExpectedStatus = strings.Join(expected, ",")
+	}
+	if sc.GRPC != nil {
+		config.URI = "grpc://" + sc.GRPC.Target
+		config.GRPCService = sc.GRPC.Service
+	}
+	if sc.TCP != nil {
+		config.URI = "tcp://" + sc.TCP.Target
+	}
+	if sc.Exec != nil {
+		config.Exec = sc.Exec.Command
+	}
+	if len(sc.Addresses) > 0 {
+		config.Addresses = sc.Addresses
+		config.AddressPolicy = sc.AddressPolicy
+	}
+	if len(sc.ProcessURIs) > 0 {
+		config.Processes = sc.ProcessURIs
+	}
+	for name, check := range sc.Checks {
+		if config.Checks == nil {
+			config.Checks = make(map[string]*health.CheckConfig)
+		}
+		config.Checks[name] = check.Config()
+	}
+	if sc.FailureThreshold > 1 || sc.SuccessThreshold > 1 {
+		config.FailureThreshold = sc.FailureThreshold
+		config.SuccessThreshold = sc.SuccessThreshold
+	}
+	config.GracePeriod = sc.GracePeriod
+	if sc.SLA != nil {
+		// Validation has already rejected bad durations
+		warning, critical, _ := sc.SLA.GetP95Latencies()
+		config.SLA = &health.SLAConfig{
+			Window:              sc.SLA.Window,
+			WarningSuccessRate:  sc.SLA.WarningSuccessRate,
+			CriticalSuccessRate: sc.SLA.CriticalSuccessRate,
+			WarningP95Latency:   warning,
+			CriticalP95Latency:  critical,
+		}
+	}
+	return config
 }
 
 // MonitorPodHealth is meant to be a long running go routine.
@@ -59,15 +305,38 @@ type StatusChecker struct {
 // services should be running on the host. MonitorPodHealth
 // runs a CheckHealth routine to monitor the health of each
 // service and kills routines for services that should no
-// longer be running.
-func MonitorPodHealth(config *preparer.PreparerConfig, logger *logging.Logger, shutdownCh chan struct{}) {
+// longer be running. If registry is non-nil, the monitored pods are recorded
+// in it.
+func MonitorPodHealth(ctx context.Context, config *preparer.PreparerConfig, logger *logging.Logger, registry *HealthRegistry) {
 	client, err := config.GetConsulClient()
 	if err != nil {
 		// A bad config should have already produced a nice, user-friendly error message.
 		logger.WithError(err).Fatalln("error creating health monitor KV client")
 	}
+	writer, err := consul.HealthWriterNamed(config.HealthWriter)
+	if err != nil {
+		logger.WithError(err).Fatalln("invalid health_writer")
+	}
 	store := consul.NewConsulStore(client)
-	healthManager := store.NewHealthManager(config.NodeName, *logger)
+	var healthManager consul.HealthManager
+	if *HEALTH_BATCH_INTERVAL > 0 {
+		batch := newHealthBatch(client.KV(), time.Duration(*HEALTH_BATCH_INTERVAL)*time.Millisecond, *logger)
+		batchQuitCh := make(chan struct{})
+		batchDone := make(chan struct{})
+		go func() {
+			defer close(batchDone)
+			batch.Run(batchQuitCh)
+		}()
+		// Stop batching only once the health manager has shut down, so
+		// that the final results of pods are written
+		defer func() {
+			close(batchQuitCh)
+			<-batchDone
+		}()
+		healthManager = store.NewBatchedHealthManager(config.NodeName, writer, batch, *logger)
+	} else {
+		healthManager = store.NewHealthManager(config.NodeName, writer, *logger)
+	}
 
 	node := config.NodeName
 	pods := []PodWatch{}
@@ -90,26 +359,78 @@ func MonitorPodHealth(config *preparer.PreparerConfig, logger *logging.Logger, s
 		logger.WithError(err).Fatalln("failed to get http client for this preparer")
 	}
 
+	tlsConfig, err := netutil.GetTLSConfig(config.CertFile, config.KeyFile, config.CAFile)
+	if err != nil {
+		logger.WithError(err).Fatalln("failed to get TLS config for this preparer")
+	}
+
 	insecureClient, err := config.GetInsecureClient(time.Duration(*HEALTHCHECK_TIMEOUT) * time.Second)
 	if err != nil {
 		logger.WithError(err).Fatalln("failed to get http client for this preparer")
 	}
 
+	var nodeHealth *NodeHealth
+	if config.NodeHealthPort != 0 || config.PublishNodeHealth {
+		nodeHealth = NewNodeHealth(node)
+		nodeHealth.SetLogURL(config.NodeStatusLogURL)
+	}
+	if config.NodeHealthPort != 0 {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", config.NodeHealthPort))
+		if err != nil {
+			logger.WithError(err).Fatalln("could not listen for node health requests")
+		}
+		defer listener.Close()
+
+		mux := http.NewServeMux()
+		mux.Handle("/_node_health", nodeHealth)
+		mux.HandleFunc("/", nodeHealth.ServeStatusPage)
+		go func() {
+			err := http.Serve(listener, mux)
+			logger.WithError(err).Warnln("Node health server exited")
+		}()
+		logger.WithField("port", config.NodeHealthPort).Infoln("Serving node health")
+	}
+
+	if config.PublishNodeHealth {
+		nodeHealthStore := nodehealthstatus.NewConsul(statusstore.NewConsul(client), statusstore.NodeHealthStatusNamespace)
+		go nodeHealth.PublishStatus(nodeHealthStore, watchQuitCh, logger)
+	}
+
+	blackouts := NewHealthBlackouts(store, logger)
+	go blackouts.Run(watchQuitCh)
+
+	var srvSync *SRVSync
+	if config.SRVPublisher != nil {
+		publisher, err := config.SRVPublisher.Publisher(client)
+		if err != nil {
+			logger.WithError(err).Fatalln("could not set up SRV record publisher")
+		}
+		srvSync = NewSRVSync(publisher, logger)
+	}
+
+	defaults := checkDefaults{
+		Interval: config.HealthCheckInterval,
+		TTL:      config.HealthCheckTTL,
+	}
+	scheduler := newCheckScheduler()
+
 	for {
 		select {
 		case results := <-watchPodCh:
 			// check if pods have been added or removed
 			// starts monitor routine for new pods
 			// kills monitor routine for removed pods
-			pods = updatePods(healthManager, secureClient, insecureClient, pods, results, node, logger)
+			pods = updatePods(healthManager, secureClient, insecureClient, tlsConfig, pods, results, node, config.PodRoot, defaults, nodeHealth, srvSync, registry, blackouts, scheduler, logger)
 		case err := <-watchErrCh:
 			logger.WithError(err).Errorln("there was an error reading reality manifests for health monitor")
-		case <-shutdownCh:
-			for _, pod := range pods {
-				pod.shutdownCh <- true
-			}
+		case <-ctx.Done():
 			close(watchQuitCh)
-			healthManager.Close()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(*HEALTH_SHUTDOWN_TIMEOUT)*time.Second)
+			defer cancel()
+			if err := stopPodWatches(shutdownCtx, pods); err != nil {
+				logger.WithError(err).Warnln("Gave up waiting for pods to stop being checked")
+			}
+			_ = healthManager.Shutdown(shutdownCtx)
 			return
 		}
 	}
@@ -121,15 +442,24 @@ func updatePods(
 	healthManager consul.HealthManager,
 	secureClient *http.Client,
 	insecureClient *http.Client,
+	tlsConfig *tls.Config,
 	current []PodWatch,
 	reality []consul.ManifestResult,
 	node types.NodeName,
+	podRoot string,
+	defaults checkDefaults,
+	nodeHealth *NodeHealth,
+	srvSync *SRVSync,
+	registry *HealthRegistry,
+	blackouts *HealthBlackouts,
+	scheduler *checkScheduler,
 	logger *logging.Logger,
 ) []PodWatch {
 	newCurrent := []PodWatch{}
 	// for pod in current if pod not in reality: kill
 	for _, pod := range current {
 		inReality := false
+		var sha string
 		for _, man := range reality {
 			if man.PodUniqueKey != "" {
 				// We don't health check uuid pods
@@ -139,8 +469,12 @@ func updatePods(
 				man.Manifest.GetStatusHTTP() == pod.manifest.GetStatusHTTP() &&
 				man.Manifest.GetStatusLocalhostOnly() == pod.manifest.GetStatusLocalhostOnly() &&
 				man.Manifest.GetStatusPath() == pod.manifest.GetStatusPath() &&
-				man.Manifest.GetStatusPort() == pod.manifest.GetStatusPort() {
+				man.Manifest.GetStatusPort() == pod.manifest.GetStatusPort() &&
+				reflect.DeepEqual(man.Manifest.GetStatusStanza(), pod.manifest.GetStatusStanza()) &&
+				reflect.DeepEqual(processStatusEndpoints(man.Manifest), processStatusEndpoints(pod.manifest)) &&
+				reflect.DeepEqual(man.Manifest.GetPorts(), pod.manifest.GetPorts()) {
 				inReality = true
+				sha, _ = man.Manifest.SHA()
 				break
 			}
 		}
@@ -150,6 +484,7 @@ func updatePods(
 		if inReality == false {
 			pod.shutdownCh <- true
 		} else {
+			pod.grace.relaunched(sha)
 			newCurrent = append(newCurrent, pod)
 		}
 	}
@@ -169,38 +504,80 @@ func updatePods(
 			}
 		}
 
-		var client *http.Client
-		var statusHost types.NodeName
-		if man.Manifest.GetStatusLocalhostOnly() {
-			statusHost = "localhost"
-			client = insecureClient
-		} else {
-			statusHost = node
-			client = secureClient
-		}
-
 		// if a manifest is in reality but not current a podwatch is created
 		// with that manifest and added to newCurrent
 		if missing {
-			sc := StatusChecker{
-				ID:     man.Manifest.ID(),
-				Node:   node,
-				Client: client,
+			checks := checkClients{
+				secure:    secureClient,
+				insecure:  insecureClient,
+				tlsConfig: tlsConfig,
+				podRoot:   podRoot,
 			}
-			if man.Manifest.GetStatusPort() == 0 {
-				sc.URI = ""
-			} else if man.Manifest.GetStatusHTTP() {
-				sc.URI = fmt.Sprintf("http://%s:%d%s", statusHost, man.Manifest.GetStatusPort(), man.Manifest.GetStatusPath())
-			} else {
-				sc.URI = fmt.Sprintf("https://%s:%d%s", statusHost, man.Manifest.GetStatusPort(), man.Manifest.GetStatusPath())
+			status := man.Manifest.GetStatusStanza()
+			status.LocalhostOnly = man.Manifest.GetStatusLocalhostOnly()
+			status.HTTP = man.Manifest.GetStatusHTTP()
+			status.Port = man.Manifest.GetStatusPort()
+			sc := checks.newStatusChecker(man.Manifest, node, status, logger)
+			sc.Interval = defaults.Interval
+			sc.TTL = defaults.TTL
+			// Validation has already rejected bad durations
+			if interval, _ := man.Manifest.GetStatusStanza().GetInterval(); interval > 0 {
+				sc.Interval = interval
 			}
+			if ttl, _ := man.Manifest.GetStatusStanza().GetTTL(); ttl > 0 {
+				sc.TTL = ttl
+			}
+			for process, endpoint := range processStatusEndpoints(man.Manifest) {
+				if sc.ProcessURIs == nil {
+					sc.ProcessURIs = make(map[string]string)
+				}
+				sc.ProcessURIs[process] = fmt.Sprintf("%s://%s%s", statusScheme(status), statusHost(status, node), endpoint)
+			}
+			for name, check := range status.Checks {
+				check.Port = check.GetCheckPort(status.Port)
+				if sc.Checks == nil {
+					sc.Checks = make(map[string]*StatusChecker)
+				}
+				named := checks.newStatusChecker(man.Manifest, node, check, logger)
+				sc.Checks[name] = &named
+			}
+			// Validation has already rejected bad durations
+			sc.GracePeriod, _ = status.GetGracePeriod()
+			sc.FailureThreshold = status.GetFailureThreshold()
+			sc.SuccessThreshold = status.GetSuccessThreshold()
+			sc.SLA = status.SLA
 			newPod := PodWatch{
 				manifest:      man.Manifest,
 				updater:       healthManager.NewUpdater(man.Manifest.ID(), string(man.Manifest.ID())),
 				statusChecker: sc,
 				shutdownCh:    make(chan bool, 1),
+				finalCh:       make(chan struct{}),
+				stoppedCh:     make(chan struct{}),
+				nodeHealth:    nodeHealth,
+				srvSync:       srvSync,
+				registry:      registry,
+				triggerCh:     make(chan chan checkResponse),
+				blackouts:     blackouts,
+				scheduler:     scheduler,
+				scheduled:     scheduler.add(sc.interval()),
 				logger:        logger,
 			}
+			if sc.GracePeriod > 0 {
+				sha, _ := man.Manifest.SHA()
+				newPod.grace = newGracePeriod(sc.GracePeriod, sha)
+			}
+			if sc.FailureThreshold > 1 || sc.SuccessThreshold > 1 {
+				newPod.hysteresis = newHysteresis(sc.FailureThreshold, sc.SuccessThreshold)
+			}
+			if sc.SLA != nil {
+				newPod.sla = newSLABudget(*sc.SLA)
+			}
+			if registry != nil {
+				registry.add(sc, newPod.triggerCh)
+			}
+			if nodeHealth != nil {
+				nodeHealth.watch(man.Manifest)
+			}
 
 			// Each health monitor will have its own statusChecker
 			go newPod.MonitorHealth()
@@ -210,38 +587,305 @@ func updatePods(
 	return newCurrent
 }
 
+// stopPodWatches has each pod publish a final "shutting down" result and stop
+// being checked, and waits for them to do so until ctx is done
+func stopPodWatches(ctx context.Context, pods []PodWatch) error {
+	for _, pod := range pods {
+		close(pod.finalCh)
+	}
+	for _, pod := range pods {
+		select {
+		case <-pod.stoppedCh:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// checkClients are what status checkers are built with
+type checkClients struct {
+	// Used for checks of the node's name and of localhost respectively
+	secure   *http.Client
+	insecure *http.Client
+
+	tlsConfig *tls.Config
+	podRoot   string
+}
+
+// newStatusChecker builds the checker of a single status check of a pod,
+// which is either the pod's status stanza or one of its named checks. The
+// stanza's port must already be resolved.
+func (c checkClients) newStatusChecker(man manifest.Manifest, node types.NodeName, status manifest.StatusStanza, logger *logging.Logger) StatusChecker {
+	host := statusHost(status, node)
+	sc := StatusChecker{
+		ID:     man.ID(),
+		Node:   node,
+		Client: c.secure,
+		Role:   status.Role,
+	}
+	if status.LocalhostOnly {
+		sc.Client = c.insecure
+	}
+
+	if status.GetType() == manifest.StatusTypeExec {
+		sc.Exec = newExecCheck(man, status.Exec, c.podRoot)
+	} else if status.GetType() == manifest.StatusTypeHTTP && status.Socket != "" {
+		sc.Socket = filepath.Join(podHome(man, c.podRoot), status.Socket)
+		sc.URI = "http://localhost" + status.GetPath()
+	} else if status.Port == 0 {
+		sc.URI = ""
+	} else if status.GetType() == manifest.StatusTypeGRPC {
+		sc.GRPC = newGRPCCheck(status, host, status.Port, c.tlsConfig)
+	} else if status.GetType() == manifest.StatusTypeTCP {
+		sc.TCP = &TCPCheck{Target: fmt.Sprintf("%s:%d", host, status.Port)}
+	} else {
+		sc.URI = fmt.Sprintf("%s://%s:%d%s", statusScheme(status), host, status.Port, status.GetPath())
+	}
+	if len(status.Addresses) > 0 && status.Port != 0 {
+		sc.Addresses = status.Addresses
+		sc.AddressPolicy = status.GetAddressPolicy()
+	}
+	if status.Expression != "" && sc.URI != "" {
+		sc.Expression, sc.expressionErr = expr.Parse(status.Expression)
+		if sc.expressionErr != nil {
+			logger.WithErrorAndFields(sc.expressionErr, logrus.Fields{
+				"pod": man.ID(),
+			}).Errorln("Invalid status expression, pod will be reported as critical")
+		}
+	}
+	if status.BodyRegex != "" && sc.URI != "" && sc.expressionErr == nil {
+		sc.BodyRegex, sc.expressionErr = regexp.Compile(status.BodyRegex)
+		if sc.expressionErr != nil {
+			logger.WithErrorAndFields(sc.expressionErr, logrus.Fields{
+				"pod": man.ID(),
+			}).Errorln("Invalid status body regex, pod will be reported as critical")
+		}
+	}
+	if len(status.BodyJSON) > 0 && sc.URI != "" {
+		sc.BodyJSON = status.BodyJSON
+	}
+	if sc.URI != "" {
+		sc.Method = status.Method
+		sc.Headers = status.Headers
+		// both were validated with the manifest, so errors are ignored
+		sc.ExpectedStatus, _ = status.GetExpectedStatus()
+		sc.Timeout, _ = status.GetTimeout()
+	}
+	return sc
+}
+
+// statusHost returns the host that a status check is made to
+func statusHost(status manifest.StatusStanza, node types.NodeName) types.NodeName {
+	if status.LocalhostOnly {
+		return "localhost"
+	}
+	return node
+}
+
+func statusScheme(status manifest.StatusStanza) string {
+	if status.HTTP {
+		return "http"
+	}
+	return "https"
+}
+
 // Monitor Health is a go routine that runs as long as the
-// service it is monitoring. Every HEALTHCHECK_INTERVAL it
+// service it is monitoring. Every check interval it
 // performs a health check and writes that information to
-// consul
+// consul. Checks requested through the trigger channel are
+// performed straight away.
 func (p *PodWatch) MonitorHealth() {
+	if p.stoppedCh != nil {
+		defer close(p.stoppedCh)
+	}
 	for {
 		select {
-		case <-time.After(HEALTHCHECK_INTERVAL):
+		case <-time.After(p.scheduler.next(p.scheduled, p.statusChecker.interval(), time.Now())):
 			p.checkHealth()
+		case respCh := <-p.triggerCh:
+			res, err := p.checkHealth()
+			respCh <- checkResponse{result: res, err: err}
+		case <-p.finalCh:
+			err := p.updater.PutHealth(resToConsulRes(health.Result{
+				ID:      p.statusChecker.ID,
+				Node:    p.statusChecker.Node,
+				Service: string(p.statusChecker.ID),
+				Status:  health.Unknown,
+				Reason:  health.ReasonShuttingDown,
+				Check:   p.statusChecker.Config(),
+			}))
+			if err != nil {
+				p.logger.WithError(err).Warnln("failed to write final health")
+			}
+			p.stop()
+			return
 		case <-p.shutdownCh:
-			p.updater.Close()
+			p.stop()
 			return
 		}
 	}
 }
 
-func (p *PodWatch) checkHealth() {
+// stop removes the pod from everywhere its health is published
+func (p *PodWatch) stop() {
+	if p.nodeHealth != nil {
+		p.nodeHealth.remove(p.manifest.ID())
+		p.nodeHealth.unwatch(p.manifest)
+	}
+	if p.srvSync != nil {
+		p.srvSync.remove(p.manifest.ID())
+	}
+	if p.registry != nil {
+		p.registry.remove(p.manifest.ID())
+	}
+	p.scheduler.remove(p.scheduled)
+	p.updater.Close()
+}
+
+// checkHealth checks the pod and records the result everywhere it is
+// published. The result is also returned.
+func (p *PodWatch) checkHealth() (health.Result, error) {
+	start := time.Now()
 	health, err := p.statusChecker.Check()
 	if err != nil {
 		p.logger.WithError(err).Warningln("health check failed")
-		return
+		return health, err
+	}
+
+	p.sla.apply(&health, time.Since(start))
+	p.hysteresis.apply(&health)
+	p.grace.apply(&health)
+
+	if p.blackouts != nil {
+		p.blackouts.suppress(&health)
+	}
+
+	if p.nodeHealth != nil {
+		p.nodeHealth.set(health)
+	}
+
+	if p.registry != nil {
+		p.registry.set(health)
+	}
+
+	if p.srvSync != nil {
+		p.srvSync.set(p.manifest.ID(), srv.RecordsForManifest(p.manifest, p.statusChecker.Node), health)
 	}
 
 	if err = p.updater.PutHealth(resToConsulRes(health)); err != nil {
 		p.logger.WithError(err).Warningln("failed to write health")
 	}
+	return health, nil
+}
+
+// processStatusEndpoints returns ":<port><path>" for each named process with
+// a status check, keyed by "<launchable>/<process>"
+func processStatusEndpoints(man manifest.Manifest) map[string]string {
+	endpoints := make(map[string]string)
+	for launchableID, stanza := range man.GetLaunchableStanzas() {
+		for name, process := range stanza.Processes {
+			if process.StatusPort == 0 {
+				continue
+			}
+			endpoints[launchableID.String()+"/"+name] = fmt.Sprintf(":%d%s", process.StatusPort, process.GetStatusPath())
+		}
+	}
+	return endpoints
 }
 
 // Given the result of a status check this method
 // creates a health.Result for that node/service/result
 func (sc *StatusChecker) Check() (health.Result, error) {
-	if sc.URI != "" {
+	res, err := sc.podCheck()
+	if err != nil {
+		return res, err
+	}
+	if res.Status == health.Passing && !sc.processesHealthy() {
+		res.Status = health.Critical
+		res.Reason = health.ReasonProcessUnhealthy
+	}
+	if len(sc.Checks) > 0 {
+		return sc.namedChecks(res)
+	}
+	return res, nil
+}
+
+// namedChecks performs each of the pod's named checks and records their
+// results in res, whose status becomes the least healthy of them and its own.
+// If any of them only decides the pod's readiness or liveness, res's
+// readiness and liveness become the least healthy of the checks that decide
+// each.
+func (sc *StatusChecker) namedChecks(res health.Result) (health.Result, error) {
+	names := make([]string, 0, len(sc.Checks))
+	for name := range sc.Checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := health.ResultList{res}
+	readiness := health.ResultList{res}
+	liveness := health.ResultList{res}
+	hasRoles := false
+	res.Checks = &health.CheckResults{}
+	for _, name := range names {
+		checkRes, err := sc.Checks[name].Check()
+		if err != nil {
+			return health.Result{}, err
+		}
+		results = append(results, checkRes)
+		role := sc.Checks[name].Role
+		if role != manifest.StatusRoleLiveness {
+			readiness = append(readiness, checkRes)
+		}
+		if role != manifest.StatusRoleReadiness {
+			liveness = append(liveness, checkRes)
+		}
+		hasRoles = hasRoles || role != ""
+		res.Checks.Results = append(res.Checks.Results, health.CheckResult{
+			Name:   name,
+			Status: checkRes.Status,
+			Reason: checkRes.Reason,
+			Role:   role,
+		})
+	}
+
+	worst := results.MinValue()
+	res.Status = worst.Status
+	res.Reason = worst.Reason
+	if hasRoles {
+		res.Readiness = readiness.MinValue().Status
+		res.Liveness = liveness.MinValue().Status
+	}
+	return res, nil
+}
+
+// processesHealthy returns whether every named process with a status check
+// responds successfully
+func (sc *StatusChecker) processesHealthy() bool {
+	for _, uri := range sc.ProcessURIs {
+		resp, err := sc.Client.Head(uri)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return false
+		}
+	}
+	return true
+}
+
+func (sc *StatusChecker) podCheck() (health.Result, error) {
+	if len(sc.Addresses) > 0 {
+		return sc.addressesCheck()
+	} else if sc.GRPC != nil {
+		return sc.resultFromGRPCCheck(sc.GRPC.Check())
+	} else if sc.TCP != nil {
+		return sc.resultFromTCPCheck(sc.TCP.Check())
+	} else if sc.Exec != nil {
+		return sc.resultFromExecCheck(sc.Exec.Check())
+	} else if sc.URI != "" {
 		return sc.resultFromCheck(sc.StatusCheck())
 	} else {
 		// "unknown" is probably more accurate, but automated tools can't handle an app that is
@@ -257,6 +901,7 @@ func (sc *StatusChecker) Check() (health.Result, error) {
 			Node:    sc.Node,
 			Service: string(sc.ID),
 			Status:  health.Passing,
+			Check:   sc.Config(),
 		}, nil
 	}
 }
@@ -266,30 +911,205 @@ func (sc *StatusChecker) resultFromCheck(resp *http.Response, err error) (health
 		ID:      sc.ID,
 		Node:    sc.Node,
 		Service: string(sc.ID),
+		Check:   sc.Config(),
 	}
-	if err != nil || resp == nil {
+	switch {
+	case err != nil:
+		res.Status = health.Critical
+		res.Reason = requestErrorReason(err)
+		return res, nil
+	case resp == nil:
 		res.Status = health.Critical
+		res.Reason = health.ReasonRequestError
+		return res, nil
+	case sc.expressionErr != nil:
+		res.Status = health.Critical
+		res.Reason = health.ReasonInvalidCheck
 		return res, nil
 	}
 
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+	defer resp.Body.Close()
+
+	switch {
+	case sc.expectsStatus(resp.StatusCode):
 		res.Status = health.Passing
-	} else {
+	case resp.StatusCode >= 500 && resp.StatusCode < 600:
+		res.Status = health.Critical
+		res.Reason = health.ReasonHTTP5xx
+	default:
 		res.Status = health.Critical
+		res.Reason = health.ReasonHTTPStatus
+	}
+
+	if sc.checksBody() {
+		if res.Status == health.Passing && !sc.bodyMatches(resp) {
+			res.Status = health.Critical
+			res.Reason = health.ReasonBodyMismatch
+		}
 	}
 	return res, err
 }
 
+// expectsStatus returns whether a response code is passing: any 2xx code,
+// unless the manifest lists the expected ones
+func (sc *StatusChecker) expectsStatus(code int) bool {
+	if len(sc.ExpectedStatus) == 0 {
+		return code >= 200 && code < 300
+	}
+	for _, codes := range sc.ExpectedStatus {
+		if codes.Contains(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// checksBody returns whether the pod's health depends on the body of its
+// status response, rather than only its status code
+func (sc *StatusChecker) checksBody() bool {
+	return sc.Expression != nil || sc.BodyRegex != nil || len(sc.BodyJSON) > 0
+}
+
+// bodyMatches returns whether the response satisfies the status expression
+// and body assertions. Bodies that can't be read, or aren't JSON when JSON is
+// expected, don't match.
+func (sc *StatusChecker) bodyMatches(resp *http.Response) bool {
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxStatusBodyBytes))
+	if err != nil {
+		return false
+	}
+	if sc.BodyRegex != nil && !sc.BodyRegex.Match(body) {
+		return false
+	}
+	if sc.Expression == nil && len(sc.BodyJSON) == 0 {
+		return true
+	}
+
+	var decoded interface{}
+	if err = json.Unmarshal(body, &decoded); err != nil {
+		return false
+	}
+	if sc.Expression != nil && !sc.evalExpression(decoded, resp.StatusCode) {
+		return false
+	}
+	for field, expected := range sc.BodyJSON {
+		value, ok := jsonField(decoded, field)
+		if !ok || !jsonValueEquals(value, expected) {
+			return false
+		}
+	}
+	return true
+}
+
+// requestErrorReason categorizes an error returned by the HTTP client
+func requestErrorReason(err error) health.Reason {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return health.ReasonTimeout
+	}
+
+	switch err.(type) {
+	case x509.UnknownAuthorityError, x509.HostnameError, x509.CertificateInvalidError, tls.RecordHeaderError:
+		return health.ReasonTLSError
+	}
+	// the TLS and syscall errors that remain aren't exported types
+	// that can be matched on
+	message := err.Error()
+	switch {
+	case strings.Contains(message, "connection refused"):
+		return health.ReasonConnectionRefused
+	case strings.HasPrefix(message, "tls:") || strings.Contains(message, "x509:"):
+		return health.ReasonTLSError
+	}
+	return health.ReasonRequestError
+}
+
+// evalExpression returns whether the status expression holds for the decoded
+// JSON body of a response. Expressions that can't be evaluated don't hold.
+func (sc *StatusChecker) evalExpression(body interface{}, statusCode int) bool {
+	ok, err := sc.Expression.Eval(map[string]interface{}{
+		"json":        body,
+		"status_code": statusCode,
+	})
+	return err == nil && ok
+}
+
+// jsonField looks up a dot-separated field of a decoded JSON object
+func jsonField(body interface{}, field string) (interface{}, bool) {
+	value := body
+	for _, name := range strings.Split(field, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		value, ok = object[name]
+		if !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// jsonValueEquals returns whether a decoded JSON value is the one that the
+// manifest expects, which is written as a string whatever its JSON type, e.g.
+// "true" or "3"
+func jsonValueEquals(value interface{}, expected string) bool {
+	switch v := value.(type) {
+	case string:
+		return v == expected
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64) == expected
+	case nil:
+		return expected == "null"
+	case map[string]interface{}, []interface{}:
+		return false
+	default:
+		return fmt.Sprint(v) == expected
+	}
+}
+
 // Go version of http status check
 func (sc *StatusChecker) StatusCheck() (*http.Response, error) {
-	return sc.Client.Head(sc.URI)
+	req, err := http.NewRequest(sc.method(), sc.URI, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range sc.Headers {
+		if http.CanonicalHeaderKey(name) == "Host" {
+			// net/http ignores the header in favor of req.Host
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+
+	client := sc.Client
+	if sc.Socket != "" {
+		// the pod's processes are still checked with sc.Client
+		client = unixSocketClient(sc.Socket)
+	}
+	if sc.Timeout > 0 {
+		withTimeout := *client
+		withTimeout.Timeout = sc.Timeout
+		client = &withTimeout
+	}
+	return client.Do(req)
 }
 
 func resToConsulRes(res health.Result) consul.WatchResult {
 	return consul.WatchResult{
-		Service: res.Service,
-		Node:    res.Node,
-		Id:      res.ID,
-		Status:  string(res.Status),
+		Service:    res.Service,
+		Node:       res.Node,
+		Id:         res.ID,
+		Status:     string(res.Status),
+		Check:      res.Check,
+		Reason:     res.Reason,
+		Addresses:  res.Addresses,
+		Checks:     res.Checks,
+		Suppressed: res.Suppressed,
+		Readiness:  string(res.Readiness),
+		Liveness:   string(res.Liveness),
 	}
 }
@@ -0,0 +1,200 @@
+package watch
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/util/param"
+)
+
+// How often the health results of all the node's pods are written to consul
+// together, in milliseconds. 0 writes each result as soon as it changes.
+var HEALTH_BATCH_INTERVAL = param.Int64("health_batch_interval_ms", 1000)
+
+// consul rejects transactions with more operations than this
+const maxHealthBatchOps = 64
+
+// healthTxner is the part of the consul KV client that healthBatch writes
+// through
+type healthTxner interface {
+	Txn(txn api.KVTxnOps, q *api.QueryOptions) (bool, *api.KVTxnResponse, *api.QueryMeta, error)
+}
+
+// healthBatch coalesces the health writes of every pod on a node. The health
+// manager's updaters write through it as if it were a consul KV client, and
+// each write blocks until the next flush, which commits all the pending
+// writes in as few transactions as possible. A write that consul rejects,
+// e.g. because the session it was acquired with is gone, fails on its own
+// without failing the rest of its batch.
+type healthBatch struct {
+	txner    healthTxner
+	interval time.Duration
+	logger   logging.Logger
+
+	mu      sync.Mutex
+	pending []*batchedWrite
+	stopped bool
+}
+
+var _ consul.ConsulKVClient = &healthBatch{}
+
+type batchedWrite struct {
+	op *api.KVTxnOp
+	// receives whether consul accepted the write, or why it could not be
+	// made at all
+	done chan batchedWriteResult
+}
+
+type batchedWriteResult struct {
+	ok  bool
+	err error
+}
+
+func newHealthBatch(txner healthTxner, interval time.Duration, logger logging.Logger) *healthBatch {
+	return &healthBatch{
+		txner:    txner,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Run flushes the pending writes every interval until quit is closed, then
+// flushes them one last time. Writes made after that are committed right
+// away.
+func (b *healthBatch) Run(quit <-chan struct{}) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.flush()
+		case <-quit:
+			b.mu.Lock()
+			b.stopped = true
+			b.mu.Unlock()
+			b.flush()
+			return
+		}
+	}
+}
+
+func (b *healthBatch) Acquire(p *api.KVPair, q *api.WriteOptions) (bool, *api.WriteMeta, error) {
+	ok, err := b.write(&api.KVTxnOp{
+		Verb:    api.KVLock,
+		Key:     p.Key,
+		Value:   p.Value,
+		Flags:   p.Flags,
+		Session: p.Session,
+	})
+	return ok, &api.WriteMeta{}, err
+}
+
+func (b *healthBatch) Put(p *api.KVPair, q *api.WriteOptions) (*api.WriteMeta, error) {
+	ok, err := b.write(&api.KVTxnOp{
+		Verb:  string(api.KVSet),
+		Key:   p.Key,
+		Value: p.Value,
+		Flags: p.Flags,
+	})
+	if err == nil && !ok {
+		err = fmt.Errorf("put of %s was rejected", p.Key)
+	}
+	return &api.WriteMeta{}, err
+}
+
+func (b *healthBatch) Delete(key string, w *api.WriteOptions) (*api.WriteMeta, error) {
+	ok, err := b.write(&api.KVTxnOp{
+		Verb: api.KVDelete,
+		Key:  key,
+	})
+	if err == nil && !ok {
+		err = fmt.Errorf("delete of %s was rejected", key)
+	}
+	return &api.WriteMeta{}, err
+}
+
+// write queues op for the next flush and waits for it
+func (b *healthBatch) write(op *api.KVTxnOp) (bool, error) {
+	w := &batchedWrite{op: op, done: make(chan batchedWriteResult, 1)}
+	b.mu.Lock()
+	if b.stopped {
+		b.mu.Unlock()
+		b.commit([]*batchedWrite{w})
+	} else {
+		b.pending = append(b.pending, w)
+		b.mu.Unlock()
+	}
+	res := <-w.done
+	return res.ok, res.err
+}
+
+func (b *healthBatch) flush() {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+
+	for len(pending) > 0 {
+		n := len(pending)
+		if n > maxHealthBatchOps {
+			n = maxHealthBatchOps
+		}
+		b.commit(pending[:n])
+		pending = pending[n:]
+	}
+}
+
+// commit writes a batch in one transaction. consul rolls back the whole
+// transaction if any of its operations fail, so the failed ones are answered
+// and the rest are committed again without them.
+func (b *healthBatch) commit(writes []*batchedWrite) {
+	for len(writes) > 0 {
+		ops := make(api.KVTxnOps, 0, len(writes))
+		for _, w := range writes {
+			ops = append(ops, w.op)
+		}
+
+		ok, resp, _, err := b.txner.Txn(ops, nil)
+		if err != nil {
+			b.logger.WithError(err).Errorf("could not write a batch of %d health updates", len(writes))
+			for _, w := range writes {
+				w.done <- batchedWriteResult{err: err}
+			}
+			return
+		}
+		if ok {
+			for _, w := range writes {
+				w.done <- batchedWriteResult{ok: true}
+			}
+			return
+		}
+
+		failed := make(map[int]bool)
+		if resp != nil {
+			for _, txnErr := range resp.Errors {
+				failed[txnErr.OpIndex] = true
+			}
+		}
+		if len(failed) == 0 {
+			// nothing to retry without
+			for _, w := range writes {
+				w.done <- batchedWriteResult{ok: false}
+			}
+			return
+		}
+		var retry []*batchedWrite
+		for i, w := range writes {
+			if failed[i] {
+				w.done <- batchedWriteResult{ok: false}
+			} else {
+				retry = append(retry, w)
+			}
+		}
+		writes = retry
+	}
+}
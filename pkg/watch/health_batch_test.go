@@ -0,0 +1,124 @@
+package watch
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul/consulutil/consulutiltest"
+)
+
+// countingTxner counts the transactions written through it
+type countingTxner struct {
+	healthTxner
+
+	mu    sync.Mutex
+	count int
+}
+
+func (c *countingTxner) Txn(txn api.KVTxnOps, q *api.QueryOptions) (bool, *api.KVTxnResponse, *api.QueryMeta, error) {
+	c.mu.Lock()
+	c.count++
+	c.mu.Unlock()
+	return c.healthTxner.Txn(txn, q)
+}
+
+func (c *countingTxner) transactions() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.count
+}
+
+func TestHealthBatchCoalescesWrites(t *testing.T) {
+	fake := consulutiltest.NewConsul()
+	session, _, err := fake.Session().CreateNoChecks(&api.SessionEntry{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txner := &countingTxner{healthTxner: fake.KV()}
+	batch := newHealthBatch(txner, 50*time.Millisecond, logging.TestLogger())
+
+	var wg sync.WaitGroup
+	results := make([]bool, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			pair := &api.KVPair{
+				Key:     fmt.Sprintf("health/pod%d/node1", i),
+				Value:   []byte("passing"),
+				Session: session,
+			}
+			// the last write uses a session that doesn't exist
+			if i == len(results)-1 {
+				pair.Session = "bogus"
+			}
+			results[i], _, _ = batch.Acquire(pair, nil)
+		}(i)
+	}
+	// let every write queue up before the first flush
+	for queued := 0; queued < len(results); {
+		time.Sleep(time.Millisecond)
+		batch.mu.Lock()
+		queued = len(batch.pending)
+		batch.mu.Unlock()
+	}
+	batch.flush()
+	wg.Wait()
+
+	for i, ok := range results[:len(results)-1] {
+		if !ok {
+			t.Errorf("Expected write %d to succeed", i)
+		}
+	}
+	if results[len(results)-1] {
+		t.Errorf("Expected the write with a bogus session to fail")
+	}
+	// one transaction that was rolled back, and one without the failed write
+	if count := txner.transactions(); count != 2 {
+		t.Errorf("Expected the writes to be made in 2 transactions, got %d", count)
+	}
+
+	pairs, _, err := fake.KV().List("health/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pairs) != len(results)-1 {
+		t.Errorf("Expected %d health results in consul, got %d", len(results)-1, len(pairs))
+	}
+}
+
+func TestHealthBatchWritesDirectlyOnceStopped(t *testing.T) {
+	fake := consulutiltest.NewConsul()
+	batch := newHealthBatch(fake.KV(), time.Hour, logging.TestLogger())
+
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		batch.Run(quit)
+	}()
+
+	_, err := fake.KV().Put(&api.KVPair{Key: "health/pod/node1", Value: []byte("passing")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(quit)
+	<-done
+
+	_, err = batch.Delete("health/pod/node1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, _, err := fake.KV().Get("health/pod/node1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pair != nil {
+		t.Errorf("Expected the health result to be deleted")
+	}
+}
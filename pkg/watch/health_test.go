@@ -3,14 +3,24 @@ package watch
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"runtime"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	. "github.com/anthonybishopric/gotcha"
 	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/health/expr"
+	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/store/consul"
@@ -36,6 +46,8 @@ func (m *MockHealthManager) PutHealth(health consul.WatchResult) error {
 
 func (*MockHealthManager) Close() {}
 
+func (*MockHealthManager) Shutdown(ctx context.Context) error { return nil }
+
 // UpdatePods looks at the pods currently being monitored and
 // compares that to what the reality store indicates should be
 // running. UpdatePods then shuts down the monitors for dead
@@ -61,7 +73,7 @@ func TestUpdatePods(t *testing.T) {
 	// ids for pods: 1, 2, test
 	// 0, 3 should have values in their shutdownCh
 	logger := logging.NewLogger(logrus.Fields{})
-	pods := updatePods(&MockHealthManager{}, nil, nil, current, reality, "", &logger)
+	pods := updatePods(&MockHealthManager{}, nil, nil, nil, current, reality, "", "", checkDefaults{}, nil, nil, nil, nil, nil, &logger)
 	Assert(t).AreEqual(true, <-current[0].shutdownCh, "this PodWatch should have been shutdown")
 	Assert(t).AreEqual(true, <-current[3].shutdownCh, "this PodWatch should have been shutdown")
 
@@ -75,7 +87,7 @@ func TestUpdateStatus(t *testing.T) {
 	healthManager := &MockHealthManager{}
 
 	reality := []consul.ManifestResult{newManifestResult("foo"), newManifestResult("bar")}
-	pods1 := updatePods(healthManager, nil, nil, []PodWatch{}, reality, "", &logger)
+	pods1 := updatePods(healthManager, nil, nil, nil, []PodWatch{}, reality, "", "", checkDefaults{}, nil, nil, nil, nil, nil, &logger)
 	Assert(t).AreEqual(2, len(pods1), "new pods were not added")
 	Assert(t).AreEqual(2, healthManager.UpdaterCreated, "new pods did not create an updaters")
 
@@ -84,7 +96,7 @@ func TestUpdateStatus(t *testing.T) {
 	builder := reality[0].Manifest.GetBuilder()
 	builder.SetStatusPort(2)
 	reality[0].Manifest = builder.GetManifest()
-	pods2 := updatePods(healthManager, nil, nil, pods1, reality, "", &logger)
+	pods2 := updatePods(healthManager, nil, nil, nil, pods1, reality, "", "", checkDefaults{}, nil, nil, nil, nil, nil, &logger)
 	Assert(t).AreEqual(2, len(pods2), "updatePods() changed the number of pods")
 	Assert(t).AreEqual(1, healthManager.UpdaterCreated, "one pod should have been refreshed")
 }
@@ -94,7 +106,7 @@ func TestUpdatePath(t *testing.T) {
 	healthManager := &MockHealthManager{}
 
 	reality := []consul.ManifestResult{newManifestResult("foo"), newManifestResult("bar")}
-	pods1 := updatePods(healthManager, nil, nil, []PodWatch{}, reality, "bobnode", &logger)
+	pods1 := updatePods(healthManager, nil, nil, nil, []PodWatch{}, reality, "bobnode", "", checkDefaults{}, nil, nil, nil, nil, nil, &logger)
 	Assert(t).AreEqual(2, len(pods1), "new pods were not added")
 	Assert(t).AreEqual(2, healthManager.UpdaterCreated, "new pods did not create an updaters")
 
@@ -103,13 +115,228 @@ func TestUpdatePath(t *testing.T) {
 	builder := reality[0].Manifest.GetBuilder()
 	builder.SetStatusPath("/_foobar")
 	reality[0].Manifest = builder.GetManifest()
-	pods2 := updatePods(healthManager, nil, nil, pods1, reality, "bobnode", &logger)
+	pods2 := updatePods(healthManager, nil, nil, nil, pods1, reality, "bobnode", "", checkDefaults{}, nil, nil, nil, nil, nil, &logger)
 	Assert(t).AreEqual(2, len(pods2), "updatePods() changed the number of pods")
 	Assert(t).AreEqual(1, healthManager.UpdaterCreated, "one pod should have been refreshed")
 	Assert(t).AreEqual("https://bobnode:1/_status", pods2[0].statusChecker.URI, "pod should be checking correct path")
 	Assert(t).AreEqual("https://bobnode:1/_foobar", pods2[1].statusChecker.URI, "pod should be checking correct path")
 }
 
+func TestUpdatePodsCheckIntervals(t *testing.T) {
+	logger := logging.TestLogger()
+	healthManager := &MockHealthManager{}
+
+	overridden, err := manifest.FromBytes([]byte(`
+id: foo
+status_port: 1
+status:
+  interval: 30s
+  ttl: 2m
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reality := []consul.ManifestResult{{Manifest: overridden}, newManifestResult("bar")}
+	defaults := checkDefaults{Interval: 5 * time.Second, TTL: 20 * time.Second}
+	pods := updatePods(healthManager, nil, nil, nil, []PodWatch{}, reality, "bobnode", "", defaults, nil, nil, nil, nil, nil, &logger)
+	defer func() {
+		for _, pod := range pods {
+			pod.shutdownCh <- true
+		}
+	}()
+	Assert(t).AreEqual(2, len(pods), "new pods were not added")
+
+	config := pods[0].statusChecker.Config()
+	Assert(t).AreEqual(30*time.Second, config.Interval, "manifest interval should override the default")
+	Assert(t).AreEqual(2*time.Minute, config.TTL, "manifest ttl should override the default")
+
+	config = pods[1].statusChecker.Config()
+	Assert(t).AreEqual(5*time.Second, config.Interval, "default interval should be used")
+	Assert(t).AreEqual(20*time.Second, config.TTL, "default ttl should be used")
+
+	sc := StatusChecker{}
+	Assert(t).AreEqual(HEALTHCHECK_INTERVAL, sc.Config().Interval, "zero interval should fall back to HEALTHCHECK_INTERVAL")
+}
+
+func TestUpdatePodsPublishesSmoothing(t *testing.T) {
+	logger := logging.TestLogger()
+	healthManager := &MockHealthManager{}
+
+	smoothed, err := manifest.FromBytes([]byte(`
+id: foo
+status_port: 1
+status:
+  grace_period: 1m
+  failure_threshold: 3
+  sla:
+    window: 20
+    critical_success_rate: 0.9
+    warning_p95_latency: 250ms
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reality := []consul.ManifestResult{{Manifest: smoothed}, newManifestResult("bar")}
+	pods := updatePods(healthManager, nil, nil, nil, []PodWatch{}, reality, "bobnode", "", checkDefaults{}, nil, nil, nil, nil, nil, &logger)
+	defer func() {
+		for _, pod := range pods {
+			pod.shutdownCh <- true
+		}
+	}()
+	Assert(t).AreEqual(2, len(pods), "new pods were not added")
+
+	config := pods[0].statusChecker.Config()
+	Assert(t).AreEqual(time.Minute, config.GracePeriod, "config should include the grace period")
+	Assert(t).AreEqual(3, config.FailureThreshold, "config should include the failure threshold")
+	Assert(t).AreEqual(1, config.SuccessThreshold, "config should include the default success threshold")
+	expectedSLA := &health.SLAConfig{Window: 20, CriticalSuccessRate: 0.9, WarningP95Latency: 250 * time.Millisecond}
+	Assert(t).AreEqual(*expectedSLA, *config.SLA, "config should include the SLA")
+
+	config = pods[1].statusChecker.Config()
+	if config.FailureThreshold != 0 || config.SuccessThreshold != 0 || config.GracePeriod != 0 || config.SLA != nil {
+		t.Errorf("expected a pod without smoothing not to publish any, got %+v", config)
+	}
+}
+
+func TestStopPodWatches(t *testing.T) {
+	logger := logging.TestLogger()
+	before := runtime.NumGoroutine()
+
+	reality := []consul.ManifestResult{newManifestResult("foo"), newManifestResult("bar")}
+	pods := updatePods(&MockHealthManager{}, nil, nil, nil, []PodWatch{}, reality, "bobnode", "", checkDefaults{}, nil, nil, nil, nil, nil, &logger)
+	Assert(t).AreEqual(2, len(pods), "new pods were not added")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := stopPodWatches(ctx, pods); err != nil {
+		t.Fatalf("pod watches did not stop: %s", err)
+	}
+
+	// Goroutines exit shortly after signalling that they stopped
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("expected at most %d goroutines after stopping, found %d", before, after)
+	}
+}
+
+func TestNamedChecks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	_, statusPort, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	_, sidecarPort, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	man, err := manifest.FromBytes([]byte(fmt.Sprintf(`
+id: foo
+status_port: %s
+status:
+  http: true
+  checks:
+    ready:
+      http: true
+      path: /ready
+    live:
+      http: true
+      path: /healthz
+    sidecar:
+      type: tcp
+      port: %s
+`, statusPort, sidecarPort)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logging.TestLogger()
+	reality := []consul.ManifestResult{{Manifest: man}}
+	pods := updatePods(&MockHealthManager{}, http.DefaultClient, http.DefaultClient, nil, []PodWatch{}, reality, "127.0.0.1", "", checkDefaults{}, nil, nil, nil, nil, nil, &logger)
+	defer func() { pods[0].shutdownCh <- true }()
+	sc := pods[0].statusChecker
+
+	config := sc.Config()
+	Assert(t).AreEqual(3, len(config.Checks), "config should include every named check")
+	Assert(t).AreEqual("tcp://127.0.0.1:"+sidecarPort, config.Checks["sidecar"].URI, "sidecar check should use its own port")
+	Assert(t).AreEqual(fmt.Sprintf("http://127.0.0.1:%s/ready", statusPort), config.Checks["ready"].URI, "ready check should default to the status port")
+
+	res, err := sc.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	Assert(t).AreEqual(health.Critical, res.Status, "pod should be as healthy as its least healthy check")
+	Assert(t).AreEqual(health.ReasonHTTP5xx, res.Reason, "pod should have the reason of its least healthy check")
+	expected := []health.CheckResult{
+		{Name: "live", Status: health.Critical, Reason: health.ReasonHTTP5xx},
+		{Name: "ready", Status: health.Passing},
+		{Name: "sidecar", Status: health.Passing},
+	}
+	Assert(t).IsTrue(res.Checks != nil && reflect.DeepEqual(expected, res.Checks.Results), fmt.Sprintf("unexpected check results %+v", res.Checks))
+	Assert(t).AreEqual(health.HealthState(""), res.Readiness, "readiness should be unset without roles")
+}
+
+func TestNamedCheckRoles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ready" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	_, statusPort, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	man, err := manifest.FromBytes([]byte(fmt.Sprintf(`
+id: foo
+status_port: %s
+status:
+  http: true
+  checks:
+    ready:
+      http: true
+      path: /ready
+      role: readiness
+    live:
+      http: true
+      path: /healthz
+      role: liveness
+`, statusPort)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logging.TestLogger()
+	reality := []consul.ManifestResult{{Manifest: man}}
+	pods := updatePods(&MockHealthManager{}, http.DefaultClient, http.DefaultClient, nil, []PodWatch{}, reality, "127.0.0.1", "", checkDefaults{}, nil, nil, nil, nil, nil, &logger)
+	defer func() { pods[0].shutdownCh <- true }()
+	sc := pods[0].statusChecker
+	Assert(t).AreEqual(manifest.StatusRoleReadiness, sc.Config().Checks["ready"].Role, "config should include the role of each check")
+
+	res, err := sc.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	Assert(t).AreEqual(health.Critical, res.Status, "pod should be as healthy as its least healthy check")
+	Assert(t).AreEqual(health.Critical, res.ReadinessStatus(), "pod should not be ready if its readiness check fails")
+	Assert(t).AreEqual(health.Passing, res.LivenessStatus(), "pod should be alive if only its readiness check fails")
+	Assert(t).AreEqual(health.RoleReadiness, res.Checks.Results[1].Role, "check results should include their role")
+}
+
 func TestResultFromCheck(t *testing.T) {
 	sc := StatusChecker{}
 	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader([]byte(`HTTP/1.1 200 OK
@@ -138,6 +365,237 @@ output`))), nil)
 	Assert(t).AreEqual(health.Critical, val.Status, "err != nil should correspond to health.Critical")
 }
 
+func TestResultFromCheckWithExpression(t *testing.T) {
+	expression, err := expr.Parse(`json.status == "ok" && json.lag_seconds < 30`)
+	Assert(t).IsNil(err, "should have parsed expression")
+	sc := StatusChecker{Expression: expression}
+
+	response := func(code int, body string) *http.Response {
+		return &http.Response{
+			StatusCode: code,
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(body))),
+		}
+	}
+
+	val, _ := sc.resultFromCheck(response(200, `{"status": "ok", "lag_seconds": 3}`), nil)
+	Assert(t).AreEqual(health.Passing, val.Status, "a matching body should correspond to health.Passing")
+
+	val, _ = sc.resultFromCheck(response(200, `{"status": "ok", "lag_seconds": 300}`), nil)
+	Assert(t).AreEqual(health.Critical, val.Status, "a non-matching body should correspond to health.Critical")
+
+	val, _ = sc.resultFromCheck(response(200, `not json`), nil)
+	Assert(t).AreEqual(health.Critical, val.Status, "a non-JSON body should correspond to health.Critical")
+
+	val, _ = sc.resultFromCheck(response(500, `{"status": "ok", "lag_seconds": 3}`), nil)
+	Assert(t).AreEqual(health.Critical, val.Status, "!2** should correspond to health.Critical even if the body matches")
+}
+
+func TestResultFromCheckWithBodyAssertions(t *testing.T) {
+	response := func(code int, body string) *http.Response {
+		return &http.Response{
+			StatusCode: code,
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(body))),
+		}
+	}
+
+	sc := StatusChecker{BodyRegex: regexp.MustCompile(`^OK`)}
+	val, _ := sc.resultFromCheck(response(200, "OK all good"), nil)
+	Assert(t).AreEqual(health.Passing, val.Status, "a matching body should correspond to health.Passing")
+
+	val, _ = sc.resultFromCheck(response(200, "DEGRADED"), nil)
+	Assert(t).AreEqual(health.Critical, val.Status, "a non-matching body should correspond to health.Critical")
+	Assert(t).AreEqual(health.ReasonBodyMismatch, val.Reason, "a non-matching body should be reported as a body mismatch")
+
+	sc = StatusChecker{BodyJSON: map[string]string{
+		"status":       "ok",
+		"db.connected": "true",
+		"replicas":     "1000000",
+	}}
+	val, _ = sc.resultFromCheck(response(200, `{"status": "ok", "db": {"connected": true}, "replicas": 1000000}`), nil)
+	Assert(t).AreEqual(health.Passing, val.Status, "matching fields should correspond to health.Passing")
+
+	val, _ = sc.resultFromCheck(response(200, `{"status": "ok", "db": {"connected": false}, "replicas": 1000000}`), nil)
+	Assert(t).AreEqual(health.Critical, val.Status, "a nested field with the wrong value should correspond to health.Critical")
+
+	val, _ = sc.resultFromCheck(response(200, `{"status": "ok", "replicas": 1000000}`), nil)
+	Assert(t).AreEqual(health.Critical, val.Status, "a missing field should correspond to health.Critical")
+
+	val, _ = sc.resultFromCheck(response(200, `ok`), nil)
+	Assert(t).AreEqual(health.Critical, val.Status, "a non-JSON body should correspond to health.Critical")
+}
+
+func TestResultIncludesCheckConfig(t *testing.T) {
+	expression, err := expr.Parse(`json.status == "ok"`)
+	Assert(t).IsNil(err, "should have parsed expression")
+	sc := StatusChecker{
+		URI:        "https://node1:8080/_status",
+		Expression: expression,
+	}
+
+	val, _ := sc.resultFromCheck(nil, fmt.Errorf("an error"))
+	Assert(t).IsNotNil(val.Check, "result should include the check config")
+	Assert(t).AreEqual(sc.URI, val.Check.URI, "check config should include the status URI")
+	Assert(t).AreEqual(`json.status == "ok"`, val.Check.Expression, "check config should include the expression")
+	Assert(t).AreEqual(HEALTHCHECK_INTERVAL, val.Check.Interval, "check config should include the interval")
+
+	consulRes := resToConsulRes(val)
+	Assert(t).IsTrue(consulRes.Check.Equal(val.Check), "check config should be published to consul")
+}
+
+func TestStatusCheckRequestOptions(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/slow":
+			<-release
+		case r.Method != "GET" || r.Host != "thepod.example.com" || r.Header.Get("X-Check") != "1":
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusNotModified)
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	sc := StatusChecker{
+		URI:            server.URL + "/_status",
+		Client:         http.DefaultClient,
+		Method:         "GET",
+		Headers:        map[string]string{"host": "thepod.example.com", "X-Check": "1"},
+		ExpectedStatus: []manifest.StatusCodeRange{{Min: 200, Max: 299}, {Min: 304, Max: 304}},
+	}
+	res, _ := sc.resultFromCheck(sc.StatusCheck())
+	Assert(t).AreEqual(health.Passing, res.Status, "an expected 304 should correspond to health.Passing")
+	Assert(t).AreEqual("200-299,304", res.Check.ExpectedStatus, "check config should include the expected status")
+
+	sc.Headers = nil
+	res, _ = sc.resultFromCheck(sc.StatusCheck())
+	Assert(t).AreEqual(health.ReasonHTTPStatus, res.Reason, "an unexpected 400 should be reported as a bad status")
+
+	sc.URI = server.URL + "/slow"
+	sc.Timeout = 50 * time.Millisecond
+	res, _ = sc.resultFromCheck(sc.StatusCheck())
+	Assert(t).AreEqual(health.ReasonTimeout, res.Reason, "a slow response should time out")
+	Assert(t).AreEqual(50*time.Millisecond, res.Check.Timeout, "check config should include the timeout")
+}
+
+func TestCheckRequiresHealthyProcesses(t *testing.T) {
+	var workerStatus int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/worker" {
+			w.WriteHeader(workerStatus)
+		}
+	}))
+	defer server.Close()
+
+	sc := StatusChecker{
+		ID:     "pod",
+		Client: server.Client(),
+		ProcessURIs: map[string]string{
+			"app/web":    server.URL + "/web",
+			"app/worker": server.URL + "/worker",
+		},
+	}
+
+	workerStatus = http.StatusOK
+	res, err := sc.Check()
+	Assert(t).IsNil(err, "should not have erred checking health")
+	Assert(t).AreEqual(res.Status, health.Passing, "should be passing when every process is healthy")
+	Assert(t).AreEqual(len(res.Check.Processes), 2, "check config should include the process checks")
+
+	workerStatus = http.StatusServiceUnavailable
+	res, err = sc.Check()
+	Assert(t).IsNil(err, "should not have erred checking health")
+	Assert(t).AreEqual(res.Status, health.Critical, "should be critical when a process is unhealthy")
+	Assert(t).AreEqual(res.Reason, health.ReasonProcessUnhealthy, "should say that a process is unhealthy")
+}
+
+func TestResultFromCheckReasons(t *testing.T) {
+	response := func(code int, body string) *http.Response {
+		return &http.Response{
+			StatusCode: code,
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(body))),
+		}
+	}
+	expression, err := expr.Parse(`json.status == "ok"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc := StatusChecker{Expression: expression}
+
+	for _, test := range []struct {
+		resp   *http.Response
+		reason health.Reason
+	}{
+		{response(200, `{"status": "ok"}`), ""},
+		{response(200, `{"status": "degraded"}`), health.ReasonBodyMismatch},
+		{response(503, `{"status": "ok"}`), health.ReasonHTTP5xx},
+		{response(404, `{"status": "ok"}`), health.ReasonHTTPStatus},
+	} {
+		res, _ := sc.resultFromCheck(test.resp, nil)
+		if res.Reason != test.reason {
+			t.Errorf("Expected reason %q for a %d response, got %q", test.reason, test.resp.StatusCode, res.Reason)
+		}
+	}
+	if consulRes := resToConsulRes(health.Result{Reason: health.ReasonTimeout}); consulRes.Reason != health.ReasonTimeout {
+		t.Error("Expected the reason to be published to consul")
+	}
+}
+
+func TestResultFromCheckRequestErrorReasons(t *testing.T) {
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsServer.Close()
+	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slowServer.Close()
+	closedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closedServer.Close()
+
+	for _, test := range []struct {
+		uri     string
+		timeout time.Duration
+		reason  health.Reason
+	}{
+		// the test server's certificate isn't trusted by the default client
+		{tlsServer.URL, 5 * time.Second, health.ReasonTLSError},
+		{slowServer.URL, 50 * time.Millisecond, health.ReasonTimeout},
+		{closedServer.URL, 5 * time.Second, health.ReasonConnectionRefused},
+	} {
+		sc := StatusChecker{
+			URI:    test.uri,
+			Client: &http.Client{Timeout: test.timeout},
+		}
+		res, err := sc.resultFromCheck(sc.StatusCheck())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != health.Critical || res.Reason != test.reason {
+			t.Errorf("Expected %s to be critical with reason %q, got %s with %q", test.uri, test.reason, res.Status, res.Reason)
+		}
+	}
+}
+
+func TestProcessStatusEndpoints(t *testing.T) {
+	builder := manifest.NewBuilder()
+	builder.SetID("pod")
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"app": {
+			LaunchableType: "hoist",
+			Processes: map[string]launch.ProcessStanza{
+				"web":    {EntryPoint: "bin/web", StatusPort: 8080, StatusPath: "health"},
+				"worker": {EntryPoint: "bin/worker", StatusPort: 8081},
+				"cron":   {EntryPoint: "bin/cron"},
+			},
+		},
+	})
+
+	endpoints := processStatusEndpoints(builder.GetManifest())
+	Assert(t).AreEqual(len(endpoints), 2, "processes without a status port should not be checked")
+	Assert(t).AreEqual(endpoints["app/web"], ":8080/health", "unexpected web endpoint")
+	Assert(t).AreEqual(endpoints["app/worker"], ":8081/_status", "unexpected worker endpoint")
+}
+
 func newWatch(id types.PodID) *PodWatch {
 	ch := make(chan bool, 1)
 	return &PodWatch{
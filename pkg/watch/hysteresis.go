@@ -0,0 +1,82 @@
+package watch
+
+import (
+	"github.com/square/p2/pkg/health"
+)
+
+// hysteresis keeps a pod's reported health from flapping. A passing pod is
+// only reported as critical after failureThreshold consecutive results that
+// aren't passing, of which warnings count, and a critical pod is only
+// reported as passing after successThreshold consecutive passing results.
+// Until then the previously reported status is kept, along with its readiness
+// and liveness. Other statuses are reported as they are, without resetting
+// which of passing and critical the pod was last reported as, so a warning in
+// between doesn't skip the thresholds.
+//
+// It is only used from the goroutine monitoring the pod, so it isn't locked.
+type hysteresis struct {
+	failureThreshold int
+	successThreshold int
+
+	failures  int
+	successes int
+
+	// Passing or critical, whichever was reported last, empty if neither
+	// has been since the last unknown result
+	settled health.HealthState
+
+	// The status, reason, readiness and liveness that were last reported,
+	// nil until the first result
+	reported *health.Result
+}
+
+func newHysteresis(failureThreshold, successThreshold int) *hysteresis {
+	return &hysteresis{
+		failureThreshold: failureThreshold,
+		successThreshold: successThreshold,
+	}
+}
+
+// apply replaces the status and reason of res with the previously reported
+// ones if res hasn't been seen enough times in a row to be reported yet
+func (h *hysteresis) apply(res *health.Result) {
+	if h == nil {
+		return
+	}
+	switch res.Status {
+	case health.Critical:
+		h.failures++
+		h.successes = 0
+	case health.Passing:
+		h.successes++
+		h.failures = 0
+	case health.Warning:
+		h.failures++
+		h.successes = 0
+	default:
+		h.failures = 0
+		h.successes = 0
+		h.settled = ""
+	}
+
+	if h.reported != nil {
+		hold := (res.Status == health.Critical && h.settled == health.Passing && h.failures < h.failureThreshold) ||
+			(res.Status == health.Passing && h.settled == health.Critical && h.successes < h.successThreshold)
+		if hold {
+			res.Status = h.reported.Status
+			res.Reason = h.reported.Reason
+			res.Readiness = h.reported.Readiness
+			res.Liveness = h.reported.Liveness
+			return
+		}
+	}
+	if res.Status == health.Passing || res.Status == health.Critical {
+		h.settled = res.Status
+	}
+	h.reported = &health.Result{
+		Status:    res.Status,
+		Reason:    res.Reason,
+		Readiness: res.Readiness,
+		Liveness:  res.Liveness,
+	}
+}
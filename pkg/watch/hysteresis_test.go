@@ -0,0 +1,100 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/health"
+)
+
+func TestHysteresis(t *testing.T) {
+	h := newHysteresis(3, 2)
+	steps := []struct {
+		status   health.HealthState
+		reported health.HealthState
+	}{
+		// the first result is reported as is
+		{health.Critical, health.Critical},
+		// it takes 2 passing results to recover
+		{health.Passing, health.Critical},
+		{health.Passing, health.Passing},
+		// blips don't flip the pod to critical
+		{health.Critical, health.Passing},
+		{health.Critical, health.Passing},
+		{health.Passing, health.Passing},
+		{health.Critical, health.Passing},
+		{health.Critical, health.Passing},
+		// until there are 3 in a row
+		{health.Critical, health.Critical},
+		{health.Passing, health.Critical},
+		{health.Critical, health.Critical},
+		// other statuses are reported straight away
+		{health.Warning, health.Warning},
+		{health.Critical, health.Critical},
+	}
+	for i, step := range steps {
+		res := health.Result{Status: step.status}
+		if step.status == health.Critical {
+			res.Reason = health.ReasonTimeout
+		}
+		h.apply(&res)
+		if res.Status != step.reported {
+			t.Errorf("step %d: expected %s to be reported as %s, got %s", i, step.status, step.reported, res.Status)
+		}
+		if res.Status == health.Passing && res.Reason != "" {
+			t.Errorf("step %d: expected a held passing status not to have a reason, got %s", i, res.Reason)
+		}
+	}
+
+	var none *hysteresis
+	res := health.Result{Status: health.Critical}
+	none.apply(&res)
+	if res.Status != health.Critical {
+		t.Errorf("expected pods without thresholds to be reported as is, got %s", res.Status)
+	}
+}
+
+func TestHysteresisCountsWarnings(t *testing.T) {
+	h := newHysteresis(3, 2)
+	steps := []struct {
+		status   health.HealthState
+		reported health.HealthState
+	}{
+		{health.Passing, health.Passing},
+		// a warning is reported, but counts toward the failures
+		{health.Warning, health.Warning},
+		{health.Critical, health.Warning},
+		{health.Critical, health.Critical},
+		// and doesn't let a critical pod recover any sooner
+		{health.Warning, health.Warning},
+		{health.Passing, health.Warning},
+		{health.Passing, health.Passing},
+		// unknown results start over
+		{health.Unknown, health.Unknown},
+		{health.Critical, health.Critical},
+	}
+	for i, step := range steps {
+		res := health.Result{Status: step.status}
+		h.apply(&res)
+		if res.Status != step.reported {
+			t.Errorf("step %d: expected %s to be reported as %s, got %s", i, step.status, step.reported, res.Status)
+		}
+	}
+}
+
+func TestHysteresisHoldsReadinessAndLiveness(t *testing.T) {
+	h := newHysteresis(2, 1)
+	res := health.Result{Status: health.Passing, Readiness: health.Passing, Liveness: health.Passing}
+	h.apply(&res)
+
+	res = health.Result{Status: health.Critical, Readiness: health.Critical, Liveness: health.Passing}
+	h.apply(&res)
+	if res.Status != health.Passing || res.ReadinessStatus() != health.Passing {
+		t.Errorf("expected a held result to keep its readiness, got %+v", res)
+	}
+
+	res = health.Result{Status: health.Critical, Readiness: health.Critical, Liveness: health.Passing}
+	h.apply(&res)
+	if res.ReadinessStatus() != health.Critical || res.LivenessStatus() != health.Passing {
+		t.Errorf("expected readiness critical and liveness passing, got %+v", res)
+	}
+}
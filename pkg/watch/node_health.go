@@ -0,0 +1,165 @@
+package watch
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul/statusstore/nodehealthstatus"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util/param"
+)
+
+// The fraction of a node's pods that must be critical for the node's published
+// health to be critical, see nodehealthstatus.Aggregate
+var nodeHealthCriticalFraction = param.Float64("node_health_critical_fraction", 0.5)
+
+// How often the node's health is compared with the last published health, and
+// how often it is published even when it hasn't changed, so that readers can
+// tell a node that stopped publishing from a healthy one
+var nodeHealthPublishSeconds = param.Int("node_health_publish_seconds", 10)
+var nodeHealthRefreshSeconds = param.Int("node_health_refresh_seconds", 60)
+
+// NodeHealthStore records the aggregated health of a node
+type NodeHealthStore interface {
+	Set(node types.NodeName, status nodehealthstatus.Status) error
+}
+
+// NodeHealth tracks the latest health check result of every pod monitored on
+// a node, and serves a summary of them over HTTP. This is useful for load
+// balancer health probes that can only check a single URL per node.
+type NodeHealth struct {
+	node types.NodeName
+
+	// See SetLogURL
+	logURL string
+
+	mu      sync.RWMutex
+	results map[types.PodID]health.HealthState
+	// The gating status of each pod's latest result, which is what the
+	// published node health is aggregated from
+	gating map[types.PodID]health.HealthState
+	// What the status page shows about each pod, see ServeStatusPage
+	pods map[types.PodID]*podStatus
+}
+
+// NodeHealthSummary is the JSON body served by NodeHealth
+type NodeHealthSummary struct {
+	Node types.NodeName `json:"node"`
+
+	// The worst health state of any pod on the node. A node with no pods is
+	// passing
+	Status health.HealthState `json:"status"`
+
+	Pods map[types.PodID]health.HealthState `json:"pods"`
+}
+
+func NewNodeHealth(node types.NodeName) *NodeHealth {
+	return &NodeHealth{
+		node:    node,
+		results: make(map[types.PodID]health.HealthState),
+		gating:  make(map[types.PodID]health.HealthState),
+		pods:    make(map[types.PodID]*podStatus),
+	}
+}
+
+func (n *NodeHealth) set(res health.Result) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.results[res.ID] = res.Status
+	n.gating[res.ID] = res.GatingStatus()
+	n.setPodStatus(res)
+}
+
+func (n *NodeHealth) remove(id types.PodID) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.results, id)
+	delete(n.gating, id)
+}
+
+func (n *NodeHealth) Summary() NodeHealthSummary {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	summary := NodeHealthSummary{
+		Node:   n.node,
+		Status: health.Passing,
+		Pods:   make(map[types.PodID]health.HealthState, len(n.results)),
+	}
+	for id, status := range n.results {
+		summary.Pods[id] = status
+		if health.Compare(status, summary.Status) < 0 {
+			summary.Status = status
+		}
+	}
+	return summary
+}
+
+// ServeHTTP responds with a NodeHealthSummary. The response code is 200 if
+// every pod is passing and 503 otherwise, so that probes which only look at
+// the response code take the node out of rotation when any pod is unhealthy.
+func (n *NodeHealth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	summary := n.Summary()
+	body, err := json.Marshal(summary)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if summary.Status != health.Passing {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_, _ = w.Write(body)
+}
+
+// Status aggregates the gating health of every pod on the node into the
+// node's health
+func (n *NodeHealth) Status(now time.Time) nodehealthstatus.Status {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return nodehealthstatus.Aggregate(n.gating, *nodeHealthCriticalFraction, now)
+}
+
+// PublishStatus writes the node's health to store whenever it changes, and at
+// least every node_health_refresh_seconds, until quitCh is closed. Schedulers
+// read it to avoid giving new pods to critical nodes.
+func (n *NodeHealth) PublishStatus(store NodeHealthStore, quitCh <-chan struct{}, logger *logging.Logger) {
+	ticker := time.NewTicker(time.Duration(*nodeHealthPublishSeconds) * time.Second)
+	defer ticker.Stop()
+
+	var published nodehealthstatus.Status
+	for {
+		published = n.publishStatus(store, published, time.Now(), logger)
+		select {
+		case <-quitCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishStatus writes the node's health if it differs from the last
+// published health or that is due to be refreshed, and returns the health
+// that is published now
+func (n *NodeHealth) publishStatus(store NodeHealthStore, published nodehealthstatus.Status, now time.Time, logger *logging.Logger) nodehealthstatus.Status {
+	status := n.Status(now)
+	refresh := time.Duration(*nodeHealthRefreshSeconds) * time.Second
+	if !published.Updated.IsZero() && status.Equivalent(published) && !published.Stale(now, refresh) {
+		return published
+	}
+
+	err := store.Set(n.node, status)
+	if err != nil {
+		logger.WithError(err).Warnln("Could not publish node health")
+		return published
+	}
+	if status.State != published.State {
+		logger.WithField("node_health", status.State).Infoln("Published node health")
+	}
+	return status
+}
@@ -0,0 +1,174 @@
+package watch
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/statusstore/nodehealthstatus"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestNodeHealthServesWorstState(t *testing.T) {
+	nodeHealth := NewNodeHealth("node1")
+
+	get := func() (int, NodeHealthSummary) {
+		recorder := httptest.NewRecorder()
+		nodeHealth.ServeHTTP(recorder, httptest.NewRequest("GET", "/_node_health", nil))
+		var summary NodeHealthSummary
+		err := json.Unmarshal(recorder.Body.Bytes(), &summary)
+		if err != nil {
+			t.Fatalf("could not unmarshal node health summary: %s", err)
+		}
+		return recorder.Code, summary
+	}
+
+	code, summary := get()
+	if code != http.StatusOK || summary.Status != health.Passing {
+		t.Errorf("expected a node with no pods to be passing, got %d %s", code, summary.Status)
+	}
+
+	nodeHealth.set(health.Result{ID: "a", Status: health.Passing})
+	nodeHealth.set(health.Result{ID: "b", Status: health.Warning})
+	code, summary = get()
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("expected a 503 when a pod is not passing, got %d", code)
+	}
+	if summary.Status != health.Warning {
+		t.Errorf("expected node status to be warning, was %s", summary.Status)
+	}
+	if summary.Node != "node1" || len(summary.Pods) != 2 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+
+	nodeHealth.remove("b")
+	code, summary = get()
+	if code != http.StatusOK || summary.Status != health.Passing {
+		t.Errorf("expected node to be passing after the unhealthy pod was removed, got %d %s", code, summary.Status)
+	}
+}
+
+func TestNodeStatusPage(t *testing.T) {
+	nodeHealth := NewNodeHealth("node1")
+	nodeHealth.SetLogURL("https://logs.example.com/?host={node}&app={pod}")
+
+	builder := manifest.NewBuilder()
+	builder.SetID("web")
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"app": {Version: launch.LaunchableVersion{ID: "1.2.3"}},
+	})
+	man := builder.GetManifest()
+	nodeHealth.watch(man)
+	nodeHealth.set(health.Result{ID: "web", Status: health.Critical, Reason: health.ReasonHTTP5xx})
+
+	get := func() string {
+		recorder := httptest.NewRecorder()
+		nodeHealth.ServeStatusPage(recorder, httptest.NewRequest("GET", "/", nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected a 200, got %d", recorder.Code)
+		}
+		return recorder.Body.String()
+	}
+
+	page := get()
+	for _, expected := range []string{
+		"web",
+		"app: 1.2.3",
+		"critical (http_5xx)",
+		"Became critical (http_5xx)",
+		`href="https://logs.example.com/?host=node1&amp;app=web"`,
+	} {
+		if !strings.Contains(page, expected) {
+			t.Errorf("expected the status page to contain %q:\n%s", expected, page)
+		}
+	}
+
+	// a replaced manifest is watched before the old one is unwatched
+	builder = man.GetBuilder()
+	builder.SetStatusPort(8080)
+	updated := builder.GetManifest()
+	nodeHealth.watch(updated)
+	nodeHealth.unwatch(man)
+	if page = get(); !strings.Contains(page, "Manifest changed") {
+		t.Errorf("expected the status page to show the manifest change:\n%s", page)
+	}
+	nodeHealth.unwatch(updated)
+	if page = get(); !strings.Contains(page, "No pods are monitored") {
+		t.Errorf("expected the status page to have no pods once they're unwatched:\n%s", page)
+	}
+
+	recorder := httptest.NewRecorder()
+	nodeHealth.ServeStatusPage(recorder, httptest.NewRequest("GET", "/other", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("expected a 404 for other paths, got %d", recorder.Code)
+	}
+}
+
+type recordingNodeHealthStore struct {
+	statuses []nodehealthstatus.Status
+	err      error
+}
+
+func (r *recordingNodeHealthStore) Set(node types.NodeName, status nodehealthstatus.Status) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.statuses = append(r.statuses, status)
+	return nil
+}
+
+func TestNodeHealthPublishStatus(t *testing.T) {
+	nodeHealth := NewNodeHealth("node1")
+	store := &recordingNodeHealthStore{}
+	logger := logging.TestLogger()
+	now := time.Now()
+
+	published := nodeHealth.publishStatus(store, nodehealthstatus.Status{}, now, &logger)
+	if len(store.statuses) != 1 || published.State != nodehealthstatus.Healthy {
+		t.Fatalf("expected a healthy node to be published at first, got %+v", store.statuses)
+	}
+
+	nodeHealth.set(health.Result{ID: "a", Status: health.Passing})
+	nodeHealth.set(health.Result{ID: "b", Status: health.Critical, Suppressed: true})
+	published = nodeHealth.publishStatus(store, published, now.Add(time.Second), &logger)
+	if len(store.statuses) != 2 || published.State != nodehealthstatus.Healthy || published.PodCount != 2 {
+		t.Fatalf("expected the new pods to be published, with the suppressed one passing, got %+v", published)
+	}
+
+	published = nodeHealth.publishStatus(store, published, now.Add(2*time.Second), &logger)
+	if len(store.statuses) != 2 {
+		t.Errorf("expected an unchanged node health not to be published again before it is due, got %+v", store.statuses)
+	}
+
+	nodeHealth.set(health.Result{ID: "b", Status: health.Critical})
+	published = nodeHealth.publishStatus(store, published, now.Add(3*time.Second), &logger)
+	if len(store.statuses) != 3 || published.State != nodehealthstatus.Critical || published.FailingPods["b"] != health.Critical {
+		t.Errorf("expected the node to be published as critical, got %+v", published)
+	}
+
+	store.err = errors.New("consul is down")
+	nodeHealth.remove("b")
+	failed := nodeHealth.publishStatus(store, published, now.Add(4*time.Second), &logger)
+	if failed.State != nodehealthstatus.Critical {
+		t.Errorf("expected a failed write to leave the last published health, got %+v", failed)
+	}
+
+	store.err = nil
+	refreshAt := now.Add(3*time.Second + time.Duration(*nodeHealthRefreshSeconds)*time.Second + time.Second)
+	published = nodeHealth.publishStatus(store, failed, refreshAt, &logger)
+	if len(store.statuses) != 4 || published.State != nodehealthstatus.Healthy {
+		t.Errorf("expected the node to be published as healthy once the store is back, got %+v", published)
+	}
+	published = nodeHealth.publishStatus(store, published, refreshAt.Add(time.Duration(*nodeHealthRefreshSeconds)*time.Second+time.Second), &logger)
+	if len(store.statuses) != 5 {
+		t.Errorf("expected an unchanged node health to be refreshed, got %+v", store.statuses)
+	}
+}
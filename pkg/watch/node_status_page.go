@@ -0,0 +1,230 @@
+package watch
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+)
+
+// The number of events kept for each pod on the status page
+const maxPodEvents = 10
+
+// podStatus is what the status page shows about a pod
+type podStatus struct {
+	ID       types.PodID
+	SHA      string
+	Versions []string
+	Status   health.HealthState
+	Reason   health.Reason
+	// Whether the latest result was during a blackout window
+	Suppressed bool
+
+	// When the health monitor started watching the current manifest,
+	// which is roughly when the pod was last launched
+	Since     time.Time
+	LastCheck time.Time
+
+	// The most recent last
+	Events []podEvent
+}
+
+type podEvent struct {
+	Time    time.Time
+	Message string
+}
+
+func (p *podStatus) event(message string) {
+	p.Events = append(p.Events, podEvent{Time: time.Now(), Message: message})
+	if len(p.Events) > maxPodEvents {
+		p.Events = p.Events[len(p.Events)-maxPodEvents:]
+	}
+}
+
+// SetLogURL links each pod on the status page to its logs. Occurrences of
+// "{node}" and "{pod}" in the template are replaced with the node name and
+// pod ID. It must be called before the page is served.
+func (n *NodeHealth) SetLogURL(template string) {
+	n.logURL = template
+}
+
+// watch records that the health monitor started watching a manifest
+func (n *NodeHealth) watch(man manifest.Manifest) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	sha, _ := man.SHA()
+	status := &podStatus{
+		ID:       man.ID(),
+		SHA:      sha,
+		Versions: launchableVersions(man),
+		Since:    time.Now(),
+	}
+	if previous, ok := n.pods[man.ID()]; ok {
+		status.Events = previous.Events
+		status.event(fmt.Sprintf("Manifest changed from %s to %s", shortSHA(previous.SHA), shortSHA(sha)))
+	} else {
+		status.event(fmt.Sprintf("Started monitoring manifest %s", shortSHA(sha)))
+	}
+	n.pods[man.ID()] = status
+}
+
+// unwatch forgets a manifest once the health monitor stops watching it.
+// Pods whose manifest changed are left alone, because the new manifest is
+// watched before the old one is forgotten.
+func (n *NodeHealth) unwatch(man manifest.Manifest) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	sha, _ := man.SHA()
+	if status, ok := n.pods[man.ID()]; ok && status.SHA == sha {
+		delete(n.pods, man.ID())
+	}
+}
+
+// setPodStatus records a check result on the status page. n.mu must be held
+func (n *NodeHealth) setPodStatus(res health.Result) {
+	status, ok := n.pods[res.ID]
+	if !ok {
+		return
+	}
+	if res.Status != status.Status || res.Reason != status.Reason {
+		message := fmt.Sprintf("Became %s", res.Status)
+		if res.Reason != "" {
+			message += fmt.Sprintf(" (%s)", res.Reason)
+		}
+		status.event(message)
+	}
+	status.Status = res.Status
+	status.Reason = res.Reason
+	status.Suppressed = res.Suppressed
+	status.LastCheck = time.Now()
+}
+
+// ServeStatusPage responds with an HTML page that describes every pod on the
+// node, for operators looking into a node during an incident
+func (n *NodeHealth) ServeStatusPage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	n.mu.RLock()
+	page := statusPage{
+		Node: n.node,
+		Time: time.Now(),
+	}
+	for _, status := range n.pods {
+		pod := *status
+		pod.Events = append([]podEvent(nil), status.Events...)
+		page.Pods = append(page.Pods, statusPagePod{
+			podStatus: pod,
+			LogURL:    n.podLogURL(status.ID),
+		})
+	}
+	n.mu.RUnlock()
+	sort.Slice(page.Pods, func(i, j int) bool {
+		return page.Pods[i].ID < page.Pods[j].ID
+	})
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := statusPageTemplate.Execute(w, page)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (n *NodeHealth) podLogURL(id types.PodID) string {
+	if n.logURL == "" {
+		return ""
+	}
+	return strings.NewReplacer("{node}", n.node.String(), "{pod}", id.String()).Replace(n.logURL)
+}
+
+type statusPage struct {
+	Node types.NodeName
+	Time time.Time
+	Pods []statusPagePod
+}
+
+type statusPagePod struct {
+	podStatus
+	LogURL string
+}
+
+// launchableVersions describes the version of each of a manifest's
+// launchables, sorted by launchable ID
+func launchableVersions(man manifest.Manifest) []string {
+	var versions []string
+	for id, stanza := range man.GetLaunchableStanzas() {
+		version := stanza.Version.ID.String()
+		if version == "" {
+			version = path.Base(stanza.Location)
+		}
+		versions = append(versions, fmt.Sprintf("%s: %s", id, version))
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
+
+var statusPageTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"shortSHA": shortSHA,
+	"uptime": func(since time.Time) string {
+		return time.Since(since).Round(time.Second).String()
+	},
+	"timestamp": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return t.Format(time.RFC3339)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>{{.Node}} pods</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+.passing { color: #080; }
+.warning { color: #a60; }
+.critical, .unknown { color: #c00; }
+</style>
+</head>
+<body>
+<h1>Pods on {{.Node}}</h1>
+<p>As of {{timestamp .Time}}</p>
+{{if .Pods}}
+<table>
+<tr><th>Pod</th><th>Version</th><th>Health</th><th>Uptime</th><th>Last check</th><th>Recent events</th><th>Logs</th></tr>
+{{range .Pods}}
+<tr>
+<td>{{.ID}}</td>
+<td>{{shortSHA .SHA}}{{range .Versions}}<br>{{.}}{{end}}</td>
+<td class="{{.Status}}">{{if .Status}}{{.Status}}{{else}}not checked yet{{end}}{{if .Reason}} ({{.Reason}}){{end}}{{if .Suppressed}}, suppressed by a blackout window{{end}}</td>
+<td>{{uptime .Since}}</td>
+<td>{{timestamp .LastCheck}}</td>
+<td>{{range .Events}}{{timestamp .Time}} {{.Message}}<br>{{end}}</td>
+<td>{{if .LogURL}}<a href="{{.LogURL}}">logs</a>{{end}}</td>
+</tr>
+{{end}}
+</table>
+{{else}}
+<p>No pods are monitored on this node.</p>
+{{end}}
+</body>
+</html>
+`))
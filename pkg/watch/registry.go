@@ -0,0 +1,168 @@
+package watch
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/square/p2/pkg/errors"
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/types"
+)
+
+// How long CheckNow waits for a check to be performed, on top of the check's
+// own timeout
+const checkNowGrace = 5 * time.Second
+
+// ErrPodNotMonitored is returned by CheckNow for pods that the health monitor
+// isn't checking
+var ErrPodNotMonitored = errors.New("pod is not monitored")
+
+// checkResponse is the outcome of a check requested through a pod's trigger
+// channel
+type checkResponse struct {
+	result health.Result
+	err    error
+}
+
+// HealthRegistry records the pods monitored by MonitorPodHealth along with
+// their checks and latest results, so that the health monitor can be
+// inspected when debugging a node
+type HealthRegistry struct {
+	mu   sync.RWMutex
+	pods map[types.PodID]*MonitoredPod
+
+	// Called with every result of the monitored pods, see Observe
+	observers []func(health.Result)
+}
+
+// MonitoredPod is a pod in a HealthRegistry
+type MonitoredPod struct {
+	ID        types.PodID         `json:"id"`
+	Check     *health.CheckConfig `json:"check"`
+	Status    health.HealthState  `json:"status,omitempty"`
+	LastCheck time.Time           `json:"last_check,omitempty"`
+
+	trigger chan chan checkResponse
+}
+
+func NewHealthRegistry() *HealthRegistry {
+	return &HealthRegistry{
+		pods: make(map[types.PodID]*MonitoredPod),
+	}
+}
+
+func (r *HealthRegistry) add(sc StatusChecker, trigger chan chan checkResponse) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pods[sc.ID] = &MonitoredPod{
+		ID:      sc.ID,
+		Check:   sc.Config(),
+		trigger: trigger,
+	}
+}
+
+func (r *HealthRegistry) set(res health.Result) {
+	r.mu.Lock()
+	if pod, ok := r.pods[res.ID]; ok {
+		pod.Status = res.Status
+		pod.LastCheck = time.Now()
+	}
+	observers := r.observers
+	r.mu.Unlock()
+
+	for _, observer := range observers {
+		observer(res)
+	}
+}
+
+// Observe has observer called with every result of the monitored pods, as
+// they are published. It is called from the goroutine checking the pod, so
+// it shouldn't block.
+func (r *HealthRegistry) Observe(observer func(health.Result)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.observers = append(r.observers, observer)
+}
+
+func (r *HealthRegistry) remove(id types.PodID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.pods, id)
+}
+
+// Snapshot returns the monitored pods sorted by ID. Its signature matches
+// preparer.DebugSection so that it can be included in debug bundles.
+func (r *HealthRegistry) Snapshot() (interface{}, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pods := make([]MonitoredPod, 0, len(r.pods))
+	for _, pod := range r.pods {
+		pods = append(pods, *pod)
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].ID < pods[j].ID
+	})
+	return pods, nil
+}
+
+// CheckNow checks the health of a monitored pod out of cycle and returns the
+// result, which is published the same as the results of scheduled checks
+func (r *HealthRegistry) CheckNow(id types.PodID) (health.Result, error) {
+	r.mu.RLock()
+	pod, ok := r.pods[id]
+	r.mu.RUnlock()
+	if !ok {
+		return health.Result{}, ErrPodNotMonitored
+	}
+
+	// the pod may stop being monitored at any point, in which case nothing
+	// will answer
+	timeout := time.After(time.Duration(*HEALTHCHECK_TIMEOUT)*time.Second + checkNowGrace)
+	respCh := make(chan checkResponse, 1)
+	select {
+	case pod.trigger <- respCh:
+	case <-timeout:
+		return health.Result{}, errors.Codef(errors.CodeTimeout, "timed out requesting a health check of %s", id)
+	}
+	select {
+	case resp := <-respCh:
+		return resp.result, resp.err
+	case <-timeout:
+		return health.Result{}, errors.Codef(errors.CodeTimeout, "timed out waiting for the health check of %s", id)
+	}
+}
+
+// ServeCheck handles requests to check a pod's health right away. The pod is
+// given by the "pod" query parameter, and the result is written as JSON.
+func (r *HealthRegistry) ServeCheck(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "health checks must be requested with POST", http.StatusMethodNotAllowed)
+		return
+	}
+	id := types.PodID(req.URL.Query().Get("pod"))
+	if id == "" {
+		http.Error(w, "no pod was given", http.StatusBadRequest)
+		return
+	}
+
+	res, err := r.CheckNow(id)
+	switch {
+	case err == ErrPodNotMonitored:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
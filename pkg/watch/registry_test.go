@@ -0,0 +1,116 @@
+package watch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul"
+)
+
+type recordingUpdater struct {
+	results chan consul.WatchResult
+}
+
+func (u recordingUpdater) PutHealth(res consul.WatchResult) error {
+	u.results <- res
+	return nil
+}
+
+func (recordingUpdater) Close() {}
+
+func TestCheckNow(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	logger := logging.TestLogger()
+	registry := NewHealthRegistry()
+	sc := StatusChecker{ID: "foo", Node: "node1", URI: server.URL, Client: http.DefaultClient}
+	updater := recordingUpdater{results: make(chan consul.WatchResult, 10)}
+	pod := PodWatch{
+		manifest:      newManifestResult("foo").Manifest,
+		updater:       updater,
+		statusChecker: sc,
+		shutdownCh:    make(chan bool, 1),
+		registry:      registry,
+		triggerCh:     make(chan chan checkResponse),
+		logger:        &logger,
+	}
+	registry.add(sc, pod.triggerCh)
+	go pod.MonitorHealth()
+	defer func() { pod.shutdownCh <- true }()
+
+	res, err := registry.CheckNow("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != health.Critical || res.Reason != health.ReasonHTTP5xx {
+		t.Errorf("expected the check to be critical with reason %s, got %s (%s)", health.ReasonHTTP5xx, res.Status, res.Reason)
+	}
+	select {
+	case published := <-updater.results:
+		if published.Status != string(health.Critical) {
+			t.Errorf("expected the triggered result to be published as critical, got %s", published.Status)
+		}
+	default:
+		t.Error("expected the triggered result to be published")
+	}
+
+	_, err = registry.CheckNow("bar")
+	if err != ErrPodNotMonitored {
+		t.Errorf("expected checking an unknown pod to fail with %q, got %v", ErrPodNotMonitored, err)
+	}
+}
+
+func TestServeCheck(t *testing.T) {
+	registry := NewHealthRegistry()
+	trigger := make(chan chan checkResponse)
+	registry.add(StatusChecker{ID: "foo"}, trigger)
+	go func() {
+		respCh := <-trigger
+		respCh <- checkResponse{result: health.Result{ID: "foo", Status: health.Passing}}
+	}()
+
+	rec := httptest.NewRecorder()
+	registry.ServeCheck(rec, httptest.NewRequest("POST", "/_health/check?pod=foo", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var res health.Result
+	err := json.NewDecoder(rec.Body).Decode(&res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ID != "foo" || res.Status != health.Passing {
+		t.Errorf("expected foo to be passing, got %+v", res)
+	}
+
+	rec = httptest.NewRecorder()
+	registry.ServeCheck(rec, httptest.NewRequest("POST", "/_health/check?pod=bar", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for a pod that isn't monitored, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	registry.ServeCheck(rec, httptest.NewRequest("GET", "/_health/check?pod=foo", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405 for a GET, got %d", rec.Code)
+	}
+}
+
+func TestObserve(t *testing.T) {
+	registry := NewHealthRegistry()
+	var observed []health.Result
+	registry.Observe(func(res health.Result) {
+		observed = append(observed, res)
+	})
+	registry.set(health.Result{ID: "foo", Status: health.Critical})
+	if len(observed) != 1 || observed[0].ID != "foo" || observed[0].Status != health.Critical {
+		t.Errorf("expected the result of foo to be observed, got %v", observed)
+	}
+}
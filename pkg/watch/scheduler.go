@@ -0,0 +1,109 @@
+package watch
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/square/p2/pkg/util/param"
+)
+
+// Fraction of the gap between two consecutive checks of a node by which each
+// check is randomly delayed
+var HEALTHCHECK_JITTER = param.Float64("healthcheck_jitter", 0.5)
+
+// checkScheduler spreads the checks of a node's pods evenly across their
+// interval, so that hundreds of pods checked every second don't all fire on
+// the same tick. The checks that share an interval each get a slot of it, in
+// the order they were scheduled, and each check is delayed by a random
+// jitter within its slot. The slots are laid out from a random epoch, so
+// different nodes don't check in lockstep either.
+//
+// Slots are recomputed as checks come and go, so a check may run somewhat
+// early or late once when that happens.
+type checkScheduler struct {
+	mu     sync.Mutex
+	epoch  time.Time
+	rand   *rand.Rand
+	checks map[time.Duration][]*scheduledCheck
+}
+
+// scheduledCheck is a check's handle on its slot
+type scheduledCheck struct {
+	interval time.Duration
+}
+
+func newCheckScheduler() *checkScheduler {
+	seed := time.Now().UnixNano()
+	r := rand.New(rand.NewSource(seed))
+	return &checkScheduler{
+		epoch:  time.Now().Add(-time.Duration(r.Int63n(int64(time.Hour)))),
+		rand:   r,
+		checks: make(map[time.Duration][]*scheduledCheck),
+	}
+}
+
+// add gives a check with the given interval a slot
+func (s *checkScheduler) add(interval time.Duration) *scheduledCheck {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	check := &scheduledCheck{interval: interval}
+	s.checks[interval] = append(s.checks[interval], check)
+	return check
+}
+
+// remove frees the slot of a check
+func (s *checkScheduler) remove(check *scheduledCheck) {
+	if s == nil || check == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	checks := s.checks[check.interval]
+	for i, c := range checks {
+		if c == check {
+			checks = append(checks[:i], checks[i+1:]...)
+			break
+		}
+	}
+	if len(checks) == 0 {
+		delete(s.checks, check.interval)
+	} else {
+		s.checks[check.interval] = checks
+	}
+}
+
+// next returns how long to wait from now until the check should run again.
+// Without a scheduler, the check simply runs every interval.
+func (s *checkScheduler) next(check *scheduledCheck, interval time.Duration, now time.Time) time.Duration {
+	if s == nil || check == nil {
+		return interval
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	checks := s.checks[check.interval]
+	slot := -1
+	for i, c := range checks {
+		if c == check {
+			slot = i
+			break
+		}
+	}
+	if slot < 0 {
+		return interval
+	}
+
+	gap := check.interval / time.Duration(len(checks))
+	offset := gap * time.Duration(slot)
+	if maxJitter := int64(float64(gap) * *HEALTHCHECK_JITTER); maxJitter > 0 {
+		offset += time.Duration(s.rand.Int63n(maxJitter))
+	}
+	wait := offset - now.Sub(s.epoch)%check.interval
+	for wait <= 0 {
+		wait += check.interval
+	}
+	return wait
+}
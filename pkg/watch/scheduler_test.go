@@ -0,0 +1,69 @@
+package watch
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestCheckSchedulerSpreadsChecks(t *testing.T) {
+	jitter := *HEALTHCHECK_JITTER
+	defer func() { *HEALTHCHECK_JITTER = jitter }()
+	*HEALTHCHECK_JITTER = 0
+
+	s := newCheckScheduler()
+	interval := 4 * time.Second
+	var checks []*scheduledCheck
+	for i := 0; i < 4; i++ {
+		checks = append(checks, s.add(interval))
+	}
+
+	now := time.Now()
+	var waits []time.Duration
+	for _, check := range checks {
+		wait := s.next(check, interval, now)
+		if wait <= 0 || wait > interval {
+			t.Fatalf("Expected a wait within the interval, got %s", wait)
+		}
+		waits = append(waits, wait)
+	}
+	sort.Slice(waits, func(i, j int) bool { return waits[i] < waits[j] })
+	for i := 1; i < len(waits); i++ {
+		if gap := waits[i] - waits[i-1]; gap != time.Second {
+			t.Errorf("Expected checks to be a second apart, got %s between %s and %s", gap, waits[i-1], waits[i])
+		}
+	}
+
+	// the remaining checks spread out over the freed slots
+	s.remove(checks[1])
+	s.remove(checks[3])
+	first := s.next(checks[0], interval, now)
+	second := s.next(checks[2], interval, now)
+	if gap := (second - first + interval) % interval; gap != 2*time.Second {
+		t.Errorf("Expected the remaining checks to be two seconds apart, got %s", gap)
+	}
+}
+
+func TestCheckSchedulerJitter(t *testing.T) {
+	s := newCheckScheduler()
+	interval := time.Second
+	check := s.add(interval)
+	s.add(interval)
+
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		wait := s.next(check, interval, now)
+		if wait <= 0 || wait > interval {
+			t.Fatalf("Expected a wait within the interval, got %s", wait)
+		}
+	}
+}
+
+func TestNoCheckScheduler(t *testing.T) {
+	var s *checkScheduler
+	check := s.add(time.Second)
+	if wait := s.next(check, 3*time.Second, time.Now()); wait != 3*time.Second {
+		t.Errorf("Expected checks to run every interval without a scheduler, got %s", wait)
+	}
+	s.remove(check)
+}
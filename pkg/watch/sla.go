@@ -0,0 +1,106 @@
+package watch
+
+import (
+	"sort"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/manifest"
+)
+
+// slaBudget derives a pod's health from its last checks, per the SLA of its
+// manifest: see manifest.SLAStanza. It keeps whether each of the last window
+// checks passed and how long it took.
+//
+// It is only used from the goroutine monitoring the pod, so it isn't locked.
+type slaBudget struct {
+	window int
+
+	warningSuccessRate  float64
+	criticalSuccessRate float64
+	warningLatency      time.Duration
+	criticalLatency     time.Duration
+
+	// A ring of the last window checks, next is where the next one goes
+	passed    []bool
+	latencies []time.Duration
+	next      int
+}
+
+func newSLABudget(sla manifest.SLAStanza) *slaBudget {
+	// Validation has already rejected bad durations
+	warning, critical, _ := sla.GetP95Latencies()
+	return &slaBudget{
+		window:              sla.Window,
+		warningSuccessRate:  sla.WarningSuccessRate,
+		criticalSuccessRate: sla.CriticalSuccessRate,
+		warningLatency:      warning,
+		criticalLatency:     critical,
+	}
+}
+
+// apply records a check that took latency and produced res, then reports a
+// passing res as warning or critical if the last checks don't meet the
+// budget. Results that aren't passing are reported as they are.
+func (b *slaBudget) apply(res *health.Result, latency time.Duration) {
+	if b == nil {
+		return
+	}
+	b.record(res.Status == health.Passing, latency)
+	if res.Status != health.Passing {
+		return
+	}
+
+	if len(b.passed) < b.window {
+		res.Status = health.Warning
+		res.Reason = health.ReasonSLAPending
+		return
+	}
+	successRate := b.successRate()
+	p95 := b.p95Latency()
+	switch {
+	case successRate < b.criticalSuccessRate:
+		res.Status = health.Critical
+		res.Reason = health.ReasonSLASuccessRate
+	case b.criticalLatency > 0 && p95 > b.criticalLatency:
+		res.Status = health.Critical
+		res.Reason = health.ReasonSLALatency
+	case successRate < b.warningSuccessRate:
+		res.Status = health.Warning
+		res.Reason = health.ReasonSLASuccessRate
+	case b.warningLatency > 0 && p95 > b.warningLatency:
+		res.Status = health.Warning
+		res.Reason = health.ReasonSLALatency
+	}
+}
+
+func (b *slaBudget) record(passed bool, latency time.Duration) {
+	if len(b.passed) < b.window {
+		b.passed = append(b.passed, passed)
+		b.latencies = append(b.latencies, latency)
+		return
+	}
+	b.passed[b.next] = passed
+	b.latencies[b.next] = latency
+	b.next = (b.next + 1) % b.window
+}
+
+// successRate returns the share of the recorded checks that passed
+func (b *slaBudget) successRate() float64 {
+	passed := 0
+	for _, p := range b.passed {
+		if p {
+			passed++
+		}
+	}
+	return float64(passed) / float64(len(b.passed))
+}
+
+// p95Latency returns the 95th percentile of the latencies of the recorded
+// checks, by the nearest rank method
+func (b *slaBudget) p95Latency() time.Duration {
+	sorted := append([]time.Duration(nil), b.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := (len(sorted)*95 + 99) / 100
+	return sorted[rank-1]
+}
@@ -0,0 +1,78 @@
+package watch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/manifest"
+)
+
+func TestSLABudget(t *testing.T) {
+	b := newSLABudget(manifest.SLAStanza{
+		Window:              4,
+		WarningSuccessRate:  1,
+		CriticalSuccessRate: 0.6,
+		WarningP95Latency:   "100ms",
+		CriticalP95Latency:  "1s",
+	})
+	fast := 10 * time.Millisecond
+	steps := []struct {
+		status   health.HealthState
+		latency  time.Duration
+		reported health.HealthState
+		reason   health.Reason
+	}{
+		// the budget isn't known until the window is full
+		{health.Passing, fast, health.Warning, health.ReasonSLAPending},
+		{health.Passing, fast, health.Warning, health.ReasonSLAPending},
+		{health.Passing, fast, health.Warning, health.ReasonSLAPending},
+		{health.Passing, fast, health.Passing, ""},
+		// failures are reported as they are
+		{health.Critical, fast, health.Critical, health.ReasonTimeout},
+		// 3 of the last 4 passed
+		{health.Passing, fast, health.Warning, health.ReasonSLASuccessRate},
+		{health.Critical, fast, health.Critical, health.ReasonTimeout},
+		{health.Critical, fast, health.Critical, health.ReasonTimeout},
+		// 2 of the last 4 passed
+		{health.Passing, fast, health.Critical, health.ReasonSLASuccessRate},
+		{health.Passing, fast, health.Critical, health.ReasonSLASuccessRate},
+		{health.Passing, fast, health.Warning, health.ReasonSLASuccessRate},
+		{health.Passing, fast, health.Passing, ""},
+		// a single slow check is the 95th percentile of 4
+		{health.Passing, 200 * time.Millisecond, health.Warning, health.ReasonSLALatency},
+		{health.Passing, 2 * time.Second, health.Critical, health.ReasonSLALatency},
+		// until it's no longer one of the last 4
+		{health.Passing, fast, health.Critical, health.ReasonSLALatency},
+		{health.Passing, fast, health.Critical, health.ReasonSLALatency},
+		{health.Passing, fast, health.Critical, health.ReasonSLALatency},
+		{health.Passing, fast, health.Passing, ""},
+	}
+	for i, step := range steps {
+		res := health.Result{Status: step.status}
+		if step.status == health.Critical {
+			res.Reason = health.ReasonTimeout
+		}
+		b.apply(&res, step.latency)
+		if res.Status != step.reported || res.Reason != step.reason {
+			t.Errorf("step %d: expected %s to be reported as %s (%s), got %s (%s)", i, step.status, step.reported, step.reason, res.Status, res.Reason)
+		}
+	}
+
+	var none *slaBudget
+	res := health.Result{Status: health.Passing}
+	none.apply(&res, time.Hour)
+	if res.Status != health.Passing {
+		t.Errorf("expected no budget to leave the result alone, got %s", res.Status)
+	}
+}
+
+func TestP95Latency(t *testing.T) {
+	b := newSLABudget(manifest.SLAStanza{Window: 100})
+	for i := 1; i <= 100; i++ {
+		b.record(true, time.Duration(i)*time.Millisecond)
+	}
+	if p95 := b.p95Latency(); p95 != 95*time.Millisecond {
+		t.Errorf("expected the 95th percentile of 1ms to 100ms to be 95ms, got %s", p95)
+	}
+}
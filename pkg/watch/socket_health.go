@@ -0,0 +1,36 @@
+package watch
+
+import (
+	"net"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/pods"
+)
+
+// podHome returns the home directory of a pod installed under podRoot
+func podHome(man manifest.Manifest, podRoot string) string {
+	if podRoot == "" {
+		podRoot = pods.DefaultPath
+	}
+	return filepath.Join(podRoot, pods.ComputeUniqueName(man.ID(), ""))
+}
+
+// unixSocketClient returns an HTTP client that makes every request over the
+// unix socket at socket, whatever the host of the request is. Connections
+// aren't kept alive, so that nothing is left open when the pod's checker is
+// replaced.
+func unixSocketClient(socket string) *http.Client {
+	timeout := time.Duration(*HEALTHCHECK_TIMEOUT) * time.Second
+	return &http.Client{
+		Transport: &http.Transport{
+			Dial: func(_, _ string) (net.Conn, error) {
+				return net.DialTimeout("unix", socket, timeout)
+			},
+			DisableKeepAlives: true,
+		},
+		Timeout: timeout,
+	}
+}
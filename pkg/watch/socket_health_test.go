@@ -0,0 +1,84 @@
+package watch
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+)
+
+func TestSocketStatusCheck(t *testing.T) {
+	testSocketStatusCheck(t, `
+id: thepod
+status:
+  socket: run/status.sock
+  path: /healthz
+`)
+}
+
+func TestSocketStatusCheckWithTimeout(t *testing.T) {
+	// the timeout must not make the check go over TCP instead of the socket
+	testSocketStatusCheck(t, `
+id: thepod
+status:
+  socket: run/status.sock
+  path: /healthz
+  timeout: 2s
+`)
+}
+
+func testSocketStatusCheck(t *testing.T, manifestYAML string) {
+	podRoot, err := ioutil.TempDir("", "pods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(podRoot)
+
+	man, err := manifest.FromBytes([]byte(manifestYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(podHome(man, podRoot), "run", "status.sock")
+	if err = os.MkdirAll(filepath.Dir(socket), 0755); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})}
+	go server.Serve(listener)
+
+	checks := checkClients{secure: http.DefaultClient, insecure: http.DefaultClient, podRoot: podRoot}
+	logger := logging.TestLogger()
+	sc := checks.newStatusChecker(man, "node1", man.GetStatusStanza(), &logger)
+	res, err := sc.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != health.Passing {
+		t.Errorf("expected the socket to be checked, got %s (%s)", res.Status, res.Reason)
+	}
+	if res.Check.Socket != socket {
+		t.Errorf("expected the check config to include the socket %s, got %s", socket, res.Check.Socket)
+	}
+
+	server.Close()
+	res, err = sc.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != health.Critical {
+		t.Errorf("expected a closed socket to be critical, got %s", res.Status)
+	}
+}
@@ -0,0 +1,79 @@
+package watch
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/srv"
+	"github.com/square/p2/pkg/types"
+)
+
+// SRVSync keeps the SRV records published for a node in sync with the pods
+// in its reality tree and their health. Only the records of passing pods are
+// published, and they are republished whenever that set changes.
+type SRVSync struct {
+	publisher srv.Publisher
+	logger    *logging.Logger
+
+	mu      sync.Mutex
+	records map[types.PodID][]srv.Record
+	healthy map[types.PodID]bool
+
+	// The records last published successfully, nil until the first publish
+	// succeeds
+	published []srv.Record
+}
+
+func NewSRVSync(publisher srv.Publisher, logger *logging.Logger) *SRVSync {
+	return &SRVSync{
+		publisher: publisher,
+		logger:    logger,
+		records:   make(map[types.PodID][]srv.Record),
+		healthy:   make(map[types.PodID]bool),
+	}
+}
+
+// set records a pod's latest records and health check result, and
+// republishes if needed
+func (s *SRVSync) set(id types.PodID, records []srv.Record, res health.Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[id] = records
+	s.healthy[id] = res.ReadinessStatus() == health.Passing
+	s.publish()
+}
+
+// remove stops publishing a pod's records
+func (s *SRVSync) remove(id types.PodID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, id)
+	delete(s.healthy, id)
+	s.publish()
+}
+
+// publish publishes the records of the healthy pods if they differ from what
+// was last published. If publishing fails, it is retried on the next call.
+func (s *SRVSync) publish() {
+	records := []srv.Record{}
+	for id, podRecords := range s.records {
+		if s.healthy[id] {
+			records = append(records, podRecords...)
+		}
+	}
+	srv.SortRecords(records)
+	if s.published != nil && reflect.DeepEqual(records, s.published) {
+		return
+	}
+
+	err := s.publisher.Publish(records)
+	if err != nil {
+		s.logger.WithError(err).Warningln("failed to publish SRV records, will retry")
+		return
+	}
+	s.published = records
+}
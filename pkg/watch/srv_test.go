@@ -0,0 +1,70 @@
+package watch
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/srv"
+)
+
+type fakePublisher struct {
+	published [][]srv.Record
+	err       error
+}
+
+func (f *fakePublisher) Publish(records []srv.Record) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.published = append(f.published, records)
+	return nil
+}
+
+func TestSRVSyncPublishesHealthyPods(t *testing.T) {
+	logger := logging.TestLogger()
+	publisher := &fakePublisher{}
+	sync := NewSRVSync(publisher, &logger)
+
+	web := []srv.Record{{PodID: "web", Node: "node1", PortName: "http", Port: 8080}}
+	worker := []srv.Record{{PodID: "worker", Node: "node1", PortName: "rpc", Port: 9090}}
+
+	sync.set("web", web, health.Result{ID: "web", Status: health.Passing})
+	sync.set("worker", worker, health.Result{ID: "worker", Status: health.Critical})
+	if len(publisher.published) != 1 || !reflect.DeepEqual(publisher.published[0], web) {
+		t.Fatalf("expected only the healthy pod's records to be published once, got %+v", publisher.published)
+	}
+
+	// unchanged results aren't republished
+	sync.set("web", web, health.Result{ID: "web", Status: health.Passing})
+	if len(publisher.published) != 1 {
+		t.Fatalf("expected no republish without changes, got %+v", publisher.published)
+	}
+
+	sync.set("worker", worker, health.Result{ID: "worker", Status: health.Passing})
+	if latest := publisher.published[len(publisher.published)-1]; !reflect.DeepEqual(latest, append(web, worker...)) {
+		t.Errorf("expected both pods to be published once healthy, got %+v", latest)
+	}
+
+	sync.remove("web")
+	if latest := publisher.published[len(publisher.published)-1]; !reflect.DeepEqual(latest, worker) {
+		t.Errorf("expected the removed pod's records to be unpublished, got %+v", latest)
+	}
+}
+
+func TestSRVSyncRetriesFailedPublishes(t *testing.T) {
+	logger := logging.TestLogger()
+	publisher := &fakePublisher{err: errors.New("dns provider unavailable")}
+	sync := NewSRVSync(publisher, &logger)
+
+	web := []srv.Record{{PodID: "web", Node: "node1", PortName: "http", Port: 8080}}
+	sync.set("web", web, health.Result{ID: "web", Status: health.Passing})
+
+	publisher.err = nil
+	sync.set("web", web, health.Result{ID: "web", Status: health.Passing})
+	if len(publisher.published) != 1 || !reflect.DeepEqual(publisher.published[0], web) {
+		t.Errorf("expected the records to be published on the next check after a failure, got %+v", publisher.published)
+	}
+}
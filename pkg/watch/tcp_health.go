@@ -0,0 +1,48 @@
+package watch
+
+import (
+	"net"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+)
+
+// TCPCheck checks a pod's health by opening a connection to its status port.
+// The pod is healthy as long as the connection is accepted, nothing is sent
+// over it.
+type TCPCheck struct {
+	// The "host:port" that is connected to
+	Target string
+
+	// If set, the connection is made to this address instead of the host
+	// of Target
+	Address string
+}
+
+// Check opens a connection to the target and closes it again
+func (c *TCPCheck) Check() error {
+	target := c.Target
+	if c.Address != "" {
+		target = pinAddress(target, c.Address)
+	}
+	conn, err := net.DialTimeout("tcp", target, time.Duration(*HEALTHCHECK_TIMEOUT)*time.Second)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func (sc *StatusChecker) resultFromTCPCheck(err error) (health.Result, error) {
+	res := health.Result{
+		ID:      sc.ID,
+		Node:    sc.Node,
+		Service: string(sc.ID),
+		Check:   sc.Config(),
+		Status:  health.Passing,
+	}
+	if err != nil {
+		res.Status = health.Critical
+		res.Reason = requestErrorReason(err)
+	}
+	return res, nil
+}
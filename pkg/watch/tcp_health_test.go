@@ -0,0 +1,62 @@
+package watch
+
+import (
+	"net"
+	"testing"
+
+	"github.com/square/p2/pkg/health"
+)
+
+func TestTCPCheck(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+
+	sc := StatusChecker{ID: "foo", TCP: &TCPCheck{Target: addr}}
+	res, err := sc.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != health.Passing {
+		t.Errorf("expected a listening port to be passing, got %s (%s)", res.Status, res.Reason)
+	}
+	if res.Check.URI != "tcp://"+addr {
+		t.Errorf("expected the check URI to be tcp://%s, got %s", addr, res.Check.URI)
+	}
+
+	listener.Close()
+	res, err = sc.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != health.Critical || res.Reason != health.ReasonConnectionRefused {
+		t.Errorf("expected a closed port to be critical with reason %s, got %s (%s)", health.ReasonConnectionRefused, res.Status, res.Reason)
+	}
+}
+
+func TestTCPCheckAtAddress(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sc := StatusChecker{
+		ID:        "foo",
+		TCP:       &TCPCheck{Target: net.JoinHostPort("unresolvable.invalid", port)},
+		Addresses: []string{"127.0.0.1"},
+	}
+	res, err := sc.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != health.Passing {
+		t.Errorf("expected the pinned address to be checked, got %s (%s)", res.Status, res.Reason)
+	}
+}
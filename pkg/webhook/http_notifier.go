@@ -0,0 +1,189 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	// Events queued beyond this are dropped rather than blocking the
+	// orchestrator
+	queueSize = 256
+
+	deliveryAttempts = 4
+	initialBackoff   = 1 * time.Second
+)
+
+// Subset of *http.Client functionality, useful for testing
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+type delivery struct {
+	endpoint Endpoint
+	event    Event
+}
+
+// HTTPNotifier POSTs events to the endpoints of a Config. Events are queued
+// by Notify and delivered in order by Start, with retries.
+type HTTPNotifier struct {
+	endpoints []Endpoint
+	client    Doer
+	logger    logging.Logger
+	queue     chan delivery
+
+	// backoff is the wait before the first retry, doubled for every
+	// following retry
+	backoff time.Duration
+
+	// counts the deliveries that are queued or in progress, see Flush
+	pending sync.WaitGroup
+}
+
+var _ Notifier = &HTTPNotifier{}
+
+func NewHTTPNotifier(config Config, client Doer, logger logging.Logger) *HTTPNotifier {
+	return &HTTPNotifier{
+		endpoints: config.Endpoints,
+		client:    client,
+		logger:    logger,
+		queue:     make(chan delivery, queueSize),
+		backoff:   initialBackoff,
+	}
+}
+
+func (n *HTTPNotifier) Notify(event Event) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	for _, endpoint := range n.endpoints {
+		if !endpoint.wants(event.Type) {
+			continue
+		}
+
+		n.pending.Add(1)
+		select {
+		case n.queue <- delivery{endpoint: endpoint, event: event}:
+		default:
+			n.pending.Done()
+			n.logger.WithFields(logrus.Fields{
+				"url":   endpoint.URL,
+				"event": event.Type,
+			}).Warnln("Webhook queue is full, dropping event")
+		}
+	}
+}
+
+// Start delivers queued events until quit is closed
+func (n *HTTPNotifier) Start(quit <-chan struct{}) {
+	for {
+		select {
+		case <-quit:
+			return
+		case d := <-n.queue:
+			n.deliver(d, quit)
+			n.pending.Done()
+		}
+	}
+}
+
+// Flush waits up to timeout for the queued events to be delivered or given up
+// on, and returns whether they all were. It's meant for commands that exit
+// once their deployment is done, and must not be called concurrently with
+// Notify.
+func (n *HTTPNotifier) Flush(timeout time.Duration) bool {
+	flushed := make(chan struct{})
+	go func() {
+		n.pending.Wait()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (n *HTTPNotifier) deliver(d delivery, quit <-chan struct{}) {
+	body, err := json.Marshal(d.event)
+	if err != nil {
+		n.logger.WithError(err).Errorln("Could not marshal webhook event")
+		return
+	}
+
+	logger := n.logger.SubLogger(logrus.Fields{
+		"url":           d.endpoint.URL,
+		"event":         d.event.Type,
+		"deployment_id": d.event.DeploymentID,
+	})
+	backoff := n.backoff
+	for attempt := 1; ; attempt++ {
+		err = n.post(d.endpoint, d.event.Type, body)
+		if err == nil {
+			return
+		}
+		if attempt == deliveryAttempts {
+			logger.WithError(err).Errorf("Giving up on webhook after %d attempts", attempt)
+			return
+		}
+
+		logger.WithError(err).Warnf("Webhook delivery failed, retrying in %s", backoff)
+		select {
+		case <-quit:
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (n *HTTPNotifier) post(endpoint Endpoint, eventType EventType, body []byte) error {
+	req, err := http.NewRequest("POST", endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-P2-Event", string(eventType))
+	req.Header.Set("X-P2-Signature", Sign(endpoint.Secret, body))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// drain the body so the connection can be reused
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return util.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the value of the X-P2-Signature header for a request body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify returns whether signature is a valid X-P2-Signature header for a
+// request body. It is meant for receivers written in Go.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
@@ -0,0 +1,148 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+)
+
+type received struct {
+	event     Event
+	eventType string
+	verified  bool
+}
+
+func newReceiver(t *testing.T, secret string, failures int) (*httptest.Server, <-chan received) {
+	ch := make(chan received, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("Could not read webhook body: %s", err)
+			return
+		}
+		var event Event
+		err = json.Unmarshal(body, &event)
+		if err != nil {
+			t.Errorf("Could not unmarshal webhook body: %s", err)
+			return
+		}
+		ch <- received{
+			event:     event,
+			eventType: r.Header.Get("X-P2-Event"),
+			verified:  Verify(secret, body, r.Header.Get("X-P2-Signature")),
+		}
+	}))
+	return server, ch
+}
+
+func waitForEvent(t *testing.T, ch <-chan received) received {
+	select {
+	case r := <-ch:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for webhook")
+	}
+	return received{}
+}
+
+func TestNotifySignsEvents(t *testing.T) {
+	server, ch := newReceiver(t, "s3cret", 0)
+	defer server.Close()
+
+	notifier := NewHTTPNotifier(Config{Endpoints: []Endpoint{{URL: server.URL, Secret: "s3cret"}}}, http.DefaultClient, logging.TestLogger())
+	quit := make(chan struct{})
+	defer close(quit)
+	go notifier.Start(quit)
+
+	notifier.Notify(Event{Type: EventStarted, Orchestrator: "roll_farm", DeploymentID: "some_rc", PodID: "web"})
+	r := waitForEvent(t, ch)
+	if !r.verified {
+		t.Error("Expected the webhook signature to verify")
+	}
+	if r.eventType != string(EventStarted) || r.event.Type != EventStarted {
+		t.Errorf("Expected a %s event, got header %q and payload %q", EventStarted, r.eventType, r.event.Type)
+	}
+	if r.event.DeploymentID != "some_rc" || r.event.PodID != "web" {
+		t.Errorf("Unexpected event payload %+v", r.event)
+	}
+	if r.event.Timestamp.IsZero() {
+		t.Error("Expected the event to be timestamped")
+	}
+
+	if Verify("wrong", []byte("{}"), Sign("s3cret", []byte("{}"))) {
+		t.Error("Expected a signature made with another secret not to verify")
+	}
+}
+
+func TestNotifyRetriesFailedDeliveries(t *testing.T) {
+	server, ch := newReceiver(t, "s3cret", deliveryAttempts-1)
+	defer server.Close()
+
+	notifier := NewHTTPNotifier(Config{Endpoints: []Endpoint{{URL: server.URL, Secret: "s3cret"}}}, http.DefaultClient, logging.TestLogger())
+	notifier.backoff = time.Millisecond
+	quit := make(chan struct{})
+	defer close(quit)
+	go notifier.Start(quit)
+
+	notifier.Notify(Event{Type: EventAborted})
+	r := waitForEvent(t, ch)
+	if r.event.Type != EventAborted {
+		t.Errorf("Expected the event to be delivered after retries, got %+v", r.event)
+	}
+}
+
+func TestNotifyFiltersEvents(t *testing.T) {
+	server, ch := newReceiver(t, "s3cret", 0)
+	defer server.Close()
+
+	notifier := NewHTTPNotifier(Config{Endpoints: []Endpoint{{
+		URL:    server.URL,
+		Secret: "s3cret",
+		Events: []EventType{EventSucceeded},
+	}}}, http.DefaultClient, logging.TestLogger())
+	quit := make(chan struct{})
+	defer close(quit)
+	go notifier.Start(quit)
+
+	notifier.Notify(Event{Type: EventPaused})
+	notifier.Notify(Event{Type: EventSucceeded})
+	r := waitForEvent(t, ch)
+	if r.event.Type != EventSucceeded {
+		t.Errorf("Expected only the subscribed event to be delivered, got %s", r.event.Type)
+	}
+}
+
+func TestFlushWaitsForDeliveries(t *testing.T) {
+	server, ch := newReceiver(t, "s3cret", 1)
+	defer server.Close()
+
+	notifier := NewHTTPNotifier(Config{Endpoints: []Endpoint{{URL: server.URL, Secret: "s3cret"}}}, http.DefaultClient, logging.TestLogger())
+	notifier.backoff = 10 * time.Millisecond
+	quit := make(chan struct{})
+	defer close(quit)
+	go notifier.Start(quit)
+
+	notifier.Notify(Event{Type: EventSucceeded})
+	if !notifier.Flush(5 * time.Second) {
+		t.Fatal("Expected the event to be delivered before the flush timed out")
+	}
+	select {
+	case r := <-ch:
+		if r.event.Type != EventSucceeded {
+			t.Errorf("Expected a %s event, got %+v", EventSucceeded, r.event)
+		}
+	default:
+		t.Error("Expected the event to have been delivered when Flush returned")
+	}
+}
@@ -0,0 +1,136 @@
+// Package webhook notifies external systems, such as chatops bots or
+// ticketing systems, of the progress of deployments. Events are POSTed as
+// JSON to configured endpoints and signed with a per-endpoint HMAC secret so
+// that receivers can verify they came from P2.
+package webhook
+
+import (
+	"io/ioutil"
+	"time"
+
+	"github.com/square/p2/pkg/util"
+
+	"gopkg.in/yaml.v2"
+)
+
+// EventType is a stage in the lifecycle of a deployment
+type EventType string
+
+const (
+	// A deployment started making changes
+	EventStarted EventType = "started"
+
+	// A batch of nodes was deployed and became healthy
+	EventBatchCompleted EventType = "batch_completed"
+
+	// A deployment is blocked waiting for nodes to become healthy
+	EventPaused EventType = "paused"
+
+	// A deployment was canceled before it completed
+	EventAborted EventType = "aborted"
+
+	// A deployment failed and its changes were reverted
+	EventRolledBack EventType = "rolled_back"
+
+	// A deployment completed
+	EventSucceeded EventType = "succeeded"
+)
+
+var eventTypes = map[EventType]bool{
+	EventStarted:        true,
+	EventBatchCompleted: true,
+	EventPaused:         true,
+	EventAborted:        true,
+	EventRolledBack:     true,
+	EventSucceeded:      true,
+}
+
+// Event is the payload sent to webhook endpoints
+type Event struct {
+	Type      EventType `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// Orchestrator names the component running the deployment, e.g.
+	// "roll_farm"
+	Orchestrator string `json:"orchestrator"`
+
+	// DeploymentID identifies the deployment among those of its
+	// orchestrator, e.g. the ID of a rolling update
+	DeploymentID string `json:"deployment_id"`
+
+	PodID string `json:"pod_id,omitempty"`
+
+	// Message is a human readable description of the event, suitable for
+	// posting to a chat channel
+	Message string `json:"message,omitempty"`
+
+	// Details holds orchestrator specific information, such as node counts
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Notifier sends deployment events to webhooks
+type Notifier interface {
+	// Notify sends an event without blocking. Delivery is best-effort:
+	// failures are logged rather than returned, since webhooks must never
+	// hold up a deployment.
+	Notify(event Event)
+}
+
+// Endpoint is a URL that receives events
+type Endpoint struct {
+	URL string `yaml:"url"`
+
+	// Secret is the key used to sign the events sent to the endpoint. The
+	// signature is sent in the X-P2-Signature header as "sha256=" followed
+	// by the hex encoded HMAC-SHA256 of the request body.
+	Secret string `yaml:"secret"`
+
+	// Events lists the event types sent to the endpoint. If empty, every
+	// event is sent.
+	Events []EventType `yaml:"events,omitempty"`
+}
+
+func (e Endpoint) wants(eventType EventType) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, t := range e.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type Config struct {
+	Endpoints []Endpoint `yaml:"endpoints"`
+}
+
+// LoadConfig reads a YAML webhook config from the given path
+func LoadConfig(path string) (Config, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, util.Errorf("could not read webhook config: %s", err)
+	}
+
+	var config Config
+	err = yaml.Unmarshal(bytes, &config)
+	if err != nil {
+		return Config{}, util.Errorf("could not parse webhook config %s: %s", path, err)
+	}
+
+	for i, endpoint := range config.Endpoints {
+		if endpoint.URL == "" {
+			return Config{}, util.Errorf("webhook endpoint %d has no url", i)
+		}
+		if endpoint.Secret == "" {
+			return Config{}, util.Errorf("webhook endpoint %s has no secret", endpoint.URL)
+		}
+		for _, t := range endpoint.Events {
+			if !eventTypes[t] {
+				return Config{}, util.Errorf("webhook endpoint %s subscribes to unknown event %q", endpoint.URL, t)
+			}
+		}
+	}
+	return config, nil
+}
@@ -0,0 +1,65 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfig(t *testing.T, contents string) (string, func()) {
+	dir, err := ioutil.TempDir("", "webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "webhooks.yaml")
+	err = ioutil.WriteFile(path, []byte(contents), 0600)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestLoadConfig(t *testing.T) {
+	path, cleanup := writeConfig(t, `
+endpoints:
+- url: https://chat.example.com/hooks/deploys
+  secret: s3cret
+- url: https://tickets.example.com/p2
+  secret: other
+  events: [aborted, rolled_back]
+`)
+	defer cleanup()
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Unexpected error loading config: %s", err)
+	}
+	if len(config.Endpoints) != 2 {
+		t.Fatalf("Expected 2 endpoints, got %d", len(config.Endpoints))
+	}
+
+	chat, tickets := config.Endpoints[0], config.Endpoints[1]
+	if !chat.wants(EventBatchCompleted) {
+		t.Error("Expected an endpoint without an event list to want every event")
+	}
+	if !tickets.wants(EventAborted) || tickets.wants(EventSucceeded) {
+		t.Errorf("Expected an endpoint to want exactly its listed events, got %v", tickets.Events)
+	}
+}
+
+func TestLoadConfigRejectsInvalidEndpoints(t *testing.T) {
+	for _, contents := range []string{
+		"endpoints:\n- secret: s3cret\n",
+		"endpoints:\n- url: https://chat.example.com\n",
+		"endpoints:\n- url: https://chat.example.com\n  secret: s3cret\n  events: [exploded]\n",
+	} {
+		path, cleanup := writeConfig(t, contents)
+		_, err := LoadConfig(path)
+		cleanup()
+		if err == nil {
+			t.Errorf("Expected an error loading config %q", contents)
+		}
+	}
+}